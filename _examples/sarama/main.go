@@ -121,6 +121,7 @@ func setup() (*jocko.Server, func()) {
 		cfg.Bootstrap = true
 		cfg.BootstrapExpect = 1
 		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
 	}, nil)
 	if err := c.Start(context.Background()); err != nil {
 		fmt.Fprintf(os.Stderr, "failed to start cluster: %v\n", err)
@@ -0,0 +1,234 @@
+// Package client implements a client for Jocko (and Kafka) clusters, built on the jocko package's
+// connections.
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/travisjeffery/jocko/jocko"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+var (
+	// ErrClosed is returned by clients, and the producers and consumers using them, once closed.
+	ErrClosed = errors.New("client: closed")
+	// ErrNoBrokers is returned when none of the brokers could be reached for metadata.
+	ErrNoBrokers = errors.New("client: no brokers available")
+)
+
+// Config configures clients.
+type Config struct {
+	// Brokers are the addresses of the brokers to bootstrap the cluster's metadata from.
+	Brokers []string
+	// Dialer dials the brokers. Defaults to a dialer with the client ID "jocko-client".
+	Dialer *jocko.Dialer
+	// MetadataMaxAge is how long topics' metadata is cached before it's refreshed. Topics whose
+	// leaders return errors are refreshed before then.
+	MetadataMaxAge time.Duration
+	// MetadataRefreshBackoff is the least time between refreshes of a topic's metadata, so
+	// repeated leader errors, like during an election, don't hammer the brokers.
+	MetadataRefreshBackoff time.Duration
+}
+
+// Client caches the cluster's metadata and a connection to each broker, shared by the producers
+// and consumers created with it. It's safe for concurrent use.
+type Client struct {
+	config Config
+	dialer *jocko.Dialer
+
+	mu sync.Mutex
+	// brokers are the brokers' addresses by node ID, from the last metadata response.
+	brokers map[int32]string
+	conns   map[string]*jocko.Conn
+	topics  map[string]*topicEntry
+	closed  bool
+}
+
+// New returns a client for the cluster with the brokers in the config.
+func New(config Config) (*Client, error) {
+	if len(config.Brokers) == 0 {
+		return nil, errors.New("client: no brokers given")
+	}
+	if config.Dialer == nil {
+		config.Dialer = jocko.NewDialer("jocko-client")
+	}
+	if config.MetadataMaxAge == 0 {
+		config.MetadataMaxAge = 5 * time.Minute
+	}
+	if config.MetadataRefreshBackoff == 0 {
+		config.MetadataRefreshBackoff = 100 * time.Millisecond
+	}
+	return &Client{
+		config:  config,
+		dialer:  config.Dialer,
+		brokers: make(map[int32]string),
+		conns:   make(map[string]*jocko.Conn),
+		topics:  make(map[string]*topicEntry),
+	}, nil
+}
+
+// Close closes the client's connections. Producers and consumers using it fail afterwards.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	for addr, conn := range c.conns {
+		conn.Close()
+		delete(c.conns, addr)
+	}
+	return nil
+}
+
+// Partitions returns the topic's partition IDs.
+func (c *Client) Partitions(topic string) ([]int32, error) {
+	md, err := c.metadata(topic)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int32, 0, len(md.partitions))
+	for _, p := range md.partitions {
+		ids = append(ids, p.PartitionID)
+	}
+	return ids, nil
+}
+
+// Leader returns the node ID of the partition's leader.
+func (c *Client) Leader(topic string, partition int32) (int32, error) {
+	md, err := c.metadata(topic)
+	if err != nil {
+		return 0, err
+	}
+	p, ok := md.partitions[partition]
+	if !ok {
+		return 0, protocol.ErrUnknownTopicOrPartition
+	}
+	if p.PartitionErrorCode != protocol.ErrNone.Code() {
+		c.Invalidate(topic)
+		return 0, errorFromCode(p.PartitionErrorCode)
+	}
+	if p.Leader < 0 {
+		c.Invalidate(topic)
+		return 0, protocol.ErrLeaderNotAvailable
+	}
+	return p.Leader, nil
+}
+
+// Conn returns the connection to the broker with the node ID, dialing it if there isn't one.
+func (c *Client) Conn(id int32) (*jocko.Conn, error) {
+	c.mu.Lock()
+	addr, ok := c.brokers[id]
+	c.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("client: unknown broker: %d", id)
+	}
+	return c.conn(addr)
+}
+
+func (c *Client) conn(addr string) (*jocko.Conn, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, ErrClosed
+	}
+	if conn, ok := c.conns[addr]; ok {
+		c.mu.Unlock()
+		return conn, nil
+	}
+	c.mu.Unlock()
+
+	// dialed without the lock so a broker that's down doesn't block requests to the others.
+	conn, err := c.dialer.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		conn.Close()
+		return nil, ErrClosed
+	}
+	if cur, ok := c.conns[addr]; ok {
+		// dialed concurrently, keep the one that's shared already.
+		conn.Close()
+		return cur, nil
+	}
+	c.conns[addr] = conn
+	return conn, nil
+}
+
+// CloseConn closes the connection if it's still the broker's shared one, so it's redialed on its
+// next use. Call it when requests on the connection fail with a network error.
+func (c *Client) CloseConn(conn *jocko.Conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for addr, cur := range c.conns {
+		if cur == conn {
+			conn.Close()
+			delete(c.conns, addr)
+			return
+		}
+	}
+}
+
+// Coordinator returns the connection to the coordinator of the group, or of the transactional
+// ID, looked up from the first broker that answers.
+func (c *Client) Coordinator(key string, typ protocol.CoordinatorType) (*jocko.Conn, error) {
+	err := ErrNoBrokers
+	for _, addr := range c.brokerAddrs() {
+		conn, dialErr := c.conn(addr)
+		if dialErr == ErrClosed {
+			return nil, dialErr
+		}
+		if dialErr != nil {
+			err = dialErr
+			continue
+		}
+		res, reqErr := conn.FindCoordinator(&protocol.FindCoordinatorRequest{
+			APIVersion:      1,
+			CoordinatorKey:  key,
+			CoordinatorType: typ,
+		})
+		if reqErr != nil {
+			c.CloseConn(conn)
+			err = reqErr
+			continue
+		}
+		if res.ErrorCode != protocol.ErrNone.Code() {
+			return nil, errorFromCode(res.ErrorCode)
+		}
+		return c.conn(net.JoinHostPort(res.Coordinator.Host, strconv.Itoa(int(res.Coordinator.Port))))
+	}
+	return nil, err
+}
+
+// brokerAddrs returns the addresses to request metadata from: the cluster's brokers, then the
+// bootstrap brokers.
+func (c *Client) brokerAddrs() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	addrs := make([]string, 0, len(c.brokers)+len(c.config.Brokers))
+	seen := make(map[string]bool)
+	for _, addr := range c.brokers {
+		addrs = append(addrs, addr)
+		seen[addr] = true
+	}
+	for _, addr := range c.config.Brokers {
+		if !seen[addr] {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// brokerAddr returns the broker's address.
+func brokerAddr(b *protocol.Broker) string {
+	return net.JoinHostPort(b.Host, strconv.Itoa(int(b.Port)))
+}
@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/jocko"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func newTestServer(t *testing.T, topics ...string) (*jocko.Server, func()) {
+	s, dir := jocko.NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+	}, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, s.Start(ctx))
+	jocko.WaitForLeader(t, s)
+
+	conn, err := jocko.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	for _, topic := range topics {
+		res, err := conn.CreateTopics(&protocol.CreateTopicRequests{
+			Timeout: time.Second,
+			Requests: []*protocol.CreateTopicRequest{{
+				Topic:             topic,
+				NumPartitions:     2,
+				ReplicationFactor: 1,
+			}},
+		})
+		require.NoError(t, err)
+		require.Equal(t, protocol.ErrNone.Code(), res.TopicErrorCodes[0].ErrorCode)
+	}
+	return s, func() {
+		cancel()
+		s.Shutdown()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestClient_Metadata(t *testing.T) {
+	s, teardown := newTestServer(t, "a", "b")
+	defer teardown()
+
+	c, err := New(Config{Brokers: []string{s.Addr().String()}})
+	require.NoError(t, err)
+	defer c.Close()
+
+	partitions, err := c.Partitions("a")
+	require.NoError(t, err)
+	require.ElementsMatch(t, []int32{0, 1}, partitions)
+	leader, err := c.Leader("b", 1)
+	require.NoError(t, err)
+	require.Equal(t, s.ID(), leader)
+
+	// cached lookups, concurrent or not, don't refresh.
+	a, b := c.topics["a"].md, c.topics["b"].md
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.Leader("a", 0)
+			require.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	require.True(t, a == c.topics["a"].md)
+
+	// invalidating a topic refreshes only it, once for concurrent lookups.
+	c.Invalidate("a")
+	var refreshed sync.Map
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			md, err := c.metadata("a")
+			require.NoError(t, err)
+			refreshed.Store(md, true)
+		}()
+	}
+	wg.Wait()
+	var n int
+	refreshed.Range(func(k, v interface{}) bool {
+		n++
+		return true
+	})
+	require.Equal(t, 1, n)
+	require.False(t, a == c.topics["a"].md)
+	require.True(t, b == c.topics["b"].md)
+
+	_, err = c.Partitions("missing")
+	require.Equal(t, protocol.ErrUnknownTopicOrPartition, err)
+}
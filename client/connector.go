@@ -0,0 +1,188 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+// TransformFunc transforms a consumed record into the records to produce for it, which must have
+// their topics and partitions set. An error aborts the transaction processing the record.
+type TransformFunc func(*Record) ([]*Record, error)
+
+// ConnectorConfig configures connectors.
+type ConnectorConfig struct {
+	// Group is the group the connector commits its consumed offsets to.
+	Group string
+	// TransactionalID identifies the connector's transactions across restarts. Defaults to Group.
+	TransactionalID string
+	// Topic is the topic consumed.
+	Topic string
+	// Partitions are the topic's partitions consumed. Defaults to all of them.
+	Partitions []int32
+	// Transform transforms the consumed records into those produced.
+	Transform TransformFunc
+	// PollTimeout is how long each run waits for records to consume. Defaults to 100ms.
+	PollTimeout time.Duration
+	// Consumer configures the connector's consumer, which always reads committed records.
+	Consumer ConsumerConfig
+	// Producer configures the connector's transactional producer.
+	Producer ProducerConfig
+}
+
+// Connector consumes records, transforms them, and produces the results along with the consumed
+// offsets in one transaction, so each consumed record's results are produced exactly once: a run
+// that fails is aborted, and its records consumed again from the committed offsets.
+//
+// Connectors with the same transactional ID fence each other off, the older one's runs failing
+// with an invalid producer epoch error, so only one instance of a connector makes progress.
+type Connector struct {
+	config   ConnectorConfig
+	consumer *Consumer
+	producer *TransactionalProducer
+	// committed are the partitions' committed offsets, the offsets of the next records to consume.
+	committed map[int32]int64
+}
+
+// NewConnector returns a connector consuming and producing with the client, from the group's
+// committed offsets, or the partitions' oldest offsets if it has none.
+func NewConnector(client *Client, config ConnectorConfig) (*Connector, error) {
+	if config.Group == "" || config.Topic == "" || config.Transform == nil {
+		return nil, errors.New("client: connector needs a group, topic and transform")
+	}
+	if config.TransactionalID == "" {
+		config.TransactionalID = config.Group
+	}
+	if config.PollTimeout == 0 {
+		config.PollTimeout = 100 * time.Millisecond
+	}
+	if len(config.Partitions) == 0 {
+		partitions, err := client.Partitions(config.Topic)
+		if err != nil {
+			return nil, err
+		}
+		config.Partitions = partitions
+	}
+	config.Consumer.IsolationLevel = protocol.ReadCommitted
+	producer, err := NewTransactionalProducer(client, config.TransactionalID, config.Producer)
+	if err != nil {
+		return nil, err
+	}
+	c := &Connector{
+		config:   config,
+		producer: producer,
+	}
+	if c.committed, err = client.CommittedOffsets(config.Group, config.Topic, config.Partitions); err != nil {
+		return nil, err
+	}
+	c.consumer = NewConsumer(client, config.Consumer)
+	for _, partition := range config.Partitions {
+		if err := c.consumer.Assign(config.Topic, partition, c.committed[partition]); err != nil {
+			c.consumer.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// RunOnce polls the records consumed and processes them in a transaction, returning how many it
+// processed. If the transaction fails it's aborted and the consumer's rewound to the committed
+// offsets.
+func (c *Connector) RunOnce() (int, error) {
+	records, err := c.consumer.Poll(c.config.PollTimeout)
+	if err != nil {
+		return 0, err
+	}
+	if len(records) == 0 {
+		return 0, nil
+	}
+	if err := c.producer.Begin(); err != nil {
+		return 0, err
+	}
+	offsets, err := c.process(records)
+	if err == nil {
+		err = c.producer.SendOffsets(c.config.Group, offsets)
+	}
+	if err == nil {
+		err = c.producer.Commit()
+	}
+	if err != nil {
+		if abortErr := c.producer.Abort(); abortErr != nil {
+			return 0, abortErr
+		}
+		c.rewind()
+		return 0, err
+	}
+	for _, o := range offsets {
+		c.committed[o.Partition] = o.Offset
+	}
+	return len(records), nil
+}
+
+// Run runs the connector until the context's done or a run fails.
+func (c *Connector) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+		if _, err := c.RunOnce(); err != nil {
+			return err
+		}
+	}
+}
+
+// Close closes the connector's consumer. Its client isn't closed.
+func (c *Connector) Close() error {
+	return c.consumer.Close()
+}
+
+// process transforms the records and produces the results in the transaction, batched by
+// partition per record, and returns the offsets to commit for them.
+func (c *Connector) process(records []*Record) ([]Offset, error) {
+	next := make(map[int32]int64)
+	var partitions []int32
+	for _, r := range records {
+		out, err := c.config.Transform(r)
+		if err != nil {
+			return nil, err
+		}
+		batches := make(map[topicPartition][]*Record)
+		var order []topicPartition
+		for _, o := range out {
+			if o.Topic == "" {
+				return nil, errors.New("client: transformed record has no topic")
+			}
+			tp := topicPartition{topic: o.Topic, partition: o.Partition}
+			if _, ok := batches[tp]; !ok {
+				order = append(order, tp)
+			}
+			batches[tp] = append(batches[tp], o)
+		}
+		for _, tp := range order {
+			if _, err := c.producer.Produce(tp.topic, tp.partition, batches[tp]...); err != nil {
+				return nil, err
+			}
+		}
+		if _, ok := next[r.Partition]; !ok {
+			partitions = append(partitions, r.Partition)
+		}
+		next[r.Partition] = r.Offset + 1
+	}
+	offsets := make([]Offset, 0, len(partitions))
+	for _, partition := range partitions {
+		offsets = append(offsets, Offset{Topic: c.config.Topic, Partition: partition, Offset: next[partition]})
+	}
+	return offsets, nil
+}
+
+// rewind moves the consumer back to the committed offsets, so an aborted transaction's records are
+// consumed again.
+func (c *Connector) rewind() {
+	for _, partition := range c.config.Partitions {
+		c.consumer.Assign(c.config.Topic, partition, c.committed[partition])
+	}
+}
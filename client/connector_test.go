@@ -0,0 +1,117 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestConnector_ExactlyOnce(t *testing.T) {
+	s, teardown := newTestServer(t, "in", "out")
+	defer teardown()
+
+	c, err := New(Config{Brokers: []string{s.Addr().String()}})
+	require.NoError(t, err)
+	defer c.Close()
+	p := NewProducer(c, ProducerConfig{})
+	for partition := int32(0); partition < 2; partition++ {
+		for i := 0; i < 5; i++ {
+			_, err := p.Produce("in", partition, &protocol.Message{Value: []byte(fmt.Sprintf("%d-%d", partition, i))})
+			require.NoError(t, err)
+		}
+	}
+
+	// the transform fails once, midway through a partition, so the records transformed before it
+	// are produced in a transaction that's aborted.
+	errTransform := errors.New("transform failed")
+	failed := false
+	conn, err := NewConnector(c, ConnectorConfig{
+		Group: "connector",
+		Topic: "in",
+		Transform: func(r *Record) ([]*Record, error) {
+			if string(r.Value) == "0-3" && !failed {
+				failed = true
+				return nil, errTransform
+			}
+			return []*Record{{Topic: "out", Partition: r.Partition, Value: []byte(strings.ToUpper("out-" + string(r.Value)))}}, nil
+		},
+		Consumer: ConsumerConfig{MaxWait: 10 * time.Millisecond},
+	})
+	require.NoError(t, err)
+	defer conn.Close()
+	for deadline := time.Now().Add(10 * time.Second); conn.committed[0] < 5 || conn.committed[1] < 5; {
+		require.True(t, time.Now().Before(deadline))
+		if _, err := conn.RunOnce(); err != nil {
+			require.Equal(t, errTransform, err)
+		}
+	}
+	require.True(t, failed)
+
+	consume := func(isolation protocol.IsolationLevel, n int) []string {
+		cons := NewConsumer(c, ConsumerConfig{MaxWait: 10 * time.Millisecond, IsolationLevel: isolation})
+		defer cons.Close()
+		require.NoError(t, cons.Assign("out", 0, 0))
+		require.NoError(t, cons.Assign("out", 1, 0))
+		var values []string
+		for deadline := time.Now().Add(5 * time.Second); len(values) < n; {
+			require.True(t, time.Now().Before(deadline))
+			records, err := cons.Poll(time.Second)
+			require.NoError(t, err)
+			for _, r := range records {
+				values = append(values, string(r.Value))
+			}
+		}
+		records, err := cons.Poll(100 * time.Millisecond)
+		require.NoError(t, err)
+		for _, r := range records {
+			values = append(values, string(r.Value))
+		}
+		return values
+	}
+	// read committed consumers see each record's results exactly once.
+	require.ElementsMatch(t, []string{
+		"OUT-0-0", "OUT-0-1", "OUT-0-2", "OUT-0-3", "OUT-0-4",
+		"OUT-1-0", "OUT-1-1", "OUT-1-2", "OUT-1-3", "OUT-1-4",
+	}, consume(protocol.ReadCommitted, 10))
+	// read uncommitted consumers see the aborted transaction's too.
+	uncommitted := consume(protocol.ReadUncommitted, 11)
+	require.True(t, len(uncommitted) > 10)
+
+	coordinator, err := c.Coordinator("connector", protocol.CoordinatorGroup)
+	require.NoError(t, err)
+	res, err := coordinator.OffsetFetch(&protocol.OffsetFetchRequest{
+		APIVersion: 1,
+		GroupID:    "connector",
+		Topics:     []protocol.OffsetFetchTopicRequest{{Topic: "in", Partitions: []int32{0, 1}}},
+	})
+	require.NoError(t, err)
+	for _, p := range res.Responses[0].Partitions {
+		require.Equal(t, int64(5), p.Offset)
+	}
+
+	// a new instance of the connector resumes from the committed offsets and fences off the old.
+	next, err := NewConnector(c, ConnectorConfig{
+		Group:     "connector",
+		Topic:     "in",
+		Transform: func(r *Record) ([]*Record, error) { return nil, nil },
+	})
+	require.NoError(t, err)
+	defer next.Close()
+	require.Equal(t, map[int32]int64{0: 5, 1: 5}, next.committed)
+	_, err = p.Produce("in", 0, &protocol.Message{Value: []byte("0-5")})
+	require.NoError(t, err)
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		require.True(t, time.Now().Before(deadline))
+		n, err := conn.RunOnce()
+		if err != nil {
+			require.Equal(t, protocol.ErrInvalidProducerEpoch, err)
+			break
+		}
+		require.Zero(t, n)
+	}
+}
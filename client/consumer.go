@@ -0,0 +1,491 @@
+package client
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+// ConsumerConfig configures consumers.
+type ConsumerConfig struct {
+	// MaxBytes is the most bytes fetched from a partition per fetch. Defaults to 1MB.
+	MaxBytes int32
+	// MaxWait is how long the broker waits for records to fetch. Brokers answer fetches at the log
+	// end right away, so partitions fetched empty aren't fetched again until it's passed. Defaults
+	// to 500ms.
+	MaxWait time.Duration
+	// FetchesInFlight is the most fetches kept in flight to each broker, its partitions split
+	// between them. Defaults to 2.
+	FetchesInFlight int
+	// BufferBytes is the budget of prefetched records' bytes buffered for Poll. Partitions aren't
+	// fetched while it's spent, so it's exceeded by at most the fetches in flight. Defaults to 16MB.
+	BufferBytes int
+	// IsolationLevel is which records are fetched: all of them, or with ReadCommitted only those
+	// not in ongoing or aborted transactions. Defaults to ReadUncommitted.
+	IsolationLevel protocol.IsolationLevel
+}
+
+// FetchError is returned by Poll when fetching a partition failed with an error other than a leader
+// error. The partition's unassigned, assign it again to resume consuming it.
+type FetchError struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Err       error
+}
+
+func (e *FetchError) Error() string {
+	return fmt.Sprintf("client: fetching %s/%d at offset %d: %s", e.Topic, e.Partition, e.Offset, e.Err)
+}
+
+// Consumer consumes records from the partitions assigned to it. Records are prefetched from the
+// partitions' leaders in the background, keeping up to FetchesInFlight fetches in flight to each
+// broker, and buffered up to BufferBytes so Poll rarely waits on a round trip.
+type Consumer struct {
+	client *Client
+	config ConsumerConfig
+
+	mu sync.Mutex
+	// cond is signaled when records are buffered or polled, fetches finish, partitions are
+	// assigned, or the consumer's closed.
+	cond       *sync.Cond
+	partitions map[topicPartition]*fetchState
+	// inflight are the number of fetches in flight by broker ID.
+	inflight      map[int32]int
+	buffered      []*Record
+	bufferedBytes int
+	err           error
+	closed        bool
+	wg            sync.WaitGroup
+}
+
+// fetchState is an assigned partition's fetch position.
+type fetchState struct {
+	offset   int64
+	fetching bool
+	// idleUntil is when the partition's fetched again after being fetched empty or failing.
+	idleUntil time.Time
+}
+
+// NewConsumer returns a consumer fetching records with the client.
+func NewConsumer(client *Client, config ConsumerConfig) *Consumer {
+	if config.MaxBytes == 0 {
+		config.MaxBytes = 1 << 20
+	}
+	if config.MaxWait == 0 {
+		config.MaxWait = 500 * time.Millisecond
+	}
+	if config.FetchesInFlight == 0 {
+		config.FetchesInFlight = 2
+	}
+	if config.BufferBytes == 0 {
+		config.BufferBytes = 16 << 20
+	}
+	c := &Consumer{
+		client:     client,
+		config:     config,
+		partitions: make(map[topicPartition]*fetchState),
+		inflight:   make(map[int32]int),
+	}
+	c.cond = sync.NewCond(&c.mu)
+	c.wg.Add(1)
+	go c.run()
+	return c
+}
+
+// Assign assigns the partition to the consumer to consume from the offset, or moves its position
+// to the offset if it's assigned already. The partition's buffered records that haven't been
+// polled are dropped, so records from before the move aren't polled.
+func (c *Consumer) Assign(topic string, partition int32, offset int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	tp := topicPartition{topic: topic, partition: partition}
+	if _, ok := c.partitions[tp]; ok {
+		buffered := c.buffered[:0]
+		for _, r := range c.buffered {
+			if r.Topic != topic || r.Partition != partition {
+				buffered = append(buffered, r)
+			}
+		}
+		c.buffered = buffered
+	}
+	c.partitions[tp] = &fetchState{offset: offset}
+	c.cond.Broadcast()
+	return nil
+}
+
+// Unassign stops consuming the partition.
+func (c *Consumer) Unassign(topic string, partition int32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.partitions, topicPartition{topic: topic, partition: partition})
+}
+
+// Poll returns the records buffered, waiting up to the timeout for some if there are none. A
+// partition's records are returned in order. It returns a FetchError if fetching a partition
+// failed, along with the records buffered before it did.
+func (c *Consumer) Poll(timeout time.Duration) ([]*Record, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var timedOut bool
+	t := time.AfterFunc(timeout, func() {
+		c.mu.Lock()
+		timedOut = true
+		c.cond.Broadcast()
+		c.mu.Unlock()
+	})
+	defer t.Stop()
+	for len(c.buffered) == 0 && c.err == nil && !c.closed && !timedOut {
+		c.cond.Wait()
+	}
+	if c.closed {
+		return nil, ErrClosed
+	}
+	records, err := c.buffered, c.err
+	c.buffered, c.bufferedBytes, c.err = nil, 0, nil
+	// the buffer's budget is free again.
+	c.cond.Broadcast()
+	return records, err
+}
+
+// Close stops the consumer fetching and waits for its fetches in flight. The consumer's client
+// isn't closed.
+func (c *Consumer) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	c.cond.Broadcast()
+	c.mu.Unlock()
+	c.wg.Wait()
+	return nil
+}
+
+// run fetches the partitions that are ready, waiting for them to be when none are.
+func (c *Consumer) run() {
+	defer c.wg.Done()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for !c.closed {
+		ready, wait := c.ready()
+		if len(ready) > 0 {
+			// leaders are looked up without the lock since it may refresh the metadata.
+			c.mu.Unlock()
+			leaders := c.leaders(ready)
+			c.mu.Lock()
+			c.fetch(leaders)
+			continue
+		}
+		var t *time.Timer
+		if wait > 0 {
+			t = time.AfterFunc(wait, func() {
+				c.mu.Lock()
+				c.cond.Broadcast()
+				c.mu.Unlock()
+			})
+		}
+		c.cond.Wait()
+		if t != nil {
+			t.Stop()
+		}
+	}
+	// wait out the fetches in flight, they finish by the conn's deadline at the latest.
+	for len(c.inflight) > 0 {
+		c.cond.Wait()
+	}
+}
+
+// ready marks the partitions ready to fetch as fetching and returns them, or if none are returns
+// how long until an idle one is. It's called with the lock held.
+func (c *Consumer) ready() ([]topicPartition, time.Duration) {
+	if c.bufferedBytes >= c.config.BufferBytes {
+		return nil, 0
+	}
+	var ready []topicPartition
+	var wait time.Duration
+	now := time.Now()
+	for tp, s := range c.partitions {
+		if s.fetching {
+			continue
+		}
+		if d := s.idleUntil.Sub(now); d > 0 {
+			if wait == 0 || d < wait {
+				wait = d
+			}
+			continue
+		}
+		s.fetching = true
+		ready = append(ready, tp)
+	}
+	return ready, wait
+}
+
+// leaders groups the partitions by their leaders. Partitions whose leaders can't be looked up are
+// left out and idle for the metadata refresh backoff.
+func (c *Consumer) leaders(partitions []topicPartition) map[int32][]topicPartition {
+	leaders := make(map[int32][]topicPartition)
+	var failed []topicPartition
+	for _, tp := range partitions {
+		id, err := c.client.Leader(tp.topic, tp.partition)
+		if err != nil {
+			failed = append(failed, tp)
+			continue
+		}
+		leaders[id] = append(leaders[id], tp)
+	}
+	if len(failed) > 0 {
+		c.mu.Lock()
+		c.idle(failed, c.client.config.MetadataRefreshBackoff)
+		c.mu.Unlock()
+	}
+	return leaders
+}
+
+// fetch splits each broker's partitions between the fetches it has room for in flight and starts
+// them. Partitions of brokers without room are fetched once one of theirs finishes. It's called
+// with the lock held.
+func (c *Consumer) fetch(leaders map[int32][]topicPartition) {
+	for id, partitions := range leaders {
+		n := c.config.FetchesInFlight - c.inflight[id]
+		if n <= 0 {
+			for _, tp := range partitions {
+				if s, ok := c.partitions[tp]; ok {
+					s.fetching = false
+				}
+			}
+			continue
+		}
+		if n > len(partitions) {
+			n = len(partitions)
+		}
+		groups := make([]map[topicPartition]int64, n)
+		for i := range groups {
+			groups[i] = make(map[topicPartition]int64)
+		}
+		for i, tp := range partitions {
+			s, ok := c.partitions[tp]
+			if !ok {
+				// unassigned while its leader was looked up.
+				continue
+			}
+			groups[i%n][tp] = s.offset
+		}
+		for _, offsets := range groups {
+			if len(offsets) == 0 {
+				continue
+			}
+			c.inflight[id]++
+			go c.fetchFrom(id, offsets)
+		}
+	}
+}
+
+// fetchFrom fetches the partitions from their offsets from the broker and buffers their records.
+func (c *Consumer) fetchFrom(id int32, offsets map[topicPartition]int64) {
+	res, err := c.request(id, offsets)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer c.cond.Broadcast()
+	if c.inflight[id]--; c.inflight[id] == 0 {
+		delete(c.inflight, id)
+	}
+	partitions := make([]topicPartition, 0, len(offsets))
+	for tp := range offsets {
+		partitions = append(partitions, tp)
+	}
+	if err != nil {
+		c.idle(partitions, c.client.config.MetadataRefreshBackoff)
+		return
+	}
+	if res.ThrottleTime > 0 {
+		c.idle(partitions, res.ThrottleTime)
+	}
+	for _, tr := range res.Responses {
+		for _, pr := range tr.PartitionResponses {
+			tp := topicPartition{topic: tr.Topic, partition: pr.Partition}
+			offset, ok := offsets[tp]
+			s := c.partitions[tp]
+			if !ok || s == nil || s.offset != offset {
+				// unassigned or moved while it was fetched.
+				continue
+			}
+			s.fetching = false
+			if pr.ErrorCode != protocol.ErrNone.Code() {
+				err := errorFromCode(pr.ErrorCode)
+				if isLeaderError(err) {
+					c.client.Invalidate(tp.topic)
+					c.idle([]topicPartition{tp}, c.client.config.MetadataRefreshBackoff)
+					continue
+				}
+				delete(c.partitions, tp)
+				if c.err == nil {
+					c.err = &FetchError{Topic: tp.topic, Partition: tp.partition, Offset: offset, Err: err}
+				}
+				continue
+			}
+			records, next, err := decodeRecords(tp, offset, pr.RecordSet, pr.AbortedTransactions)
+			if err != nil {
+				delete(c.partitions, tp)
+				if c.err == nil {
+					c.err = &FetchError{Topic: tp.topic, Partition: tp.partition, Offset: offset, Err: err}
+				}
+				continue
+			}
+			if len(records) == 0 {
+				if next > offset {
+					// the set was all control batches or aborted records, fetch past them.
+					s.offset = next
+					continue
+				}
+				c.idle([]topicPartition{tp}, c.config.MaxWait)
+				continue
+			}
+			s.offset = next
+			c.buffered = append(c.buffered, records...)
+			c.bufferedBytes += len(pr.RecordSet)
+		}
+	}
+	// partitions missing from the response are fetched again.
+	for tp := range offsets {
+		if s, ok := c.partitions[tp]; ok && s.offset == offsets[tp] {
+			s.fetching = false
+		}
+	}
+}
+
+// request sends the fetch for the partitions from their offsets to the broker.
+func (c *Consumer) request(id int32, offsets map[topicPartition]int64) (*protocol.FetchResponse, error) {
+	conn, err := c.client.Conn(id)
+	if err != nil {
+		return nil, err
+	}
+	req := &protocol.FetchRequest{
+		APIVersion:     10,
+		MaxWaitTime:    c.config.MaxWait,
+		MinBytes:       1,
+		MaxBytes:       c.config.MaxBytes,
+		IsolationLevel: c.config.IsolationLevel,
+	}
+	topics := make(map[string]*protocol.FetchTopic)
+	for tp, offset := range offsets {
+		t, ok := topics[tp.topic]
+		if !ok {
+			t = &protocol.FetchTopic{Topic: tp.topic}
+			topics[tp.topic] = t
+			req.Topics = append(req.Topics, t)
+		}
+		t.Partitions = append(t.Partitions, &protocol.FetchPartition{
+			Partition:          tp.partition,
+			FetchOffset:        offset,
+			CurrentLeaderEpoch: -1,
+			MaxBytes:           c.config.MaxBytes,
+		})
+	}
+	res, err := conn.Fetch(req)
+	if err != nil {
+		c.client.CloseConn(conn)
+		for topic := range topics {
+			c.client.Invalidate(topic)
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+// idle idles the partitions for the duration, or longer if they are already. It's called with the
+// lock held.
+func (c *Consumer) idle(partitions []topicPartition, d time.Duration) {
+	until := time.Now().Add(d)
+	for _, tp := range partitions {
+		s, ok := c.partitions[tp]
+		if !ok {
+			continue
+		}
+		s.fetching = false
+		if until.After(s.idleUntil) {
+			s.idleUntil = until
+		}
+	}
+}
+
+// decodeRecords decodes the partition's records at and after the offset from the fetched record
+// set's message sets and record batches, decompressing compressed ones, and returns the offset to
+// fetch next. A message set truncated by the fetch's max bytes is fetched again next time.
+//
+// Control batches are skipped, as are the transactional batches of the aborted transactions, which
+// a read committed fetch's response lists with their first offsets. A producer's aborted from its
+// transaction's first offset until its abort marker.
+func decodeRecords(tp topicPartition, offset int64, set []byte, aborted []*protocol.AbortedTransaction) ([]*Record, int64, error) {
+	var records []*Record
+	next := offset
+	aborted = append([]*protocol.AbortedTransaction(nil), aborted...)
+	sort.Slice(aborted, func(i, j int) bool { return aborted[i].FirstOffset < aborted[j].FirstOffset })
+	abortedProducers := make(map[int64]bool)
+	for len(set) >= 12 {
+		n := 12 + int(protocol.Encoding.Uint32(set[8:12]))
+		if n > len(set) {
+			break
+		}
+		if protocol.IsRecordBatch(set[:n]) {
+			batch := new(protocol.RecordBatch)
+			if err := batch.Decode(protocol.NewDecoder(set[:n])); err != nil {
+				return nil, 0, err
+			}
+			set = set[n:]
+			last := batch.FirstOffset + int64(batch.LastOffsetDelta)
+			for len(aborted) > 0 && aborted[0].FirstOffset <= last {
+				abortedProducers[aborted[0].ProducerID] = true
+				aborted = aborted[1:]
+			}
+			if typ, ok := batch.ControlType(); ok && typ == protocol.ControlAbort {
+				delete(abortedProducers, batch.ProducerID)
+			}
+			if batch.Control() || batch.Transactional() && abortedProducers[batch.ProducerID] {
+				batch.Records = nil
+			}
+			for _, r := range batch.Records {
+				if o := batch.FirstOffset + r.OffsetDelta; o >= offset {
+					records = append(records, &Record{
+						Topic:     tp.topic,
+						Partition: tp.partition,
+						Key:       r.Key,
+						Value:     r.Value,
+						Offset:    o,
+					})
+				}
+			}
+			if last >= next {
+				next = last + 1
+			}
+			continue
+		}
+		ms := new(protocol.MessageSet)
+		if err := ms.Decode(protocol.NewDecoder(set[:n])); err != nil {
+			return nil, 0, err
+		}
+		set = set[n:]
+		if ms.Offset < offset {
+			continue
+		}
+		msgs, err := protocol.DecompressMessages(ms.Messages)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, m := range msgs {
+			records = append(records, &Record{
+				Topic:     tp.topic,
+				Partition: tp.partition,
+				Key:       m.Key,
+				Value:     m.Value,
+				Offset:    ms.Offset,
+			})
+		}
+		next = ms.Offset + 1
+	}
+	return records, next, nil
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestConsumer_Poll(t *testing.T) {
+	s, teardown := newTestServer(t, "a")
+	defer teardown()
+
+	c, err := New(Config{Brokers: []string{s.Addr().String()}})
+	require.NoError(t, err)
+	defer c.Close()
+	p := NewProducer(c, ProducerConfig{})
+	compressed := NewProducer(c, ProducerConfig{Compression: protocol.CompressionGZIP})
+	for i := 0; i < 3; i++ {
+		for partition := int32(0); partition < 2; partition++ {
+			_, err := p.Produce("a", partition, &protocol.Message{Value: []byte(fmt.Sprintf("%d-%d", partition, i))})
+			require.NoError(t, err)
+		}
+	}
+	_, err = compressed.Produce("a", 1, &protocol.Message{Value: []byte("1-3")}, &protocol.Message{Value: []byte("1-4")})
+	require.NoError(t, err)
+
+	cons := NewConsumer(c, ConsumerConfig{MaxWait: 10 * time.Millisecond})
+	require.NoError(t, cons.Assign("a", 0, 1))
+	require.NoError(t, cons.Assign("a", 1, 0))
+
+	values := make(map[int32][]string)
+	offsets := make(map[int32][]int64)
+	for deadline := time.Now().Add(5 * time.Second); len(values[0]) < 2 || len(values[1]) < 5; {
+		require.True(t, time.Now().Before(deadline))
+		records, err := cons.Poll(time.Second)
+		require.NoError(t, err)
+		for _, r := range records {
+			values[r.Partition] = append(values[r.Partition], string(r.Value))
+			offsets[r.Partition] = append(offsets[r.Partition], r.Offset)
+		}
+	}
+	require.Equal(t, []string{"0-1", "0-2"}, values[0])
+	require.Equal(t, []int64{1, 2}, offsets[0])
+	// the compressed messages were appended at one offset.
+	require.Equal(t, []string{"1-0", "1-1", "1-2", "1-3", "1-4"}, values[1])
+	require.Equal(t, []int64{0, 1, 2, 3, 3}, offsets[1])
+
+	records, err := cons.Poll(50 * time.Millisecond)
+	require.NoError(t, err)
+	require.Empty(t, records)
+
+	// fetching out of range fails the partition, it's unassigned.
+	require.NoError(t, cons.Assign("a", 0, 100))
+	_, err = cons.Poll(time.Second)
+	require.Equal(t, &FetchError{Topic: "a", Partition: 0, Offset: 100, Err: protocol.ErrOffsetOutOfRange}, err)
+	cons.mu.Lock()
+	require.NotContains(t, cons.partitions, topicPartition{topic: "a", partition: 0})
+	cons.mu.Unlock()
+
+	require.NoError(t, cons.Close())
+	_, err = cons.Poll(time.Second)
+	require.Equal(t, ErrClosed, err)
+	require.Equal(t, ErrClosed, cons.Assign("a", 0, 0))
+}
+
+func TestConsumer_BufferBytes(t *testing.T) {
+	s, teardown := newTestServer(t, "a")
+	defer teardown()
+
+	c, err := New(Config{Brokers: []string{s.Addr().String()}})
+	require.NoError(t, err)
+	defer c.Close()
+	p := NewProducer(c, ProducerConfig{})
+	for i := 0; i < 3; i++ {
+		_, err := p.Produce("a", 0, &protocol.Message{Value: []byte("hello")})
+		require.NoError(t, err)
+	}
+
+	cons := NewConsumer(c, ConsumerConfig{MaxWait: 10 * time.Millisecond, BufferBytes: 1})
+	defer cons.Close()
+	require.NoError(t, cons.Assign("a", 0, 0))
+	buffered := func() int {
+		cons.mu.Lock()
+		defer cons.mu.Unlock()
+		return len(cons.buffered)
+	}
+	for deadline := time.Now().Add(5 * time.Second); buffered() == 0; time.Sleep(10 * time.Millisecond) {
+		require.True(t, time.Now().Before(deadline))
+	}
+
+	// the budget's spent so what's produced now isn't prefetched until the buffer's polled.
+	_, err = p.Produce("a", 0, &protocol.Message{Value: []byte("hello")})
+	require.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, 3, buffered())
+
+	records, err := cons.Poll(time.Second)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(records))
+	records, err = cons.Poll(time.Second)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(records))
+	require.Equal(t, int64(3), records[0].Offset)
+}
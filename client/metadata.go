@@ -0,0 +1,162 @@
+package client
+
+import (
+	"time"
+
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+// topicMetadata is a topic's metadata as of a metadata response. It isn't modified once fetched,
+// refreshes replace it, so it's read without the client's lock.
+type topicMetadata struct {
+	partitions map[int32]*protocol.PartitionMetadata
+	fetchedAt  time.Time
+}
+
+// topicEntry is a topic's cached metadata and the state of its refreshes.
+type topicEntry struct {
+	md *topicMetadata
+	// stale is set when the topic's leaders returned errors so it's refreshed on its next use.
+	stale bool
+	// lastRefresh is when the topic's metadata was last requested, successfully or not.
+	lastRefresh time.Time
+	// refresh is the refresh in flight, shared by those needing the topic's metadata meanwhile.
+	refresh *refresh
+}
+
+type refresh struct {
+	done chan struct{}
+	md   *topicMetadata
+	err  error
+}
+
+// Invalidate marks the topic's metadata stale so it's refreshed on its next use, leaving other
+// topics' metadata cached. Call it when the topic's partitions return leader errors.
+func (c *Client) Invalidate(topic string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.topics[topic]; ok {
+		e.stale = true
+	}
+}
+
+// metadata returns the topic's metadata, refreshing it if it's stale or older than the max age.
+// Concurrent refreshes of a topic are coalesced into one request.
+func (c *Client) metadata(topic string) (*topicMetadata, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, ErrClosed
+	}
+	e, ok := c.topics[topic]
+	if !ok {
+		e = new(topicEntry)
+		c.topics[topic] = e
+	}
+	if e.md != nil && !e.stale && time.Since(e.md.fetchedAt) < c.config.MetadataMaxAge {
+		md := e.md
+		c.mu.Unlock()
+		return md, nil
+	}
+	if r := e.refresh; r != nil {
+		c.mu.Unlock()
+		<-r.done
+		return r.md, r.err
+	}
+	r := &refresh{done: make(chan struct{})}
+	e.refresh = r
+	wait := c.config.MetadataRefreshBackoff - time.Since(e.lastRefresh)
+	c.mu.Unlock()
+
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+	md, err := c.fetchMetadata(topic)
+
+	c.mu.Lock()
+	e.lastRefresh = time.Now()
+	if err == nil {
+		e.md, e.stale = md, false
+	}
+	e.refresh = nil
+	r.md, r.err = md, err
+	c.mu.Unlock()
+	close(r.done)
+	return md, err
+}
+
+// fetchMetadata requests the topic's metadata from the first broker that answers, updating the
+// brokers' addresses from the response.
+func (c *Client) fetchMetadata(topic string) (*topicMetadata, error) {
+	err := ErrNoBrokers
+	for _, addr := range c.brokerAddrs() {
+		conn, dialErr := c.conn(addr)
+		if dialErr == ErrClosed {
+			return nil, dialErr
+		}
+		if dialErr != nil {
+			err = dialErr
+			continue
+		}
+		res, reqErr := conn.Metadata(&protocol.MetadataRequest{Topics: []string{topic}})
+		if reqErr != nil {
+			c.CloseConn(conn)
+			err = reqErr
+			continue
+		}
+
+		brokers := make(map[int32]string, len(res.Brokers))
+		for _, b := range res.Brokers {
+			brokers[b.NodeID] = brokerAddr(b)
+		}
+		c.mu.Lock()
+		c.brokers = brokers
+		c.mu.Unlock()
+
+		for _, tm := range res.TopicMetadata {
+			if tm.Topic != topic {
+				continue
+			}
+			if tm.TopicErrorCode != protocol.ErrNone.Code() {
+				return nil, errorFromCode(tm.TopicErrorCode)
+			}
+			md := &topicMetadata{
+				partitions: make(map[int32]*protocol.PartitionMetadata, len(tm.PartitionMetadata)),
+				fetchedAt:  time.Now(),
+			}
+			for _, p := range tm.PartitionMetadata {
+				md.partitions[p.PartitionID] = p
+			}
+			return md, nil
+		}
+		return nil, protocol.ErrUnknownTopicOrPartition
+	}
+	return nil, err
+}
+
+// errorFromCode returns the protocol error with the code, or an unknown error if there's none.
+func errorFromCode(code int16) error {
+	if err, ok := protocol.Errs[code]; ok {
+		return err
+	}
+	return protocol.ErrUnknown
+}
+
+// isLeaderError returns whether the error means the partition's leader has moved, or its
+// connection's broken, so the topic's metadata needs refreshing.
+func isLeaderError(err error) bool {
+	perr, ok := err.(protocol.Error)
+	if !ok {
+		// a network error.
+		return true
+	}
+	switch perr.Code() {
+	case protocol.ErrNotLeaderForPartition.Code(),
+		protocol.ErrLeaderNotAvailable.Code(),
+		protocol.ErrUnknownTopicOrPartition.Code(),
+		protocol.ErrBrokerNotAvailable.Code(),
+		protocol.ErrReplicaNotAvailable.Code():
+		return true
+	}
+	return false
+}
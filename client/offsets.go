@@ -0,0 +1,144 @@
+package client
+
+import (
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+// CommittedOffsets returns the group's committed offsets of the topic's partitions, the offsets of
+// the next records to consume, with the partitions' oldest offsets for those it hasn't committed.
+func (c *Client) CommittedOffsets(group, topic string, partitions []int32) (map[int32]int64, error) {
+	conn, err := c.Coordinator(group, protocol.CoordinatorGroup)
+	if err != nil {
+		return nil, err
+	}
+	res, err := conn.OffsetFetch(&protocol.OffsetFetchRequest{
+		APIVersion: 1,
+		GroupID:    group,
+		Topics:     []protocol.OffsetFetchTopicRequest{{Topic: topic, Partitions: partitions}},
+	})
+	if err != nil {
+		c.CloseConn(conn)
+		return nil, err
+	}
+	committed := make(map[int32]int64)
+	for _, t := range res.Responses {
+		for _, p := range t.Partitions {
+			if p.ErrorCode != protocol.ErrNone.Code() {
+				return nil, errorFromCode(p.ErrorCode)
+			}
+			if p.Offset >= 0 {
+				committed[p.Partition] = p.Offset
+			}
+		}
+	}
+	for _, partition := range partitions {
+		if _, ok := committed[partition]; ok {
+			continue
+		}
+		offset, err := c.OldestOffset(topic, partition)
+		if err != nil {
+			return nil, err
+		}
+		committed[partition] = offset
+	}
+	return committed, nil
+}
+
+// DescribeGroup returns the group's state and members, asked of its coordinator.
+func (c *Client) DescribeGroup(group string) (*protocol.Group, error) {
+	conn, err := c.Coordinator(group, protocol.CoordinatorGroup)
+	if err != nil {
+		return nil, err
+	}
+	res, err := conn.DescribeGroups(&protocol.DescribeGroupsRequest{GroupIDs: []string{group}})
+	if err != nil {
+		c.CloseConn(conn)
+		return nil, err
+	}
+	if len(res.Groups) == 0 {
+		return nil, protocol.ErrUnknown
+	}
+	g := res.Groups[0]
+	if g.ErrorCode != protocol.ErrNone.Code() {
+		return nil, errorFromCode(g.ErrorCode)
+	}
+	return &g, nil
+}
+
+// CommitOffsets commits the group's offsets, outside of any generation, so they're meant for
+// groups whose consumers assign their partitions themselves.
+func (c *Client) CommitOffsets(group string, offsets []Offset) error {
+	req := &protocol.OffsetCommitRequest{APIVersion: 2, GroupID: group, GenerationID: -1, RetentionTime: -1}
+	topics := make(map[string]*protocol.OffsetCommitRequestTopic)
+	for _, o := range offsets {
+		t, ok := topics[o.Topic]
+		if !ok {
+			t = &protocol.OffsetCommitRequestTopic{Name: o.Topic}
+			topics[o.Topic] = t
+			req.Topics = append(req.Topics, t)
+		}
+		t.Partitions = append(t.Partitions, &protocol.OffsetCommitRequestPartition{PartitionIndex: o.Partition, CommittedOffset: o.Offset})
+	}
+	conn, err := c.Coordinator(group, protocol.CoordinatorGroup)
+	if err != nil {
+		return err
+	}
+	res, err := conn.OffsetCommit(req)
+	if err != nil {
+		c.CloseConn(conn)
+		return err
+	}
+	for _, t := range res.Topics {
+		for _, p := range t.Partitions {
+			if p.ErrorCode != protocol.ErrNone.Code() {
+				return errorFromCode(p.ErrorCode)
+			}
+		}
+	}
+	return nil
+}
+
+// OldestOffset returns the partition's oldest offset, asked of its leader.
+func (c *Client) OldestOffset(topic string, partition int32) (int64, error) {
+	return c.listOffset(topic, partition, -2)
+}
+
+// NewestOffset returns the partition's newest offset, the offset of its next record, asked of its
+// leader.
+func (c *Client) NewestOffset(topic string, partition int32) (int64, error) {
+	return c.listOffset(topic, partition, -1)
+}
+
+// listOffset returns the partition's offset for the timestamp, -2 for its oldest and -1 for its
+// newest, asked of its leader.
+func (c *Client) listOffset(topic string, partition int32, timestamp int64) (int64, error) {
+	id, err := c.Leader(topic, partition)
+	if err != nil {
+		return 0, err
+	}
+	conn, err := c.Conn(id)
+	if err != nil {
+		return 0, err
+	}
+	res, err := conn.Offsets(&protocol.OffsetsRequest{
+		APIVersion: 1,
+		ReplicaID:  -1,
+		Topics: []*protocol.OffsetsTopic{{
+			Topic:      topic,
+			Partitions: []*protocol.OffsetsPartition{{Partition: partition, Timestamp: timestamp}},
+		}},
+	})
+	if err != nil {
+		c.CloseConn(conn)
+		return 0, err
+	}
+	for _, t := range res.Responses {
+		for _, p := range t.PartitionResponses {
+			if p.ErrorCode != protocol.ErrNone.Code() {
+				return 0, errorFromCode(p.ErrorCode)
+			}
+			return p.Offset, nil
+		}
+	}
+	return 0, protocol.ErrUnknownTopicOrPartition
+}
@@ -0,0 +1,432 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/travisjeffery/jocko/jocko"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+// ProducerConfig configures producers.
+type ProducerConfig struct {
+	// Acks is the number of replicas that must have the messages before they're acknowledged: 1
+	// for the leader, or -1 for the ISR. Defaults to 1.
+	Acks int16
+	// Timeout is how long the leader waits for the ISR's acknowledgements. Defaults to 10s.
+	Timeout time.Duration
+	// Retries is how many times sends failing with leader errors are retried. Defaults to 3.
+	Retries int
+	// BatchSize is how many records sent with Send partitions' batches start at, tuned from
+	// there to their throughput. Defaults to 100.
+	BatchSize int
+	// MaxBatchSize is the most records partitions' batches are tuned up to. Defaults to 10 times
+	// BatchSize.
+	MaxBatchSize int
+	// Linger is how long records sent with Send wait for their batch to fill before it's sent,
+	// stretched while the broker's throttling the producer. Defaults to 5ms.
+	Linger time.Duration
+	// Compression is the codec messages are compressed with. Defaults to none.
+	Compression protocol.CompressionCodec
+}
+
+// ErrFlushTimeout is returned by Flush when records are still in flight at its timeout.
+var ErrFlushTimeout = errors.New("client: timed out flushing records")
+
+// Record is a message sent asynchronously with Send. Its offset, or error, is set once it's been
+// acknowledged, or has failed, which it has by the time Flush or Close return.
+type Record struct {
+	Topic     string
+	Partition int32
+	Key       []byte
+	Value     []byte
+
+	// Offset is the offset the record's batch was appended at.
+	Offset int64
+	// Err is why the record failed to be delivered, if it did.
+	Err error
+}
+
+// ProduceErrors are the records that failed to be delivered.
+type ProduceErrors []*Record
+
+func (e ProduceErrors) Error() string {
+	return fmt.Sprintf("client: failed to deliver %d records, first: %s", len(e), e[0].Err)
+}
+
+// Producer produces messages to the partitions' leaders. Each partition's leader connection is
+// pinned, so it's reused without checking the metadata, until it returns a leader error.
+//
+// Records sent with Send are batched per partition and sent in order, a batch at a time. Flush
+// waits for them to be delivered and Close does too, before closing the producer.
+//
+// Partitions' batch sizes are tuned to their throughput: batches filling before half their linger
+// double, up to MaxBatchSize, and batches lingering less than half full halve, down to BatchSize.
+// Throttled responses' throttle times are waited out before the partition's next batch is sent.
+type Producer struct {
+	client *Client
+	config ProducerConfig
+
+	mu      sync.Mutex
+	leaders map[topicPartition]leaderConn
+	queues  map[topicPartition]*partitionQueue
+	// inflight is the number of records sent that haven't been acknowledged or failed, signaled
+	// on done as records finish.
+	inflight int
+	done     *sync.Cond
+	// failed are the records that failed since the last flush.
+	failed []*Record
+	closed bool
+}
+
+// partitionQueue is the partition's records sent with Send: the batch filling up, and the batches
+// ready to send, sent in order by one goroutine at a time.
+type partitionQueue struct {
+	batch   []*Record
+	linger  *time.Timer
+	ready   [][]*Record
+	sending bool
+
+	// size is the tuned batch size and started is when the batch's first record was sent.
+	size    int
+	started time.Time
+	// throttle is the last response's throttle time.
+	throttle time.Duration
+}
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// leaderConn is a partition's pinned leader and its connection.
+type leaderConn struct {
+	id   int32
+	conn *jocko.Conn
+}
+
+// NewProducer returns a producer sending messages with the client.
+func NewProducer(client *Client, config ProducerConfig) *Producer {
+	if config.Acks == 0 {
+		config.Acks = 1
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if config.Retries == 0 {
+		config.Retries = 3
+	}
+	if config.BatchSize == 0 {
+		config.BatchSize = 100
+	}
+	if config.MaxBatchSize == 0 {
+		config.MaxBatchSize = 10 * config.BatchSize
+	}
+	if config.MaxBatchSize < config.BatchSize {
+		config.MaxBatchSize = config.BatchSize
+	}
+	if config.Linger == 0 {
+		config.Linger = 5 * time.Millisecond
+	}
+	p := &Producer{
+		client:  client,
+		config:  config,
+		leaders: make(map[topicPartition]leaderConn),
+		queues:  make(map[topicPartition]*partitionQueue),
+	}
+	p.done = sync.NewCond(&p.mu)
+	return p
+}
+
+// Produce sends the messages to the partition and returns the offset of the first. Sends failing
+// with leader errors refresh the topic's metadata and are retried with its new leader.
+func (p *Producer) Produce(topic string, partition int32, msgs ...*protocol.Message) (int64, error) {
+	p.mu.Lock()
+	closed := p.closed
+	p.mu.Unlock()
+	if closed {
+		return 0, ErrClosed
+	}
+	set, err := p.encode(msgs)
+	if err != nil {
+		return 0, err
+	}
+	offset, _, err := p.produce(topicPartition{topic: topic, partition: partition}, set)
+	return offset, err
+}
+
+// encode encodes the messages' set. If the producer compresses, the set's compressed and wrapped
+// in a message.
+func (p *Producer) encode(msgs []*protocol.Message) ([]byte, error) {
+	set, err := protocol.Encode(&protocol.MessageSet{Messages: msgs})
+	if err != nil || p.config.Compression == protocol.CompressionNone {
+		return set, err
+	}
+	compressed, err := protocol.Compress(p.config.Compression, set)
+	if err != nil {
+		return nil, err
+	}
+	return protocol.Encode(&protocol.MessageSet{Messages: []*protocol.Message{{
+		Attributes: int8(p.config.Compression),
+		Value:      compressed,
+	}}})
+}
+
+// produce sends the message set to the partition, retrying leader errors, and returns the offset
+// it was appended at and the response's throttle time.
+func (p *Producer) produce(tp topicPartition, set []byte) (int64, time.Duration, error) {
+	return p.produceRequest(tp, &protocol.ProduceRequest{
+		APIVersion: 2,
+		Acks:       p.config.Acks,
+		Timeout:    p.config.Timeout,
+		TopicData: []*protocol.TopicData{{
+			Topic: tp.topic,
+			Data:  []*protocol.Data{{Partition: tp.partition, RecordSet: set}},
+		}},
+	})
+}
+
+// produceRequest sends the produce request of the partition's record set, retrying leader errors.
+func (p *Producer) produceRequest(tp topicPartition, req *protocol.ProduceRequest) (int64, time.Duration, error) {
+	for attempt := 0; ; attempt++ {
+		offset, throttle, err := p.send(tp, req)
+		if err == nil || !isLeaderError(err) || attempt == p.config.Retries {
+			return offset, throttle, err
+		}
+	}
+}
+
+// Send adds the record to its partition's batch, sent once it's full or has lingered. The record's
+// offset or error is set once it's been delivered or has failed.
+func (p *Producer) Send(r *Record) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrClosed
+	}
+	tp := topicPartition{topic: r.Topic, partition: r.Partition}
+	q, ok := p.queues[tp]
+	if !ok {
+		q = &partitionQueue{size: p.config.BatchSize}
+		p.queues[tp] = q
+	}
+	if len(q.batch) == 0 {
+		q.started = time.Now()
+	}
+	q.batch = append(q.batch, r)
+	p.inflight++
+	if len(q.batch) >= q.size {
+		if time.Since(q.started) < p.linger(q)/2 {
+			q.size = min(2*q.size, p.config.MaxBatchSize)
+		}
+		p.ready(tp, q)
+	} else if q.linger == nil {
+		var t *time.Timer
+		t = time.AfterFunc(p.linger(q), func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			if q.linger != t {
+				// the batch was readied, e.g. by a flush, while the timer fired.
+				return
+			}
+			if len(q.batch) < q.size/2 {
+				q.size = max(q.size/2, p.config.BatchSize)
+			}
+			p.ready(tp, q)
+		})
+		q.linger = t
+	}
+	return nil
+}
+
+// linger returns how long the partition's batches linger: the configured linger, or the last
+// throttle time if it's longer. It's called with the lock held.
+func (p *Producer) linger(q *partitionQueue) time.Duration {
+	if q.throttle > p.config.Linger {
+		return q.throttle
+	}
+	return p.config.Linger
+}
+
+// ready queues the partition's batch to be sent. It's called with the lock held.
+func (p *Producer) ready(tp topicPartition, q *partitionQueue) {
+	if q.linger != nil {
+		q.linger.Stop()
+		q.linger = nil
+	}
+	if len(q.batch) == 0 {
+		return
+	}
+	q.ready = append(q.ready, q.batch)
+	q.batch = nil
+	if !q.sending {
+		q.sending = true
+		go p.drain(tp, q)
+	}
+}
+
+// drain sends the partition's ready batches in order until there are none.
+func (p *Producer) drain(tp topicPartition, q *partitionQueue) {
+	for {
+		p.mu.Lock()
+		if len(q.ready) == 0 {
+			q.sending = false
+			p.mu.Unlock()
+			return
+		}
+		batch := q.ready[0]
+		q.ready = q.ready[1:]
+		p.mu.Unlock()
+
+		msgs := make([]*protocol.Message, len(batch))
+		for i, r := range batch {
+			msgs[i] = &protocol.Message{Key: r.Key, Value: r.Value}
+		}
+		set, err := p.encode(msgs)
+		var offset int64
+		var throttle time.Duration
+		if err == nil {
+			offset, throttle, err = p.produce(tp, set)
+		}
+
+		p.mu.Lock()
+		q.throttle = throttle
+		for _, r := range batch {
+			r.Offset, r.Err = offset, err
+			if err != nil {
+				p.failed = append(p.failed, r)
+			}
+		}
+		p.inflight -= len(batch)
+		p.done.Broadcast()
+		p.mu.Unlock()
+
+		if throttle > 0 {
+			// back off for as long as the broker asked before sending the partition's next batch.
+			time.Sleep(throttle)
+		}
+	}
+}
+
+// Flush sends the partitions' batches without lingering and waits for the records in flight to
+// be delivered, or fail, returning those that failed since the last flush as ProduceErrors. It
+// returns ErrFlushTimeout if records are still in flight after the timeout, leaving the failed
+// records to the next flush. A zero timeout waits for as long as it takes.
+func (p *Producer) Flush(timeout time.Duration) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for tp, q := range p.queues {
+		p.ready(tp, q)
+	}
+	var timedOut bool
+	if timeout > 0 {
+		t := time.AfterFunc(timeout, func() {
+			p.mu.Lock()
+			timedOut = true
+			p.done.Broadcast()
+			p.mu.Unlock()
+		})
+		defer t.Stop()
+	}
+	for p.inflight > 0 && !timedOut {
+		p.done.Wait()
+	}
+	if p.inflight > 0 {
+		return ErrFlushTimeout
+	}
+	if len(p.failed) == 0 {
+		return nil
+	}
+	failed := p.failed
+	p.failed = nil
+	return ProduceErrors(failed)
+}
+
+// Close stops the producer taking records and waits for those in flight, returning those that
+// failed like Flush. The producer's client isn't closed.
+func (p *Producer) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+	return p.Flush(0)
+}
+
+// send sends the request to the partition's pinned leader, unpinning it on leader errors.
+func (p *Producer) send(tp topicPartition, req *protocol.ProduceRequest) (int64, time.Duration, error) {
+	leader, err := p.leader(tp)
+	if err != nil {
+		return 0, 0, err
+	}
+	res, err := leader.conn.Produce(req)
+	if err != nil {
+		p.client.CloseConn(leader.conn)
+		p.unpin(tp, leader)
+		return 0, 0, err
+	}
+	for _, tr := range res.Responses {
+		for _, pr := range tr.PartitionResponses {
+			if tr.Topic != tp.topic || pr.Partition != tp.partition {
+				continue
+			}
+			if pr.ErrorCode != protocol.ErrNone.Code() {
+				err := errorFromCode(pr.ErrorCode)
+				if isLeaderError(err) {
+					p.unpin(tp, leader)
+				}
+				return 0, res.ThrottleTime, err
+			}
+			return pr.BaseOffset, res.ThrottleTime, nil
+		}
+	}
+	return 0, res.ThrottleTime, protocol.ErrUnknown
+}
+
+// leader returns the partition's pinned leader, pinning its current leader if there's none.
+func (p *Producer) leader(tp topicPartition) (leaderConn, error) {
+	p.mu.Lock()
+	leader, ok := p.leaders[tp]
+	p.mu.Unlock()
+	if ok {
+		return leader, nil
+	}
+	id, err := p.client.Leader(tp.topic, tp.partition)
+	if err != nil {
+		return leaderConn{}, err
+	}
+	conn, err := p.client.Conn(id)
+	if err != nil {
+		return leaderConn{}, err
+	}
+	leader = leaderConn{id: id, conn: conn}
+	p.mu.Lock()
+	p.leaders[tp] = leader
+	p.mu.Unlock()
+	return leader, nil
+}
+
+// unpin unpins the partition's leader, if it's still the one pinned, and invalidates only the
+// partition's topic so its next send looks up the new leader.
+func (p *Producer) unpin(tp topicPartition, leader leaderConn) {
+	p.mu.Lock()
+	if cur, ok := p.leaders[tp]; ok && cur == leader {
+		delete(p.leaders, tp)
+	}
+	p.mu.Unlock()
+	p.client.Invalidate(tp.topic)
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestProducer_Produce(t *testing.T) {
+	s, teardown := newTestServer(t, "a")
+	defer teardown()
+
+	c, err := New(Config{Brokers: []string{s.Addr().String()}})
+	require.NoError(t, err)
+	defer c.Close()
+	p := NewProducer(c, ProducerConfig{})
+
+	for i := int64(0); i < 3; i++ {
+		offset, err := p.Produce("a", 1, &protocol.Message{Value: []byte("hello")})
+		require.NoError(t, err)
+		require.Equal(t, i, offset)
+	}
+	leader := p.leaders[topicPartition{topic: "a", partition: 1}]
+	require.Equal(t, s.ID(), leader.id)
+
+	// a broken connection unpins the leader and the send's retried with a new one.
+	leader.conn.Close()
+	offset, err := p.Produce("a", 1, &protocol.Message{Value: []byte("hello")})
+	require.NoError(t, err)
+	require.Equal(t, int64(3), offset)
+	require.False(t, leader == p.leaders[topicPartition{topic: "a", partition: 1}])
+
+	_, err = p.Produce("a", 5, &protocol.Message{Value: []byte("hello")})
+	require.Equal(t, protocol.ErrUnknownTopicOrPartition, err)
+}
+
+func TestProducer_Send(t *testing.T) {
+	s, teardown := newTestServer(t, "a")
+	defer teardown()
+
+	c, err := New(Config{Brokers: []string{s.Addr().String()}})
+	require.NoError(t, err)
+	defer c.Close()
+	p := NewProducer(c, ProducerConfig{BatchSize: 4, Linger: time.Hour})
+
+	var records []*Record
+	for i := 0; i < 10; i++ {
+		r := &Record{Topic: "a", Partition: int32(i % 2), Value: []byte(fmt.Sprintf("msg-%d", i))}
+		require.NoError(t, p.Send(r))
+		records = append(records, r)
+	}
+	// the full batches are sent without lingering, the rest once flushed.
+	require.NoError(t, p.Flush(10*time.Second))
+	for i, r := range records {
+		require.NoError(t, r.Err)
+		// partitions' records are sent in order, 4 to a batch appended at an offset.
+		require.Equal(t, int64(i/2/4), r.Offset)
+	}
+	// the batches filled well within their linger so the partitions' batch sizes grew.
+	require.Equal(t, 8, p.queues[topicPartition{topic: "a", partition: 0}].size)
+
+	// records to unknown partitions fail, returned by the next flush.
+	bad := &Record{Topic: "a", Partition: 5, Value: []byte("hello")}
+	require.NoError(t, p.Send(bad))
+	require.NoError(t, p.Send(&Record{Topic: "a", Partition: 0, Value: []byte("hello")}))
+	err = p.Close()
+	require.Equal(t, ProduceErrors{bad}, err)
+	require.Equal(t, protocol.ErrUnknownTopicOrPartition, bad.Err)
+	require.NoError(t, p.Flush(0))
+
+	require.Equal(t, ErrClosed, p.Send(&Record{Topic: "a", Value: []byte("hello")}))
+}
+
+func TestProducer_Compression(t *testing.T) {
+	s, teardown := newTestServer(t, "a")
+	defer teardown()
+
+	c, err := New(Config{Brokers: []string{s.Addr().String()}})
+	require.NoError(t, err)
+	defer c.Close()
+	p := NewProducer(c, ProducerConfig{Compression: protocol.CompressionGZIP})
+
+	msgs := []*protocol.Message{{Value: []byte("hello")}, {Key: []byte("key"), Value: []byte("world")}}
+	offset, err := p.Produce("a", 0, msgs...)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), offset)
+
+	conn, err := c.Conn(s.ID())
+	require.NoError(t, err)
+	res, err := conn.Fetch(&protocol.FetchRequest{
+		MaxWaitTime: time.Second,
+		MinBytes:    1,
+		MaxBytes:    1 << 20,
+		Topics: []*protocol.FetchTopic{{
+			Topic:      "a",
+			Partitions: []*protocol.FetchPartition{{Partition: 0, MaxBytes: 1 << 20}},
+		}},
+	})
+	require.NoError(t, err)
+	pres := res.Responses[0].PartitionResponses[0]
+	require.Equal(t, protocol.ErrNone.Code(), pres.ErrorCode)
+
+	// the messages are appended as one wrapper message, its value the compressed message set.
+	wrapper := new(protocol.MessageSet)
+	require.NoError(t, wrapper.Decode(protocol.NewDecoder(pres.RecordSet)))
+	require.Equal(t, 1, len(wrapper.Messages))
+	require.Equal(t, protocol.CompressionGZIP, wrapper.Messages[0].Codec())
+	b, err := protocol.Decompress(wrapper.Messages[0].Codec(), wrapper.Messages[0].Value)
+	require.NoError(t, err)
+	set := new(protocol.MessageSet)
+	require.NoError(t, set.Decode(protocol.NewDecoder(b)))
+	require.Equal(t, 2, len(set.Messages))
+	require.Equal(t, []byte("hello"), set.Messages[0].Value)
+	require.Equal(t, []byte("key"), set.Messages[1].Key)
+	require.Equal(t, []byte("world"), set.Messages[1].Value)
+
+	p = NewProducer(c, ProducerConfig{Compression: protocol.CompressionCodec(7)})
+	_, err = p.Produce("a", 0, msgs...)
+	require.Equal(t, protocol.ErrUnsupportedCompressionType, err)
+}
@@ -0,0 +1,312 @@
+package client
+
+import (
+	"errors"
+	"time"
+
+	"github.com/travisjeffery/jocko/jocko"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+// ErrNoTransaction is returned by transactional producers asked to produce, commit offsets, or end
+// a transaction when they haven't begun one.
+var ErrNoTransaction = errors.New("client: no transaction in progress")
+
+// Offset is a group's offset of a partition, the offset of the next record to consume from it.
+type Offset struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+}
+
+// TransactionalProducer produces records in transactions, which read committed consumers see all
+// of, once they're committed, or none of. The offsets of the records consumed to produce them can
+// be committed in the same transaction, so consume-transform-produce loops process each record
+// exactly once.
+//
+// The transactional ID identifies the producer across restarts: creating a producer with it
+// aborts the previous instance's ongoing transaction and fences the instance off, so its later
+// requests fail with an invalid producer epoch error. A transaction that fails must be aborted,
+// and a producer that's been fenced, or fails to abort, must be replaced by a new one.
+//
+// It's not safe for concurrent use.
+type TransactionalProducer struct {
+	client          *Client
+	producer        *Producer
+	config          ProducerConfig
+	transactionalID string
+	producerID      int64
+	producerEpoch   int16
+	coordinator     *jocko.Conn
+
+	// sequences are the sequences of the partitions' next batches.
+	sequences map[topicPartition]int32
+	inTxn     bool
+	// partitions and groups are those added to the ongoing transaction.
+	partitions map[topicPartition]bool
+	groups     map[string]bool
+}
+
+// NewTransactionalProducer returns a transactional producer with the transactional ID, producing
+// with the client. The config's Acks are always the ISR's, and its batching fields are unused
+// since records are produced a batch at a time.
+func NewTransactionalProducer(client *Client, transactionalID string, config ProducerConfig) (*TransactionalProducer, error) {
+	if transactionalID == "" {
+		return nil, errors.New("client: no transactional id given")
+	}
+	config.Acks = -1
+	p := &TransactionalProducer{
+		client:          client,
+		producer:        NewProducer(client, config),
+		transactionalID: transactionalID,
+		sequences:       make(map[topicPartition]int32),
+	}
+	p.config = p.producer.config
+	err := p.coordinate(func(conn *jocko.Conn) (int16, error) {
+		res, err := conn.InitProducerID(&protocol.InitProducerIDRequest{
+			APIVersion:         1,
+			TransactionalID:    &transactionalID,
+			TransactionTimeout: time.Minute,
+		})
+		if err != nil {
+			return 0, err
+		}
+		p.producerID, p.producerEpoch = res.ProducerID, res.ProducerEpoch
+		return res.ErrorCode, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Begin begins a transaction.
+func (p *TransactionalProducer) Begin() error {
+	if p.inTxn {
+		return errors.New("client: transaction already in progress")
+	}
+	p.inTxn = true
+	p.partitions = make(map[topicPartition]bool)
+	p.groups = make(map[string]bool)
+	return nil
+}
+
+// Produce produces the records to the partition in the transaction, as one batch, and returns the
+// offset of the first. The records' topics and partitions are ignored.
+func (p *TransactionalProducer) Produce(topic string, partition int32, records ...*Record) (int64, error) {
+	if !p.inTxn {
+		return 0, ErrNoTransaction
+	}
+	tp := topicPartition{topic: topic, partition: partition}
+	if !p.partitions[tp] {
+		if err := p.addPartition(tp); err != nil {
+			return 0, err
+		}
+		p.partitions[tp] = true
+	}
+	now := time.Now()
+	batch := &protocol.RecordBatch{
+		Attributes:      protocol.TransactionalAttribute | int16(p.config.Compression),
+		LastOffsetDelta: int32(len(records) - 1),
+		FirstTimestamp:  now,
+		MaxTimestamp:    now,
+		ProducerID:      p.producerID,
+		ProducerEpoch:   p.producerEpoch,
+		FirstSequence:   p.sequences[tp],
+	}
+	for i, r := range records {
+		batch.Records = append(batch.Records, &protocol.Record{OffsetDelta: int64(i), Key: r.Key, Value: r.Value})
+	}
+	set, err := protocol.Encode(batch)
+	if err != nil {
+		return 0, err
+	}
+	offset, _, err := p.producer.produceRequest(tp, &protocol.ProduceRequest{
+		APIVersion:      3,
+		TransactionalID: &p.transactionalID,
+		Acks:            p.config.Acks,
+		Timeout:         p.config.Timeout,
+		TopicData: []*protocol.TopicData{{
+			Topic: topic,
+			Data:  []*protocol.Data{{Partition: partition, RecordSet: set}},
+		}},
+	})
+	if err == protocol.ErrDuplicateSequenceNumber {
+		// a retry of a batch that was appended though its response was lost.
+		offset, err = -1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	p.sequences[tp] += int32(len(records))
+	return offset, nil
+}
+
+// addPartition adds the partition to the transaction, so its records are committed or aborted
+// with it.
+func (p *TransactionalProducer) addPartition(tp topicPartition) error {
+	return p.coordinate(func(conn *jocko.Conn) (int16, error) {
+		res, err := conn.AddPartitionsToTxn(&protocol.AddPartitionsToTxnRequest{
+			TransactionalID: p.transactionalID,
+			ProducerID:      p.producerID,
+			ProducerEpoch:   p.producerEpoch,
+			Topics:          []*protocol.AddPartitionsToTxnRequestAddPartitionsToTxnTopic{{Name: tp.topic, Partitions: []int32{tp.partition}}},
+		})
+		if err != nil {
+			return 0, err
+		}
+		for _, t := range res.Results {
+			for _, r := range t.Results {
+				if r.ErrorCode != protocol.ErrNone.Code() {
+					return r.ErrorCode, nil
+				}
+			}
+		}
+		return protocol.ErrNone.Code(), nil
+	})
+}
+
+// SendOffsets commits the group's offsets in the transaction, so they're committed if and only if
+// the transaction is.
+func (p *TransactionalProducer) SendOffsets(group string, offsets []Offset) error {
+	if !p.inTxn {
+		return ErrNoTransaction
+	}
+	if !p.groups[group] {
+		err := p.coordinate(func(conn *jocko.Conn) (int16, error) {
+			res, err := conn.AddOffsetsToTxn(&protocol.AddOffsetsToTxnRequest{
+				TransactionalID: p.transactionalID,
+				ProducerID:      p.producerID,
+				ProducerEpoch:   p.producerEpoch,
+				GroupID:         group,
+			})
+			if err != nil {
+				return 0, err
+			}
+			return res.ErrorCode, nil
+		})
+		if err != nil {
+			return err
+		}
+		p.groups[group] = true
+	}
+	req := &protocol.TxnOffsetCommitRequest{
+		TransactionalID: p.transactionalID,
+		GroupID:         group,
+		ProducerID:      p.producerID,
+		ProducerEpoch:   p.producerEpoch,
+	}
+	topics := make(map[string]*protocol.TxnOffsetCommitRequestTopic)
+	for _, o := range offsets {
+		t, ok := topics[o.Topic]
+		if !ok {
+			t = &protocol.TxnOffsetCommitRequestTopic{Name: o.Topic}
+			topics[o.Topic] = t
+			req.Topics = append(req.Topics, t)
+		}
+		t.Partitions = append(t.Partitions, &protocol.TxnOffsetCommitRequestPartition{PartitionIndex: o.Partition, CommittedOffset: o.Offset})
+	}
+	return p.coordinate(func(conn *jocko.Conn) (int16, error) {
+		res, err := conn.TxnOffsetCommit(req)
+		if err != nil {
+			return 0, err
+		}
+		for _, t := range res.Topics {
+			for _, r := range t.Partitions {
+				if r.ErrorCode != protocol.ErrNone.Code() {
+					return r.ErrorCode, nil
+				}
+			}
+		}
+		return protocol.ErrNone.Code(), nil
+	})
+}
+
+// Commit commits the transaction, making its records visible to read committed consumers and
+// committing its offsets.
+func (p *TransactionalProducer) Commit() error {
+	return p.end(true)
+}
+
+// Abort aborts the transaction, so read committed consumers skip its records, and its offsets
+// aren't committed.
+func (p *TransactionalProducer) Abort() error {
+	return p.end(false)
+}
+
+func (p *TransactionalProducer) end(commit bool) error {
+	if !p.inTxn {
+		return ErrNoTransaction
+	}
+	err := p.coordinate(func(conn *jocko.Conn) (int16, error) {
+		res, err := conn.EndTxn(&protocol.EndTxnRequest{
+			TransactionalID: p.transactionalID,
+			ProducerID:      p.producerID,
+			ProducerEpoch:   p.producerEpoch,
+			Committed:       commit,
+		})
+		if err != nil {
+			return 0, err
+		}
+		return res.ErrorCode, nil
+	})
+	if err != nil {
+		return err
+	}
+	p.inTxn = false
+	return nil
+}
+
+// coordinate sends a request to the transaction coordinator with fn, which returns the response's
+// error code, retrying retriable errors up to the producer's retries. The coordinator's looked up
+// again after connection and coordinator errors.
+func (p *TransactionalProducer) coordinate(fn func(conn *jocko.Conn) (int16, error)) error {
+	for attempt := 0; ; attempt++ {
+		err := p.tryCoordinate(fn)
+		if err == nil || !isRetriableTxnError(err) || attempt == p.config.Retries {
+			return err
+		}
+		time.Sleep(p.client.config.MetadataRefreshBackoff)
+	}
+}
+
+func (p *TransactionalProducer) tryCoordinate(fn func(conn *jocko.Conn) (int16, error)) error {
+	if p.coordinator == nil {
+		conn, err := p.client.Coordinator(p.transactionalID, protocol.CoordinatorTransaction)
+		if err != nil {
+			return err
+		}
+		p.coordinator = conn
+	}
+	code, err := fn(p.coordinator)
+	if err != nil {
+		p.client.CloseConn(p.coordinator)
+		p.coordinator = nil
+		return err
+	}
+	if code == protocol.ErrNone.Code() {
+		return nil
+	}
+	err = errorFromCode(code)
+	if code == protocol.ErrNotCoordinator.Code() || code == protocol.ErrCoordinatorNotAvailable.Code() {
+		p.coordinator = nil
+	}
+	return err
+}
+
+// isRetriableTxnError returns whether the transaction request may succeed if it's retried.
+func isRetriableTxnError(err error) bool {
+	perr, ok := err.(protocol.Error)
+	if !ok {
+		// a network error.
+		return true
+	}
+	switch perr.Code() {
+	case protocol.ErrNotCoordinator.Code(),
+		protocol.ErrCoordinatorNotAvailable.Code(),
+		protocol.ErrCoordinatorLoadInProgress.Code(),
+		protocol.ErrConcurrentTransactions.Code():
+		return true
+	}
+	return false
+}
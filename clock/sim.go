@@ -0,0 +1,169 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Sim is a simulated clock. Its time only moves when it's advanced, firing the timers and tickers
+// that come due in order, so code waiting on timeouts can be tested without real sleeps.
+type Sim struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	seq     uint64
+	waiters []*simTimer
+}
+
+// NewSim returns a simulated clock set to now.
+func NewSim(now time.Time) *Sim {
+	s := &Sim{now: now}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// Now returns the simulated time.
+func (s *Sim) Now() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.now
+}
+
+// Since returns the simulated time elapsed since t.
+func (s *Sim) Since(t time.Time) time.Duration {
+	return s.Now().Sub(t)
+}
+
+// Sleep blocks until the clock's been advanced by d.
+func (s *Sim) Sleep(d time.Duration) {
+	<-s.After(d)
+}
+
+// After returns a channel sent the time once the clock's been advanced by d.
+func (s *Sim) After(d time.Duration) <-chan time.Time {
+	return s.NewTimer(d).C()
+}
+
+// NewTimer returns a timer that fires once the clock's been advanced by d.
+func (s *Sim) NewTimer(d time.Duration) Timer {
+	t := &simTimer{s: s, c: make(chan time.Time, 1)}
+	s.mu.Lock()
+	s.schedule(t, d)
+	s.mu.Unlock()
+	return t
+}
+
+// NewTicker returns a ticker that fires each time the clock's been advanced by another d.
+func (s *Sim) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	t := &simTimer{s: s, c: make(chan time.Time, 1), period: d}
+	s.mu.Lock()
+	s.schedule(t, d)
+	s.mu.Unlock()
+	return simTicker{t}
+}
+
+// Advance moves the clock forward by d, firing the timers and tickers due by then in the order
+// they're due. Timers due at the same time fire in the order they were set.
+func (s *Sim) Advance(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	end := s.now.Add(d)
+	for len(s.waiters) > 0 && !s.waiters[0].when.After(end) {
+		t := s.waiters[0]
+		s.now = t.when
+		s.remove(t)
+		// like the time package's, the channels hold a single value and ticks are dropped if
+		// the receiver's behind.
+		select {
+		case t.c <- s.now:
+		default:
+		}
+		if t.period > 0 {
+			s.schedule(t, t.period)
+		}
+	}
+	s.now = end
+}
+
+// Waiters returns the number of timers and tickers waiting to fire.
+func (s *Sim) Waiters() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.waiters)
+}
+
+// BlockUntil blocks until at least n timers and tickers are waiting to fire, e.g. so a test
+// advances the clock only once the code under test has set its timeout.
+func (s *Sim) BlockUntil(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.waiters) < n {
+		s.cond.Wait()
+	}
+}
+
+// schedule adds t to fire after d. The caller must hold the lock.
+func (s *Sim) schedule(t *simTimer, d time.Duration) {
+	s.seq++
+	t.when, t.seq, t.active = s.now.Add(d), s.seq, true
+	i := sort.Search(len(s.waiters), func(i int) bool {
+		w := s.waiters[i]
+		return w.when.After(t.when) || (w.when.Equal(t.when) && w.seq > t.seq)
+	})
+	s.waiters = append(s.waiters, nil)
+	copy(s.waiters[i+1:], s.waiters[i:])
+	s.waiters[i] = t
+	s.cond.Broadcast()
+}
+
+// remove removes t from the waiters and returns whether it was waiting. The caller must hold
+// the lock.
+func (s *Sim) remove(t *simTimer) bool {
+	if !t.active {
+		return false
+	}
+	t.active = false
+	for i, w := range s.waiters {
+		if w == t {
+			s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+type simTimer struct {
+	s      *Sim
+	c      chan time.Time
+	when   time.Time
+	seq    uint64
+	period time.Duration
+	active bool
+}
+
+func (t *simTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *simTimer) Stop() bool {
+	t.s.mu.Lock()
+	defer t.s.mu.Unlock()
+	return t.s.remove(t)
+}
+
+func (t *simTimer) Reset(d time.Duration) bool {
+	t.s.mu.Lock()
+	defer t.s.mu.Unlock()
+	active := t.s.remove(t)
+	t.s.schedule(t, d)
+	return active
+}
+
+type simTicker struct{ t *simTimer }
+
+func (t simTicker) C() <-chan time.Time { return t.t.c }
+func (t simTicker) Stop()               { t.t.Stop() }
@@ -0,0 +1,81 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSim(t *testing.T) {
+	req := require.New(t)
+	start := time.Unix(1000, 0)
+	s := NewSim(start)
+
+	fired := func(c <-chan time.Time) (time.Time, bool) {
+		select {
+		case now := <-c:
+			return now, true
+		default:
+			return time.Time{}, false
+		}
+	}
+
+	a := s.NewTimer(2 * time.Second)
+	b := s.NewTimer(time.Second)
+	tick := s.NewTicker(time.Second)
+	stopped := s.NewTimer(time.Second)
+	req.True(stopped.Stop())
+	req.False(stopped.Stop())
+	req.Equal(3, s.Waiters())
+
+	s.Advance(999 * time.Millisecond)
+	_, ok := fired(b.C())
+	req.False(ok)
+
+	s.Advance(time.Millisecond)
+	now, ok := fired(b.C())
+	req.True(ok)
+	req.Equal(start.Add(time.Second), now)
+	now, ok = fired(tick.C())
+	req.True(ok)
+	req.Equal(start.Add(time.Second), now)
+	_, ok = fired(a.C())
+	req.False(ok)
+	_, ok = fired(stopped.C())
+	req.False(ok)
+
+	// resetting reschedules from the current time.
+	req.True(a.Reset(2 * time.Second))
+	s.Advance(time.Second)
+	_, ok = fired(a.C())
+	req.False(ok)
+	s.Advance(time.Second)
+	now, ok = fired(a.C())
+	req.True(ok)
+	req.Equal(start.Add(3*time.Second), now)
+
+	// the ticker's channel holds one tick, the others are dropped while it's not read.
+	now, ok = fired(tick.C())
+	req.True(ok)
+	req.Equal(start.Add(2*time.Second), now)
+	_, ok = fired(tick.C())
+	req.False(ok)
+	tick.Stop()
+	req.Equal(0, s.Waiters())
+	req.Equal(start.Add(3*time.Second), s.Now())
+	req.Equal(3*time.Second, s.Since(start))
+
+	done := make(chan struct{})
+	go func() {
+		s.Sleep(time.Minute)
+		close(done)
+	}()
+	s.BlockUntil(1)
+	s.Advance(time.Minute)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		req.Fail("sleep didn't return")
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/travisjeffery/jocko/jocko"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+var compactCfg = struct {
+	BrokerAddr string
+	Topic      string
+	Partition  int32
+}{}
+
+func init() {
+	compactCmd := &cobra.Command{
+		Use:   "compact-partition",
+		Short: "Compact a compacted topic's partition on a broker now, e.g. to recover disk space in an emergency",
+		Run:   compactPartition,
+		Args:  cobra.NoArgs,
+	}
+	compactCmd.Flags().StringVar(&compactCfg.BrokerAddr, "broker-addr", "0.0.0.0:9092", "Address of the broker with the replica to compact")
+	compactCmd.Flags().StringVar(&compactCfg.Topic, "topic", "", "Name of the topic")
+	compactCmd.Flags().Int32Var(&compactCfg.Partition, "partition", 0, "ID of the partition")
+	cli.AddCommand(compactCmd)
+}
+
+func compactPartition(cmd *cobra.Command, args []string) {
+	conn, err := jocko.Dial("tcp", compactCfg.BrokerAddr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error connecting to broker: %v\n", err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+
+	resp, err := conn.CompactPartition(&protocol.CompactPartitionRequest{
+		Topic:     compactCfg.Topic,
+		Partition: compactCfg.Partition,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error with request to broker: %v\n", err)
+		os.Exit(1)
+	}
+	if resp.ErrorCode != protocol.ErrNone.Code() {
+		exitResponseErr(resp.ErrorCode, resp.ErrorMessage)
+	}
+	fmt.Printf("compacted %s/%d: reclaimed %d bytes\n", compactCfg.Topic, compactCfg.Partition, resp.ReclaimedBytes)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/spf13/pflag"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// envPrefix prefixes the environment variables that set broker flags, e.g. JOCKO_BROKER_ADDR
+// sets --broker-addr.
+const envPrefix = "JOCKO_"
+
+// loadConfig sets the flags not given on the command line from the YAML config file at path, if
+// given, and from JOCKO_ environment variables. The file's keys are the flags' names. Flags given
+// on the command line take precedence over the environment, which takes precedence over the file.
+// Unknown keys in the file are errors, unknown environment variables are ignored.
+func loadConfig(flags *pflag.FlagSet, path string, environ []string) error {
+	values := make(map[string]string)
+	source := make(map[string]string)
+
+	if path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read config file: %v", err)
+		}
+		var file map[string]interface{}
+		if err := yaml.Unmarshal(b, &file); err != nil {
+			return fmt.Errorf("parse config file %s: %v", path, err)
+		}
+		for k, v := range file {
+			values[k] = configValue(v)
+			source[k] = fmt.Sprintf("config file key %q", k)
+		}
+	}
+
+	for _, kv := range environ {
+		if !strings.HasPrefix(kv, envPrefix) {
+			continue
+		}
+		i := strings.Index(kv, "=")
+		if i < 0 {
+			continue
+		}
+		env := kv[:i]
+		k := strings.Replace(strings.ToLower(strings.TrimPrefix(env, envPrefix)), "_", "-", -1)
+		if flags.Lookup(k) == nil || k == "config" {
+			continue
+		}
+		values[k] = kv[i+1:]
+		source[k] = fmt.Sprintf("environment variable %s", env)
+	}
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		f := flags.Lookup(k)
+		if f == nil || k == "config" {
+			return fmt.Errorf("%s: unknown option %q", source[k], k)
+		}
+		if f.Changed {
+			continue
+		}
+		if err := flags.Set(k, values[k]); err != nil {
+			return fmt.Errorf("%s: invalid value %q: %v", source[k], values[k], err)
+		}
+	}
+	return nil
+}
+
+// configValue formats a value from the config file as it'd be given on the command line.
+func configValue(v interface{}) string {
+	if vs, ok := v.([]interface{}); ok {
+		ss := make([]string, len(vs))
+		for i, v := range vs {
+			ss[i] = fmt.Sprint(v)
+		}
+		return strings.Join(ss, ",")
+	}
+	return fmt.Sprint(v)
+}
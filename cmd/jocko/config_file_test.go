@@ -0,0 +1,57 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jocko-config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "jocko.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(`
+id: 2
+broker-addr: 127.0.0.1:9092
+raft-addr: 127.0.0.1:9093
+join:
+  - 127.0.0.1:9094
+  - 127.0.0.1:9095
+`), 0644))
+
+	var (
+		id         int32
+		brokerAddr string
+		raftAddr   string
+		join       []string
+	)
+	flags := pflag.NewFlagSet("broker", pflag.ContinueOnError)
+	flags.Int32Var(&id, "id", 0, "")
+	flags.StringVar(&brokerAddr, "broker-addr", "", "")
+	flags.StringVar(&raftAddr, "raft-addr", "", "")
+	flags.StringSliceVar(&join, "join", nil, "")
+	require.NoError(t, flags.Parse([]string{"--raft-addr", "127.0.0.1:9193"}))
+
+	err = loadConfig(flags, path, []string{"JOCKO_BROKER_ADDR=127.0.0.1:9192", "JOCKO_RAFT_ADDR=127.0.0.1:9293", "JOCKO_UNKNOWN=1"})
+	require.NoError(t, err)
+	require.Equal(t, int32(2), id)
+	require.Equal(t, "127.0.0.1:9192", brokerAddr)
+	require.Equal(t, "127.0.0.1:9193", raftAddr)
+	require.Equal(t, []string{"127.0.0.1:9094", "127.0.0.1:9095"}, join)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("id: two\n"), 0644))
+	err = loadConfig(pflag.NewFlagSet("broker", pflag.ContinueOnError), path, nil)
+	require.EqualError(t, err, `config file key "id": unknown option "id"`)
+
+	flags = pflag.NewFlagSet("broker", pflag.ContinueOnError)
+	flags.Int32Var(&id, "id", 0, "")
+	err = loadConfig(flags, path, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `config file key "id": invalid value "two"`)
+}
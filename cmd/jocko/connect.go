@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	gracefully "github.com/tj/go-gracefully"
+	"github.com/travisjeffery/jocko/client"
+	"github.com/travisjeffery/jocko/connect"
+)
+
+var connectCfg = struct {
+	BrokerAddrs []string
+	Addr        string
+	DataDir     string
+}{}
+
+func init() {
+	connectCmd := &cobra.Command{Use: "connect", Short: "Run a worker running file and S3 connectors, managed through its admin API", Run: runConnect, Args: cobra.NoArgs}
+	connectCmd.Flags().StringSliceVar(&connectCfg.BrokerAddrs, "broker-addr", []string{"0.0.0.0:9092"}, "Address of a broker in the cluster. Can be specified multiple times.")
+	connectCmd.Flags().StringVar(&connectCfg.Addr, "addr", "0.0.0.0:8083", "Address to serve the admin API on")
+	connectCmd.Flags().StringVar(&connectCfg.DataDir, "data-dir", "/tmp/jocko-connect", "Directory to keep the connectors' configs and sources' positions in")
+	cli.AddCommand(connectCmd)
+}
+
+func runConnect(cmd *cobra.Command, args []string) {
+	c, err := client.New(client.Config{Brokers: connectCfg.BrokerAddrs})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error creating client: %v\n", err)
+		os.Exit(1)
+	}
+	defer c.Close()
+
+	w, err := connect.NewWorker(c, connectCfg.DataDir, connect.Plugins())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error starting worker: %v\n", err)
+		os.Exit(1)
+	}
+	defer w.Close()
+
+	go func() {
+		if err := http.ListenAndServe(connectCfg.Addr, connect.Handler(w)); err != nil {
+			fmt.Fprintf(os.Stderr, "error serving admin api: %v\n", err)
+			os.Exit(1)
+		}
+	}()
+
+	gracefully.Timeout = 10 * time.Second
+	gracefully.Shutdown()
+}
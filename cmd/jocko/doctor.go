@@ -0,0 +1,307 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/travisjeffery/jocko/jocko"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+var doctorCfg = struct {
+	BrokerAddr   string
+	Timeout      time.Duration
+	DiskFreeMin  float64
+	RaftLagMax   int64
+	MaxClockSkew time.Duration
+	LeaderSkew   float64
+}{}
+
+func init() {
+	doctorCmd := &cobra.Command{Use: "doctor", Short: "Check a running cluster for common problems", Run: doctor, Args: cobra.NoArgs}
+	doctorCmd.Flags().StringVar(&doctorCfg.BrokerAddr, "broker-addr", "0.0.0.0:9092", "Address of a broker in the cluster")
+	doctorCmd.Flags().DurationVar(&doctorCfg.Timeout, "timeout", 5*time.Second, "Timeout of each broker's health check")
+	doctorCmd.Flags().Float64Var(&doctorCfg.DiskFreeMin, "disk-free-min", 0.1, "Fraction of a broker's data dir disk below which it's nearly full")
+	doctorCmd.Flags().Int64Var(&doctorCfg.RaftLagMax, "raft-lag-max", 1000, "Number of raft entries a broker can be behind the leader applying")
+	doctorCmd.Flags().DurationVar(&doctorCfg.MaxClockSkew, "max-clock-skew", time.Second, "Largest difference allowed between the brokers' clocks")
+	doctorCmd.Flags().Float64Var(&doctorCfg.LeaderSkew, "leader-skew", 0.5, "Fraction over the brokers' average number of leaderships a broker can lead")
+	cli.AddCommand(doctorCmd)
+}
+
+type severity int
+
+const (
+	warning severity = iota
+	critical
+)
+
+func (s severity) String() string {
+	if s == critical {
+		return "CRITICAL"
+	}
+	return "WARNING"
+}
+
+// finding is a problem found with the cluster and how to fix it.
+type finding struct {
+	severity severity
+	check    string
+	problem  string
+	fix      string
+}
+
+// brokerHealth is a broker's health check, or the error checking it.
+type brokerHealth struct {
+	addr string
+	res  *protocol.BrokerHealthResponse
+	err  error
+	// offset is how far the broker's clock is ahead of ours, estimated assuming the request took
+	// as long as the response, so it's off by up to half the round trip.
+	offset time.Duration
+	rtt    time.Duration
+}
+
+type doctorOptions struct {
+	diskFreeMin  float64
+	raftLagMax   int64
+	maxClockSkew time.Duration
+	leaderSkew   float64
+}
+
+func doctor(cmd *cobra.Command, args []string) {
+	conn, err := jocko.Dial("tcp", doctorCfg.BrokerAddr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error connecting to broker: %v\n", err)
+		os.Exit(1)
+	}
+	meta, err := conn.Metadata(&protocol.MetadataRequest{APIVersion: 1})
+	conn.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error with request to broker: %v\n", err)
+		os.Exit(1)
+	}
+
+	health := make(map[int32]*brokerHealth, len(meta.Brokers))
+	for _, b := range meta.Brokers {
+		health[b.NodeID] = checkBrokerHealth(net.JoinHostPort(b.Host, strconv.Itoa(int(b.Port))), doctorCfg.Timeout)
+	}
+
+	findings := diagnose(meta, health, doctorOptions{
+		diskFreeMin:  doctorCfg.DiskFreeMin,
+		raftLagMax:   doctorCfg.RaftLagMax,
+		maxClockSkew: doctorCfg.MaxClockSkew,
+		leaderSkew:   doctorCfg.LeaderSkew,
+	})
+	var partitions int
+	for _, t := range meta.TopicMetadata {
+		partitions += len(t.PartitionMetadata)
+	}
+	if len(findings) == 0 {
+		fmt.Printf("no problems found: %d brokers, %d topics, %d partitions\n", len(meta.Brokers), len(meta.TopicMetadata), partitions)
+		return
+	}
+	var crit bool
+	for _, f := range findings {
+		fmt.Printf("%-8s  %s: %s\n          fix: %s\n", f.severity, f.check, f.problem, f.fix)
+		crit = crit || f.severity == critical
+	}
+	if crit {
+		os.Exit(1)
+	}
+}
+
+func checkBrokerHealth(addr string, timeout time.Duration) *brokerHealth {
+	h := checkBrokerHealthVersion(addr, timeout, 1)
+	if h.err != nil {
+		// brokers predating version 1 close the connection on it, so they're asked with version 0.
+		if h0 := checkBrokerHealthVersion(addr, timeout, 0); h0.err == nil {
+			return h0
+		}
+	}
+	return h
+}
+
+func checkBrokerHealthVersion(addr string, timeout time.Duration, version int16) *brokerHealth {
+	h := &brokerHealth{addr: addr}
+	d := jocko.NewDialer("jocko-doctor")
+	d.Timeout = timeout
+	conn, err := d.Dial("tcp", addr)
+	if err != nil {
+		h.err = err
+		return h
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	start := time.Now()
+	h.res, h.err = conn.BrokerHealth(&protocol.BrokerHealthRequest{APIVersion: version})
+	h.rtt = time.Since(start)
+	if h.err == nil {
+		h.offset = h.res.Time.Sub(start.Add(h.rtt / 2))
+	}
+	return h
+}
+
+// diagnose checks the cluster's metadata and its brokers' health checks for problems, most severe
+// first.
+func diagnose(meta *protocol.MetadataResponse, health map[int32]*brokerHealth, opts doctorOptions) []finding {
+	var findings []finding
+	add := func(s severity, check, fix, format string, args ...interface{}) {
+		findings = append(findings, finding{severity: s, check: check, problem: fmt.Sprintf(format, args...), fix: fix})
+	}
+
+	live := make(map[int32]bool, len(meta.Brokers))
+	var ids []int32
+	for _, b := range meta.Brokers {
+		live[b.NodeID] = true
+		ids = append(ids, b.NodeID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		if h := health[id]; h != nil && h.err != nil {
+			add(critical, "unreachable broker", "check the broker's process is running and its address is reachable from here",
+				"broker %d at %s didn't answer its health check: %v", id, h.addr, h.err)
+		}
+	}
+
+	topics := append([]*protocol.TopicMetadata(nil), meta.TopicMetadata...)
+	sort.Slice(topics, func(i, j int) bool { return topics[i].Topic < topics[j].Topic })
+	leaders := make(map[int32]int)
+	var led int
+	for _, t := range topics {
+		if t.TopicErrorCode != protocol.ErrNone.Code() {
+			add(critical, "unavailable topic", "check the controller's logs for errors loading the topic",
+				"topic %s: %s", t.Topic, protocol.Errs[t.TopicErrorCode])
+			continue
+		}
+		partitions := append([]*protocol.PartitionMetadata(nil), t.PartitionMetadata...)
+		sort.Slice(partitions, func(i, j int) bool { return partitions[i].PartitionID < partitions[j].PartitionID })
+		for _, p := range partitions {
+			if p.PartitionErrorCode != protocol.ErrNone.Code() || p.Leader < 0 || !live[p.Leader] {
+				candidates := p.ISR
+				if len(candidates) == 0 {
+					candidates = p.Replicas
+				}
+				add(critical, "offline partition", fmt.Sprintf("bring back one of its replicas, brokers %s", joinIDs(candidates)),
+					"topic %s partition %d has no live leader", t.Topic, p.PartitionID)
+				continue
+			}
+			leaders[p.Leader]++
+			led++
+			if missing := missingIDs(p.Replicas, p.ISR); len(missing) != 0 {
+				add(warning, "under-replicated partition", fmt.Sprintf("check brokers %s are up and their logs for replication errors", joinIDs(missing)),
+					"topic %s partition %d has %d of %d replicas in sync", t.Topic, p.PartitionID, len(p.ISR), len(p.Replicas))
+			}
+		}
+	}
+
+	if len(ids) > 1 && led > 0 {
+		avg := float64(led) / float64(len(ids))
+		for _, id := range ids {
+			if n := leaders[id]; float64(n) > avg*(1+opts.leaderSkew) && float64(n)-avg >= 2 {
+				add(warning, "skewed leadership", fmt.Sprintf("move leaderships off it with jocko maintenance start --id %d, then stop", id),
+					"broker %d leads %d partitions, the brokers average %.1f", id, n, avg)
+			}
+		}
+	}
+
+	var reachable []int32
+	var raftLeader *protocol.BrokerHealthResponse
+	for _, id := range ids {
+		if h := health[id]; h != nil && h.err == nil {
+			reachable = append(reachable, id)
+			if h.res.RaftState == "Leader" {
+				raftLeader = h.res
+			}
+		}
+	}
+	if len(reachable) != 0 && raftLeader == nil {
+		add(critical, "no raft leader", "check enough of the voting brokers are up for a quorum and their logs for election errors",
+			"none of the brokers is the raft leader")
+	}
+	for _, id := range reachable {
+		res := health[id].res
+		if raftLeader != nil {
+			if lag := raftLeader.RaftLastIndex - res.RaftAppliedIndex; lag > opts.raftLagMax {
+				add(warning, "raft lag", "check the broker's disk and network, and its logs for raft errors",
+					"broker %d has applied raft index %d, %d behind the leader", id, res.RaftAppliedIndex, lag)
+			}
+		}
+		if res.DiskTotalBytes > 0 && res.DiskFreeBytes >= 0 {
+			if free := float64(res.DiskFreeBytes) / float64(res.DiskTotalBytes); free < opts.diskFreeMin {
+				add(critical, "disk nearly full", "lower its topics' retention, delete unused topics, or grow the disk",
+					"broker %d's data dir disk is %.0f%% full, %d bytes free", id, 100*(1-free), res.DiskFreeBytes)
+			}
+		}
+	}
+
+	if len(reachable) > 1 {
+		sort.Slice(reachable, func(i, j int) bool { return health[reachable[i]].offset < health[reachable[j]].offset })
+		behind, ahead := health[reachable[0]], health[reachable[len(reachable)-1]]
+		// only count the skew the round trips can't account for.
+		skew := ahead.offset - behind.offset - (ahead.rtt+behind.rtt)/2
+		if skew > opts.maxClockSkew {
+			add(warning, "clock skew", "sync the brokers' clocks, e.g. with NTP",
+				"broker %d's clock is at least %s ahead of broker %d's", reachable[len(reachable)-1], skew.Round(time.Millisecond), reachable[0])
+		}
+	}
+
+	versions := make(map[string][]int32)
+	for _, id := range reachable {
+		v := health[id].res.BrokerVersion
+		if v == "" {
+			v = "unknown"
+		}
+		versions[v] = append(versions[v], id)
+	}
+	if len(versions) > 1 {
+		var vs []string
+		for v := range versions {
+			vs = append(vs, v)
+		}
+		sort.Strings(vs)
+		for i, v := range vs {
+			vs[i] = fmt.Sprintf("%s on brokers %s", v, joinIDs(versions[v]))
+		}
+		add(warning, "mixed versions", "finish upgrading the brokers, features needing every broker upgraded stay off until they're all on one version",
+			"the brokers run %d versions: %s", len(versions), strings.Join(vs, "; "))
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].severity > findings[j].severity })
+	return findings
+}
+
+// missingIDs returns the IDs in all that aren't in some.
+func missingIDs(all, some []int32) []int32 {
+	var missing []int32
+	for _, id := range all {
+		var found bool
+		for _, s := range some {
+			if s == id {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, id)
+		}
+	}
+	return missing
+}
+
+func joinIDs(ids []int32) string {
+	if len(ids) == 0 {
+		return "(none)"
+	}
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = strconv.Itoa(int(id))
+	}
+	return strings.Join(s, ", ")
+}
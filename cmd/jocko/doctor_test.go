@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestDiagnose(t *testing.T) {
+	opts := doctorOptions{diskFreeMin: 0.1, raftLagMax: 100, maxClockSkew: time.Second, leaderSkew: 0.5}
+	now := time.Now()
+	healthy := func(id int32, state string, applied int64) *brokerHealth {
+		return &brokerHealth{
+			addr:   "127.0.0.1:9092",
+			res:    &protocol.BrokerHealthResponse{BrokerID: id, Time: now, RaftState: state, RaftLastIndex: applied, RaftAppliedIndex: applied, DiskTotalBytes: 100, DiskFreeBytes: 50},
+			rtt:    time.Millisecond,
+			offset: 0,
+		}
+	}
+	partition := func(id, leader int32, replicas, isr []int32) *protocol.PartitionMetadata {
+		return &protocol.PartitionMetadata{PartitionID: id, Leader: leader, Replicas: replicas, ISR: isr}
+	}
+	meta := &protocol.MetadataResponse{
+		Brokers: []*protocol.Broker{{NodeID: 1}, {NodeID: 2}, {NodeID: 3}},
+		TopicMetadata: []*protocol.TopicMetadata{{
+			Topic: "a",
+			PartitionMetadata: []*protocol.PartitionMetadata{
+				partition(0, 1, []int32{1, 2}, []int32{1, 2}),
+				partition(1, 2, []int32{2, 3}, []int32{2, 3}),
+				partition(2, 3, []int32{3, 1}, []int32{3, 1}),
+			},
+		}},
+	}
+	health := map[int32]*brokerHealth{1: healthy(1, "Leader", 500), 2: healthy(2, "Follower", 500), 3: healthy(3, "Follower", 500)}
+	require.Empty(t, diagnose(meta, health, opts))
+
+	checks := func(findings []finding) []string {
+		var s []string
+		for _, f := range findings {
+			s = append(s, f.severity.String()+" "+f.check)
+		}
+		return s
+	}
+
+	meta.TopicMetadata = append(meta.TopicMetadata, &protocol.TopicMetadata{
+		Topic: "b",
+		PartitionMetadata: []*protocol.PartitionMetadata{
+			partition(0, 4, []int32{4}, []int32{4}),
+			partition(1, 1, []int32{1, 2, 3}, []int32{1}),
+			partition(2, 1, []int32{1, 2}, []int32{1, 2}),
+			partition(3, 1, []int32{1, 3}, []int32{1, 3}),
+			partition(4, 1, []int32{1, 2}, []int32{1, 2}),
+		},
+	})
+	health[2].res.RaftAppliedIndex = 300
+	health[3].res.DiskFreeBytes = 5
+	health[3].offset = 3 * time.Second
+	health[1].res.BrokerVersion = "1.1.0"
+	health[2].res.BrokerVersion = "1.1.0"
+	health[3].res.BrokerVersion = "1.2.0"
+	findings := diagnose(meta, health, opts)
+	require.Equal(t, []string{
+		"CRITICAL offline partition",
+		"CRITICAL disk nearly full",
+		"WARNING under-replicated partition",
+		"WARNING skewed leadership",
+		"WARNING raft lag",
+		"WARNING clock skew",
+		"WARNING mixed versions",
+	}, checks(findings))
+	require.Equal(t, "topic b partition 0 has no live leader", findings[0].problem)
+	require.Equal(t, "bring back one of its replicas, brokers 4", findings[0].fix)
+	require.Equal(t, "check brokers 2, 3 are up and their logs for replication errors", findings[2].fix)
+	require.Equal(t, "broker 1 leads 5 partitions, the brokers average 2.3", findings[3].problem)
+	require.Equal(t, "broker 2 has applied raft index 300, 200 behind the leader", findings[4].problem)
+	require.Equal(t, "broker 3's clock is at least 2.999s ahead of broker 1's", findings[5].problem)
+	require.Equal(t, "the brokers run 2 versions: 1.1.0 on brokers 1, 2; 1.2.0 on brokers 3", findings[6].problem)
+
+	health[1].err, health[1].res = errors.New("connection refused"), nil
+	require.Equal(t, []string{
+		"CRITICAL unreachable broker",
+		"CRITICAL offline partition",
+		"CRITICAL no raft leader",
+		"CRITICAL disk nearly full",
+		"WARNING under-replicated partition",
+		"WARNING skewed leadership",
+		"WARNING clock skew",
+		"WARNING mixed versions",
+	}, checks(diagnose(meta, health, opts)))
+}
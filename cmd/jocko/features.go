@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/travisjeffery/jocko/jocko"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+var featuresCfg = struct {
+	BrokerAddr     string
+	Features       []string
+	AllowDowngrade bool
+	ValidateOnly   bool
+}{}
+
+func init() {
+	featuresCmd := &cobra.Command{Use: "features", Short: "Manage the feature levels finalized across the cluster"}
+	featuresCmd.PersistentFlags().StringVar(&featuresCfg.BrokerAddr, "broker-addr", "0.0.0.0:9092", "Address of a broker in the cluster")
+	describeFeaturesCmd := &cobra.Command{Use: "describe", Short: "Describe the feature levels a broker supports and the cluster's finalized levels", Run: describeFeatures, Args: cobra.NoArgs}
+	updateFeaturesCmd := &cobra.Command{Use: "update", Short: "Finalize feature levels once every broker supports them", Run: updateFeatures, Args: cobra.NoArgs}
+	updateFeaturesCmd.Flags().StringSliceVar(&featuresCfg.Features, "feature", nil, "Feature level to finalize as <feature>=<level>, level 0 unfinalizes the feature")
+	updateFeaturesCmd.Flags().BoolVar(&featuresCfg.AllowDowngrade, "allow-downgrade", false, "Allow lowering finalized levels")
+	updateFeaturesCmd.Flags().BoolVar(&featuresCfg.ValidateOnly, "validate-only", false, "Check the levels can be finalized without finalizing them")
+	featuresCmd.AddCommand(describeFeaturesCmd, updateFeaturesCmd)
+	cli.AddCommand(featuresCmd)
+}
+
+func describeFeatures(cmd *cobra.Command, args []string) {
+	conn, err := jocko.Dial("tcp", featuresCfg.BrokerAddr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error connecting to broker: %v\n", err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+
+	resp, err := conn.DescribeFeatures(&protocol.DescribeFeaturesRequest{})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error with request to broker: %v\n", err)
+		os.Exit(1)
+	}
+	if resp.ErrorCode != protocol.ErrNone.Code() {
+		exitResponseErr(resp.ErrorCode, resp.ErrorMessage)
+	}
+
+	finalized := make(map[string]int16)
+	for _, f := range resp.FinalizedFeatures {
+		finalized[f.Name] = f.Level
+	}
+	fmt.Printf("finalized epoch: %d\n", resp.FinalizedEpoch)
+	fmt.Printf("%-24s %-12s %s\n", "FEATURE", "SUPPORTED", "FINALIZED")
+	for _, f := range resp.SupportedFeatures {
+		fmt.Printf("%-24s %-12s %d\n", f.Name, fmt.Sprintf("%d-%d", f.MinLevel, f.MaxLevel), finalized[f.Name])
+		delete(finalized, f.Name)
+	}
+	// finalized features the broker doesn't know, which it shouldn't be in the cluster with.
+	for _, f := range resp.FinalizedFeatures {
+		if _, ok := finalized[f.Name]; ok {
+			fmt.Printf("%-24s %-12s %d\n", f.Name, "-", f.Level)
+		}
+	}
+}
+
+func updateFeatures(cmd *cobra.Command, args []string) {
+	req := &protocol.UpdateFeaturesRequest{ValidateOnly: featuresCfg.ValidateOnly}
+	for _, f := range featuresCfg.Features {
+		u, err := parseFeatureUpdate(f)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		u.AllowDowngrade = featuresCfg.AllowDowngrade
+		req.Updates = append(req.Updates, u)
+	}
+	if len(req.Updates) == 0 {
+		fmt.Fprintln(os.Stderr, "error: no --feature to update")
+		os.Exit(1)
+	}
+
+	conn, err := dialController(featuresCfg.BrokerAddr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error connecting to controller: %v\n", err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+
+	resp, err := conn.UpdateFeatures(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error with request to broker: %v\n", err)
+		os.Exit(1)
+	}
+	if resp.ErrorCode != protocol.ErrNone.Code() {
+		exitResponseErr(resp.ErrorCode, resp.ErrorMessage)
+	}
+	if req.ValidateOnly {
+		fmt.Println("feature levels can be finalized")
+		return
+	}
+	fmt.Println("finalized feature levels")
+}
+
+// parseFeatureUpdate parses a <feature>=<level> flag.
+func parseFeatureUpdate(s string) (*protocol.FeatureUpdate, error) {
+	i := strings.LastIndex(s, "=")
+	if i <= 0 {
+		return nil, fmt.Errorf("feature %q isn't <feature>=<level>", s)
+	}
+	level, err := strconv.ParseInt(s[i+1:], 10, 16)
+	if err != nil || level < 0 {
+		return nil, fmt.Errorf("feature %q has an invalid level", s)
+	}
+	return &protocol.FeatureUpdate{Name: s[:i], Level: int16(level)}, nil
+}
+
+func exitResponseErr(code int16, msg *string) {
+	if msg != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", *msg)
+	} else {
+		fmt.Fprintf(os.Stderr, "error code: %v\n", protocol.Errs[code])
+	}
+	os.Exit(1)
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestParseFeatureUpdate(t *testing.T) {
+	u, err := parseFeatureUpdate("record_batch=2")
+	require.NoError(t, err)
+	require.Equal(t, &protocol.FeatureUpdate{Name: "record_batch", Level: 2}, u)
+
+	u, err = parseFeatureUpdate("node_maintenance=0")
+	require.NoError(t, err)
+	require.Equal(t, &protocol.FeatureUpdate{Name: "node_maintenance", Level: 0}, u)
+
+	for _, s := range []string{"record_batch", "=2", "record_batch=x", "record_batch=-1", "record_batch=40000"} {
+		_, err := parseFeatureUpdate(s)
+		require.Error(t, err, s)
+	}
+}
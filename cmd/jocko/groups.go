@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+	"github.com/travisjeffery/jocko/client"
+)
+
+var resetOffsetsCfg = struct {
+	BrokerAddrs []string
+	Group       string
+	Topic       string
+	Partitions  []int
+	ToEarliest  bool
+	ToLatest    bool
+	ToOffset    int64
+	Force       bool
+}{}
+
+func init() {
+	groupCmd := &cobra.Command{Use: "group", Short: "Manage consumer groups"}
+	resetOffsetsCmd := &cobra.Command{Use: "reset-offsets", Short: "Reset a group's committed offsets of a topic, once the group's consumers are stopped", Run: resetOffsets, Args: cobra.NoArgs}
+	resetOffsetsCmd.Flags().StringSliceVar(&resetOffsetsCfg.BrokerAddrs, "broker-addr", []string{"0.0.0.0:9092"}, "Address of a broker in the cluster. Can be specified multiple times.")
+	resetOffsetsCmd.Flags().StringVar(&resetOffsetsCfg.Group, "group", "", "Group to reset the offsets of")
+	resetOffsetsCmd.Flags().StringVar(&resetOffsetsCfg.Topic, "topic", "", "Topic to reset the group's offsets of")
+	resetOffsetsCmd.Flags().IntSliceVar(&resetOffsetsCfg.Partitions, "partition", nil, "Partition to reset the group's offset of. Can be specified multiple times, defaults to every partition.")
+	resetOffsetsCmd.Flags().BoolVar(&resetOffsetsCfg.ToEarliest, "to-earliest", false, "Reset the offsets to the partitions' oldest offsets")
+	resetOffsetsCmd.Flags().BoolVar(&resetOffsetsCfg.ToLatest, "to-latest", false, "Reset the offsets to the partitions' newest offsets")
+	resetOffsetsCmd.Flags().Int64Var(&resetOffsetsCfg.ToOffset, "to-offset", 0, "Reset the offsets to the offset, within the partitions' oldest and newest offsets")
+	resetOffsetsCmd.Flags().BoolVar(&resetOffsetsCfg.Force, "force", false, "Skip checking the group's empty before committing the offsets, the brokers still refuse to reset the offsets of groups with active members")
+	groupCmd.AddCommand(resetOffsetsCmd)
+	cli.AddCommand(groupCmd)
+}
+
+type resetOffsetsOptions struct {
+	group      string
+	topic      string
+	partitions []int32
+	toEarliest bool
+	toLatest   bool
+	// toOffset, if set, is the offset to reset to.
+	toOffset *int64
+	force    bool
+}
+
+func resetOffsets(cmd *cobra.Command, args []string) {
+	c, err := client.New(client.Config{Brokers: resetOffsetsCfg.BrokerAddrs})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error creating client: %v\n", err)
+		os.Exit(1)
+	}
+	defer c.Close()
+
+	opts := resetOffsetsOptions{
+		group:      resetOffsetsCfg.Group,
+		topic:      resetOffsetsCfg.Topic,
+		toEarliest: resetOffsetsCfg.ToEarliest,
+		toLatest:   resetOffsetsCfg.ToLatest,
+		force:      resetOffsetsCfg.Force,
+	}
+	if cmd.Flags().Changed("to-offset") {
+		opts.toOffset = &resetOffsetsCfg.ToOffset
+	}
+	for _, p := range resetOffsetsCfg.Partitions {
+		opts.partitions = append(opts.partitions, int32(p))
+	}
+	offsets, err := resetGroupOffsets(c, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error resetting offsets: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("%-20s %-10s %s\n", "TOPIC", "PARTITION", "NEW OFFSET")
+	for _, o := range offsets {
+		fmt.Printf("%-20s %-10d %d\n", o.Topic, o.Partition, o.Offset)
+	}
+}
+
+// resetGroupOffsets commits the group's offsets of the topic's partitions reset per the options.
+// Like Kafka, the group has to be empty, without members whose commits would overwrite the reset
+// offsets. The brokers refuse the commits otherwise, the group's described first to explain why,
+// unless it's forced.
+func resetGroupOffsets(c *client.Client, opts resetOffsetsOptions) ([]client.Offset, error) {
+	if opts.group == "" || opts.topic == "" {
+		return nil, fmt.Errorf("a group and topic are required")
+	}
+	targets := 0
+	for _, set := range []bool{opts.toEarliest, opts.toLatest, opts.toOffset != nil} {
+		if set {
+			targets++
+		}
+	}
+	if targets != 1 {
+		return nil, fmt.Errorf("exactly one of --to-earliest, --to-latest, and --to-offset is required")
+	}
+
+	if !opts.force {
+		g, err := c.DescribeGroup(opts.group)
+		if err != nil {
+			return nil, err
+		}
+		if g.State != "Empty" && g.State != "Dead" {
+			return nil, fmt.Errorf("group %s has active members, it's %s: stop its consumers first", opts.group, g.State)
+		}
+	}
+
+	partitions := opts.partitions
+	if len(partitions) == 0 {
+		var err error
+		if partitions, err = c.Partitions(opts.topic); err != nil {
+			return nil, err
+		}
+		sort.Slice(partitions, func(i, j int) bool { return partitions[i] < partitions[j] })
+	}
+	offsets := make([]client.Offset, 0, len(partitions))
+	for _, p := range partitions {
+		oldest, err := c.OldestOffset(opts.topic, p)
+		if err != nil {
+			return nil, err
+		}
+		newest, err := c.NewestOffset(opts.topic, p)
+		if err != nil {
+			return nil, err
+		}
+		var offset int64
+		switch {
+		case opts.toEarliest:
+			offset = oldest
+		case opts.toLatest:
+			offset = newest
+		case *opts.toOffset < oldest:
+			offset = oldest
+		case *opts.toOffset > newest:
+			offset = newest
+		default:
+			offset = *opts.toOffset
+		}
+		offsets = append(offsets, client.Offset{Topic: opts.topic, Partition: p, Offset: offset})
+	}
+	if err := c.CommitOffsets(opts.group, offsets); err != nil {
+		return nil, err
+	}
+	return offsets, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/testutil/retry"
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/client"
+	"github.com/travisjeffery/jocko/jocko"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestResetGroupOffsets(t *testing.T) {
+	offset := func(o int64) *int64 { return &o }
+	s, dir := jocko.NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+	}, nil)
+	defer os.RemoveAll(dir)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, s.Start(ctx))
+	defer s.Shutdown()
+	jocko.WaitForLeader(t, s)
+	conn, err := jocko.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	res, err := conn.CreateTopics(&protocol.CreateTopicRequests{
+		Timeout:  time.Second,
+		Requests: []*protocol.CreateTopicRequest{{Topic: "events", NumPartitions: 2, ReplicationFactor: 1}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrNone.Code(), res.TopicErrorCodes[0].ErrorCode)
+	jocko.WaitForTopicLeader(t, "events", 1, s)
+
+	c, err := client.New(client.Config{Brokers: []string{s.Addr().String()}})
+	require.NoError(t, err)
+	defer c.Close()
+	p := client.NewProducer(c, client.ProducerConfig{})
+	for i := 0; i < 3; i++ {
+		_, err := p.Produce("events", 0, &protocol.Message{Value: []byte("v")})
+		require.NoError(t, err)
+	}
+
+	// the offsets topic is created by the first find coordinator request.
+	retry.Run(t, func(r *retry.R) {
+		res, err := conn.FindCoordinator(&protocol.FindCoordinatorRequest{CoordinatorKey: "group"})
+		if err != nil {
+			r.Fatal(err)
+		}
+		if res.ErrorCode != protocol.ErrNone.Code() {
+			r.Fatalf("find coordinator error: %s", protocol.Errs[res.ErrorCode])
+		}
+	})
+	// a member joins the group, so its offsets can't be reset without forcing it.
+	var join *protocol.JoinGroupResponse
+	retry.Run(t, func(r *retry.R) {
+		var err error
+		join, err = conn.JoinGroup(&protocol.JoinGroupRequest{
+			APIVersion:       1,
+			GroupID:          "group",
+			SessionTimeout:   10000,
+			RebalanceTimeout: 10000,
+			ProtocolType:     "consumer",
+			GroupProtocols:   []*protocol.GroupProtocol{{ProtocolName: "range"}},
+		})
+		if err != nil {
+			r.Fatal(err)
+		}
+		if join.ErrorCode != protocol.ErrNone.Code() {
+			r.Fatalf("join group error: %s", protocol.Errs[join.ErrorCode])
+		}
+	})
+	opts := resetOffsetsOptions{group: "group", topic: "events", toLatest: true}
+	_, err = resetGroupOffsets(c, opts)
+	require.EqualError(t, err, "group group has active members, it's CompletingRebalance: stop its consumers first")
+	// forcing it only skips the check here, the broker refuses the commits too.
+	opts.force = true
+	_, err = resetGroupOffsets(c, opts)
+	require.Equal(t, protocol.ErrUnknownMemberId, err)
+
+	// once the member's left the group's empty.
+	leave, err := conn.LeaveGroup(&protocol.LeaveGroupRequest{GroupID: "group", MemberID: join.MemberID})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrNone.Code(), leave.ErrorCode)
+	offsets, err := resetGroupOffsets(c, opts)
+	require.NoError(t, err)
+	require.Equal(t, []client.Offset{{Topic: "events", Partition: 0, Offset: 3}, {Topic: "events", Partition: 1, Offset: 0}}, offsets)
+	_, err = resetGroupOffsets(c, resetOffsetsOptions{group: "group", topic: "events", partitions: []int32{0}, toOffset: offset(1)})
+	require.NoError(t, err)
+	committed, err := c.CommittedOffsets("group", "events", []int32{0, 1})
+	require.NoError(t, err)
+	require.Equal(t, map[int32]int64{0: 1, 1: 0}, committed)
+
+	// offsets past the partitions' newest are reset to their newest.
+	offsets, err = resetGroupOffsets(c, resetOffsetsOptions{group: "group", topic: "events", toOffset: offset(10)})
+	require.NoError(t, err)
+	require.Equal(t, int64(3), offsets[0].Offset)
+	require.Equal(t, int64(0), offsets[1].Offset)
+
+	_, err = resetGroupOffsets(c, resetOffsetsOptions{group: "group", topic: "events", toEarliest: true, toLatest: true})
+	require.EqualError(t, err, "exactly one of --to-earliest, --to-latest, and --to-offset is required")
+}
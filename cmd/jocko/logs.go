@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/travisjeffery/jocko/commitlog"
+	"github.com/travisjeffery/jocko/jocko"
+)
+
+var logsCfg = struct {
+	DataDir   string
+	DryRun    bool
+	Topic     string
+	Partition int32
+}{}
+
+func init() {
+	logsCmd := &cobra.Command{Use: "logs", Short: "Manage a broker's logs"}
+	repairCmd := &cobra.Command{Use: "repair", Short: "Repair the logs in a stopped broker's data dir, exiting 1 if any can't be", Run: repairLogs, Args: cobra.NoArgs}
+	repairCmd.Flags().StringVar(&logsCfg.DataDir, "data-dir", "/tmp/jocko", "Data dir of the stopped broker")
+	repairCmd.Flags().BoolVar(&logsCfg.DryRun, "dry-run", false, "Report the problems without fixing them")
+	logsCmd.AddCommand(repairCmd)
+	verifyCmd := &cobra.Command{Use: "verify", Short: "Verify the partition logs in a broker's data dir, printing the results as JSON and exiting 1 if any are invalid", Run: verifyLogs, Args: cobra.NoArgs}
+	verifyCmd.Flags().StringVar(&logsCfg.DataDir, "data-dir", "/tmp/jocko", "Data dir of the broker, or of its backup")
+	verifyCmd.Flags().StringVar(&logsCfg.Topic, "topic", "", "Verify only the topic's partitions")
+	verifyCmd.Flags().Int32Var(&logsCfg.Partition, "partition", -1, "Verify only the topic's partition")
+	logsCmd.AddCommand(verifyCmd)
+	cli.AddCommand(logsCmd)
+}
+
+// verifyResults are the results of verifying the logs, for CI of backup and restore pipelines.
+type verifyResults struct {
+	Valid bool                      `json:"valid"`
+	Logs  []*commitlog.VerifyResult `json:"logs"`
+}
+
+func verifyLogs(cmd *cobra.Command, args []string) {
+	if logsCfg.Partition >= 0 && logsCfg.Topic == "" {
+		fmt.Fprintln(os.Stderr, "error verifying logs: --partition needs --topic")
+		os.Exit(1)
+	}
+	logs, err := jocko.VerifyDataDir(logsCfg.DataDir, logsCfg.Topic, logsCfg.Partition)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error verifying logs: %v\n", err)
+		os.Exit(1)
+	}
+	res := verifyResults{Valid: true, Logs: logs}
+	for _, l := range logs {
+		res.Valid = res.Valid && l.Valid()
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(res); err != nil {
+		fmt.Fprintf(os.Stderr, "error verifying logs: %v\n", err)
+		os.Exit(1)
+	}
+	if !res.Valid {
+		os.Exit(1)
+	}
+}
+
+func repairLogs(cmd *cobra.Command, args []string) {
+	issues, err := jocko.RepairDataDir(logsCfg.DataDir, logsCfg.DryRun)
+	var unrecoverable int
+	for _, i := range issues {
+		fix := i.Fix
+		switch {
+		case fix == "":
+			fix = "UNRECOVERABLE"
+			unrecoverable++
+		case logsCfg.DryRun:
+			fix = "would be " + fix
+		}
+		fmt.Printf("%s: %s: %s\n", i.Path, i.Problem, fix)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error repairing logs: %v\n", err)
+		os.Exit(1)
+	}
+	if len(issues) == 0 {
+		fmt.Println("no problems found")
+	}
+	if unrecoverable > 0 {
+		fmt.Printf("%d problems can't be fixed: restore the segments from another replica or a backup\n", unrecoverable)
+		os.Exit(1)
+	}
+}
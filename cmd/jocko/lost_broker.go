@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+var lostBrokerCfg = struct {
+	BrokerAddr     string
+	ID             int32
+	AcceptDataLoss bool
+	ValidateOnly   bool
+}{}
+
+func init() {
+	lostBrokerCmd := &cobra.Command{
+		Use:   "reassign-lost-broker",
+		Short: "Reassign the replicas of a broker that will never return to the other brokers, losing the records only it had",
+		Run:   reassignLostBroker,
+		Args:  cobra.NoArgs,
+	}
+	lostBrokerCmd.Flags().StringVar(&lostBrokerCfg.BrokerAddr, "broker-addr", "0.0.0.0:9092", "Address of a broker in the cluster")
+	lostBrokerCmd.Flags().Int32Var(&lostBrokerCfg.ID, "id", 0, "ID of the lost broker")
+	lostBrokerCmd.Flags().BoolVar(&lostBrokerCfg.AcceptDataLoss, "accept-data-loss", false, "Accept losing the records only the lost broker had, required to reassign its replicas")
+	lostBrokerCmd.Flags().BoolVar(&lostBrokerCfg.ValidateOnly, "validate-only", false, "Print the reassignment without making it")
+	cli.AddCommand(lostBrokerCmd)
+}
+
+func reassignLostBroker(cmd *cobra.Command, args []string) {
+	conn, err := dialController(lostBrokerCfg.BrokerAddr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error connecting to controller: %v\n", err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+
+	resp, err := conn.ReassignLostBroker(&protocol.ReassignLostBrokerRequest{
+		BrokerID:       lostBrokerCfg.ID,
+		AcceptDataLoss: lostBrokerCfg.AcceptDataLoss,
+		ValidateOnly:   lostBrokerCfg.ValidateOnly,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error with request to broker: %v\n", err)
+		os.Exit(1)
+	}
+	if resp.ErrorCode != protocol.ErrNone.Code() {
+		exitResponseErr(resp.ErrorCode, resp.ErrorMessage)
+	}
+
+	fmt.Printf("%-24s %-10s %-8s %-16s %s\n", "TOPIC", "PARTITION", "LEADER", "REPLICAS", "UNCLEAN")
+	unclean := 0
+	for _, p := range resp.Partitions {
+		fmt.Printf("%-24s %-10d %-8d %-16v %t\n", p.Topic, p.Partition, p.Leader, p.Replicas, p.Unclean)
+		if p.Unclean {
+			unclean++
+		}
+	}
+	if lostBrokerCfg.ValidateOnly {
+		fmt.Printf("would reassign %d partitions, %d with unclean leaders\n", len(resp.Partitions), unclean)
+		return
+	}
+	fmt.Printf("reassigned %d partitions, %d with unclean leaders\n", len(resp.Partitions), unclean)
+}
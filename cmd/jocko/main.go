@@ -4,12 +4,18 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"math"
 	"net"
+	"net/http"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	gracefully "github.com/tj/go-gracefully"
 	"github.com/travisjeffery/jocko/jocko"
 	"github.com/travisjeffery/jocko/jocko/config"
@@ -28,7 +34,9 @@ var (
 		Short: "Kafka in Go and more",
 	}
 
-	brokerCfg = config.DefaultConfig()
+	brokerCfg     = config.DefaultConfig()
+	brokerCfgFile string
+	metricsAddr   string
 
 	topicCfg = struct {
 		BrokerAddr        string
@@ -36,19 +44,18 @@ var (
 		Partitions        int32
 		ReplicationFactor int
 	}{}
+
+	maintenanceCfg = struct {
+		BrokerAddr string
+		ID         int32
+	}{}
 )
 
 func init() {
 	brokerCmd := &cobra.Command{Use: "broker", Short: "Run a Jocko broker", Run: run, Args: cobra.NoArgs}
-	brokerCmd.Flags().StringVar(&brokerCfg.RaftAddr, "raft-addr", "127.0.0.1:9093", "Address for Raft to bind and advertise on")
-	brokerCmd.Flags().StringVar(&brokerCfg.DataDir, "data-dir", "/tmp/jocko", "A comma separated list of directories under which to store log files")
-	brokerCmd.Flags().StringVar(&brokerCfg.Addr, "broker-addr", "0.0.0.0:9092", "Address for broker to bind on")
-	brokerCmd.Flags().Var(newMemberlistConfigValue(brokerCfg.SerfLANConfig.MemberlistConfig, "0.0.0.0:9094"), "serf-addr", "Address for Serf to bind on")
-	brokerCmd.Flags().BoolVar(&brokerCfg.Bootstrap, "bootstrap", false, "Initial cluster bootstrap (dangerous!)")
-	brokerCmd.Flags().IntVar(&brokerCfg.BootstrapExpect, "bootstrap-expect", 0, "Expected number of nodes in cluster")
-	brokerCmd.Flags().StringSliceVar(&brokerCfg.StartJoinAddrsLAN, "join", nil, "Address of an broker serf to join at start time. Can be specified multiple times.")
-	brokerCmd.Flags().StringSliceVar(&brokerCfg.StartJoinAddrsWAN, "join-wan", nil, "Address of an broker serf to join -wan at start time. Can be specified multiple times.")
-	brokerCmd.Flags().Int32Var(&brokerCfg.ID, "id", 0, "Broker ID")
+	brokerCmd.Flags().StringVar(&brokerCfgFile, "config", "", "Path to a YAML config file keyed by flag name, flags and JOCKO_ environment variables take precedence")
+	brokerCmd.Flags().StringVar(&metricsAddr, "metrics-addr", "", "Address to serve Prometheus metrics on at /metrics, unset to disable")
+	brokerCmd.Flags().AddFlagSet(brokerFlags(brokerCfg))
 
 	topicCmd := &cobra.Command{Use: "topic", Short: "Manage topics"}
 	createTopicCmd := &cobra.Command{Use: "create", Short: "Create a topic", Run: createTopic, Args: cobra.NoArgs}
@@ -58,14 +65,131 @@ func init() {
 	createTopicCmd.Flags().Int32Var(&topicCfg.Partitions, "partitions", 1, "Number of partitions")
 	createTopicCmd.Flags().IntVar(&topicCfg.ReplicationFactor, "replication-factor", 1, "Replication factor")
 
+	maintenanceCmd := &cobra.Command{Use: "maintenance", Short: "Manage broker maintenance"}
+	maintenanceCmd.PersistentFlags().StringVar(&maintenanceCfg.BrokerAddr, "broker-addr", "0.0.0.0:9092", "Address of a broker in the cluster")
+	maintenanceCmd.PersistentFlags().Int32Var(&maintenanceCfg.ID, "id", 0, "ID of the broker to put into or take out of maintenance")
+	startMaintenanceCmd := &cobra.Command{Use: "start", Short: "Move a broker's leaderships off it and stop assigning it new replicas", Run: brokerMaintenance(true), Args: cobra.NoArgs}
+	stopMaintenanceCmd := &cobra.Command{Use: "stop", Short: "Take a broker out of maintenance", Run: brokerMaintenance(false), Args: cobra.NoArgs}
+
+	versionCmd := &cobra.Command{Use: "version", Short: "Print jocko's version", Args: cobra.NoArgs, Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println(jocko.Version)
+	}}
+
 	cli.AddCommand(brokerCmd)
+	cli.AddCommand(versionCmd)
 	cli.AddCommand(topicCmd)
 	topicCmd.AddCommand(createTopicCmd)
+	cli.AddCommand(maintenanceCmd)
+	maintenanceCmd.AddCommand(startMaintenanceCmd, stopMaintenanceCmd)
+}
+
+// brokerFlags returns the broker command's options bound to the given config.
+func brokerFlags(cfg *config.Config) *pflag.FlagSet {
+	flags := pflag.NewFlagSet("broker", pflag.ContinueOnError)
+	flags.StringVar(&cfg.RaftAddr, "raft-addr", config.DefaultRaftAddr, "Address for Raft to bind and advertise on. Expands ${HOSTNAME}, ${ORDINAL}, and env vars like the advertise addr")
+	flags.StringVar(&cfg.DataDir, "data-dir", "/tmp/jocko", "A comma separated list of directories under which to store log files")
+	flags.StringVar(&cfg.Addr, "broker-addr", config.DefaultAddr, "Address for broker to bind on")
+	flags.StringVar(&cfg.AdvertiseAddr, "advertise-addr", "", "Address of the broker advertised to clients and other brokers, defaults to the broker addr. Expands ${HOSTNAME}, ${ORDINAL}, and env vars, e.g. ${HOSTNAME}.jocko.default.svc:9092")
+	flags.StringVar(&cfg.IDTemplate, "id-template", "", "Template the broker ID is expanded from in place of --id, e.g. ${ORDINAL} for a StatefulSet's pod jocko-2")
+	flags.Int32Var(&cfg.IDOffset, "id-offset", 0, "Added to the ID expanded from the id template")
+	flags.Var(newMemberlistConfigValue(cfg.SerfLANConfig.MemberlistConfig, "0.0.0.0:9094"), "serf-addr", "Address for Serf to bind on")
+	flags.BoolVar(&cfg.Bootstrap, "bootstrap", false, "Initial cluster bootstrap (dangerous!)")
+	flags.IntVar(&cfg.BootstrapExpect, "bootstrap-expect", 0, "Expected number of nodes in cluster")
+	flags.StringSliceVar(&cfg.StartJoinAddrsLAN, "join", nil, "Address of an broker serf to join at start time. Can be specified multiple times.")
+	flags.StringArrayVar(&cfg.RetryJoinLAN, "retry-join", nil, "Address of a broker serf, or a discovery provider's config like \"provider=dns name=_serf._tcp.jocko.example.com\", to keep trying to join until joined. Can be specified multiple times.")
+	flags.DurationVar(&cfg.RetryJoinInterval, "retry-join-interval", cfg.RetryJoinInterval, "How long to wait to retry joining, doubling each attempt")
+	flags.DurationVar(&cfg.RetryJoinMaxInterval, "retry-join-max-interval", cfg.RetryJoinMaxInterval, "Longest to wait to retry joining")
+	flags.IntVar(&cfg.RetryJoinMaxAttempts, "retry-join-max-attempts", 0, "Number of times to try joining before giving up, 0 to keep trying")
+	flags.StringSliceVar(&cfg.StartJoinAddrsWAN, "join-wan", nil, "Address of an broker serf to join -wan at start time. Can be specified multiple times.")
+	flags.Int32Var(&cfg.ID, "id", 0, "Broker ID")
+	flags.StringVar(&cfg.NodeName, "node-name", cfg.NodeName, "Name of the broker's node in the cluster, unique to each broker. Defaults to the hostname")
+	flags.StringVar(&cfg.Role, "role", cfg.Role, "Node role: broker, or observer to replicate the cluster metadata as a non-voter without hosting partitions")
+	flags.Var(newTagsValue(&cfg.Tags), "tags", "Comma separated key=value tags the broker advertises to match topics' placement constraints against")
+	flags.BoolVar(&cfg.AutoCreateTopics, "auto-create-topics", false, "Create unknown topics requested in metadata requests")
+	flags.Int("default-replication-factor", int(cfg.DefaultReplicationFactor), "Replication factor of auto-created topics and topics created with a replication factor of -1")
+	flags.Int("offsets-topic-replication-factor", int(cfg.OffsetsTopicReplicationFactor), "Replication factor of the offsets topic, no more than the bootstrap expect if it's set")
+	flags.Int32Var(&cfg.NumPartitions, "num-partitions", cfg.NumPartitions, "Number of partitions of auto-created topics and topics created with -1 partitions")
+	flags.IntVar(&cfg.MinInsyncReplicas, "min-insync-replicas", cfg.MinInsyncReplicas, "Fewest in-sync replicas a partition needs to take acks=all produces, for topics without min.insync.replicas set")
+	flags.BoolVar(&cfg.AutoPopulateNewBrokers, "auto-populate-new-brokers", false, "Move existing partition replicas onto brokers carrying less than their share")
+	flags.IntVar(&cfg.AutoPopulateMaxMoves, "auto-populate-max-moves", cfg.AutoPopulateMaxMoves, "Maximum number of replicas moved onto underloaded brokers each reconcile interval")
+	flags.IntVar(&cfg.MaxPartitionsPerBroker, "max-partitions-per-broker", 0, "Maximum number of partition replicas assigned to a broker, 0 for no limit")
+	flags.IntVar(&cfg.MaxPartitions, "max-partitions", 0, "Maximum number of partitions in the cluster, 0 for no limit")
+	flags.IntVar(&cfg.MaxOpenSegmentFiles, "max-open-segment-files", 0, "Maximum number of segment log files kept open, 0 for no limit")
+	flags.DurationVar(&cfg.OffsetCommitLinger, "offset-commit-linger", cfg.OffsetCommitLinger, "How long offset commits wait to be appended with others, 0 to append each on its own")
+	flags.IntVar(&cfg.FetchCacheSize, "fetch-cache-size", 0, "Number of fetched record sets cached and shared between consumers, 0 to disable")
+	flags.DurationVar(&cfg.GroupMinSessionTimeout, "group-min-session-timeout", cfg.GroupMinSessionTimeout, "Shortest session timeout group members may join with")
+	flags.DurationVar(&cfg.GroupMaxSessionTimeout, "group-max-session-timeout", cfg.GroupMaxSessionTimeout, "Longest session timeout group members may join with")
+	flags.DurationVar(&cfg.ReplicaLagWarnThreshold, "replica-lag-warn-threshold", cfg.ReplicaLagWarnThreshold, "Log a warning when a follower replica goes this long without catching up with its leader, 0 to disable")
+	flags.DurationVar(&cfg.ClockSkewThreshold, "clock-skew-threshold", cfg.ClockSkewThreshold, "Log producers whose records' create times are this far from the broker's clock, 0 to disable")
+	flags.BoolVar(&cfg.RejectClockSkew, "reject-clock-skew", false, "Reject produce requests with records skewed past the clock skew threshold")
+	flags.DurationVar(&cfg.HibernateAfter, "hibernate-after", 0, "Close the logs of partitions idle for this long until they're next used, 0 to disable")
+	flags.DurationVar(&cfg.DiskUsageReportInterval, "disk-usage-report-interval", cfg.DiskUsageReportInterval, "How often the broker reports its disk usage for new replicas to be placed on emptier disks, 0 to disable")
+	flags.DurationVar(&cfg.OrphanedPartitionScanInterval, "orphaned-partition-scan-interval", cfg.OrphanedPartitionScanInterval, "How often the data dir's scanned for partition dirs no longer belonging to the broker's replicas, 0 to disable")
+	flags.StringVar(&cfg.OrphanedPartitionAction, "orphaned-partition-action", cfg.OrphanedPartitionAction, "What's done with orphaned partition dirs found on consecutive scans: quarantine, moving them into the data dir's quarantine dir, or delete")
+	flags.DurationVar(&cfg.SegmentCompressionInterval, "segment-compression-interval", cfg.SegmentCompressionInterval, "How often sealed segments of topics with segment.compression set are recompressed at rest, 0 to disable")
+	flags.BoolVar(&cfg.MetricsPerPartition, "metrics-per-partition", false, "Track topic metrics per partition rather than aggregating each topic's partitions")
+	flags.StringSliceVar(&cfg.MetricsTopics, "metrics-topics", nil, "Topics tracked under their own metrics, others are aggregated together. Defaults to every topic.")
+	flags.StringSliceVar(&cfg.MetricsClientIDs, "metrics-client-ids", nil, "Client IDs tracked under their own client metrics, others are aggregated together. Defaults to every client ID.")
+	flags.StringVar(&cfg.MetricsSink, "metrics-sink", cfg.MetricsSink, "Metrics system to write metrics to: prometheus, served on the metrics addr, or statsd")
+	flags.StringVar(&cfg.StatsdAddr, "statsd-addr", cfg.StatsdAddr, "Address of the statsd server the statsd metrics sink sends metrics to over UDP")
+	flags.StringVar(&cfg.TLSCertFile, "tls-cert-file", "", "Path to the certificate the broker serves TLS with, reloaded on SIGHUP")
+	flags.StringVar(&cfg.TLSKeyFile, "tls-key-file", "", "Path to the key for the TLS certificate, reloaded on SIGHUP")
+	flags.StringVar(&cfg.TLSClientAuth, "tls-client-auth", cfg.TLSClientAuth, "Whether clients authenticate with certificates signed by the TLS CA: none, requested, letting clients without one connect, or required")
+	flags.StringVar(&cfg.TLSCAFile, "tls-ca-file", "", "Path to the CA clients' certificates must be signed by")
+	flags.StringVar(&cfg.InterBrokerAddr, "inter-broker-addr", "", "Address for the listener the other brokers send their requests to, separate from clients'")
+	flags.StringVar(&cfg.InterBrokerTLSCertFile, "inter-broker-tls-cert-file", "", "Path to the certificate the broker presents to the other brokers over raft and the inter-broker listener, reloaded on SIGHUP")
+	flags.StringVar(&cfg.InterBrokerTLSKeyFile, "inter-broker-tls-key-file", "", "Path to the key for the inter-broker TLS certificate, reloaded on SIGHUP")
+	flags.StringVar(&cfg.InterBrokerTLSCAFile, "inter-broker-tls-ca-file", "", "Path to the CA the other brokers' certificates must be signed by")
+	flags.StringVar(&cfg.SerfEncryptKey, "serf-encrypt-key", "", "Base64 encoded 16, 24, or 32 byte key to encrypt serf's gossip with")
+	flags.DurationVar(&cfg.TCPKeepAlive, "tcp-keep-alive", 0, "Keep-alive period of TCP connections, 0 for the default, negative to disable")
+	flags.IntVar(&cfg.TCPSendBufferBytes, "tcp-send-buffer-bytes", 0, "Size of TCP connections' send buffers, 0 for the system default")
+	flags.IntVar(&cfg.TCPReceiveBufferBytes, "tcp-receive-buffer-bytes", 0, "Size of TCP connections' receive buffers, 0 for the system default")
+	flags.BoolVar(&cfg.TCPNoDelay, "tcp-no-delay", cfg.TCPNoDelay, "Send small writes immediately rather than batching them with Nagle's algorithm")
+	flags.BoolVar(&cfg.WireLog, "wire-log", false, "Log the decoded requests and responses of connections matching the wire filters")
+	flags.IntVar(&cfg.SocketRequestMaxBytes, "socket-request-max-bytes", cfg.SocketRequestMaxBytes, "Size of the largest request the broker reads, connections sending larger ones are closed")
+	flags.StringSliceVar(&cfg.DeniedClientIDs, "denied-client-ids", nil, "Regexps matching whole client IDs whose requests are refused, e.g. ^$ for clients without one")
+	flags.StringSliceVar(&cfg.AllowedClientIDs, "allowed-client-ids", nil, "Regexps matching whole client IDs, requests from others are refused. Defaults to any.")
+	flags.DurationVar(&cfg.HandshakeTimeout, "handshake-timeout", cfg.HandshakeTimeout, "Time connections have to complete their TLS handshake before they're closed, 0 for no limit")
+	flags.DurationVar(&cfg.RequestReadTimeout, "request-read-timeout", cfg.RequestReadTimeout, "Time connections have to send the rest of a request once it's started before they're closed, 0 for no limit")
+	flags.Int64Var(&cfg.QueuedMaxRequestBytes, "queued-max-request-bytes", cfg.QueuedMaxRequestBytes, "Bytes of unanswered requests and unappended replicated records the broker holds before it stops reading more, 0 for no limit")
+	flags.IntVar(&cfg.WireLogMaxBytes, "wire-log-max-bytes", cfg.WireLogMaxBytes, "Length logged requests and responses are truncated to, 0 for no limit")
+	flags.StringVar(&cfg.WireCaptureDir, "wire-capture-dir", "", "Directory to dump the raw frames of connections matching the wire filters to, a file per connection")
+	flags.StringSliceVar(&cfg.WireClientIDs, "wire-client-ids", nil, "Client IDs of the connections logged and captured, defaults to any")
+	flags.StringSliceVar(&cfg.WireCIDRs, "wire-cidrs", nil, "CIDRs of the connections logged and captured, defaults to any")
+	return flags
+}
+
+// setReplicationFactors sets the config's replication factors from the parsed flags. pflag has no
+// int16 flags, so they're parsed as ints and range checked here.
+func setReplicationFactors(flags *pflag.FlagSet, cfg *config.Config) error {
+	for name, p := range map[string]*int16{
+		"default-replication-factor":       &cfg.DefaultReplicationFactor,
+		"offsets-topic-replication-factor": &cfg.OffsetsTopicReplicationFactor,
+	} {
+		rf, err := flags.GetInt(name)
+		if err != nil {
+			return err
+		}
+		if rf < math.MinInt16 || rf > math.MaxInt16 {
+			return fmt.Errorf("%s %d is out of range", name, rf)
+		}
+		*p = int16(rf)
+	}
+	return nil
 }
 
 func run(cmd *cobra.Command, args []string) {
 	var err error
 
+	cliFlags := changedFlags(cmd.Flags())
+	if err = loadConfig(cmd.Flags(), brokerCfgFile, os.Environ()); err == nil {
+		err = setReplicationFactors(cmd.Flags(), brokerCfg)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
 	log.SetPrefix(fmt.Sprintf("jocko: node id: %d: ", brokerCfg.ID))
 
 	cfg := jaegercfg.Configuration{
@@ -96,7 +220,30 @@ func run(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	srv := jocko.NewServer(brokerCfg, broker, nil, tracer, closer.Close)
+	var m *jocko.Metrics
+	if brokerCfg.MetricsSink == config.MetricsSinkStatsd {
+		sink, err := jocko.NewStatsdSink(brokerCfg.StatsdAddr, jocko.StatsdFlushInterval)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error connecting to statsd: %v\n", err)
+			os.Exit(1)
+		}
+		defer sink.Close()
+		m = jocko.NewMetrics(sink)
+		broker.SetMetrics(m)
+	} else if metricsAddr != "" {
+		m = jocko.NewMetrics(jocko.PrometheusSink{})
+		broker.SetMetrics(m)
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", promhttp.Handler())
+			if err := http.ListenAndServe(metricsAddr, mux); err != nil {
+				fmt.Fprintf(os.Stderr, "error serving metrics: %v\n", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	srv := jocko.NewServer(brokerCfg, broker, m, tracer, closer.Close)
 	if err := srv.Start(context.Background()); err != nil {
 		fmt.Fprintf(os.Stderr, "error starting server: %v\n", err)
 		os.Exit(1)
@@ -104,6 +251,8 @@ func run(cmd *cobra.Command, args []string) {
 
 	defer srv.Shutdown()
 
+	go reloadOnHUP(cmd.Flags(), cliFlags, broker, srv)
+
 	gracefully.Timeout = 10 * time.Second
 	gracefully.Shutdown()
 
@@ -143,6 +292,58 @@ func createTopic(cmd *cobra.Command, args []string) {
 	fmt.Printf("created topic: %v\n", topicCfg.Topic)
 }
 
+func brokerMaintenance(enabled bool) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		conn, err := dialController(maintenanceCfg.BrokerAddr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error connecting to controller: %v\n", err)
+			os.Exit(1)
+		}
+
+		resp, err := conn.BrokerMaintenance(&protocol.BrokerMaintenanceRequest{
+			BrokerID: maintenanceCfg.ID,
+			Enabled:  enabled,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error with request to broker: %v\n", err)
+			os.Exit(1)
+		}
+		if resp.ErrorCode != protocol.ErrNone.Code() {
+			if resp.ErrorMessage != nil {
+				fmt.Fprintf(os.Stderr, "error: %s\n", *resp.ErrorMessage)
+			} else {
+				fmt.Fprintf(os.Stderr, "error code: %v\n", protocol.Errs[resp.ErrorCode])
+			}
+			os.Exit(1)
+		}
+		if !enabled {
+			fmt.Printf("broker %d out of maintenance\n", maintenanceCfg.ID)
+			return
+		}
+		fmt.Printf("broker %d in maintenance, still leading %d partitions\n", maintenanceCfg.ID, resp.Leaders)
+	}
+}
+
+// dialController dials the cluster's controller, found from the metadata of the broker at the
+// given address.
+func dialController(addr string) (*jocko.Conn, error) {
+	conn, err := jocko.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	meta, err := conn.Metadata(&protocol.MetadataRequest{APIVersion: 1})
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range meta.Brokers {
+		if b.NodeID == meta.ControllerID {
+			return jocko.Dial("tcp", net.JoinHostPort(b.Host, strconv.Itoa(int(b.Port))))
+		}
+	}
+	return nil, fmt.Errorf("controller %d not found", meta.ControllerID)
+}
+
 func main() {
 	cli.Execute()
 }
@@ -175,3 +376,40 @@ func (v *memberlistConfigValue) Type() string {
 func (v *memberlistConfigValue) String() string {
 	return fmt.Sprintf("%s:%d", v.BindAddr, v.BindPort)
 }
+
+// tagsValue is a flag of comma separated key=value pairs, merged into the map each time it's set.
+type tagsValue map[string]string
+
+func newTagsValue(p *map[string]string) *tagsValue {
+	if *p == nil {
+		*p = make(map[string]string)
+	}
+	return (*tagsValue)(p)
+}
+
+func (v *tagsValue) Set(s string) error {
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return fmt.Errorf("invalid tag %q: must be key=value", pair)
+		}
+		(*v)[kv[0]] = kv[1]
+	}
+	return nil
+}
+
+func (v *tagsValue) Type() string {
+	return "string"
+}
+
+func (v *tagsValue) String() string {
+	pairs := make([]string, 0, len(*v))
+	for k, val := range *v {
+		pairs = append(pairs, k+"="+val)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+var quorumCfg = struct {
+	BrokerAddr string
+	LagMax     int64
+}{}
+
+func init() {
+	quorumCmd := &cobra.Command{Use: "quorum", Short: "Describe the raft quorum replicating the cluster's metadata, exiting 1 if it's degraded", Run: describeQuorum, Args: cobra.NoArgs}
+	quorumCmd.Flags().StringVar(&quorumCfg.BrokerAddr, "broker-addr", "0.0.0.0:9092", "Address of a broker in the cluster")
+	quorumCmd.Flags().Int64Var(&quorumCfg.LagMax, "lag-max", 1000, "Number of raft entries a voter can be behind the leader before the quorum's degraded")
+	cli.AddCommand(quorumCmd)
+}
+
+func describeQuorum(cmd *cobra.Command, args []string) {
+	conn, err := dialController(quorumCfg.BrokerAddr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error connecting to controller: %v\n", err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+
+	resp, err := conn.DescribeQuorum(&protocol.DescribeQuorumRequest{})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error with request to broker: %v\n", err)
+		os.Exit(1)
+	}
+	if resp.ErrorCode != protocol.ErrNone.Code() {
+		if resp.ErrorMessage != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", *resp.ErrorMessage)
+		} else {
+			fmt.Fprintf(os.Stderr, "error code: %v\n", protocol.Errs[resp.ErrorCode])
+		}
+		os.Exit(1)
+	}
+
+	fmt.Printf("leader: %d, term: %d, commit index: %d\n", resp.LeaderID, resp.Term, resp.CommitIndex)
+	fmt.Printf("%-10s %-10s %-12s %-8s %s\n", "ROLE", "BROKER", "LAST INDEX", "LAG", "ERROR")
+	degraded := 0
+	for _, role := range []struct {
+		name     string
+		replicas []*protocol.QuorumReplica
+	}{{"voter", resp.Voters}, {"observer", resp.Observers}} {
+		for _, q := range role.replicas {
+			var errMsg string
+			if q.ErrorCode != protocol.ErrNone.Code() {
+				errMsg = protocol.Errs[q.ErrorCode].Error()
+			}
+			fmt.Printf("%-10s %-10d %-12d %-8d %s\n", role.name, q.ReplicaID, q.LastIndex, q.Lag, errMsg)
+			if role.name == "voter" && (q.ErrorCode != protocol.ErrNone.Code() || q.Lag > quorumCfg.LagMax) {
+				degraded++
+			}
+		}
+	}
+	if degraded > 0 {
+		fmt.Printf("degraded: %d of %d voters down or lagging\n", degraded, len(resp.Voters))
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/pflag"
+	"github.com/travisjeffery/jocko/jocko"
+	"github.com/travisjeffery/jocko/jocko/config"
+)
+
+// changedFlags returns the names of the flags that have been set, e.g. on the command line.
+func changedFlags(flags *pflag.FlagSet) map[string]bool {
+	changed := make(map[string]bool)
+	flags.Visit(func(f *pflag.Flag) {
+		changed[f.Name] = true
+	})
+	return changed
+}
+
+// reloadOnHUP reloads the broker's TLS certificate and its reloadable options from the config file
+// and environment each time the process gets a SIGHUP.
+func reloadOnHUP(flags *pflag.FlagSet, cliFlags map[string]bool, broker *jocko.Broker, srv *jocko.Server) {
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	for range hupCh {
+		log.Printf("reloading config")
+		if err := srv.ReloadTLS(); err != nil {
+			fmt.Fprintf(os.Stderr, "error reloading tls certificate: %v\n", err)
+		}
+		cfg, err := reloadConfig(flags, cliFlags)
+		if err == nil {
+			err = broker.Reload(cfg)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error reloading config: %v\n", err)
+		}
+	}
+}
+
+// reloadConfig rereads the config file and environment into a new config. Options given on the
+// command line keep the values they were given.
+func reloadConfig(flags *pflag.FlagSet, cliFlags map[string]bool) (*config.Config, error) {
+	cfg := config.DefaultConfig()
+	reloaded := brokerFlags(cfg)
+	for name := range cliFlags {
+		f := reloaded.Lookup(name)
+		if f == nil {
+			continue
+		}
+		if f.Value.Type() == "stringSlice" {
+			// slices don't format as they're parsed, they aren't reloadable anyway.
+			f.Changed = true
+			continue
+		}
+		if err := reloaded.Set(name, flags.Lookup(name).Value.String()); err != nil {
+			return nil, err
+		}
+	}
+	if err := loadConfig(reloaded, brokerCfgFile, os.Environ()); err != nil {
+		return nil, err
+	}
+	if err := setReplicationFactors(reloaded, cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"hash/crc32"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/travisjeffery/jocko/jocko"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+var verifyReplicasCfg = struct {
+	BrokerAddr  string
+	Topics      []string
+	Partition   int32
+	StartOffset int64
+	MaxBytes    int32
+	Timeout     time.Duration
+}{}
+
+func init() {
+	verifyReplicasCmd := &cobra.Command{Use: "verify-replicas", Short: "Compare the checksums of partitions' replicas offset by offset, exiting 1 if any diverge", Run: verifyReplicas, Args: cobra.NoArgs}
+	verifyReplicasCmd.Flags().StringVar(&verifyReplicasCfg.BrokerAddr, "broker-addr", "0.0.0.0:9092", "Address of a broker in the cluster")
+	verifyReplicasCmd.Flags().StringSliceVar(&verifyReplicasCfg.Topics, "topic", nil, "Topic to verify. Can be specified multiple times, defaults to every topic.")
+	verifyReplicasCmd.Flags().Int32Var(&verifyReplicasCfg.Partition, "partition", -1, "Partition to verify, defaults to every partition")
+	verifyReplicasCmd.Flags().Int64Var(&verifyReplicasCfg.StartOffset, "start-offset", 0, "Offset to start comparing from, or the replicas' latest log start offset if it's before it")
+	verifyReplicasCmd.Flags().Int32Var(&verifyReplicasCfg.MaxBytes, "max-bytes", 1<<20, "Number of bytes to fetch from each replica at a time, at least the largest record batch")
+	verifyReplicasCmd.Flags().DurationVar(&verifyReplicasCfg.Timeout, "timeout", 10*time.Second, "Timeout of each request to a broker")
+	cli.AddCommand(verifyReplicasCmd)
+}
+
+// logEntry is a fetched message set or record batch: its offsets and the checksum of its bytes
+// after its offset and size.
+type logEntry struct {
+	offset     int64
+	lastOffset int64
+	checksum   uint32
+}
+
+func (e logEntry) String() string {
+	if e.offset == e.lastOffset {
+		return fmt.Sprintf("offset %d checksum %08x", e.offset, e.checksum)
+	}
+	return fmt.Sprintf("offsets %d-%d checksum %08x", e.offset, e.lastOffset, e.checksum)
+}
+
+// logEntries returns the fetched record set's entries, dropping the last if it's truncated.
+func logEntries(set []byte) []logEntry {
+	var entries []logEntry
+	for len(set) >= 12 {
+		n := 12 + int(protocol.Encoding.Uint32(set[8:12]))
+		if n > len(set) {
+			break
+		}
+		entries = append(entries, logEntry{
+			offset:     int64(protocol.Encoding.Uint64(set)),
+			lastOffset: protocol.LastOffset(set[:n]),
+			checksum:   crc32.ChecksumIEEE(set[12:n]),
+		})
+		set = set[n:]
+	}
+	return entries
+}
+
+// replicaFetcher fetches the partition's records from the offset on the broker's replica.
+type replicaFetcher func(broker int32, offset int64) (*protocol.FetchPartitionResponse, error)
+
+// replicaVerification is the result of comparing a partition's replicas.
+type replicaVerification struct {
+	// start is the first offset compared and next the offset after the last entry all the
+	// replicas have and agree on.
+	start int64
+	next  int64
+	// ends are the replicas' log end offsets as of their last fetch.
+	ends map[int32]int64
+	// diverged are the replicas' entries at next if they differ.
+	diverged map[int32]logEntry
+	err      error
+}
+
+// verifyPartition compares the replicas' entries offset by offset from the start offset until
+// one of the replicas' logs ends or they diverge. Offsets before a replica's log start offset
+// can't be compared, so a start before them all is moved up to the latest.
+func verifyPartition(replicas []int32, start int64, fetch replicaFetcher) *replicaVerification {
+	v := &replicaVerification{start: start, next: start, ends: make(map[int32]int64, len(replicas))}
+	for {
+		entries := make(map[int32][]logEntry, len(replicas))
+		n := -1
+		restart := false
+		for _, id := range replicas {
+			res, err := fetch(id, v.next)
+			if err != nil {
+				v.err = fmt.Errorf("broker %d: %v", id, err)
+				return v
+			}
+			v.ends[id] = res.HighWatermark + 1
+			switch res.ErrorCode {
+			case protocol.ErrNone.Code():
+			case protocol.ErrOffsetOutOfRange.Code():
+				if v.next == v.start && v.next < res.LogStartOffset {
+					v.start, v.next = res.LogStartOffset, res.LogStartOffset
+					restart = true
+				}
+			default:
+				v.err = fmt.Errorf("broker %d: %v", id, protocol.Errs[res.ErrorCode])
+				return v
+			}
+			if restart {
+				break
+			}
+			entries[id] = logEntries(res.RecordSet)
+			if len(entries[id]) == 0 && res.ErrorCode == protocol.ErrNone.Code() && res.HighWatermark >= v.next {
+				v.err = fmt.Errorf("broker %d: entry at offset %d is larger than the max bytes", id, v.next)
+				return v
+			}
+			if n < 0 || len(entries[id]) < n {
+				n = len(entries[id])
+			}
+		}
+		if restart {
+			continue
+		}
+		if n <= 0 {
+			return v
+		}
+		for i := 0; i < n; i++ {
+			first := entries[replicas[0]][i]
+			for _, id := range replicas[1:] {
+				if entries[id][i] != first {
+					v.diverged = make(map[int32]logEntry, len(replicas))
+					for _, r := range replicas {
+						v.diverged[r] = entries[r][i]
+					}
+					return v
+				}
+			}
+			v.next = first.lastOffset + 1
+		}
+	}
+}
+
+func verifyReplicas(cmd *cobra.Command, args []string) {
+	conn, err := jocko.Dial("tcp", verifyReplicasCfg.BrokerAddr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error connecting to broker: %v\n", err)
+		os.Exit(1)
+	}
+	meta, err := conn.Metadata(&protocol.MetadataRequest{APIVersion: 1, Topics: verifyReplicasCfg.Topics})
+	conn.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error with request to broker: %v\n", err)
+		os.Exit(1)
+	}
+
+	addrs := make(map[int32]string, len(meta.Brokers))
+	for _, b := range meta.Brokers {
+		addrs[b.NodeID] = net.JoinHostPort(b.Host, strconv.Itoa(int(b.Port)))
+	}
+	conns := make(map[int32]*jocko.Conn)
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+
+	topics := append([]*protocol.TopicMetadata(nil), meta.TopicMetadata...)
+	sort.Slice(topics, func(i, j int) bool { return topics[i].Topic < topics[j].Topic })
+	var failed bool
+	for _, t := range topics {
+		if t.TopicErrorCode != protocol.ErrNone.Code() {
+			fmt.Printf("topic %s: %v\n", t.Topic, protocol.Errs[t.TopicErrorCode])
+			failed = true
+			continue
+		}
+		partitions := append([]*protocol.PartitionMetadata(nil), t.PartitionMetadata...)
+		sort.Slice(partitions, func(i, j int) bool { return partitions[i].PartitionID < partitions[j].PartitionID })
+		for _, p := range partitions {
+			if verifyReplicasCfg.Partition >= 0 && p.PartitionID != verifyReplicasCfg.Partition {
+				continue
+			}
+			topic, partition := t.Topic, p.PartitionID
+			fetch := func(broker int32, offset int64) (*protocol.FetchPartitionResponse, error) {
+				conn, ok := conns[broker]
+				if !ok {
+					addr, ok := addrs[broker]
+					if !ok {
+						return nil, fmt.Errorf("not in the cluster's metadata")
+					}
+					d := jocko.NewDialer("jocko-verify-replicas")
+					d.Timeout = verifyReplicasCfg.Timeout
+					var err error
+					if conn, err = d.Dial("tcp", addr); err != nil {
+						return nil, err
+					}
+					conns[broker] = conn
+				}
+				conn.SetDeadline(time.Now().Add(verifyReplicasCfg.Timeout))
+				res, err := conn.Fetch(&protocol.FetchRequest{
+					APIVersion: 5,
+					ReplicaID:  protocol.DebuggingReplicaID,
+					MinBytes:   1,
+					MaxBytes:   verifyReplicasCfg.MaxBytes,
+					Topics: []*protocol.FetchTopic{{
+						Topic:      topic,
+						Partitions: []*protocol.FetchPartition{{Partition: partition, FetchOffset: offset, MaxBytes: verifyReplicasCfg.MaxBytes}},
+					}},
+				})
+				if err != nil {
+					// the connection's state is unknown, the next fetch dials again.
+					conn.Close()
+					delete(conns, broker)
+					return nil, err
+				}
+				return res.Responses[0].PartitionResponses[0], nil
+			}
+			v := verifyPartition(p.Replicas, verifyReplicasCfg.StartOffset, fetch)
+			fmt.Printf("topic %s partition %d: %s\n", topic, partition, v.report(p.Replicas))
+			failed = failed || v.err != nil || v.diverged != nil
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// report describes the verification, e.g. "replicas 1, 2 match from offset 0 to 9".
+func (v *replicaVerification) report(replicas []int32) string {
+	var s string
+	switch {
+	case v.err != nil:
+		s = fmt.Sprintf("error at offset %d: %v", v.next, v.err)
+	case v.next == v.start:
+		s = fmt.Sprintf("replicas %s have nothing to compare from offset %d", joinIDs(replicas), v.start)
+	default:
+		s = fmt.Sprintf("replicas %s match from offset %d to %d", joinIDs(replicas), v.start, v.next-1)
+	}
+	if v.diverged != nil {
+		var entries []string
+		for _, id := range replicas {
+			entries = append(entries, fmt.Sprintf("broker %d has %s", id, v.diverged[id]))
+		}
+		s += fmt.Sprintf(", then DIVERGE at offset %d: %s", v.next, strings.Join(entries, ", "))
+	}
+	var ends []string
+	var differ bool
+	for _, id := range replicas {
+		end, ok := v.ends[id]
+		if !ok {
+			continue
+		}
+		differ = differ || end != v.ends[replicas[0]]
+		ends = append(ends, fmt.Sprintf("broker %d at %d", id, end))
+	}
+	if differ {
+		s += fmt.Sprintf(" (log ends: %s)", strings.Join(ends, ", "))
+	}
+	return s
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestVerifyPartition(t *testing.T) {
+	entry := func(offset int64, value string) []byte {
+		b, err := protocol.Encode(&protocol.MessageSet{Offset: offset, Messages: []*protocol.Message{{Value: []byte(value)}}})
+		require.NoError(t, err)
+		return b
+	}
+	// logs are the brokers' replicas' entries from their log start offsets.
+	logs := map[int32][][]byte{
+		1: {entry(2, "c"), entry(3, "d"), entry(4, "e"), entry(5, "f")},
+		2: {entry(0, "a"), entry(1, "b"), entry(2, "c"), entry(3, "d"), entry(4, "e")},
+	}
+	// fetch returns up to two entries from the offset, truncating the next.
+	fetch := func(broker int32, offset int64) (*protocol.FetchPartitionResponse, error) {
+		log := logs[broker]
+		start := int64(protocol.Encoding.Uint64(log[0]))
+		res := &protocol.FetchPartitionResponse{LogStartOffset: start, HighWatermark: start + int64(len(log)) - 1}
+		if offset < start || offset > res.HighWatermark+1 {
+			res.ErrorCode = protocol.ErrOffsetOutOfRange.Code()
+			return res, nil
+		}
+		for i := offset - start; i < int64(len(log)) && i < offset-start+2; i++ {
+			res.RecordSet = append(res.RecordSet, log[i]...)
+		}
+		if i := offset - start + 2; i < int64(len(log)) {
+			res.RecordSet = append(res.RecordSet, log[i][:5]...)
+		}
+		return res, nil
+	}
+
+	// the replicas are compared from the latest log start offset to the earliest log end.
+	v := verifyPartition([]int32{1, 2}, 0, fetch)
+	require.NoError(t, v.err)
+	require.Nil(t, v.diverged)
+	require.Equal(t, int64(2), v.start)
+	require.Equal(t, int64(5), v.next)
+	require.Equal(t, map[int32]int64{1: 6, 2: 5}, v.ends)
+	require.Equal(t, "replicas 1, 2 match from offset 2 to 4 (log ends: broker 1 at 6, broker 2 at 5)", v.report([]int32{1, 2}))
+
+	logs[2][3] = entry(3, "x")
+	v = verifyPartition([]int32{1, 2}, 0, fetch)
+	require.NoError(t, v.err)
+	require.Equal(t, int64(3), v.next)
+	require.Equal(t, logEntries(logs[1][1])[0], v.diverged[1])
+	require.Equal(t, logEntries(logs[2][3])[0], v.diverged[2])
+	require.NotEqual(t, v.diverged[1].checksum, v.diverged[2].checksum)
+	require.Contains(t, v.report([]int32{1, 2}), "replicas 1, 2 match from offset 2 to 2, then DIVERGE at offset 3: broker 1 has offset 3 checksum")
+
+	// an entry larger than the fetch's max bytes can't be compared.
+	logs[1] = [][]byte{entry(2, "c")}
+	fetch2 := func(broker int32, offset int64) (*protocol.FetchPartitionResponse, error) {
+		res, err := fetch(broker, offset)
+		res.RecordSet = res.RecordSet[:5]
+		return res, err
+	}
+	v = verifyPartition([]int32{1, 2}, 2, fetch2)
+	require.EqualError(t, v.err, "broker 1: entry at offset 2 is larger than the max bytes")
+}
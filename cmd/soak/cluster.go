@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/travisjeffery/jocko/testutil"
+)
+
+// broker is a jocko broker run as a child process, so it can be crashed and restarted without
+// taking the harness down with it.
+type broker struct {
+	id       int32
+	addr     string
+	raftAddr string
+	serfAddr string
+	dataDir  string
+	logPath  string
+
+	cmd    *exec.Cmd
+	exited chan struct{}
+}
+
+// cluster is a local cluster of brokers sharing a work dir holding their data dirs and logs.
+type cluster struct {
+	bin     string
+	dir     string
+	brokers []*broker
+}
+
+func newCluster(bin, dir string, n int) *cluster {
+	c := &cluster{bin: bin, dir: dir}
+	ports := testutil.Ports(3 * n)
+	for i := 0; i < n; i++ {
+		c.brokers = append(c.brokers, &broker{
+			id:       int32(i + 1),
+			addr:     fmt.Sprintf("127.0.0.1:%d", ports[3*i]),
+			raftAddr: fmt.Sprintf("127.0.0.1:%d", ports[3*i+1]),
+			serfAddr: fmt.Sprintf("127.0.0.1:%d", ports[3*i+2]),
+			dataDir:  filepath.Join(dir, fmt.Sprintf("data-%d", i+1)),
+			logPath:  filepath.Join(dir, fmt.Sprintf("broker-%d.log", i+1)),
+		})
+	}
+	return c
+}
+
+// start starts the broker, joined to the other brokers. The first broker bootstraps the cluster.
+func (c *cluster) start(b *broker) error {
+	args := []string{
+		"broker",
+		"--id=" + strconv.Itoa(int(b.id)),
+		"--node-name=soak-" + strconv.Itoa(int(b.id)),
+		"--data-dir=" + b.dataDir,
+		"--broker-addr=" + b.addr,
+		"--raft-addr=" + b.raftAddr,
+		"--serf-addr=" + b.serfAddr,
+		"--bootstrap-expect=" + strconv.Itoa(len(c.brokers)),
+	}
+	if b == c.brokers[0] {
+		args = append(args, "--bootstrap")
+	}
+	for _, o := range c.brokers {
+		if o != b {
+			args = append(args, "--join="+o.serfAddr)
+		}
+	}
+	// the logs are appended to so a restarted broker's follow what it logged before.
+	f, err := os.OpenFile(b.logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(f, "==> %s: starting broker %d\n", time.Now().Format(time.RFC3339Nano), b.id)
+	cmd := exec.Command(c.bin, args...)
+	cmd.Stdout, cmd.Stderr = f, f
+	if err := cmd.Start(); err != nil {
+		f.Close()
+		return err
+	}
+	b.cmd, b.exited = cmd, make(chan struct{})
+	go func(exited chan struct{}) {
+		cmd.Wait()
+		f.Close()
+		close(exited)
+	}(b.exited)
+	return nil
+}
+
+// stop stops the broker, killing it if crash is set or it doesn't exit gracefully in time.
+func (c *cluster) stop(b *broker, crash bool) {
+	if b.cmd == nil {
+		return
+	}
+	sig := syscall.SIGTERM
+	if crash {
+		sig = syscall.SIGKILL
+	}
+	b.cmd.Process.Signal(sig)
+	select {
+	case <-b.exited:
+	case <-time.After(15 * time.Second):
+		b.cmd.Process.Kill()
+		<-b.exited
+	}
+	b.cmd = nil
+}
+
+// running returns whether the broker's process is running.
+func (b *broker) running() bool {
+	if b.cmd == nil {
+		return false
+	}
+	select {
+	case <-b.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+// addrs returns the addresses of the running brokers.
+func (c *cluster) addrs() []string {
+	var addrs []string
+	for _, b := range c.brokers {
+		if b.running() {
+			addrs = append(addrs, b.addr)
+		}
+	}
+	return addrs
+}
+
+func (c *cluster) shutdown() {
+	for _, b := range c.brokers {
+		c.stop(b, false)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Violation is a broken invariant.
+type Violation struct {
+	Time      time.Time `json:"time"`
+	Invariant string    `json:"invariant"`
+	Partition int32     `json:"partition"`
+	Detail    string    `json:"detail"`
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: partition %d: %s", v.Invariant, v.Partition, v.Detail)
+}
+
+const (
+	invariantDataLoss  = "acked-data-loss"
+	invariantMonotonic = "monotonic-offsets"
+	invariantISR       = "isr-recovery"
+)
+
+// ledger tracks the records acked by the producers and consumed by the consumer, checking no
+// acked record's lost or overwritten and that the offsets only move forward.
+type ledger struct {
+	mu         sync.Mutex
+	partitions map[int32]*partitionLedger
+	violations []Violation
+	// notify is signaled when a violation's recorded.
+	notify chan struct{}
+}
+
+type partitionLedger struct {
+	// lastAcked is the last offset acked, -1 before the first ack.
+	lastAcked int64
+	// acked are the acked records that haven't been consumed yet, in offset order.
+	acked []record
+	// consumed are the values of the consumed offsets that haven't been acked yet, since acks can
+	// come back after the consumer's fetched what they acked.
+	consumed map[int64]string
+	// next is the offset the consumer reads next.
+	next int64
+	// ackedTotal and consumedTotal count the records acked and consumed.
+	ackedTotal, consumedTotal int64
+}
+
+type record struct {
+	offset int64
+	value  string
+}
+
+func newLedger(partitions int32) *ledger {
+	l := &ledger{
+		partitions: make(map[int32]*partitionLedger),
+		notify:     make(chan struct{}, 1),
+	}
+	for p := int32(0); p < partitions; p++ {
+		l.partitions[p] = &partitionLedger{
+			lastAcked: -1,
+			consumed:  make(map[int64]string),
+		}
+	}
+	return l
+}
+
+// ack records the value acked at the partition's offset.
+func (l *ledger) ack(partition int32, offset int64, value string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	p := l.partitions[partition]
+	p.ackedTotal++
+	if offset <= p.lastAcked {
+		l.violate(invariantMonotonic, partition, "acked offset %d after offset %d", offset, p.lastAcked)
+		return
+	}
+	p.lastAcked = offset
+	if offset < p.next {
+		if v, ok := p.consumed[offset]; !ok {
+			l.violate(invariantDataLoss, partition, "acked offset %d (%q) was skipped by the consumer", offset, value)
+		} else if v != value {
+			l.violate(invariantDataLoss, partition, "acked offset %d (%q) was consumed as %q", offset, value, v)
+		}
+	} else {
+		p.acked = append(p.acked, record{offset: offset, value: value})
+	}
+	// the producer's acks are in order so what's consumed up to here that wasn't acked never will be.
+	for o := range p.consumed {
+		if o <= offset {
+			delete(p.consumed, o)
+		}
+	}
+}
+
+// consume records the value consumed at the partition's offset.
+func (l *ledger) consume(partition int32, offset int64, value string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	p := l.partitions[partition]
+	p.consumedTotal++
+	if offset < p.next {
+		l.violate(invariantMonotonic, partition, "consumed offset %d after offset %d", offset, p.next-1)
+		return
+	}
+	for len(p.acked) > 0 && p.acked[0].offset < offset {
+		l.violate(invariantDataLoss, partition, "acked offset %d (%q) was skipped by the consumer", p.acked[0].offset, p.acked[0].value)
+		p.acked = p.acked[1:]
+	}
+	if len(p.acked) > 0 && p.acked[0].offset == offset {
+		if v := p.acked[0].value; v != value {
+			l.violate(invariantDataLoss, partition, "acked offset %d (%q) was consumed as %q", offset, v, value)
+		}
+		p.acked = p.acked[1:]
+	} else if offset > p.lastAcked {
+		p.consumed[offset] = value
+	}
+	p.next = offset + 1
+}
+
+// next returns the offset the consumer reads the partition from next.
+func (l *ledger) next(partition int32) int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.partitions[partition].next
+}
+
+// caughtUp returns whether the consumer has read every acked record.
+func (l *ledger) caughtUp() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, p := range l.partitions {
+		if p.next <= p.lastAcked {
+			return false
+		}
+	}
+	return true
+}
+
+// finish records the acked records the consumer never read as lost.
+func (l *ledger) finish() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for id, p := range l.partitions {
+		for _, r := range p.acked {
+			l.violate(invariantDataLoss, id, "acked offset %d (%q) was never consumed", r.offset, r.value)
+		}
+		p.acked = nil
+	}
+}
+
+// violation records a violation found outside the ledger.
+func (l *ledger) violation(invariant string, partition int32, format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.violate(invariant, partition, format, args...)
+}
+
+func (l *ledger) violate(invariant string, partition int32, format string, args ...interface{}) {
+	l.violations = append(l.violations, Violation{
+		Time:      time.Now(),
+		Invariant: invariant,
+		Partition: partition,
+		Detail:    fmt.Sprintf(format, args...),
+	})
+	select {
+	case l.notify <- struct{}{}:
+	default:
+	}
+}
+
+// recorded returns the violations recorded.
+func (l *ledger) recorded() []Violation {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Violation(nil), l.violations...)
+}
+
+// stats returns the records acked and consumed across the partitions.
+func (l *ledger) stats() (acked, consumed int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, p := range l.partitions {
+		acked += p.ackedTotal
+		consumed += p.consumedTotal
+	}
+	return acked, consumed
+}
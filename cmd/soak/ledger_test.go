@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLedger(t *testing.T) {
+	l := newLedger(2)
+
+	// acks can come back before or after what they acked is consumed.
+	l.ack(0, 0, "a")
+	l.consume(0, 0, "a")
+	l.consume(0, 1, "b")
+	l.ack(0, 1, "b")
+	// a failed produce can still be appended, it's consumed but never acked.
+	l.consume(0, 2, "unacked")
+	l.ack(0, 3, "c")
+	l.consume(0, 3, "c")
+	require.True(t, l.caughtUp())
+	require.Empty(t, l.recorded())
+
+	l.ack(1, 0, "a")
+	l.ack(1, 1, "b")
+	l.ack(1, 2, "c")
+	require.False(t, l.caughtUp())
+	// offset 1 was lost and offset 2 overwritten.
+	l.consume(1, 0, "a")
+	l.consume(1, 2, "d")
+	l.consume(1, 2, "d")
+	l.ack(1, 2, "e")
+	l.ack(1, 3, "f")
+	l.finish()
+
+	var details []string
+	for _, v := range l.recorded() {
+		details = append(details, v.String())
+	}
+	require.Equal(t, []string{
+		`acked-data-loss: partition 1: acked offset 1 ("b") was skipped by the consumer`,
+		`acked-data-loss: partition 1: acked offset 2 ("c") was consumed as "d"`,
+		`monotonic-offsets: partition 1: consumed offset 2 after offset 2`,
+		`monotonic-offsets: partition 1: acked offset 2 after offset 2`,
+		`acked-data-loss: partition 1: acked offset 3 ("f") was never consumed`,
+	}, details)
+	acked, consumed := l.stats()
+	require.Equal(t, int64(8), acked)
+	require.Equal(t, int64(7), consumed)
+}
@@ -0,0 +1,487 @@
+// Command soak runs a local jocko cluster for a long while, producing to and consuming from it
+// continuously while restarting its brokers at random, and checks that no acked records are lost,
+// offsets only move forward, and partitions' ISRs recover after each restart. On a violation it
+// stops and leaves the brokers' data dirs and logs, and a report of what happened, in its work
+// dir.
+//
+//	$ go build ./cmd/jocko && go run ./cmd/soak --jocko=./jocko --duration=1h
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/travisjeffery/jocko/client"
+	"github.com/travisjeffery/jocko/jocko"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+const topic = "soak"
+
+var (
+	cli = &cobra.Command{
+		Use:   "soak",
+		Short: "Soak test a local Jocko cluster, restarting brokers and checking invariants",
+		Run:   run,
+		Args:  cobra.NoArgs,
+	}
+
+	soakCfg = struct {
+		Jocko             string
+		Dir               string
+		Brokers           int
+		Partitions        int32
+		ReplicationFactor int
+		Duration          time.Duration
+		RestartInterval   time.Duration
+		Downtime          time.Duration
+		RecoveryTimeout   time.Duration
+		ProduceInterval   time.Duration
+		Crash             bool
+		Seed              int64
+		Keep              bool
+	}{}
+)
+
+func init() {
+	flags := cli.Flags()
+	flags.StringVar(&soakCfg.Jocko, "jocko", "jocko", "Path to the jocko binary the brokers are run with")
+	flags.StringVar(&soakCfg.Dir, "dir", "", "Work dir for the brokers' data dirs and logs and the diagnostics, defaults to a temp dir")
+	flags.IntVar(&soakCfg.Brokers, "brokers", 3, "Number of brokers")
+	flags.Int32Var(&soakCfg.Partitions, "partitions", 4, "Number of partitions produced to and consumed from")
+	flags.IntVar(&soakCfg.ReplicationFactor, "replication-factor", 3, "Replication factor of the partitions")
+	flags.DurationVar(&soakCfg.Duration, "duration", 10*time.Minute, "How long to soak for")
+	flags.DurationVar(&soakCfg.RestartInterval, "restart-interval", 30*time.Second, "How often a random broker's restarted, 0 to never restart brokers")
+	flags.DurationVar(&soakCfg.Downtime, "downtime", 5*time.Second, "How long restarted brokers are down for")
+	flags.DurationVar(&soakCfg.RecoveryTimeout, "recovery-timeout", time.Minute, "How long partitions have to get a leader and their full ISR back after a restart")
+	flags.DurationVar(&soakCfg.ProduceInterval, "produce-interval", 10*time.Millisecond, "How long each partition's producer waits between records")
+	flags.BoolVar(&soakCfg.Crash, "crash", false, "Kill brokers rather than shutting them down gracefully")
+	flags.Int64Var(&soakCfg.Seed, "seed", 0, "Seed choosing the brokers restarted, defaults to the time")
+	flags.BoolVar(&soakCfg.Keep, "keep", false, "Keep the work dir even if no invariant was violated")
+}
+
+func main() {
+	if err := cli.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+func run(cmd *cobra.Command, args []string) {
+	if soakCfg.ReplicationFactor < 1 || soakCfg.ReplicationFactor > math.MaxInt16 {
+		fmt.Fprintf(os.Stderr, "replication factor %d is out of range\n", soakCfg.ReplicationFactor)
+		os.Exit(1)
+	}
+	bin, err := exec.LookPath(soakCfg.Jocko)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error finding jocko binary: %v\n", err)
+		os.Exit(1)
+	}
+	if soakCfg.Seed == 0 {
+		soakCfg.Seed = time.Now().UnixNano()
+	}
+	dir := soakCfg.Dir
+	if dir == "" {
+		if dir, err = ioutil.TempDir("", "jocko-soak"); err != nil {
+			fmt.Fprintf(os.Stderr, "error creating work dir: %v\n", err)
+			os.Exit(1)
+		}
+	} else if err := os.MkdirAll(dir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "error creating work dir: %v\n", err)
+		os.Exit(1)
+	}
+
+	s := &soaker{
+		cluster:  newCluster(bin, dir, soakCfg.Brokers),
+		ledger:   newLedger(soakCfg.Partitions),
+		rand:     rand.New(rand.NewSource(soakCfg.Seed)),
+		started:  time.Now(),
+		stopping: make(chan struct{}),
+	}
+	s.event("soaking in %s with seed %d", dir, soakCfg.Seed)
+	err = s.soak()
+	violations := s.ledger.recorded()
+	if err == nil && len(violations) == 0 {
+		s.cluster.shutdown()
+		acked, consumed := s.ledger.stats()
+		s.event("done: no violations, %d records acked, %d consumed, %d restarts", acked, consumed, s.restarts)
+		if !soakCfg.Keep {
+			os.RemoveAll(dir)
+		}
+		return
+	}
+	if err != nil {
+		s.event("error: %v", err)
+	}
+	for _, v := range violations {
+		s.event("violation: %s", v)
+	}
+	path, derr := s.dumpDiagnostics(dir, err, violations)
+	s.cluster.shutdown()
+	if derr != nil {
+		fmt.Fprintf(os.Stderr, "error dumping diagnostics: %v\n", derr)
+	} else {
+		fmt.Fprintf(os.Stderr, "diagnostics dumped to %s, broker data dirs and logs are in %s\n", path, dir)
+	}
+	os.Exit(1)
+}
+
+// soaker runs the workload and the restarts against the cluster.
+type soaker struct {
+	cluster *cluster
+	ledger  *ledger
+	rand    *rand.Rand
+	started time.Time
+	client  *client.Client
+
+	restarts      int
+	produceErrors int64
+	fetchErrors   int64
+
+	// stopping is closed to stop the producers.
+	stopping  chan struct{}
+	producers sync.WaitGroup
+
+	mu     sync.Mutex
+	events []string
+}
+
+// maxEvents is the number of the most recent events kept for the diagnostics.
+const maxEvents = 1000
+
+// event logs what happened and keeps it for the diagnostics.
+func (s *soaker) event(format string, args ...interface{}) {
+	e := fmt.Sprintf("%s %s", time.Now().Format("15:04:05.000"), fmt.Sprintf(format, args...))
+	fmt.Println(e)
+	s.mu.Lock()
+	s.events = append(s.events, e)
+	if len(s.events) > maxEvents {
+		s.events = s.events[len(s.events)-maxEvents:]
+	}
+	s.mu.Unlock()
+}
+
+func (s *soaker) soak() error {
+	for _, b := range s.cluster.brokers {
+		if err := s.cluster.start(b); err != nil {
+			return fmt.Errorf("starting broker %d: %v", b.id, err)
+		}
+	}
+	if err := s.createTopic(time.Minute); err != nil {
+		return err
+	}
+	if unrecovered := s.waitRecovered(time.Minute); len(unrecovered) != 0 {
+		return fmt.Errorf("partitions never got their leaders and full ISRs: %s", strings.Join(unrecovered, "; "))
+	}
+	s.event("cluster up: %d brokers, topic %s with %d partitions", len(s.cluster.brokers), topic, soakCfg.Partitions)
+
+	var err error
+	if s.client, err = client.New(client.Config{Brokers: s.cluster.addrs()}); err != nil {
+		return err
+	}
+	defer s.client.Close()
+	producer := client.NewProducer(s.client, client.ProducerConfig{Acks: -1})
+	for p := int32(0); p < soakCfg.Partitions; p++ {
+		s.producers.Add(1)
+		go s.produce(producer, p)
+	}
+	consumer := client.NewConsumer(s.client, client.ConsumerConfig{MaxWait: 100 * time.Millisecond})
+	defer consumer.Close()
+	for p := int32(0); p < soakCfg.Partitions; p++ {
+		if err := consumer.Assign(topic, p, 0); err != nil {
+			return err
+		}
+	}
+	consuming := make(chan struct{})
+	consumed := make(chan struct{})
+	go func() {
+		defer close(consumed)
+		s.consume(consumer, consuming)
+	}()
+	stopConsuming := func() {
+		close(consuming)
+		<-consumed
+	}
+
+	s.chaos()
+
+	// let the cluster settle and the consumer catch up to what was acked before the final check.
+	close(s.stopping)
+	s.producers.Wait()
+	if unrecovered := s.waitRecovered(soakCfg.RecoveryTimeout); len(unrecovered) != 0 {
+		s.ledger.violation(invariantISR, -1, "partitions didn't recover at the end: %s", strings.Join(unrecovered, "; "))
+	}
+	for deadline := time.Now().Add(soakCfg.RecoveryTimeout); !s.ledger.caughtUp() && time.Now().Before(deadline); {
+		time.Sleep(100 * time.Millisecond)
+	}
+	stopConsuming()
+	s.ledger.finish()
+	return nil
+}
+
+// chaos restarts random brokers until the soak's done, it's interrupted, or an invariant's
+// violated, checking the partitions recover after each restart.
+func (s *soaker) chaos() {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	done := time.After(soakCfg.Duration)
+	stats := time.NewTicker(10 * time.Second)
+	defer stats.Stop()
+	var restart <-chan time.Time
+	if soakCfg.RestartInterval > 0 {
+		t := time.NewTicker(soakCfg.RestartInterval)
+		defer t.Stop()
+		restart = t.C
+	}
+	for {
+		select {
+		case <-done:
+			return
+		case <-interrupt:
+			s.event("interrupted, finishing")
+			return
+		case <-s.ledger.notify:
+			return
+		case <-stats.C:
+			acked, consumed := s.ledger.stats()
+			s.event("stats: %d acked, %d consumed, %d produce errors, %d fetch errors, %d restarts",
+				acked, consumed, atomic.LoadInt64(&s.produceErrors), atomic.LoadInt64(&s.fetchErrors), s.restarts)
+		case <-restart:
+			b := s.cluster.brokers[s.rand.Intn(len(s.cluster.brokers))]
+			s.restarts++
+			s.event("stopping broker %d (crash: %v)", b.id, soakCfg.Crash)
+			s.cluster.stop(b, soakCfg.Crash)
+			time.Sleep(soakCfg.Downtime)
+			if err := s.cluster.start(b); err != nil {
+				s.ledger.violation(invariantISR, -1, "restarting broker %d failed: %v", b.id, err)
+				return
+			}
+			s.event("restarted broker %d", b.id)
+			if unrecovered := s.waitRecovered(soakCfg.RecoveryTimeout); len(unrecovered) != 0 {
+				s.ledger.violation(invariantISR, -1, "partitions didn't recover within %s of restarting broker %d: %s", soakCfg.RecoveryTimeout, b.id, strings.Join(unrecovered, "; "))
+				return
+			}
+			s.event("partitions recovered")
+		}
+	}
+}
+
+func (s *soaker) createTopic(timeout time.Duration) error {
+	var lastErr error
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); time.Sleep(500 * time.Millisecond) {
+		conn, err := jocko.Dial("tcp", s.cluster.brokers[0].addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		res, err := conn.CreateTopics(&protocol.CreateTopicRequests{
+			Timeout: 10 * time.Second,
+			Requests: []*protocol.CreateTopicRequest{{
+				Topic:             topic,
+				NumPartitions:     soakCfg.Partitions,
+				ReplicationFactor: int16(soakCfg.ReplicationFactor),
+			}},
+		})
+		conn.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		code := res.TopicErrorCodes[0].ErrorCode
+		if code == protocol.ErrNone.Code() || code == protocol.ErrTopicAlreadyExists.Code() {
+			return nil
+		}
+		lastErr = protocol.Errs[code]
+	}
+	return fmt.Errorf("creating topic: %v", lastErr)
+}
+
+// waitRecovered waits for the topic's partitions to have running leaders and full ISRs, returning
+// what's wrong with the ones that don't by the timeout.
+func (s *soaker) waitRecovered(timeout time.Duration) []string {
+	var unrecovered []string
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); time.Sleep(200 * time.Millisecond) {
+		res, err := s.metadata()
+		if err != nil {
+			unrecovered = []string{err.Error()}
+			continue
+		}
+		unrecovered = s.unrecovered(res)
+		if len(unrecovered) == 0 {
+			return nil
+		}
+	}
+	return unrecovered
+}
+
+func (s *soaker) unrecovered(res *protocol.MetadataResponse) []string {
+	running := make(map[int32]bool)
+	for _, b := range s.cluster.brokers {
+		running[b.id] = b.running()
+	}
+	var unrecovered []string
+	for _, t := range res.TopicMetadata {
+		if t.Topic != topic {
+			continue
+		}
+		if t.TopicErrorCode != protocol.ErrNone.Code() {
+			return []string{fmt.Sprintf("topic error: %s", protocol.Errs[t.TopicErrorCode])}
+		}
+		if len(t.PartitionMetadata) != int(soakCfg.Partitions) {
+			return []string{fmt.Sprintf("%d of %d partitions", len(t.PartitionMetadata), soakCfg.Partitions)}
+		}
+		for _, p := range t.PartitionMetadata {
+			switch {
+			case !running[p.Leader]:
+				unrecovered = append(unrecovered, fmt.Sprintf("partition %d: leader %d isn't running", p.PartitionID, p.Leader))
+			case len(p.ISR) < soakCfg.ReplicationFactor:
+				unrecovered = append(unrecovered, fmt.Sprintf("partition %d: isr %v of replicas %v", p.PartitionID, p.ISR, p.Replicas))
+			}
+		}
+		sort.Strings(unrecovered)
+		return unrecovered
+	}
+	return []string{fmt.Sprintf("topic %s missing", topic)}
+}
+
+// metadata returns the topic's metadata from one of the running brokers.
+func (s *soaker) metadata() (*protocol.MetadataResponse, error) {
+	var lastErr error = client.ErrNoBrokers
+	for _, addr := range s.cluster.addrs() {
+		conn, err := jocko.Dial("tcp", addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		res, err := conn.Metadata(&protocol.MetadataRequest{APIVersion: 1, Topics: []string{topic}})
+		conn.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return res, nil
+	}
+	return nil, lastErr
+}
+
+// produce produces records to the partition until the soak's stopping, recording the ones acked.
+func (s *soaker) produce(producer *client.Producer, partition int32) {
+	defer s.producers.Done()
+	for seq := 0; ; seq++ {
+		select {
+		case <-s.stopping:
+			return
+		default:
+		}
+		value := fmt.Sprintf("%d-%d", partition, seq)
+		offset, err := producer.Produce(topic, partition, &protocol.Message{Value: []byte(value)})
+		if err != nil {
+			atomic.AddInt64(&s.produceErrors, 1)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		s.ledger.ack(partition, offset, value)
+		time.Sleep(soakCfg.ProduceInterval)
+	}
+}
+
+// consume consumes the partitions until stopped, recording what's read. Partitions whose fetches
+// fail are reassigned from where they were read up to.
+func (s *soaker) consume(consumer *client.Consumer, stop chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		records, err := consumer.Poll(time.Second)
+		for _, r := range records {
+			s.ledger.consume(r.Partition, r.Offset, string(r.Value))
+		}
+		if err == nil {
+			continue
+		}
+		ferr, ok := err.(*client.FetchError)
+		if !ok {
+			s.event("poll error: %v", err)
+			return
+		}
+		atomic.AddInt64(&s.fetchErrors, 1)
+		if ferr.Err == protocol.ErrOffsetOutOfRange {
+			s.ledger.violation(invariantMonotonic, ferr.Partition, "fetching offset %d was out of range, the log end moved back below it", ferr.Offset)
+		}
+		time.Sleep(100 * time.Millisecond)
+		if err := consumer.Assign(topic, ferr.Partition, s.ledger.next(ferr.Partition)); err != nil {
+			s.event("reassign error: %v", err)
+			return
+		}
+	}
+}
+
+// diagnostics is the report dumped when the soak fails.
+type diagnostics struct {
+	Seed       int64                     `json:"seed"`
+	Started    time.Time                 `json:"started"`
+	Elapsed    string                    `json:"elapsed"`
+	Restarts   int                       `json:"restarts"`
+	Error      string                    `json:"error,omitempty"`
+	Violations []Violation               `json:"violations"`
+	Events     []string                  `json:"events"`
+	Metadata   map[int32]json.RawMessage `json:"metadata"`
+}
+
+// dumpDiagnostics writes the report, with each running broker's view of the cluster's metadata,
+// to the work dir and returns its path.
+func (s *soaker) dumpDiagnostics(dir string, err error, violations []Violation) (string, error) {
+	d := diagnostics{
+		Seed:       soakCfg.Seed,
+		Started:    s.started,
+		Elapsed:    time.Since(s.started).String(),
+		Restarts:   s.restarts,
+		Violations: violations,
+		Metadata:   make(map[int32]json.RawMessage),
+	}
+	if err != nil {
+		d.Error = err.Error()
+	}
+	s.mu.Lock()
+	d.Events = append(d.Events, s.events...)
+	s.mu.Unlock()
+	for _, b := range s.cluster.brokers {
+		var v interface{}
+		if conn, err := jocko.Dial("tcp", b.addr); err != nil {
+			v = err.Error()
+		} else {
+			if res, err := conn.Metadata(&protocol.MetadataRequest{APIVersion: 1}); err != nil {
+				v = err.Error()
+			} else {
+				v = res
+			}
+			conn.Close()
+		}
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		d.Metadata[b.id] = raw
+	}
+	b, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "diagnostics.json")
+	return path, ioutil.WriteFile(path, b, 0644)
+}
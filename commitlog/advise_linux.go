@@ -0,0 +1,21 @@
+//go:build linux
+// +build linux
+
+package commitlog
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	adviseSequential = unix.FADV_SEQUENTIAL
+	adviseWillNeed   = unix.FADV_WILLNEED
+	adviseDontNeed   = unix.FADV_DONTNEED
+)
+
+// fadvise hints to the kernel how the file from off to the end will be accessed.
+func fadvise(f *os.File, off int64, advice int) error {
+	return unix.Fadvise(int(f.Fd()), off, 0, advice)
+}
@@ -0,0 +1,69 @@
+//go:build linux
+// +build linux
+
+package commitlog
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSegmentEvictionDropsPageCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "commitlog-advise")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s, err := NewSegment(dir, 0, 1<<30)
+	require.NoError(t, err)
+	defer s.Close()
+	files := NewFileCache(1)
+	s.SetFileCache(files)
+	for i := 0; i < 256; i++ {
+		_, err := s.Write(NewMessageSet(uint64(i), NewMessage(make([]byte, 4096))))
+		require.NoError(t, err)
+	}
+	// only clean pages are dropped.
+	s.Lock()
+	require.NoError(t, s.log.Sync())
+	s.Unlock()
+	_, err = io.Copy(ioutil.Discard, io.NewSectionReader(s, 0, s.Position))
+	require.NoError(t, err)
+
+	resident := func() int {
+		f, err := os.Open(s.logPath())
+		require.NoError(t, err)
+		defer f.Close()
+		fi, err := f.Stat()
+		require.NoError(t, err)
+		m, err := syscall.Mmap(int(f.Fd()), 0, int(fi.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+		require.NoError(t, err)
+		defer syscall.Munmap(m)
+		pages := make([]byte, (len(m)+os.Getpagesize()-1)/os.Getpagesize())
+		_, _, errno := syscall.Syscall(syscall.SYS_MINCORE, uintptr(unsafe.Pointer(&m[0])), uintptr(len(m)), uintptr(unsafe.Pointer(&pages[0])))
+		require.Zero(t, errno)
+		var n int
+		for _, p := range pages {
+			n += int(p & 1)
+		}
+		return n
+	}
+	if resident() == 0 {
+		t.Skip("the log isn't in the page cache")
+	}
+
+	// the file cache evicting the segment drops its log's pages.
+	other, err := NewSegment(dir, 1<<30, 1<<30)
+	require.NoError(t, err)
+	defer other.Close()
+	other.SetFileCache(files)
+	s.Lock()
+	require.Nil(t, s.log)
+	s.Unlock()
+	require.Equal(t, 0, resident())
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package commitlog
+
+import "os"
+
+const (
+	adviseSequential = iota
+	adviseWillNeed
+	adviseDontNeed
+)
+
+// fadvise is a no-op on platforms without posix_fadvise.
+func fadvise(f *os.File, off int64, advice int) error {
+	return nil
+}
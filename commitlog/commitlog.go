@@ -9,20 +9,24 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/pkg/errors"
+	"github.com/travisjeffery/jocko/clock"
 )
 
 var (
 	ErrSegmentNotFound = errors.New("segment not found")
+	ErrSegmentClosed   = errors.New("segment closed")
 	Encoding           = binary.BigEndian
 )
 
 type CleanupPolicy string
 
 const (
-	DeleteCleanupPolicy  = "delete"
-	CompactCleanupPolicy = "compact"
+	DeleteCleanupPolicy        = "delete"
+	CompactCleanupPolicy       = "compact"
+	CompactDeleteCleanupPolicy = "compact,delete"
 
 	LogFileSuffix   = ".log"
 	IndexFileSuffix = ".index"
@@ -35,6 +39,10 @@ type CommitLog struct {
 	mu             sync.RWMutex
 	segments       []*Segment
 	vActiveSegment atomic.Value
+	// txnMu guards ongoing, the first offsets of the transactions appended to the log that
+	// aren't yet committed or aborted, keyed by their producer IDs.
+	txnMu   sync.Mutex
+	ongoing map[int64]int64
 }
 
 type Options struct {
@@ -43,7 +51,16 @@ type Options struct {
 	// new segment will be split off.
 	MaxSegmentBytes int64
 	MaxLogBytes     int64
-	CleanupPolicy   CleanupPolicy
+	// MaxLogAge is how long segments are kept after their latest record's timestamp under the
+	// delete and compact,delete cleanup policies. Zero keeps them regardless of age.
+	MaxLogAge     time.Duration
+	CleanupPolicy CleanupPolicy
+	// FileCache, if set, limits the number of segment log files kept open and may be shared
+	// across commit logs.
+	FileCache *FileCache
+	// Clock, if set, is what the cleaners measure segments' ages against rather than the real
+	// clock, e.g. a simulated clock in tests.
+	Clock clock.Clock
 }
 
 func New(opts Options) (*CommitLog, error) {
@@ -60,10 +77,28 @@ func New(opts Options) (*CommitLog, error) {
 	}
 
 	var cleaner Cleaner
-	if opts.CleanupPolicy == DeleteCleanupPolicy {
-		cleaner = NewDeleteCleaner(opts.MaxLogBytes)
-	} else {
-		cleaner = NewCompactCleaner()
+	switch opts.CleanupPolicy {
+	case DeleteCleanupPolicy:
+		c := NewDeleteCleaner(opts.MaxLogBytes)
+		c.Retention.Age = opts.MaxLogAge
+		if opts.Clock != nil {
+			c.Clock = opts.Clock
+		}
+		cleaner = c
+	case CompactDeleteCleanupPolicy, "delete,compact":
+		c := NewCompactDeleteCleaner(opts.MaxLogBytes)
+		c.Retention.Age = opts.MaxLogAge
+		if opts.Clock != nil {
+			c.DeleteCleaner.Clock = opts.Clock
+			c.CompactCleaner.Clock = opts.Clock
+		}
+		cleaner = c
+	default:
+		c := NewCompactCleaner()
+		if opts.Clock != nil {
+			c.Clock = opts.Clock
+		}
+		cleaner = c
 	}
 
 	path, _ := filepath.Abs(opts.Path)
@@ -100,16 +135,29 @@ func (l *CommitLog) open() error {
 	for _, file := range files {
 		// if this file is an index file, make sure it has a corresponding .log file
 		if strings.HasSuffix(file.Name(), IndexFileSuffix) {
-			_, err := os.Stat(filepath.Join(l.Path, strings.Replace(file.Name(), IndexFileSuffix, LogFileSuffix, 1)))
+			logPath := filepath.Join(l.Path, strings.Replace(file.Name(), IndexFileSuffix, LogFileSuffix, 1))
+			_, err := os.Stat(logPath)
+			if os.IsNotExist(err) {
+				_, err = os.Stat(logPath + compressedSuffix)
+			}
 			if os.IsNotExist(err) {
-				if err := os.Remove(file.Name()); err != nil {
+				if err := os.Remove(filepath.Join(l.Path, file.Name())); err != nil {
 					return err
 				}
 			} else if err != nil {
 				return errors.Wrap(err, "stat file failed")
 			}
-		} else if strings.HasSuffix(file.Name(), LogFileSuffix) {
-			offsetStr := strings.TrimSuffix(file.Name(), LogFileSuffix)
+		} else if strings.HasSuffix(file.Name(), LogFileSuffix+compressedSuffix+tmpSuffix) {
+			// the segment's compression was interrupted, its log's still there.
+			if err := os.Remove(filepath.Join(l.Path, file.Name())); err != nil {
+				return err
+			}
+		} else if strings.HasSuffix(file.Name(), LogFileSuffix) || strings.HasSuffix(file.Name(), LogFileSuffix+compressedSuffix) {
+			if _, err := os.Stat(filepath.Join(l.Path, file.Name()+compressedSuffix)); err == nil {
+				// the segment was compressed, it's opened from its compressed log.
+				continue
+			}
+			offsetStr := strings.TrimSuffix(strings.TrimSuffix(file.Name(), compressedSuffix), LogFileSuffix)
 			baseOffset, err := strconv.Atoi(offsetStr)
 			if err != nil {
 				return err
@@ -118,6 +166,7 @@ func (l *CommitLog) open() error {
 			if err != nil {
 				return err
 			}
+			segment.SetFileCache(l.FileCache)
 			l.segments = append(l.segments, segment)
 		}
 	}
@@ -126,32 +175,54 @@ func (l *CommitLog) open() error {
 		if err != nil {
 			return err
 		}
+		segment.SetFileCache(l.FileCache)
 		l.segments = append(l.segments, segment)
 	}
 	l.vActiveSegment.Store(l.segments[len(l.segments)-1])
-	return nil
+	return l.loadTransactions()
 }
 
+// Append appends the message set, or record batches, to the log and returns the offset assigned to
+// its first record. Each record batch is assigned the offsets of its records and indexed by its
+// base offset.
 func (l *CommitLog) Append(b []byte) (offset int64, err error) {
-	ms := MessageSet(b)
 	if l.checkSplit() {
 		if err := l.split(); err != nil {
 			return offset, err
 		}
 	}
-	position := l.activeSegment().Position
-	offset = l.activeSegment().NextOffset
-	ms.PutOffset(offset)
-	if _, err := l.activeSegment().Write(ms); err != nil {
-		return offset, err
-	}
-	e := Entry{
-		Offset:   offset,
-		Position: position,
+	segment := l.activeSegment()
+	offset = segment.NextOffset
+	// the sets are given their offsets and written together, with one writev.
+	var sets []MessageSet
+	var entries []Entry
+	next, position := segment.NextOffset, segment.Position
+	for len(b) > 0 {
+		ms := MessageSet(b)
+		if size := int(ms.Size()); ms.IsRecordBatch() && size >= recordBatchHeaderLen && size < len(b) {
+			ms = ms[:size]
+		}
+		b = b[len(ms):]
+		ms.PutOffset(next)
+		sets = append(sets, ms)
+		entries = append(entries, Entry{
+			Offset:   next,
+			Position: position,
+		})
+		next += ms.offsets()
+		position += int64(len(ms))
 	}
-	if err := l.activeSegment().Index.WriteEntry(e); err != nil {
+	if _, err := segment.writeSets(sets); err != nil {
 		return offset, err
 	}
+	for i, e := range entries {
+		if err := segment.Index.WriteEntry(e); err != nil {
+			return offset, err
+		}
+		if err := l.trackTransaction(segment, sets[i]); err != nil {
+			return offset, err
+		}
+	}
 	return offset, nil
 }
 
@@ -171,6 +242,132 @@ func (l *CommitLog) OldestOffset() int64 {
 	return l.segments[0].BaseOffset
 }
 
+// Size returns the number of bytes in the log's segments.
+func (l *CommitLog) Size() int64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return segmentsSize(l.segments)
+}
+
+func segmentsSize(segments []*Segment) int64 {
+	var size int64
+	for _, segment := range segments {
+		segment.Lock()
+		size += segment.Position
+		segment.Unlock()
+	}
+	return size
+}
+
+// Retention returns the bytes and age the log's segments are retained by. They only apply under
+// the delete and compact,delete cleanup policies.
+func (l *CommitLog) Retention() (bytes int64, age time.Duration) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.MaxLogBytes, l.MaxLogAge
+}
+
+// SetRetention changes the bytes and age the log's segments are retained by, taking effect the
+// next time the log's cleaned.
+func (l *CommitLog) SetRetention(bytes int64, age time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.MaxLogBytes, l.MaxLogAge = bytes, age
+	if c := l.deleteCleaner(); c != nil {
+		c.Retention.Bytes, c.Retention.Age = bytes, age
+	}
+}
+
+// EnforceRetention deletes the segments past the log's retention now rather than waiting for the
+// active segment to split, returning the bytes reclaimed. Logs that aren't cleaned by retention
+// are left alone.
+func (l *CommitLog) EnforceRetention() (int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c := l.deleteCleaner()
+	if c == nil {
+		return 0, nil
+	}
+	before := segmentsSize(l.segments)
+	segments, err := c.Clean(l.segments)
+	if err != nil {
+		return 0, err
+	}
+	l.segments = segments
+	return before - segmentsSize(segments), nil
+}
+
+// Compact compacts the log's sealed segments now rather than waiting for the active segment to
+// split, returning the bytes reclaimed. Logs that aren't compacted are left alone.
+func (l *CommitLog) Compact() (int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c := l.compactCleaner()
+	if c == nil {
+		return 0, nil
+	}
+	before := segmentsSize(l.segments)
+	segments, err := c.Clean(l.segments)
+	if err != nil {
+		return 0, err
+	}
+	l.segments = segments
+	return before - segmentsSize(segments), nil
+}
+
+// CleanerStats returns the stats of the log's last compaction since it was opened, and false if
+// its cleanup policy doesn't compact it.
+func (l *CommitLog) CleanerStats() (CleanerStats, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	c := l.compactCleaner()
+	if c == nil {
+		return CleanerStats{}, false
+	}
+	return c.Stats(), true
+}
+
+// CompressSegments recompresses the log's sealed segments at rest that aren't already, returning
+// the bytes saved. Reads from the compressed segments decompress the chunks they span.
+func (l *CommitLog) CompressSegments() (int64, error) {
+	l.mu.RLock()
+	segments := l.segments[:len(l.segments)-1]
+	l.mu.RUnlock()
+	var saved int64
+	for _, s := range segments {
+		n, err := s.Compress()
+		saved += n
+		if err != nil {
+			return saved, err
+		}
+	}
+	return saved, nil
+}
+
+// deleteCleaner returns the cleaner enforcing the log's retention, or nil if its cleanup policy
+// doesn't delete segments.
+func (l *CommitLog) deleteCleaner() *DeleteCleaner {
+	switch c := l.cleaner.(type) {
+	case *DeleteCleaner:
+		return c
+	case *CompactDeleteCleaner:
+		return c.DeleteCleaner
+	}
+	return nil
+}
+
+// compactCleaner returns the cleaner compacting the log, or nil if its cleanup policy doesn't
+// compact it.
+func (l *CommitLog) compactCleaner() *CompactCleaner {
+	switch c := l.cleaner.(type) {
+	case *CompactCleaner:
+		return c
+	case *CompactDeleteCleaner:
+		return c.CompactCleaner
+	}
+	return nil
+}
+
 func (l *CommitLog) activeSegment() *Segment {
 	return l.vActiveSegment.Load().(*Segment)
 }
@@ -186,11 +383,20 @@ func (l *CommitLog) Close() error {
 	return nil
 }
 
+// Delete closes the log and removes its dir. The dir's renamed first so a deletion interrupted
+// by a crash doesn't leave a partial log to be opened.
 func (l *CommitLog) Delete() error {
 	if err := l.Close(); err != nil {
 		return err
 	}
-	return os.RemoveAll(l.Path)
+	deleted := filepath.Clean(l.Path) + DeletedDirSuffix
+	if err := os.RemoveAll(deleted); err != nil {
+		return err
+	}
+	if err := os.Rename(l.Path, deleted); err != nil {
+		return err
+	}
+	return os.RemoveAll(deleted)
 }
 
 func (l *CommitLog) Truncate(offset int64) error {
@@ -210,6 +416,24 @@ func (l *CommitLog) Truncate(offset int64) error {
 	return nil
 }
 
+// DeleteBefore deletes the sealed segments whose records are all before the offset, returning the
+// bytes reclaimed. The active segment's kept.
+func (l *CommitLog) DeleteBefore(offset int64) (int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var reclaimed int64
+	for len(l.segments) > 1 && l.segments[1].BaseOffset <= offset {
+		s := l.segments[0]
+		size := segmentsSize(l.segments[:1])
+		if err := s.Delete(); err != nil {
+			return reclaimed, err
+		}
+		reclaimed += size
+		l.segments = l.segments[1:]
+	}
+	return reclaimed, nil
+}
+
 func (l *CommitLog) Segments() []*Segment {
 	l.mu.Lock()
 	defer l.mu.Unlock()
@@ -225,6 +449,7 @@ func (l *CommitLog) split() error {
 	if err != nil {
 		return err
 	}
+	segment.SetFileCache(l.FileCache)
 	l.mu.Lock()
 	segments := append(l.segments, segment)
 	segments, err = l.cleaner.Clean(segments)
@@ -5,9 +5,11 @@ import (
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"github.com/travisjeffery/jocko/commitlog"
+	"github.com/travisjeffery/jocko/protocol"
 )
 
 var (
@@ -130,6 +132,87 @@ func TestCleaner(t *testing.T) {
 	}
 }
 
+func TestRecordBatches(t *testing.T) {
+	req := require.New(t)
+	opts := commitlog.Options{MaxSegmentBytes: 1024, MaxLogBytes: -1}
+	l := setupWithOptions(t, opts)
+	defer cleanup(t, l)
+
+	batch := func(values ...string) []byte {
+		b := &protocol.RecordBatch{LastOffsetDelta: int32(len(values) - 1)}
+		for i, v := range values {
+			b.Records = append(b.Records, &protocol.Record{OffsetDelta: int64(i), Key: []byte(v), Value: []byte(v)})
+		}
+		set, err := protocol.Encode(b)
+		req.NoError(err)
+		return set
+	}
+	first, second := batch("a", "b", "c"), batch("d", "e")
+	offset, err := l.Append(append(append([]byte{}, first...), second...))
+	req.NoError(err)
+	req.Equal(int64(0), offset)
+	offset, err = l.Append(msgSets[0])
+	req.NoError(err)
+	req.Equal(int64(5), offset)
+	req.Equal(int64(6), l.NewestOffset())
+
+	read := func(offset int64) commitlog.MessageSet {
+		r, err := l.NewReader(offset, 1024)
+		req.NoError(err)
+		p, err := ioutil.ReadAll(r)
+		req.NoError(err)
+		ms := commitlog.MessageSet(p)
+		return ms[:ms.Size()]
+	}
+	for _, test := range []struct {
+		offset, base, last int64
+	}{{0, 0, 2}, {2, 0, 2}, {3, 3, 4}, {4, 3, 4}, {5, 5, 5}} {
+		ms := read(test.offset)
+		req.Equal(test.base, ms.Offset())
+		req.Equal(test.last, ms.LastOffset())
+	}
+	keys, ok := read(3).Keys()
+	req.True(ok)
+	req.Equal([][]byte{[]byte("d"), []byte("e")}, keys)
+
+	// the reopened log's index is rebuilt from the batches' offsets.
+	req.NoError(l.Close())
+	opts.Path = l.Path
+	l = setupWithOptions(t, opts)
+	req.Equal(int64(6), l.NewestOffset())
+	req.Equal(int64(3), read(4).Offset())
+}
+
+func TestEnforceRetention(t *testing.T) {
+	l := setupWithOptions(t, commitlog.Options{MaxSegmentBytes: 6, MaxLogBytes: -1})
+	defer cleanup(t, l)
+
+	for i := 0; i < 4; i++ {
+		_, err := l.Append(msgSets[0])
+		require.NoError(t, err)
+	}
+	segments := len(l.Segments())
+	size := l.Size()
+	reclaimed, err := l.EnforceRetention()
+	require.NoError(t, err)
+	require.Equal(t, int64(0), reclaimed)
+
+	// lowering the retention doesn't delete anything until it's enforced.
+	setSize := int64(len(msgSets[0]))
+	l.SetRetention(setSize, 0)
+	bytes, age := l.Retention()
+	require.Equal(t, setSize, bytes)
+	require.Equal(t, time.Duration(0), age)
+	require.Equal(t, segments, len(l.Segments()))
+
+	reclaimed, err = l.EnforceRetention()
+	require.NoError(t, err)
+	require.True(t, reclaimed > 0)
+	require.Equal(t, size-reclaimed, l.Size())
+	require.True(t, l.Size() <= setSize)
+	require.True(t, len(l.Segments()) < segments)
+}
+
 func check(t require.TestingT, got, want []byte) {
 	if !bytes.Equal(got, want) {
 		t.Errorf("got = %s, want %s", string(got), string(want))
@@ -1,20 +1,54 @@
 package commitlog
 
 import (
+	"time"
+
 	"github.com/cespare/xxhash"
+	"github.com/travisjeffery/jocko/clock"
 )
 
+// DefaultCleanerBufferKeys is the number of keys the compact cleaner maps per compaction by
+// default.
+const DefaultCleanerBufferKeys = 1 << 20
+
 type CompactCleaner struct {
+	// BufferKeys is the number of keys mapped per compaction. Once it's filled the segments past
+	// the last mapped one are left for the next compaction.
+	BufferKeys int
+	// Clock is what compactions are timed with.
+	Clock clock.Clock
+
 	// map from key hash to offset
-	m map[uint64]int64
+	m     map[uint64]int64
+	stats CleanerStats
+}
+
+// CleanerStats are the stats of a log's last compaction.
+type CleanerStats struct {
+	// BufferUtilization is the fraction of the cleaner's key buffer the compaction filled.
+	BufferUtilization float64
+	// DirtyRatio is the fraction of the compacted segments' bytes that were superseded records.
+	DirtyRatio float64
+	// CleanedBytes is the bytes of the segments compacted and Duration how long it took.
+	CleanedBytes int64
+	Duration     time.Duration
+	// LastClean is when the compaction finished, zero if the log hasn't been compacted.
+	LastClean time.Time
 }
 
 func NewCompactCleaner() *CompactCleaner {
 	return &CompactCleaner{
-		m: make(map[uint64]int64),
+		BufferKeys: DefaultCleanerBufferKeys,
+		Clock:      clock.New(),
+		m:          make(map[uint64]int64),
 	}
 }
 
+// Stats returns the stats of the cleaner's last compaction.
+func (c *CompactCleaner) Stats() CleanerStats {
+	return c.stats
+}
+
 func (c *CompactCleaner) Clean(segments []*Segment) (cleaned []*Segment, err error) {
 	if len(segments) == 0 {
 		return segments, nil
@@ -23,21 +57,41 @@ func (c *CompactCleaner) Clean(segments []*Segment) (cleaned []*Segment, err err
 	var ss *SegmentScanner
 	var ms MessageSet
 	var offset int64
+	bufferKeys := c.BufferKeys
+	if bufferKeys <= 0 {
+		bufferKeys = DefaultCleanerBufferKeys
+	}
+	start := c.Clock.Now()
+	// the previous compaction's keys may have been deleted since.
+	c.m = make(map[uint64]int64)
 
-	// build the map of keys to their latest offsets
+	// build the map of keys to their latest offsets, up to the buffer's size. The records of the
+	// mapped segments superseded in later, unmapped, ones are kept until they're mapped together.
+	var mapped int
 	for _, segment := range segments {
 		ss = NewSegmentScanner(segment)
 
 		for ms, err = ss.Scan(); err == nil; ms, err = ss.Scan() {
 			offset = ms.Offset()
-			for _, msg := range ms.Messages() {
-				c.m[Hash(msg.Key())] = offset
+			keys, _ := ms.Keys()
+			for _, key := range keys {
+				c.m[Hash(key)] = offset
 			}
 		}
+		mapped++
+		if len(c.m) >= bufferKeys {
+			break
+		}
 	}
 
 	// TODO: handle joining segments when they're smaller than max segment size
-	for _, ds := range segments {
+	// the active segment is still being appended to so isn't compacted.
+	if mapped == len(segments) {
+		mapped--
+	}
+	dirty, rest := segments[:mapped], segments[mapped:]
+	before := segmentsSize(dirty)
+	for _, ds := range dirty {
 		ss = NewSegmentScanner(ds)
 
 		cs, err := NewSegment(ds.path, ds.BaseOffset, ds.maxBytes, cleanedSuffix)
@@ -46,20 +100,28 @@ func (c *CompactCleaner) Clean(segments []*Segment) (cleaned []*Segment, err err
 		}
 
 		for ms, err = ss.Scan(); err == nil; ms, err = ss.Scan() {
-			var retain bool
 			offset = ms.Offset()
-			for _, msg := range ms.Messages() {
-				if c.m[Hash(msg.Key())] <= offset {
+			// a compressed record batch's keys aren't known so it's kept whole.
+			keys, ok := ms.Keys()
+			retain := !ok
+			for _, key := range keys {
+				if c.m[Hash(key)] <= offset {
 					retain = true
 				}
 			}
 
 			if retain {
+				position := cs.Position
 				if _, err = cs.Write(ms); err != nil {
 					return nil, err
 				}
+				if err = cs.Index.WriteEntry(Entry{Offset: offset, Position: position}); err != nil {
+					return nil, err
+				}
 			}
 		}
+		// the offsets compacted away aren't reused.
+		cs.NextOffset = ds.NextOffset
 
 		if err = cs.Replace(ds); err != nil {
 			return nil, err
@@ -68,7 +130,21 @@ func (c *CompactCleaner) Clean(segments []*Segment) (cleaned []*Segment, err err
 		cleaned = append(cleaned, cs)
 	}
 
-	return cleaned, nil
+	if len(dirty) > 0 {
+		c.stats = CleanerStats{
+			BufferUtilization: float64(len(c.m)) / float64(bufferKeys),
+			CleanedBytes:      before,
+			LastClean:         c.Clock.Now(),
+		}
+		c.stats.Duration = c.stats.LastClean.Sub(start)
+		if c.stats.BufferUtilization > 1 {
+			c.stats.BufferUtilization = 1
+		}
+		if before > 0 {
+			c.stats.DirtyRatio = float64(before-segmentsSize(cleaned)) / float64(before)
+		}
+	}
+	return append(cleaned, rest...), nil
 }
 
 func Hash(b []byte) uint64 {
@@ -88,6 +88,7 @@ func TestCompactCleaner(t *testing.T) {
 	}
 	req.Equal(1, count)
 
+	// the active segment isn't compacted.
 	scanner = commitlog.NewSegmentScanner(cleaned[1])
 	count = 0
 	for {
@@ -95,13 +96,67 @@ func TestCompactCleaner(t *testing.T) {
 		if err != nil {
 			break
 		}
-		req.Equal(1, len(ms.Messages()))
-		req.Equal([]byte("travisjeffery"), ms.Messages()[0].Key())
-		req.Equal([]byte("two tj"), ms.Messages()[0].Value())
+		req.Equal(msgSets[2+count], ms)
 		count++
 	}
-	req.Equal(1, count)
+	req.Equal(2, count)
+
+	stats := cc.Stats()
+	req.Equal(int64(len(msgSets[0])+len(msgSets[1])), stats.CleanedBytes)
+	req.InDelta(float64(len(msgSets[0]))/float64(stats.CleanedBytes), stats.DirtyRatio, 0.001)
+	req.Equal(float64(3)/commitlog.DefaultCleanerBufferKeys, stats.BufferUtilization)
+	req.False(stats.LastClean.IsZero())
+}
+
+func TestCommitLogCompact(t *testing.T) {
+	req := require.New(t)
+	set := func(key, value string) commitlog.MessageSet {
+		return newMessageSet(0, &protocol.Message{Key: []byte(key), Value: []byte(value)})
+	}
+	// the first two sets fill the first segment and are superseded by the last two in the active
+	// segment, which the split didn't see.
+	sets := []commitlog.MessageSet{set("a", "1"), set("b", "1"), set("a", "2"), set("b", "2")}
+	newLog := func() *commitlog.CommitLog {
+		l := setupWithOptions(t, commitlog.Options{
+			MaxSegmentBytes: int64(len(sets[0]) + len(sets[1])),
+			MaxLogBytes:     -1,
+			CleanupPolicy:   commitlog.CompactCleanupPolicy,
+		})
+		for _, ms := range sets {
+			_, err := l.Append(ms)
+			req.NoError(err)
+		}
+		return l
+	}
 
+	// a full buffer leaves the segments past the last mapped one for the next compaction.
+	l := newLog()
+	defer cleanup(t, l)
+	segments := l.Segments()
+	cc := commitlog.NewCompactCleaner()
+	cc.BufferKeys = 1
+	cleaned, err := cc.Clean(segments)
+	req.NoError(err)
+	req.Equal(len(segments), len(cleaned))
+	req.Equal(int64(len(sets[0])+len(sets[1])), cc.Stats().CleanedBytes)
+	req.Equal(float64(1), cc.Stats().BufferUtilization)
+	req.Equal(float64(0), cc.Stats().DirtyRatio)
+
+	// the log's compacted on demand rather than waiting for its next split.
+	l = newLog()
+	defer cleanup(t, l)
+	size := l.Size()
+	reclaimed, err := l.Compact()
+	req.NoError(err)
+	req.Equal(int64(len(sets[0])+len(sets[1])), reclaimed)
+	req.Equal(size-reclaimed, l.Size())
+	stats, ok := l.CleanerStats()
+	req.True(ok)
+	req.Equal(reclaimed, stats.CleanedBytes)
+	req.Equal(float64(1), stats.DirtyRatio)
+
+	_, ok = setup(t).CleanerStats()
+	req.False(ok)
 }
 
 func newMessageSet(offset uint64, pmsgs ...*protocol.Message) commitlog.MessageSet {
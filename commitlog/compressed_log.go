@@ -0,0 +1,165 @@
+package commitlog
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// compressedChunkSize is how much of a segment's log is compressed together, as one gzip member.
+// Reads decompress the chunks they span, so it bounds the memory a compressed segment holds.
+const compressedChunkSize = 64 << 10
+
+// compressedLog reads a sealed segment's log recompressed at rest. The log's compressed in chunks,
+// each its own gzip member so the file's still a gzip stream of the whole log, and a read only
+// decompresses the chunks it spans. The last chunk read is kept since reads are mostly sequential.
+type compressedLog struct {
+	f *os.File
+	// chunks are where each chunk starts, by its offset in the log.
+	chunks []compressedChunk
+	// size is the size of the decompressed log, end the size of the compressed file.
+	size, end int64
+	// chunk is the index of the chunk decompressed into buf, -1 if there isn't one.
+	chunk int
+	buf   []byte
+}
+
+type compressedChunk struct {
+	// pos is the chunk's position in the compressed file, off its offset in the log.
+	pos, off int64
+}
+
+// newCompressedLog opens the compressed log at the path and finds its chunks, decompressing each
+// in turn without keeping them.
+func newCompressedLog(path string) (*compressedLog, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "open file failed")
+	}
+	c := &compressedLog{f: f, chunk: -1}
+	if err := c.scan(); err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, "decompress failed")
+	}
+	return c, nil
+}
+
+func (c *compressedLog) scan() error {
+	// gzip reads through the counting reader without buffering it, since it's a byte reader, so
+	// the count's where each member ends.
+	r := &countingReader{r: bufio.NewReader(c.f)}
+	z, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	for {
+		z.Multistream(false)
+		n, err := io.Copy(ioutil.Discard, z)
+		if err != nil {
+			return err
+		}
+		c.chunks = append(c.chunks, compressedChunk{pos: c.end, off: c.size})
+		c.size += n
+		c.end = r.n
+		if err := z.Reset(r); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// ReadAt reads the decompressed log at the offset.
+func (c *compressedLog) ReadAt(p []byte, off int64) (n int, err error) {
+	for n < len(p) {
+		if off >= c.size {
+			return n, io.EOF
+		}
+		// the last chunk starting at or before the offset, chunks that are empty are skipped.
+		i := sort.Search(len(c.chunks), func(i int) bool { return c.chunks[i].off > off }) - 1
+		if err := c.load(i); err != nil {
+			return n, err
+		}
+		m := copy(p[n:], c.buf[off-c.chunks[i].off:])
+		n += m
+		off += int64(m)
+	}
+	return n, nil
+}
+
+// load decompresses the chunk into buf if it isn't already.
+func (c *compressedLog) load(i int) error {
+	if c.chunk == i {
+		return nil
+	}
+	c.chunk = -1
+	size, end := c.size-c.chunks[i].off, c.end
+	if i+1 < len(c.chunks) {
+		size, end = c.chunks[i+1].off-c.chunks[i].off, c.chunks[i+1].pos
+	}
+	z, err := gzip.NewReader(io.NewSectionReader(c.f, c.chunks[i].pos, end-c.chunks[i].pos))
+	if err != nil {
+		return errors.Wrap(err, "decompress failed")
+	}
+	if int64(cap(c.buf)) < size {
+		c.buf = make([]byte, size)
+	}
+	c.buf = c.buf[:size]
+	if _, err := io.ReadFull(z, c.buf); err != nil {
+		return errors.Wrap(err, "decompress failed")
+	}
+	c.chunk = i
+	return nil
+}
+
+// Close closes the compressed log's file and drops its decompressed chunk.
+func (c *compressedLog) Close() error {
+	c.buf = nil
+	c.chunk = -1
+	return c.f.Close()
+}
+
+// compressChunks writes the log to w compressed in chunks of compressedChunkSize.
+func compressChunks(w io.Writer, log io.Reader) error {
+	z, err := gzip.NewWriterLevel(w, gzip.BestCompression)
+	if err != nil {
+		return err
+	}
+	for {
+		n, err := io.CopyN(z, log, compressedChunkSize)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if err := z.Close(); err != nil {
+			return err
+		}
+		if n < compressedChunkSize {
+			return nil
+		}
+		z.Reset(w)
+	}
+}
+
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+func (r *countingReader) ReadByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err == nil {
+		r.n++
+	}
+	return b, err
+}
@@ -0,0 +1,73 @@
+package commitlog
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressedLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "commitlog-compressed")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s, err := NewSegment(dir, 0, 1<<20)
+	require.NoError(t, err)
+	files := NewFileCache(1)
+	s.SetFileCache(files)
+	var log []byte
+	for i := 0; len(log) < 3*compressedChunkSize; i++ {
+		value := make([]byte, 1000)
+		rand.Read(value[:500])
+		ms := NewMessageSet(uint64(i), NewMessage(value))
+		_, err := s.Write(ms)
+		require.NoError(t, err)
+		log = append(log, ms...)
+	}
+	_, err = s.Compress()
+	require.NoError(t, err)
+
+	// reads across the chunks only hold the chunk they end in.
+	p := make([]byte, compressedChunkSize)
+	off := int64(compressedChunkSize + compressedChunkSize/2)
+	_, err = s.ReadAt(p, off)
+	require.NoError(t, err)
+	require.Equal(t, log[off:off+int64(len(p))], p)
+	s.Lock()
+	require.True(t, len(s.clog.chunks) > 3)
+	require.True(t, cap(s.clog.buf) <= compressedChunkSize)
+	s.Unlock()
+	r := io.NewSectionReader(s, 0, int64(len(log)))
+	all, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(log, all))
+
+	// it's released once the file cache evicts the segment, and when the segment's closed.
+	other, err := NewSegment(dir, 1<<30, 1<<20)
+	require.NoError(t, err)
+	defer other.Close()
+	other.SetFileCache(files)
+	s.Lock()
+	require.Nil(t, s.clog)
+	require.Nil(t, s.data)
+	s.Unlock()
+	_, err = s.ReadAt(p, 0)
+	require.NoError(t, err)
+	require.Equal(t, log[:len(p)], p)
+	require.NoError(t, s.Close())
+	require.Nil(t, s.clog)
+	require.Nil(t, s.data)
+
+	// the reopened segment indexes the compressed log without holding it.
+	s, err = NewSegment(dir, 0, 1<<20)
+	require.NoError(t, err)
+	defer s.Close()
+	require.True(t, s.Compressed())
+	require.Equal(t, int64(len(log)), s.Position)
+	require.True(t, cap(s.clog.buf) <= compressedChunkSize)
+}
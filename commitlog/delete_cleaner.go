@@ -1,5 +1,11 @@
 package commitlog
 
+import (
+	"time"
+
+	"github.com/travisjeffery/jocko/clock"
+)
+
 type Cleaner interface {
 	Clean([]*Segment) ([]*Segment, error)
 }
@@ -10,16 +16,25 @@ type Cleaner interface {
 type DeleteCleaner struct {
 	Retention struct {
 		Bytes int64
+		// Age is how long segments are kept after their latest record's timestamp. Zero or
+		// less keeps them regardless of age.
+		Age time.Duration
 	}
+	// Clock is what segments' ages are measured against.
+	Clock clock.Clock
 }
 
 func NewDeleteCleaner(bytes int64) *DeleteCleaner {
-	c := &DeleteCleaner{}
+	c := &DeleteCleaner{Clock: clock.New()}
 	c.Retention.Bytes = bytes
 	return c
 }
 
 func (c *DeleteCleaner) Clean(segments []*Segment) ([]*Segment, error) {
+	segments, err := c.cleanAge(segments)
+	if err != nil {
+		return nil, err
+	}
 	if len(segments) == 0 || c.Retention.Bytes == -1 {
 		return segments, nil
 	}
@@ -48,3 +63,47 @@ func (c *DeleteCleaner) Clean(segments []*Segment) ([]*Segment, error) {
 	}
 	return cleanedSegments, nil
 }
+
+// cleanAge deletes the segments, other than the active one, whose latest records are older than
+// the retention age. Segments are aged by their records' timestamps rather than their files'
+// modification times, which are reset by copying or restoring the log, so segments without
+// timestamps are kept.
+func (c *DeleteCleaner) cleanAge(segments []*Segment) ([]*Segment, error) {
+	if c.Retention.Age <= 0 {
+		return segments, nil
+	}
+	cutoff := c.Clock.Now().Add(-c.Retention.Age).UnixNano() / int64(time.Millisecond)
+	var i int
+	for ; i < len(segments)-1; i++ {
+		ts := segments[i].MaxTimestamp()
+		if ts < 0 || ts > cutoff {
+			break
+		}
+		if err := segments[i].Delete(); err != nil {
+			return nil, err
+		}
+	}
+	return segments[i:], nil
+}
+
+// CompactDeleteCleaner implements the compact,delete cleanup policy, deleting segments past
+// retention then compacting the rest.
+type CompactDeleteCleaner struct {
+	*DeleteCleaner
+	*CompactCleaner
+}
+
+func NewCompactDeleteCleaner(bytes int64) *CompactDeleteCleaner {
+	return &CompactDeleteCleaner{
+		DeleteCleaner:  NewDeleteCleaner(bytes),
+		CompactCleaner: NewCompactCleaner(),
+	}
+}
+
+func (c *CompactDeleteCleaner) Clean(segments []*Segment) ([]*Segment, error) {
+	segments, err := c.DeleteCleaner.Clean(segments)
+	if err != nil {
+		return nil, err
+	}
+	return c.CompactCleaner.Clean(segments)
+}
@@ -1,12 +1,15 @@
 package commitlog_test
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/clock"
 	"github.com/travisjeffery/jocko/commitlog"
 	"github.com/travisjeffery/jocko/protocol"
 )
@@ -96,3 +99,102 @@ func TestDeleteCleaner(t *testing.T) {
 	req.Equal(2, count)
 
 }
+
+func TestCompactDeleteCleaner(t *testing.T) {
+	req := require.New(t)
+
+	// the first segment's records are past retention.
+	old := time.Now().Add(-2 * time.Hour)
+	var msgSets []commitlog.MessageSet
+	for i, key := range []string{"a", "b", "a", "c", "a", "d"} {
+		ts := time.Now()
+		if i < 2 {
+			ts = old
+		}
+		msgSets = append(msgSets, newMessageSet(uint64(i), &protocol.Message{
+			Key:       []byte(key),
+			Value:     []byte("value"),
+			MagicByte: 2,
+			Timestamp: ts,
+		}))
+	}
+
+	l := setupWithOptions(t, commitlog.Options{
+		MaxSegmentBytes: int64(len(msgSets[0]) + len(msgSets[1])),
+		MaxLogBytes:     -1,
+	})
+	defer cleanup(t, l)
+
+	for _, msgSet := range msgSets {
+		_, err := l.Append(msgSet)
+		req.NoError(err)
+	}
+	segments := l.Segments()
+	req.Equal(3, len(segments))
+
+	// segments are aged by their records' timestamps, not their files' modification times.
+	req.NoError(os.Chtimes(filepath.Join(l.Path, fmt.Sprintf("%020d%s", segments[1].BaseOffset, commitlog.LogFileSuffix)), old, old))
+
+	cc := commitlog.NewCompactDeleteCleaner(-1)
+	cc.Retention.Age = time.Hour
+	cleaned, err := cc.Clean(segments)
+	req.NoError(err)
+	req.Equal(2, len(cleaned))
+	req.Equal(int64(2), cleaned[0].BaseOffset)
+
+	var keys []string
+	for _, s := range cleaned {
+		scanner := commitlog.NewSegmentScanner(s)
+		for ms, err := scanner.Scan(); err == nil; ms, err = scanner.Scan() {
+			for _, m := range ms.Messages() {
+				keys = append(keys, string(m.Key()))
+			}
+		}
+	}
+	req.Equal([]string{"c", "a", "d"}, keys)
+}
+
+func TestDeleteCleanerAge(t *testing.T) {
+	req := require.New(t)
+
+	var msgSets []commitlog.MessageSet
+	for i := 0; i < 8; i++ {
+		msgSets = append(msgSets, newMessageSet(uint64(i), &protocol.Message{
+			Value:     []byte("value"),
+			MagicByte: 2,
+			Timestamp: time.Now(),
+		}))
+	}
+	// segments are aged against the simulated clock, which starts at the real time so the
+	// records' timestamps are current.
+	sim := clock.NewSim(time.Now())
+	l := setupWithOptions(t, commitlog.Options{
+		MaxSegmentBytes: int64(len(msgSets[0]) + len(msgSets[1])),
+		MaxLogBytes:     -1,
+		MaxLogAge:       time.Hour,
+		Clock:           sim,
+	})
+	defer cleanup(t, l)
+
+	appendSets := func(sets []commitlog.MessageSet) {
+		for _, msgSet := range sets {
+			_, err := l.Append(msgSet)
+			req.NoError(err)
+		}
+	}
+
+	// the segments are kept until they're past retention.
+	appendSets(msgSets[:4])
+	n := len(l.Segments())
+	req.True(n > 1)
+	sim.Advance(time.Hour - time.Minute)
+	appendSets(msgSets[4:6])
+	req.Equal(n+1, len(l.Segments()))
+	req.Equal(int64(0), l.OldestOffset())
+
+	// segments are cleaned when the log splits, keeping the active segment regardless of age.
+	sim.Advance(2 * time.Minute)
+	appendSets(msgSets[6:])
+	req.Equal(1, len(l.Segments()))
+	req.Equal(int64(6), l.OldestOffset())
+}
@@ -0,0 +1,34 @@
+// Package commitlog is the append only log of a partition's records.
+//
+// A log's stored as a dir of segments, each named by the offset of its first message set, its base
+// offset, zero padded to 20 digits. A segment has two files, and a third if it has aborted
+// transactions' markers:
+//
+//	<base offset>.log       the message sets, one after another as they were appended. A
+//	                        sealed segment recompressed at rest is <base offset>.log.gz instead,
+//	                        gzip members of 64KiB of the log each, decompressed as they're read.
+//	<base offset>.index     an entry per message set, each 8 bytes: the set's offset relative
+//	                        to the base offset and its byte position in the log, both big
+//	                        endian int32s. An open segment's index is preallocated and padded
+//	                        with zeros, it's truncated to its entries when it's closed.
+//	<base offset>.txnindex  an entry per transaction aborted by a marker in the segment, each
+//	                        24 bytes: the producer ID, the transaction's first offset and its
+//	                        abort marker's offset, big endian int64s. It's rebuilt when the
+//	                        log's opened.
+//
+// A message set starts with a 12 byte header, its int64 offset and int32 size, followed by size
+// bytes of either legacy messages or a record batch, told apart by the magic byte at position 16:
+//
+//	magic 0, 1  messages of a legacy message set: crc, magic, attributes, an int64 timestamp
+//	            from magic 1, and length prefixed key and value. The messages share the set's
+//	            offset and the crc is an IEEE CRC-32 of each message from its magic on.
+//	magic 2     a record batch: partition leader epoch, magic, a CRC-32C of the rest of the
+//	            batch, attributes, last offset delta, first and max timestamps, producer ID,
+//	            epoch and first sequence, and the records, compressed as a whole if the
+//	            attributes' codec is set. Its records take the offsets from the set's offset to
+//	            the set's offset plus the last offset delta.
+//
+// The broker assigns a set's offset when it's appended, which the CRCs don't cover. Compaction
+// removes sets, leaving gaps in the offsets, but offsets never decrease. Verify checks these
+// invariants, and Repair fixes what it can of the files a crash or disk failure leaves behind.
+package commitlog
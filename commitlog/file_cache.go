@@ -0,0 +1,81 @@
+package commitlog
+
+import (
+	"container/list"
+	"sync"
+)
+
+// FileCache bounds the number of segment log files held open. It's shared across commit logs so
+// brokers hosting many partitions stay within their file descriptor budget. The least recently
+// used segments have their log file closed and reopen it on their next read or write.
+type FileCache struct {
+	mu    sync.Mutex
+	max   int
+	ll    *list.List
+	items map[*Segment]*list.Element
+}
+
+// NewFileCache creates a file cache holding at most max segment log files open. A max of zero
+// means no limit.
+func NewFileCache(max int) *FileCache {
+	return &FileCache{
+		max:   max,
+		ll:    list.New(),
+		items: make(map[*Segment]*list.Element),
+	}
+}
+
+// Len returns the number of segments with an open log file tracked by the cache.
+func (c *FileCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// use marks the segment as most recently used and closes the log files of the least recently
+// used segments over the cap. Closed segments are ignored. It must be called without holding the
+// segment's lock.
+func (c *FileCache) use(s *Segment) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	s.Lock()
+	closed := s.closed
+	s.Unlock()
+	if closed {
+		c.mu.Unlock()
+		return
+	}
+	if e, ok := c.items[s]; ok {
+		c.ll.MoveToFront(e)
+	} else {
+		c.items[s] = c.ll.PushFront(s)
+	}
+	var evicted []*Segment
+	for c.max > 0 && c.ll.Len() > c.max {
+		e := c.ll.Back()
+		c.ll.Remove(e)
+		seg := e.Value.(*Segment)
+		delete(c.items, seg)
+		evicted = append(evicted, seg)
+	}
+	c.mu.Unlock()
+	// close outside the cache's lock so segments using the cache don't deadlock one another.
+	for _, seg := range evicted {
+		_ = seg.closeLog()
+	}
+}
+
+// remove stops tracking the segment, e.g. because it was closed.
+func (c *FileCache) remove(s *Segment) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[s]; ok {
+		c.ll.Remove(e)
+		delete(c.items, s)
+	}
+}
@@ -0,0 +1,47 @@
+package commitlog_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/commitlog"
+)
+
+func TestFileCache(t *testing.T) {
+	files := commitlog.NewFileCache(2)
+	l := setupWithOptions(t, commitlog.Options{
+		MaxSegmentBytes: 6,
+		MaxLogBytes:     -1,
+		FileCache:       files,
+	})
+	defer cleanup(t, l)
+
+	var sets []commitlog.MessageSet
+	for i := 0; i < 5; i++ {
+		ms := commitlog.NewMessageSet(uint64(i), msgs...)
+		sets = append(sets, ms)
+		_, err := l.Append(ms)
+		require.NoError(t, err)
+	}
+	require.Equal(t, 5, len(l.Segments()))
+	require.Equal(t, 2, files.Len())
+
+	// reading from the first segments reopens their files and closes others.
+	maxBytes := sets[0].Size()
+	r, err := l.NewReader(0, maxBytes)
+	require.NoError(t, err)
+	for i, exp := range sets {
+		p := make([]byte, maxBytes)
+		_, err = r.Read(p)
+		require.NoError(t, err)
+		act := commitlog.MessageSet(p)
+		require.Equal(t, exp, act)
+		require.Equal(t, int64(i), act.Offset())
+		require.True(t, files.Len() <= 2)
+	}
+
+	_, err = l.Append(commitlog.NewMessageSet(5, msgs...))
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+	require.Equal(t, 0, files.Len())
+}
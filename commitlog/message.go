@@ -66,7 +66,11 @@ func (m Message) keyOffsets() (start, end, size int32) {
 		start = 14
 	}
 	size = int32(Encoding.Uint32(m[start:]))
-	end = start + 4 + size
+	end = start + 4
+	// a null key's size is -1.
+	if size > 0 {
+		end += size
+	}
 	return
 }
 
@@ -74,6 +78,9 @@ func (m Message) valueOffsets() (start, end, size int32) {
 	_, keyEnd, _ := m.keyOffsets()
 	start = keyEnd
 	size = int32(Encoding.Uint32(m[start:]))
-	end = start + 4 + size
+	end = start + 4
+	if size > 0 {
+		end += size
+	}
 	return
 }
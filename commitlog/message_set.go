@@ -1,5 +1,7 @@
 package commitlog
 
+import "encoding/binary"
+
 const (
 	offsetPos       = 0
 	sizePos         = 8
@@ -37,16 +39,160 @@ func (ms MessageSet) Payload() []byte {
 }
 
 func (ms MessageSet) Messages() (msgs []Message) {
-	var offset int32
-	var msg Message
 	b := ms.Payload()
-	payloadSize := int32(len(b))
-	for offset < payloadSize {
-		msg = NewMessage(b)
-		offset = msg.Size()
-		msgs = append(msgs, NewMessage(b[:offset]))
-		b = b[offset:]
-		offset += offset
+	for len(b) > 0 {
+		size := NewMessage(b).Size()
+		msgs = append(msgs, NewMessage(b[:size]))
+		b = b[size:]
 	}
 	return msgs
 }
+
+const (
+	// a record batch's magic byte is at the same position as a legacy message set's first
+	// message's, which is how the formats are told apart.
+	magicPos             = 16
+	batchAttributesPos   = 21
+	lastOffsetDeltaPos   = 23
+	firstTimestampPos    = 27
+	maxTimestampPos      = 35
+	recordsCountPos      = 57
+	recordBatchHeaderLen = 61
+	recordBatchMagic     = 2
+	codecMask            = 0x07
+	timestampTypeMask    = 0x08
+)
+
+// IsRecordBatch returns whether the set's a v2, magic 2, record batch rather than a legacy
+// message set.
+func (ms MessageSet) IsRecordBatch() bool {
+	return len(ms) >= recordBatchHeaderLen && ms[magicPos] == recordBatchMagic
+}
+
+// LastOffset returns the offset of the set's last record. A legacy message set's messages all
+// share its offset while a record batch's records take consecutive offsets from its base offset.
+func (ms MessageSet) LastOffset() int64 {
+	if !ms.IsRecordBatch() {
+		return ms.Offset()
+	}
+	return ms.Offset() + int64(int32(Encoding.Uint32(ms[lastOffsetDeltaPos:])))
+}
+
+// MaxTimestamp returns the latest timestamp, in milliseconds, of the set's records, or -1 if they
+// don't have timestamps, e.g. a legacy message set's v0 messages.
+func (ms MessageSet) MaxTimestamp() int64 {
+	if ms.IsRecordBatch() {
+		return int64(Encoding.Uint64(ms[maxTimestampPos:]))
+	}
+	// the messages are walked by hand, rather than with Messages, so a malformed set is cut short
+	// instead of panicking.
+	max := int64(-1)
+	p := ms.Payload()
+	for len(p) >= 4+1+1 {
+		size := 4 + 1 + 1
+		if p[4] > 0 {
+			if len(p) < size+8 {
+				break
+			}
+			if ts := int64(Encoding.Uint64(p[size:])); ts > max {
+				max = ts
+			}
+			size += 8
+		}
+		// the key and value are prefixed by their length, -1 if they're null.
+		for i := 0; i < 2 && len(p) >= size+4; i++ {
+			l := int32(Encoding.Uint32(p[size:]))
+			size += 4
+			if l > 0 {
+				size += int(l)
+			}
+		}
+		if len(p) < size {
+			break
+		}
+		p = p[size:]
+	}
+	return max
+}
+
+// offsets returns the number of offsets the set takes in the log.
+func (ms MessageSet) offsets() int64 {
+	if n := ms.LastOffset() - ms.Offset() + 1; n > 1 {
+		return n
+	}
+	return 1
+}
+
+// Keys returns the keys of the set's records, and false if they can't be read without
+// decompressing a compressed record batch.
+func (ms MessageSet) Keys() ([][]byte, bool) {
+	var keys [][]byte
+	if !ms.IsRecordBatch() {
+		for _, msg := range ms.Messages() {
+			keys = append(keys, msg.Key())
+		}
+		return keys, true
+	}
+	ok := ms.eachRecord(func(r []byte) bool {
+		// the timestamp and offset deltas come before the key.
+		for j := 0; j < 2; j++ {
+			_, n := binary.Varint(r)
+			if n <= 0 {
+				return false
+			}
+			r = r[n:]
+		}
+		l, n := binary.Varint(r)
+		if n <= 0 || int64(len(r)-n) < l {
+			return false
+		}
+		var key []byte
+		if l >= 0 {
+			key = r[n : n+int(l)]
+		}
+		keys = append(keys, key)
+		return true
+	})
+	if !ok {
+		return nil, false
+	}
+	return keys, true
+}
+
+// timestampDeltas returns the timestamp deltas of the record batch's records in milliseconds, and
+// false if they can't be read without decompressing a compressed record batch.
+func (ms MessageSet) timestampDeltas() ([]int64, bool) {
+	var deltas []int64
+	ok := ms.eachRecord(func(r []byte) bool {
+		d, n := binary.Varint(r)
+		if n <= 0 {
+			return false
+		}
+		deltas = append(deltas, d)
+		return true
+	})
+	return deltas, ok
+}
+
+// eachRecord calls fn with each of the uncompressed record batch's records from after their
+// attributes, stopping if it returns false. It returns false if the records can't be read.
+func (ms MessageSet) eachRecord(fn func(r []byte) bool) bool {
+	if !ms.IsRecordBatch() || Encoding.Uint16(ms[batchAttributesPos:])&codecMask != 0 {
+		return false
+	}
+	// each record's its varint length and attributes, then its varint timestamp and offset
+	// deltas, key, value, and headers.
+	b := ms[recordBatchHeaderLen:]
+	for i := int32(Encoding.Uint32(ms[recordsCountPos:])); i > 0; i-- {
+		length, n := binary.Varint(b)
+		if n <= 0 || length < 1 || int64(len(b)-n) < length {
+			return false
+		}
+		r := b[n+1 : n+int(length)]
+		b = b[n+int(length):]
+		if !fn(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -39,6 +39,7 @@ func (r *Reader) Read(p []byte) (n int, err error) {
 		r.idx++
 		segment = segments[r.idx]
 		r.pos = 0
+		segment.advise(0, adviseSequential)
 	}
 
 	return n, err
@@ -60,6 +61,13 @@ func (l *CommitLog) NewReader(offset int64, maxBytes int32) (io.Reader, error) {
 	if err != nil {
 		return nil, err
 	}
+	if idx < len(l.Segments())-1 {
+		// the consumer is behind the active segment, likely reading data that's not in the page
+		// cache, so have the kernel start reading it in.
+		s.advise(e.Position, adviseSequential, adviseWillNeed)
+	} else {
+		s.advise(e.Position, adviseSequential)
+	}
 	return &Reader{
 		cl:  l,
 		idx: idx,
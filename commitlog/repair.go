@@ -0,0 +1,252 @@
+package commitlog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DeletedDirSuffix is added to a log's dir when it's deleted, so a deletion that's interrupted
+// leaves a dir that's recognizably garbage rather than a partial log.
+const DeletedDirSuffix = "-delete"
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// RepairIssue is a problem Repair found with a log's files.
+type RepairIssue struct {
+	Path    string
+	Problem string
+	// Fix is what was done about the problem, or would be on a dry run. It's empty if the problem
+	// can't be fixed.
+	Fix string
+}
+
+// Repair checks the files of the log in the dir for problems left by crashes and disk failures,
+// fixing those it can: temp files left by interrupted compactions and compressions are removed,
+// missing and corrupt indexes are rebuilt, and the active segment's torn or corrupt tail is
+// truncated, like a crash mid-append leaves. Corrupt sealed segments can't be fixed without
+// losing records in the middle of the log so they're only reported. Nothing's changed on a dry
+// run. The log mustn't be open.
+func Repair(path string, dryRun bool) ([]RepairIssue, error) {
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read dir failed")
+	}
+	var issues []RepairIssue
+	report := func(file, problem, fix string, do func() error) error {
+		issues = append(issues, RepairIssue{Path: file, Problem: problem, Fix: fix})
+		if dryRun || do == nil {
+			return nil
+		}
+		return do()
+	}
+
+	names := make(map[string]bool, len(files))
+	for _, f := range files {
+		names[f.Name()] = true
+	}
+	var bases []int64
+	for _, f := range files {
+		name := f.Name()
+		file := filepath.Join(path, name)
+		remove := func() error { return os.Remove(file) }
+		var err error
+		switch {
+		case f.IsDir():
+			continue
+		case strings.HasSuffix(name, tmpSuffix), strings.HasSuffix(name, cleanedSuffix):
+			err = report(file, "temp file left by an interrupted compaction or compression", "removed", remove)
+		case strings.HasSuffix(name, indexSuffix):
+			log := strings.TrimSuffix(name, indexSuffix) + logSuffix
+			if !names[log] && !names[log+compressedSuffix] {
+				err = report(file, "index without a log", "removed", remove)
+			}
+		case strings.HasSuffix(name, logSuffix) && names[name+compressedSuffix]:
+			err = report(file, "log left behind after its segment was compressed", "removed", remove)
+		case strings.HasSuffix(name, logSuffix), strings.HasSuffix(name, logSuffix+compressedSuffix):
+			base, perr := strconv.ParseInt(strings.TrimSuffix(strings.TrimSuffix(name, compressedSuffix), logSuffix), 10, 64)
+			if perr != nil || base < 0 {
+				err = report(file, "log file name isn't a base offset", "", nil)
+			} else {
+				bases = append(bases, base)
+			}
+		}
+		if err != nil {
+			return issues, err
+		}
+	}
+
+	sort.Slice(bases, func(i, j int) bool { return bases[i] < bases[j] })
+	for i, base := range bases {
+		if err := repairSegment(path, base, i == len(bases)-1, report); err != nil {
+			return issues, err
+		}
+	}
+	return issues, nil
+}
+
+// repairSegment checks the segment's log and index, truncating the active segment's invalid
+// tail and rebuilding the index if it's missing or corrupt.
+func repairSegment(dir string, base int64, active bool, report func(file, problem, fix string, do func() error) error) error {
+	s, path, data, err := readSegmentFiles(dir, base)
+	if err != nil {
+		return report(path, fmt.Sprintf("unreadable: %v", err), "", nil)
+	}
+
+	valid, n, err := scanMessageSets(data)
+	if err != nil {
+		problem := fmt.Sprintf("%v at position %d, offset %d", err, valid, base+n)
+		if !active || s.compressed {
+			return report(path, problem+" of a sealed segment", "", nil)
+		}
+		truncate := func() error { return os.Truncate(path, valid) }
+		if err := report(path, problem, fmt.Sprintf("truncated %d bytes", int64(len(data))-valid), truncate); err != nil {
+			return err
+		}
+	}
+
+	if problem := checkIndexFile(s.indexPath()); problem != "" {
+		rebuild := func() error {
+			if err := os.Remove(s.indexPath()); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			rebuilt, err := NewSegment(dir, base, 0)
+			if err != nil {
+				return err
+			}
+			return rebuilt.Close()
+		}
+		return report(s.indexPath(), problem, "rebuilt", rebuild)
+	}
+	return nil
+}
+
+// readSegmentFiles returns the segment with its log's path and data, decompressed if the
+// segment's log was recompressed at rest, without opening it.
+func readSegmentFiles(dir string, base int64) (*Segment, string, []byte, error) {
+	s := &Segment{path: dir, BaseOffset: base}
+	path := s.logPath()
+	if _, err := os.Stat(s.compressedLogPath()); err == nil {
+		s.compressed = true
+		path = s.compressedLogPath()
+	}
+	data, err := ioutil.ReadFile(path)
+	if err == nil && s.compressed {
+		var r *gzip.Reader
+		if r, err = gzip.NewReader(bytes.NewReader(data)); err == nil {
+			data, err = ioutil.ReadAll(r)
+		}
+	}
+	return s, path, data, err
+}
+
+// scanMessageSets returns the position of the end of the log's valid message sets and the number
+// of offsets they take, and what's wrong with the set after them.
+func scanMessageSets(data []byte) (int64, int64, error) {
+	var pos, n int64
+	for pos < int64(len(data)) {
+		rest := data[pos:]
+		if len(rest) < msgSetHeaderLen {
+			return pos, n, errors.New("torn message set header")
+		}
+		size := int64(Encoding.Uint32(rest[sizePos:]))
+		if int64(len(rest)) < msgSetHeaderLen+size {
+			return pos, n, errors.New("torn message set")
+		}
+		if err := checkPayload(rest[msgSetHeaderLen : msgSetHeaderLen+size]); err != nil {
+			return pos, n, err
+		}
+		n += MessageSet(rest[:msgSetHeaderLen+size]).offsets()
+		pos += msgSetHeaderLen + size
+	}
+	return pos, n, nil
+}
+
+// checkPayload checks the CRCs of a message set's payload, either messages or a record batch,
+// which have their magic byte in the same place.
+func checkPayload(p []byte) error {
+	if len(p) < 5 {
+		return errors.New("message set too short")
+	}
+	switch magic := p[4]; magic {
+	case 0, 1:
+		// one or more messages: crc, magic, attributes, timestamp from v1, key and value.
+		for len(p) > 0 {
+			size := 4 + 1 + 1
+			if len(p) < size {
+				return errors.New("truncated message")
+			}
+			if p[4] > 0 {
+				size += 8
+			}
+			// the key and value are prefixed by their length, -1 if they're null.
+			for i := 0; i < 2; i++ {
+				if len(p) < size+4 {
+					return errors.New("truncated message")
+				}
+				l := int32(Encoding.Uint32(p[size:]))
+				size += 4
+				if l > 0 {
+					size += int(l)
+				}
+			}
+			if len(p) < size {
+				return errors.New("truncated message")
+			}
+			if crc32.ChecksumIEEE(p[4:size]) != Encoding.Uint32(p) {
+				return errors.New("message crc mismatch")
+			}
+			p = p[size:]
+		}
+	case 2:
+		// a record batch: partition leader epoch, magic, crc of the rest.
+		if len(p) < 9 {
+			return errors.New("record batch too short")
+		}
+		if crc32.Checksum(p[9:], castagnoli) != Encoding.Uint32(p[5:]) {
+			return errors.New("record batch crc mismatch")
+		}
+	default:
+		return fmt.Errorf("unknown magic byte %d", magic)
+	}
+	return nil
+}
+
+// checkIndexFile returns what's wrong with the segment's index, checked like opening the segment
+// does.
+func checkIndexFile(path string) string {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "missing index"
+	} else if err != nil {
+		return fmt.Sprintf("unreadable index: %v", err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return fmt.Sprintf("unreadable index: %v", err)
+	}
+	if fi.Size() == 0 {
+		return ""
+	}
+	if fi.Size()%entryWidth != 0 {
+		return "corrupt index: size isn't a whole number of entries"
+	}
+	p := make([]byte, entryWidth)
+	if _, err := f.ReadAt(p, fi.Size()-entryWidth); err != nil {
+		return fmt.Sprintf("unreadable index: %v", err)
+	}
+	if int32(Encoding.Uint32(p[offsetOffset:])) < 0 {
+		return "corrupt index: last entry's offset is before the segment's base offset"
+	}
+	return ""
+}
@@ -0,0 +1,105 @@
+package commitlog_test
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/commitlog"
+)
+
+// v0Message returns a v0 message with the value and a valid crc.
+func v0Message(value string) commitlog.Message {
+	m := make([]byte, 4+1+1+4+4+len(value))
+	commitlog.Encoding.PutUint32(m[6:], 0xffffffff) // null key
+	commitlog.Encoding.PutUint32(m[10:], uint32(len(value)))
+	copy(m[14:], value)
+	commitlog.Encoding.PutUint32(m, crc32.ChecksumIEEE(m[4:]))
+	return m
+}
+
+func TestRepair(t *testing.T) {
+	req := require.New(t)
+	path, err := ioutil.TempDir("", "repair")
+	req.NoError(err)
+	defer os.RemoveAll(path)
+	opts := commitlog.Options{Path: path, MaxSegmentBytes: 60, MaxLogBytes: -1}
+	l, err := commitlog.New(opts)
+	req.NoError(err)
+	for i := 0; i < 8; i++ {
+		_, err := l.Append(commitlog.NewMessageSet(uint64(i), v0Message(fmt.Sprintf("value %d", i))))
+		req.NoError(err)
+	}
+	segments := l.Segments()
+	req.True(len(segments) >= 4)
+	file := func(s *commitlog.Segment, suffix string) string {
+		return filepath.Join(path, fmt.Sprintf("%020d%s", s.BaseOffset, suffix))
+	}
+	active := segments[len(segments)-1]
+	activeSize := active.Position
+	req.NoError(l.Close())
+
+	issues, err := commitlog.Repair(path, false)
+	req.NoError(err)
+	req.Empty(issues)
+
+	// a crash mid-compaction, mid-append and disk failures.
+	req.NoError(ioutil.WriteFile(file(segments[0], ".log.cleaned"), []byte("cleaned"), 0644))
+	req.NoError(os.Truncate(file(segments[0], ".index"), 8*3+5))
+	req.NoError(os.Remove(file(segments[1], ".index")))
+	data, err := ioutil.ReadFile(file(segments[2], ".log"))
+	req.NoError(err)
+	data[len(data)-1] ^= 0xff
+	req.NoError(ioutil.WriteFile(file(segments[2], ".log"), data, 0644))
+	f, err := os.OpenFile(file(active, ".log"), os.O_APPEND|os.O_WRONLY, 0644)
+	req.NoError(err)
+	_, err = f.Write([]byte{0, 0, 0, 0, 0, 0, 0, 8, 0, 0, 0, 40, 1})
+	req.NoError(err)
+	req.NoError(f.Close())
+
+	problems := map[string]string{
+		file(segments[0], ".log.cleaned"): "removed",
+		file(segments[0], ".index"):       "rebuilt",
+		file(segments[1], ".index"):       "rebuilt",
+		file(segments[2], ".log"):         "",
+		file(active, ".log"):              "truncated 13 bytes",
+	}
+	check := func(issues []commitlog.RepairIssue) {
+		got := make(map[string]string)
+		for _, i := range issues {
+			got[i.Path] = i.Fix
+		}
+		req.Equal(problems, got)
+	}
+
+	// dry runs change nothing.
+	issues, err = commitlog.Repair(path, true)
+	req.NoError(err)
+	check(issues)
+	_, err = os.Stat(file(segments[0], ".log.cleaned"))
+	req.NoError(err)
+
+	issues, err = commitlog.Repair(path, false)
+	req.NoError(err)
+	check(issues)
+	_, err = os.Stat(file(segments[0], ".log.cleaned"))
+	req.True(os.IsNotExist(err))
+	fi, err := os.Stat(file(active, ".log"))
+	req.NoError(err)
+	req.Equal(activeSize, fi.Size())
+
+	// only the unrecoverable segment's left.
+	issues, err = commitlog.Repair(path, false)
+	req.NoError(err)
+	req.Len(issues, 1)
+	req.Equal(file(segments[2], ".log"), issues[0].Path)
+	req.Contains(issues[0].Problem, "crc mismatch")
+
+	l, err = commitlog.New(opts)
+	req.NoError(err)
+	req.NoError(l.Close())
+}
@@ -17,10 +17,13 @@ const (
 	logSuffix     = ".log"
 	cleanedSuffix = ".cleaned"
 	indexSuffix   = ".index"
+	// compressedSuffix is added to the log file's name once the sealed segment's been
+	// recompressed at rest.
+	compressedSuffix = ".gz"
+	tmpSuffix        = ".tmp"
 )
 
 type Segment struct {
-	writer     io.Writer
 	reader     io.Reader
 	log        *os.File
 	Index      *Index
@@ -30,6 +33,22 @@ type Segment struct {
 	maxBytes   int64
 	path       string
 	suffix     string
+	// files, if set, limits how many segments keep their log file open.
+	files *FileCache
+	// readPos is the read position kept while the log file is closed by the file cache.
+	readPos int64
+	// compressed is whether the sealed segment's log was recompressed at rest. It's read from
+	// data, which reads clog, opened on the segment's first read after it was opened or closed by
+	// the file cache.
+	compressed bool
+	clog       *compressedLog
+	data       *io.SectionReader
+	closed     bool
+	// aborted is the segment's transaction index, the transactions aborted by markers in it.
+	aborted []AbortedTxn
+	// maxTimestamp is the latest timestamp, in milliseconds, of the segment's records, or -1 if
+	// none of them have one. Retention ages segments by it.
+	maxTimestamp int64
 
 	sync.Mutex
 }
@@ -45,15 +64,25 @@ func NewSegment(path string, baseOffset, maxBytes int64, args ...interface{}) (*
 		NextOffset: baseOffset,
 		path:       path,
 		suffix:     suffix,
+		// the log's read when its index is built, setting the timestamp.
+		maxTimestamp: -1,
 	}
-	log, err := os.OpenFile(s.logPath(), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-	if err != nil {
-		return nil, errors.Wrap(err, "open file failed")
+	if suffix == "" {
+		if _, err := os.Stat(s.compressedLogPath()); err == nil {
+			s.compressed = true
+			// the log's left behind if the segment was compressed but the log wasn't removed
+			// before the broker stopped.
+			if err := os.Remove(s.logPath()); err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+		} else if !os.IsNotExist(err) {
+			return nil, errors.Wrap(err, "stat file failed")
+		}
 	}
-	s.log = log
-	s.writer = log
-	s.reader = log
-	err = s.SetupIndex()
+	if err := s.openLog(); err != nil {
+		return nil, err
+	}
+	err := s.SetupIndex()
 	return s, err
 }
 
@@ -81,7 +110,11 @@ func (s *Segment) BuildIndex() (err error) {
 		return err
 	}
 
-	_, err = s.log.Seek(0, 0)
+	var log io.ReadSeeker = s.log
+	if s.compressed {
+		log = s.data
+	}
+	_, err = log.Seek(0, 0)
 	if err != nil {
 		return err
 	}
@@ -94,41 +127,43 @@ func (s *Segment) BuildIndex() (err error) {
 loop:
 	for {
 		// get offset and size
-		_, err = io.CopyN(b, s.log, 8)
+		_, err = io.CopyN(b, log, 8)
 		if err != nil {
 			break loop
 		}
 
-		_, err = io.CopyN(b, s.log, 4)
+		_, err = io.CopyN(b, log, 4)
 		if err != nil {
 			break loop
 		}
 		size := int64(Encoding.Uint32(b.Bytes()[8:12]))
 
-		_, err = io.CopyN(b, s.log, size)
+		_, err = io.CopyN(b, log, size)
 		if err != nil {
 			break loop
 		}
 
-		// Reset the buffer to not get an overflow
-		b.Truncate(0)
-
+		// a record batch takes an offset per record, and compaction leaves gaps, so the set's
+		// offsets are read from it rather than counted.
+		ms := MessageSet(b.Bytes())
 		entry := Entry{
-			Offset:   nextOffset,
+			Offset:   ms.Offset(),
 			Position: position,
 		}
-		err = s.Index.WriteEntry(entry)
-		if err != nil {
-			break loop
+		nextOffset = ms.Offset() + ms.offsets()
+		if ts := ms.MaxTimestamp(); ts > s.maxTimestamp {
+			s.maxTimestamp = ts
 		}
 
-		position += size + msgSetHeaderLen
-		nextOffset++
+		// Reset the buffer to not get an overflow
+		b.Truncate(0)
 
-		_, err = s.log.Seek(size, 1)
+		err = s.Index.WriteEntry(entry)
 		if err != nil {
 			break loop
 		}
+
+		position += size + msgSetHeaderLen
 	}
 	if err == io.EOF {
 		s.NextOffset = nextOffset
@@ -144,44 +179,192 @@ func (s *Segment) IsFull() bool {
 	return s.Position >= s.maxBytes
 }
 
-// Write writes a byte slice to the log at the current position.
-// It increments the offset as well as sets the position to the new tail.
+// Write writes a message set to the log at the current position.
+// It advances the offset past the set's records as well as sets the position to the new tail.
 func (s *Segment) Write(p []byte) (n int, err error) {
+	return s.writeSets([]MessageSet{p})
+}
+
+// writeSets writes the message sets to the log at the current position with one writev, rather
+// than a write each, advancing the offset and position past them like Write.
+func (s *Segment) writeSets(sets []MessageSet) (n int, err error) {
+	defer s.files.use(s)
 	s.Lock()
 	defer s.Unlock()
-	n, err = s.writer.Write(p)
+	if err = s.openLog(); err != nil {
+		return 0, err
+	}
+	if s.compressed {
+		return 0, errors.New("write to compressed segment")
+	}
+	bufs := make([][]byte, len(sets))
+	for i, ms := range sets {
+		bufs[i] = ms
+	}
+	n, err = writev(s.log, bufs)
 	if err != nil {
 		return n, errors.Wrap(err, "log write failed")
 	}
-	s.NextOffset++
+	for _, ms := range sets {
+		s.NextOffset += ms.offsets()
+		if ts := ms.MaxTimestamp(); ts > s.maxTimestamp {
+			s.maxTimestamp = ts
+		}
+	}
 	s.Position += int64(n)
 	return n, nil
 }
 
 func (s *Segment) Read(p []byte) (n int, err error) {
+	defer s.files.use(s)
 	s.Lock()
 	defer s.Unlock()
+	if err = s.openLog(); err != nil {
+		return 0, err
+	}
 	return s.reader.Read(p)
 }
 
 func (s *Segment) ReadAt(p []byte, off int64) (n int, err error) {
+	defer s.files.use(s)
 	s.Lock()
 	defer s.Unlock()
+	if err = s.openLog(); err != nil {
+		return 0, err
+	}
+	if s.compressed {
+		return s.data.ReadAt(p, off)
+	}
 	return s.log.ReadAt(p, off)
 }
 
 func (s *Segment) Close() error {
+	// removed once it's marked closed so the file cache doesn't track it again.
+	defer s.files.remove(s)
 	s.Lock()
 	defer s.Unlock()
-	if err := s.log.Close(); err != nil {
-		return err
+	s.closed = true
+	if s.clog != nil {
+		if err := s.closeCompressedLog(); err != nil {
+			return err
+		}
+	}
+	if s.log != nil {
+		if err := s.log.Close(); err != nil {
+			return err
+		}
+		s.log = nil
 	}
 	return s.Index.Close()
 }
 
+// advise hints to the kernel how the log file from off will be read. It's best effort so errors
+// are ignored.
+func (s *Segment) advise(off int64, advices ...int) {
+	defer s.files.use(s)
+	s.Lock()
+	defer s.Unlock()
+	if err := s.openLog(); err != nil || s.compressed {
+		return
+	}
+	for _, advice := range advices {
+		_ = fadvise(s.log, off, advice)
+	}
+}
+
+// SetFileCache sets the cache limiting the number of open segment log files.
+func (s *Segment) SetFileCache(c *FileCache) {
+	s.files = c
+	c.use(s)
+}
+
+// openLog reopens the log file if it was closed by the file cache. It isn't reopened once the
+// segment's closed, that'd recreate it if it was deleted. The caller must hold the lock.
+func (s *Segment) openLog() error {
+	if s.closed {
+		return ErrSegmentClosed
+	}
+	if s.compressed {
+		return s.openCompressedLog()
+	}
+	if s.log != nil {
+		return nil
+	}
+	log, err := os.OpenFile(s.logPath(), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return errors.Wrap(err, "open file failed")
+	}
+	if _, err = log.Seek(s.readPos, io.SeekStart); err != nil {
+		log.Close()
+		return err
+	}
+	s.log = log
+	s.reader = log
+	return nil
+}
+
+// openCompressedLog opens the compressed log if it isn't already. Reads decompress the chunks of
+// it they span, so the whole log isn't held in memory. The caller must hold the lock.
+func (s *Segment) openCompressedLog() error {
+	if s.clog != nil {
+		return nil
+	}
+	c, err := newCompressedLog(s.compressedLogPath())
+	if err != nil {
+		return err
+	}
+	data := io.NewSectionReader(c, 0, c.size)
+	if _, err := data.Seek(s.readPos, io.SeekStart); err != nil {
+		c.Close()
+		return err
+	}
+	s.clog, s.data = c, data
+	s.reader = s.data
+	return nil
+}
+
+// closeCompressedLog closes the compressed log, dropping its decompressed chunk, until it's next
+// read. The caller must hold the lock.
+func (s *Segment) closeCompressedLog() error {
+	s.readPos, _ = s.data.Seek(0, io.SeekCurrent)
+	err := s.clog.Close()
+	s.clog, s.data, s.reader = nil, nil, nil
+	return err
+}
+
+// closeLog closes the log file until the segment's next read or write. It's called when the
+// file cache evicts the segment, as its least recently used, so the kernel's told the log's pages
+// won't be read soon and they're dropped ahead of hotter segments'.
+func (s *Segment) closeLog() error {
+	s.Lock()
+	defer s.Unlock()
+	if s.clog != nil {
+		return s.closeCompressedLog()
+	}
+	if s.log == nil {
+		return nil
+	}
+	pos, err := s.log.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	s.readPos = pos
+	// best effort, the pages are only dropped sooner.
+	_ = fadvise(s.log, 0, adviseDontNeed)
+	err = s.log.Close()
+	s.log = nil
+	s.reader = nil
+	return err
+}
+
 // Cleaner creates a cleaner segment for this segment.
 func (s *Segment) Cleaner() (*Segment, error) {
-	return NewSegment(s.path, s.BaseOffset, s.maxBytes, cleanedSuffix)
+	c, err := NewSegment(s.path, s.BaseOffset, s.maxBytes, cleanedSuffix)
+	if err != nil {
+		return nil, err
+	}
+	c.SetFileCache(s.files)
+	return c, nil
 }
 
 // Replace replaces the given segment with the callee.
@@ -198,27 +381,49 @@ func (s *Segment) Replace(old *Segment) (err error) {
 	if err = os.Rename(s.indexPath(), old.indexPath()); err != nil {
 		return err
 	}
+	if old.compressed {
+		if err = os.Remove(old.compressedLogPath()); err != nil {
+			return err
+		}
+	}
 	s.suffix = ""
+	s.closed = false
+	// the old segment's transaction index is kept.
+	s.aborted = old.aborted
 	log, err := os.OpenFile(s.logPath(), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
 	if err != nil {
 		return errors.Wrap(err, "open file failed")
 	}
 	s.log = log
-	s.writer = log
 	s.reader = log
+	s.readPos = 0
+	defer s.files.use(s)
 	return s.SetupIndex()
 }
 
-// findEntry returns the nearest entry whose offset is greater than or equal to the given offset.
+// findEntry returns the entry of the record batch holding the given offset or, if there isn't one,
+// the nearest entry whose offset is greater than or equal to the given offset.
 func (s *Segment) findEntry(offset int64) (e *Entry, err error) {
+	defer s.files.use(s)
 	s.Lock()
 	defer s.Unlock()
 	e = &Entry{}
-	n := int(s.Index.bytes / entryWidth)
+	// search the written entries rather than the index's whole mapped size.
+	s.Index.mu.RLock()
+	n := int(s.Index.position / entryWidth)
+	s.Index.mu.RUnlock()
 	idx := sort.Search(n, func(i int) bool {
 		_ = s.Index.ReadEntryAtFileOffset(e, int64(i*entryWidth))
-		return e.Offset >= offset || e.Offset == 0
+		return e.Offset >= offset
 	})
+	if idx > 0 {
+		// the offset's in the previous entry's set if it's a record batch that ends past it.
+		prev := &Entry{}
+		_ = s.Index.ReadEntryAtFileOffset(prev, int64((idx-1)*entryWidth))
+		if last, err := s.lastOffsetAt(prev.Position); err == nil && last >= offset {
+			return prev, nil
+		}
+	}
 	if idx == n {
 		return nil, errors.New("entry not found")
 	}
@@ -226,6 +431,23 @@ func (s *Segment) findEntry(offset int64) (e *Entry, err error) {
 	return e, nil
 }
 
+// lastOffsetAt returns the last offset of the set at the position in the log. The segment must be
+// locked.
+func (s *Segment) lastOffsetAt(position int64) (int64, error) {
+	if err := s.openLog(); err != nil {
+		return 0, err
+	}
+	var r io.ReaderAt = s.log
+	if s.compressed {
+		r = s.data
+	}
+	header := make(MessageSet, recordBatchHeaderLen)
+	if _, err := r.ReadAt(header, position); err != nil && err != io.EOF {
+		return 0, err
+	}
+	return header.LastOffset(), nil
+}
+
 // Delete closes the segment and then deletes its log and index files.
 func (s *Segment) Delete() error {
 	if err := s.Close(); err != nil {
@@ -233,12 +455,19 @@ func (s *Segment) Delete() error {
 	}
 	s.Lock()
 	defer s.Unlock()
-	if err := os.Remove(s.log.Name()); err != nil {
+	path := s.logPath()
+	if s.compressed {
+		path = s.compressedLogPath()
+	}
+	if err := os.Remove(path); err != nil {
 		return err
 	}
 	if err := os.Remove(s.Index.Name()); err != nil {
 		return err
 	}
+	if err := os.Remove(s.txnIndexPath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
 	return nil
 }
 
@@ -273,6 +502,80 @@ func (s *SegmentScanner) Scan() (ms MessageSet, err error) {
 	return msgSet, nil
 }
 
+// Compress recompresses the sealed segment's log at rest with gzip at its best compression, trading
+// the CPU to decompress the chunks of it that are read for disk. It returns the bytes saved. The log's written
+// to a temp file that's renamed over once it's synced, so a crash leaves either the log or its
+// compressed copy to open.
+func (s *Segment) Compress() (saved int64, err error) {
+	defer s.files.use(s)
+	s.Lock()
+	defer s.Unlock()
+	if s.compressed || s.closed {
+		return 0, nil
+	}
+	if err = s.openLog(); err != nil {
+		return 0, err
+	}
+	fi, err := s.log.Stat()
+	if err != nil {
+		return 0, err
+	}
+	tmp := s.compressedLogPath() + tmpSuffix
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return 0, errors.Wrap(err, "open file failed")
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(tmp)
+		}
+	}()
+	if err = compressChunks(f, io.NewSectionReader(s.log, 0, fi.Size())); err != nil {
+		return 0, errors.Wrap(err, "compress failed")
+	}
+	if err = f.Sync(); err != nil {
+		return 0, err
+	}
+	cfi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if err = f.Close(); err != nil {
+		return 0, err
+	}
+	if err = os.Rename(tmp, s.compressedLogPath()); err != nil {
+		return 0, err
+	}
+	s.readPos, _ = s.log.Seek(0, io.SeekCurrent)
+	s.log.Close()
+	s.log, s.reader = nil, nil
+	s.compressed = true
+	if err = os.Remove(s.logPath()); err != nil {
+		return 0, err
+	}
+	return fi.Size() - cfi.Size(), nil
+}
+
+// Compressed returns whether the segment's log was recompressed at rest.
+func (s *Segment) Compressed() bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.compressed
+}
+
+// MaxTimestamp returns the latest timestamp, in milliseconds, of the segment's records, or -1 if
+// none of them have one.
+func (s *Segment) MaxTimestamp() int64 {
+	s.Lock()
+	defer s.Unlock()
+	return s.maxTimestamp
+}
+
+func (s *Segment) compressedLogPath() string {
+	return s.logPath() + compressedSuffix
+}
+
 func (s *Segment) logPath() string {
 	return filepath.Join(s.path, fmt.Sprintf(fileFormat, s.BaseOffset, logSuffix+s.suffix))
 }
@@ -1,6 +1,10 @@
 package commitlog_test
 
 import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -29,3 +33,84 @@ func TestSegmentScanner(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, msgSets[0], ms)
 }
+
+func TestSegmentCompress(t *testing.T) {
+	path, err := ioutil.TempDir("", "segmentcompress")
+	require.NoError(t, err)
+	defer os.RemoveAll(path)
+	opts := commitlog.Options{
+		Path:            path,
+		MaxSegmentBytes: 100,
+		MaxLogBytes:     -1,
+		// evicting the segments drops their decompressed logs.
+		FileCache: commitlog.NewFileCache(1),
+	}
+	l, err := commitlog.New(opts)
+	require.NoError(t, err)
+
+	msgs := make([]commitlog.MessageSet, 10)
+	for i := range msgs {
+		msgs[i] = commitlog.NewMessageSet(uint64(i), commitlog.NewMessage(bytes.Repeat([]byte{'a' + byte(i)}, 100)))
+		_, err := l.Append(msgs[i])
+		require.NoError(t, err)
+	}
+	segments := l.Segments()
+	require.True(t, len(segments) > 2)
+	readAll := func(l *commitlog.CommitLog) {
+		for i, ms := range msgs {
+			r, err := l.NewReader(int64(i), ms.Size())
+			require.NoError(t, err)
+			p := make([]byte, len(ms))
+			_, err = io.ReadFull(r, p)
+			require.NoError(t, err)
+			require.Equal(t, []byte(ms), p)
+		}
+	}
+
+	saved, err := l.CompressSegments()
+	require.NoError(t, err)
+	require.True(t, saved > 0)
+	for i, s := range segments {
+		require.Equal(t, i < len(segments)-1, s.Compressed())
+	}
+	saved, err = l.CompressSegments()
+	require.NoError(t, err)
+	require.Equal(t, int64(0), saved)
+	readAll(l)
+
+	// the compressed segments are reopened from their compressed logs.
+	require.NoError(t, l.Close())
+	l, err = commitlog.New(opts)
+	require.NoError(t, err)
+	defer l.Close()
+	require.Equal(t, len(segments), len(l.Segments()))
+	require.True(t, l.Segments()[0].Compressed())
+	readAll(l)
+	_, err = l.Append(msgs[0])
+	require.NoError(t, err)
+}
+
+func TestSegmentClosed(t *testing.T) {
+	path, err := ioutil.TempDir("", "segmentclosed")
+	require.NoError(t, err)
+	defer os.RemoveAll(path)
+	files := commitlog.NewFileCache(1)
+	s, err := commitlog.NewSegment(path, 0, 1000)
+	require.NoError(t, err)
+	s.SetFileCache(files)
+	ms := commitlog.NewMessageSet(0, msgs...)
+	_, err = s.Write(ms)
+	require.NoError(t, err)
+	require.NoError(t, s.Delete())
+
+	// reads after it's deleted fail rather than recreate the log file, and aren't cached.
+	p := make([]byte, len(ms))
+	_, err = s.ReadAt(p, 0)
+	require.Equal(t, commitlog.ErrSegmentClosed, err)
+	_, err = s.Read(p)
+	require.Equal(t, commitlog.ErrSegmentClosed, err)
+	fis, err := ioutil.ReadDir(path)
+	require.NoError(t, err)
+	require.Empty(t, fis)
+	require.Equal(t, 0, files.Len())
+}
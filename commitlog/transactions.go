@@ -0,0 +1,162 @@
+package commitlog
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const (
+	txnIndexSuffix = ".txnindex"
+	// each transaction index entry is an aborted transaction's producer ID, first offset and
+	// last offset.
+	txnEntryWidth = 24
+
+	producerIDPos     = 43
+	transactionalMask = 0x10
+	controlMask       = 0x20
+	// abortMarker is the type in a control record's key of a transaction's abort marker, commit
+	// markers are type 1.
+	abortMarker = 0
+)
+
+// AbortedTxn is a transaction aborted in the log, whose records read committed consumers skip.
+type AbortedTxn struct {
+	ProducerID  int64
+	FirstOffset int64
+	// LastOffset is the offset of the transaction's abort marker.
+	LastOffset int64
+}
+
+// LastStableOffset returns the offset of the log's first record in a transaction that's not yet
+// committed or aborted, or the log's newest offset if there isn't one. Read committed consumers
+// aren't served records from it on.
+func (l *CommitLog) LastStableOffset() int64 {
+	l.txnMu.Lock()
+	defer l.txnMu.Unlock()
+	lso := l.NewestOffset()
+	for _, first := range l.ongoing {
+		if first < lso {
+			lso = first
+		}
+	}
+	return lso
+}
+
+// AbortedTransactions returns the aborted transactions with records between the from and to
+// offsets, read from the segments' transaction indexes.
+func (l *CommitLog) AbortedTransactions(from, to int64) []AbortedTxn {
+	l.mu.RLock()
+	segments := l.segments
+	l.mu.RUnlock()
+	var aborted []AbortedTxn
+	for _, s := range segments {
+		s.Lock()
+		for _, t := range s.aborted {
+			if t.LastOffset >= from && t.FirstOffset < to {
+				aborted = append(aborted, t)
+			}
+		}
+		s.Unlock()
+	}
+	return aborted
+}
+
+// trackTransaction tracks the transaction the appended set's a part of, if it's a transactional
+// record batch, and indexes the transaction in the segment if the set's its abort marker.
+func (l *CommitLog) trackTransaction(s *Segment, ms MessageSet) error {
+	if !ms.IsRecordBatch() || Encoding.Uint16(ms[batchAttributesPos:])&transactionalMask == 0 {
+		return nil
+	}
+	producerID := int64(Encoding.Uint64(ms[producerIDPos:]))
+	l.txnMu.Lock()
+	defer l.txnMu.Unlock()
+	if l.ongoing == nil {
+		l.ongoing = make(map[int64]int64)
+	}
+	if Encoding.Uint16(ms[batchAttributesPos:])&controlMask == 0 {
+		if _, ok := l.ongoing[producerID]; !ok {
+			l.ongoing[producerID] = ms.Offset()
+		}
+		return nil
+	}
+	first, ok := l.ongoing[producerID]
+	delete(l.ongoing, producerID)
+	if !ok || !isAbortMarker(ms) {
+		return nil
+	}
+	return s.addAbortedTxn(AbortedTxn{ProducerID: producerID, FirstOffset: first, LastOffset: ms.Offset()})
+}
+
+// loadTransactions rebuilds the log's ongoing transactions and its segments' transaction indexes
+// from the record batches' headers, and the control batches, when it's opened.
+func (l *CommitLog) loadTransactions() error {
+	l.ongoing = make(map[int64]int64)
+	for _, s := range l.segments {
+		s.aborted = nil
+		if err := os.Remove(s.txnIndexPath()); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		scanner := NewIndexScanner(s.Index)
+		for {
+			e, err := scanner.Scan()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			header := make(MessageSet, recordBatchHeaderLen)
+			n, err := s.ReadAt(header, e.Position)
+			if err != nil && err != io.EOF {
+				return err
+			}
+			ms := header[:n]
+			if ms.IsRecordBatch() && Encoding.Uint16(ms[batchAttributesPos:])&controlMask != 0 {
+				ms = make(MessageSet, ms.Size())
+				if _, err := s.ReadAt(ms, e.Position); err != nil && err != io.EOF {
+					return err
+				}
+			}
+			if err := l.trackTransaction(s, ms); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isAbortMarker returns whether the control batch holds an abort marker. The marker's control
+// record's key is its version and type.
+func isAbortMarker(ms MessageSet) bool {
+	keys, ok := ms.Keys()
+	return ok && len(keys) != 0 && len(keys[0]) >= 4 && Encoding.Uint16(keys[0][2:]) == abortMarker
+}
+
+// addAbortedTxn adds the transaction aborted by a marker in the segment to its transaction index.
+func (s *Segment) addAbortedTxn(t AbortedTxn) error {
+	s.Lock()
+	defer s.Unlock()
+	f, err := os.OpenFile(s.txnIndexPath(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	b := make([]byte, txnEntryWidth)
+	Encoding.PutUint64(b, uint64(t.ProducerID))
+	Encoding.PutUint64(b[8:], uint64(t.FirstOffset))
+	Encoding.PutUint64(b[16:], uint64(t.LastOffset))
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	s.aborted = append(s.aborted, t)
+	return nil
+}
+
+func (s *Segment) txnIndexPath() string {
+	return filepath.Join(s.path, fmt.Sprintf(fileFormat, s.BaseOffset, txnIndexSuffix+s.suffix))
+}
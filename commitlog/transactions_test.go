@@ -0,0 +1,65 @@
+package commitlog_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/commitlog"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestCommitLog_Transactions(t *testing.T) {
+	req := require.New(t)
+	path, err := ioutil.TempDir("", "transactions")
+	req.NoError(err)
+	defer os.RemoveAll(path)
+	opts := commitlog.Options{Path: path, MaxSegmentBytes: 1 << 20, MaxLogBytes: -1}
+	l, err := commitlog.New(opts)
+	req.NoError(err)
+
+	const transactional, control = 0x10, 0x20
+	appendBatch := func(attributes int16, producerID int64, records ...*protocol.Record) {
+		b, err := protocol.Encode(&protocol.RecordBatch{
+			Attributes:      attributes,
+			LastOffsetDelta: int32(len(records) - 1),
+			ProducerID:      producerID,
+			Records:         records,
+		})
+		req.NoError(err)
+		_, err = l.Append(b)
+		req.NoError(err)
+	}
+	// a control record's key is the marker's version and type, 0 aborts and 1 commits.
+	marker := func(typ byte) *protocol.Record {
+		return &protocol.Record{Key: []byte{0, 0, 0, typ}, Value: []byte{0, 0, 0, 0, 0, 0}}
+	}
+
+	appendBatch(transactional, 1, &protocol.Record{Value: []byte("a")}, &protocol.Record{OffsetDelta: 1, Value: []byte("b")})
+	appendBatch(0, -1, &protocol.Record{Value: []byte("c")})
+	appendBatch(transactional, 2, &protocol.Record{Value: []byte("d")})
+	req.Equal(int64(0), l.LastStableOffset())
+	appendBatch(transactional|control, 1, marker(0))
+	req.Equal(int64(3), l.LastStableOffset())
+	appendBatch(transactional|control, 2, marker(1))
+	req.Equal(int64(6), l.LastStableOffset())
+
+	aborted := []commitlog.AbortedTxn{{ProducerID: 1, FirstOffset: 0, LastOffset: 4}}
+	req.Equal(aborted, l.AbortedTransactions(0, 6))
+	req.Equal(aborted, l.AbortedTransactions(2, 3))
+	req.Empty(l.AbortedTransactions(5, 6))
+
+	// the transactions are reloaded when the log's reopened.
+	appendBatch(transactional, 3, &protocol.Record{Value: []byte("e")})
+	req.NoError(l.Close())
+	l, err = commitlog.New(opts)
+	req.NoError(err)
+	defer l.Close()
+	req.Equal(int64(6), l.LastStableOffset())
+	req.Equal(aborted, l.AbortedTransactions(0, 7))
+	index, err := ioutil.ReadFile(filepath.Join(path, "00000000000000000000.txnindex"))
+	req.NoError(err)
+	req.Len(index, 24)
+}
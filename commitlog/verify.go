@@ -0,0 +1,234 @@
+package commitlog
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The invariants Verify checks, as reported in violations.
+const (
+	// InvariantReadable is that the segment's log and index files can be read.
+	InvariantReadable = "readable"
+	// InvariantIntact is that every message set is whole and its CRCs match.
+	InvariantIntact = "intact"
+	// InvariantMonotonicOffsets is that every message set's offsets follow the one before it, and
+	// a segment's follow its base offset.
+	InvariantMonotonicOffsets = "monotonic_offsets"
+	// InvariantIndexEntries is that the index's offsets increase and its entries point at the
+	// start of the message set with their offset.
+	InvariantIndexEntries = "index_entries"
+	// InvariantBatchTimestamps is that a batch's timestamps don't decrease and don't pass its max
+	// timestamp.
+	InvariantBatchTimestamps = "batch_timestamps"
+)
+
+// VerifyResult is what Verify found checking a log.
+type VerifyResult struct {
+	Path         string      `json:"path"`
+	Segments     int         `json:"segments"`
+	MessageSets  int         `json:"message_sets"`
+	OldestOffset int64       `json:"oldest_offset"`
+	NewestOffset int64       `json:"newest_offset"`
+	Violations   []Violation `json:"violations"`
+}
+
+// Valid returns whether the log didn't violate any invariant.
+func (r *VerifyResult) Valid() bool {
+	return len(r.Violations) == 0
+}
+
+// Violation is a broken invariant of a log's files.
+type Violation struct {
+	Path      string `json:"path"`
+	Invariant string `json:"invariant"`
+	// Position is the byte position in the log, or in the index, the violation's at.
+	Position int64  `json:"position"`
+	Offset   int64  `json:"offset"`
+	Detail   string `json:"detail"`
+}
+
+// Verify walks the segments and indexes of the log in the dir and checks its invariants, so a
+// backup or restore can be checked before it's relied on. Unlike Repair it only reads the files,
+// and it reads the whole of them, so it's slower but can be run on a copy of a live log. A
+// segment's message sets after one that's torn or corrupt aren't checked.
+func Verify(path string) (*VerifyResult, error) {
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read dir failed")
+	}
+	var bases []int64
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasSuffix(strings.TrimSuffix(name, compressedSuffix), logSuffix) {
+			continue
+		}
+		base, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimSuffix(name, compressedSuffix), logSuffix), 10, 64)
+		if err != nil || base < 0 {
+			continue
+		}
+		if strings.HasSuffix(name, logSuffix) && fileExists(filepath.Join(path, name+compressedSuffix)) {
+			// left behind by an interrupted compression, the compressed log's the segment's.
+			continue
+		}
+		bases = append(bases, base)
+	}
+	sort.Slice(bases, func(i, j int) bool { return bases[i] < bases[j] })
+
+	res := &VerifyResult{Path: path, Segments: len(bases), OldestOffset: -1, NewestOffset: -1, Violations: []Violation{}}
+	next := int64(-1)
+	for _, base := range bases {
+		next = verifySegment(res, path, base, next)
+	}
+	if len(bases) != 0 {
+		res.OldestOffset = bases[0]
+		res.NewestOffset = next
+		if next < 0 {
+			res.NewestOffset = bases[len(bases)-1]
+		}
+	}
+	return res, nil
+}
+
+// verifySegment checks the segment's log and index, and returns the offset after its last
+// message set, -1 if it has none and there weren't any before.
+func verifySegment(res *VerifyResult, dir string, base, next int64) int64 {
+	violate := func(path, invariant string, position, offset int64, format string, args ...interface{}) {
+		res.Violations = append(res.Violations, Violation{
+			Path:      path,
+			Invariant: invariant,
+			Position:  position,
+			Offset:    offset,
+			Detail:    fmt.Sprintf(format, args...),
+		})
+	}
+	s, path, data, err := readSegmentFiles(dir, base)
+	if err != nil {
+		violate(path, InvariantReadable, 0, base, "%v", err)
+		return next
+	}
+	if next > base {
+		violate(path, InvariantMonotonicOffsets, 0, base, "base offset %d is before the previous segment's next offset %d", base, next)
+	}
+
+	// the positions the message sets start at, and their first and last offsets.
+	type set struct{ first, last int64 }
+	sets := make(map[int64]set)
+	var pos int64
+	for pos < int64(len(data)) {
+		rest := data[pos:]
+		if len(rest) < msgSetHeaderLen || int64(len(rest)) < msgSetHeaderLen+int64(Encoding.Uint32(rest[sizePos:])) {
+			violate(path, InvariantIntact, pos, -1, "torn message set")
+			break
+		}
+		ms := MessageSet(rest[:msgSetHeaderLen+int64(Encoding.Uint32(rest[sizePos:]))])
+		if err := checkPayload(ms.Payload()); err != nil {
+			violate(path, InvariantIntact, pos, ms.Offset(), "%v", err)
+			break
+		}
+		switch {
+		case ms.Offset() < base:
+			violate(path, InvariantMonotonicOffsets, pos, ms.Offset(), "offset is before the segment's base offset %d", base)
+		case ms.Offset() < next:
+			violate(path, InvariantMonotonicOffsets, pos, ms.Offset(), "offset is before the previous message set's next offset %d", next)
+		}
+		if problem := checkTimestamps(ms); problem != "" {
+			violate(path, InvariantBatchTimestamps, pos, ms.Offset(), "%s", problem)
+		}
+		sets[pos] = set{first: ms.Offset(), last: ms.LastOffset()}
+		next = ms.LastOffset() + 1
+		res.MessageSets++
+		pos += int64(len(ms))
+	}
+
+	index, err := ioutil.ReadFile(s.indexPath())
+	if err != nil {
+		violate(s.indexPath(), InvariantReadable, 0, base, "%v", err)
+		return next
+	}
+	if len(index)%entryWidth != 0 {
+		violate(s.indexPath(), InvariantIndexEntries, 0, base, "size isn't a whole number of entries")
+	}
+	prev := int64(-1)
+	for i := 0; i+entryWidth <= len(index); i += entryWidth {
+		var e Entry
+		relEntry{
+			Offset:   int32(Encoding.Uint32(index[i+offsetOffset:])),
+			Position: int32(Encoding.Uint32(index[i+positionOffset:])),
+		}.fill(&e, base)
+		if i > 0 && e.Offset == base && e.Position == 0 {
+			// the rest of an open index's preallocated space.
+			break
+		}
+		if e.Position >= pos && pos < int64(len(data)) {
+			// the sets from where the log's torn or corrupt weren't checked.
+			break
+		}
+		set, ok := sets[e.Position]
+		switch {
+		case e.Offset <= prev:
+			violate(s.indexPath(), InvariantIndexEntries, int64(i), e.Offset, "offset isn't after the previous entry's %d", prev)
+		case !ok:
+			violate(s.indexPath(), InvariantIndexEntries, int64(i), e.Offset, "position %d isn't the start of a message set", e.Position)
+		case e.Offset < set.first || e.Offset > set.last:
+			violate(s.indexPath(), InvariantIndexEntries, int64(i), e.Offset, "message set at position %d has offsets %d to %d", e.Position, set.first, set.last)
+		}
+		prev = e.Offset
+	}
+	return next
+}
+
+// checkTimestamps returns what's wrong with the message set's timestamps: a legacy message set's
+// messages' mustn't decrease, and a record batch's records' mustn't decrease or pass its max
+// timestamp. The records of compressed batches aren't checked, nor are those of batches whose max
+// timestamp is the log append time.
+func checkTimestamps(ms MessageSet) string {
+	if !ms.IsRecordBatch() {
+		last := int64(-1)
+		for _, m := range ms.Messages() {
+			if m.MagicByte() == 0 || m.Timestamp() < 0 {
+				continue
+			}
+			if m.Timestamp() < last {
+				return fmt.Sprintf("message timestamp %d is before the previous message's %d", m.Timestamp(), last)
+			}
+			last = m.Timestamp()
+		}
+		return ""
+	}
+	first := int64(Encoding.Uint64(ms[firstTimestampPos:]))
+	max := int64(Encoding.Uint64(ms[maxTimestampPos:]))
+	if first < 0 || Encoding.Uint16(ms[batchAttributesPos:])&timestampTypeMask != 0 {
+		return ""
+	}
+	if max < first {
+		return fmt.Sprintf("max timestamp %d is before the first timestamp %d", max, first)
+	}
+	deltas, ok := ms.timestampDeltas()
+	if !ok {
+		return ""
+	}
+	last := first
+	for _, d := range deltas {
+		ts := first + d
+		if ts < last {
+			return fmt.Sprintf("record timestamp %d is before the previous record's %d", ts, last)
+		}
+		if ts > max {
+			return fmt.Sprintf("record timestamp %d is after the max timestamp %d", ts, max)
+		}
+		last = ts
+	}
+	return ""
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
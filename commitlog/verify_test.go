@@ -0,0 +1,111 @@
+package commitlog_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/commitlog"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestVerify(t *testing.T) {
+	req := require.New(t)
+	path, err := ioutil.TempDir("", "verify")
+	req.NoError(err)
+	defer os.RemoveAll(path)
+	l, err := commitlog.New(commitlog.Options{Path: path, MaxSegmentBytes: 100, MaxLogBytes: -1})
+	req.NoError(err)
+	now := time.Unix(1500000000, 0)
+	for i := 0; i < 6; i++ {
+		var set []byte
+		if i%2 == 0 {
+			set, err = protocol.Encode(&protocol.MessageSet{Messages: []*protocol.Message{{MagicByte: 1, Timestamp: now, Value: []byte(fmt.Sprintf("value %d", i))}}})
+		} else {
+			set, err = protocol.Encode(&protocol.RecordBatch{
+				LastOffsetDelta: 1,
+				FirstTimestamp:  now,
+				MaxTimestamp:    now.Add(time.Second),
+				Records:         []*protocol.Record{{Value: []byte("a")}, {OffsetDelta: 1, TimestampDelta: time.Second, Value: []byte("b")}},
+			})
+		}
+		req.NoError(err)
+		_, err = l.Append(set)
+		req.NoError(err)
+	}
+	segments := l.Segments()
+	req.True(len(segments) >= 3)
+	req.NoError(l.Close())
+	file := func(s *commitlog.Segment, suffix string) string {
+		return filepath.Join(path, fmt.Sprintf("%020d%s", s.BaseOffset, suffix))
+	}
+
+	res, err := commitlog.Verify(path)
+	req.NoError(err)
+	req.True(res.Valid(), "%v", res.Violations)
+	req.Equal(len(segments), res.Segments)
+	req.Equal(6, res.MessageSets)
+	req.Equal(int64(0), res.OldestOffset)
+	req.Equal(int64(9), res.NewestOffset)
+
+	// a batch overlapping the last one's offsets, a corrupt set and a bad index entry.
+	overlapping, err := protocol.Encode(&protocol.RecordBatch{
+		FirstOffset:     8,
+		LastOffsetDelta: 1,
+		FirstTimestamp:  now,
+		MaxTimestamp:    now,
+		Records:         []*protocol.Record{{Value: []byte("a")}, {OffsetDelta: 1, Value: []byte("b")}},
+	})
+	req.NoError(err)
+	active := segments[len(segments)-1]
+	f, err := os.OpenFile(file(active, ".log"), os.O_APPEND|os.O_WRONLY, 0644)
+	req.NoError(err)
+	_, err = f.Write(overlapping)
+	req.NoError(err)
+	req.NoError(f.Close())
+	data, err := ioutil.ReadFile(file(segments[0], ".log"))
+	req.NoError(err)
+	data[len(data)-1] ^= 0xff
+	req.NoError(ioutil.WriteFile(file(segments[0], ".log"), data, 0644))
+	index, err := ioutil.ReadFile(file(segments[1], ".index"))
+	req.NoError(err)
+	commitlog.Encoding.PutUint32(index[4:], 1)
+	req.NoError(ioutil.WriteFile(file(segments[1], ".index"), index, 0644))
+
+	res, err = commitlog.Verify(path)
+	req.NoError(err)
+	got := make(map[string]string)
+	for _, v := range res.Violations {
+		got[v.Path] = v.Invariant
+	}
+	req.Equal(map[string]string{
+		file(segments[0], ".log"):   commitlog.InvariantIntact,
+		file(segments[1], ".index"): commitlog.InvariantIndexEntries,
+		file(active, ".log"):        commitlog.InvariantMonotonicOffsets,
+	}, got)
+
+	// a batch whose records' timestamps go backwards.
+	backwards, err := protocol.Encode(&protocol.RecordBatch{
+		FirstOffset:     20,
+		LastOffsetDelta: 1,
+		FirstTimestamp:  now,
+		MaxTimestamp:    now,
+		Records:         []*protocol.Record{{Value: []byte("a")}, {OffsetDelta: 1, TimestampDelta: -time.Second, Value: []byte("b")}},
+	})
+	req.NoError(err)
+	f, err = os.OpenFile(file(active, ".log"), os.O_APPEND|os.O_WRONLY, 0644)
+	req.NoError(err)
+	_, err = f.Write(backwards)
+	req.NoError(err)
+	req.NoError(f.Close())
+	res, err = commitlog.Verify(path)
+	req.NoError(err)
+	last := res.Violations[len(res.Violations)-1]
+	req.Equal(commitlog.InvariantBatchTimestamps, last.Invariant)
+	req.Equal(int64(20), last.Offset)
+	req.Equal(int64(22), res.NewestOffset)
+}
@@ -0,0 +1,69 @@
+//go:build linux
+// +build linux
+
+package commitlog
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// maxIovecs is the most buffers a writev call takes, Linux's IOV_MAX.
+const maxIovecs = 1024
+
+// writev writes the buffers to the file, one after another, with a writev call for up to
+// maxIovecs of them rather than a write and a copy each.
+func writev(f *os.File, bufs [][]byte) (n int, err error) {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	iovs := make([]syscall.Iovec, 0, maxIovecs)
+	for {
+		iovs = iovs[:0]
+		for _, b := range bufs {
+			if len(iovs) == maxIovecs {
+				break
+			}
+			if len(b) == 0 {
+				continue
+			}
+			iov := syscall.Iovec{Base: &b[0]}
+			iov.SetLen(len(b))
+			iovs = append(iovs, iov)
+		}
+		if len(iovs) == 0 {
+			return n, nil
+		}
+		var written uintptr
+		var errno syscall.Errno
+		if err := rc.Write(func(fd uintptr) bool {
+			written, _, errno = syscall.Syscall(syscall.SYS_WRITEV, fd, uintptr(unsafe.Pointer(&iovs[0])), uintptr(len(iovs)))
+			return errno != syscall.EAGAIN
+		}); err != nil {
+			return n, err
+		}
+		if errno == syscall.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return n, os.NewSyscallError("writev", errno)
+		}
+		n += int(written)
+		// a short write's continued from where it stopped.
+		bufs = consumeBuffers(bufs, int(written))
+	}
+}
+
+// consumeBuffers returns the buffers after their first n bytes.
+func consumeBuffers(bufs [][]byte, n int) [][]byte {
+	for len(bufs) > 0 && n >= len(bufs[0]) {
+		n -= len(bufs[0])
+		bufs = bufs[1:]
+	}
+	if len(bufs) > 0 {
+		bufs = append([][]byte{bufs[0][n:]}, bufs[1:]...)
+	}
+	return bufs
+}
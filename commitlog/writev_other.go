@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+package commitlog
+
+import "os"
+
+// writev writes the buffers to the file one after another, with a write each on platforms without
+// writev.
+func writev(f *os.File, bufs [][]byte) (n int, err error) {
+	for _, b := range bufs {
+		m, err := f.Write(b)
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
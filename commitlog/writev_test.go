@@ -0,0 +1,32 @@
+package commitlog
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWritev(t *testing.T) {
+	f, err := ioutil.TempFile("", "commitlog-writev")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	// more buffers than a writev call takes, some of them empty.
+	var bufs [][]byte
+	var expected []byte
+	for i := 0; i < 3000; i++ {
+		b := bytes.Repeat([]byte{byte(i)}, i%3)
+		bufs = append(bufs, b)
+		expected = append(expected, b...)
+	}
+	n, err := writev(f, bufs)
+	require.NoError(t, err)
+	require.Equal(t, len(expected), n)
+	written, err := ioutil.ReadFile(f.Name())
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(expected, written))
+}
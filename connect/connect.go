@@ -0,0 +1,162 @@
+// Package connect runs connectors moving data between jocko and external systems, so simple
+// pipelines don't need Kafka Connect. Sources read records from a system and produce them to a
+// topic, sinks consume a topic's records and write them to a system. A worker runs the connectors
+// created through its admin API, with the built-in file and S3 connectors or others plugged in.
+//
+// Connectors deliver records at least once: sources' positions are saved once their records are
+// produced, and sinks' offsets are committed once their records are flushed, so records read or
+// written before a crash are read or written again after it.
+package connect
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/travisjeffery/jocko/client"
+)
+
+var (
+	// ErrConnectorExists is returned creating a connector whose name's taken.
+	ErrConnectorExists = errors.New("connect: connector exists")
+	// ErrConnectorNotFound is returned for connectors the worker isn't running.
+	ErrConnectorNotFound = errors.New("connect: connector not found")
+)
+
+// Source reads records from an external system. It's only used by one goroutine at a time.
+type Source interface {
+	// Open opens the source to read from the position, a position returned by Read, or from the
+	// start if it's empty.
+	Open(position string) error
+	// Read returns the records read since the last read and the position after them, or no
+	// records if there are none yet.
+	Read() ([]*client.Record, string, error)
+	Close() error
+}
+
+// Sink writes records consumed from a topic to an external system. It's only used by one
+// goroutine at a time.
+type Sink interface {
+	// Write writes the records, possibly buffering them until they're flushed.
+	Write(records []*client.Record) error
+	// Flush makes the records written durable. Their offsets are committed once it returns.
+	Flush() error
+	Close() error
+}
+
+// Plugin creates a type of connector's source or sink from the connectors' configs.
+type Plugin struct {
+	NewSource func(config map[string]string) (Source, error)
+	NewSink   func(config map[string]string) (Sink, error)
+}
+
+// Plugins returns the built-in connector types by name: file-source, file-sink, s3-source and
+// s3-sink.
+func Plugins() map[string]Plugin {
+	return map[string]Plugin{
+		"file-source": {NewSource: NewFileSource},
+		"file-sink":   {NewSink: NewFileSink},
+		"s3-source":   {NewSource: NewS3Source},
+		"s3-sink":     {NewSink: NewS3Sink},
+	}
+}
+
+// ConnectorConfig is a connector's config: its name, unique to the worker, its type, the name of
+// its plugin, and its config's key/value pairs. All connectors take:
+//
+//	topic           the topic a source produces to or a sink consumes, required.
+//	poll.interval   how long a source waits to read again after reading nothing, or a sink waits
+//	                for records to consume. Defaults to 1s.
+//
+// Sources take:
+//
+//	partition       the partition produced to. Defaults to 0.
+//
+// Sinks take:
+//
+//	group           the group the sink commits its offsets to. Defaults to connect-<name>.
+//	flush.interval  how often the sink flushes its records and commits their offsets. Defaults
+//	                to 10s.
+//
+// The plugins' keys are documented with their sources and sinks.
+type ConnectorConfig struct {
+	Name   string            `json:"name"`
+	Type   string            `json:"type"`
+	Config map[string]string `json:"config"`
+}
+
+// Connector states.
+const (
+	StateRunning = "running"
+	StateFailed  = "failed"
+	StateStopped = "stopped"
+)
+
+// Status is a connector's config and state, with the error it failed with if it's failed.
+type Status struct {
+	ConnectorConfig
+	State string `json:"state"`
+	Error string `json:"error,omitempty"`
+}
+
+// validName returns whether the connector name is made up of letters, digits, dots, dashes, and
+// underscores, so it's safe to name the worker's files after.
+func validName(name string) bool {
+	if name == "" || name == "." || name == ".." {
+		return false
+	}
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// duration returns the config's duration, or the default if it's unset.
+func duration(config map[string]string, key string, def time.Duration) (time.Duration, error) {
+	v, ok := config[key]
+	if !ok || v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", key, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%s: must be positive", key)
+	}
+	return d, nil
+}
+
+// integer returns the config's integer, or the default if it's unset.
+func integer(config map[string]string, key string, def int) (int, error) {
+	v, ok := config[key]
+	if !ok || v == "" {
+		return def, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", key, err)
+	}
+	return i, nil
+}
+
+// required returns an error naming the keys unset in the config, if any are.
+func required(config map[string]string, keys ...string) error {
+	var missing []string
+	for _, k := range keys {
+		if config[k] == "" {
+			missing = append(missing, k)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	return fmt.Errorf("missing required config: %v", missing)
+}
@@ -0,0 +1,152 @@
+package connect
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/client"
+	"github.com/travisjeffery/jocko/jocko"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestWorker_FileConnectors(t *testing.T) {
+	s, dir := jocko.NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+	}, nil)
+	defer os.RemoveAll(dir)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, s.Start(ctx))
+	defer s.Shutdown()
+	jocko.WaitForLeader(t, s)
+	conn, err := jocko.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	res, err := conn.CreateTopics(&protocol.CreateTopicRequests{
+		Timeout:  time.Second,
+		Requests: []*protocol.CreateTopicRequest{{Topic: "lines", NumPartitions: 2, ReplicationFactor: 1}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrNone.Code(), res.TopicErrorCodes[0].ErrorCode)
+
+	c, err := client.New(client.Config{Brokers: []string{s.Addr().String()}})
+	require.NoError(t, err)
+	defer c.Close()
+	tmp, err := ioutil.TempDir("", "jocko-connect")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	workerDir := filepath.Join(tmp, "worker")
+	in, out := filepath.Join(tmp, "in.txt"), filepath.Join(tmp, "out.txt")
+
+	w, err := NewWorker(c, workerDir, Plugins())
+	require.NoError(t, err)
+	api := httptest.NewServer(Handler(w))
+	defer api.Close()
+
+	request := func(method, path string, body interface{}) (int, []byte) {
+		var r bytes.Buffer
+		if body != nil {
+			require.NoError(t, json.NewEncoder(&r).Encode(body))
+		}
+		req, err := http.NewRequest(method, api.URL+path, &r)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, b
+	}
+	source := ConnectorConfig{Name: "lines-in", Type: "file-source", Config: map[string]string{
+		"topic": "lines", "partition": "1", "file": in, "poll.interval": "10ms",
+	}}
+	sink := ConnectorConfig{Name: "lines-out", Type: "file-sink", Config: map[string]string{
+		"topic": "lines", "file": out, "poll.interval": "10ms", "flush.interval": "10ms",
+	}}
+	code, body := request("POST", "/connectors", source)
+	require.Equal(t, http.StatusCreated, code, string(body))
+	var status Status
+	require.NoError(t, json.Unmarshal(body, &status))
+	require.Equal(t, Status{ConnectorConfig: source, State: StateRunning}, status)
+	code, body = request("POST", "/connectors", sink)
+	require.Equal(t, http.StatusCreated, code, string(body))
+
+	code, _ = request("POST", "/connectors", source)
+	require.Equal(t, http.StatusConflict, code)
+	code, _ = request("POST", "/connectors", ConnectorConfig{Name: "unknown", Type: "unknown", Config: map[string]string{"topic": "lines"}})
+	require.Equal(t, http.StatusBadRequest, code)
+	code, body = request("POST", "/connectors", ConnectorConfig{Name: "no-file", Type: "file-sink", Config: map[string]string{"topic": "lines"}})
+	require.Equal(t, http.StatusBadRequest, code)
+	require.Contains(t, string(body), "missing required config: [file]")
+	code, _ = request("POST", "/connectors", ConnectorConfig{Name: "../escape", Type: "file-sink"})
+	require.Equal(t, http.StatusBadRequest, code)
+
+	waitFor := func(want string) {
+		for deadline := time.Now().Add(10 * time.Second); ; {
+			got, _ := ioutil.ReadFile(out)
+			if string(got) == want {
+				return
+			}
+			require.True(t, time.Now().Before(deadline), "out: %q, want: %q", got, want)
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	appendIn := func(s string) {
+		f, err := os.OpenFile(in, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		require.NoError(t, err)
+		_, err = f.WriteString(s)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+	// the source reads the file once it exists, a line once it's ended.
+	appendIn("a\nb\nc")
+	waitFor("a\nb\n")
+	appendIn("\n")
+	waitFor("a\nb\nc\n")
+
+	code, body = request("GET", "/connectors", nil)
+	require.Equal(t, http.StatusOK, code)
+	var statuses []Status
+	require.NoError(t, json.Unmarshal(body, &statuses))
+	require.Equal(t, []Status{{ConnectorConfig: source, State: StateRunning}, {ConnectorConfig: sink, State: StateRunning}}, statuses)
+	code, body = request("POST", "/connectors/lines-out/restart", nil)
+	require.Equal(t, http.StatusOK, code, string(body))
+
+	// a new worker with the dir resumes the connectors where they left off.
+	require.NoError(t, w.Close())
+	position, err := ioutil.ReadFile(filepath.Join(workerDir, "lines-in.position"))
+	require.NoError(t, err)
+	require.Equal(t, "6", string(position))
+	w, err = NewWorker(c, workerDir, Plugins())
+	require.NoError(t, err)
+	defer w.Close()
+	api.Config.Handler = Handler(w)
+	appendIn("d\n")
+	waitFor("a\nb\nc\nd\n")
+
+	code, _ = request("DELETE", "/connectors/lines-in", nil)
+	require.Equal(t, http.StatusNoContent, code)
+	code, _ = request("GET", "/connectors/lines-in", nil)
+	require.Equal(t, http.StatusNotFound, code)
+	code, _ = request("DELETE", "/connectors/lines-in", nil)
+	require.Equal(t, http.StatusNotFound, code)
+	_, err = os.Stat(filepath.Join(workerDir, "lines-in.json"))
+	require.True(t, os.IsNotExist(err))
+	code, body = request("GET", "/connectors/lines-out", nil)
+	require.Equal(t, http.StatusOK, code)
+	require.NoError(t, json.Unmarshal(body, &status))
+	require.Equal(t, StateRunning, status.State)
+}
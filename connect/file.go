@@ -0,0 +1,150 @@
+package connect
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/travisjeffery/jocko/client"
+)
+
+// fileSourceReadBytes is the most bytes a file source reads at a time, and so the longest line it
+// reads.
+const fileSourceReadBytes = 1 << 20
+
+// FileSource reads a file's lines as records' values, following the lines appended to it, e.g. a
+// log file. Its position is the byte offset of the next line to read, and a line's only read once
+// it ends with a newline. It takes:
+//
+//	file  the path of the file to read, required. It's read once it exists.
+type FileSource struct {
+	path   string
+	f      *os.File
+	offset int64
+}
+
+// NewFileSource returns a file source with the config.
+func NewFileSource(config map[string]string) (Source, error) {
+	if err := required(config, "file"); err != nil {
+		return nil, err
+	}
+	return &FileSource{path: config["file"]}, nil
+}
+
+// Open sets the offset to read the file from.
+func (s *FileSource) Open(position string) error {
+	if position == "" {
+		return nil
+	}
+	offset, err := strconv.ParseInt(position, 10, 64)
+	if err != nil {
+		return fmt.Errorf("file source: bad position %q: %v", position, err)
+	}
+	s.offset = offset
+	return nil
+}
+
+// Read returns the lines appended to the file since the last read, if it exists yet.
+func (s *FileSource) Read() ([]*client.Record, string, error) {
+	position := strconv.FormatInt(s.offset, 10)
+	if s.f == nil {
+		f, err := os.Open(s.path)
+		if os.IsNotExist(err) {
+			return nil, position, nil
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		s.f = f
+	}
+	buf := make([]byte, fileSourceReadBytes)
+	n, err := s.f.ReadAt(buf, s.offset)
+	if err != nil && err != io.EOF {
+		return nil, "", err
+	}
+	end := bytes.LastIndexByte(buf[:n], '\n')
+	if end < 0 {
+		if n == len(buf) {
+			return nil, "", fmt.Errorf("file source: %s: line at offset %d is longer than %d bytes", s.path, s.offset, fileSourceReadBytes)
+		}
+		return nil, position, nil
+	}
+	lines := bytes.Split(buf[:end], []byte{'\n'})
+	records := make([]*client.Record, len(lines))
+	for i, line := range lines {
+		records[i] = &client.Record{Value: line}
+	}
+	s.offset += int64(end) + 1
+	return records, strconv.FormatInt(s.offset, 10), nil
+}
+
+// Close closes the file.
+func (s *FileSource) Close() error {
+	if s.f == nil {
+		return nil
+	}
+	return s.f.Close()
+}
+
+// FileSink appends records' values to a file, a line each. It takes:
+//
+//	file  the path of the file to append to, required. It's created if it doesn't exist.
+type FileSink struct {
+	path string
+	f    *os.File
+	w    *bufio.Writer
+}
+
+// NewFileSink returns a file sink with the config.
+func NewFileSink(config map[string]string) (Sink, error) {
+	if err := required(config, "file"); err != nil {
+		return nil, err
+	}
+	return &FileSink{path: config["file"]}, nil
+}
+
+// Write buffers the records' lines, opening the file on the first write.
+func (s *FileSink) Write(records []*client.Record) error {
+	if s.f == nil {
+		f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		s.f, s.w = f, bufio.NewWriter(f)
+	}
+	for _, r := range records {
+		if _, err := s.w.Write(r.Value); err != nil {
+			return err
+		}
+		if err := s.w.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush writes the buffered lines to the file and syncs it.
+func (s *FileSink) Flush() error {
+	if s.f == nil {
+		return nil
+	}
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	return s.f.Sync()
+}
+
+// Close writes the buffered lines and closes the file.
+func (s *FileSink) Close() error {
+	if s.f == nil {
+		return nil
+	}
+	if err := s.w.Flush(); err != nil {
+		s.f.Close()
+		return err
+	}
+	return s.f.Close()
+}
@@ -0,0 +1,113 @@
+package connect
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/travisjeffery/jocko/client"
+)
+
+// Handler returns the worker's admin API, a JSON API managing its connectors:
+//
+//	GET    /connectors                the connectors' statuses.
+//	POST   /connectors                create a connector from its config in the body.
+//	GET    /connectors/<name>         the connector's status.
+//	DELETE /connectors/<name>         stop and delete the connector.
+//	POST   /connectors/<name>/restart restart the connector.
+//
+// Errors are responded with an object with the error's message, e.g. {"error": "..."}.
+func Handler(w *Worker) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/connectors", func(rw http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			writeJSON(rw, http.StatusOK, w.Connectors())
+		case "POST":
+			var config ConnectorConfig
+			if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+				writeError(rw, http.StatusBadRequest, err)
+				return
+			}
+			if err := w.Create(config); err != nil {
+				writeError(rw, errorStatus(err), err)
+				return
+			}
+			status, err := w.Status(config.Name)
+			if err != nil {
+				writeError(rw, errorStatus(err), err)
+				return
+			}
+			writeJSON(rw, http.StatusCreated, status)
+		default:
+			writeError(rw, http.StatusMethodNotAllowed, nil)
+		}
+	})
+	mux.HandleFunc("/connectors/", func(rw http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/connectors/")
+		if strings.HasSuffix(name, "/restart") {
+			if r.Method != "POST" {
+				writeError(rw, http.StatusMethodNotAllowed, nil)
+				return
+			}
+			name = strings.TrimSuffix(name, "/restart")
+			if err := w.Restart(name); err != nil {
+				writeError(rw, errorStatus(err), err)
+				return
+			}
+			status, err := w.Status(name)
+			if err != nil {
+				writeError(rw, errorStatus(err), err)
+				return
+			}
+			writeJSON(rw, http.StatusOK, status)
+			return
+		}
+		switch r.Method {
+		case "GET":
+			status, err := w.Status(name)
+			if err != nil {
+				writeError(rw, errorStatus(err), err)
+				return
+			}
+			writeJSON(rw, http.StatusOK, status)
+		case "DELETE":
+			if err := w.Delete(name); err != nil {
+				writeError(rw, errorStatus(err), err)
+				return
+			}
+			rw.WriteHeader(http.StatusNoContent)
+		default:
+			writeError(rw, http.StatusMethodNotAllowed, nil)
+		}
+	})
+	return mux
+}
+
+// errorStatus returns the HTTP status of the worker's error.
+func errorStatus(err error) int {
+	switch err {
+	case ErrConnectorNotFound:
+		return http.StatusNotFound
+	case ErrConnectorExists:
+		return http.StatusConflict
+	case client.ErrClosed:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadRequest
+}
+
+func writeJSON(rw http.ResponseWriter, status int, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	json.NewEncoder(rw).Encode(v)
+}
+
+// writeError writes the error's message, or the status's text if there's no error.
+func writeError(rw http.ResponseWriter, status int, err error) {
+	msg := http.StatusText(status)
+	if err != nil {
+		msg = err.Error()
+	}
+	writeJSON(rw, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,285 @@
+package connect
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/travisjeffery/jocko/client"
+	"github.com/travisjeffery/jocko/sigv4"
+)
+
+// s3Bucket is an S3 bucket, requested with path style URLs so S3 compatible stores work too.
+type s3Bucket struct {
+	endpoint string
+	bucket   string
+	region   string
+	creds    sigv4.Credentials
+	client   *http.Client
+}
+
+// newS3Bucket returns the bucket of the config's S3 keys:
+//
+//	bucket             the bucket, required.
+//	region             the bucket's region. Defaults to AWS_REGION, or us-east-1.
+//	endpoint           the S3 endpoint. Defaults to the region's.
+//	access.key.id      the credentials, which default to the AWS_ACCESS_KEY_ID,
+//	secret.access.key  AWS_SECRET_ACCESS_KEY, and AWS_SESSION_TOKEN env vars.
+//	session.token
+func newS3Bucket(config map[string]string) (*s3Bucket, error) {
+	if err := required(config, "bucket"); err != nil {
+		return nil, err
+	}
+	b := &s3Bucket{
+		bucket:   config["bucket"],
+		region:   config["region"],
+		endpoint: config["endpoint"],
+		creds: sigv4.Credentials{
+			AccessKeyID:     config["access.key.id"],
+			SecretAccessKey: config["secret.access.key"],
+			SessionToken:    config["session.token"],
+		},
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+	if b.region == "" {
+		b.region = os.Getenv("AWS_REGION")
+	}
+	if b.region == "" {
+		b.region = "us-east-1"
+	}
+	if b.endpoint == "" {
+		b.endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", b.region)
+	}
+	b.endpoint = strings.TrimSuffix(b.endpoint, "/")
+	if b.creds.AccessKeyID == "" {
+		b.creds = sigv4.Credentials{
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+	}
+	if b.creds.AccessKeyID == "" || b.creds.SecretAccessKey == "" {
+		return nil, errors.New("no S3 credentials: set access.key.id and secret.access.key, or AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	return b, nil
+}
+
+// put puts the object.
+func (b *s3Bucket) put(key string, body []byte) error {
+	_, err := b.do("PUT", key, nil, body)
+	return err
+}
+
+// get gets the object.
+func (b *s3Bucket) get(key string) ([]byte, error) {
+	return b.do("GET", key, nil, nil)
+}
+
+// next returns the key of the object with the prefix after the key in key order, or "" if there's
+// none.
+func (b *s3Bucket) next(prefix, after string) (string, error) {
+	q := url.Values{"list-type": {"2"}, "max-keys": {"1"}, "prefix": {prefix}}
+	if after != "" {
+		q.Set("start-after", after)
+	}
+	body, err := b.do("GET", "", q, nil)
+	if err != nil {
+		return "", err
+	}
+	var res struct {
+		Contents []struct {
+			Key string `xml:"Key"`
+		} `xml:"Contents"`
+	}
+	if err := xml.Unmarshal(body, &res); err != nil {
+		return "", fmt.Errorf("s3: decode list: %v", err)
+	}
+	if len(res.Contents) == 0 {
+		return "", nil
+	}
+	return res.Contents[0].Key, nil
+}
+
+// do sends the signed request for the object, or the bucket if the key's empty, and returns the
+// response's body.
+func (b *s3Bucket) do(method, key string, query url.Values, body []byte) ([]byte, error) {
+	path := "/" + s3Escape(b.bucket)
+	if key != "" {
+		path += "/" + s3Escape(key)
+	}
+	u, err := url.Parse(b.endpoint + path)
+	if err != nil {
+		return nil, err
+	}
+	// url.Values encodes spaces as +, signatures need them as %20.
+	u.RawQuery = strings.Replace(query.Encode(), "+", "%20", -1)
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	b.sign(req, body, time.Now())
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	res, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("s3: %s %s: %s: %s", method, path, resp.Status, res)
+	}
+	return res, nil
+}
+
+// sign signs the request with AWS's signature version 4, signing the body's hash, which S3
+// requires in the x-amz-content-sha256 header.
+func (b *s3Bucket) sign(req *http.Request, body []byte, now time.Time) {
+	req.Header.Set("X-Amz-Content-Sha256", sigv4.PayloadHash(body))
+	sigv4.Sign(req, body, b.creds, b.region, "s3", now)
+}
+
+// s3Escape escapes the key as signatures need it: every byte but the unreserved characters and
+// slashes percent encoded.
+func s3Escape(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// S3Source reads the lines of a bucket's objects as records' values, an object at a time in key
+// order, following the objects put after them. Its position is the key of the last object read,
+// so objects must be immutable and put in key order, like an S3 sink's objects of a partition are:
+// to read them set the prefix to the partition's, e.g. <prefix><topic>/0/. It takes the bucket's
+// keys and:
+//
+//	prefix  the prefix of the objects to read.
+type S3Source struct {
+	bucket *s3Bucket
+	prefix string
+	last   string
+}
+
+// NewS3Source returns an S3 source with the config.
+func NewS3Source(config map[string]string) (Source, error) {
+	b, err := newS3Bucket(config)
+	if err != nil {
+		return nil, err
+	}
+	return &S3Source{bucket: b, prefix: config["prefix"]}, nil
+}
+
+// Open sets the key of the last object read.
+func (s *S3Source) Open(position string) error {
+	s.last = position
+	return nil
+}
+
+// Read returns the lines of the next object, if one's been put.
+func (s *S3Source) Read() ([]*client.Record, string, error) {
+	key, err := s.bucket.next(s.prefix, s.last)
+	if err != nil || key == "" {
+		return nil, s.last, err
+	}
+	body, err := s.bucket.get(key)
+	if err != nil {
+		return nil, "", err
+	}
+	s.last = key
+	body = bytes.TrimSuffix(body, []byte{'\n'})
+	if len(body) == 0 {
+		return nil, s.last, nil
+	}
+	lines := bytes.Split(body, []byte{'\n'})
+	records := make([]*client.Record, len(lines))
+	for i, line := range lines {
+		records[i] = &client.Record{Value: line}
+	}
+	return records, s.last, nil
+}
+
+// Close does nothing, the source holds no resources.
+func (s *S3Source) Close() error {
+	return nil
+}
+
+// S3Sink puts records' values in a bucket's objects, a line each. Each flush puts an object per
+// partition written to, keyed <prefix><topic>/<partition>/<first offset>.txt with the offset zero
+// padded to 20 digits, so a partition's objects sort in offset order and records written again
+// after a crash overwrite the object they were put in before it. It takes the bucket's keys and:
+//
+//	prefix  the prefix of the objects' keys.
+type S3Sink struct {
+	bucket  *s3Bucket
+	prefix  string
+	objects map[s3Partition]*s3Object
+}
+
+type s3Partition struct {
+	topic     string
+	partition int32
+}
+
+// s3Object is a partition's object buffered until it's flushed.
+type s3Object struct {
+	first int64
+	buf   bytes.Buffer
+}
+
+// NewS3Sink returns an S3 sink with the config.
+func NewS3Sink(config map[string]string) (Sink, error) {
+	b, err := newS3Bucket(config)
+	if err != nil {
+		return nil, err
+	}
+	return &S3Sink{bucket: b, prefix: config["prefix"], objects: make(map[s3Partition]*s3Object)}, nil
+}
+
+// Write buffers the records' lines in their partitions' objects.
+func (s *S3Sink) Write(records []*client.Record) error {
+	for _, r := range records {
+		p := s3Partition{topic: r.Topic, partition: r.Partition}
+		o, ok := s.objects[p]
+		if !ok {
+			o = &s3Object{first: r.Offset}
+			s.objects[p] = o
+		}
+		o.buf.Write(r.Value)
+		o.buf.WriteByte('\n')
+	}
+	return nil
+}
+
+// Flush puts the buffered objects.
+func (s *S3Sink) Flush() error {
+	for p, o := range s.objects {
+		key := fmt.Sprintf("%s%s/%d/%020d.txt", s.prefix, p.topic, p.partition, o.first)
+		if err := s.bucket.put(key, o.buf.Bytes()); err != nil {
+			return err
+		}
+		delete(s.objects, p)
+	}
+	return nil
+}
+
+// Close drops the buffered objects, their records' offsets weren't committed so they're written
+// again.
+func (s *S3Sink) Close() error {
+	s.objects = nil
+	return nil
+}
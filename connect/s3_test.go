@@ -0,0 +1,129 @@
+package connect
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/client"
+)
+
+// fakeS3 is an S3 bucket in memory, serving puts, gets, and ListObjectsV2 requests.
+type fakeS3 struct {
+	t       *testing.T
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (s *fakeS3) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	require.NoError(s.t, err)
+	hash := sha256.Sum256(body)
+	require.Equal(s.t, hex.EncodeToString(hash[:]), r.Header.Get("X-Amz-Content-Sha256"))
+	require.True(s.t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=id/"), r.Header.Get("Authorization"))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := strings.TrimPrefix(r.URL.Path, "/bucket")
+	switch {
+	case r.Method == "PUT":
+		s.objects[strings.TrimPrefix(path, "/")] = body
+	case path == "" && r.URL.Query().Get("list-type") == "2":
+		var keys []string
+		for k := range s.objects {
+			if strings.HasPrefix(k, r.URL.Query().Get("prefix")) && k > r.URL.Query().Get("start-after") {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		if len(keys) > 1 {
+			keys = keys[:1]
+		}
+		var res struct {
+			XMLName  xml.Name `xml:"ListBucketResult"`
+			Contents []struct {
+				Key string
+			}
+		}
+		for _, k := range keys {
+			res.Contents = append(res.Contents, struct{ Key string }{k})
+		}
+		require.NoError(s.t, xml.NewEncoder(rw).Encode(res))
+	default:
+		object, ok := s.objects[strings.TrimPrefix(path, "/")]
+		if !ok {
+			http.Error(rw, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		rw.Write(object)
+	}
+}
+
+func TestS3Connectors(t *testing.T) {
+	s3 := &fakeS3{t: t, objects: make(map[string][]byte)}
+	srv := httptest.NewServer(s3)
+	defer srv.Close()
+	config := map[string]string{
+		"endpoint":          srv.URL,
+		"bucket":            "bucket",
+		"access.key.id":     "id",
+		"secret.access.key": "secret",
+		"prefix":            "out/",
+	}
+
+	sink, err := NewS3Sink(config)
+	require.NoError(t, err)
+	require.NoError(t, sink.Write([]*client.Record{
+		{Topic: "t", Partition: 0, Offset: 3, Value: []byte("a")},
+		{Topic: "t", Partition: 1, Offset: 7, Value: []byte("x")},
+		{Topic: "t", Partition: 0, Offset: 4, Value: []byte("b")},
+	}))
+	require.NoError(t, sink.Flush())
+	require.NoError(t, sink.Write([]*client.Record{{Topic: "t", Partition: 0, Offset: 5, Value: []byte("c d")}}))
+	require.NoError(t, sink.Flush())
+	require.NoError(t, sink.Close())
+	require.Equal(t, map[string][]byte{
+		"out/t/0/00000000000000000003.txt": []byte("a\nb\n"),
+		"out/t/0/00000000000000000005.txt": []byte("c d\n"),
+		"out/t/1/00000000000000000007.txt": []byte("x\n"),
+	}, s3.objects)
+
+	config["prefix"] = "out/t/0/"
+	source, err := NewS3Source(config)
+	require.NoError(t, err)
+	require.NoError(t, source.Open(""))
+	records, position, err := source.Read()
+	require.NoError(t, err)
+	require.Equal(t, []*client.Record{{Value: []byte("a")}, {Value: []byte("b")}}, records)
+	require.Equal(t, "out/t/0/00000000000000000003.txt", position)
+
+	// a source opened at a position reads the objects after it.
+	source, err = NewS3Source(config)
+	require.NoError(t, err)
+	require.NoError(t, source.Open(position))
+	records, position, err = source.Read()
+	require.NoError(t, err)
+	require.Equal(t, []*client.Record{{Value: []byte("c d")}}, records)
+	require.Equal(t, "out/t/0/00000000000000000005.txt", position)
+	records, position, err = source.Read()
+	require.NoError(t, err)
+	require.Empty(t, records)
+	require.Equal(t, "out/t/0/00000000000000000005.txt", position)
+	require.NoError(t, source.Close())
+
+	delete(config, "bucket")
+	_, err = NewS3Sink(config)
+	require.EqualError(t, err, "missing required config: [bucket]")
+}
+
+func TestS3Escape(t *testing.T) {
+	require.Equal(t, "out/a%20b/c%2Bd~_-.txt", s3Escape("out/a b/c+d~_-.txt"))
+}
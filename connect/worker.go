@@ -0,0 +1,411 @@
+package connect
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/travisjeffery/jocko/client"
+	"github.com/travisjeffery/jocko/log"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+const (
+	configSuffix   = ".json"
+	positionSuffix = ".position"
+)
+
+// Worker runs connectors with a client. Their configs and sources' positions are kept in its dir,
+// so the connectors resume where they left off when a worker's started with the dir again. It's
+// safe for concurrent use.
+type Worker struct {
+	client  *client.Client
+	dir     string
+	plugins map[string]Plugin
+
+	mu         sync.Mutex
+	connectors map[string]*connector
+	closed     bool
+}
+
+// connector is a connector the worker's running, or that's failed.
+type connector struct {
+	config ConnectorConfig
+	cancel context.CancelFunc
+	done   chan struct{}
+	// err is why the connector failed, set before done's closed.
+	err error
+}
+
+// NewWorker returns a worker running connectors of the plugins' types with the client, keeping its
+// state in the dir, and starts the connectors whose configs are in the dir already. The worker
+// doesn't close the client.
+func NewWorker(c *client.Client, dir string, plugins map[string]Plugin) (*Worker, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	w := &Worker{
+		client:     c,
+		dir:        dir,
+		plugins:    plugins,
+		connectors: make(map[string]*connector),
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), configSuffix) {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var config ConnectorConfig
+		if err := json.Unmarshal(b, &config); err != nil {
+			return nil, fmt.Errorf("%s: %v", f.Name(), err)
+		}
+		w.mu.Lock()
+		w.start(config)
+		w.mu.Unlock()
+	}
+	return w, nil
+}
+
+// Create starts the connector and saves its config so it's restarted with the worker.
+func (w *Worker) Create(config ConnectorConfig) error {
+	if !validName(config.Name) {
+		return fmt.Errorf("connect: invalid connector name %q: use letters, digits, '.', '-', and '_'", config.Name)
+	}
+	if _, ok := w.plugins[config.Type]; !ok {
+		return fmt.Errorf("connect: unknown connector type %q, known are %s", config.Type, w.types())
+	}
+	if config.Config == nil {
+		config.Config = make(map[string]string)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return client.ErrClosed
+	}
+	if _, ok := w.connectors[config.Name]; ok {
+		return ErrConnectorExists
+	}
+	run, err := w.prepare(config)
+	if err != nil {
+		return fmt.Errorf("connect: %s: %v", config.Name, err)
+	}
+	b, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(w.path(config.Name, configSuffix), b); err != nil {
+		return err
+	}
+	w.run(config, run)
+	return nil
+}
+
+// Delete stops the connector and deletes its config and position. Sinks flush their records
+// before they stop.
+func (w *Worker) Delete(name string) error {
+	w.mu.Lock()
+	c, ok := w.connectors[name]
+	delete(w.connectors, name)
+	w.mu.Unlock()
+	if !ok {
+		return ErrConnectorNotFound
+	}
+	c.stop()
+	for _, suffix := range []string{configSuffix, positionSuffix} {
+		if err := os.Remove(w.path(name, suffix)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restart stops the connector and starts it again with its config, e.g. once what failed it's
+// fixed.
+func (w *Worker) Restart(name string) error {
+	w.mu.Lock()
+	c, ok := w.connectors[name]
+	w.mu.Unlock()
+	if !ok {
+		return ErrConnectorNotFound
+	}
+	c.stop()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return client.ErrClosed
+	}
+	if w.connectors[name] != c {
+		// deleted or restarted while it was stopped.
+		return ErrConnectorNotFound
+	}
+	w.start(c.config)
+	return nil
+}
+
+// Status returns the connector's status.
+func (w *Worker) Status(name string) (Status, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	c, ok := w.connectors[name]
+	if !ok {
+		return Status{}, ErrConnectorNotFound
+	}
+	return c.status(), nil
+}
+
+// Connectors returns the statuses of the worker's connectors, ordered by name.
+func (w *Worker) Connectors() []Status {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	statuses := make([]Status, 0, len(w.connectors))
+	for _, c := range w.connectors {
+		statuses = append(statuses, c.status())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// Close stops the worker's connectors, leaving their configs to be started again by the next worker
+// with the dir.
+func (w *Worker) Close() error {
+	w.mu.Lock()
+	w.closed = true
+	connectors := w.connectors
+	w.connectors = make(map[string]*connector)
+	w.mu.Unlock()
+	for _, c := range connectors {
+		c.stop()
+	}
+	return nil
+}
+
+// start starts the connector, or adds it failed if its config's invalid. It's called with the lock
+// held.
+func (w *Worker) start(config ConnectorConfig) {
+	run, err := w.prepare(config)
+	if err != nil {
+		log.Error.Printf("connect: connector %s: %s", config.Name, err)
+		done := make(chan struct{})
+		close(done)
+		w.connectors[config.Name] = &connector{config: config, cancel: func() {}, done: done, err: err}
+		return
+	}
+	w.run(config, run)
+}
+
+// run runs the connector in its own goroutine. It's called with the lock held.
+func (w *Worker) run(config ConnectorConfig, run func(ctx context.Context) error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &connector{config: config, cancel: cancel, done: make(chan struct{})}
+	w.connectors[config.Name] = c
+	go func() {
+		defer close(c.done)
+		if err := run(ctx); err != nil {
+			log.Error.Printf("connect: connector %s failed: %s", config.Name, err)
+			c.err = err
+		}
+	}()
+}
+
+// prepare creates the connector's source or sink and returns the function running it.
+func (w *Worker) prepare(config ConnectorConfig) (func(ctx context.Context) error, error) {
+	plugin, ok := w.plugins[config.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown connector type %q", config.Type)
+	}
+	if err := required(config.Config, "topic"); err != nil {
+		return nil, err
+	}
+	poll, err := duration(config.Config, "poll.interval", time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if plugin.NewSource != nil {
+		partition, err := integer(config.Config, "partition", 0)
+		if err != nil {
+			return nil, err
+		}
+		source, err := plugin.NewSource(config.Config)
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context) error {
+			return w.runSource(ctx, config.Name, source, config.Config["topic"], int32(partition), poll)
+		}, nil
+	}
+	group := config.Config["group"]
+	if group == "" {
+		group = "connect-" + config.Name
+	}
+	flush, err := duration(config.Config, "flush.interval", 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	sink, err := plugin.NewSink(config.Config)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) error {
+		return w.runSink(ctx, sink, config.Config["topic"], group, poll, flush)
+	}, nil
+}
+
+// runSource reads the source's records from its saved position and produces them to the
+// partition, saving the source's position once they're produced, until the context's done.
+func (w *Worker) runSource(ctx context.Context, name string, source Source, topic string, partition int32, poll time.Duration) error {
+	position, err := ioutil.ReadFile(w.path(name, positionSuffix))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := source.Open(string(position)); err != nil {
+		return err
+	}
+	defer source.Close()
+	producer := client.NewProducer(w.client, client.ProducerConfig{Acks: -1})
+	defer producer.Close()
+	for {
+		records, next, err := source.Read()
+		if err != nil {
+			return err
+		}
+		if len(records) > 0 {
+			msgs := make([]*protocol.Message, len(records))
+			for i, r := range records {
+				msgs[i] = &protocol.Message{Key: r.Key, Value: r.Value}
+			}
+			if _, err := producer.Produce(topic, partition, msgs...); err != nil {
+				return err
+			}
+			if err := writeFile(w.path(name, positionSuffix), []byte(next)); err != nil {
+				return err
+			}
+			if ctx.Err() != nil {
+				return nil
+			}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(poll):
+		}
+	}
+}
+
+// runSink consumes the topic's committed records from the group's offsets and writes them to the
+// sink, flushing it and committing the offsets every flush interval, and once the context's done.
+func (w *Worker) runSink(ctx context.Context, sink Sink, topic, group string, poll, flush time.Duration) error {
+	defer sink.Close()
+	partitions, err := w.client.Partitions(topic)
+	if err != nil {
+		return err
+	}
+	offsets, err := w.client.CommittedOffsets(group, topic, partitions)
+	if err != nil {
+		return err
+	}
+	consumer := client.NewConsumer(w.client, client.ConsumerConfig{MaxWait: poll, IsolationLevel: protocol.ReadCommitted})
+	defer consumer.Close()
+	for _, partition := range partitions {
+		if err := consumer.Assign(topic, partition, offsets[partition]); err != nil {
+			return err
+		}
+	}
+	next := make(map[int32]int64)
+	flushed := time.Now()
+	for {
+		records, err := consumer.Poll(poll)
+		if err != nil {
+			return err
+		}
+		if len(records) > 0 {
+			if err := sink.Write(records); err != nil {
+				return err
+			}
+			for _, r := range records {
+				next[r.Partition] = r.Offset + 1
+			}
+		}
+		done := ctx.Err() != nil
+		if !done && time.Since(flushed) < flush {
+			continue
+		}
+		if len(next) > 0 {
+			if err := sink.Flush(); err != nil {
+				return err
+			}
+			commit := make([]client.Offset, 0, len(next))
+			for partition, offset := range next {
+				commit = append(commit, client.Offset{Topic: topic, Partition: partition, Offset: offset})
+			}
+			if err := w.client.CommitOffsets(group, commit); err != nil {
+				return err
+			}
+			next = make(map[int32]int64)
+		}
+		flushed = time.Now()
+		if done {
+			return nil
+		}
+	}
+}
+
+// path returns the path of the connector's file with the suffix in the worker's dir.
+func (w *Worker) path(name, suffix string) string {
+	return filepath.Join(w.dir, name+suffix)
+}
+
+// types returns the names of the worker's plugins.
+func (w *Worker) types() string {
+	types := make([]string, 0, len(w.plugins))
+	for t := range w.plugins {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return strings.Join(types, ", ")
+}
+
+// stop stops the connector and waits for it to finish.
+func (c *connector) stop() {
+	c.cancel()
+	<-c.done
+}
+
+// status returns the connector's status.
+func (c *connector) status() Status {
+	s := Status{ConnectorConfig: c.config, State: StateRunning}
+	select {
+	case <-c.done:
+		if c.err != nil {
+			s.State, s.Error = StateFailed, c.err.Error()
+		} else {
+			s.State = StateStopped
+		}
+	default:
+	}
+	return s
+}
+
+// writeFile replaces the file's contents, writing them to a temp file first so a crash doesn't
+// leave it half written.
+func writeFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -32,6 +32,7 @@ require (
 	github.com/hashicorp/raft-boltdb v0.0.0-20191021154308-4207f1bf0617
 	github.com/hashicorp/serf v0.8.5
 	github.com/inconshreveable/mousetrap v1.0.0
+	github.com/klauspost/compress v1.9.8
 	github.com/matttproud/golang_protobuf_extensions v1.0.1
 	github.com/miekg/dns v1.0.14
 	github.com/mitchellh/go-testing-interface v0.0.0-20171004221916-a61a99592b77
@@ -58,5 +59,6 @@ require (
 	github.com/ugorji/go v0.0.0-20180112141927-9831f2c3ac10
 	golang.org/x/net v0.0.0-20181201002055-351d144fa1fc
 	golang.org/x/sys v0.0.0-20200202164722-d101bd2416d5
+	gopkg.in/yaml.v3 v3.0.1
 	upspin.io v0.0.0-20180517055408-63f1073c7a3a
 )
@@ -0,0 +1,276 @@
+// Package acl matches requests against Kafka ACLs. An ACL's resource pattern is a literal name,
+// the literal wildcard "*" matching every resource of its type, or a prefix matching the
+// resources whose names start with it, e.g. a prefixed "teamA." for every topic of a team.
+//
+// The broker doesn't authenticate clients yet, so it doesn't check requests against ACLs. An
+// authorizer built on Authorizer needs principals from the client's TLS certificate or SASL.
+package acl
+
+import (
+	"fmt"
+	"sync"
+
+	iradix "github.com/hashicorp/go-immutable-radix"
+)
+
+// ResourceType is the type of resource an ACL applies to, with Kafka's codes.
+type ResourceType int8
+
+const (
+	ResourceTopic           ResourceType = 2
+	ResourceGroup           ResourceType = 3
+	ResourceCluster         ResourceType = 4
+	ResourceTransactionalID ResourceType = 5
+)
+
+// PatternType is how an ACL's resource name matches resources, with Kafka's codes.
+type PatternType int8
+
+const (
+	// PatternLiteral matches the resource with the ACL's name, or every resource if the name's
+	// the wildcard.
+	PatternLiteral PatternType = 3
+	// PatternPrefixed matches the resources whose names start with the ACL's name.
+	PatternPrefixed PatternType = 4
+)
+
+// Operation is the operation an ACL allows or denies, with Kafka's codes.
+type Operation int8
+
+const (
+	OperationAll             Operation = 2
+	OperationRead            Operation = 3
+	OperationWrite           Operation = 4
+	OperationCreate          Operation = 5
+	OperationDelete          Operation = 6
+	OperationAlter           Operation = 7
+	OperationDescribe        Operation = 8
+	OperationClusterAction   Operation = 9
+	OperationDescribeConfigs Operation = 10
+	OperationAlterConfigs    Operation = 11
+	OperationIdempotentWrite Operation = 12
+)
+
+// Permission is whether an ACL allows or denies its operation, with Kafka's codes.
+type Permission int8
+
+const (
+	PermissionDeny  Permission = 2
+	PermissionAllow Permission = 3
+)
+
+// Wildcard is the resource name, principal, and host matching every one.
+const Wildcard = "*"
+
+// WildcardPrincipal is the principal matching every user.
+const WildcardPrincipal = "User:*"
+
+// ACL allows or denies a principal from a host an operation on the resources its pattern matches.
+type ACL struct {
+	ResourceType ResourceType
+	ResourceName string
+	PatternType  PatternType
+	// Principal is e.g. User:alice, or WildcardPrincipal. Host is the client's IP, or Wildcard.
+	Principal  string
+	Host       string
+	Operation  Operation
+	Permission Permission
+}
+
+// Validate returns an error if the ACL is invalid.
+func (a ACL) Validate() error {
+	switch {
+	case a.ResourceType < ResourceTopic || a.ResourceType > ResourceTransactionalID:
+		return fmt.Errorf("unknown resource type %d", a.ResourceType)
+	case a.PatternType != PatternLiteral && a.PatternType != PatternPrefixed:
+		return fmt.Errorf("unknown pattern type %d", a.PatternType)
+	case a.ResourceName == "":
+		return fmt.Errorf("resource name is empty")
+	case a.PatternType == PatternPrefixed && a.ResourceName == Wildcard:
+		return fmt.Errorf("prefixed resource name %s, use a literal one to match every resource", Wildcard)
+	case a.Principal == "" || a.Host == "":
+		return fmt.Errorf("principal and host must be set")
+	case a.Operation < OperationAll || a.Operation > OperationIdempotentWrite:
+		return fmt.Errorf("unknown operation %d", a.Operation)
+	case a.Permission != PermissionDeny && a.Permission != PermissionAllow:
+		return fmt.Errorf("unknown permission %d", a.Permission)
+	}
+	return nil
+}
+
+// matches returns whether the ACL applies to the principal, host, and operation.
+func (a ACL) matches(principal, host string, op Operation) bool {
+	if a.Principal != principal && a.Principal != WildcardPrincipal {
+		return false
+	}
+	if a.Host != host && a.Host != Wildcard {
+		return false
+	}
+	if a.Operation == op || a.Operation == OperationAll {
+		return true
+	}
+	// like Kafka, allowing an operation implies allowing describing the resource, and allowing
+	// altering configs describing them.
+	if a.Permission != PermissionAllow {
+		return false
+	}
+	switch op {
+	case OperationDescribe:
+		return a.Operation == OperationRead || a.Operation == OperationWrite || a.Operation == OperationDelete || a.Operation == OperationAlter
+	case OperationDescribeConfigs:
+		return a.Operation == OperationAlterConfigs
+	}
+	return false
+}
+
+// resources are the ACLs of a resource type. Literal ACLs are looked up by name, prefixed ones
+// in a radix tree so a lookup walks only the prefixes of the resource's name, not every ACL.
+type resources struct {
+	literal  map[string][]ACL
+	prefixed *iradix.Tree
+}
+
+// Authorizer holds ACLs and checks requests against them. Deny ACLs take precedence over allow
+// ones, and a request no ACL allows is denied. It's safe for concurrent use.
+type Authorizer struct {
+	mu        sync.RWMutex
+	resources map[ResourceType]*resources
+}
+
+// NewAuthorizer returns an authorizer with no ACLs.
+func NewAuthorizer() *Authorizer {
+	return &Authorizer{resources: make(map[ResourceType]*resources)}
+}
+
+// Add adds the ACLs, none if any is invalid. Adding an ACL that's already held is a no-op.
+func (a *Authorizer) Add(acls ...ACL) error {
+	for _, acl := range acls {
+		if err := acl.Validate(); err != nil {
+			return err
+		}
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, acl := range acls {
+		r := a.resources[acl.ResourceType]
+		if r == nil {
+			r = &resources{literal: make(map[string][]ACL), prefixed: iradix.New()}
+			a.resources[acl.ResourceType] = r
+		}
+		if acl.PatternType == PatternLiteral {
+			r.literal[acl.ResourceName] = appendACL(r.literal[acl.ResourceName], acl)
+			continue
+		}
+		var existing []ACL
+		if v, ok := r.prefixed.Get([]byte(acl.ResourceName)); ok {
+			existing = v.([]ACL)
+		}
+		r.prefixed, _, _ = r.prefixed.Insert([]byte(acl.ResourceName), appendACL(existing, acl))
+	}
+	return nil
+}
+
+// Remove removes the ACLs, ignoring those not held.
+func (a *Authorizer) Remove(acls ...ACL) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, acl := range acls {
+		r := a.resources[acl.ResourceType]
+		if r == nil {
+			continue
+		}
+		if acl.PatternType == PatternLiteral {
+			if rest := removeACL(r.literal[acl.ResourceName], acl); len(rest) != 0 {
+				r.literal[acl.ResourceName] = rest
+			} else {
+				delete(r.literal, acl.ResourceName)
+			}
+			continue
+		}
+		v, ok := r.prefixed.Get([]byte(acl.ResourceName))
+		if !ok {
+			continue
+		}
+		if rest := removeACL(v.([]ACL), acl); len(rest) != 0 {
+			r.prefixed, _, _ = r.prefixed.Insert([]byte(acl.ResourceName), rest)
+		} else {
+			r.prefixed, _, _ = r.prefixed.Delete([]byte(acl.ResourceName))
+		}
+	}
+}
+
+// ACLs returns the ACLs the authorizer holds.
+func (a *Authorizer) ACLs() []ACL {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	var acls []ACL
+	for _, r := range a.resources {
+		for _, l := range r.literal {
+			acls = append(acls, l...)
+		}
+		r.prefixed.Root().Walk(func(k []byte, v interface{}) bool {
+			acls = append(acls, v.([]ACL)...)
+			return false
+		})
+	}
+	return acls
+}
+
+// Authorize returns whether the principal from the host is allowed the operation on the resource:
+// some ACL matching the resource allows it and none denies it.
+func (a *Authorizer) Authorize(principal, host string, op Operation, typ ResourceType, name string) bool {
+	a.mu.RLock()
+	r := a.resources[typ]
+	if r == nil {
+		a.mu.RUnlock()
+		return false
+	}
+	// the ACL slices are replaced, never modified, so they can be read after unlocking.
+	literal, wildcard, prefixed := r.literal[name], r.literal[Wildcard], r.prefixed
+	a.mu.RUnlock()
+
+	// check returns whether an ACL denies the request, noting whether one allows it.
+	var allowed bool
+	check := func(acls []ACL) bool {
+		for _, acl := range acls {
+			if !acl.matches(principal, host, op) {
+				continue
+			}
+			if acl.Permission == PermissionDeny {
+				return true
+			}
+			allowed = true
+		}
+		return false
+	}
+	if check(literal) || check(wildcard) {
+		return false
+	}
+	denied := false
+	prefixed.Root().WalkPath([]byte(name), func(k []byte, v interface{}) bool {
+		denied = check(v.([]ACL))
+		return denied
+	})
+	return allowed && !denied
+}
+
+// appendACL returns a copy of the ACLs with the ACL appended, unless they hold it.
+func appendACL(acls []ACL, acl ACL) []ACL {
+	for _, a := range acls {
+		if a == acl {
+			return acls
+		}
+	}
+	return append(append(make([]ACL, 0, len(acls)+1), acls...), acl)
+}
+
+// removeACL returns a copy of the ACLs without the ACL.
+func removeACL(acls []ACL, acl ACL) []ACL {
+	rest := make([]ACL, 0, len(acls))
+	for _, a := range acls {
+		if a != acl {
+			rest = append(rest, a)
+		}
+	}
+	return rest
+}
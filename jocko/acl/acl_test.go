@@ -0,0 +1,86 @@
+package acl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthorize(t *testing.T) {
+	topic := func(name string, pattern PatternType, principal string, op Operation, perm Permission) ACL {
+		return ACL{ResourceType: ResourceTopic, ResourceName: name, PatternType: pattern, Principal: principal, Host: Wildcard, Operation: op, Permission: perm}
+	}
+	a := NewAuthorizer()
+	require.NoError(t, a.Add(
+		topic("teamA.", PatternPrefixed, "User:alice", OperationWrite, PermissionAllow),
+		topic("teamA.secret", PatternPrefixed, "User:alice", OperationAll, PermissionDeny),
+		topic("team", PatternPrefixed, "User:bob", OperationRead, PermissionAllow),
+		topic("orders", PatternLiteral, "User:carol", OperationAll, PermissionAllow),
+		topic(Wildcard, PatternLiteral, WildcardPrincipal, OperationDescribeConfigs, PermissionAllow),
+		topic("orders", PatternLiteral, "User:dave", OperationRead, PermissionAllow),
+		topic("orders", PatternLiteral, "User:dave", OperationRead, PermissionAllow),
+		ACL{ResourceType: ResourceTopic, ResourceName: "orders", PatternType: PatternLiteral, Principal: "User:dave", Host: "10.0.0.2", Operation: OperationRead, Permission: PermissionDeny},
+	))
+	require.Len(t, a.ACLs(), 7)
+
+	for _, test := range []struct {
+		principal, host string
+		op              Operation
+		typ             ResourceType
+		name            string
+		allowed         bool
+	}{
+		{"User:alice", "10.0.0.1", OperationWrite, ResourceTopic, "teamA.orders", true},
+		{"User:alice", "10.0.0.1", OperationDescribe, ResourceTopic, "teamA.orders", true},
+		{"User:alice", "10.0.0.1", OperationRead, ResourceTopic, "teamA.orders", false},
+		{"User:alice", "10.0.0.1", OperationWrite, ResourceTopic, "teamA", false},
+		{"User:alice", "10.0.0.1", OperationWrite, ResourceTopic, "teamB.orders", false},
+		{"User:alice", "10.0.0.1", OperationWrite, ResourceTopic, "teamA.secrets", false},
+		{"User:alice", "10.0.0.1", OperationWrite, ResourceGroup, "teamA.orders", false},
+		{"User:bob", "10.0.0.1", OperationRead, ResourceTopic, "teamA.orders", true},
+		{"User:bob", "10.0.0.1", OperationRead, ResourceTopic, "team", true},
+		{"User:bob", "10.0.0.1", OperationRead, ResourceTopic, "tea", false},
+		{"User:carol", "10.0.0.1", OperationDelete, ResourceTopic, "orders", true},
+		{"User:carol", "10.0.0.1", OperationDelete, ResourceTopic, "orders2", false},
+		{"User:erin", "10.0.0.1", OperationDescribeConfigs, ResourceTopic, "anything", true},
+		{"User:erin", "10.0.0.1", OperationAlterConfigs, ResourceTopic, "anything", false},
+		{"User:dave", "10.0.0.1", OperationRead, ResourceTopic, "orders", true},
+		{"User:dave", "10.0.0.2", OperationRead, ResourceTopic, "orders", false},
+	} {
+		require.Equal(t, test.allowed, a.Authorize(test.principal, test.host, test.op, test.typ, test.name), "%+v", test)
+	}
+
+	a.Remove(
+		topic("teamA.secret", PatternPrefixed, "User:alice", OperationAll, PermissionDeny),
+		topic("orders", PatternLiteral, "User:carol", OperationAll, PermissionAllow),
+		topic("unknown", PatternPrefixed, "User:carol", OperationAll, PermissionAllow),
+	)
+	require.Len(t, a.ACLs(), 5)
+	require.True(t, a.Authorize("User:alice", "10.0.0.1", OperationWrite, ResourceTopic, "teamA.secrets"))
+	require.False(t, a.Authorize("User:carol", "10.0.0.1", OperationDelete, ResourceTopic, "orders"))
+}
+
+func TestValidate(t *testing.T) {
+	valid := ACL{ResourceType: ResourceTopic, ResourceName: "teamA.", PatternType: PatternPrefixed, Principal: "User:alice", Host: Wildcard, Operation: OperationRead, Permission: PermissionAllow}
+	require.NoError(t, valid.Validate())
+
+	for _, modify := range []func(a *ACL){
+		func(a *ACL) { a.ResourceType = 1 },
+		func(a *ACL) { a.PatternType = 1 },
+		func(a *ACL) { a.ResourceName = "" },
+		func(a *ACL) { a.ResourceName = Wildcard },
+		func(a *ACL) { a.Principal = "" },
+		func(a *ACL) { a.Operation = 13 },
+		func(a *ACL) { a.Permission = 1 },
+	} {
+		acl := valid
+		modify(&acl)
+		require.Error(t, acl.Validate(), "%+v", acl)
+	}
+
+	a := NewAuthorizer()
+	invalid := valid
+	invalid.Host = ""
+	require.Error(t, a.Add(valid, invalid))
+	require.Empty(t, a.ACLs())
+}
@@ -0,0 +1,77 @@
+package jocko
+
+import (
+	"fmt"
+
+	"github.com/travisjeffery/jocko/jocko/structs"
+	"github.com/travisjeffery/jocko/log"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func (b *Broker) handleAlterConfigs(ctx *Context, req *protocol.AlterConfigsRequest) *protocol.AlterConfigsResponse {
+	sp := span(ctx, b.tracer, "alter configs")
+	defer sp.Finish()
+	res := &protocol.AlterConfigsResponse{APIVersion: req.Version()}
+	res.Resources = make([]protocol.AlterConfigResourceResponse, len(req.Resources))
+	isController := b.isController()
+	sp.LogKV("is controller", isController)
+	for i, r := range req.Resources {
+		err := protocol.ErrNone
+		switch {
+		case !isController:
+			err = protocol.ErrNotController
+		case r.Type != protocol.TopicResourceType:
+			err = protocol.ErrInvalidRequest.WithErr(fmt.Errorf("unsupported resource type: %d", r.Type))
+		default:
+			err = b.alterTopicConfig(r, req.ValidateOnly)
+		}
+		res.Resources[i] = protocol.AlterConfigResourceResponse{
+			ErrorCode: err.Code(),
+			Type:      r.Type,
+			Name:      r.Name,
+		}
+		if err != protocol.ErrNone {
+			msg := err.Error()
+			res.Resources[i].ErrorMessage = &msg
+		}
+	}
+	return res
+}
+
+// alterTopicConfig replaces the topic's config with the resource's entries, like Kafka configs
+// missing from the request are reset to their defaults. Brokers apply a changed retention to their
+// replicas' logs as soon as they see the change.
+func (b *Broker) alterTopicConfig(r protocol.AlterConfigsResource, validateOnly bool) protocol.Error {
+	_, t, err := b.fsm.State().GetTopic(r.Name)
+	if err != nil {
+		return protocol.ErrUnknown.WithErr(err)
+	}
+	if t == nil {
+		return protocol.ErrUnknownTopicOrPartition
+	}
+	if t.Internal {
+		return protocol.ErrInvalidRequest.WithErr(fmt.Errorf("internal topic %s's config can't be altered", t.Topic))
+	}
+	cfg := structs.NewTopicConfig()
+	for _, e := range r.Entries {
+		if err := cfg.SetValueFromString(e.Name, e.Value); err != nil {
+			return protocol.ErrInvalidConfig.WithErr(err)
+		}
+	}
+	if _, err := parsePlacementConstraints(cfg.GetString(placementConstraintsConfig)); err != nil {
+		return protocol.ErrInvalidConfig.WithErr(err)
+	}
+	if err := b.checkAlterConfigPolicy(r); err != protocol.ErrNone {
+		return err
+	}
+	if validateOnly {
+		return protocol.ErrNone
+	}
+	altered := *t
+	altered.Config = cfg
+	if _, err := b.raftApply(structs.RegisterTopicRequestType, structs.RegisterTopicRequest{Topic: altered}); err != nil {
+		return protocol.ErrUnknown.WithErr(err)
+	}
+	log.Info.Printf("broker/%d: altered topic config: topic: %s", b.config.ID, t.Topic)
+	return protocol.ErrNone
+}
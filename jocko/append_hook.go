@@ -0,0 +1,38 @@
+package jocko
+
+// AppendHook is told of the record sets produced to the partitions this broker leads, e.g. to
+// index, forward, or trigger on new records in process without running a consumer.
+type AppendHook interface {
+	// Appended is called after the record set's appended to the partition's log at the base
+	// offset, with the offsets the log assigned its message sets. It's called while handling the
+	// produce request so it holds up the producer's response and shouldn't block, and it may be
+	// called concurrently. The record set mustn't be modified.
+	Appended(topic string, partition int32, baseOffset int64, recordSet []byte)
+}
+
+// AppendHookFunc is an adapter to use an ordinary function as an AppendHook.
+type AppendHookFunc func(topic string, partition int32, baseOffset int64, recordSet []byte)
+
+// Appended calls f(topic, partition, baseOffset, recordSet).
+func (f AppendHookFunc) Appended(topic string, partition int32, baseOffset int64, recordSet []byte) {
+	f(topic, partition, baseOffset, recordSet)
+}
+
+// SetAppendHook sets the hook told of the record sets appended to the partitions this broker
+// leads. Followers replicating the records don't call it, so each record set's seen once by its
+// leader. A nil hook removes it.
+func (b *Broker) SetAppendHook(h AppendHook) {
+	b.Lock()
+	defer b.Unlock()
+	b.appendHook = h
+}
+
+// appended calls the append hook, if there is one.
+func (b *Broker) appended(topic string, partition int32, baseOffset int64, recordSet []byte) {
+	b.RLock()
+	h := b.appendHook
+	b.RUnlock()
+	if h != nil {
+		h.Appended(topic, partition, baseOffset, recordSet)
+	}
+}
@@ -0,0 +1,75 @@
+package jocko
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestBroker_AppendHook(t *testing.T) {
+	s, dir := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+
+	type appended struct {
+		topic      string
+		partition  int32
+		baseOffset int64
+		recordSet  []byte
+	}
+	var mu sync.Mutex
+	var got []appended
+	s.broker().SetAppendHook(AppendHookFunc(func(topic string, partition int32, baseOffset int64, recordSet []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, appended{topic, partition, baseOffset, recordSet})
+	}))
+
+	conn, err := Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	CreateTopic(t, conn, "hooked", 1, 1)
+	WaitForTopicLeader(t, "hooked", 0, s)
+
+	produce := func(value string) []byte {
+		set, err := protocol.Encode(&protocol.MessageSet{Messages: []*protocol.Message{{Value: []byte(value)}}})
+		require.NoError(t, err)
+		res, err := conn.Produce(&protocol.ProduceRequest{
+			APIVersion: 2,
+			Timeout:    time.Second,
+			TopicData: []*protocol.TopicData{{
+				Topic: "hooked",
+				Data:  []*protocol.Data{{Partition: 0, RecordSet: set}},
+			}},
+		})
+		require.NoError(t, err)
+		require.Equal(t, protocol.ErrNone.Code(), res.Responses[0].PartitionResponses[0].ErrorCode)
+		return set
+	}
+	a, b := produce("a"), produce("b")
+	// the hook sees the offsets the log assigned.
+	protocol.Encoding.PutUint64(b, 1)
+
+	mu.Lock()
+	require.Equal(t, []appended{{"hooked", 0, 0, a}, {"hooked", 0, 1, b}}, got)
+	mu.Unlock()
+
+	// a removed hook isn't called.
+	s.broker().SetAppendHook(nil)
+	produce("c")
+	mu.Lock()
+	require.Equal(t, 2, len(got))
+	mu.Unlock()
+}
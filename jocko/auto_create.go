@@ -0,0 +1,99 @@
+package jocko
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/serf/serf"
+	"github.com/travisjeffery/jocko/jocko/metadata"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+// autoCreateTimeout is how long a broker waits on the controller to create a topic requested in
+// a metadata request.
+const autoCreateTimeout = 5 * time.Second
+
+// topicDefaults returns the topic creation request with a replication factor or partition count
+// of -1 replaced by the broker's defaults.
+func (b *Broker) topicDefaults(req *protocol.CreateTopicRequest) *protocol.CreateTopicRequest {
+	if req.ReplicationFactor != -1 && req.NumPartitions != -1 {
+		return req
+	}
+	b.RLock()
+	replicationFactor, numPartitions := b.config.DefaultReplicationFactor, b.config.NumPartitions
+	b.RUnlock()
+	r := *req
+	if r.ReplicationFactor == -1 {
+		r.ReplicationFactor = replicationFactor
+	}
+	if r.NumPartitions == -1 {
+		r.NumPartitions = numPartitions
+	}
+	return &r
+}
+
+// checkTopicRequest returns an error if the topic can't be created as requested with the brokers
+// alive in the cluster, or the create topic policy rejects it.
+func (b *Broker) checkTopicRequest(req *protocol.CreateTopicRequest) protocol.Error {
+	if req.NumPartitions < 1 {
+		return protocol.ErrInvalidPartitions.WithErr(fmt.Errorf("number of partitions %d must be at least 1", req.NumPartitions))
+	}
+	if alive := b.aliveBrokers(); req.ReplicationFactor < 1 || int(req.ReplicationFactor) > alive {
+		return protocol.ErrInvalidReplicationFactor.WithErr(fmt.Errorf("replication factor %d must be between 1 and the %d alive brokers", req.ReplicationFactor, alive))
+	}
+	return b.checkCreateTopicPolicy(req)
+}
+
+// aliveBrokers returns the number of brokers alive in the cluster that can host partitions.
+func (b *Broker) aliveBrokers() int {
+	var n int
+	for _, m := range b.LANMembers() {
+		if m.Status != serf.StatusAlive {
+			continue
+		}
+		if meta, ok := metadata.IsBroker(m); ok && !meta.Observer {
+			n++
+		}
+	}
+	return n
+}
+
+// autoCreateTopic creates the topic with the broker's default replication factor and partition
+// count. Brokers that aren't the controller forward the request to it.
+func (b *Broker) autoCreateTopic(ctx *Context, topic string) protocol.Error {
+	req := b.topicDefaults(&protocol.CreateTopicRequest{
+		Topic:             topic,
+		NumPartitions:     -1,
+		ReplicationFactor: -1,
+	})
+	if b.isController() {
+		if err := b.checkTopicRequest(req); err != protocol.ErrNone {
+			return err
+		}
+		return b.createTopic(ctx, req, b.clock.Now().Add(autoCreateTimeout))
+	}
+	controller := b.brokerLookup.BrokerByAddr(b.raft.Leader())
+	if controller == nil {
+		return protocol.ErrLeaderNotAvailable
+	}
+	res, err := b.brokerClient(controller.ID.Int32()).CreateTopics(&protocol.CreateTopicRequests{
+		Timeout:  autoCreateTimeout,
+		Requests: []*protocol.CreateTopicRequest{req},
+	})
+	if err != nil {
+		return protocol.ErrLeaderNotAvailable.WithErr(err)
+	}
+	if len(res.TopicErrorCodes) == 0 {
+		return protocol.ErrUnknown.WithErr(fmt.Errorf("controller %d's create topics response has no topic", controller.ID.Int32()))
+	}
+	return protocol.Errs[res.TopicErrorCodes[0].ErrorCode]
+}
+
+// autoCreateTopics returns whether the metadata request's unknown topics should be created.
+// Clients opt out from version 4.
+func (b *Broker) autoCreateTopics(req *protocol.MetadataRequest) bool {
+	b.RLock()
+	enabled := b.config.AutoCreateTopics
+	b.RUnlock()
+	return enabled && (req.Version() < 4 || req.AllowAutoTopicCreation)
+}
@@ -0,0 +1,76 @@
+package jocko
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/testutil/retry"
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestBroker_AutoCreateTopics(t *testing.T) {
+	s, dir := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+		cfg.AutoCreateTopics = true
+		cfg.NumPartitions = 2
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+
+	conn, err := Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	var res *protocol.MetadataResponse
+	retry.Run(t, func(r *retry.R) {
+		var err error
+		res, err = conn.Metadata(&protocol.MetadataRequest{APIVersion: 4, Topics: []string{"auto-created"}, AllowAutoTopicCreation: true})
+		if err != nil {
+			r.Fatal(err)
+		}
+		if code := res.TopicMetadata[0].TopicErrorCode; code != protocol.ErrNone.Code() {
+			r.Fatalf("metadata error: %d", code)
+		}
+	})
+	require.Equal(t, 2, len(res.TopicMetadata[0].PartitionMetadata))
+
+	res, err = conn.Metadata(&protocol.MetadataRequest{APIVersion: 4, Topics: []string{"opted-out"}})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrUnknownTopicOrPartition.Code(), res.TopicMetadata[0].TopicErrorCode)
+
+	cres, err := conn.CreateTopics(&protocol.CreateTopicRequests{
+		Timeout: time.Second,
+		Requests: []*protocol.CreateTopicRequest{
+			{Topic: "defaults", NumPartitions: -1, ReplicationFactor: -1},
+			{Topic: "too-many-replicas", NumPartitions: -1, ReplicationFactor: 2},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrNone.Code(), cres.TopicErrorCodes[0].ErrorCode)
+	require.Equal(t, protocol.ErrInvalidReplicationFactor.Code(), cres.TopicErrorCodes[1].ErrorCode)
+	_, topic, err := s.broker().fsm.State().GetTopic("defaults")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(topic.Partitions))
+	require.Equal(t, 1, len(topic.Partitions[0]))
+
+	// topics that can't be registered by the deadline time out rather than being created in the
+	// background.
+	b := s.broker()
+	err = b.createTopic(&Context{parent: context.Background(), header: &protocol.RequestHeader{}}, &protocol.CreateTopicRequest{
+		Topic:             "timed-out",
+		NumPartitions:     1,
+		ReplicationFactor: 1,
+	}, b.clock.Now().Add(-time.Second))
+	require.Equal(t, protocol.ErrRequestTimedOut, err)
+	_, topic, err = b.fsm.State().GetTopic("timed-out")
+	require.NoError(t, err)
+	require.Nil(t, topic)
+}
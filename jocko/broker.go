@@ -4,11 +4,13 @@ import (
 	"bytes"
 	"container/ring"
 	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -20,13 +22,12 @@ import (
 	"github.com/hashicorp/serf/serf"
 	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
-	uuid "github.com/satori/go.uuid"
+	"github.com/travisjeffery/jocko/clock"
 	"github.com/travisjeffery/jocko/commitlog"
 	"github.com/travisjeffery/jocko/jocko/config"
 	"github.com/travisjeffery/jocko/jocko/fsm"
 	"github.com/travisjeffery/jocko/jocko/metadata"
 	"github.com/travisjeffery/jocko/jocko/structs"
-	"github.com/travisjeffery/jocko/jocko/util"
 	"github.com/travisjeffery/jocko/log"
 	"github.com/travisjeffery/jocko/protocol"
 )
@@ -69,7 +70,7 @@ type Broker struct {
 	brokerLookup  *brokerLookup
 	replicaLookup *replicaLookup
 	// The raft instance is used among Jocko brokers within the DC to protect operations that require strong consistency.
-	raft          *raft.Raft
+	raft          Raft
 	raftStore     *raftboltdb.BoltStore
 	raftTransport *raft.NetworkTransport
 	raftInmem     *raft.InmemStore
@@ -77,12 +78,62 @@ type Broker struct {
 	raftNotifyCh <-chan bool
 	// reconcileCh is used to pass events from the serf handler to the raft leader to update its state.
 	reconcileCh      chan serf.Member
-	serf             *serf.Serf
+	serf             Serf
 	fsm              *fsm.FSM
 	eventChLAN       chan serf.Event
 	logStateInterval time.Duration
+	// deadLetters queues the records rejected from produces to be written to their topics' dead
+	// letter queues in the background.
+	deadLetters chan deadLetters
 
 	tracer opentracing.Tracer
+	// clock drives the broker's timers: the controller's reconciles, request timeouts,
+	// hibernation, delayed deliveries, quotas, and retention.
+	clock clock.Clock
+	// segmentFiles limits the number of segment log files open across the broker's replicas.
+	segmentFiles *commitlog.FileCache
+	// fetchCache shares record sets read for fetches between consumers.
+	fetchCache *fetchCache
+	// purgatory holds consumers' empty fetches until their partitions are appended to.
+	purgatory *fetchPurgatory
+	// held are the requests being answered asynchronously by conn.
+	held *heldResponses
+	// offsetCommits batches the groups' offset commits into appends to the offsets topic.
+	offsetCommits *offsetCommits
+	// metrics, if set, tracks the broker's topics and partitions.
+	metrics *Metrics
+	// validators check the records produced to their topics.
+	validators map[string]RecordValidator
+	// appendHook is told of the record sets produced to the partitions this broker leads.
+	appendHook AppendHook
+	// createTopicPolicy and alterConfigPolicy, if set, validate the topics clients create and the
+	// configs they alter.
+	createTopicPolicy CreateTopicPolicy
+	alterConfigPolicy AlterConfigPolicy
+	// fetchQuotas tracks the bytes each consumer fetches to enforce the topics' byte rates.
+	fetchQuotas *topicQuotas
+	// produceByteQuotas and produceRecordQuotas track the bytes and records producers append to
+	// enforce the topics' produce rates.
+	produceByteQuotas   *topicQuotas
+	produceRecordQuotas *topicQuotas
+	// groups are the groups the broker coordinates.
+	groups *groupCoordinator
+	// clientQuotas tracks the clients' quota usage for metrics and describe client quotas requests.
+	clientQuotas *clientQuotaStats
+	// buffers is the budget for unanswered requests and unappended replicated records.
+	buffers *bufferPool
+	// clusterMetadata is the log of cluster state changes served as the cluster metadata topic.
+	clusterMetadata *clusterMetadataLog
+	// brokerConns are the connections to the other brokers, replicaConns are those replicators
+	// fetch over so their fetches don't hold up other requests.
+	brokerConns  *connPool
+	replicaConns *connPool
+	// goroutines tracks the broker's goroutines to check they exit on shutdown.
+	goroutines *lifecycle
+	// peerCerts and peerTLS, if set, secure the traffic between brokers: raft, and the requests
+	// they send to each other's inter-broker listeners.
+	peerCerts *certReloader
+	peerTLS   *tls.Config
 
 	shutdownCh   chan struct{}
 	shutdown     bool
@@ -91,15 +142,78 @@ type Broker struct {
 
 // New is used to instantiate a new broker.
 func NewBroker(config *config.Config, tracer opentracing.Tracer) (*Broker, error) {
+	if err := config.ResolveIdentity(); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
 	b := &Broker{
-		config:           config,
-		shutdownCh:       make(chan struct{}),
-		eventChLAN:       make(chan serf.Event, 256),
-		brokerLookup:     NewBrokerLookup(),
-		replicaLookup:    NewReplicaLookup(),
-		reconcileCh:      make(chan serf.Member, 32),
-		tracer:           tracer,
-		logStateInterval: time.Millisecond * 250,
+		config:              config,
+		shutdownCh:          make(chan struct{}),
+		goroutines:          newLifecycle(),
+		eventChLAN:          make(chan serf.Event, 256),
+		brokerLookup:        NewBrokerLookup(),
+		replicaLookup:       NewReplicaLookup(),
+		reconcileCh:         make(chan serf.Member, 256),
+		deadLetters:         make(chan deadLetters, 256),
+		tracer:              tracer,
+		clock:               config.Clock,
+		logStateInterval:    time.Millisecond * 250,
+		segmentFiles:        commitlog.NewFileCache(config.MaxOpenSegmentFiles),
+		fetchQuotas:         newTopicQuotas(),
+		produceByteQuotas:   newTopicQuotas(),
+		produceRecordQuotas: newTopicQuotas(),
+		clientQuotas:        newClientQuotaStats(),
+		groups:              newGroupCoordinator(),
+	}
+	if b.clock == nil {
+		b.clock = clock.New()
+	}
+	b.buffers = newBufferPool(config.QueuedMaxRequestBytes, b.trackBufferedBytes)
+
+	var err error
+	if config.InterBrokerTLSCertFile != "" {
+		if b.peerCerts, err = newCertReloader(config.InterBrokerTLSCertFile, config.InterBrokerTLSKeyFile); err != nil {
+			return nil, fmt.Errorf("inter-broker tls: %v", err)
+		}
+		if b.peerTLS, err = newPeerTLSConfig(b.peerCerts, config.InterBrokerTLSCAFile); err != nil {
+			return nil, fmt.Errorf("inter-broker tls: %v", err)
+		}
+	}
+
+	tcp := newTCPOptions(config)
+	brokerDialer := NewDialer("jocko")
+	brokerDialer.tcp = tcp
+	brokerDialer.DialFunc = config.Dial
+	brokerDialer.TLS = b.peerTLS
+	replicaDialer := NewDialer(fmt.Sprintf("jocko-replicator-%d", config.ID))
+	replicaDialer.tcp = tcp
+	replicaDialer.DialFunc = config.Dial
+	replicaDialer.TLS = b.peerTLS
+	b.brokerConns = newConnPool(brokerDialer, b.brokerLookup, b.topicMetrics)
+	b.brokerConns.clock = b.clock
+	b.replicaConns = newConnPool(replicaDialer, b.brokerLookup, b.topicMetrics)
+	b.replicaConns.clock = b.clock
+
+	if b.fetchCache, err = newFetchCache(config.FetchCacheSize); err != nil {
+		return nil, fmt.Errorf("fetch cache: %v", err)
+	}
+	b.purgatory = newFetchPurgatory(b.trackHeldFetches)
+	b.held = newHeldResponses()
+	b.offsetCommits = newOffsetCommits()
+
+	if err := openDataDir(config.DataDir, config.ID); err != nil {
+		if config.IDTemplate != "" {
+			return nil, fmt.Errorf("data dir: %v: check the id template %q", err, config.IDTemplate)
+		}
+		return nil, fmt.Errorf("data dir: %v", err)
+	}
+
+	b.clusterMetadata, err = openClusterMetadataLog(filepath.Join(config.DataDir, clusterMetadataDir), config.ID, config.DevMode)
+	if err != nil {
+		return nil, fmt.Errorf("cluster metadata log: %v", err)
 	}
 
 	if err := b.setupRaft(); err != nil {
@@ -107,17 +221,56 @@ func NewBroker(config *config.Config, tracer opentracing.Tracer) (*Broker, error
 		return nil, fmt.Errorf("start raft: %v", err)
 	}
 
-	var err error
-	b.serf, err = b.setupSerf(config.SerfLANConfig, b.eventChLAN, serfLANSnapshot)
+	s, err := b.setupSerf(config.SerfLANConfig, b.eventChLAN, serfLANSnapshot)
 	if err != nil {
 		return nil, err
 	}
+	b.serf = s
+
+	if len(config.StartJoinAddrsLAN) != 0 {
+		// the other brokers may not be up yet, they join this one when they are.
+		if err := b.JoinLAN(config.StartJoinAddrsLAN...); err != protocol.ErrNone {
+			log.Error.Printf("broker/%d: start join error: %s", b.config.ID, err)
+		}
+	}
+
+	if err := b.checkDuplicateAddrs(); err != nil {
+		b.serf.Leave()
+		b.Shutdown()
+		return nil, err
+	}
 
-	go b.lanEventHandler()
+	b.goroutines.goFunc("serf", b.lanEventHandler)
+	if len(config.RetryJoinLAN) != 0 {
+		b.goroutines.goFunc("retry join", b.retryJoinLAN)
+	}
+
+	b.goroutines.goFunc("leader", b.monitorLeadership)
+
+	b.goroutines.goFunc("state log", b.logState)
+
+	b.goroutines.goFunc("conn pool", func() { b.brokerConns.probeLoop(b.shutdownCh) })
+	b.goroutines.goFunc("conn pool", func() { b.replicaConns.probeLoop(b.shutdownCh) })
+	b.goroutines.goFunc("groups", b.groupsLoop)
+	b.goroutines.goFunc("dead letters", b.deadLetterLoop)
+
+	if config.HibernateAfter > 0 {
+		b.goroutines.goFunc("hibernate", b.hibernateLoop)
+	}
 
-	go b.monitorLeadership()
+	if config.SegmentCompressionInterval > 0 {
+		b.goroutines.goFunc("segment compression", b.segmentCompressionLoop)
+	}
+
+	if config.DiskUsageReportInterval > 0 {
+		b.goroutines.goFunc("disk usage", b.diskUsageLoop)
+	}
 
-	go b.logState()
+	if config.OrphanedPartitionScanInterval > 0 {
+		b.goroutines.goFunc("orphaned partitions", b.orphanedPartitionsLoop)
+	}
+
+	log.Info.Printf("broker/%d: jocko %s started: addr: %s, raft addr: %s, data dir: %s, features: %s", b.config.ID, Version, b.config.AdvertisedAddr(), b.config.RaftAddr, b.config.DataDir, metadata.FeaturesTagValue(supportedFeatures))
 
 	return b, nil
 }
@@ -140,66 +293,29 @@ func (b *Broker) Run(ctx context.Context, requests <-chan *Context, responses ch
 				queueSpan.Finish()
 			}
 
-			var res protocol.ResponseBody
-
-			switch req := reqCtx.req.(type) {
-			case *protocol.ProduceRequest:
-				res = b.handleProduce(reqCtx, req)
-			case *protocol.FetchRequest:
-				res = b.handleFetch(reqCtx, req)
-			case *protocol.OffsetsRequest:
-				res = b.handleOffsets(reqCtx, req)
-			case *protocol.MetadataRequest:
-				res = b.handleMetadata(reqCtx, req)
-			case *protocol.LeaderAndISRRequest:
-				res = b.handleLeaderAndISR(reqCtx, req)
-			case *protocol.StopReplicaRequest:
-				res = b.handleStopReplica(reqCtx, req)
-			case *protocol.UpdateMetadataRequest:
-				res = b.handleUpdateMetadata(reqCtx, req)
-			case *protocol.ControlledShutdownRequest:
-				res = b.handleControlledShutdown(reqCtx, req)
-			case *protocol.OffsetCommitRequest:
-				res = b.handleOffsetCommit(reqCtx, req)
-			case *protocol.OffsetFetchRequest:
-				res = b.handleOffsetFetch(reqCtx, req)
-			case *protocol.FindCoordinatorRequest:
-				res = b.handleFindCoordinator(reqCtx, req)
-			case *protocol.JoinGroupRequest:
-				res = b.handleJoinGroup(reqCtx, req)
-			case *protocol.HeartbeatRequest:
-				res = b.handleHeartbeat(reqCtx, req)
-			case *protocol.LeaveGroupRequest:
-				res = b.handleLeaveGroup(reqCtx, req)
-			case *protocol.SyncGroupRequest:
-				res = b.handleSyncGroup(reqCtx, req)
-			case *protocol.DescribeGroupsRequest:
-				res = b.handleDescribeGroups(reqCtx, req)
-			case *protocol.ListGroupsRequest:
-				res = b.handleListGroups(reqCtx, req)
-			case *protocol.SaslHandshakeRequest:
-				res = b.handleSaslHandshake(reqCtx, req)
-			case *protocol.APIVersionsRequest:
-				res = b.handleAPIVersions(reqCtx, req)
-			case *protocol.CreateTopicRequests:
-				res = b.handleCreateTopic(reqCtx, req)
-			case *protocol.DeleteTopicsRequest:
-				res = b.handleDeleteTopics(reqCtx, req)
+			var h handler
+			var async bool
+			if body, ok := reqCtx.req.(protocol.Body); ok {
+				h, async = handlers[body.Key()], asyncAPIs[body.Key()]
 			}
-
-			parentSpan := opentracing.SpanFromContext(reqCtx)
-			queueSpan = b.tracer.StartSpan("broker: queue response", opentracing.ChildOf(parentSpan.Context()))
-			responseCtx := context.WithValue(reqCtx, responseQueueSpanKey, queueSpan)
-
-			responses <- &Context{
-				parent: responseCtx,
-				conn:   reqCtx.conn,
-				header: reqCtx.header,
-				res: &protocol.Response{
-					CorrelationID: reqCtx.header.CorrelationID,
-					Body:          res,
-				},
+			if h.handle == nil {
+				// the server only decodes requests with handlers.
+				log.Error.Printf("broker/%d: no handler for request: %v", b.config.ID, reqCtx)
+				continue
+			}
+			// the conn's held request is answered first so its responses stay in order. Requests
+			// behind async ones wait in the background so they don't hold up the other conns.
+			if async || b.waitsOnAsync(reqCtx.conn) {
+				b.handleAsync(reqCtx, h, responses)
+				continue
+			}
+			b.held.finish(reqCtx.conn)
+			watched := b.watchFetch(reqCtx)
+			res := h.handle(b, reqCtx, reqCtx.req)
+			if watched != nil && b.holdFetch(reqCtx, watched, res, responses) {
+				continue
 			}
+			b.respond(reqCtx, res, responses)
 		case <-ctx.Done():
 			goto DONE
 		}
@@ -209,6 +325,26 @@ DONE:
 	return
 }
 
+// respond queues the response to the request to be written to its conn.
+func (b *Broker) respond(reqCtx *Context, res protocol.ResponseBody, responses chan<- *Context) {
+	parentSpan := opentracing.SpanFromContext(reqCtx)
+	queueSpan := b.tracer.StartSpan("broker: queue response", opentracing.ChildOf(parentSpan.Context()))
+	responseCtx := context.WithValue(reqCtx, responseQueueSpanKey, queueSpan)
+
+	select {
+	case responses <- &Context{
+		parent: responseCtx,
+		conn:   reqCtx.conn,
+		header: reqCtx.header,
+		res: &protocol.Response{
+			CorrelationID: reqCtx.header.CorrelationID,
+			Body:          res,
+		},
+	}:
+	case <-b.shutdownCh:
+	}
+}
+
 // Join is used to have the broker join the gossip ring.
 // The given address should be another broker listening on the Serf address.
 func (b *Broker) JoinLAN(addrs ...string) protocol.Error {
@@ -233,12 +369,18 @@ func span(ctx context.Context, tracer opentracing.Tracer, op string) opentracing
 	return tracer.StartSpan("broker: "+op, opentracing.ChildOf(parentSpan.Context()))
 }
 
-var apiVersions = &protocol.APIVersionsResponse{APIVersions: protocol.APIVersions}
-
 func (b *Broker) handleAPIVersions(ctx *Context, req *protocol.APIVersionsRequest) *protocol.APIVersionsResponse {
 	sp := span(ctx, b.tracer, "api versions")
 	defer sp.Finish()
-	return apiVersions
+	res := *apiVersions
+	if !handlers[protocol.APIVersionsKey].supports(req.Version()) {
+		// clients probing with a newer version get the versions supported in a version 0
+		// response, to retry with one of them.
+		res.ErrorCode = protocol.ErrUnsupportedVersion.Code()
+		return &res
+	}
+	res.APIVersion = req.Version()
+	return &res
 }
 
 func (b *Broker) handleCreateTopic(ctx *Context, reqs *protocol.CreateTopicRequests) *protocol.CreateTopicsResponse {
@@ -257,20 +399,29 @@ func (b *Broker) handleCreateTopic(ctx *Context, reqs *protocol.CreateTopicReque
 			}
 			continue
 		}
-		if req.ReplicationFactor > int16(len(b.LANMembers())) {
+		req = b.topicDefaults(req)
+		if err := b.checkTopicRequest(req); err != protocol.ErrNone {
 			res.TopicErrorCodes[i] = &protocol.TopicErrorCode{
 				Topic:     req.Topic,
-				ErrorCode: protocol.ErrInvalidReplicationFactor.Code(),
+				ErrorCode: err.Code(),
+			}
+			if err.Code() == protocol.ErrPolicyViolation.Code() {
+				msg := err.Error()
+				res.TopicErrorCodes[i].ErrorMessage = &msg
 			}
 			continue
 		}
 		err := b.withTimeout(reqs.Timeout, func() protocol.Error {
-			return b.createTopic(ctx, req)
+			return b.createTopic(ctx, req, time.Time{})
 		})
 		res.TopicErrorCodes[i] = &protocol.TopicErrorCode{
 			Topic:     req.Topic,
 			ErrorCode: err.Code(),
 		}
+		if err.Code() == protocol.ErrPolicyViolation.Code() || err.Code() == protocol.ErrInvalidConfig.Code() {
+			msg := err.Error()
+			res.TopicErrorCodes[i].ErrorMessage = &msg
+		}
 
 	}
 	return res
@@ -326,22 +477,39 @@ func (b *Broker) handleLeaderAndISR(ctx *Context, req *protocol.LeaderAndISRRequ
 		}
 	}
 	for i, p := range req.PartitionStates {
-		// TODO: need to replace the replica regardless
-		replica := &Replica{
-			BrokerID: b.config.ID,
-			Partition: structs.Partition{
-				ID:              p.Partition,
-				Partition:       p.Partition,
-				Topic:           p.Topic,
-				ISR:             p.ISR,
-				AR:              p.Replicas,
-				ControllerEpoch: p.ZKVersion,
-				LeaderEpoch:     p.LeaderEpoch,
-				Leader:          p.Leader,
-			},
-			IsLocal: true,
-		}
-		b.replicaLookup.AddReplica(replica)
+		if !contains(p.Replicas, b.config.ID) {
+			// the broker isn't assigned the partition so it doesn't get a replica of it.
+			setErr(i, p, protocol.ErrReplicaNotAvailable)
+			continue
+		}
+		partition := structs.Partition{
+			ID:              p.Partition,
+			Partition:       p.Partition,
+			Topic:           p.Topic,
+			ISR:             p.ISR,
+			AR:              p.Replicas,
+			ControllerEpoch: p.ZKVersion,
+			LeaderEpoch:     p.LeaderEpoch,
+			Leader:          p.Leader,
+		}
+		replica, err := b.replicaLookup.Replica(p.Topic, p.Partition)
+		if err != nil {
+			replica = &Replica{
+				BrokerID:  b.config.ID,
+				Partition: partition,
+				IsLocal:   true,
+			}
+			replica.touch(b.clock.Now())
+			b.replicaLookup.AddReplica(replica)
+		} else {
+			// the existing replica is updated rather than replaced so its log and replicator
+			// aren't left open. A hibernated one's log is reopened below.
+			replica.touch(b.clock.Now())
+			replica.Lock()
+			replica.Partition = partition
+			replica.hibernated = false
+			replica.Unlock()
+		}
 
 		if p.Leader == b.config.ID && (replica.Partition.Leader == b.config.ID) {
 			// is command asking this broker to be the new leader for p and this broker is not already the leader for
@@ -372,6 +540,54 @@ func (b *Broker) handleLeaderAndISR(ctx *Context, req *protocol.LeaderAndISRRequ
 	return res
 }
 
+// handleStopReplica stops the broker's replicas of the partitions, closing their logs and
+// replicators, and deletes their logs if asked to. The controller sends it to the brokers that
+// replicas were moved off of.
+func (b *Broker) handleStopReplica(ctx *Context, req *protocol.StopReplicaRequest) *protocol.StopReplicaResponse {
+	sp := span(ctx, b.tracer, "stop replica")
+	defer sp.Finish()
+	res := &protocol.StopReplicaResponse{
+		Partitions: make([]*protocol.StopReplicaResponsePartition, len(req.Partitions)),
+	}
+	for i, p := range req.Partitions {
+		res.Partitions[i] = &protocol.StopReplicaResponsePartition{Topic: p.Topic, Partition: p.Partition}
+		if err := b.stopReplica(p.Topic, p.Partition, req.DeletePartitions); err != nil {
+			log.Error.Printf("broker/%d: stop replica error: topic: %s, partition: %d: %s", b.config.ID, p.Topic, p.Partition, err)
+			res.Partitions[i].ErrorCode = protocol.ErrUnknown.Code()
+		}
+	}
+	return res
+}
+
+// stopReplica closes and removes the broker's replica of the partition, if it has one, and deletes
+// the partition's log if delete is set.
+func (b *Broker) stopReplica(topic string, partition int32, delete bool) error {
+	if replica, err := b.replicaLookup.Replica(topic, partition); err == nil {
+		replica.Lock()
+		if replica.Replicator != nil {
+			if err := replica.Replicator.Close(); err != nil {
+				replica.Unlock()
+				return err
+			}
+			replica.Replicator = nil
+		}
+		if c, ok := replica.Log.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				replica.Unlock()
+				return err
+			}
+		}
+		replica.Log = nil
+		replica.Unlock()
+		b.replicaLookup.RemoveReplica(replica)
+		b.fetchCache.invalidate(topic, partition)
+	}
+	if !delete {
+		return nil
+	}
+	return os.RemoveAll(filepath.Join(b.config.DataDir, "data", fmt.Sprintf("%s-%d", topic, partition)))
+}
+
 func (b *Broker) handleOffsets(ctx *Context, req *protocol.OffsetsRequest) *protocol.OffsetsResponse {
 	sp := span(ctx, b.tracer, "offsets")
 	defer sp.Finish()
@@ -385,21 +601,41 @@ func (b *Broker) handleOffsets(ctx *Context, req *protocol.OffsetsRequest) *prot
 		for _, p := range t.Partitions {
 			pres := new(protocol.PartitionResponse)
 			pres.Partition = p.Partition
+			res.Responses[i].PartitionResponses = append(res.Responses[i].PartitionResponses, pres)
 			replica, err := b.replicaLookup.Replica(t.Topic, p.Partition)
 			if err != nil {
-				// TODO: have replica lookup return an error with a code
-				pres.ErrorCode = protocol.ErrUnknown.Code()
+				pres.ErrorCode = protocol.ErrUnknownTopicOrPartition.Code()
+				continue
+			}
+			if req.Version() >= 4 {
+				if err := b.checkLeaderEpoch(replica, p.CurrentLeaderEpoch); err != protocol.ErrNone {
+					pres.ErrorCode = err.Code()
+					continue
+				}
+				_, pres.LeaderEpoch = b.currentLeader(replica)
+			}
+			if err := b.wakeReplica(replica); err != protocol.ErrNone {
+				pres.ErrorCode = err.Code()
+				continue
+			}
+			if replica.Log == nil {
+				replica.unpin()
+				pres.ErrorCode = protocol.ErrReplicaNotAvailable.Code()
 				continue
 			}
 			var offset int64
 			if p.Timestamp == -2 {
+				// the earliest offset is the log start offset.
 				offset = replica.Log.OldestOffset()
+			} else if req.IsolationLevel == int8(protocol.ReadCommitted) {
+				// read committed consumers' latest offset is the last stable offset.
+				offset = lastStableOffset(replica.Log)
 			} else {
-				// TODO: this is nil because i'm not sending the leader and isr requests telling the new leader to start the replica and instantiate the log...
 				offset = replica.Log.NewestOffset()
 			}
+			replica.unpin()
 			pres.Offsets = []int64{offset}
-			res.Responses[i].PartitionResponses = append(res.Responses[i].PartitionResponses, pres)
+			pres.Offset = offset
 		}
 	}
 	return res
@@ -418,6 +654,7 @@ func (b *Broker) handleProduce(ctx *Context, req *protocol.ProduceRequest) *prot
 		for j, p := range td.Data {
 			pres := &protocol.ProducePartitionResponse{}
 			pres.Partition = p.Partition
+			var throttle time.Duration
 			err := b.withTimeout(req.Timeout, func() protocol.Error {
 				state := b.fsm.State()
 				_, t, err := state.GetTopic(td.Topic)
@@ -429,21 +666,103 @@ func (b *Broker) handleProduce(ctx *Context, req *protocol.ProduceRequest) *prot
 					log.Error.Printf("broker/%d: produce to partition error: unknown topic", b.config.ID)
 					return protocol.ErrUnknownTopicOrPartition
 				}
+				if readOnly(t) {
+					log.Debug.Printf("broker/%d: produce to partition error: topic: %s: read only", b.config.ID, td.Topic)
+					return protocol.ErrPolicyViolation
+				}
+				if throttle = b.produceThrottle(t, b.clock.Now()); throttle > 0 {
+					// nothing's appended so a producer that ignores the throttle time can't
+					// fill the disks regardless.
+					return protocol.ErrThrottlingQuotaExceeded
+				}
+				// zstd's only for record batches, produced by clients that fetch with versions
+				// supporting it.
+				if protocol.IndexCodec(p.RecordSet, protocol.CompressionZSTD) >= 0 && (req.Version() < 7 || !protocol.IsRecordBatch(p.RecordSet)) {
+					return protocol.ErrUnsupportedCompressionType
+				}
+				if err := b.checkRecords(t, p.RecordSet); err != protocol.ErrNone {
+					log.Error.Printf("broker/%d: produce to partition error: topic: %s: %s", b.config.ID, td.Topic, err)
+					if deadLetterQueueEnabled(t) {
+						if dlqErr := b.queueDeadLetters(td.Topic, p.Partition, p.RecordSet, err); dlqErr != nil {
+							log.Error.Printf("broker/%d: produce to dead letter queue error: topic: %s: %s", b.config.ID, td.Topic, dlqErr)
+						}
+					}
+					return err
+				}
+				now := b.clock.Now()
+				if err := b.checkClockSkew(ctx.Header().ClientID, t, p.Partition, p.RecordSet, now); err != protocol.ErrNone {
+					return err
+				}
+				shared, err := protocol.ShareWrappedOffsets(p.RecordSet)
+				if err != nil {
+					return protocol.ErrCorruptMessage.WithErr(err)
+				}
+				p.RecordSet = shared
+				recompressed, perr := recompress(t, p.RecordSet)
+				if perr != protocol.ErrNone {
+					return perr
+				}
+				p.RecordSet = recompressed
+				if logAppendTime(t) {
+					stamped, err := protocol.SetLogAppendTime(p.RecordSet, now)
+					if err != nil {
+						return protocol.ErrCorruptMessage.WithErr(err)
+					}
+					p.RecordSet = stamped
+				}
 				replica, err := b.replicaLookup.Replica(td.Topic, p.Partition)
+				if err == nil && replica != nil {
+					if err := b.checkLeader(replica); err != protocol.ErrNone {
+						return err
+					}
+					if err := b.wakeReplica(replica); err != protocol.ErrNone {
+						return err
+					}
+					defer replica.unpin()
+				}
 				if err != nil || replica == nil || replica.Log == nil {
 					log.Error.Printf("broker/%d: produce to partition error: %s", b.config.ID, err)
 					pres.Partition = p.Partition
 					return protocol.ErrReplicaNotAvailable
 				}
-				offset, appendErr := replica.Log.Append(p.RecordSet)
-				if appendErr != nil {
-					log.Error.Printf("broker/%d: log append error: %s", b.config.ID, err)
-					return protocol.ErrUnknown
+				if req.Acks == -1 {
+					if err := b.checkInsyncReplicas(t, p.Partition, protocol.ErrNotEnoughReplicas); err != protocol.ErrNone {
+						log.Error.Printf("broker/%d: produce to partition error: %s", b.config.ID, err)
+						return err
+					}
+				}
+				offset, appendErr := b.appendRecords(td.Topic, p.Partition, replica, p.RecordSet)
+				if appendErr != protocol.ErrNone {
+					return appendErr
+				}
+				if delay := deliveryDelay(t); delay > 0 {
+					replica.delayDelivery(offset, b.clock.Now().Add(delay))
 				}
+				b.trackProduce(td.Topic, p.Partition, p.RecordSet)
+				b.trackClientBytes(ctx.Header().ClientID, produceQuota, len(p.RecordSet))
+				b.recordProduce(t, p.RecordSet, b.clock.Now())
+				b.appended(td.Topic, p.Partition, offset, p.RecordSet)
+				b.purgatory.wake(td.Topic, p.Partition)
 				pres.BaseOffset = offset
-				pres.LogAppendTime = time.Now()
+				if logAppendTime(t) {
+					pres.LogAppendTime = now
+					b.trackInjectedTimestamps(td.Topic, p.Partition)
+				}
+				if req.Acks == -1 {
+					// the isr shrank while the records were appended, they're kept but the
+					// producer's told too few replicas may hold them.
+					if err := b.checkInsyncReplicas(t, p.Partition, protocol.ErrNotEnoughReplicasAfterAppend); err != protocol.ErrNone {
+						log.Error.Printf("broker/%d: produce to partition error: %s", b.config.ID, err)
+						return err
+					}
+				}
 				return protocol.ErrNone
 			})
+			// fn may still be running if it timed out, throttle's only read once its result's
+			// been received.
+			if err.Code() == protocol.ErrThrottlingQuotaExceeded.Code() && throttle > res.ThrottleTime {
+				res.ThrottleTime = throttle
+			}
 			pres.ErrorCode = err.Code()
 			tres[j] = pres
 		}
@@ -452,6 +771,9 @@ func (b *Broker) handleProduce(ctx *Context, req *protocol.ProduceRequest) *prot
 			PartitionResponses: tres,
 		}
 	}
+	if res.ThrottleTime > 0 {
+		b.trackClientThrottle(ctx.Header().ClientID, produceQuota, res.ThrottleTime)
+	}
 	return res
 }
 
@@ -484,18 +806,26 @@ func (b *Broker) handleMetadata(ctx *Context, req *protocol.MetadataRequest) *pr
 		if !ok {
 			continue
 		}
-		brokers = append(brokers, &protocol.Broker{
+		broker := &protocol.Broker{
 			NodeID: m.ID.Int32(),
 			Host:   m.Host(),
 			Port:   m.Port(),
-		})
+		}
+		if rack, ok := m.Tags["rack"]; ok {
+			broker.Rack = &rack
+		}
+		brokers = append(brokers, broker)
 	}
+	// the brokers and partitions are sorted by ID so the metadata's the same across calls.
+	sort.Slice(brokers, func(i, j int) bool { return brokers[i].NodeID < brokers[j].NodeID })
 	var topicMetadata []*protocol.TopicMetadata
 	topicMetadataFn := func(topic *structs.Topic, err protocol.Error) *protocol.TopicMetadata {
 		if err != protocol.ErrNone {
 			return &protocol.TopicMetadata{
-				TopicErrorCode: err.Code(),
-				Topic:          topic.Topic,
+				TopicErrorCode:            err.Code(),
+				Topic:                     topic.Topic,
+				TopicID:                   topic.ID,
+				TopicAuthorizedOperations: protocol.AuthorizedOperationsOmitted,
 			}
 		}
 		partitionMetadata := make([]*protocol.PartitionMetadata, 0, len(topic.Partitions))
@@ -519,18 +849,27 @@ func (b *Broker) handleMetadata(ctx *Context, req *protocol.MetadataRequest) *pr
 				PartitionID:        p.ID,
 				PartitionErrorCode: protocol.ErrNone.Code(),
 				Leader:             p.Leader,
+				LeaderEpoch:        p.LeaderEpoch,
 				Replicas:           p.AR,
 				ISR:                p.ISR,
+				OfflineReplicas:    []int32{},
 			})
 		}
+		sort.Slice(partitionMetadata, func(i, j int) bool {
+			return partitionMetadata[i].PartitionID < partitionMetadata[j].PartitionID
+		})
 		return &protocol.TopicMetadata{
 			TopicErrorCode:    protocol.ErrNone.Code(),
 			Topic:             topic.Topic,
+			TopicID:           topic.ID,
+			IsInternal:        topic.Internal,
 			PartitionMetadata: partitionMetadata,
+			// the broker doesn't authorize requests so there are no operations to return.
+			TopicAuthorizedOperations: protocol.AuthorizedOperationsOmitted,
 		}
 	}
-	if len(req.Topics) == 0 {
-		// Respond with metadata for all topics
+	if req.Topics == nil && req.TopicIDs == nil {
+		// Respond with metadata for all topics, from version 1 an empty topics array asks for none
 		// how to handle err here?
 		_, topics, _ := state.GetTopics()
 		topicMetadata = make([]*protocol.TopicMetadata, 0, len(topics))
@@ -541,6 +880,17 @@ func (b *Broker) handleMetadata(ctx *Context, req *protocol.MetadataRequest) *pr
 		topicMetadata = make([]*protocol.TopicMetadata, 0, len(req.Topics))
 		for _, topicName := range req.Topics {
 			_, topic, err := state.GetTopic(topicName)
+			if topic == nil && err == nil && b.autoCreateTopics(req) {
+				if err := b.autoCreateTopic(ctx, topicName); err != protocol.ErrNone && err != protocol.ErrTopicAlreadyExists {
+					topicMetadata = append(topicMetadata, topicMetadataFn(&structs.Topic{Topic: topicName}, err))
+					continue
+				}
+				if _, topic, err = state.GetTopic(topicName); topic == nil && err == nil {
+					// the topic's created but this broker hasn't caught up with the controller yet.
+					topicMetadata = append(topicMetadata, topicMetadataFn(&structs.Topic{Topic: topicName}, protocol.ErrLeaderNotAvailable))
+					continue
+				}
+			}
 			if topic == nil {
 				topicMetadata = append(topicMetadata, topicMetadataFn(&structs.Topic{Topic: topicName}, protocol.ErrUnknownTopicOrPartition))
 			} else if err != nil {
@@ -550,9 +900,25 @@ func (b *Broker) handleMetadata(ctx *Context, req *protocol.MetadataRequest) *pr
 			}
 		}
 	}
+	// from v10 topics are requested by ID too.
+	for _, id := range req.TopicIDs {
+		_, topic, err := state.GetTopicByID(id)
+		if topic == nil {
+			topicMetadata = append(topicMetadata, topicMetadataFn(&structs.Topic{ID: id}, protocol.ErrUnknownTopicID))
+		} else if err != nil {
+			topicMetadata = append(topicMetadata, topicMetadataFn(&structs.Topic{ID: id}, protocol.ErrUnknown.WithErr(err)))
+		} else {
+			topicMetadata = append(topicMetadata, topicMetadataFn(topic, protocol.ErrNone))
+		}
+	}
 	res := &protocol.MetadataResponse{
-		Brokers:       brokers,
-		TopicMetadata: topicMetadata,
+		Brokers:                     brokers,
+		ControllerID:                -1,
+		TopicMetadata:               topicMetadata,
+		ClusterAuthorizedOperations: protocol.AuthorizedOperationsOmitted,
+	}
+	if controller := b.brokerLookup.BrokerByAddr(b.raft.Leader()); controller != nil {
+		res.ControllerID = controller.ID.Int32()
 	}
 	res.APIVersion = req.Version()
 	return res
@@ -565,41 +931,50 @@ func (b *Broker) handleFindCoordinator(ctx *Context, req *protocol.FindCoordinat
 	res := &protocol.FindCoordinatorResponse{}
 	res.APIVersion = req.Version()
 
-	var broker *metadata.Broker
-	var p *structs.Partition
-	var i int32
-
-	state := b.fsm.State()
+	broker, err := b.findCoordinator(ctx, req)
+	if err != protocol.ErrNone {
+		log.Error.Printf("broker/%d: find coordinator error: key: %s: %s", b.config.ID, req.CoordinatorKey, err)
+		res.ErrorCode = err.Code()
+		msg := err.Error()
+		res.ErrorMessage = &msg
+		return res
+	}
+	res.Coordinator.NodeID = broker.ID.Int32()
+	res.Coordinator.Host = broker.Host()
+	res.Coordinator.Port = broker.Port()
+	return res
+}
 
+// findCoordinator returns the broker leading the offsets topic partition the group's assigned,
+// creating the offsets topic if it doesn't exist yet. Transactions' coordinator is the controller.
+func (b *Broker) findCoordinator(ctx *Context, req *protocol.FindCoordinatorRequest) (*metadata.Broker, protocol.Error) {
+	if req.CoordinatorType == protocol.CoordinatorTransaction {
+		controller := b.brokerLookup.BrokerByAddr(b.raft.Leader())
+		if controller == nil {
+			return nil, protocol.ErrCoordinatorNotAvailable
+		}
+		return controller, protocol.ErrNone
+	}
+	if req.CoordinatorType != protocol.CoordinatorGroup {
+		return nil, protocol.ErrInvalidRequest.WithErr(fmt.Errorf("unsupported coordinator type: %d", req.CoordinatorType))
+	}
 	topic, err := b.offsetsTopic(ctx)
 	if err != nil {
-		goto ERROR
+		return nil, protocol.ErrCoordinatorNotAvailable.WithErr(err)
 	}
-	i = int32(util.Hash(req.CoordinatorKey) % uint64(len(topic.Partitions)))
-	_, p, err = state.GetPartition(OffsetsTopicName, i)
+	i := coordinatorPartition(req.CoordinatorKey, len(topic.Partitions))
+	_, p, err := b.fsm.State().GetPartition(OffsetsTopicName, i)
 	if err != nil {
-		goto ERROR
+		return nil, protocol.ErrCoordinatorNotAvailable.WithErr(err)
 	}
 	if p == nil {
-		res.ErrorCode = protocol.ErrUnknownTopicOrPartition.Code()
-		goto ERROR
+		return nil, protocol.ErrCoordinatorNotAvailable.WithErr(fmt.Errorf("offsets topic partition %d not found", i))
 	}
-	broker = b.brokerLookup.BrokerByID(raft.ServerID(fmt.Sprintf("%d", p.Leader)))
-
-	res.Coordinator.NodeID = broker.ID.Int32()
-	res.Coordinator.Host = broker.Host()
-	res.Coordinator.Port = broker.Port()
-
-	return res
-
-ERROR:
-	// todo: which err code to use?
-	if res.ErrorCode == 0 {
-		res.ErrorCode = protocol.ErrUnknown.Code()
+	broker := b.brokerLookup.BrokerByID(raft.ServerID(fmt.Sprintf("%d", p.Leader)))
+	if broker == nil {
+		return nil, protocol.ErrCoordinatorNotAvailable.WithErr(fmt.Errorf("offsets topic partition %d's leader %d not found", i, p.Leader))
 	}
-	log.Error.Printf("broker/%d: broker: %v: coordinator error: %s", b.config.ID, broker, err)
-
-	return res
+	return broker, protocol.ErrNone
 }
 
 func (b *Broker) handleJoinGroup(ctx *Context, r *protocol.JoinGroupRequest) *protocol.JoinGroupResponse {
@@ -609,55 +984,32 @@ func (b *Broker) handleJoinGroup(ctx *Context, r *protocol.JoinGroupRequest) *pr
 	res := &protocol.JoinGroupResponse{}
 	res.APIVersion = r.Version()
 
-	// // TODO: distribute this.
-	state := b.fsm.State()
-
-	_, group, err := state.GetGroup(r.GroupID)
-	if err != nil {
-		log.Error.Printf("broker/%d: get group error: %s", b.config.ID, err)
-		res.ErrorCode = protocol.ErrUnknown.Code()
+	if r.GroupID == "" {
+		res.ErrorCode = protocol.ErrInvalidGroupId.Code()
 		return res
 	}
-	// TODO: only try to create the group if the group is not unknown AND
-	// the member id is UNKNOWN, if member is specified but group does not
-	// exist we should reject the request
-	if group == nil {
-		// group doesn't exist so let's create it
-		group = &structs.Group{
-			Group:       r.GroupID,
-			Coordinator: b.config.ID,
-			Members:     make(map[string]structs.Member),
-		}
-	}
-	if r.MemberID == "" {
-		// for group member IDs -- can replace with something else
-		r.MemberID = ctx.Header().ClientID + "-" + uuid.NewV1().String()
-		group.Members[r.MemberID] = structs.Member{ID: r.MemberID}
+	if err := b.checkCoordinator(r.GroupID); err != protocol.ErrNone {
+		res.ErrorCode = err.Code()
+		return res
 	}
-	if group.LeaderID == "" {
-		group.LeaderID = r.MemberID
+	if err := b.checkSessionTimeout(r.SessionTimeout); err != protocol.ErrNone {
+		res.ErrorCode = err.Code()
+		return res
 	}
-	_, err = b.raftApply(structs.RegisterGroupRequestType, structs.RegisterGroupRequest{
-		Group: *group,
-	})
-	if err != nil {
-		log.Error.Printf("broker/%d: register group error: %s", b.config.ID, err)
-		res.ErrorCode = protocol.ErrUnknown.Code()
+	memberID, join, err := b.groups.join(r, ctx.Header().ClientID, clientHost(ctx), b.clock.Now())
+	if err != protocol.ErrNone {
+		res.ErrorCode = err.Code()
 		return res
 	}
-
-	res.GenerationID = 0
-	res.LeaderID = group.LeaderID
-	res.MemberID = r.MemberID
-
-	if res.LeaderID == res.MemberID {
-		// fill in members on response, we only do this for the leader to reduce overhead
-		for _, m := range group.Members {
-			res.Members = append(res.Members, protocol.Member{MemberID: m.ID, MemberMetadata: m.Metadata})
-		}
-
+	// join group is an async api so waiting on the other members doesn't hold up other conns.
+	select {
+	case <-join.done:
+	case <-b.shutdownCh:
+		res.ErrorCode = protocol.ErrCoordinatorNotAvailable.Code()
+		return res
 	}
-
+	res = b.groups.joined(memberID, join)
+	res.APIVersion = r.Version()
 	return res
 }
 
@@ -668,33 +1020,11 @@ func (b *Broker) handleLeaveGroup(ctx *Context, r *protocol.LeaveGroupRequest) *
 	res := &protocol.LeaveGroupResponse{}
 	res.APIVersion = r.Version()
 
-	// // TODO: distribute this.
-	state := b.fsm.State()
-
-	_, group, err := state.GetGroup(r.GroupID)
-	if err != nil {
-		res.ErrorCode = protocol.ErrUnknown.Code()
-		return res
-	}
-	if group == nil {
-		res.ErrorCode = protocol.ErrInvalidGroupId.Code()
-		return res
-	}
-	if _, ok := group.Members[r.MemberID]; !ok {
-		res.ErrorCode = protocol.ErrUnknownMemberId.Code()
-		return res
-	}
-
-	delete(group.Members, r.MemberID)
-
-	_, err = b.raftApply(structs.RegisterGroupRequestType, structs.RegisterGroupRequest{
-		Group: *group,
-	})
-	if err != nil {
-		res.ErrorCode = protocol.ErrUnknown.Code()
+	if err := b.checkCoordinator(r.GroupID); err != protocol.ErrNone {
+		res.ErrorCode = err.Code()
 		return res
 	}
-
+	res.ErrorCode = b.groups.leave(r.GroupID, r.MemberID, b.clock.Now()).Code()
 	return res
 }
 
@@ -702,84 +1032,29 @@ func (b *Broker) handleSyncGroup(ctx *Context, r *protocol.SyncGroupRequest) *pr
 	sp := span(ctx, b.tracer, "sync group")
 	defer sp.Finish()
 
-	state := b.fsm.State()
 	res := &protocol.SyncGroupResponse{}
 	res.APIVersion = r.Version()
 
-	_, group, err := state.GetGroup(r.GroupID)
-	if err != nil {
-		res.ErrorCode = protocol.ErrUnknown.Code()
-		return res
-	}
-	if group == nil {
-		res.ErrorCode = protocol.ErrInvalidGroupId.Code()
-		return res
-	}
-	if _, ok := group.Members[r.MemberID]; !ok {
-		res.ErrorCode = protocol.ErrUnknownMemberId.Code()
-		return res
-	}
-	if r.GenerationID != group.GenerationID {
-		res.ErrorCode = protocol.ErrIllegalGeneration.Code()
+	if err := b.checkCoordinator(r.GroupID); err != protocol.ErrNone {
+		res.ErrorCode = err.Code()
 		return res
 	}
-	switch group.State {
-	case structs.GroupStateEmpty, structs.GroupStateDead:
-		res.ErrorCode = protocol.ErrUnknownMemberId.Code()
-		return res
-	case structs.GroupStatePreparingRebalance:
-		res.ErrorCode = protocol.ErrRebalanceInProgress.Code()
+	sync, err := b.groups.sync(r, b.clock.Now())
+	if err != protocol.ErrNone {
+		res.ErrorCode = err.Code()
 		return res
-	case structs.GroupStateCompletingRebalance:
-		// TODO: wait to get member in group
-
-		if group.LeaderID == r.MemberID {
-			// if is leader, attempt to persist state and transition to stable
-			var assignment []protocol.GroupAssignment
-			for _, ga := range r.GroupAssignments {
-				if _, ok := group.Members[ga.MemberID]; !ok {
-					// if member isn't set fill in with empty assignment
-					assignment = append(assignment, protocol.GroupAssignment{
-						MemberID:         ga.MemberID,
-						MemberAssignment: nil,
-					})
-				} else {
-					assignment = append(assignment, ga)
-				}
-
-				// save group
-			}
-		}
-	case structs.GroupStateStable:
-		// in stable, return current assignment
-
 	}
-
-	if group.LeaderID == r.MemberID {
-		// take the assignments from the leader and save them
-		for _, ga := range r.GroupAssignments {
-			if m, ok := group.Members[ga.MemberID]; ok {
-				m.Assignment = ga.MemberAssignment
-			} else {
-				panic("sync group: unknown member")
-			}
-		}
-		_, err = b.raftApply(structs.RegisterGroupRequestType, structs.RegisterGroupRequest{
-			Group: *group,
-		})
-		if err != nil {
-			res.ErrorCode = protocol.ErrUnknown.Code()
+	if sync != nil {
+		// sync group is an async api so waiting on the leader doesn't hold up other conns.
+		select {
+		case <-sync.done:
+		case <-b.shutdownCh:
+			res.ErrorCode = protocol.ErrCoordinatorNotAvailable.Code()
 			return res
 		}
-	} else {
-		// TODO: need to wait until leader sets assignments
-		if m, ok := group.Members[r.MemberID]; ok {
-			res.MemberAssignment = m.Assignment
-		} else {
-			panic(fmt.Errorf("sync group: unknown member: %s", r.MemberID))
-		}
 	}
-
+	res = b.groups.synced(r)
+	res.APIVersion = r.Version()
 	return res
 }
 
@@ -790,20 +1065,11 @@ func (b *Broker) handleHeartbeat(ctx *Context, r *protocol.HeartbeatRequest) *pr
 	res := &protocol.HeartbeatResponse{}
 	res.APIVersion = r.Version()
 
-	state := b.fsm.State()
-	_, group, err := state.GetGroup(r.GroupID)
-	if err != nil {
-		res.ErrorCode = protocol.ErrUnknown.Code()
+	if err := b.checkCoordinator(r.GroupID); err != protocol.ErrNone {
+		res.ErrorCode = err.Code()
 		return res
 	}
-	if group == nil {
-		res.ErrorCode = protocol.ErrInvalidGroupId.Code()
-		return res
-	}
-	// TODO: need to handle case when rebalance is in process
-
-	res.ErrorCode = protocol.ErrNone.Code()
-
+	res.ErrorCode = b.groups.heartbeat(r, b.clock.Now()).Code()
 	return res
 }
 
@@ -814,25 +1080,159 @@ func (b *Broker) handleFetch(ctx *Context, r *protocol.FetchRequest) *protocol.F
 		Responses: make(protocol.FetchTopicResponses, len(r.Topics)),
 	}
 	fres.APIVersion = r.Version()
+	if r.SessionID != 0 {
+		// the broker doesn't create fetch sessions, responding with session ID 0 so fetchers
+		// send full fetch requests, so any other session is unknown.
+		fres.ErrorCode = protocol.ErrFetchSessionIDNotFound.Code()
+		fres.Responses = nil
+		return fres
+	}
 	for i, topic := range r.Topics {
 		fr := &protocol.FetchTopicResponse{
 			Topic:              topic.Topic,
+			TopicID:            topic.TopicID,
 			PartitionResponses: make([]*protocol.FetchPartitionResponse, len(topic.Partitions)),
 		}
+		fres.Responses[i] = fr
+		name := topic.Topic
+		if r.Version() >= 13 {
+			// from v13 topics are fetched by ID.
+			if _, t, _ := b.fsm.State().GetTopicByID(topic.TopicID); t != nil {
+				name = t.Topic
+			} else {
+				for j, p := range topic.Partitions {
+					fr.PartitionResponses[j] = &protocol.FetchPartitionResponse{
+						Partition:            p.Partition,
+						ErrorCode:            protocol.ErrUnknownTopicID.Code(),
+						HighWatermark:        -1,
+						LastStableOffset:     -1,
+						LogStartOffset:       -1,
+						PreferredReadReplica: -1,
+					}
+				}
+				continue
+			}
+		}
+		// consumers over the topic's byte rate get empty responses until their throttle time passes.
+		var rate int64
+		var throttle time.Duration
+		consumer := r.ReplicaID < 0
+		if consumer {
+			_, t, _ := b.fsm.State().GetTopic(name)
+			if rate = consumerByteRate(t); rate > 0 {
+				throttle = b.fetchQuotas.throttle(fetchQuotaKey(ctx.Header().ClientID, name), rate, b.clock.Now())
+				if throttle > fres.ThrottleTime {
+					fres.ThrottleTime = throttle
+				}
+			}
+		}
 		for j, p := range topic.Partitions {
 			fpres := &protocol.FetchPartitionResponse{}
 			fpres.Partition = p.Partition
-			err := b.withTimeout(r.MaxWaitTime, func() protocol.Error {
-				replica, err := b.replicaLookup.Replica(topic.Topic, p.Partition)
+			// the broker doesn't serve fetches from followers, consumers fetch from the leader.
+			fpres.PreferredReadReplica = -1
+			// fetches without a max wait time, like followers', are answered with what's already
+			// available rather than withTimeout running the read in the background.
+			wait := b.withTimeout
+			if r.MaxWaitTime <= 0 {
+				wait = func(_ time.Duration, fn func() protocol.Error) protocol.Error { return fn() }
+			}
+			err := wait(r.MaxWaitTime, func() protocol.Error {
+				replica, err := b.fetchReplica(name, p.Partition)
 				if err != nil {
+					if _, t, _ := b.fsm.State().GetTopic(name); t == nil && name != ClusterMetadataTopic {
+						// e.g. the topic was deleted and its replica removed.
+						return protocol.ErrUnknownTopicOrPartition
+					}
 					return protocol.ErrReplicaNotAvailable
 				}
-				if replica.Partition.Leader != b.config.ID {
-					return protocol.ErrNotLeaderForPartition
+				if r.Version() >= 9 {
+					if err := b.checkLeaderEpoch(replica, p.CurrentLeaderEpoch); err != protocol.ErrNone {
+						return err
+					}
+				}
+				// debugging fetches read any of the partition's replicas, not just the leader's.
+				debugging := r.ReplicaID == protocol.DebuggingReplicaID
+				if !debugging {
+					if err := b.checkLeader(replica); err != protocol.ErrNone {
+						return err
+					}
+				}
+				follower := r.ReplicaID != b.config.ID && contains(replica.Partition.AR, r.ReplicaID)
+				if follower {
+					// followers fetch continuously so they don't keep the partition awake, they
+					// resume when it's woken by a produce or consumer fetch.
+					replica.fetchedBy(r.ReplicaID, b.clock.Now())
+					if !replica.pinAwake() {
+						fpres.HighWatermark = -1
+						return protocol.ErrNone
+					}
+				} else if err := b.wakeReplica(replica); err != protocol.ErrNone {
+					return err
 				}
+				defer replica.unpin()
 				if replica.Log == nil {
 					return protocol.ErrReplicaNotAvailable
 				}
+				newest := replica.Log.NewestOffset()
+				oldest := replica.Log.OldestOffset()
+				fpres.LogStartOffset = oldest
+				if p.FetchOffset < oldest || p.FetchOffset > newest {
+					// consumers reset their offset per their auto offset reset policy.
+					fpres.HighWatermark = newest - 1
+					return protocol.ErrOffsetOutOfRange
+				}
+				// records on delayed delivery topics are hidden from consumers until they're visible,
+				// followers replicate them right away and debugging fetches read them as they are.
+				visible := newest
+				if !follower && !debugging {
+					visible = replica.visibleOffset(newest, b.clock.Now())
+				}
+				// read committed consumers aren't served the records of transactions that aren't
+				// committed or aborted yet, and are told the aborted transactions to skip.
+				stable := visible
+				if r.IsolationLevel == protocol.ReadCommitted && !follower {
+					if lso := lastStableOffset(replica.Log); lso < stable {
+						stable = lso
+					}
+					fpres.AbortedTransactions = abortedTransactions(replica.Log, p.FetchOffset, stable)
+				}
+				fpres.LastStableOffset = stable - 1
+				if throttle > 0 || (stable < newest && p.FetchOffset >= stable) {
+					fpres.HighWatermark = visible - 1
+					return protocol.ErrNone
+				}
+				if p.FetchOffset == newest {
+					// caught up, there's nothing to read past the log end.
+					fpres.HighWatermark = newest - 1
+					return protocol.ErrNone
+				}
+				// consumers fetching with versions before 10 can't read zstd record batches, so they're
+				// fetched up to the first, replicas copy them as they are.
+				zstdUnsupported := !follower && !debugging && r.Version() < 10
+				key := fetchKey{log: replica.Log, topic: name, partition: p.Partition, offset: p.FetchOffset, maxBytes: p.MaxBytes}
+				if set, ok := b.fetchCache.get(key, newest); ok {
+					if stable < newest {
+						set = truncateRecordSet(set, stable)
+					}
+					if zstdUnsupported {
+						if i := protocol.IndexCodec(set, protocol.CompressionZSTD); i == 0 {
+							return protocol.ErrUnsupportedCompressionType
+						} else if i > 0 {
+							set = set[:i]
+						}
+					}
+					fpres.HighWatermark = visible - 1
+					fpres.RecordSet = set
+					b.trackFetch(name, p.Partition, len(set))
+					if consumer {
+						b.trackClientBytes(ctx.Header().ClientID, fetchQuota, len(set))
+					}
+					if rate > 0 {
+						b.fetchQuotas.record(fetchQuotaKey(ctx.Header().ClientID, name), len(set), b.clock.Now())
+					}
+					return protocol.ErrNone
+				}
 				rdr, rdrErr := replica.Log.NewReader(p.FetchOffset, p.MaxBytes)
 				if rdrErr != nil {
 					log.Error.Printf("broker/%d: replica log read error: %s", b.config.ID, rdrErr)
@@ -855,127 +1255,96 @@ func (b *Broker) handleFetch(ctx *Context, r *protocol.FetchRequest) *protocol.F
 				}
 				fpres.HighWatermark = replica.Log.NewestOffset() - 1
 				fpres.RecordSet = buf.Bytes()
+				b.fetchCache.add(key, newest, fpres.RecordSet)
+				if visible < newest {
+					fpres.HighWatermark = visible - 1
+				}
+				if stable < newest {
+					fpres.RecordSet = truncateRecordSet(fpres.RecordSet, stable)
+				}
+				if zstdUnsupported {
+					if i := protocol.IndexCodec(fpres.RecordSet, protocol.CompressionZSTD); i == 0 {
+						fpres.RecordSet = nil
+						return protocol.ErrUnsupportedCompressionType
+					} else if i > 0 {
+						fpres.RecordSet = fpres.RecordSet[:i]
+					}
+				}
+				b.trackFetch(name, p.Partition, len(fpres.RecordSet))
+				if consumer {
+					b.trackClientBytes(ctx.Header().ClientID, fetchQuota, len(fpres.RecordSet))
+				}
+				if rate > 0 {
+					b.fetchQuotas.record(fetchQuotaKey(ctx.Header().ClientID, name), len(fpres.RecordSet), b.clock.Now())
+				}
 				return protocol.ErrNone
 			})
 			fpres.ErrorCode = err.Code()
 			fr.PartitionResponses[j] = fpres
 		}
-		fres.Responses[i] = fr
+	}
+	if fres.ThrottleTime > 0 {
+		b.trackClientThrottle(ctx.Header().ClientID, fetchQuota, fres.ThrottleTime)
 	}
 	return fres
 }
 
-func (b *Broker) handleSaslHandshake(ctx *Context, req *protocol.SaslHandshakeRequest) *protocol.SaslHandshakeResponse {
-	panic("not implemented: sasl handshake")
-	return nil
-}
-
 func (b *Broker) handleListGroups(ctx *Context, req *protocol.ListGroupsRequest) *protocol.ListGroupsResponse {
-	sp := span(ctx, b.tracer, "create topic")
+	sp := span(ctx, b.tracer, "list groups")
 	defer sp.Finish()
 	res := new(protocol.ListGroupsResponse)
 	res.APIVersion = req.Version()
-	state := b.fsm.State()
-
-	fmt.Println("list")
-	fmt.Println("list")
-	fmt.Println("list")
-
-	_, groups, err := state.GetGroups()
-	if err != nil {
-		res.ErrorCode = protocol.ErrUnknown.Code()
-		return res
-	}
-	for _, group := range groups {
-		res.Groups = append(res.Groups, protocol.ListGroup{
-			GroupID: group.Group,
-			// TODO: add protocol type
-			ProtocolType: "consumer",
-		})
-	}
+	res.Groups = b.groups.list()
 	return res
 }
 
 func (b *Broker) handleDescribeGroups(ctx *Context, req *protocol.DescribeGroupsRequest) *protocol.DescribeGroupsResponse {
-	sp := span(ctx, b.tracer, "create topic")
+	sp := span(ctx, b.tracer, "describe groups")
 	defer sp.Finish()
 	res := new(protocol.DescribeGroupsResponse)
 	res.APIVersion = req.Version()
-	state := b.fsm.State()
-
-	fmt.Println("describe")
-	fmt.Println("describe")
-	fmt.Println("describe")
-
 	for _, id := range req.GroupIDs {
-		group := protocol.Group{}
-		_, g, err := state.GetGroup(id)
-		if err != nil {
-			group.ErrorCode = protocol.ErrUnknown.Code()
-			group.GroupID = id
-			res.Groups = append(res.Groups, group)
-			return res
-		}
-		group.GroupID = id
-		group.State = "Stable"
-		group.ProtocolType = "consumer"
-		group.Protocol = "consumer"
-		for id, member := range g.Members {
-			group.GroupMembers[id] = &protocol.GroupMember{
-				ClientID: member.ID,
-				// TODO: ???
-				ClientHost:            "",
-				GroupMemberMetadata:   member.Metadata,
-				GroupMemberAssignment: member.Assignment,
-			}
+		if err := b.checkCoordinator(id); err != protocol.ErrNone {
+			res.Groups = append(res.Groups, protocol.Group{ErrorCode: err.Code(), GroupID: id})
+			continue
 		}
-		res.Groups = append(res.Groups)
-
+		res.Groups = append(res.Groups, b.groups.describe(id))
 	}
-
 	return res
 }
 
-func (b *Broker) handleStopReplica(ctx *Context, req *protocol.StopReplicaRequest) *protocol.StopReplicaResponse {
-	panic("not implemented: stop replica")
-	return nil
-}
-
-func (b *Broker) handleUpdateMetadata(ctx *Context, req *protocol.UpdateMetadataRequest) *protocol.UpdateMetadataResponse {
-	panic("not implemented: update metadata")
-	return nil
-}
-
-func (b *Broker) handleControlledShutdown(ctx *Context, req *protocol.ControlledShutdownRequest) *protocol.ControlledShutdownResponse {
-	panic("not implemented: controlled shutdown")
-	return nil
-}
-
-func (b *Broker) handleOffsetCommit(ctx *Context, req *protocol.OffsetCommitRequest) *protocol.OffsetCommitResponse {
-	panic("not implemented: offset commit")
-	return nil
-}
-
 func (b *Broker) handleOffsetFetch(ctx *Context, req *protocol.OffsetFetchRequest) *protocol.OffsetFetchResponse {
-	sp := span(ctx, b.tracer, "create topic")
+	sp := span(ctx, b.tracer, "offset fetch")
 	defer sp.Finish()
 
 	res := new(protocol.OffsetFetchResponse)
 	res.APIVersion = req.Version()
 	res.Responses = make([]protocol.OffsetFetchTopicResponse, len(req.Topics))
 
-	// state := b.fsm.State()
-
-	// _, g, err := state.GetGroup(req.GroupID)
-
-	// // If group doesn't exist then create it?
-	// if err != nil {
-	// 	// TODO: handle err
-	// 	panic(err)
-	// }
+	replica, err := b.coordinatorReplica(req.GroupID)
+	for i, t := range req.Topics {
+		res.Responses[i].Topic = t.Topic
+		res.Responses[i].Partitions = make([]protocol.OffsetFetchPartition, len(t.Partitions))
+		for j, partition := range t.Partitions {
+			// partitions without a committed offset are answered with offset -1.
+			p := protocol.OffsetFetchPartition{Partition: partition, Offset: -1}
+			if err != protocol.ErrNone {
+				p.ErrorCode = err.Code()
+			} else if v, ok, rerr := b.committedOffset(replica, offsetCommitKey{Group: req.GroupID, Topic: t.Topic, Partition: partition}); rerr != nil {
+				log.Error.Printf("broker/%d: offset fetch: read committed offsets error: %s", b.config.ID, rerr)
+				p.ErrorCode = protocol.ErrUnknown.Code()
+			} else if ok && !b.committedBeforeCreated(t.Topic, v) {
+				p.Offset = v.Offset
+				p.Metadata = &v.Metadata
+			}
+			res.Responses[i].Partitions[j] = p
+		}
+	}
+	if err == protocol.ErrNone {
+		replica.unpin()
+	}
 
 	return res
-
 }
 
 // isController returns true if this is the cluster controller.
@@ -1011,42 +1380,92 @@ func (b *Broker) startReplica(replica *Replica) protocol.Error {
 	}
 
 	if replica.Log == nil {
+		retentionBytes, retentionAge := topicRetention(topic)
+		path := filepath.Join(b.config.DataDir, "data", fmt.Sprintf("%s-%d", replica.Partition.Topic, replica.Partition.ID))
+		if err := b.adoptLegacyPartitionLog(path, replica.Partition); err != nil {
+			return protocol.ErrUnknown.WithErr(err)
+		}
+		if err := b.ensurePartitionTopicID(path, topic.ID); err != nil {
+			return protocol.ErrUnknown.WithErr(err)
+		}
+		replica.topicID = topic.ID
 		log, err := commitlog.New(commitlog.Options{
-			Path:            filepath.Join(b.config.DataDir, "data", fmt.Sprintf("%d", replica.Partition.ID)),
+			Path:            path,
 			MaxSegmentBytes: 1024,
-			MaxLogBytes:     -1,
-			CleanupPolicy:   commitlog.CleanupPolicy(topic.Config.GetValue("cleanup.policy").(string)),
+			MaxLogBytes:     retentionBytes,
+			MaxLogAge:       retentionAge,
+			CleanupPolicy:   commitlog.CleanupPolicy(topic.Config.GetString("cleanup.policy")),
+			FileCache:       b.segmentFiles,
+			Clock:           b.clock,
 		})
 		if err != nil {
 			return protocol.ErrUnknown.WithErr(err)
 		}
 		replica.Log = log
+		replica.loadProducerSequences()
 		// TODO: register leader-change listener on r.replica.Partition.id
 	}
 
 	return protocol.ErrNone
 }
 
-// createTopic is used to create the topic across the cluster.
-func (b *Broker) createTopic(ctx *Context, topic *protocol.CreateTopicRequest) protocol.Error {
+// sendLeaderAndISR sends the leader and isr request to the given broker, handling it directly if
+// it's this broker.
+func (b *Broker) sendLeaderAndISR(id int32, req *protocol.LeaderAndISRRequest) error {
+	if id == b.config.ID {
+		b.handleLeaderAndISR(&Context{parent: context.Background(), header: &protocol.RequestHeader{}}, req)
+		return nil
+	}
+	_, err := b.brokerClient(id).LeaderAndISR(req)
+	return err
+}
+
+// createTopic is used to create the topic across the cluster. The deadline, if set, bounds
+// registering the topic, returning ErrRequestTimedOut if it isn't registered by then. Once it's
+// registered its partitions are led regardless so they aren't left without replicas.
+func (b *Broker) createTopic(ctx *Context, topic *protocol.CreateTopicRequest, deadline time.Time) protocol.Error {
 	state := b.fsm.State()
 	_, t, _ := state.GetTopic(topic.Topic)
 	if t != nil {
 		return protocol.ErrTopicAlreadyExists
 	}
-	ps, err := b.buildPartitions(topic.Topic, topic.NumPartitions, topic.ReplicationFactor)
+	tt := structs.Topic{
+		ID:              newTopicID(),
+		CreateTimestamp: b.clock.Now().UnixNano() / int64(time.Millisecond),
+		Topic:           topic.Topic,
+		Partitions:      make(map[int32][]int32),
+		Config:          structs.NewTopicConfig(),
+	}
+	for name, value := range topic.Configs {
+		if err := tt.Config.SetValueFromString(name, value); err != nil {
+			return protocol.ErrInvalidConfig.WithErr(err)
+		}
+	}
+	constraints, perr := parsePlacementConstraints(tt.Config.GetString(placementConstraintsConfig))
+	if perr != nil {
+		return protocol.ErrInvalidConfig.WithErr(perr)
+	}
+	ps, err := b.buildPartitions(topic.Topic, topic.NumPartitions, topic.ReplicationFactor, constraints)
 	if err != protocol.ErrNone {
 		return err
 	}
-	tt := structs.Topic{
-		Topic:      topic.Topic,
-		Partitions: make(map[int32][]int32),
+	if err := b.checkPartitionLimits(ps); err != protocol.ErrNone {
+		return err
 	}
+	fenceDeletedPartitions(state, ps)
 	for _, partition := range ps {
 		tt.Partitions[partition.ID] = partition.AR
 	}
-	// TODO: create/set topic config here
-	if _, err := b.raftApply(structs.RegisterTopicRequestType, structs.RegisterTopicRequest{Topic: tt}); err != nil {
+	timeout := raftApplyTimeout
+	if !deadline.IsZero() {
+		if timeout = deadline.Sub(b.clock.Now()); timeout <= 0 {
+			return protocol.ErrRequestTimedOut
+		}
+	}
+	if _, err := b.raftApplyWithin(structs.RegisterTopicRequestType, structs.RegisterTopicRequest{Topic: tt}, timeout); err != nil {
+		if err == raft.ErrEnqueueTimeout {
+			return protocol.ErrRequestTimedOut.WithErr(err)
+		}
 		return protocol.ErrUnknown.WithErr(err)
 	}
 	for _, partition := range ps {
@@ -1054,7 +1473,22 @@ func (b *Broker) createTopic(ctx *Context, topic *protocol.CreateTopicRequest) p
 			return protocol.ErrUnknown.WithErr(err)
 		}
 	}
-	// could move this up maybe and do the iteration once
+	if deadLetterQueueEnabled(&tt) {
+		dlq := &protocol.CreateTopicRequest{
+			Topic:             deadLetterTopic(tt.Topic),
+			NumPartitions:     1,
+			ReplicationFactor: topic.ReplicationFactor,
+		}
+		if err := b.createTopic(ctx, dlq, deadline); err != protocol.ErrNone && err != protocol.ErrTopicAlreadyExists {
+			return err
+		}
+	}
+	return b.leadPartitions(ctx, ps)
+}
+
+// leadPartitions sends the new partitions' leaders and ISRs to the brokers so they start their
+// replicas.
+func (b *Broker) leadPartitions(ctx *Context, ps []structs.Partition) protocol.Error {
 	req := &protocol.LeaderAndISRRequest{
 		ControllerID: b.config.ID,
 		// TODO ControllerEpoch
@@ -1064,10 +1498,11 @@ func (b *Broker) createTopic(ctx *Context, topic *protocol.CreateTopicRequest) p
 		req.PartitionStates = append(req.PartitionStates, &protocol.PartitionState{
 			Topic:     partition.Topic,
 			Partition: partition.ID,
-			// TODO: ControllerEpoch, LeaderEpoch, ZKVersion
-			Leader:   partition.Leader,
-			ISR:      partition.ISR,
-			Replicas: partition.AR,
+			// TODO: ControllerEpoch, ZKVersion
+			LeaderEpoch: partition.LeaderEpoch,
+			Leader:      partition.Leader,
+			ISR:         partition.ISR,
+			Replicas:    partition.AR,
 		})
 	}
 	// TODO: can optimize this
@@ -1078,11 +1513,7 @@ func (b *Broker) createTopic(ctx *Context, topic *protocol.CreateTopicRequest) p
 				panic(fmt.Sprintf("broker/%d: handling leader and isr error: %d", b.config.ID, errCode))
 			}
 		} else {
-			conn, err := Dial("tcp", broker.BrokerAddr)
-			if err != nil {
-				return protocol.ErrUnknown.WithErr(err)
-			}
-			res, err := conn.LeaderAndISR(req)
+			res, err := b.brokerClient(broker.ID.Int32()).LeaderAndISR(req)
 			if err != nil {
 				// handle err and responses
 				return protocol.ErrUnknown.WithErr(err)
@@ -1093,11 +1524,14 @@ func (b *Broker) createTopic(ctx *Context, topic *protocol.CreateTopicRequest) p
 	return protocol.ErrNone
 }
 
-func (b *Broker) buildPartitions(topic string, partitionsCount int32, replicationFactor int16) ([]structs.Partition, protocol.Error) {
-	brokers := b.brokerLookup.Brokers()
+func (b *Broker) buildPartitions(topic string, partitionsCount int32, replicationFactor int16, constraints map[string]string) ([]structs.Partition, protocol.Error) {
+	brokers := b.partitionBrokers(constraints)
 	count := len(brokers)
 
-	if int(replicationFactor) > count {
+	if count == 0 || int(replicationFactor) > count {
+		if len(constraints) != 0 {
+			return nil, protocol.ErrInvalidReplicationFactor.WithErr(fmt.Errorf("replication factor %d is greater than the %d brokers matching the placement constraints", replicationFactor, count))
+		}
 		return nil, protocol.ErrInvalidReplicationFactor
 	}
 
@@ -1109,21 +1543,27 @@ func (b *Broker) buildPartitions(topic string, partitionsCount int32, replicatio
 	}
 
 	var partitions []structs.Partition
+	// the replicas are biased toward the emptier disks when the brokers' disks are used unevenly.
+	weights := diskWeights(brokers)
 
 	for i := int32(0); i < partitionsCount; i++ {
-		// TODO: maybe just go next here too
-		r = r.Move(rand.Intn(count))
-		leader := r.Value.(*metadata.Broker)
-		replicas := []int32{leader.ID.Int32()}
-		for i := int16(0); i < replicationFactor-1; i++ {
-			r = r.Next()
-			replicas = append(replicas, r.Value.(*metadata.Broker).ID.Int32())
+		var replicas []int32
+		if weights != nil {
+			replicas = pickReplicas(brokers, weights, int(replicationFactor))
+		} else {
+			// TODO: maybe just go next here too
+			r = r.Move(rand.Intn(count))
+			replicas = []int32{r.Value.(*metadata.Broker).ID.Int32()}
+			for i := int16(0); i < replicationFactor-1; i++ {
+				r = r.Next()
+				replicas = append(replicas, r.Value.(*metadata.Broker).ID.Int32())
+			}
 		}
 		partition := structs.Partition{
 			Topic:     topic,
 			ID:        i,
 			Partition: i,
-			Leader:    leader.ID.Int32(),
+			Leader:    replicas[0],
 			AR:        replicas,
 			ISR:       replicas,
 		}
@@ -1133,6 +1573,61 @@ func (b *Broker) buildPartitions(topic string, partitionsCount int32, replicatio
 	return partitions, protocol.ErrNone
 }
 
+// checkPartitionLimits returns a policy violation if adding the given partitions
+// would put the cluster or any broker over its configured partition limit.
+func (b *Broker) checkPartitionLimits(ps []structs.Partition) protocol.Error {
+	b.RLock()
+	maxPerBroker, max := b.config.MaxPartitionsPerBroker, b.config.MaxPartitions
+	b.RUnlock()
+	if max <= 0 && maxPerBroker <= 0 {
+		return protocol.ErrNone
+	}
+	_, existing, err := b.fsm.State().GetPartitions()
+	if err != nil {
+		return protocol.ErrUnknown.WithErr(err)
+	}
+	if err := partitionLimitsErr(existing, ps, maxPerBroker, max); err != nil {
+		return protocol.ErrPolicyViolation.WithErr(err)
+	}
+	return protocol.ErrNone
+}
+
+func partitionLimitsErr(existing []*structs.Partition, ps []structs.Partition, maxPerBroker, max int) error {
+	if max > 0 && len(existing)+len(ps) > max {
+		return fmt.Errorf("creating %d partitions would exceed the cluster limit of %d partitions, %d exist", len(ps), max, len(existing))
+	}
+	if maxPerBroker <= 0 {
+		return nil
+	}
+	counts := make(map[int32]int)
+	for _, p := range existing {
+		for _, r := range p.AR {
+			counts[r]++
+		}
+	}
+	for _, p := range ps {
+		for _, r := range p.AR {
+			counts[r]++
+			if counts[r] > maxPerBroker {
+				return fmt.Errorf("broker %d would exceed the limit of %d partitions per broker", r, maxPerBroker)
+			}
+		}
+	}
+	return nil
+}
+
+// Reload validates the given config and applies its options that can be changed while the broker
+// is running.
+func (b *Broker) Reload(config *config.Config) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	b.Lock()
+	defer b.Unlock()
+	b.config.Reload(config)
+	return nil
+}
+
 // Leave is used to prepare for a graceful shutdown.
 func (b *Broker) Leave() error {
 	log.Info.Printf("broker/%d: starting leave", b.config.ID)
@@ -1198,6 +1693,7 @@ func (b *Broker) Shutdown() error {
 	}
 	b.shutdown = true
 	close(b.shutdownCh)
+	b.closeReplicators()
 
 	if b.serf != nil {
 		b.serf.Shutdown()
@@ -1214,9 +1710,32 @@ func (b *Broker) Shutdown() error {
 		}
 	}
 
+	b.brokerConns.close()
+	b.replicaConns.close()
+
+	if b.clusterMetadata != nil {
+		if err := b.clusterMetadata.close(); err != nil {
+			log.Error.Printf("broker/%d: close cluster metadata log error: %s", b.config.ID, err)
+		}
+	}
+
+	b.waitGoroutines()
+
 	return nil
 }
 
+// closeReplicators stops the broker's replicas fetching from their leaders.
+func (b *Broker) closeReplicators() {
+	for _, replica := range b.replicaLookup.Replicas() {
+		replica.Lock()
+		if replica.Replicator != nil {
+			replica.Replicator.Close()
+			replica.Replicator = nil
+		}
+		replica.Unlock()
+	}
+}
+
 // Replication.
 
 func (b *Broker) becomeFollower(replica *Replica, cmd *protocol.PartitionState) protocol.Error {
@@ -1232,15 +1751,12 @@ func (b *Broker) becomeFollower(replica *Replica, cmd *protocol.PartitionState)
 	if err := replica.Log.Truncate(hw); err != nil {
 		return protocol.ErrUnknown.WithErr(err)
 	}
+	b.fetchCache.invalidate(replica.Partition.Topic, replica.Partition.ID)
 	broker := b.brokerLookup.BrokerByID(raft.ServerID(fmt.Sprintf("%d", cmd.Leader)))
 	if broker == nil {
 		return protocol.ErrBrokerNotAvailable
 	}
-	conn, err := NewDialer(fmt.Sprintf("jocko-replicator-%d", b.config.ID)).Dial("tcp", broker.BrokerAddr)
-	if err != nil {
-		return protocol.ErrUnknown.WithErr(err)
-	}
-	r := NewReplicator(ReplicatorConfig{}, replica, conn)
+	r := NewReplicator(ReplicatorConfig{Clock: b.clock, buffers: b.buffers, goroutines: b.goroutines, LagWarnThreshold: b.config.ReplicaLagWarnThreshold}, replica, brokerClient{pool: b.replicaConns, id: cmd.Leader})
 	replica.Replicator = r
 	if !b.config.DevMode {
 		r.Replicate()
@@ -1260,7 +1776,7 @@ func (b *Broker) becomeLeader(replica *Replica, cmd *protocol.PartitionState) pr
 	replica.Partition.Leader = cmd.Leader
 	replica.Partition.AR = cmd.Replicas
 	replica.Partition.ISR = cmd.ISR
-	replica.Partition.LeaderEpoch = cmd.ZKVersion
+	replica.Partition.LeaderEpoch = cmd.LeaderEpoch
 	return protocol.ErrNone
 }
 
@@ -1324,6 +1840,20 @@ type Replica struct {
 	Hw         int64
 	Leo        int64
 	Replicator *Replicator
+	// lastUsed is the unix nano time the replica was last produced to or fetched from.
+	lastUsed int64
+	// hibernated is set when the replica's log was closed because it was idle.
+	hibernated bool
+	// pins counts the handlers using the replica's log, it isn't hibernated while it's pinned.
+	pins int32
+	// followerFetched is when each follower last fetched from the replica.
+	followerFetched map[int32]time.Time
+	// visibility tracks the offsets hidden from consumers on delayed delivery topics.
+	visibility *visibility
+	// sequences tracks the sequences idempotent producers have appended to the replica.
+	sequences *producerSequences
+	// topicID is the ID of the topic the replica's log belongs to, set when it's started.
+	topicID string
 	sync.Mutex
 }
 
@@ -1343,15 +1873,21 @@ func (b *Broker) offsetsTopic(ctx *Context) (topic *structs.Topic, err error) {
 		return
 	}
 
-	// doesn't exist so let's create it
-	partitions, err := b.buildPartitions(OffsetsTopicName, 50, b.config.OffsetsTopicReplicationFactor)
+	// doesn't exist so let's create it, with no more replicas than the cluster's expected to have.
+	replicationFactor := b.config.OffsetsTopicReplicationFactor
+	if n := b.config.BootstrapExpect; n > 0 && int(replicationFactor) > n {
+		replicationFactor = int16(n)
+	}
+	partitions, err := b.buildPartitions(OffsetsTopicName, 50, replicationFactor, nil)
 	if err != protocol.ErrNone {
 		return nil, err
 	}
 	topic = &structs.Topic{
-		Topic:      OffsetsTopicName,
-		Internal:   true,
-		Partitions: make(map[int32][]int32),
+		ID:              newTopicID(),
+		CreateTimestamp: b.clock.Now().UnixNano() / int64(time.Millisecond),
+		Topic:           OffsetsTopicName,
+		Internal:        true,
+		Partitions:      make(map[int32][]int32),
 	}
 	for _, p := range partitions {
 		topic.Partitions[p.Partition] = p.AR
@@ -1364,6 +1900,9 @@ func (b *Broker) offsetsTopic(ctx *Context) (topic *structs.Topic, err error) {
 			return nil, err
 		}
 	}
+	if err := b.leadPartitions(ctx, partitions); err != protocol.ErrNone {
+		return nil, err
+	}
 	return
 }
 
@@ -1378,10 +1917,10 @@ func (b *Broker) withTimeout(timeout time.Duration, fn func() protocol.Error) pr
 		return protocol.ErrNone
 	}
 
+	// buffered so fn can send its result after timing out.
 	c := make(chan protocol.Error, 1)
-	defer close(c)
 
-	timer := time.NewTimer(timeout)
+	timer := b.clock.NewTimer(timeout)
 	defer timer.Stop()
 
 	go func() {
@@ -1391,18 +1930,18 @@ func (b *Broker) withTimeout(timeout time.Duration, fn func() protocol.Error) pr
 	select {
 	case err := <-c:
 		return err
-	case <-timer.C:
+	case <-timer.C():
 		return protocol.ErrRequestTimedOut
 	}
 }
 
 func (b *Broker) logState() {
-	t := time.NewTicker(b.logStateInterval)
+	t := b.clock.NewTicker(b.logStateInterval)
 	for {
 		select {
 		case <-b.shutdownCh:
 			return
-		case <-t.C:
+		case <-t.C():
 			var buf bytes.Buffer
 			buf.WriteString("\tmembers:\n")
 			members := b.LANMembers()
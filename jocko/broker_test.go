@@ -6,7 +6,6 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"net"
 	"os"
 	"reflect"
 	"testing"
@@ -14,7 +13,6 @@ import (
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/hashicorp/consul/testutil/retry"
-	"github.com/hashicorp/raft"
 	"github.com/hashicorp/serf/serf"
 	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/stretchr/testify/require"
@@ -191,7 +189,7 @@ func TestBroker_Run(t *testing.T) {
 						res: &protocol.Response{CorrelationID: 3, Body: &protocol.OffsetsResponse{
 							Responses: []*protocol.OffsetResponse{{
 								Topic:              "test-topic",
-								PartitionResponses: []*protocol.PartitionResponse{{Partition: 0, Offsets: []int64{1}, ErrorCode: protocol.ErrNone.Code()}},
+								PartitionResponses: []*protocol.PartitionResponse{{Partition: 0, Offsets: []int64{1}, Offset: 1, ErrorCode: protocol.ErrNone.Code()}},
 							}},
 						}},
 					},
@@ -282,10 +280,11 @@ func TestBroker_Run(t *testing.T) {
 							Responses: protocol.FetchTopicResponses{{
 								Topic: "test-topic",
 								PartitionResponses: []*protocol.FetchPartitionResponse{{
-									Partition:     0,
-									ErrorCode:     protocol.ErrNone.Code(),
-									HighWatermark: 0,
-									RecordSet:     mustEncode(&protocol.MessageSet{Offset: 0, Messages: []*protocol.Message{{Value: []byte("The message.")}}}),
+									Partition:            0,
+									ErrorCode:            protocol.ErrNone.Code(),
+									HighWatermark:        0,
+									PreferredReadReplica: -1,
+									RecordSet:            mustEncode(&protocol.MessageSet{Offset: 0, Messages: []*protocol.Message{{Value: []byte("The message.")}}}),
 								}},
 							}}},
 						},
@@ -352,21 +351,29 @@ func TestBroker_Run(t *testing.T) {
 					{
 						header: &protocol.RequestHeader{CorrelationID: 3},
 						res: &protocol.Response{CorrelationID: 3, Body: &protocol.MetadataResponse{
-							Brokers: []*protocol.Broker{{NodeID: 1, Host: "localhost", Port: 9092}},
+							Brokers:      []*protocol.Broker{{NodeID: 1, Host: "localhost", Port: 9092}},
+							ControllerID: 1,
 							TopicMetadata: []*protocol.TopicMetadata{
-								{Topic: "test-topic", TopicErrorCode: protocol.ErrNone.Code(), PartitionMetadata: []*protocol.PartitionMetadata{{PartitionErrorCode: protocol.ErrNone.Code(), PartitionID: 0, Leader: 1, Replicas: []int32{1}, ISR: []int32{1}}}},
-								{Topic: "unknown-topic", TopicErrorCode: protocol.ErrUnknownTopicOrPartition.Code()},
+								{Topic: "test-topic", TopicErrorCode: protocol.ErrNone.Code(), PartitionMetadata: []*protocol.PartitionMetadata{{PartitionErrorCode: protocol.ErrNone.Code(), PartitionID: 0, Leader: 1, Replicas: []int32{1}, ISR: []int32{1}, OfflineReplicas: []int32{}}}, TopicAuthorizedOperations: protocol.AuthorizedOperationsOmitted},
+								{Topic: "unknown-topic", TopicErrorCode: protocol.ErrUnknownTopicOrPartition.Code(), TopicAuthorizedOperations: protocol.AuthorizedOperationsOmitted},
 							},
+							ClusterAuthorizedOperations: protocol.AuthorizedOperationsOmitted,
 						}},
 					},
 				},
 			},
-			handle: func(t *testing.T, _ *Broker, ctx *Context) {
+			handle: func(t *testing.T, b *Broker, ctx *Context) {
 				switch res := ctx.res.(*protocol.Response).Body.(type) {
 				// handle timestamp explicitly since we don't know what
 				// it'll be set to
 				case *protocol.ProduceResponse:
 					handleProduceResponse(t, res)
+				// the topic's id is generated when it's created.
+				case *protocol.MetadataResponse:
+					_, topic, err := b.fsm.State().GetTopic("test-topic")
+					require.NoError(t, err)
+					require.Equal(t, topic.ID, res.TopicMetadata[0].TopicID)
+					res.TopicMetadata[0].TopicID = ""
 				}
 			},
 		},
@@ -716,7 +723,7 @@ func TestBroker_JoinLAN(t *testing.T) {
 	defer os.RemoveAll(dir2)
 	defer s2.Shutdown()
 
-	joinLAN(t, s1, s2)
+	TestJoin(t, s1, s2)
 
 	retry.Run(t, func(r *retry.R) {
 		require.Equal(t, 2, len(s1.broker().LANMembers()))
@@ -727,7 +734,6 @@ func TestBroker_JoinLAN(t *testing.T) {
 func TestBroker_RegisterMember(t *testing.T) {
 	s1, dir1 := NewTestServer(t, func(cfg *config.Config) {
 		cfg.Bootstrap = true
-		cfg.BootstrapExpect = 3
 	}, nil)
 
 	defer os.RemoveAll(dir1)
@@ -741,9 +747,9 @@ func TestBroker_RegisterMember(t *testing.T) {
 	defer os.RemoveAll(dir2)
 	defer s2.Shutdown()
 
-	joinLAN(t, s2, s1)
+	TestJoin(t, s2, s1)
 
-	waitForLeader(t, s1, s2)
+	WaitForLeader(t, s1, s2)
 
 	state := s1.broker().fsm.State()
 	retry.Run(t, func(r *retry.R) {
@@ -771,6 +777,7 @@ func TestBroker_FailedMember(t *testing.T) {
 		cfg.Bootstrap = true
 		cfg.BootstrapExpect = 1
 		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
 	}, nil)
 	defer os.RemoveAll(dir1)
 	defer s1.Shutdown()
@@ -807,6 +814,7 @@ func TestBroker_LeftMember(t *testing.T) {
 		cfg.Bootstrap = true
 		cfg.BootstrapExpect = 1
 		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
 	}, nil)
 
 	defer os.RemoveAll(dir1)
@@ -868,8 +876,8 @@ func TestBroker_ReapLeader(t *testing.T) {
 	defer os.RemoveAll(dir3)
 	defer s3.Shutdown()
 
-	joinLAN(t, s1, s2)
-	joinLAN(t, s1, s3)
+	TestJoin(t, s1, s2)
+	TestJoin(t, s1, s3)
 
 	state := s1.broker().fsm.State()
 
@@ -914,7 +922,7 @@ func TestBroker_ReapMember(t *testing.T) {
 	defer os.RemoveAll(dir2)
 	defer s2.Shutdown()
 
-	joinLAN(t, s1, s2)
+	TestJoin(t, s1, s2)
 
 	state := s1.broker().fsm.State()
 
@@ -958,7 +966,6 @@ func TestBroker_ReapMember(t *testing.T) {
 func TestBroker_LeftLeader(t *testing.T) {
 	s1, dir1 := NewTestServer(t, func(cfg *config.Config) {
 		cfg.Bootstrap = true
-		cfg.BootstrapExpect = 3
 	}, nil)
 
 	defer os.RemoveAll(dir1)
@@ -980,8 +987,8 @@ func TestBroker_LeftLeader(t *testing.T) {
 
 	brokers := []*Broker{s1.broker(), s2.broker(), s3.broker()}
 
-	joinLAN(t, s2, s1)
-	joinLAN(t, s3, s1)
+	TestJoin(t, s2, s1)
+	TestJoin(t, s3, s1)
 
 	for _, b := range brokers {
 		retry.Run(t, func(r *retry.R) {
@@ -1043,56 +1050,6 @@ func TestBroker_LeftLeader(t *testing.T) {
 	})
 }
 
-func waitForLeader(t *testing.T, servers ...*Server) {
-	retry.Run(t, func(r *retry.R) {
-		var leader *Server
-		for _, s := range servers {
-			if raft.Leader == s.broker().raft.State() {
-				leader = s
-			}
-		}
-		if leader == nil {
-			r.Fatal("no leader")
-		}
-	})
-}
-
-func joinLAN(t *testing.T, leader *Server, member *Server) {
-	if leader == nil || member == nil {
-		panic("no server")
-	}
-	leaderAddr := fmt.Sprintf("127.0.0.1:%d", leader.config.SerfLANConfig.MemberlistConfig.BindPort)
-	memberAddr := fmt.Sprintf("127.0.0.1:%d", member.config.SerfLANConfig.MemberlistConfig.BindPort)
-	if err := member.broker().JoinLAN(leaderAddr); err != protocol.ErrNone {
-		t.Fatal(err)
-	}
-	retry.Run(t, func(r *retry.R) {
-		if !seeEachOther(leader.broker().LANMembers(), member.broker().LANMembers(), leaderAddr, memberAddr) {
-			r.Fatalf("leader and member cannot see each other")
-		}
-	})
-	if !seeEachOther(leader.broker().LANMembers(), member.broker().LANMembers(), leaderAddr, memberAddr) {
-		t.Fatalf("leader and member cannot see each other")
-	}
-}
-
-func seeEachOther(a, b []serf.Member, addra, addrb string) bool {
-	return serfMembersContains(a, addrb) && serfMembersContains(b, addra)
-}
-
-func serfMembersContains(members []serf.Member, addr string) bool {
-	_, want, err := net.SplitHostPort(addr)
-	if err != nil {
-		panic(err)
-	}
-	for _, m := range members {
-		if got := fmt.Sprintf("%d", m.Port); got == want {
-			return true
-		}
-	}
-	return false
-}
-
 // wantPeers determines whether the server has the given
 // number of voting raft peers.
 func wantPeers(s *Broker, peers int) error {
@@ -1123,3 +1080,93 @@ func handleProduceResponse(t *testing.T, res *protocol.ProduceResponse) {
 func (s *Server) broker() *Broker {
 	return s.handler.(*Broker)
 }
+
+func TestPartitionLimitsErr(t *testing.T) {
+	existing := []*structs.Partition{
+		{Topic: "a", ID: 0, AR: []int32{1, 2}},
+		{Topic: "a", ID: 1, AR: []int32{2, 1}},
+	}
+	ps := []structs.Partition{
+		{Topic: "b", ID: 0, AR: []int32{1, 2}},
+	}
+	require.NoError(t, partitionLimitsErr(existing, ps, 0, 0))
+	require.NoError(t, partitionLimitsErr(existing, ps, 3, 3))
+	require.Error(t, partitionLimitsErr(existing, ps, 0, 2))
+	require.Error(t, partitionLimitsErr(existing, ps, 2, 0))
+}
+
+func TestBroker_FetchOffsetOutOfRange(t *testing.T) {
+	s, dir := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+
+	conn, err := Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	CreateTopic(t, conn, "test-topic", 1, 1)
+
+	fetch := func(offset int64) *protocol.FetchPartitionResponse {
+		res, err := conn.Fetch(&protocol.FetchRequest{
+			APIVersion:  5,
+			MaxWaitTime: time.Second,
+			MinBytes:    1,
+			Topics: []*protocol.FetchTopic{{
+				Topic:      "test-topic",
+				Partitions: []*protocol.FetchPartition{{Partition: 0, FetchOffset: offset, MaxBytes: 1 << 20}},
+			}},
+		})
+		require.NoError(t, err)
+		return res.Responses[0].PartitionResponses[0]
+	}
+
+	fpres := fetch(5)
+	require.Equal(t, protocol.ErrOffsetOutOfRange.Code(), fpres.ErrorCode)
+	require.Equal(t, int64(0), fpres.LogStartOffset)
+	require.Equal(t, 0, len(fpres.RecordSet))
+
+	fpres = fetch(-1)
+	require.Equal(t, protocol.ErrOffsetOutOfRange.Code(), fpres.ErrorCode)
+}
+
+func TestBroker_MetadataOrder(t *testing.T) {
+	c := NewTestCluster(t, TestClusterOptions{})
+	defer c.Shutdown()
+
+	conn, err := Dial("tcp", c.Leader(t).Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	res, err := conn.CreateTopics(&protocol.CreateTopicRequests{
+		Timeout:  5 * time.Second,
+		Requests: []*protocol.CreateTopicRequest{{Topic: "test-topic", NumPartitions: 16, ReplicationFactor: 1}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrNone.Code(), res.TopicErrorCodes[0].ErrorCode)
+
+	// the brokers and partitions are sorted by ID, so the metadata's the same across calls.
+	var first *protocol.MetadataResponse
+	for i := 0; i < 5; i++ {
+		md, err := conn.Metadata(&protocol.MetadataRequest{APIVersion: 1, Topics: []string{"test-topic"}})
+		require.NoError(t, err)
+		require.Equal(t, 3, len(md.Brokers))
+		for j := 1; j < len(md.Brokers); j++ {
+			require.True(t, md.Brokers[j-1].NodeID < md.Brokers[j].NodeID)
+		}
+		partitions := md.TopicMetadata[0].PartitionMetadata
+		require.Equal(t, 16, len(partitions))
+		for j, p := range partitions {
+			require.Equal(t, int32(j), p.PartitionID)
+		}
+		if first == nil {
+			first = md
+		}
+		require.Equal(t, first.Brokers, md.Brokers)
+		require.Equal(t, first.TopicMetadata, md.TopicMetadata)
+	}
+}
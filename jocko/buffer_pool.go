@@ -0,0 +1,91 @@
+package jocko
+
+import "sync"
+
+// bufferPool is the broker's budget for the requests it's read but not yet answered and the
+// records its followers have fetched but not yet appended, so a surge of produce requests can't
+// run it out of memory. Acquiring bytes blocks while the budget's used up, pushing back on the
+// clients and leaders sending them. Like Kafka's memory pool an acquisition succeeds while any of
+// the budget's left, so it's exceeded by at most one request or fetch. A nil pool is unlimited.
+type bufferPool struct {
+	mu       sync.Mutex
+	capacity int64
+	used     int64
+	// freed is closed and replaced when bytes are released, waking the blocked acquisitions.
+	freed chan struct{}
+	// onChange, if set, is called with the bytes used after each change.
+	onChange func(used int64)
+}
+
+func newBufferPool(capacity int64, onChange func(used int64)) *bufferPool {
+	if capacity <= 0 {
+		return nil
+	}
+	return &bufferPool{capacity: capacity, freed: make(chan struct{}), onChange: onChange}
+}
+
+// acquire blocks until some of the budget's left and takes n bytes of it, returning false if
+// cancel's closed first.
+func (p *bufferPool) acquire(n int64, cancel <-chan struct{}) bool {
+	if p == nil {
+		return true
+	}
+	for {
+		p.mu.Lock()
+		if p.used < p.capacity {
+			p.used += n
+			used := p.used
+			p.mu.Unlock()
+			p.changed(used)
+			return true
+		}
+		freed := p.freed
+		p.mu.Unlock()
+		select {
+		case <-freed:
+		case <-cancel:
+			return false
+		}
+	}
+}
+
+// release returns n bytes to the budget.
+func (p *bufferPool) release(n int64) {
+	if p == nil || n == 0 {
+		return
+	}
+	p.mu.Lock()
+	p.used -= n
+	used := p.used
+	close(p.freed)
+	p.freed = make(chan struct{})
+	p.mu.Unlock()
+	p.changed(used)
+}
+
+// Used returns the bytes of the budget in use.
+func (p *bufferPool) Used() int64 {
+	if p == nil {
+		return 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.used
+}
+
+func (p *bufferPool) changed(used int64) {
+	if p.onChange != nil {
+		p.onChange(used)
+	}
+}
+
+// requestBuffers returns the budget the server holds the broker's requests against.
+func (b *Broker) requestBuffers() *bufferPool {
+	return b.buffers
+}
+
+func (b *Broker) trackBufferedBytes(used int64) {
+	if m := b.topicMetrics(); m != nil && m.BufferedBytes != nil {
+		m.BufferedBytes.Set(float64(used))
+	}
+}
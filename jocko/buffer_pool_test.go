@@ -0,0 +1,46 @@
+package jocko
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBufferPool(t *testing.T) {
+	req := require.New(t)
+	var used int64
+	p := newBufferPool(100, func(n int64) { used = n })
+	cancel := make(chan struct{})
+
+	// acquisitions succeed while any of the budget's left, overshooting it by the last one.
+	req.True(p.acquire(60, cancel))
+	req.True(p.acquire(60, cancel))
+	req.Equal(int64(120), p.Used())
+	req.Equal(int64(120), used)
+
+	acquired := make(chan bool)
+	go func() { acquired <- p.acquire(10, cancel) }()
+	select {
+	case <-acquired:
+		t.Fatal("acquired past the budget")
+	case <-time.After(50 * time.Millisecond):
+	}
+	p.release(60)
+	req.True(<-acquired)
+	req.Equal(int64(70), p.Used())
+
+	// blocked acquisitions give up when cancelled.
+	req.True(p.acquire(30, cancel))
+	go func() { acquired <- p.acquire(10, cancel) }()
+	close(cancel)
+	req.False(<-acquired)
+	req.Equal(int64(100), p.Used())
+
+	// a nil pool's unlimited.
+	var unlimited *bufferPool
+	req.Nil(newBufferPool(0, nil))
+	req.True(unlimited.acquire(1<<40, nil))
+	unlimited.release(1 << 40)
+	req.Equal(int64(0), unlimited.Used())
+}
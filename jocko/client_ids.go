@@ -0,0 +1,53 @@
+package jocko
+
+import (
+	"regexp"
+
+	"github.com/travisjeffery/jocko/jocko/config"
+)
+
+// brokerClientID matches the client IDs brokers send each other requests with, which are never
+// refused so the patterns can't break replication.
+var brokerClientID = regexp.MustCompile(`^jocko(-replicator-\d+)?$`)
+
+// clientIDFilter refuses the requests of clients whose client IDs match the broker's denied
+// client ID patterns, or miss its allowed ones.
+type clientIDFilter struct {
+	denied  []*regexp.Regexp
+	allowed []*regexp.Regexp
+}
+
+func newClientIDFilter(c *config.Config) *clientIDFilter {
+	compile := func(patterns []string) []*regexp.Regexp {
+		var res []*regexp.Regexp
+		for _, p := range patterns {
+			// the config's validated so the patterns compile.
+			if re, err := config.CompileClientIDPattern(p); err == nil {
+				res = append(res, re)
+			}
+		}
+		return res
+	}
+	return &clientIDFilter{denied: compile(c.DeniedClientIDs), allowed: compile(c.AllowedClientIDs)}
+}
+
+// denies returns whether the client ID's requests are refused.
+func (f *clientIDFilter) denies(id string) bool {
+	if brokerClientID.MatchString(id) {
+		return false
+	}
+	for _, re := range f.denied {
+		if re.MatchString(id) {
+			return true
+		}
+	}
+	if len(f.allowed) == 0 {
+		return false
+	}
+	for _, re := range f.allowed {
+		if re.MatchString(id) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,52 @@
+package jocko
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/jocko/config"
+)
+
+func TestClientIDFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		denied  []string
+		allowed []string
+		ids     map[string]bool
+	}{
+		{
+			name: "no patterns",
+			ids:  map[string]bool{"": false, "app": false},
+		},
+		{
+			name:   "denied",
+			denied: []string{"^$", "legacy-.*"},
+			ids:    map[string]bool{"": true, "legacy-app": true, "app": false, "app-legacy-1": false},
+		},
+		{
+			name:    "allowed",
+			allowed: []string{"app-[0-9]+"},
+			ids:     map[string]bool{"app-1": false, "app-1x": true, "": true},
+		},
+		{
+			name:    "denied over allowed",
+			denied:  []string{"app-0"},
+			allowed: []string{"app-.*"},
+			ids:     map[string]bool{"app-0": true, "app-1": false},
+		},
+		{
+			name:    "brokers",
+			denied:  []string{"jocko.*"},
+			allowed: []string{"app"},
+			ids:     map[string]bool{"jocko": false, "jocko-replicator-2": false, "jocko-client": true},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := newClientIDFilter(&config.Config{DeniedClientIDs: test.denied, AllowedClientIDs: test.allowed})
+			for id, denied := range test.ids {
+				require.Equal(t, denied, f.denies(id), id)
+			}
+		})
+	}
+}
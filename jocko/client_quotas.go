@@ -0,0 +1,238 @@
+package jocko
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+const (
+	produceQuota = "produce"
+	fetchQuota   = "fetch"
+	// clientRateWindow is how long the bytes clients produce and fetch are sampled over to get
+	// their byte rates.
+	clientRateWindow = 10 * time.Second
+	// clientStatsExpiry is how long a client's stats are kept after it was last seen.
+	clientStatsExpiry = time.Hour
+	// otherClientsLabel is the client_id label the metrics of clients missing from the metrics
+	// client IDs allowlist are aggregated under.
+	otherClientsLabel = "__other"
+)
+
+// Clients aren't authenticated, so their usage is tracked per client ID, the principal the
+// request's header gives.
+
+// clientUsage is a client's usage of a quota type, e.g. the bytes it produces.
+type clientUsage struct {
+	// windowStart is when the current window started, bytes are the bytes used in it and
+	// prevBytes those in the previous window.
+	windowStart time.Time
+	bytes       int64
+	prevBytes   int64
+	// throttle is the throttle time the client's been issued, violations the number of responses
+	// it was throttled in.
+	throttle   time.Duration
+	violations int64
+}
+
+// roll starts a new window if the current one's over.
+func (u *clientUsage) roll(now time.Time) {
+	elapsed := now.Sub(u.windowStart)
+	if elapsed < clientRateWindow {
+		return
+	}
+	u.prevBytes = u.bytes
+	if elapsed >= 2*clientRateWindow {
+		// the client was idle for the whole previous window.
+		u.prevBytes = 0
+	}
+	u.bytes = 0
+	u.windowStart = now
+}
+
+// rate returns the bytes per second the client used over the last whole window.
+func (u *clientUsage) rate(now time.Time) float64 {
+	u.roll(now)
+	return float64(u.prevBytes) / clientRateWindow.Seconds()
+}
+
+type clientStats struct {
+	lastSeen time.Time
+	usage    map[string]*clientUsage
+}
+
+// clientQuotaStats tracks the bytes clients produce and fetch and the throttling they're issued,
+// so operators can see who's using the broker and size the quotas.
+type clientQuotaStats struct {
+	mu        sync.Mutex
+	clients   map[string]*clientStats
+	lastSweep time.Time
+}
+
+func newClientQuotaStats() *clientQuotaStats {
+	return &clientQuotaStats{clients: make(map[string]*clientStats)}
+}
+
+// usage returns the client's usage of the quota type. It must be called with the lock held.
+func (s *clientQuotaStats) usage(clientID, typ string, now time.Time) *clientUsage {
+	s.expire(now)
+	c, ok := s.clients[clientID]
+	if !ok {
+		c = &clientStats{usage: make(map[string]*clientUsage)}
+		s.clients[clientID] = c
+	}
+	c.lastSeen = now
+	u, ok := c.usage[typ]
+	if !ok {
+		u = &clientUsage{windowStart: now}
+		c.usage[typ] = u
+	}
+	u.roll(now)
+	return u
+}
+
+// expire removes the clients that haven't been seen in a while, at most once per expiry so
+// tracking a request doesn't go over every client.
+func (s *clientQuotaStats) expire(now time.Time) {
+	if now.Sub(s.lastSweep) < clientStatsExpiry {
+		return
+	}
+	s.lastSweep = now
+	for id, c := range s.clients {
+		if now.Sub(c.lastSeen) >= clientStatsExpiry {
+			delete(s.clients, id)
+		}
+	}
+}
+
+// record adds the bytes the client used of the quota type.
+func (s *clientQuotaStats) record(clientID, typ string, bytes int, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.usage(clientID, typ, now).bytes += int64(bytes)
+}
+
+// throttled adds the throttle time the client was issued for the quota type, counting a violation.
+func (s *clientQuotaStats) throttled(clientID, typ string, throttle time.Duration, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.usage(clientID, typ, now)
+	u.throttle += throttle
+	u.violations++
+}
+
+// entries returns the quota entries of the clients the match accepts, sorted by client ID.
+func (s *clientQuotaStats) entries(match func(clientID string) bool, now time.Time) []*protocol.QuotaEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(s.clients))
+	for id := range s.clients {
+		if match(id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	entries := make([]*protocol.QuotaEntry, 0, len(ids))
+	for _, id := range ids {
+		id := id
+		entry := &protocol.QuotaEntry{
+			Entity: []*protocol.QuotaEntity{{EntityType: protocol.QuotaEntityClientID, EntityName: &id}},
+		}
+		for _, typ := range []string{produceQuota, fetchQuota} {
+			u, ok := s.clients[id].usage[typ]
+			if !ok {
+				continue
+			}
+			entry.Values = append(entry.Values,
+				&protocol.QuotaValue{Key: typ + "_byte_rate", Value: u.rate(now)},
+				&protocol.QuotaValue{Key: typ + "_throttle_time_ms", Value: float64(u.throttle / time.Millisecond)},
+				&protocol.QuotaValue{Key: typ + "_quota_violations", Value: float64(u.violations)},
+			)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// clientMetricLabels returns the label values the client's metrics are tracked under, keeping the
+// number of series down per the broker's config.
+func (b *Broker) clientMetricLabels(clientID, typ string) []string {
+	if len(b.config.MetricsClientIDs) != 0 && !containsString(b.config.MetricsClientIDs, clientID) {
+		clientID = otherClientsLabel
+	}
+	return []string{"client_id", clientID, "type", typ}
+}
+
+// trackClientBytes records the bytes the client produced or fetched.
+func (b *Broker) trackClientBytes(clientID, typ string, bytes int) {
+	b.clientQuotas.record(clientID, typ, bytes, b.clock.Now())
+	if m := b.topicMetrics(); m != nil && m.ClientBytes != nil {
+		m.ClientBytes.With(b.clientMetricLabels(clientID, typ)...).Add(float64(bytes))
+	}
+}
+
+// trackClientThrottle records the throttle time the client was issued in a response.
+func (b *Broker) trackClientThrottle(clientID, typ string, throttle time.Duration) {
+	b.clientQuotas.throttled(clientID, typ, throttle, b.clock.Now())
+	if m := b.topicMetrics(); m != nil && m.ClientThrottleTime != nil {
+		labels := b.clientMetricLabels(clientID, typ)
+		m.ClientThrottleTime.With(labels...).Add(throttle.Seconds())
+		m.ClientQuotaViolations.With(labels...).Add(1)
+	}
+}
+
+// handleDescribeClientQuotas returns the clients' quota usage: their byte rates, the throttle
+// time they've been issued, and the number of responses they were throttled in. Clients are
+// only identified by client ID, so filters on users or IPs match nothing.
+func (b *Broker) handleDescribeClientQuotas(ctx *Context, req *protocol.DescribeClientQuotasRequest) *protocol.DescribeClientQuotasResponse {
+	sp := span(ctx, b.tracer, "describe client quotas")
+	defer sp.Finish()
+	res := &protocol.DescribeClientQuotasResponse{}
+	res.APIVersion = req.Version()
+
+	match := func(string) bool { return true }
+	seen := make(map[string]bool, len(req.Components))
+	for _, c := range req.Components {
+		if seen[c.EntityType] {
+			setDescribeClientQuotasErr(res, protocol.ErrInvalidRequest.WithErr(fmt.Errorf("entity type %s is filtered more than once", c.EntityType)))
+			return res
+		}
+		seen[c.EntityType] = true
+		switch c.EntityType {
+		case protocol.QuotaEntityClientID:
+		case protocol.QuotaEntityUser, protocol.QuotaEntityIP:
+			res.Entries = []*protocol.QuotaEntry{}
+			return res
+		default:
+			setDescribeClientQuotasErr(res, protocol.ErrInvalidRequest.WithErr(fmt.Errorf("unknown entity type %q", c.EntityType)))
+			return res
+		}
+		switch c.MatchType {
+		case protocol.QuotaMatchExact:
+			if c.Match == nil {
+				setDescribeClientQuotasErr(res, protocol.ErrInvalidRequest.WithErr(fmt.Errorf("exact match of %s without a name", c.EntityType)))
+				return res
+			}
+			name := *c.Match
+			match = func(id string) bool { return id == name }
+		case protocol.QuotaMatchDefault:
+			// there are no client ID quotas, so no default entity either.
+			match = func(string) bool { return false }
+		case protocol.QuotaMatchAny:
+		default:
+			setDescribeClientQuotasErr(res, protocol.ErrInvalidRequest.WithErr(fmt.Errorf("unknown match type %d", c.MatchType)))
+			return res
+		}
+	}
+	res.Entries = b.clientQuotas.entries(match, b.clock.Now())
+	return res
+}
+
+func setDescribeClientQuotasErr(res *protocol.DescribeClientQuotasResponse, err protocol.Error) {
+	res.ErrorCode = err.Code()
+	msg := err.Error()
+	res.ErrorMessage = &msg
+}
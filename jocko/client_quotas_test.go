@@ -0,0 +1,86 @@
+package jocko
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/clock"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestClientQuotaStats(t *testing.T) {
+	s := newClientQuotaStats()
+	now := time.Now()
+	all := func(string) bool { return true }
+
+	s.record("a", produceQuota, 500, now)
+	s.record("a", produceQuota, 500, now.Add(time.Second))
+	// the rate's over the last whole window, so it's 0 until the first one ends.
+	usage := s.clients["a"].usage[produceQuota]
+	require.Equal(t, float64(0), usage.rate(now.Add(time.Second)))
+	require.Equal(t, float64(100), usage.rate(now.Add(clientRateWindow)))
+	// an idle window's rate is 0.
+	require.Equal(t, float64(0), usage.rate(now.Add(3*clientRateWindow)))
+
+	s.throttled("b", fetchQuota, 250*time.Millisecond, now)
+	s.throttled("b", fetchQuota, 500*time.Millisecond, now)
+	b := "b"
+	require.Equal(t, []*protocol.QuotaEntry{{
+		Entity: []*protocol.QuotaEntity{{EntityType: protocol.QuotaEntityClientID, EntityName: &b}},
+		Values: []*protocol.QuotaValue{
+			{Key: "fetch_byte_rate", Value: 0},
+			{Key: "fetch_throttle_time_ms", Value: 750},
+			{Key: "fetch_quota_violations", Value: 2},
+		},
+	}}, s.entries(func(id string) bool { return id == "b" }, now))
+	require.Len(t, s.entries(all, now), 2)
+
+	// clients not seen in a while are forgotten.
+	s.record("c", fetchQuota, 1, now.Add(clientStatsExpiry+time.Second))
+	entries := s.entries(all, now.Add(clientStatsExpiry+time.Second))
+	require.Len(t, entries, 1)
+	require.Equal(t, "c", *entries[0].Entity[0].EntityName)
+}
+
+func TestBroker_DescribeClientQuotas(t *testing.T) {
+	now := time.Now()
+	b := &Broker{
+		config:       &config.Config{MetricsClientIDs: []string{"a"}},
+		tracer:       opentracing.NoopTracer{},
+		clock:        clock.NewSim(now),
+		clientQuotas: newClientQuotaStats(),
+	}
+	b.trackClientBytes("a", produceQuota, 100)
+	b.trackClientBytes("b", fetchQuota, 100)
+	b.trackClientThrottle("b", fetchQuota, time.Second)
+	require.Equal(t, []string{"client_id", "a", "type", produceQuota}, b.clientMetricLabels("a", produceQuota))
+	require.Equal(t, []string{"client_id", otherClientsLabel, "type", fetchQuota}, b.clientMetricLabels("b", fetchQuota))
+
+	describe := func(components ...*protocol.QuotaFilterComponent) *protocol.DescribeClientQuotasResponse {
+		return b.handleDescribeClientQuotas(&Context{parent: context.Background()}, &protocol.DescribeClientQuotasRequest{Components: components})
+	}
+	res := describe()
+	require.Equal(t, protocol.ErrNone.Code(), res.ErrorCode)
+	require.Len(t, res.Entries, 2)
+
+	name := "b"
+	res = describe(&protocol.QuotaFilterComponent{EntityType: protocol.QuotaEntityClientID, MatchType: protocol.QuotaMatchExact, Match: &name})
+	require.Len(t, res.Entries, 1)
+	require.Equal(t, "b", *res.Entries[0].Entity[0].EntityName)
+	require.Contains(t, res.Entries[0].Values, &protocol.QuotaValue{Key: "fetch_throttle_time_ms", Value: 1000})
+
+	// clients aren't authenticated so there are no users.
+	res = describe(&protocol.QuotaFilterComponent{EntityType: protocol.QuotaEntityUser, MatchType: protocol.QuotaMatchAny})
+	require.Equal(t, protocol.ErrNone.Code(), res.ErrorCode)
+	require.Empty(t, res.Entries)
+
+	res = describe(&protocol.QuotaFilterComponent{EntityType: "unknown", MatchType: protocol.QuotaMatchAny})
+	require.Equal(t, protocol.ErrInvalidRequest.Code(), res.ErrorCode)
+	require.Nil(t, res.Entries)
+	res = describe(&protocol.QuotaFilterComponent{EntityType: protocol.QuotaEntityClientID, MatchType: protocol.QuotaMatchExact})
+	require.Equal(t, protocol.ErrInvalidRequest.Code(), res.ErrorCode)
+}
@@ -0,0 +1,66 @@
+package jocko
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/travisjeffery/jocko/jocko/structs"
+	"github.com/travisjeffery/jocko/log"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+// checkClockSkew tracks how far the produced records' create times are from the broker's clock,
+// and logs the producer if they're further than the broker's clock skew threshold. A producer
+// host whose clock is off stamps its records with times that break the topic's time based
+// retention, deleting them too early or keeping them too long. Skewed records are only rejected
+// if the broker's configured to. Log append time topics' timestamps are overwritten by the broker
+// so they aren't checked.
+func (b *Broker) checkClockSkew(clientID string, t *structs.Topic, partition int32, recordSet []byte, now time.Time) protocol.Error {
+	if logAppendTime(t) {
+		return protocol.ErrNone
+	}
+	timestamps, err := protocol.Timestamps(recordSet)
+	if err != nil || len(timestamps) == 0 {
+		return protocol.ErrNone
+	}
+	var skew time.Duration
+	for _, ts := range timestamps {
+		if d := ts.Sub(now); abs(d) > abs(skew) {
+			skew = d
+		}
+	}
+	m := b.topicMetrics()
+	if m != nil && m.ProduceTimestampSkew != nil {
+		m.ProduceTimestampSkew.With(b.metricLabels(t.Topic, partition)...).Observe(abs(skew).Seconds())
+	}
+	threshold := b.config.ClockSkewThreshold
+	if threshold == 0 || abs(skew) <= threshold {
+		return protocol.ErrNone
+	}
+	direction := "future"
+	if skew < 0 {
+		direction = "past"
+	}
+	if m != nil && m.ClockSkewedProduces != nil {
+		m.ClockSkewedProduces.With(append(b.metricLabels(t.Topic, partition), "direction", direction)...).Add(1)
+	}
+	log.Info.Printf("broker/%d: produce clock skew: client id: %s, topic: %s, partition: %d: create time is %s in the %s of the broker's clock", b.config.ID, clientID, t.Topic, partition, abs(skew), direction)
+	if b.config.RejectClockSkew {
+		return protocol.ErrInvalidTimestamp.WithErr(fmt.Errorf("create time of topic %s is %s from the broker's clock, more than the clock skew threshold %s", t.Topic, abs(skew), threshold))
+	}
+	return protocol.ErrNone
+}
+
+// trackInjectedTimestamps counts a record set the broker stamped with its log append time.
+func (b *Broker) trackInjectedTimestamps(topic string, partition int32) {
+	if m := b.topicMetrics(); m != nil && m.InjectedTimestamps != nil {
+		m.InjectedTimestamps.With(b.metricLabels(topic, partition)...).Add(1)
+	}
+}
+
+func abs(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
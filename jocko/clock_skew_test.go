@@ -0,0 +1,67 @@
+package jocko
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/jocko/structs"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestBroker_CheckClockSkew(t *testing.T) {
+	labels := []string{"topic", "partition"}
+	skew := stdprometheus.NewHistogramVec(stdprometheus.HistogramOpts{Name: "produce_timestamp_skew_seconds"}, labels)
+	skewed := stdprometheus.NewCounterVec(stdprometheus.CounterOpts{Name: "produce_clock_skewed_total"}, append(labels, "direction"))
+	b := &Broker{
+		config: &config.Config{ClockSkewThreshold: time.Hour},
+		metrics: &Metrics{
+			ProduceTimestampSkew: prometheus.NewHistogram(skew),
+			ClockSkewedProduces:  prometheus.NewCounter(skewed),
+		},
+	}
+	topic := &structs.Topic{Topic: "t", Config: structs.NewTopicConfig()}
+	now := time.Unix(1500000000, 0)
+	set := func(timestamps ...time.Time) []byte {
+		batch := &protocol.RecordBatch{FirstTimestamp: timestamps[0], MaxTimestamp: timestamps[len(timestamps)-1]}
+		for i, ts := range timestamps {
+			batch.Records = append(batch.Records, &protocol.Record{OffsetDelta: int64(i), TimestampDelta: ts.Sub(timestamps[0]), Value: []byte("v")})
+		}
+		batch.LastOffsetDelta = int32(len(timestamps) - 1)
+		data, err := protocol.Encode(batch)
+		require.NoError(t, err)
+		return data
+	}
+	skewedCount := func(direction string) float64 {
+		var m dto.Metric
+		require.NoError(t, skewed.WithLabelValues("t", "", direction).Write(&m))
+		return m.GetCounter().GetValue()
+	}
+
+	require.Equal(t, protocol.ErrNone, b.checkClockSkew("c", topic, 0, set(now.Add(-time.Minute), now), now))
+	require.Equal(t, protocol.ErrNone, b.checkClockSkew("c", topic, 0, set(now, now.Add(2*time.Hour)), now))
+	require.Equal(t, protocol.ErrNone, b.checkClockSkew("c", topic, 0, set(now.Add(-3*time.Hour)), now))
+	require.Equal(t, float64(1), skewedCount("future"))
+	require.Equal(t, float64(1), skewedCount("past"))
+	var m dto.Metric
+	require.NoError(t, skew.WithLabelValues("t", "").(stdprometheus.Histogram).Write(&m))
+	require.Equal(t, uint64(3), m.GetHistogram().GetSampleCount())
+	require.Equal(t, float64(60+2*3600+3*3600), m.GetHistogram().GetSampleSum())
+
+	// skewed records are rejected only if the broker's configured to, and log append time
+	// topics' are overwritten so they're never rejected.
+	b.config.RejectClockSkew = true
+	err := b.checkClockSkew("c", topic, 0, set(now.Add(-3*time.Hour)), now)
+	require.Equal(t, protocol.ErrInvalidTimestamp.Code(), err.Code())
+	appendTime := logAppendTimestampType
+	require.NoError(t, topic.Config.SetValueFromString(timestampTypeConfig, &appendTime))
+	require.Equal(t, protocol.ErrNone, b.checkClockSkew("c", topic, 0, set(now.Add(-3*time.Hour)), now))
+	b.config.ClockSkewThreshold = 0
+	topic.Config = structs.NewTopicConfig()
+	require.Equal(t, protocol.ErrNone, b.checkClockSkew("c", topic, 0, set(now.Add(-3*time.Hour)), now))
+	require.Equal(t, float64(2), skewedCount("past"))
+}
@@ -0,0 +1,217 @@
+package jocko
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/travisjeffery/jocko/commitlog"
+	"github.com/travisjeffery/jocko/jocko/structs"
+	"github.com/travisjeffery/jocko/log"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+const (
+	// ClusterMetadataTopic is the internal, read-only topic observers can fetch to tail the
+	// changes applied to the raft replicated cluster state. It has a single partition each broker
+	// serves from its own copy of the state.
+	ClusterMetadataTopic = "__cluster_metadata"
+	clusterMetadataDir   = "cluster_metadata"
+)
+
+// ClusterMetadataRecord is the value of each record in the cluster metadata topic, keyed by its
+// type.
+type ClusterMetadataRecord struct {
+	// Index is the raft index the change was applied at.
+	Index uint64 `json:"index"`
+	Type  string `json:"type"`
+	// Entry is the applied request, e.g. a structs.RegisterTopicRequest.
+	Entry interface{} `json:"entry"`
+}
+
+// clusterMetadataLog appends the changes applied to the FSM to a log served as the cluster
+// metadata topic. Raft replays the entries after its latest snapshot when the broker restarts so
+// entries at or before the last appended index are skipped. The log's trimmed as raft snapshots
+// the state, like raft's own log, keeping the entries since the snapshot before last so observers
+// have a snapshot interval to catch up.
+type clusterMetadataLog struct {
+	mu        sync.Mutex
+	replica   *Replica
+	log       *commitlog.CommitLog
+	lastIndex uint64
+	// snapshotOffset is the log's newest offset when the state was last snapshotted, the offset
+	// the log's trimmed to at the next snapshot.
+	snapshotOffset int64
+}
+
+func openClusterMetadataLog(path string, brokerID int32, fresh bool) (*clusterMetadataLog, error) {
+	if fresh {
+		// the raft state isn't persisted so neither is its metadata log.
+		if err := os.RemoveAll(path); err != nil {
+			return nil, err
+		}
+	}
+	l, err := commitlog.New(commitlog.Options{
+		Path:            path,
+		MaxSegmentBytes: 1 << 20,
+		MaxLogBytes:     -1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	m := &clusterMetadataLog{
+		log: l,
+		replica: &Replica{
+			BrokerID: brokerID,
+			Partition: structs.Partition{
+				Topic:     ClusterMetadataTopic,
+				ID:        0,
+				Partition: 0,
+				Leader:    brokerID,
+				AR:        []int32{brokerID},
+				ISR:       []int32{brokerID},
+			},
+			IsLocal: true,
+			Log:     l,
+		},
+	}
+	if m.lastIndex, err = m.readLastIndex(); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// readLastIndex returns the raft index of the last record in the log.
+func (m *clusterMetadataLog) readLastIndex() (uint64, error) {
+	newest := m.log.NewestOffset()
+	if newest == m.log.OldestOffset() {
+		return 0, nil
+	}
+	r, err := m.log.NewReader(newest-1, 1<<20)
+	if err != nil {
+		return 0, err
+	}
+	buf := new(bytes.Buffer)
+	if _, err := io.Copy(buf, r); err != nil && err != io.EOF {
+		return 0, err
+	}
+	ms := new(protocol.MessageSet)
+	if err := ms.Decode(protocol.NewDecoder(buf.Bytes())); err != nil {
+		return 0, err
+	}
+	var index uint64
+	for _, msg := range ms.Messages {
+		var rec ClusterMetadataRecord
+		if err := json.Unmarshal(msg.Value, &rec); err != nil {
+			return 0, err
+		}
+		index = rec.Index
+	}
+	return index, nil
+}
+
+// append appends the applied raft log entry to the log.
+func (m *clusterMetadataLog) append(index uint64, msgType structs.MessageType, buf []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if index <= m.lastIndex {
+		return nil
+	}
+	entry := newClusterMetadataEntry(msgType)
+	if entry != nil {
+		if err := structs.Decode(buf, entry); err != nil {
+			return err
+		}
+	}
+	value, err := json.Marshal(ClusterMetadataRecord{Index: index, Type: msgType.String(), Entry: entry})
+	if err != nil {
+		return err
+	}
+	set, err := protocol.Encode(&protocol.MessageSet{Messages: []*protocol.Message{{
+		Key:   []byte(msgType.String()),
+		Value: value,
+	}}})
+	if err != nil {
+		return err
+	}
+	if _, err := m.log.Append(set); err != nil {
+		return err
+	}
+	m.lastIndex = index
+	return nil
+}
+
+// trim deletes the segments whose entries were all applied before the previous snapshot, returning
+// the bytes reclaimed.
+func (m *clusterMetadataLog) trim() (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	reclaimed, err := m.log.DeleteBefore(m.snapshotOffset)
+	if err != nil {
+		return reclaimed, err
+	}
+	m.snapshotOffset = m.log.NewestOffset()
+	return reclaimed, nil
+}
+
+func (m *clusterMetadataLog) close() error {
+	return m.log.Close()
+}
+
+// newClusterMetadataEntry returns the request applied for the message type.
+func newClusterMetadataEntry(msgType structs.MessageType) interface{} {
+	switch msgType {
+	case structs.RegisterNodeRequestType:
+		return new(structs.RegisterNodeRequest)
+	case structs.DeregisterNodeRequestType:
+		return new(structs.DeregisterNodeRequest)
+	case structs.RegisterTopicRequestType:
+		return new(structs.RegisterTopicRequest)
+	case structs.DeregisterTopicRequestType:
+		return new(structs.DeregisterTopicRequest)
+	case structs.RegisterPartitionRequestType:
+		return new(structs.RegisterPartitionRequest)
+	case structs.DeregisterPartitionRequestType:
+		return new(structs.DeregisterPartitionRequest)
+	case structs.AssignPartitionRequestType:
+		return new(structs.AssignPartitionRequest)
+	case structs.RegisterGroupRequestType:
+		return new(structs.RegisterGroupRequest)
+	case structs.BatchNodesRequestType:
+		return new(structs.BatchNodesRequest)
+	case structs.NodeMaintenanceRequestType:
+		return new(structs.NodeMaintenanceRequest)
+	}
+	return nil
+}
+
+// appendClusterMetadata is the FSM's apply hook adding the applied entry to the cluster metadata
+// topic.
+func (b *Broker) appendClusterMetadata(index uint64, msgType structs.MessageType, buf []byte) {
+	if err := b.clusterMetadata.append(index, msgType, buf); err != nil {
+		log.Error.Printf("broker/%d: cluster metadata append error: index: %d: %s", b.config.ID, index, err)
+	}
+}
+
+// trimClusterMetadata is the FSM's snapshot hook trimming the cluster metadata topic.
+func (b *Broker) trimClusterMetadata(index uint64) {
+	reclaimed, err := b.clusterMetadata.trim()
+	if err != nil {
+		log.Error.Printf("broker/%d: cluster metadata trim error: index: %d: %s", b.config.ID, index, err)
+		return
+	}
+	if reclaimed > 0 {
+		log.Info.Printf("broker/%d: trimmed cluster metadata: index: %d, reclaimed bytes: %d", b.config.ID, index, reclaimed)
+	}
+}
+
+// fetchReplica returns the replica fetches from the topic's partition are served from.
+func (b *Broker) fetchReplica(topic string, partition int32) (*Replica, error) {
+	if topic == ClusterMetadataTopic && partition == 0 {
+		return b.clusterMetadata.replica, nil
+	}
+	return b.replicaLookup.Replica(topic, partition)
+}
@@ -0,0 +1,110 @@
+package jocko
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/commitlog"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/jocko/structs"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestBroker_ClusterMetadataTopic(t *testing.T) {
+	s, dir := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+
+	conn, err := Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	CreateTopic(t, conn, "test-topic", 1, 1)
+
+	// the conn buffers whole responses so the log's read a few records at a time.
+	var topics []string
+	var last uint64
+	for offset := int64(0); offset < s.broker().clusterMetadata.log.NewestOffset(); {
+		res, err := conn.Fetch(&protocol.FetchRequest{
+			MaxWaitTime: time.Second,
+			MinBytes:    1,
+			Topics: []*protocol.FetchTopic{{
+				Topic:      ClusterMetadataTopic,
+				Partitions: []*protocol.FetchPartition{{Partition: 0, FetchOffset: offset, MaxBytes: 2048}},
+			}},
+		})
+		require.NoError(t, err)
+		fpres := res.Responses[0].PartitionResponses[0]
+		require.Equal(t, protocol.ErrNone.Code(), fpres.ErrorCode)
+		next := offset
+		for set := fpres.RecordSet; len(set) >= 12; {
+			n := 12 + int(protocol.Encoding.Uint32(set[8:12]))
+			if n > len(set) {
+				break
+			}
+			ms := new(protocol.MessageSet)
+			require.NoError(t, ms.Decode(protocol.NewDecoder(set[:n])))
+			set = set[n:]
+			next = ms.Offset + 1
+			for _, m := range ms.Messages {
+				var rec struct {
+					Index uint64
+					Type  string
+					Entry struct{ Topic struct{ ID, Topic string } }
+				}
+				require.NoError(t, json.Unmarshal(m.Value, &rec))
+				require.Equal(t, string(m.Key), rec.Type)
+				require.True(t, rec.Index > last)
+				last = rec.Index
+				if rec.Type == "register_topic" {
+					topics = append(topics, rec.Entry.Topic.Topic)
+				}
+			}
+		}
+		require.True(t, next > offset, "no whole record at offset %d", offset)
+		offset = next
+	}
+	require.Contains(t, topics, "test-topic")
+}
+
+func TestClusterMetadataTrim(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cluster_metadata_test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	// each entry gets its own segment.
+	l, err := commitlog.New(commitlog.Options{Path: dir, MaxSegmentBytes: 1, MaxLogBytes: -1})
+	require.NoError(t, err)
+	defer l.Close()
+	m := &clusterMetadataLog{log: l}
+	appendEntries := func(from, to uint64) {
+		for i := from; i <= to; i++ {
+			require.NoError(t, m.append(i, structs.UpdateFeaturesRequestType, nil))
+		}
+	}
+
+	// the first snapshot only marks where the next trims to.
+	appendEntries(1, 3)
+	reclaimed, err := m.trim()
+	require.NoError(t, err)
+	require.Equal(t, int64(0), reclaimed)
+	require.Equal(t, int64(0), l.OldestOffset())
+
+	// the entries from before the previous snapshot are deleted at the next.
+	appendEntries(4, 6)
+	reclaimed, err = m.trim()
+	require.NoError(t, err)
+	require.True(t, reclaimed > 0)
+	require.Equal(t, int64(3), l.OldestOffset())
+	require.Equal(t, uint64(6), m.lastIndex)
+}
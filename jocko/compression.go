@@ -0,0 +1,34 @@
+package jocko
+
+import (
+	"github.com/travisjeffery/jocko/jocko/structs"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+const compressionTypeConfig = "compression.type"
+
+// compressionCodecs are the codecs of the compression types other than producer.
+var compressionCodecs = map[string]protocol.CompressionCodec{
+	"uncompressed": protocol.CompressionNone,
+	"gzip":         protocol.CompressionGZIP,
+	"snappy":       protocol.CompressionSnappy,
+	"lz4":          protocol.CompressionLZ4,
+	"zstd":         protocol.CompressionZSTD,
+}
+
+// recompress returns the produced record set compressed with the topic's compression type. A
+// producer compression type keeps the producer's codec and the set's returned as it is.
+func recompress(t *structs.Topic, set []byte) ([]byte, protocol.Error) {
+	codec, ok := compressionCodecs[t.Config.GetString(compressionTypeConfig)]
+	if !ok {
+		return set, protocol.ErrNone
+	}
+	recompressed, err := protocol.Recompress(set, codec)
+	if err == protocol.ErrUnsupportedCompressionType {
+		return nil, protocol.ErrUnsupportedCompressionType
+	}
+	if err != nil {
+		return nil, protocol.ErrCorruptMessage.WithErr(err)
+	}
+	return recompressed, protocol.ErrNone
+}
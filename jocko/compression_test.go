@@ -0,0 +1,111 @@
+package jocko
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestBroker_CompressionType(t *testing.T) {
+	s, dir := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+
+	conn, err := Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	gzip, uncompressed, zstd := "gzip", "uncompressed", "zstd"
+	configs := map[string]map[string]*string{
+		"producer":     nil,
+		"gzip":         {compressionTypeConfig: &gzip},
+		"uncompressed": {compressionTypeConfig: &uncompressed},
+		"zstd":         {compressionTypeConfig: &zstd},
+	}
+	for topic, cfg := range configs {
+		CreateTopicWithConfigs(t, conn, topic, 1, 1, cfg)
+		WaitForTopicLeader(t, topic, 0, s)
+	}
+
+	produce := func(topic string, set []byte) *protocol.ProducePartitionResponse {
+		res, err := conn.Produce(&protocol.ProduceRequest{
+			APIVersion: 7,
+			Timeout:    time.Second,
+			TopicData:  []*protocol.TopicData{{Topic: topic, Data: []*protocol.Data{{Partition: 0, RecordSet: set}}}},
+		})
+		require.NoError(t, err)
+		return res.Responses[0].PartitionResponses[0]
+	}
+	fetch := func(topic string, offset int64) []byte {
+		res, err := conn.Fetch(&protocol.FetchRequest{
+			APIVersion:  10,
+			MaxWaitTime: time.Second,
+			MinBytes:    1,
+			Topics: []*protocol.FetchTopic{{
+				Topic:      topic,
+				Partitions: []*protocol.FetchPartition{{Partition: 0, FetchOffset: offset, CurrentLeaderEpoch: -1, MaxBytes: 1 << 20}},
+			}},
+		})
+		require.NoError(t, err)
+		require.Equal(t, protocol.ErrNone.Code(), res.Responses[0].PartitionResponses[0].ErrorCode)
+		return res.Responses[0].PartitionResponses[0].RecordSet
+	}
+	batch, err := protocol.Encode(&protocol.RecordBatch{
+		Attributes:      int16(protocol.CompressionSnappy),
+		LastOffsetDelta: 1,
+		Records:         []*protocol.Record{{Value: []byte("a")}, {OffsetDelta: 1, Value: []byte("b")}},
+	})
+	require.NoError(t, err)
+
+	for topic, codec := range map[string]protocol.CompressionCodec{
+		"producer":     protocol.CompressionSnappy,
+		"gzip":         protocol.CompressionGZIP,
+		"uncompressed": protocol.CompressionNone,
+		"zstd":         protocol.CompressionZSTD,
+	} {
+		require.Equal(t, protocol.ErrNone.Code(), produce(topic, batch).ErrorCode, topic)
+		set := fetch(topic, 0)
+		fetched := new(protocol.RecordBatch)
+		require.NoError(t, fetched.Decode(protocol.NewDecoder(set)))
+		require.Equal(t, codec, fetched.Codec(), topic)
+		require.Equal(t, int64(1), protocol.LastOffset(set), topic)
+		records, err := protocol.DecodeRecords(set)
+		require.NoError(t, err)
+		require.Len(t, records, 2)
+		require.Equal(t, []byte("b"), records[1].Value)
+	}
+
+	// legacy message sets are wrapped, and can't be zstd compressed.
+	legacy, err := protocol.Encode(&protocol.MessageSet{Messages: []*protocol.Message{{MagicByte: 1, Value: []byte("c")}, {MagicByte: 1, Value: []byte("d")}}})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrNone.Code(), produce("gzip", legacy).ErrorCode)
+	ms := new(protocol.MessageSet)
+	require.NoError(t, ms.Decode(protocol.NewDecoder(fetch("gzip", 2))))
+	require.Len(t, ms.Messages, 1)
+	require.Equal(t, protocol.CompressionGZIP, ms.Messages[0].Codec())
+	records, err := protocol.DecodeRecords(fetch("gzip", 2))
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.Equal(t, protocol.ErrUnsupportedCompressionType.Code(), produce("zstd", legacy).ErrorCode)
+
+	value := "brotli"
+	res, err := conn.AlterConfigs(&protocol.AlterConfigsRequest{
+		Resources: []protocol.AlterConfigsResource{{
+			Type:    protocol.TopicResourceType,
+			Name:    "producer",
+			Entries: []protocol.AlterConfigsEntry{{Name: compressionTypeConfig, Value: &value}},
+		}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrInvalidConfig.Code(), res.Resources[0].ErrorCode)
+}
@@ -1,36 +1,274 @@
 package config
 
 import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"os"
+	"regexp"
 	"time"
 
+	multierror "github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/raft"
 	"github.com/hashicorp/serf/serf"
+	"github.com/travisjeffery/jocko/clock"
+	"github.com/travisjeffery/jocko/jocko/discover"
 )
 
 const (
 	DefaultLANSerfPort = 8301
+	DefaultAddr        = "0.0.0.0:9092"
+	DefaultRaftAddr    = "127.0.0.1:9093"
+)
+
+const (
+	// RoleBroker nodes host partitions.
+	RoleBroker = "broker"
+	// RoleObserver nodes join serf and replicate the raft state as non-voters but host no
+	// partitions, e.g. to serve metadata requests for very large clusters.
+	RoleObserver = "observer"
+)
+
+const (
+	// MetricsSinkPrometheus serves the broker's metrics for Prometheus to scrape.
+	MetricsSinkPrometheus = "prometheus"
+	// MetricsSinkStatsd sends the broker's metrics to a statsd server.
+	MetricsSinkStatsd = "statsd"
+)
+
+const (
+	// OrphanedPartitionsQuarantine moves orphaned partition dirs into the data dir's quarantine
+	// dir for the operator to inspect.
+	OrphanedPartitionsQuarantine = "quarantine"
+	// OrphanedPartitionsDelete deletes orphaned partition dirs.
+	OrphanedPartitionsDelete = "delete"
+)
+
+const (
+	// TLSClientAuthNone doesn't ask clients for certificates.
+	TLSClientAuthNone = "none"
+	// TLSClientAuthRequested asks clients for certificates and verifies those presented against
+	// the TLS CA, but lets clients without one connect.
+	TLSClientAuthRequested = "requested"
+	// TLSClientAuthRequired only lets clients presenting a certificate signed by the TLS CA
+	// connect.
+	TLSClientAuthRequired = "required"
 )
 
 // Config holds the configuration for a Config.
 type Config struct {
-	ID                            int32
-	NodeName                      string
-	DataDir                       string
-	DevMode                       bool
-	Addr                          string
-	SerfLANConfig                 *serf.Config
-	RaftConfig                    *raft.Config
-	Bootstrap                     bool
-	BootstrapExpect               int
-	StartAsLeader                 bool
-	StartJoinAddrsLAN             []string
-	StartJoinAddrsWAN             []string
-	NonVoter                      bool
-	RaftAddr                      string
-	LeaveDrainTime                time.Duration
-	ReconcileInterval             time.Duration
+	ID       int32
+	NodeName string
+	DataDir  string
+	DevMode  bool
+	Addr     string
+	// AdvertiseAddr, if set, is the address of the Kafka protocol listener advertised to clients
+	// and the other brokers rather than Addr, e.g. a pod's DNS name when Addr binds every
+	// interface. It can be a template, see ResolveIdentity.
+	AdvertiseAddr string
+	// IDTemplate, if set, is the template the broker's ID is expanded from, e.g. ${ORDINAL} for a
+	// StatefulSet's pods, plus IDOffset. See ResolveIdentity.
+	IDTemplate        string
+	IDOffset          int32
+	SerfLANConfig     *serf.Config
+	RaftConfig        *raft.Config
+	Bootstrap         bool
+	BootstrapExpect   int
+	StartAsLeader     bool
+	StartJoinAddrsLAN []string
+	StartJoinAddrsWAN []string
+	// RetryJoinLAN are the serf addresses the broker keeps trying to join until it's joined one
+	// of them, either addresses or discovery providers' configs, e.g.
+	// "provider=k8s label_selector=app=jocko". See the discover package for the providers.
+	RetryJoinLAN []string
+	// RetryJoinInterval is how long the broker waits to retry joining after its first attempt,
+	// doubling after each attempt up to RetryJoinMaxInterval.
+	RetryJoinInterval    time.Duration
+	RetryJoinMaxInterval time.Duration
+	// RetryJoinMaxAttempts is the number of times the broker tries to join before giving up, 0
+	// to keep trying.
+	RetryJoinMaxAttempts int
+	// JoinProviders are discovery providers by name for RetryJoinLAN in addition to the
+	// built-in ones, replacing those with the same names.
+	JoinProviders     map[string]discover.Provider
+	NonVoter          bool
+	RaftAddr          string
+	LeaveDrainTime    time.Duration
+	ReconcileInterval time.Duration
+	// OffsetsTopicReplicationFactor is the offsets topic's replication factor, clamped to
+	// BootstrapExpect so the default's fine for smaller clusters.
 	OffsetsTopicReplicationFactor int16
+	// OffsetCommitLinger is how long offset commits wait for others to the same offsets topic
+	// partition to be appended together. Zero appends each commit on its own.
+	OffsetCommitLinger time.Duration
+	// GroupMinSessionTimeout and GroupMaxSessionTimeout bound the session timeouts group members
+	// may join with, a member is removed from its group when it doesn't heartbeat for its
+	// session timeout.
+	GroupMinSessionTimeout time.Duration
+	GroupMaxSessionTimeout time.Duration
+	// DefaultReplicationFactor and NumPartitions are used for auto-created topics and for topics
+	// created with a replication factor or partition count of -1.
+	DefaultReplicationFactor int16
+	NumPartitions            int32
+	// MinInsyncReplicas is the fewest in-sync replicas a partition needs to take acks=all
+	// produces, for topics without min.insync.replicas set.
+	MinInsyncReplicas int
+	// AutoCreateTopics has metadata requests for unknown topics create them, if the client allows
+	// it.
+	AutoCreateTopics bool
+	// Role is either RoleBroker or RoleObserver. Observers are always non-voters.
+	Role string
+	// ReconcileCoalescePeriod is how long the controller waits for more member events after one
+	// arrives, so a burst of them is reconciled into raft together.
+	ReconcileCoalescePeriod time.Duration
+	// Tags label the broker, e.g. disk=ssd or dc=us-east, for topics' placement constraints to
+	// match when their replicas are assigned.
+	Tags map[string]string
+	// AutoPopulateNewBrokers has the controller move a share of the existing
+	// partition replicas onto brokers that carry less than their share, e.g.
+	// brokers that just joined the cluster.
+	AutoPopulateNewBrokers bool
+	// AutoPopulateMaxMoves caps the number of replicas moved each reconcile interval.
+	AutoPopulateMaxMoves int
+	// MaxPartitionsPerBroker caps the number of partition replicas assigned to a
+	// single broker. Zero means no limit.
+	MaxPartitionsPerBroker int
+	// MaxPartitions caps the number of partitions in the cluster. Zero means no limit.
+	MaxPartitions int
+	// MaxOpenSegmentFiles caps the number of segment log files the broker keeps open, closing
+	// the least recently used and reopening them on demand. Zero means no limit.
+	MaxOpenSegmentFiles int
+	// FetchCacheSize is the number of fetched record sets cached and shared between consumers
+	// fetching the same offsets. Zero disables the cache.
+	FetchCacheSize int
+	// HibernateAfter is how long a partition replica can go without being produced to or fetched
+	// from before its log is closed and its replicator stopped. It's reopened on the next produce
+	// or fetch. Zero disables hibernation.
+	HibernateAfter time.Duration
+	// ReplicaLagWarnThreshold is how long a follower replica can go without catching up with its
+	// leader before the broker logs a warning. Zero disables the warnings.
+	ReplicaLagWarnThreshold time.Duration
+	// ClockSkewThreshold is how far produced records' create times can be from the broker's
+	// clock before the broker logs the producer as skewed, catching producer hosts with
+	// misconfigured clocks that break time based retention. Zero disables the check.
+	ClockSkewThreshold time.Duration
+	// RejectClockSkew rejects produce requests to create time topics with records skewed past the
+	// ClockSkewThreshold, rather than only logging them.
+	RejectClockSkew bool
+	// SegmentCompressionInterval is how often the sealed segments of topics with
+	// segment.compression set are recompressed at rest. Zero disables recompression.
+	SegmentCompressionInterval time.Duration
+	// DiskUsageReportInterval is how often the broker reports its replicas' log sizes and its
+	// disk's free space to the other brokers, for new replicas to be placed on the emptier disks
+	// when the brokers' disks are used unevenly. Zero disables the reports.
+	DiskUsageReportInterval time.Duration
+	// OrphanedPartitionScanInterval is how often the data dir's scanned for partition dirs that
+	// no longer belong to one of the broker's replicas, e.g. left by a failed delete or
+	// reassignment, starting once the broker's caught up with the raft state. Zero disables the
+	// scans.
+	OrphanedPartitionScanInterval time.Duration
+	// OrphanedPartitionAction is what's done with partition dirs still orphaned on the scan after
+	// the one that found them, OrphanedPartitionsQuarantine if unset or OrphanedPartitionsDelete.
+	OrphanedPartitionAction string
+	// MetricsPerPartition labels the topic metrics with their partition too, rather than
+	// aggregating a topic's partitions.
+	MetricsPerPartition bool
+	// MetricsTopics, if set, is the allowlist of topics tracked under their own metrics, the
+	// other topics' metrics are aggregated together.
+	MetricsTopics []string
+	// MetricsClientIDs, if set, is the allowlist of client IDs tracked under their own client
+	// metrics, the other clients' metrics are aggregated together.
+	MetricsClientIDs []string
+	// MetricsSink is the metrics system the broker's metrics are written to, MetricsSinkPrometheus
+	// if unset or MetricsSinkStatsd.
+	MetricsSink string
+	// StatsdAddr is the address of the statsd server the statsd sink sends the metrics to over
+	// UDP.
+	StatsdAddr string
+	// TLSCertFile and TLSKeyFile are the certificate and key the Kafka protocol listener serves
+	// TLS with. Both are reread on Server.ReloadTLS. If unset the listener doesn't use TLS.
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSClientAuth is whether the Kafka protocol listener authenticates clients by their
+	// certificates, TLSClientAuthNone if unset, TLSClientAuthRequested, or TLSClientAuthRequired,
+	// and TLSCAFile the CA the certificates must be signed by.
+	TLSClientAuth string
+	TLSCAFile     string
+	// InterBrokerAddr, if set, is the address of a second Kafka protocol listener the other
+	// brokers send their requests to, e.g. replicas' fetches, so it can be secured apart from the
+	// client-facing one.
+	InterBrokerAddr string
+	// InterBrokerTLSCertFile and InterBrokerTLSKeyFile are the certificate and key the broker
+	// presents to the other brokers, and InterBrokerTLSCAFile the CA their certificates must be
+	// signed by. If set, raft and the inter-broker listener use mutual TLS with them, independent
+	// of the client-facing TLS. The certificate's reread on Server.ReloadTLS.
+	InterBrokerTLSCertFile string
+	InterBrokerTLSKeyFile  string
+	InterBrokerTLSCAFile   string
+	// SerfEncryptKey, if set, is the base64 encoded 16, 24, or 32 byte key serf's gossip is
+	// encrypted with. Gossip is over UDP so the inter-broker TLS doesn't cover it.
+	SerfEncryptKey string
+	// TCPKeepAlive is the keep-alive period of the broker's TCP connections, those it accepts and
+	// those it dials to other brokers. Zero uses Go's default, negative disables keep-alives.
+	TCPKeepAlive time.Duration
+	// TCPSendBufferBytes and TCPReceiveBufferBytes size the connections' socket buffers, e.g.
+	// larger to keep high-latency WAN replication links full. Zero leaves the system's default.
+	TCPSendBufferBytes    int
+	TCPReceiveBufferBytes int
+	// TCPNoDelay disables Nagle's algorithm so small requests and responses are sent immediately.
+	// Turning it off batches small writes into fewer packets, e.g. for very high throughput
+	// produce streams.
+	TCPNoDelay bool
+	// SocketRequestMaxBytes is the largest request the broker reads. Connections sending larger
+	// requests are closed rather than the broker allocating for them.
+	SocketRequestMaxBytes int
+	// DeniedClientIDs and AllowedClientIDs are regexps matching whole client IDs, e.g. ^$ matching
+	// none or legacy-.* matching a legacy client's. Requests with a client ID matching a denied
+	// pattern, or no allowed pattern if there are any, are refused and their connections closed,
+	// e.g. to enforce a client migration. The brokers' own client IDs are never refused.
+	DeniedClientIDs  []string
+	AllowedClientIDs []string
+	// HandshakeTimeout bounds how long a connection accepted by a TLS listener has to complete its
+	// handshake, and RequestReadTimeout how long a connection has to send the rest of a request
+	// once its first byte arrives. Connections taking longer are closed, so half-open or
+	// slowloris connections can't hold the broker's goroutines and buffers. Connections may idle
+	// between requests indefinitely. Zero disables the timeout.
+	HandshakeTimeout   time.Duration
+	RequestReadTimeout time.Duration
+	// QueuedMaxRequestBytes is the memory budget for the requests the broker's read but not yet
+	// answered and the records its followers have fetched but not yet appended. Once it's used up
+	// the broker stops reading requests and fetching from leaders until some's freed, so a surge
+	// of produce requests can't run it out of memory. 0 is unlimited.
+	QueuedMaxRequestBytes int64
+	// WireLog logs the decoded requests and responses of the connections matching the wire
+	// filters, each truncated to WireLogMaxBytes, to debug protocol incompatibilities.
+	WireLog         bool
+	WireLogMaxBytes int
+	// WireCaptureDir, if set, is the directory the raw request and response frames of the
+	// connections matching the wire filters are dumped to, a file per connection, so they can be
+	// replayed.
+	WireCaptureDir string
+	// WireClientIDs and WireCIDRs filter the connections logged and captured to those with one of
+	// the client IDs and from an address in one of the CIDRs. An empty filter matches any.
+	WireClientIDs []string
+	WireCIDRs     []string
+	// LogOutput, if set, is where raft writes its logs.
+	LogOutput io.Writer
+	// OnLeaderChange, if set, is called when the broker gains or loses cluster leadership. It's
+	// called from the goroutine monitoring leadership so shouldn't block.
+	OnLeaderChange func(isLeader bool)
+	// OnTopicChange, if set, is called when a topic is created or updated, or deleted. It's
+	// called while applying raft log entries so shouldn't block.
+	OnTopicChange func(topic string, deleted bool)
+	// Clock drives the broker's timers. Tests can set a simulated clock to step through
+	// timeouts, hibernation, and retention without sleeping.
+	Clock clock.Clock
+	// Dial, if set, is how the broker dials the other brokers' Kafka protocol listeners rather
+	// than over TCP, e.g. in-memory pipes in tests.
+	Dial func(ctx context.Context, network, address string) (net.Conn, error)
 }
 
 // DefaultConfig creates/returns a default configuration.
@@ -43,11 +281,37 @@ func DefaultConfig() *Config {
 	conf := &Config{
 		DevMode:                       false,
 		NodeName:                      hostname,
+		Addr:                          DefaultAddr,
+		RaftAddr:                      DefaultRaftAddr,
 		SerfLANConfig:                 serfDefaultConfig(),
 		RaftConfig:                    raft.DefaultConfig(),
 		LeaveDrainTime:                5 * time.Second,
 		ReconcileInterval:             60 * time.Second,
+		ReconcileCoalescePeriod:       100 * time.Millisecond,
 		OffsetsTopicReplicationFactor: 3,
+		OffsetCommitLinger:            5 * time.Millisecond,
+		GroupMinSessionTimeout:        6 * time.Second,
+		GroupMaxSessionTimeout:        30 * time.Minute,
+		DefaultReplicationFactor:      1,
+		NumPartitions:                 1,
+		MinInsyncReplicas:             1,
+		AutoPopulateMaxMoves:          10,
+		Role:                          RoleBroker,
+		TCPNoDelay:                    true,
+		WireLogMaxBytes:               1024,
+		SocketRequestMaxBytes:         100 * 1024 * 1024,
+		HandshakeTimeout:              10 * time.Second,
+		RequestReadTimeout:            30 * time.Second,
+		SegmentCompressionInterval:    5 * time.Minute,
+		OrphanedPartitionScanInterval: 10 * time.Minute,
+		DiskUsageReportInterval:       time.Minute,
+		ReplicaLagWarnThreshold:       30 * time.Second,
+		ClockSkewThreshold:            time.Hour,
+		OrphanedPartitionAction:       OrphanedPartitionsQuarantine,
+		TLSClientAuth:                 TLSClientAuthNone,
+		RetryJoinInterval:             time.Second,
+		RetryJoinMaxInterval:          30 * time.Second,
+		Clock:                         clock.New(),
 	}
 
 	conf.SerfLANConfig.ReconnectTimeout = 3 * 24 * time.Hour
@@ -61,3 +325,249 @@ func serfDefaultConfig() *serf.Config {
 	base.QueueDepthWarning = 1000000
 	return base
 }
+
+// Validate checks the config for invalid and conflicting options and returns all of the problems
+// found at once.
+func (c *Config) Validate() error {
+	var result error
+	if c.DataDir == "" {
+		result = multierror.Append(result, errors.New("data dir is required"))
+	}
+	if c.ID < 0 {
+		result = multierror.Append(result, fmt.Errorf("id %d must not be negative", c.ID))
+	}
+	if err := c.checkAddrs(); err != nil {
+		result = multierror.Append(result, err)
+	}
+	if c.AdvertiseAddr != "" {
+		if host, _, err := net.SplitHostPort(c.AdvertiseAddr); err != nil {
+			result = multierror.Append(result, fmt.Errorf("invalid advertise addr %q: %v", c.AdvertiseAddr, err))
+		} else if isUnspecified(host) {
+			result = multierror.Append(result, fmt.Errorf("advertise addr %q must have a specific host", c.AdvertiseAddr))
+		}
+	}
+	if host, _, err := net.SplitHostPort(c.RaftAddr); err == nil && isUnspecified(host) {
+		result = multierror.Append(result, fmt.Errorf("raft addr %q is advertised to other brokers so must have a specific host", c.RaftAddr))
+	}
+	if c.BootstrapExpect < 0 {
+		result = multierror.Append(result, fmt.Errorf("bootstrap expect %d must not be negative", c.BootstrapExpect))
+	}
+	if c.Role != "" && c.Role != RoleBroker && c.Role != RoleObserver {
+		result = multierror.Append(result, fmt.Errorf("role %q must be %q or %q", c.Role, RoleBroker, RoleObserver))
+	}
+	if c.MetricsSink != "" && c.MetricsSink != MetricsSinkPrometheus && c.MetricsSink != MetricsSinkStatsd {
+		result = multierror.Append(result, fmt.Errorf("metrics sink %q must be %q or %q", c.MetricsSink, MetricsSinkPrometheus, MetricsSinkStatsd))
+	} else if c.MetricsSink == MetricsSinkStatsd && c.StatsdAddr == "" {
+		result = multierror.Append(result, errors.New("statsd addr is required by the statsd metrics sink"))
+	}
+	if c.Bootstrap && c.BootstrapExpect > 1 {
+		result = multierror.Append(result, fmt.Errorf("bootstrap can't be set with bootstrap expect %d, a single broker would bootstrap the cluster", c.BootstrapExpect))
+	}
+	if c.IsNonVoter() && (c.Bootstrap || c.BootstrapExpect > 0) {
+		result = multierror.Append(result, errors.New("non-voters can't bootstrap the cluster"))
+	}
+	if c.OffsetsTopicReplicationFactor < 1 {
+		result = multierror.Append(result, fmt.Errorf("offsets topic replication factor %d must be at least 1", c.OffsetsTopicReplicationFactor))
+	}
+	if c.DefaultReplicationFactor < 1 {
+		result = multierror.Append(result, fmt.Errorf("default replication factor %d must be at least 1", c.DefaultReplicationFactor))
+	} else if c.BootstrapExpect > 0 && int(c.DefaultReplicationFactor) > c.BootstrapExpect {
+		result = multierror.Append(result, fmt.Errorf("default replication factor %d is greater than the %d expected brokers", c.DefaultReplicationFactor, c.BootstrapExpect))
+	}
+	if c.NumPartitions < 1 {
+		result = multierror.Append(result, fmt.Errorf("num partitions %d must be at least 1", c.NumPartitions))
+	}
+	if c.MinInsyncReplicas < 1 {
+		result = multierror.Append(result, fmt.Errorf("min insync replicas %d must be at least 1", c.MinInsyncReplicas))
+	}
+	if c.OffsetCommitLinger < 0 {
+		result = multierror.Append(result, fmt.Errorf("offset commit linger %s must not be negative", c.OffsetCommitLinger))
+	}
+	if c.GroupMinSessionTimeout > c.GroupMaxSessionTimeout {
+		result = multierror.Append(result, fmt.Errorf("group min session timeout %s is greater than the max %s", c.GroupMinSessionTimeout, c.GroupMaxSessionTimeout))
+	}
+	if c.ReplicaLagWarnThreshold < 0 {
+		result = multierror.Append(result, fmt.Errorf("replica lag warn threshold %s must not be negative", c.ReplicaLagWarnThreshold))
+	}
+	if c.ClockSkewThreshold < 0 {
+		result = multierror.Append(result, fmt.Errorf("clock skew threshold %s must not be negative", c.ClockSkewThreshold))
+	}
+	if c.HibernateAfter < 0 {
+		result = multierror.Append(result, fmt.Errorf("hibernate after %s must not be negative", c.HibernateAfter))
+	}
+	if c.DiskUsageReportInterval < 0 {
+		result = multierror.Append(result, fmt.Errorf("disk usage report interval %s must not be negative", c.DiskUsageReportInterval))
+	}
+	if c.OrphanedPartitionScanInterval < 0 {
+		result = multierror.Append(result, fmt.Errorf("orphaned partition scan interval %s must not be negative", c.OrphanedPartitionScanInterval))
+	}
+	if c.OrphanedPartitionAction != "" && c.OrphanedPartitionAction != OrphanedPartitionsQuarantine && c.OrphanedPartitionAction != OrphanedPartitionsDelete {
+		result = multierror.Append(result, fmt.Errorf("orphaned partition action %q must be %q or %q", c.OrphanedPartitionAction, OrphanedPartitionsQuarantine, OrphanedPartitionsDelete))
+	}
+	if c.SegmentCompressionInterval < 0 {
+		result = multierror.Append(result, fmt.Errorf("segment compression interval %s must not be negative", c.SegmentCompressionInterval))
+	}
+	if c.TCPSendBufferBytes < 0 || c.TCPReceiveBufferBytes < 0 {
+		result = multierror.Append(result, fmt.Errorf("tcp send buffer bytes %d and receive buffer bytes %d must not be negative", c.TCPSendBufferBytes, c.TCPReceiveBufferBytes))
+	}
+	if c.SocketRequestMaxBytes <= 0 {
+		result = multierror.Append(result, fmt.Errorf("socket request max bytes %d must be positive", c.SocketRequestMaxBytes))
+	}
+	for _, p := range append(append([]string{}, c.DeniedClientIDs...), c.AllowedClientIDs...) {
+		if _, err := CompileClientIDPattern(p); err != nil {
+			result = multierror.Append(result, fmt.Errorf("client id pattern %q: %v", p, err))
+		}
+	}
+	if c.HandshakeTimeout < 0 || c.RequestReadTimeout < 0 {
+		result = multierror.Append(result, fmt.Errorf("handshake timeout %s and request read timeout %s must not be negative", c.HandshakeTimeout, c.RequestReadTimeout))
+	}
+	if len(c.RetryJoinLAN) > 0 && (c.RetryJoinInterval <= 0 || c.RetryJoinMaxInterval < c.RetryJoinInterval) {
+		result = multierror.Append(result, fmt.Errorf("retry join interval %s must be positive and at most the max interval %s", c.RetryJoinInterval, c.RetryJoinMaxInterval))
+	}
+	if c.QueuedMaxRequestBytes < 0 {
+		result = multierror.Append(result, fmt.Errorf("queued max request bytes %d must not be negative", c.QueuedMaxRequestBytes))
+	}
+	if c.WireLogMaxBytes < 0 {
+		result = multierror.Append(result, fmt.Errorf("wire log max bytes %d must not be negative", c.WireLogMaxBytes))
+	}
+	for _, cidr := range c.WireCIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			result = multierror.Append(result, fmt.Errorf("wire cidr %q: %v", cidr, err))
+		}
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		result = multierror.Append(result, errors.New("tls cert file and tls key file must be set together"))
+	}
+	switch c.TLSClientAuth {
+	case "", TLSClientAuthNone:
+	case TLSClientAuthRequested, TLSClientAuthRequired:
+		if c.TLSCertFile == "" || c.TLSCAFile == "" {
+			result = multierror.Append(result, fmt.Errorf("tls client auth %q needs a tls cert file and ca file", c.TLSClientAuth))
+		}
+	default:
+		result = multierror.Append(result, fmt.Errorf("tls client auth %q must be %q, %q, or %q", c.TLSClientAuth, TLSClientAuthNone, TLSClientAuthRequested, TLSClientAuthRequired))
+	}
+	if c.InterBrokerTLSCertFile != "" || c.InterBrokerTLSKeyFile != "" || c.InterBrokerTLSCAFile != "" {
+		if c.InterBrokerTLSCertFile == "" || c.InterBrokerTLSKeyFile == "" || c.InterBrokerTLSCAFile == "" {
+			result = multierror.Append(result, errors.New("inter-broker tls cert file, key file, and ca file must be set together"))
+		}
+		if c.InterBrokerAddr == "" {
+			result = multierror.Append(result, errors.New("inter-broker tls needs an inter-broker addr for the brokers' requests"))
+		}
+	}
+	if c.SerfEncryptKey != "" {
+		if _, err := c.SerfEncryptKeyBytes(); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+	for _, o := range []struct {
+		name string
+		val  int
+	}{
+		{"auto populate max moves", c.AutoPopulateMaxMoves},
+		{"retry join max attempts", c.RetryJoinMaxAttempts},
+		{"max partitions per broker", c.MaxPartitionsPerBroker},
+		{"max partitions", c.MaxPartitions},
+		{"max open segment files", c.MaxOpenSegmentFiles},
+		{"fetch cache size", c.FetchCacheSize},
+	} {
+		if o.val < 0 {
+			result = multierror.Append(result, fmt.Errorf("%s %d must not be negative", o.name, o.val))
+		}
+	}
+	return result
+}
+
+// SerfEncryptKeyBytes returns the decoded serf encryption key.
+func (c *Config) SerfEncryptKeyBytes() ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(c.SerfEncryptKey)
+	if err != nil {
+		return nil, fmt.Errorf("serf encrypt key: %v", err)
+	}
+	if n := len(key); n != 16 && n != 24 && n != 32 {
+		return nil, fmt.Errorf("serf encrypt key is %d bytes, it must be 16, 24, or 32", n)
+	}
+	return key, nil
+}
+
+// IsObserver returns whether the node is an observer.
+func (c *Config) IsObserver() bool {
+	return c.Role == RoleObserver
+}
+
+// IsNonVoter returns whether the node joins raft as a non-voter.
+func (c *Config) IsNonVoter() bool {
+	return c.NonVoter || c.IsObserver()
+}
+
+// Reload copies the options that can be changed on a running broker from the given config.
+func (c *Config) Reload(from *Config) {
+	c.AutoPopulateNewBrokers = from.AutoPopulateNewBrokers
+	c.AutoPopulateMaxMoves = from.AutoPopulateMaxMoves
+	c.MaxPartitionsPerBroker = from.MaxPartitionsPerBroker
+	c.MaxPartitions = from.MaxPartitions
+	c.DefaultReplicationFactor = from.DefaultReplicationFactor
+	c.NumPartitions = from.NumPartitions
+	c.AutoCreateTopics = from.AutoCreateTopics
+}
+
+// checkAddrs returns an error if the broker, raft, and serf listeners are configured to bind to
+// the same port on overlapping addresses.
+func (c *Config) checkAddrs() error {
+	type listener struct {
+		name string
+		host string
+		port string
+	}
+	var ls []listener
+	for _, l := range []struct {
+		name string
+		addr string
+	}{
+		{"broker", c.Addr},
+		{"raft", c.RaftAddr},
+	} {
+		host, port, err := net.SplitHostPort(l.addr)
+		if err != nil {
+			return fmt.Errorf("invalid %s addr %q: %v", l.name, l.addr, err)
+		}
+		ls = append(ls, listener{l.name, host, port})
+	}
+	if c.InterBrokerAddr != "" {
+		host, port, err := net.SplitHostPort(c.InterBrokerAddr)
+		if err != nil {
+			return fmt.Errorf("invalid inter-broker addr %q: %v", c.InterBrokerAddr, err)
+		}
+		ls = append(ls, listener{"inter-broker", host, port})
+	}
+	if c.SerfLANConfig != nil && c.SerfLANConfig.MemberlistConfig != nil {
+		ml := c.SerfLANConfig.MemberlistConfig
+		ls = append(ls, listener{"serf", ml.BindAddr, fmt.Sprintf("%d", ml.BindPort)})
+	}
+	for i := range ls {
+		for j := i + 1; j < len(ls); j++ {
+			a, b := ls[i], ls[j]
+			// port 0 has the os pick an unused port.
+			if a.port == "0" || a.port != b.port {
+				continue
+			}
+			if a.host == b.host || isUnspecified(a.host) || isUnspecified(b.host) {
+				return fmt.Errorf("%s and %s addrs collide on port %s", a.name, b.name, a.port)
+			}
+		}
+	}
+	return nil
+}
+
+func isUnspecified(host string) bool {
+	if host == "" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsUnspecified()
+}
+
+// CompileClientIDPattern compiles the client ID pattern to a regexp matching whole client IDs.
+func CompileClientIDPattern(p string) (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + p + ")$")
+}
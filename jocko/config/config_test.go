@@ -0,0 +1,275 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(c *Config)
+		wantErr bool
+	}{
+		{
+			name:  "defaults",
+			setup: func(c *Config) {},
+		},
+		{
+			name: "same port different hosts",
+			setup: func(c *Config) {
+				c.Addr = "10.0.0.1:9092"
+				c.RaftAddr = "10.0.0.2:9092"
+			},
+		},
+		{
+			name: "ephemeral ports",
+			setup: func(c *Config) {
+				c.Addr = "127.0.0.1:0"
+				c.RaftAddr = "127.0.0.1:0"
+			},
+		},
+		{
+			name: "broker and raft collide",
+			setup: func(c *Config) {
+				c.RaftAddr = "127.0.0.1:9092"
+			},
+			wantErr: true,
+		},
+		{
+			name: "raft and serf collide",
+			setup: func(c *Config) {
+				c.RaftAddr = "127.0.0.1:8301"
+			},
+			wantErr: true,
+		},
+		{
+			name: "inter-broker addr",
+			setup: func(c *Config) {
+				c.InterBrokerAddr = "127.0.0.1:9094"
+			},
+		},
+		{
+			name: "inter-broker and broker collide",
+			setup: func(c *Config) {
+				c.InterBrokerAddr = "127.0.0.1:9092"
+			},
+			wantErr: true,
+		},
+		{
+			name: "inter-broker and raft collide",
+			setup: func(c *Config) {
+				c.InterBrokerAddr = "127.0.0.1:9093"
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid inter-broker addr",
+			setup: func(c *Config) {
+				c.InterBrokerAddr = "9094"
+			},
+			wantErr: true,
+		},
+		{
+			name: "unspecified raft addr",
+			setup: func(c *Config) {
+				c.RaftAddr = "0.0.0.0:9093"
+			},
+			wantErr: true,
+		},
+		{
+			name: "non-voter bootstrap",
+			setup: func(c *Config) {
+				c.NonVoter = true
+				c.Bootstrap = true
+			},
+			wantErr: true,
+		},
+		{
+			name: "bootstrap single expected broker",
+			setup: func(c *Config) {
+				c.Bootstrap = true
+				c.BootstrapExpect = 1
+			},
+		},
+		{
+			name: "bootstrap with bootstrap expect",
+			setup: func(c *Config) {
+				c.Bootstrap = true
+				c.BootstrapExpect = 3
+			},
+			wantErr: true,
+		},
+		{
+			name: "observer bootstrap",
+			setup: func(c *Config) {
+				c.Role = RoleObserver
+				c.BootstrapExpect = 3
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown role",
+			setup: func(c *Config) {
+				c.Role = "controller"
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown metrics sink",
+			setup: func(c *Config) {
+				c.MetricsSink = "graphite"
+			},
+			wantErr: true,
+		},
+		{
+			name: "statsd sink without addr",
+			setup: func(c *Config) {
+				c.MetricsSink = MetricsSinkStatsd
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid client id pattern",
+			setup: func(c *Config) {
+				c.DeniedClientIDs = []string{"legacy-("}
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown tls client auth",
+			setup: func(c *Config) {
+				c.TLSClientAuth = "optional"
+			},
+			wantErr: true,
+		},
+		{
+			name: "tls client auth without ca",
+			setup: func(c *Config) {
+				c.TLSCertFile = "cert.pem"
+				c.TLSKeyFile = "key.pem"
+				c.TLSClientAuth = TLSClientAuthRequired
+			},
+			wantErr: true,
+		},
+		{
+			name: "inter-broker tls without ca",
+			setup: func(c *Config) {
+				c.InterBrokerAddr = "127.0.0.1:9094"
+				c.InterBrokerTLSCertFile = "cert.pem"
+				c.InterBrokerTLSKeyFile = "key.pem"
+			},
+			wantErr: true,
+		},
+		{
+			name: "inter-broker tls without inter-broker addr",
+			setup: func(c *Config) {
+				c.InterBrokerTLSCertFile = "cert.pem"
+				c.InterBrokerTLSKeyFile = "key.pem"
+				c.InterBrokerTLSCAFile = "ca.pem"
+			},
+			wantErr: true,
+		},
+		{
+			name: "unspecified advertise addr",
+			setup: func(c *Config) {
+				c.AdvertiseAddr = "0.0.0.0:9092"
+			},
+			wantErr: true,
+		},
+		{
+			name: "short serf encrypt key",
+			setup: func(c *Config) {
+				c.SerfEncryptKey = "c2hvcnQ="
+			},
+			wantErr: true,
+		},
+		{
+			name: "single node default offsets topic replication factor",
+			setup: func(c *Config) {
+				c.BootstrapExpect = 1
+			},
+		},
+		{
+			name: "replication factor within expected brokers",
+			setup: func(c *Config) {
+				c.BootstrapExpect = 3
+			},
+		},
+		{
+			name: "default replication factor over expected brokers",
+			setup: func(c *Config) {
+				c.BootstrapExpect = 3
+				c.DefaultReplicationFactor = 4
+			},
+			wantErr: true,
+		},
+		{
+			name: "no default partitions",
+			setup: func(c *Config) {
+				c.NumPartitions = 0
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid addr",
+			setup: func(c *Config) {
+				c.Addr = "9092"
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid wire cidr",
+			setup: func(c *Config) {
+				c.WireCIDRs = []string{"10.0.0.1"}
+			},
+			wantErr: true,
+		},
+		{
+			name: "zero socket request max bytes",
+			setup: func(c *Config) {
+				c.SocketRequestMaxBytes = 0
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative tcp buffer",
+			setup: func(c *Config) {
+				c.TCPReceiveBufferBytes = -1
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown orphaned partition action",
+			setup: func(c *Config) {
+				c.OrphanedPartitionAction = "archive"
+			},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := DefaultConfig()
+			c.DataDir = "/tmp/jocko"
+			test.setup(c)
+			err := c.Validate()
+			if test.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestConfig_ValidateAggregatesErrors(t *testing.T) {
+	c := DefaultConfig()
+	c.RaftAddr = c.Addr
+	c.MaxPartitions = -1
+	err := c.Validate()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "data dir is required")
+	require.Contains(t, err.Error(), "broker and raft addrs collide on port 9092")
+	require.Contains(t, err.Error(), "max partitions -1 must not be negative")
+}
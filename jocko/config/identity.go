@@ -0,0 +1,80 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ordinalRe matches the ordinal a StatefulSet's pods' hostnames end with, e.g. 2 in jocko-2.
+var ordinalRe = regexp.MustCompile(`-(\d+)$`)
+
+// ExpandTemplate expands the template's ${VAR} env vars and ${HOSTNAME} and ${ORDINAL}, the number
+// the hostname ends with like a Kubernetes StatefulSet's pods', e.g. 2 for jocko-2. Unset vars are
+// errors rather than expanding to nothing.
+func ExpandTemplate(tmpl, hostname string) (string, error) {
+	var err error
+	s := os.Expand(tmpl, func(name string) string {
+		switch name {
+		case "HOSTNAME":
+			return hostname
+		case "ORDINAL":
+			m := ordinalRe.FindStringSubmatch(hostname)
+			if m == nil {
+				err = fmt.Errorf("hostname %q doesn't end with an ordinal", hostname)
+				return ""
+			}
+			return m[1]
+		}
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			err = fmt.Errorf("env var %s isn't set", name)
+		}
+		return v
+	})
+	return s, err
+}
+
+// ResolveIdentity sets the broker's ID from IDTemplate, if it's set, and expands AdvertiseAddr and
+// RaftAddr, so brokers templated from the same config, e.g. a StatefulSet's, each get their own
+// identity. The ID's checked against the one recorded in the data dir when the broker starts, so
+// a broker started with the wrong ID refuses to rather than taking over another broker's data.
+func (c *Config) ResolveIdentity() error {
+	hostname := os.Getenv("HOSTNAME")
+	if hostname == "" {
+		var err error
+		if hostname, err = os.Hostname(); err != nil {
+			return err
+		}
+	}
+	if c.IDTemplate != "" {
+		s, err := ExpandTemplate(c.IDTemplate, hostname)
+		if err != nil {
+			return fmt.Errorf("id template %q: %v", c.IDTemplate, err)
+		}
+		id, err := strconv.ParseInt(strings.TrimSpace(s), 10, 32)
+		if err != nil {
+			return fmt.Errorf("id template %q expands to %q, not an id", c.IDTemplate, s)
+		}
+		c.ID = int32(id) + c.IDOffset
+	}
+	for _, addr := range []*string{&c.AdvertiseAddr, &c.RaftAddr} {
+		s, err := ExpandTemplate(*addr, hostname)
+		if err != nil {
+			return fmt.Errorf("addr %q: %v", *addr, err)
+		}
+		*addr = s
+	}
+	return nil
+}
+
+// AdvertisedAddr returns the address of the broker's Kafka protocol listener it advertises to
+// clients and the other brokers.
+func (c *Config) AdvertisedAddr() string {
+	if c.AdvertiseAddr != "" {
+		return c.AdvertiseAddr
+	}
+	return c.Addr
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandTemplate(t *testing.T) {
+	req := require.New(t)
+	os.Setenv("JOCKO_TEST_DOMAIN", "jocko.default.svc")
+	defer os.Unsetenv("JOCKO_TEST_DOMAIN")
+
+	s, err := ExpandTemplate("${HOSTNAME}.${JOCKO_TEST_DOMAIN}:9092", "jocko-2")
+	req.NoError(err)
+	req.Equal("jocko-2.jocko.default.svc:9092", s)
+	s, err = ExpandTemplate("${ORDINAL}", "kafka-jocko-12")
+	req.NoError(err)
+	req.Equal("12", s)
+	s, err = ExpandTemplate("127.0.0.1:9092", "jocko-2")
+	req.NoError(err)
+	req.Equal("127.0.0.1:9092", s)
+
+	_, err = ExpandTemplate("${ORDINAL}", "jocko")
+	req.Error(err)
+	_, err = ExpandTemplate("${JOCKO_TEST_UNSET}:9092", "jocko-2")
+	req.Error(err)
+}
+
+func TestConfig_ResolveIdentity(t *testing.T) {
+	req := require.New(t)
+	os.Setenv("HOSTNAME", "jocko-3")
+	defer os.Unsetenv("HOSTNAME")
+
+	c := DefaultConfig()
+	c.IDTemplate = "${ORDINAL}"
+	c.IDOffset = 100
+	c.AdvertiseAddr = "${HOSTNAME}.jocko:9092"
+	c.RaftAddr = "${HOSTNAME}.jocko:9093"
+	req.NoError(c.ResolveIdentity())
+	req.Equal(int32(103), c.ID)
+	req.Equal("jocko-3.jocko:9092", c.AdvertisedAddr())
+	req.Equal("jocko-3.jocko:9093", c.RaftAddr)
+
+	c = DefaultConfig()
+	c.IDTemplate = "${HOSTNAME}"
+	req.Error(c.ResolveIdentity())
+
+	// without an advertise addr the broker advertises the one it binds.
+	c = DefaultConfig()
+	req.NoError(c.ResolveIdentity())
+	req.Equal(c.Addr, c.AdvertisedAddr())
+}
@@ -2,6 +2,7 @@ package jocko
 
 import (
 	"bufio"
+	"io"
 	"net"
 	"runtime"
 	"sync"
@@ -85,7 +86,7 @@ func (c *Conn) LeaderAndISR(req *protocol.LeaderAndISRRequest) (*protocol.Leader
 	err := c.writeOperation(func(deadline time.Time, id int32) error {
 		return c.writeRequest(req)
 	}, func(deadline time.Time, size int) error {
-		return c.readResponse(&resp, size, req.Version())
+		return c.readResponse(req, &resp, size)
 	})
 	if err != nil {
 		return nil, err
@@ -99,7 +100,7 @@ func (c *Conn) CreateTopics(req *protocol.CreateTopicRequests) (*protocol.Create
 	err := c.writeOperation(func(deadline time.Time, id int32) error {
 		return c.writeRequest(req)
 	}, func(deadline time.Time, size int) error {
-		return c.readResponse(&resp, size, req.Version())
+		return c.readResponse(req, &resp, size)
 	})
 	if err != nil {
 		return nil, err
@@ -113,7 +114,7 @@ func (c *Conn) Produce(req *protocol.ProduceRequest) (*protocol.ProduceResponse,
 	err := c.readOperation(func(deadline time.Time, id int32) error {
 		return c.writeRequest(req)
 	}, func(deadline time.Time, size int) error {
-		return c.readResponse(&resp, size, req.Version())
+		return c.readResponse(req, &resp, size)
 	})
 	if err != nil {
 		return nil, err
@@ -127,7 +128,7 @@ func (c *Conn) Offsets(req *protocol.OffsetsRequest) (*protocol.OffsetsResponse,
 	err := c.readOperation(func(deadline time.Time, id int32) error {
 		return c.writeRequest(req)
 	}, func(deadline time.Time, size int) error {
-		return c.readResponse(&resp, size, req.Version())
+		return c.readResponse(req, &resp, size)
 	})
 	if err != nil {
 		return nil, err
@@ -141,7 +142,7 @@ func (c *Conn) StopReplica(req *protocol.StopReplicaRequest) (*protocol.StopRepl
 	err := c.readOperation(func(deadline time.Time, id int32) error {
 		return c.writeRequest(req)
 	}, func(deadline time.Time, size int) error {
-		return c.readResponse(&resp, size, req.Version())
+		return c.readResponse(req, &resp, size)
 	})
 	if err != nil {
 		return nil, err
@@ -155,7 +156,7 @@ func (c *Conn) UpdateMetadata(req *protocol.UpdateMetadataRequest) (*protocol.Up
 	err := c.readOperation(func(deadline time.Time, id int32) error {
 		return c.writeRequest(req)
 	}, func(deadline time.Time, size int) error {
-		return c.readResponse(&resp, size, req.Version())
+		return c.readResponse(req, &resp, size)
 	})
 	if err != nil {
 		return nil, err
@@ -169,7 +170,7 @@ func (c *Conn) ControlledShutdown(req *protocol.ControlledShutdownRequest) (*pro
 	err := c.readOperation(func(deadline time.Time, id int32) error {
 		return c.writeRequest(req)
 	}, func(deadline time.Time, size int) error {
-		return c.readResponse(&resp, size, req.Version())
+		return c.readResponse(req, &resp, size)
 	})
 	if err != nil {
 		return nil, err
@@ -183,7 +184,7 @@ func (c *Conn) OffsetCommit(req *protocol.OffsetCommitRequest) (*protocol.Offset
 	err := c.readOperation(func(deadline time.Time, id int32) error {
 		return c.writeRequest(req)
 	}, func(deadline time.Time, size int) error {
-		return c.readResponse(&resp, size, req.Version())
+		return c.readResponse(req, &resp, size)
 	})
 	if err != nil {
 		return nil, err
@@ -197,7 +198,7 @@ func (c *Conn) SaslHandshake(req *protocol.SaslHandshakeRequest) (*protocol.Sasl
 	err := c.readOperation(func(deadline time.Time, id int32) error {
 		return c.writeRequest(req)
 	}, func(deadline time.Time, size int) error {
-		return c.readResponse(&resp, size, req.Version())
+		return c.readResponse(req, &resp, size)
 	})
 	if err != nil {
 		return nil, err
@@ -211,7 +212,7 @@ func (c *Conn) OffsetFetch(req *protocol.OffsetFetchRequest) (*protocol.OffsetFe
 	err := c.readOperation(func(deadline time.Time, id int32) error {
 		return c.writeRequest(req)
 	}, func(deadline time.Time, size int) error {
-		return c.readResponse(&resp, size, req.Version())
+		return c.readResponse(req, &resp, size)
 	})
 	if err != nil {
 		return nil, err
@@ -225,7 +226,7 @@ func (c *Conn) FindCoordinator(req *protocol.FindCoordinatorRequest) (*protocol.
 	err := c.readOperation(func(deadline time.Time, id int32) error {
 		return c.writeRequest(req)
 	}, func(deadline time.Time, size int) error {
-		return c.readResponse(&resp, size, req.Version())
+		return c.readResponse(req, &resp, size)
 	})
 	if err != nil {
 		return nil, err
@@ -239,7 +240,7 @@ func (c *Conn) Heartbeat(req *protocol.HeartbeatRequest) (*protocol.HeartbeatRes
 	err := c.readOperation(func(deadline time.Time, id int32) error {
 		return c.writeRequest(req)
 	}, func(deadline time.Time, size int) error {
-		return c.readResponse(&resp, size, req.Version())
+		return c.readResponse(req, &resp, size)
 	})
 	if err != nil {
 		return nil, err
@@ -253,7 +254,7 @@ func (c *Conn) LeaveGroup(req *protocol.LeaveGroupRequest) (*protocol.LeaveGroup
 	err := c.readOperation(func(deadline time.Time, id int32) error {
 		return c.writeRequest(req)
 	}, func(deadline time.Time, size int) error {
-		return c.readResponse(&resp, size, req.Version())
+		return c.readResponse(req, &resp, size)
 	})
 	if err != nil {
 		return nil, err
@@ -267,7 +268,7 @@ func (c *Conn) SyncGroup(req *protocol.SyncGroupRequest) (*protocol.SyncGroupRes
 	err := c.readOperation(func(deadline time.Time, id int32) error {
 		return c.writeRequest(req)
 	}, func(deadline time.Time, size int) error {
-		return c.readResponse(&resp, size, req.Version())
+		return c.readResponse(req, &resp, size)
 	})
 	if err != nil {
 		return nil, err
@@ -281,7 +282,7 @@ func (c *Conn) DescribeGroups(req *protocol.DescribeGroupsRequest) (*protocol.De
 	err := c.readOperation(func(deadline time.Time, id int32) error {
 		return c.writeRequest(req)
 	}, func(deadline time.Time, size int) error {
-		return c.readResponse(&resp, size, req.Version())
+		return c.readResponse(req, &resp, size)
 	})
 	if err != nil {
 		return nil, err
@@ -295,7 +296,7 @@ func (c *Conn) ListGroups(req *protocol.ListGroupsRequest) (*protocol.ListGroups
 	err := c.readOperation(func(deadline time.Time, id int32) error {
 		return c.writeRequest(req)
 	}, func(deadline time.Time, size int) error {
-		return c.readResponse(&resp, size, req.Version())
+		return c.readResponse(req, &resp, size)
 	})
 	if err != nil {
 		return nil, err
@@ -309,7 +310,7 @@ func (c *Conn) APIVersions(req *protocol.APIVersionsRequest) (*protocol.APIVersi
 	err := c.readOperation(func(deadline time.Time, id int32) error {
 		return c.writeRequest(req)
 	}, func(deadline time.Time, size int) error {
-		return c.readResponse(&resp, size, req.Version())
+		return c.readResponse(req, &resp, size)
 	})
 	if err != nil {
 		return nil, err
@@ -323,7 +324,7 @@ func (c *Conn) DeleteTopics(req *protocol.DeleteTopicsRequest) (*protocol.Delete
 	err := c.readOperation(func(deadline time.Time, id int32) error {
 		return c.writeRequest(req)
 	}, func(deadline time.Time, size int) error {
-		return c.readResponse(&resp, size, req.Version())
+		return c.readResponse(req, &resp, size)
 	})
 	if err != nil {
 		return nil, err
@@ -337,7 +338,7 @@ func (c *Conn) JoinGroup(req *protocol.JoinGroupRequest) (*protocol.JoinGroupRes
 	err := c.readOperation(func(deadline time.Time, id int32) error {
 		return c.writeRequest(req)
 	}, func(deadline time.Time, size int) error {
-		return c.readResponse(&resp, size, req.Version())
+		return c.readResponse(req, &resp, size)
 	})
 	if err != nil {
 		return nil, err
@@ -351,7 +352,7 @@ func (c *Conn) Metadata(req *protocol.MetadataRequest) (*protocol.MetadataRespon
 	err := c.readOperation(func(deadline time.Time, id int32) error {
 		return c.writeRequest(req)
 	}, func(deadline time.Time, size int) error {
-		return c.readResponse(&resp, size, req.Version())
+		return c.readResponse(req, &resp, size)
 	})
 	if err != nil {
 		return nil, err
@@ -365,7 +366,241 @@ func (c *Conn) Fetch(req *protocol.FetchRequest) (*protocol.FetchResponse, error
 	err := c.readOperation(func(deadline time.Time, id int32) error {
 		return c.writeRequest(req)
 	}, func(deadline time.Time, size int) error {
-		return c.readResponse(&resp, size, req.Version())
+		return c.readResponse(req, &resp, size)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// FilteredFetch fetches only the message sets matching the request's filter, it's a jocko
+// extension Kafka brokers don't support.
+func (c *Conn) FilteredFetch(req *protocol.FilteredFetchRequest) (*protocol.FetchResponse, error) {
+	var resp protocol.FetchResponse
+	err := c.readOperation(func(deadline time.Time, id int32) error {
+		return c.writeRequest(req)
+	}, func(deadline time.Time, size int) error {
+		return c.readResponse(req, &resp, size)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// BrokerMaintenance puts a broker into or takes it out of maintenance, it's a jocko extension
+// Kafka brokers don't support.
+func (c *Conn) BrokerMaintenance(req *protocol.BrokerMaintenanceRequest) (*protocol.BrokerMaintenanceResponse, error) {
+	var resp protocol.BrokerMaintenanceResponse
+	err := c.readOperation(func(deadline time.Time, id int32) error {
+		return c.writeRequest(req)
+	}, func(deadline time.Time, size int) error {
+		return c.readResponse(req, &resp, size)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// BrokerHealth returns the broker's clock, raft progress, and disk usage, it's a jocko extension
+// Kafka brokers don't support.
+func (c *Conn) BrokerHealth(req *protocol.BrokerHealthRequest) (*protocol.BrokerHealthResponse, error) {
+	var resp protocol.BrokerHealthResponse
+	err := c.readOperation(func(deadline time.Time, id int32) error {
+		return c.writeRequest(req)
+	}, func(deadline time.Time, size int) error {
+		return c.readResponse(req, &resp, size)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DescribeQuorum returns the status of the raft quorum replicating the cluster's metadata, it's
+// a jocko extension Kafka brokers don't support. It must be sent to the controller.
+func (c *Conn) DescribeQuorum(req *protocol.DescribeQuorumRequest) (*protocol.DescribeQuorumResponse, error) {
+	var resp protocol.DescribeQuorumResponse
+	err := c.readOperation(func(deadline time.Time, id int32) error {
+		return c.writeRequest(req)
+	}, func(deadline time.Time, size int) error {
+		return c.readResponse(req, &resp, size)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// PartitionStats returns the offsets and segment counts of the partitions the broker leads, it's
+// a jocko extension Kafka brokers don't support.
+func (c *Conn) PartitionStats(req *protocol.PartitionStatsRequest) (*protocol.PartitionStatsResponse, error) {
+	var resp protocol.PartitionStatsResponse
+	err := c.readOperation(func(deadline time.Time, id int32) error {
+		return c.writeRequest(req)
+	}, func(deadline time.Time, size int) error {
+		return c.readResponse(req, &resp, size)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ReassignLostBroker reassigns a permanently lost broker's replicas to the other brokers, it's a
+// jocko extension Kafka brokers don't support. It must be sent to the controller.
+func (c *Conn) ReassignLostBroker(req *protocol.ReassignLostBrokerRequest) (*protocol.ReassignLostBrokerResponse, error) {
+	var resp protocol.ReassignLostBrokerResponse
+	err := c.writeOperation(func(deadline time.Time, id int32) error {
+		return c.writeRequest(req)
+	}, func(deadline time.Time, size int) error {
+		return c.readResponse(req, &resp, size)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// InitProducerID sends an init producer id request and returns the response.
+func (c *Conn) InitProducerID(req *protocol.InitProducerIDRequest) (*protocol.InitProducerIDResponse, error) {
+	var resp protocol.InitProducerIDResponse
+	err := c.writeOperation(func(deadline time.Time, id int32) error {
+		return c.writeRequest(req)
+	}, func(deadline time.Time, size int) error {
+		return c.readResponse(req, &resp, size)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// AddPartitionsToTxn sends an add partitions to txn request and returns the response.
+func (c *Conn) AddPartitionsToTxn(req *protocol.AddPartitionsToTxnRequest) (*protocol.AddPartitionsToTxnResponse, error) {
+	var resp protocol.AddPartitionsToTxnResponse
+	err := c.writeOperation(func(deadline time.Time, id int32) error {
+		return c.writeRequest(req)
+	}, func(deadline time.Time, size int) error {
+		return c.readResponse(req, &resp, size)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// AddOffsetsToTxn sends an add offsets to txn request and returns the response.
+func (c *Conn) AddOffsetsToTxn(req *protocol.AddOffsetsToTxnRequest) (*protocol.AddOffsetsToTxnResponse, error) {
+	var resp protocol.AddOffsetsToTxnResponse
+	err := c.writeOperation(func(deadline time.Time, id int32) error {
+		return c.writeRequest(req)
+	}, func(deadline time.Time, size int) error {
+		return c.readResponse(req, &resp, size)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// EndTxn sends an end txn request and returns the response.
+func (c *Conn) EndTxn(req *protocol.EndTxnRequest) (*protocol.EndTxnResponse, error) {
+	var resp protocol.EndTxnResponse
+	err := c.writeOperation(func(deadline time.Time, id int32) error {
+		return c.writeRequest(req)
+	}, func(deadline time.Time, size int) error {
+		return c.readResponse(req, &resp, size)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// WriteTxnMarkers sends a write txn markers request and returns the response.
+func (c *Conn) WriteTxnMarkers(req *protocol.WriteTxnMarkersRequest) (*protocol.WriteTxnMarkersResponse, error) {
+	var resp protocol.WriteTxnMarkersResponse
+	err := c.writeOperation(func(deadline time.Time, id int32) error {
+		return c.writeRequest(req)
+	}, func(deadline time.Time, size int) error {
+		return c.readResponse(req, &resp, size)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// TxnOffsetCommit sends a txn offset commit request and returns the response.
+func (c *Conn) TxnOffsetCommit(req *protocol.TxnOffsetCommitRequest) (*protocol.TxnOffsetCommitResponse, error) {
+	var resp protocol.TxnOffsetCommitResponse
+	err := c.writeOperation(func(deadline time.Time, id int32) error {
+		return c.writeRequest(req)
+	}, func(deadline time.Time, size int) error {
+		return c.readResponse(req, &resp, size)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CompactPartition compacts the partition's replica on the broker now rather than when its active
+// segment next splits, it's a jocko extension Kafka brokers don't support.
+func (c *Conn) CompactPartition(req *protocol.CompactPartitionRequest) (*protocol.CompactPartitionResponse, error) {
+	var resp protocol.CompactPartitionResponse
+	err := c.writeOperation(func(deadline time.Time, id int32) error {
+		return c.writeRequest(req)
+	}, func(deadline time.Time, size int) error {
+		return c.readResponse(req, &resp, size)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DescribeClientQuotas returns the clients' quota usage on the broker: their byte rates, throttle
+// time, and quota violations.
+func (c *Conn) DescribeClientQuotas(req *protocol.DescribeClientQuotasRequest) (*protocol.DescribeClientQuotasResponse, error) {
+	var resp protocol.DescribeClientQuotasResponse
+	err := c.readOperation(func(deadline time.Time, id int32) error {
+		return c.writeRequest(req)
+	}, func(deadline time.Time, size int) error {
+		return c.readResponse(req, &resp, size)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DescribeFeatures returns the feature levels the broker supports and the cluster's finalized
+// levels, it's a jocko extension Kafka brokers don't support.
+func (c *Conn) DescribeFeatures(req *protocol.DescribeFeaturesRequest) (*protocol.DescribeFeaturesResponse, error) {
+	var resp protocol.DescribeFeaturesResponse
+	err := c.readOperation(func(deadline time.Time, id int32) error {
+		return c.writeRequest(req)
+	}, func(deadline time.Time, size int) error {
+		return c.readResponse(req, &resp, size)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// UpdateFeatures finalizes feature levels, it's a jocko extension Kafka brokers don't support. It
+// must be sent to the controller.
+func (c *Conn) UpdateFeatures(req *protocol.UpdateFeaturesRequest) (*protocol.UpdateFeaturesResponse, error) {
+	var resp protocol.UpdateFeaturesResponse
+	err := c.writeOperation(func(deadline time.Time, id int32) error {
+		return c.writeRequest(req)
+	}, func(deadline time.Time, size int) error {
+		return c.readResponse(req, &resp, size)
 	})
 	if err != nil {
 		return nil, err
@@ -379,7 +614,7 @@ func (c *Conn) AlterConfigs(req *protocol.AlterConfigsRequest) (*protocol.AlterC
 	err := c.readOperation(func(deadline time.Time, id int32) error {
 		return c.writeRequest(req)
 	}, func(deadline time.Time, size int) error {
-		return c.readResponse(&resp, size, req.Version())
+		return c.readResponse(req, &resp, size)
 	})
 	if err != nil {
 		return nil, err
@@ -393,7 +628,7 @@ func (c *Conn) DescribeConfigs(req *protocol.DescribeConfigsRequest) (*protocol.
 	err := c.readOperation(func(deadline time.Time, id int32) error {
 		return c.writeRequest(req)
 	}, func(deadline time.Time, size int) error {
-		return c.readResponse(&resp, size, req.Version())
+		return c.readResponse(req, &resp, size)
 	})
 	if err != nil {
 		return nil, err
@@ -401,14 +636,22 @@ func (c *Conn) DescribeConfigs(req *protocol.DescribeConfigsRequest) (*protocol.
 	return &resp, nil
 }
 
-func (c *Conn) readResponse(resp protocol.VersionedDecoder, size int, version int16) error {
-	b, err := c.rbuf.Peek(size)
-	if err != nil {
+func (c *Conn) readResponse(req protocol.Body, resp protocol.VersionedDecoder, size int) error {
+	// the response's read into its own buffer, not peeked at in the conn's, since decoded byte
+	// fields like record sets alias it and would be overwritten by the next response read.
+	b := make([]byte, size)
+	if _, err := io.ReadFull(&c.rbuf, b); err != nil {
 		return err
 	}
-	err = protocol.Decode(b, resp, version)
-	c.rbuf.Discard(size)
-	return err
+	if protocol.IsFlexibleResponseHeader(req.Key(), req.Version()) {
+		// flexible response headers end in tagged fields after the correlation ID.
+		d := protocol.NewDecoder(b)
+		if _, err := d.TaggedFields(); err != nil {
+			return err
+		}
+		b = b[d.Offset():]
+	}
+	return protocol.Decode(b, resp, req.Version())
 }
 
 func (c *Conn) writeRequest(body protocol.Body) error {
@@ -472,7 +715,7 @@ func (c *Conn) doRequest(d *connDeadline, write wop) (int32, error) {
 		c.conn.Close()
 	}
 	c.wlock.Unlock()
-	return c.correlationID, nil
+	return id, err
 }
 
 func (c *Conn) waitResponse(d *connDeadline, id int32) (deadline time.Time, size int, lock *sync.Mutex, err error) {
@@ -512,7 +755,7 @@ func (c *Conn) writeDeadline() time.Time {
 func (c *Conn) peekResponseSizeAndID() (int32, int32, error) {
 	b, err := c.rbuf.Peek(8)
 	if err != nil {
-		return 0, 0, nil
+		return 0, 0, err
 	}
 	size, id := protocol.MakeInt32(b[:4]), protocol.MakeInt32(b[4:])
 	return size, id, nil
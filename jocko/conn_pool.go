@@ -0,0 +1,340 @@
+package jocko
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/travisjeffery/jocko/clock"
+	"github.com/travisjeffery/jocko/log"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+const (
+	// connProbeInterval is how often pooled connections are probed with an API versions request.
+	connProbeInterval = 10 * time.Second
+	connProbeTimeout  = 5 * time.Second
+	// connMinBackoff and connMaxBackoff bound how long a broker that couldn't be dialed is left
+	// before it's redialed, doubling with each failed dial.
+	connMinBackoff = 100 * time.Millisecond
+	connMaxBackoff = 10 * time.Second
+)
+
+// connPool keeps a connection to each broker, shared by the requests this broker sends to it.
+// Connections that fail are closed and redialed on their next use, and brokers that can't be
+// dialed are backed off.
+type connPool struct {
+	dialer *Dialer
+	lookup *brokerLookup
+	// metrics returns the broker's metrics, if set, to track request latencies in.
+	metrics func() *Metrics
+	// clock times the backoffs and probes.
+	clock clock.Clock
+	mu    sync.Mutex
+	// probed is signaled when a probe finishes with its connection.
+	probed *sync.Cond
+	conns  map[int32]*pooledConn
+	// refs counts the requests using each connection. Connections that are replaced or evicted
+	// while they're in use are closed once their requests finish.
+	refs map[*Conn]int
+}
+
+type pooledConn struct {
+	conn     *Conn
+	addr     string
+	failures uint
+	retryAt  time.Time
+	// probing is whether the connection's being probed, which has it to itself.
+	probing bool
+}
+
+func newConnPool(dialer *Dialer, lookup *brokerLookup, metrics func() *Metrics) *connPool {
+	p := &connPool{
+		dialer:  dialer,
+		lookup:  lookup,
+		metrics: metrics,
+		clock:   clock.New(),
+		conns:   make(map[int32]*pooledConn),
+		refs:    make(map[*Conn]int),
+	}
+	p.probed = sync.NewCond(&p.mu)
+	return p
+}
+
+// get returns the connection to the broker, dialing it if there isn't one, waiting for it if it's
+// being probed. The connection's used until it's released.
+func (p *connPool) get(id int32) (*Conn, error) {
+	broker := p.lookup.BrokerByID(raft.ServerID(fmt.Sprintf("%d", id)))
+	if broker == nil {
+		return nil, fmt.Errorf("unknown broker: %d", id)
+	}
+	addr := broker.PeerAddr()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pc, ok := p.conns[id]
+	if !ok {
+		pc = new(pooledConn)
+		p.conns[id] = pc
+	}
+	for pc.probing {
+		p.probed.Wait()
+	}
+	if pc.conn != nil && pc.addr == addr {
+		p.refs[pc.conn]++
+		return pc.conn, nil
+	}
+	if pc.conn != nil {
+		// the broker's moved.
+		p.retire(pc.conn)
+		pc.conn = nil
+		pc.failures = 0
+	}
+	now := p.clock.Now()
+	if now.Before(pc.retryAt) {
+		return nil, fmt.Errorf("broker %d: backing off reconnecting for %s", id, pc.retryAt.Sub(now))
+	}
+	conn, err := p.dialer.Dial("tcp", addr)
+	if err != nil {
+		backoff := connMaxBackoff
+		if pc.failures < 8 {
+			if backoff = connMinBackoff << pc.failures; backoff > connMaxBackoff {
+				backoff = connMaxBackoff
+			}
+		}
+		pc.failures++
+		pc.retryAt = now.Add(backoff)
+		return nil, err
+	}
+	pc.conn, pc.addr, pc.failures, pc.retryAt = conn, addr, 0, time.Time{}
+	p.refs[conn]++
+	return conn, nil
+}
+
+// release finishes the request's use of the connection, closing it if it's no longer pooled and
+// it was the last request using it.
+func (p *connPool) release(id int32, conn *Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.refs[conn]--; p.refs[conn] > 0 {
+		return
+	}
+	delete(p.refs, conn)
+	if pc, ok := p.conns[id]; !ok || pc.conn != conn {
+		conn.Close()
+	}
+}
+
+// retire closes the connection that's no longer pooled, or leaves it to be closed when the
+// requests using it finish. The caller must hold the lock.
+func (p *connPool) retire(conn *Conn) {
+	if p.refs[conn] == 0 {
+		conn.Close()
+	}
+}
+
+// do calls fn with the connection to the broker, tracking the request's latency under the api.
+// Connection errors close the connection so the next request redials it.
+func (p *connPool) do(id int32, api string, fn func(conn *Conn) error) error {
+	conn, err := p.get(id)
+	if err != nil {
+		return err
+	}
+	defer p.release(id, conn)
+	start := time.Now()
+	err = fn(conn)
+	if m := p.metrics(); m != nil {
+		m.InterBrokerRequestLatency.With("broker", fmt.Sprintf("%d", id), "api", api).Observe(time.Since(start).Seconds())
+	}
+	if err != nil {
+		if _, ok := err.(protocol.Error); !ok {
+			p.evict(id, conn)
+		}
+	}
+	return err
+}
+
+// evict removes the broker's connection from the pool if it's still the pooled one, closing it
+// once the requests using it finish.
+func (p *connPool) evict(id int32, conn *Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if pc, ok := p.conns[id]; ok && pc.conn == conn {
+		p.retire(pc.conn)
+		pc.conn = nil
+	}
+}
+
+// probe checks each idle pooled connection is alive, evicting those that aren't. Connections in
+// use are left alone, their requests' errors evict them, and requests wait for those being
+// probed so the probe's deadline doesn't apply to them.
+func (p *connPool) probe() {
+	p.mu.Lock()
+	pcs := make(map[int32]*pooledConn, len(p.conns))
+	for id, pc := range p.conns {
+		pcs[id] = pc
+	}
+	p.mu.Unlock()
+	for id, pc := range pcs {
+		p.mu.Lock()
+		conn := pc.conn
+		if conn == nil || p.refs[conn] > 0 {
+			p.mu.Unlock()
+			continue
+		}
+		pc.probing = true
+		p.mu.Unlock()
+		conn.SetDeadline(time.Now().Add(connProbeTimeout))
+		_, err := conn.APIVersions(&protocol.APIVersionsRequest{})
+		conn.SetDeadline(time.Time{})
+		p.mu.Lock()
+		pc.probing = false
+		p.probed.Broadcast()
+		p.mu.Unlock()
+		if err != nil {
+			log.Error.Printf("conn pool: broker %d failed liveness probe: %s", id, err)
+			p.evict(id, conn)
+		}
+	}
+}
+
+// probeLoop probes the pooled connections until the done channel's closed.
+func (p *connPool) probeLoop(done <-chan struct{}) {
+	ticker := p.clock.NewTicker(connProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C():
+			p.probe()
+		}
+	}
+}
+
+// close closes the pooled connections.
+func (p *connPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for id, pc := range p.conns {
+		if pc.conn != nil {
+			pc.conn.Close()
+		}
+		delete(p.conns, id)
+	}
+}
+
+// brokerClient sends requests to a broker over its pooled connection.
+type brokerClient struct {
+	pool *connPool
+	id   int32
+}
+
+// brokerClient returns the client for the broker with the given ID.
+func (b *Broker) brokerClient(id int32) brokerClient {
+	return brokerClient{pool: b.brokerConns, id: id}
+}
+
+func (c brokerClient) Fetch(req *protocol.FetchRequest) (res *protocol.FetchResponse, err error) {
+	err = c.pool.do(c.id, "fetch", func(conn *Conn) error {
+		res, err = conn.Fetch(req)
+		return err
+	})
+	return res, err
+}
+
+func (c brokerClient) CreateTopics(req *protocol.CreateTopicRequests) (res *protocol.CreateTopicsResponse, err error) {
+	err = c.pool.do(c.id, "create_topics", func(conn *Conn) error {
+		res, err = conn.CreateTopics(req)
+		return err
+	})
+	return res, err
+}
+
+func (c brokerClient) InitProducerID(req *protocol.InitProducerIDRequest) (res *protocol.InitProducerIDResponse, err error) {
+	err = c.pool.do(c.id, "init_producer_id", func(conn *Conn) error {
+		res, err = conn.InitProducerID(req)
+		return err
+	})
+	return res, err
+}
+
+func (c brokerClient) AddPartitionsToTxn(req *protocol.AddPartitionsToTxnRequest) (res *protocol.AddPartitionsToTxnResponse, err error) {
+	err = c.pool.do(c.id, "add_partitions_to_txn", func(conn *Conn) error {
+		res, err = conn.AddPartitionsToTxn(req)
+		return err
+	})
+	return res, err
+}
+
+func (c brokerClient) AddOffsetsToTxn(req *protocol.AddOffsetsToTxnRequest) (res *protocol.AddOffsetsToTxnResponse, err error) {
+	err = c.pool.do(c.id, "add_offsets_to_txn", func(conn *Conn) error {
+		res, err = conn.AddOffsetsToTxn(req)
+		return err
+	})
+	return res, err
+}
+
+func (c brokerClient) EndTxn(req *protocol.EndTxnRequest) (res *protocol.EndTxnResponse, err error) {
+	err = c.pool.do(c.id, "end_txn", func(conn *Conn) error {
+		res, err = conn.EndTxn(req)
+		return err
+	})
+	return res, err
+}
+
+func (c brokerClient) WriteTxnMarkers(req *protocol.WriteTxnMarkersRequest) (res *protocol.WriteTxnMarkersResponse, err error) {
+	err = c.pool.do(c.id, "write_txn_markers", func(conn *Conn) error {
+		res, err = conn.WriteTxnMarkers(req)
+		return err
+	})
+	return res, err
+}
+
+func (c brokerClient) TxnOffsetCommit(req *protocol.TxnOffsetCommitRequest) (res *protocol.TxnOffsetCommitResponse, err error) {
+	err = c.pool.do(c.id, "txn_offset_commit", func(conn *Conn) error {
+		res, err = conn.TxnOffsetCommit(req)
+		return err
+	})
+	return res, err
+}
+
+func (c brokerClient) OffsetCommit(req *protocol.OffsetCommitRequest) (res *protocol.OffsetCommitResponse, err error) {
+	err = c.pool.do(c.id, "offset_commit", func(conn *Conn) error {
+		res, err = conn.OffsetCommit(req)
+		return err
+	})
+	return res, err
+}
+
+func (c brokerClient) LeaderAndISR(req *protocol.LeaderAndISRRequest) (res *protocol.LeaderAndISRResponse, err error) {
+	err = c.pool.do(c.id, "leader_and_isr", func(conn *Conn) error {
+		res, err = conn.LeaderAndISR(req)
+		return err
+	})
+	return res, err
+}
+
+func (c brokerClient) StopReplica(req *protocol.StopReplicaRequest) (res *protocol.StopReplicaResponse, err error) {
+	err = c.pool.do(c.id, "stop_replica", func(conn *Conn) error {
+		res, err = conn.StopReplica(req)
+		return err
+	})
+	return res, err
+}
+
+func (c brokerClient) Offsets(req *protocol.OffsetsRequest) (res *protocol.OffsetsResponse, err error) {
+	err = c.pool.do(c.id, "offsets", func(conn *Conn) error {
+		res, err = conn.Offsets(req)
+		return err
+	})
+	return res, err
+}
+
+func (c brokerClient) Produce(req *protocol.ProduceRequest) (res *protocol.ProduceResponse, err error) {
+	err = c.pool.do(c.id, "produce", func(conn *Conn) error {
+		res, err = conn.Produce(req)
+		return err
+	})
+	return res, err
+}
@@ -0,0 +1,139 @@
+package jocko
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/clock"
+	"github.com/travisjeffery/jocko/jocko/metadata"
+)
+
+func TestConnPool(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	lookup := NewBrokerLookup()
+	lookup.AddBroker(&metadata.Broker{ID: 1, RaftAddr: "127.0.0.1:9093", BrokerAddr: ln.Addr().String()})
+	lookup.AddBroker(&metadata.Broker{ID: 2, RaftAddr: "127.0.0.1:9193", BrokerAddr: closedAddr})
+	p := newConnPool(NewDialer("test"), lookup, func() *Metrics { return nil })
+	defer p.close()
+
+	// connections are reused until they're evicted.
+	c1, err := p.get(1)
+	require.NoError(t, err)
+	c2, err := p.get(1)
+	require.NoError(t, err)
+	require.True(t, c1 == c2)
+	p.evict(1, c1)
+	c3, err := p.get(1)
+	require.NoError(t, err)
+	require.True(t, c1 != c3)
+
+	// brokers that can't be dialed are backed off.
+	_, err = p.get(2)
+	require.Error(t, err)
+	require.Equal(t, uint(1), p.conns[2].failures)
+	require.False(t, p.conns[2].retryAt.IsZero())
+	// push the retry out so a slow run doesn't redial.
+	p.conns[2].retryAt = time.Now().Add(time.Minute)
+	_, err = p.get(2)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "backing off")
+	require.Equal(t, uint(1), p.conns[2].failures)
+
+	_, err = p.get(3)
+	require.Error(t, err)
+}
+
+func TestConnPoolBackoff(t *testing.T) {
+	lookup := NewBrokerLookup()
+	lookup.AddBroker(&metadata.Broker{ID: 1, RaftAddr: "127.0.0.1:9093", BrokerAddr: "broker-1:9092"})
+	var dials int
+	up := false
+	d := NewDialer("test")
+	d.DialFunc = func(ctx context.Context, network, address string) (net.Conn, error) {
+		dials++
+		if !up {
+			return nil, errors.New("connection refused")
+		}
+		c, s := net.Pipe()
+		s.Close()
+		return c, nil
+	}
+	sim := clock.NewSim(time.Now())
+	p := newConnPool(d, lookup, func() *Metrics { return nil })
+	p.clock = sim
+	defer p.close()
+
+	// each failed dial doubles the backoff.
+	for i, backoff := range []time.Duration{connMinBackoff, 2 * connMinBackoff, 4 * connMinBackoff} {
+		_, err := p.get(1)
+		require.EqualError(t, err, "connection refused")
+		require.Equal(t, i+1, dials)
+
+		sim.Advance(backoff - time.Millisecond)
+		_, err = p.get(1)
+		require.Contains(t, err.Error(), "backing off")
+		require.Equal(t, i+1, dials)
+		sim.Advance(time.Millisecond)
+	}
+
+	up = true
+	_, err := p.get(1)
+	require.NoError(t, err)
+	require.Equal(t, uint(0), p.conns[1].failures)
+}
+
+func TestConnPoolInUse(t *testing.T) {
+	lookup := NewBrokerLookup()
+	lookup.AddBroker(&metadata.Broker{ID: 1, RaftAddr: "127.0.0.1:9093", BrokerAddr: "broker-1:9092"})
+	var servers []net.Conn
+	d := NewDialer("test")
+	d.DialFunc = func(ctx context.Context, network, address string) (net.Conn, error) {
+		c, s := net.Pipe()
+		servers = append(servers, s)
+		return c, nil
+	}
+	p := newConnPool(d, lookup, func() *Metrics { return nil })
+	defer p.close()
+	closed := func(s net.Conn) bool {
+		s.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		_, err := s.Read(make([]byte, 1))
+		return err == io.EOF
+	}
+
+	// evicted connections are closed once the requests using them finish.
+	c1, err := p.get(1)
+	require.NoError(t, err)
+	p.evict(1, c1)
+	require.False(t, closed(servers[0]))
+	p.release(1, c1)
+	require.True(t, closed(servers[0]))
+
+	// connections in use aren't probed, the pipe's never answered so a probe would evict it.
+	c2, err := p.get(1)
+	require.NoError(t, err)
+	p.probe()
+	require.True(t, p.conns[1].conn == c2)
+	p.release(1, c2)
+	require.False(t, closed(servers[1]))
+}
@@ -86,6 +86,7 @@ func TestConn(t *testing.T) {
 		cfg.Bootstrap = true
 		cfg.BootstrapExpect = 1
 		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
 	}, nil)
 	defer os.RemoveAll(dir)
 	err := s.Start(context.Background())
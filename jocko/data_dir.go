@@ -0,0 +1,312 @@
+package jocko
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/travisjeffery/jocko/commitlog"
+	"github.com/travisjeffery/jocko/jocko/structs"
+	"github.com/travisjeffery/jocko/log"
+)
+
+const (
+	// metaPropertiesFile is the file in the root of the data dir recording the version of its
+	// layout and the broker it belongs to.
+	metaPropertiesFile = "meta.properties"
+	// dataDirVersion is the version of the data dir layout this release reads and writes:
+	//
+	//	0: partition logs are kept in data/<partition id>, shared by the topics' partitions with
+	//	   the same ID. There's no meta.properties.
+	//	1: partition logs are kept in data/<topic>-<partition id> with a partition.metadata file
+	//	   recording the topic's ID.
+	dataDirVersion = 1
+)
+
+// dataDirMigrations migrate a data dir from the version at their index to the next.
+var dataDirMigrations = []func(dir string) error{
+	migrateDataDirV0,
+}
+
+// metaProperties is the data dir's meta.properties file.
+type metaProperties struct {
+	Version  int
+	BrokerID int32
+}
+
+// openDataDir checks the data dir belongs to the broker and was written by a release that uses a
+// layout this one can read, migrating a layout written by a previous release. Data dirs written
+// by a newer release are refused rather than risk misreading them.
+func openDataDir(dir string, brokerID int32) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	meta, err := readMetaProperties(dir)
+	if os.IsNotExist(err) {
+		meta = &metaProperties{Version: dataDirVersion, BrokerID: brokerID}
+		if used, err := dataDirUsed(dir); err != nil {
+			return err
+		} else if used {
+			// data dirs written before the layout was versioned have no meta.properties.
+			meta.Version = 0
+		}
+	} else if err != nil {
+		return err
+	}
+	if meta.BrokerID != brokerID {
+		return fmt.Errorf("data dir %s belongs to broker %d, not %d", dir, meta.BrokerID, brokerID)
+	}
+	if meta.Version > dataDirVersion {
+		return fmt.Errorf("data dir %s has layout version %d, newer than the %d this release supports: restore a backup taken before upgrading or run a newer release", dir, meta.Version, dataDirVersion)
+	}
+	for meta.Version < dataDirVersion {
+		log.Info.Printf("broker/%d: migrating data dir %s from layout version %d to %d", brokerID, dir, meta.Version, meta.Version+1)
+		if err := dataDirMigrations[meta.Version](dir); err != nil {
+			return fmt.Errorf("migrate data dir %s from layout version %d: %v", dir, meta.Version, err)
+		}
+		meta.Version++
+		// record each step so an interrupted upgrade picks up where it left off.
+		if err := writeMetaProperties(dir, meta); err != nil {
+			return err
+		}
+	}
+	return writeMetaProperties(dir, meta)
+}
+
+// dataDirUsed returns whether the data dir holds any of the broker's state.
+func dataDirUsed(dir string) (bool, error) {
+	for _, name := range []string{"data", raftState, filepath.Dir(serfLANSnapshot)} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return true, nil
+		} else if !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// migrateDataDirV0 migrates a version 0 data dir. Its partition logs can't be moved to their
+// topics' paths yet since which topics have which partitions isn't known until the raft state's
+// been restored, they're adopted as their partitions start instead.
+func migrateDataDirV0(dir string) error {
+	infos, err := ioutil.ReadDir(filepath.Join(dir, "data"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, fi := range infos {
+		if _, ok := legacyPartitionID(fi); ok {
+			log.Info.Printf("data dir %s: version 0 partition log %s is adopted when its partition starts", dir, fi.Name())
+		}
+	}
+	return nil
+}
+
+// legacyPartitionID returns the ID of the partition whose version 0 log is in the dir.
+func legacyPartitionID(fi os.FileInfo) (int32, bool) {
+	if !fi.IsDir() {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(fi.Name(), 10, 32)
+	if err != nil || id < 0 {
+		return 0, false
+	}
+	return int32(id), true
+}
+
+// adoptLegacyPartitionLog moves the partition's log left by a version 0 data dir to the
+// partition's path. Version 0 kept the logs by partition ID alone, so topics' partitions with the
+// same ID shared a log: it's only adopted if the partition's topic is the only one with the ID,
+// otherwise it's left for the operator to sort out.
+func (b *Broker) adoptLegacyPartitionLog(path string, partition structs.Partition) error {
+	legacy := filepath.Join(b.config.DataDir, "data", strconv.Itoa(int(partition.ID)))
+	if _, err := os.Stat(legacy); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	_, topics, err := b.fsm.State().GetTopics()
+	if err != nil {
+		return err
+	}
+	var sharing []string
+	for _, t := range topics {
+		if _, ok := t.Partitions[partition.ID]; ok {
+			sharing = append(sharing, t.Topic)
+		}
+	}
+	if len(sharing) != 1 {
+		log.Error.Printf("broker/%d: version 0 partition log %s is shared by topics %v: not adopting it", b.config.ID, legacy, sharing)
+		return nil
+	}
+	log.Info.Printf("broker/%d: adopting version 0 partition log %s: topic: %s, partition: %d", b.config.ID, legacy, partition.Topic, partition.ID)
+	return os.Rename(legacy, path)
+}
+
+// RepairDataDir repairs the partition and cluster metadata logs in a broker's data dir and removes
+// the temp files and dirs left by interrupted writes and deletions, so a broker can be salvaged
+// after a crash or disk failure. See commitlog.Repair for what's fixed. The broker must be
+// stopped. Nothing's changed on a dry run.
+func RepairDataDir(dir string, dryRun bool) ([]commitlog.RepairIssue, error) {
+	meta, err := readMetaProperties(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if meta != nil && meta.Version > dataDirVersion {
+		return nil, fmt.Errorf("data dir %s has layout version %d, newer than the %d this release supports: repair it with a newer release", dir, meta.Version, dataDirVersion)
+	}
+	if used, err := dataDirUsed(dir); err != nil {
+		return nil, err
+	} else if !used {
+		return nil, fmt.Errorf("%s isn't a broker's data dir", dir)
+	}
+
+	var issues []commitlog.RepairIssue
+	remove := func(path, problem string) error {
+		issues = append(issues, commitlog.RepairIssue{Path: path, Problem: problem, Fix: "removed"})
+		if dryRun {
+			return nil
+		}
+		return os.RemoveAll(path)
+	}
+	if tmp := filepath.Join(dir, metaPropertiesFile+".tmp"); fileExists(tmp) {
+		if err := remove(tmp, "temp file left by an interrupted write"); err != nil {
+			return issues, err
+		}
+	}
+
+	var logs []string
+	if path := filepath.Join(dir, clusterMetadataDir); fileExists(path) {
+		logs = append(logs, path)
+	}
+	infos, err := ioutil.ReadDir(filepath.Join(dir, "data"))
+	if err != nil && !os.IsNotExist(err) {
+		return issues, err
+	}
+	for _, fi := range infos {
+		path := filepath.Join(dir, "data", fi.Name())
+		if !fi.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(fi.Name(), commitlog.DeletedDirSuffix) {
+			if err := remove(path, "dir left by an interrupted deletion"); err != nil {
+				return issues, err
+			}
+			continue
+		}
+		logs = append(logs, path)
+	}
+	for _, path := range logs {
+		found, err := commitlog.Repair(path, dryRun)
+		issues = append(issues, found...)
+		if err != nil {
+			return issues, fmt.Errorf("repair %s: %v", path, err)
+		}
+	}
+	return issues, nil
+}
+
+// VerifyDataDir verifies the partition logs in a broker's data dir, see commitlog.Verify for the
+// invariants checked. With a topic only its partitions' logs are verified, and with a partition
+// too, not -1, only that partition's.
+func VerifyDataDir(dir, topic string, partition int32) ([]*commitlog.VerifyResult, error) {
+	var paths []string
+	if topic != "" && partition >= 0 {
+		path := filepath.Join(dir, "data", fmt.Sprintf("%s-%d", topic, partition))
+		if !fileExists(path) {
+			return nil, fmt.Errorf("no log for topic %s partition %d in %s", topic, partition, dir)
+		}
+		paths = append(paths, path)
+	} else {
+		infos, err := ioutil.ReadDir(filepath.Join(dir, "data"))
+		if err != nil {
+			return nil, err
+		}
+		for _, fi := range infos {
+			name := fi.Name()
+			if !fi.IsDir() || strings.HasSuffix(name, commitlog.DeletedDirSuffix) {
+				continue
+			}
+			if topic != "" {
+				id := strings.TrimPrefix(name, topic+"-")
+				if _, err := strconv.ParseInt(id, 10, 32); id == name || err != nil {
+					continue
+				}
+			}
+			paths = append(paths, filepath.Join(dir, "data", name))
+		}
+	}
+	results := make([]*commitlog.VerifyResult, 0, len(paths))
+	for _, path := range paths {
+		res, err := commitlog.Verify(path)
+		if err != nil {
+			return results, fmt.Errorf("verify %s: %v", path, err)
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func readMetaProperties(dir string) (*metaProperties, error) {
+	f, err := os.Open(filepath.Join(dir, metaPropertiesFile))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	meta := &metaProperties{Version: -1, BrokerID: -1}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("%s: bad line: %q", metaPropertiesFile, line)
+		}
+		switch strings.TrimSpace(kv[0]) {
+		case "version":
+			if meta.Version, err = strconv.Atoi(strings.TrimSpace(kv[1])); err != nil {
+				return nil, fmt.Errorf("%s: bad version: %v", metaPropertiesFile, err)
+			}
+		case "broker.id":
+			id, err := strconv.ParseInt(strings.TrimSpace(kv[1]), 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("%s: bad broker.id: %v", metaPropertiesFile, err)
+			}
+			meta.BrokerID = int32(id)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if meta.Version < 0 || meta.BrokerID < 0 {
+		return nil, fmt.Errorf("%s: version and broker.id are required", metaPropertiesFile)
+	}
+	return meta, nil
+}
+
+// writeMetaProperties replaces the data dir's meta.properties, writing it to a temp file first so
+// a crash doesn't leave it half written.
+func writeMetaProperties(dir string, meta *metaProperties) error {
+	path := filepath.Join(dir, metaPropertiesFile)
+	tmp := path + ".tmp"
+	data := fmt.Sprintf("version=%d\nbroker.id=%d\n", meta.Version, meta.BrokerID)
+	if err := ioutil.WriteFile(tmp, []byte(data), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
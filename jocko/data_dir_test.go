@@ -0,0 +1,190 @@
+package jocko
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/commitlog"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestOpenDataDir(t *testing.T) {
+	req := require.New(t)
+	tmp, err := ioutil.TempDir("", "data_dir_test")
+	req.NoError(err)
+	defer os.RemoveAll(tmp)
+
+	// new data dirs are written at the current version.
+	dir := filepath.Join(tmp, "new")
+	req.NoError(openDataDir(dir, 1))
+	meta, err := readMetaProperties(dir)
+	req.NoError(err)
+	req.Equal(&metaProperties{Version: dataDirVersion, BrokerID: 1}, meta)
+	req.NoError(openDataDir(dir, 1))
+	req.Error(openDataDir(dir, 2))
+
+	// data dirs written before the layout was versioned are migrated.
+	dir = filepath.Join(tmp, "v0")
+	req.NoError(os.MkdirAll(filepath.Join(dir, "data", "0"), 0755))
+	req.NoError(openDataDir(dir, 1))
+	meta, err = readMetaProperties(dir)
+	req.NoError(err)
+	req.Equal(&metaProperties{Version: dataDirVersion, BrokerID: 1}, meta)
+	_, err = os.Stat(filepath.Join(dir, "data", "0"))
+	req.NoError(err)
+
+	// data dirs written by a newer release are refused.
+	dir = filepath.Join(tmp, "newer")
+	req.NoError(os.MkdirAll(dir, 0755))
+	req.NoError(writeMetaProperties(dir, &metaProperties{Version: dataDirVersion + 1, BrokerID: 1}))
+	err = openDataDir(dir, 1)
+	req.Error(err)
+	req.Contains(err.Error(), "newer than")
+
+	req.NoError(ioutil.WriteFile(filepath.Join(dir, metaPropertiesFile), []byte("broker.id=1\n"), 0644))
+	req.Error(openDataDir(dir, 1))
+}
+
+func TestRepairDataDir(t *testing.T) {
+	req := require.New(t)
+	dir, err := ioutil.TempDir("", "data_dir_test")
+	req.NoError(err)
+	defer os.RemoveAll(dir)
+
+	_, err = RepairDataDir(dir, false)
+	req.Error(err)
+
+	req.NoError(openDataDir(dir, 1))
+	l, err := commitlog.New(commitlog.Options{Path: filepath.Join(dir, "data", "topic-0"), MaxSegmentBytes: 1024, MaxLogBytes: -1})
+	req.NoError(err)
+	set, err := protocol.Encode(&protocol.MessageSet{Messages: []*protocol.Message{{Value: []byte("v")}}})
+	req.NoError(err)
+	_, err = l.Append(set)
+	req.NoError(err)
+	req.NoError(l.Close())
+	issues, err := RepairDataDir(dir, false)
+	req.NoError(err)
+	req.Empty(issues)
+
+	// a deletion and writes interrupted by a crash.
+	deleted := filepath.Join(dir, "data", "old-0"+commitlog.DeletedDirSuffix)
+	req.NoError(os.MkdirAll(deleted, 0755))
+	req.NoError(ioutil.WriteFile(filepath.Join(dir, metaPropertiesFile+".tmp"), nil, 0644))
+	f, err := os.OpenFile(filepath.Join(dir, "data", "topic-0", "00000000000000000000.log"), os.O_APPEND|os.O_WRONLY, 0644)
+	req.NoError(err)
+	_, err = f.Write(set[:len(set)-1])
+	req.NoError(err)
+	req.NoError(f.Close())
+
+	issues, err = RepairDataDir(dir, false)
+	req.NoError(err)
+	req.Len(issues, 3)
+	for _, i := range issues {
+		req.NotEmpty(i.Fix)
+	}
+	_, err = os.Stat(deleted)
+	req.True(os.IsNotExist(err))
+	issues, err = RepairDataDir(dir, false)
+	req.NoError(err)
+	req.Empty(issues)
+}
+
+func TestVerifyDataDir(t *testing.T) {
+	req := require.New(t)
+	dir, err := ioutil.TempDir("", "data_dir_test")
+	req.NoError(err)
+	defer os.RemoveAll(dir)
+	set, err := protocol.Encode(&protocol.MessageSet{Messages: []*protocol.Message{{Value: []byte("v")}}})
+	req.NoError(err)
+	for _, name := range []string{"topic-0", "topic-1", "other-0", "old-0" + commitlog.DeletedDirSuffix} {
+		l, err := commitlog.New(commitlog.Options{Path: filepath.Join(dir, "data", name), MaxSegmentBytes: 1024, MaxLogBytes: -1})
+		req.NoError(err)
+		_, err = l.Append(set)
+		req.NoError(err)
+		req.NoError(l.Close())
+	}
+
+	results, err := VerifyDataDir(dir, "", -1)
+	req.NoError(err)
+	req.Len(results, 3)
+	results, err = VerifyDataDir(dir, "topic", -1)
+	req.NoError(err)
+	req.Len(results, 2)
+	results, err = VerifyDataDir(dir, "topic", 1)
+	req.NoError(err)
+	req.Len(results, 1)
+	req.Equal(filepath.Join(dir, "data", "topic-1"), results[0].Path)
+	req.True(results[0].Valid())
+	_, err = VerifyDataDir(dir, "topic", 2)
+	req.Error(err)
+}
+
+func TestBroker_UpgradeDataDirV0(t *testing.T) {
+	values := []string{"a", "b", "c"}
+	s, dir := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+
+		// write the partition's log where the previous release kept it.
+		l, err := commitlog.New(commitlog.Options{
+			Path:            filepath.Join(cfg.DataDir, "data", "0"),
+			MaxSegmentBytes: 1024,
+			MaxLogBytes:     -1,
+		})
+		require.NoError(t, err)
+		for _, v := range values {
+			set, err := protocol.Encode(&protocol.MessageSet{Messages: []*protocol.Message{{Value: []byte(v)}}})
+			require.NoError(t, err)
+			_, err = l.Append(set)
+			require.NoError(t, err)
+		}
+		require.NoError(t, l.Close())
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+
+	meta, err := readMetaProperties(dir)
+	require.NoError(t, err)
+	require.Equal(t, dataDirVersion, meta.Version)
+
+	conn, err := Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	CreateTopic(t, conn, "upgraded", 1, 1)
+	WaitForTopicLeader(t, "upgraded", 0, s)
+
+	// the topic's the only one with partition 0 so it adopts the old log.
+	_, err = os.Stat(filepath.Join(dir, "data", "0"))
+	require.True(t, os.IsNotExist(err))
+	res, err := conn.Fetch(&protocol.FetchRequest{
+		MaxWaitTime: time.Second,
+		MinBytes:    1,
+		Topics: []*protocol.FetchTopic{{
+			Topic:      "upgraded",
+			Partitions: []*protocol.FetchPartition{{Partition: 0, MaxBytes: 1 << 20}},
+		}},
+	})
+	require.NoError(t, err)
+	p := res.Responses[0].PartitionResponses[0]
+	require.Equal(t, protocol.ErrNone.Code(), p.ErrorCode)
+	var got []string
+	for set := p.RecordSet; len(set) >= 12; {
+		n := 12 + int(protocol.Encoding.Uint32(set[8:12]))
+		ms := new(protocol.MessageSet)
+		require.NoError(t, ms.Decode(protocol.NewDecoder(set[:n])))
+		for _, m := range ms.Messages {
+			got = append(got, string(m.Value))
+		}
+		set = set[n:]
+	}
+	require.Equal(t, values, got)
+}
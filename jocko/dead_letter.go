@@ -0,0 +1,125 @@
+package jocko
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/travisjeffery/jocko/jocko/structs"
+	"github.com/travisjeffery/jocko/log"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+const deadLetterQueueConfig = "dead.letter.queue.enable"
+
+// deadLetterTopic returns the name of the topic the records rejected from the topic are written to.
+func deadLetterTopic(topic string) string {
+	return topic + ".dlq"
+}
+
+func deadLetterQueueEnabled(t *structs.Topic) bool {
+	return t.Config.GetString(deadLetterQueueConfig) == "true"
+}
+
+// deadLetter is the value of a record written to a dead letter queue. The message format doesn't
+// have headers so the error metadata wraps the rejected record's value.
+type deadLetter struct {
+	Topic     string    `json:"topic"`
+	Partition int32     `json:"partition"`
+	ErrorCode int16     `json:"error_code"`
+	Error     string    `json:"error"`
+	Timestamp time.Time `json:"timestamp"`
+	Value     []byte    `json:"value"`
+}
+
+// deadLetters is a record set of dead letters queued to be written to the topic.
+type deadLetters struct {
+	topic string
+	set   []byte
+}
+
+// queueDeadLetters queues the records rejected from the topic's partition to be written to the
+// topic's dead letter queue, so producers can debug their payloads. They're written in the
+// background so the produce isn't held up, and dropped if too many are queued.
+func (b *Broker) queueDeadLetters(topic string, partition int32, recordSet []byte, reason protocol.Error) error {
+	rejected, err := protocol.DecodeRecords(recordSet)
+	if err != nil || len(rejected) == 0 {
+		// keep the set whole if it can't be split into its records.
+		rejected = []*protocol.Record{{Value: recordSet}}
+	}
+	now := b.clock.Now()
+	ms := new(protocol.MessageSet)
+	for _, m := range rejected {
+		value, err := json.Marshal(deadLetter{
+			Topic:     topic,
+			Partition: partition,
+			ErrorCode: reason.Code(),
+			Error:     reason.Error(),
+			Timestamp: now,
+			Value:     m.Value,
+		})
+		if err != nil {
+			return err
+		}
+		ms.Messages = append(ms.Messages, &protocol.Message{Key: m.Key, Value: value})
+	}
+	// the records are encoded before they're queued since the request's buffer is reused once
+	// it's answered.
+	set, err := protocol.Encode(ms)
+	if err != nil {
+		return err
+	}
+	select {
+	case b.deadLetters <- deadLetters{topic: deadLetterTopic(topic), set: set}:
+		return nil
+	default:
+		return fmt.Errorf("dead letter queue full, dropped %d records", len(rejected))
+	}
+}
+
+// deadLetterLoop writes the queued dead letters to their dead letter queues.
+func (b *Broker) deadLetterLoop() {
+	for {
+		select {
+		case d := <-b.deadLetters:
+			if err := b.produceDeadLetters(d); err != nil {
+				log.Error.Printf("broker/%d: produce to dead letter queue error: topic: %s: %s", b.config.ID, d.topic, err)
+			}
+		case <-b.shutdownCh:
+			return
+		}
+	}
+}
+
+// produceDeadLetters writes the dead letters to their dead letter queue's partition, via its
+// leader.
+func (b *Broker) produceDeadLetters(d deadLetters) error {
+	_, p, err := b.fsm.State().GetPartition(d.topic, 0)
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		return fmt.Errorf("unknown dead letter queue: %s", d.topic)
+	}
+	req := &protocol.ProduceRequest{
+		APIVersion: 2,
+		Timeout:    5 * time.Second,
+		TopicData: []*protocol.TopicData{{
+			Topic: d.topic,
+			Data:  []*protocol.Data{{Partition: p.ID, RecordSet: d.set}},
+		}},
+	}
+	var res *protocol.ProduceResponse
+	if p.Leader == b.config.ID {
+		res = b.handleProduce(&Context{parent: context.Background(), header: &protocol.RequestHeader{}}, req)
+	} else {
+		if res, err = b.brokerClient(p.Leader).Produce(req); err != nil {
+			return err
+		}
+	}
+	if code := res.Responses[0].PartitionResponses[0].ErrorCode; code != protocol.ErrNone.Code() {
+		return protocol.Errs[code]
+	}
+	return nil
+}
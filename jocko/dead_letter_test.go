@@ -0,0 +1,85 @@
+package jocko
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestBroker_DeadLetterQueue(t *testing.T) {
+	s, dir := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+	b := s.handler.(*Broker)
+	b.SetRecordValidator("dlq-topic", RecordValidatorFunc(func(topic string, key, value []byte) error {
+		if string(value) == "bad" {
+			return errors.New("bad value")
+		}
+		return nil
+	}))
+
+	conn, err := Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	enable, invalid := "true", "yes"
+	CreateTopicWithConfigs(t, conn, "dlq-topic", 1, 1, map[string]*string{"dead.letter.queue.enable": &enable})
+	res, err := conn.CreateTopics(&protocol.CreateTopicRequests{
+		Timeout: time.Second,
+		Requests: []*protocol.CreateTopicRequest{{
+			Topic:             "invalid-config-topic",
+			NumPartitions:     1,
+			ReplicationFactor: 1,
+			Configs:           map[string]*string{"dead.letter.queue.enable": &invalid},
+		}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrInvalidConfig.Code(), res.TopicErrorCodes[0].ErrorCode)
+
+	set, err := protocol.Encode(&protocol.MessageSet{Messages: []*protocol.Message{{Key: []byte("k"), Value: []byte("bad")}}})
+	require.NoError(t, err)
+	pres, err := conn.Produce(&protocol.ProduceRequest{
+		APIVersion: 2,
+		Timeout:    time.Second,
+		TopicData: []*protocol.TopicData{{
+			Topic: "dlq-topic",
+			Data:  []*protocol.Data{{Partition: 0, RecordSet: set}},
+		}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrInvalidRecord.Code(), pres.Responses[0].PartitionResponses[0].ErrorCode)
+
+	fres, err := conn.Fetch(&protocol.FetchRequest{
+		MaxWaitTime: time.Second,
+		MinBytes:    1,
+		Topics: []*protocol.FetchTopic{{
+			Topic:      "dlq-topic.dlq",
+			Partitions: []*protocol.FetchPartition{{Partition: 0, MaxBytes: 1 << 20}},
+		}},
+	})
+	require.NoError(t, err)
+	fpres := fres.Responses[0].PartitionResponses[0]
+	require.Equal(t, protocol.ErrNone.Code(), fpres.ErrorCode)
+	ms := new(protocol.MessageSet)
+	require.NoError(t, ms.Decode(protocol.NewDecoder(fpres.RecordSet)))
+	require.Equal(t, 1, len(ms.Messages))
+	require.Equal(t, []byte("k"), ms.Messages[0].Key)
+	var letter deadLetter
+	require.NoError(t, json.Unmarshal(ms.Messages[0].Value, &letter))
+	require.Equal(t, "dlq-topic", letter.Topic)
+	require.Equal(t, protocol.ErrInvalidRecord.Code(), letter.ErrorCode)
+	require.Equal(t, []byte("bad"), letter.Value)
+}
@@ -0,0 +1,74 @@
+package jocko
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/protocol"
+	"github.com/travisjeffery/jocko/testutil"
+)
+
+func TestBroker_DebuggingFetch(t *testing.T) {
+	c := NewTestCluster(t, TestClusterOptions{Brokers: 2})
+	defer c.Shutdown()
+	conn, err := Dial("tcp", c.Leader(t).Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	res, err := conn.CreateTopics(&protocol.CreateTopicRequests{
+		Timeout:  5 * time.Second,
+		Requests: []*protocol.CreateTopicRequest{{Topic: "debug", NumPartitions: 1, ReplicationFactor: 2}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrNone.Code(), res.TopicErrorCodes[0].ErrorCode)
+	leader := c.WaitForTopicLeader(t, "debug", 0)
+	follower := c.Servers[0]
+	if follower == leader {
+		follower = c.Servers[1]
+	}
+
+	lconn, err := Dial("tcp", leader.Addr().String())
+	require.NoError(t, err)
+	defer lconn.Close()
+	set, err := protocol.Encode(&protocol.MessageSet{Messages: []*protocol.Message{{Value: []byte("v")}}})
+	require.NoError(t, err)
+	pres, err := lconn.Produce(&protocol.ProduceRequest{
+		APIVersion: 2,
+		Timeout:    time.Second,
+		TopicData:  []*protocol.TopicData{{Topic: "debug", Data: []*protocol.Data{{Partition: 0, RecordSet: set}}}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrNone.Code(), pres.Responses[0].PartitionResponses[0].ErrorCode)
+
+	fconn, err := Dial("tcp", follower.Addr().String())
+	require.NoError(t, err)
+	defer fconn.Close()
+	fetch := func(replicaID int32) *protocol.FetchPartitionResponse {
+		res, err := fconn.Fetch(&protocol.FetchRequest{
+			APIVersion: 5,
+			ReplicaID:  replicaID,
+			MinBytes:   1,
+			Topics: []*protocol.FetchTopic{{
+				Topic:      "debug",
+				Partitions: []*protocol.FetchPartition{{Partition: 0, MaxBytes: 1 << 20}},
+			}},
+		})
+		require.NoError(t, err)
+		return res.Responses[0].PartitionResponses[0]
+	}
+	// consumers fetch from the leader, debugging fetches read the follower's replica.
+	require.Equal(t, protocol.ErrNotLeaderForPartition.Code(), fetch(-1).ErrorCode)
+	testutil.WaitForResult(func() (bool, error) {
+		fpres := fetch(protocol.DebuggingReplicaID)
+		if fpres.ErrorCode != protocol.ErrNone.Code() || len(fpres.RecordSet) == 0 {
+			return false, fmt.Errorf("debugging fetch: error code: %d, %d bytes", fpres.ErrorCode, len(fpres.RecordSet))
+		}
+		records, err := protocol.DecodeRecords(fpres.RecordSet)
+		require.NoError(t, err)
+		require.Equal(t, []byte("v"), records[0].Value)
+		return true, nil
+	}, func(err error) {
+		t.Fatalf("err: %v", err)
+	})
+}
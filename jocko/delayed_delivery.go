@@ -0,0 +1,97 @@
+package jocko
+
+import (
+	"sync"
+	"time"
+
+	"github.com/travisjeffery/jocko/jocko/structs"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+const deliveryDelayConfig = "delivery.delay.ms"
+
+// deliveryDelay returns how long after being appended the topic's records become visible to
+// consumers.
+func deliveryDelay(t *structs.Topic) time.Duration {
+	ms, ok := t.Config.GetInt(deliveryDelayConfig)
+	if !ok || ms <= 0 {
+		return 0
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// visibility tracks when the offsets appended to a delayed delivery partition become visible to
+// consumers. It's kept in memory by the leader, so after a leader change the records appended
+// before it are visible right away.
+type visibility struct {
+	mu      sync.Mutex
+	pending []pendingOffset
+}
+
+type pendingOffset struct {
+	offset    int64
+	visibleAt time.Time
+}
+
+// add records that the offset becomes visible at the time. Offsets must be added in order.
+func (v *visibility) add(offset int64, visibleAt time.Time) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.pending = append(v.pending, pendingOffset{offset: offset, visibleAt: visibleAt})
+}
+
+// visibleOffset returns the first offset not visible yet at the time, or newest if every offset is
+// visible.
+func (v *visibility) visibleOffset(newest int64, now time.Time) int64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	i := 0
+	for i < len(v.pending) && !v.pending[i].visibleAt.After(now) {
+		i++
+	}
+	v.pending = v.pending[i:]
+	if len(v.pending) == 0 {
+		return newest
+	}
+	return v.pending[0].offset
+}
+
+// delayDelivery hides the offset just appended to the replica from consumers until the given
+// time.
+func (r *Replica) delayDelivery(offset int64, until time.Time) {
+	r.Lock()
+	if r.visibility == nil {
+		r.visibility = new(visibility)
+	}
+	v := r.visibility
+	r.Unlock()
+	v.add(offset, until)
+}
+
+// visibleOffset returns the first offset in the replica's log consumers can't see yet as of now.
+func (r *Replica) visibleOffset(newest int64, now time.Time) int64 {
+	r.Lock()
+	v := r.visibility
+	r.Unlock()
+	if v == nil {
+		return newest
+	}
+	return v.visibleOffset(newest, now)
+}
+
+// truncateRecordSet returns the message sets in the record set before the offset.
+func truncateRecordSet(recordSet []byte, offset int64) []byte {
+	const headerLen = 12 // offset and size
+	var n int
+	for len(recordSet)-n >= headerLen {
+		if int64(protocol.Encoding.Uint64(recordSet[n:n+8])) >= offset {
+			break
+		}
+		n += headerLen + int(protocol.Encoding.Uint32(recordSet[n+8:n+headerLen]))
+	}
+	if n > len(recordSet) {
+		// keep the partial trailing message set.
+		n = len(recordSet)
+	}
+	return recordSet[:n]
+}
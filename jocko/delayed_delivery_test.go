@@ -0,0 +1,39 @@
+package jocko
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestVisibility(t *testing.T) {
+	now := time.Now()
+	v := new(visibility)
+	require.Equal(t, int64(3), v.visibleOffset(3, now))
+
+	v.add(3, now.Add(time.Second))
+	v.add(4, now.Add(2*time.Second))
+	require.Equal(t, int64(3), v.visibleOffset(5, now))
+	require.Equal(t, int64(4), v.visibleOffset(5, now.Add(time.Second)))
+	require.Equal(t, int64(5), v.visibleOffset(5, now.Add(3*time.Second)))
+}
+
+func TestTruncateRecordSet(t *testing.T) {
+	var recordSet []byte
+	for offset := int64(0); offset < 3; offset++ {
+		b, err := protocol.Encode(&protocol.MessageSet{Offset: offset, Messages: []*protocol.Message{{Value: []byte("v")}}})
+		require.NoError(t, err)
+		recordSet = append(recordSet, b...)
+	}
+	setLen := len(recordSet) / 3
+
+	require.Equal(t, 0, len(truncateRecordSet(recordSet, 0)))
+	require.Equal(t, recordSet[:2*setLen], truncateRecordSet(recordSet, 2))
+	require.Equal(t, recordSet, truncateRecordSet(recordSet, 3))
+	// partial trailing message sets are kept.
+	partial := recordSet[:2*setLen+14]
+	require.Equal(t, partial, truncateRecordSet(partial, 3))
+	require.Equal(t, recordSet[:2*setLen], truncateRecordSet(partial, 2))
+}
@@ -0,0 +1,122 @@
+package jocko
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/travisjeffery/jocko/jocko/structs"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+// readOnlyConfig freezes a topic, e.g. while it's migrated or after an incident: produces to it
+// are rejected while it's still fetched from.
+const readOnlyConfig = "read.only"
+
+func readOnly(t *structs.Topic) bool {
+	return t.Config.GetString(readOnlyConfig) == "true"
+}
+
+func (b *Broker) handleDescribeConfigs(ctx *Context, req *protocol.DescribeConfigsRequest) *protocol.DescribeConfigsResponse {
+	sp := span(ctx, b.tracer, "describe configs")
+	defer sp.Finish()
+	res := &protocol.DescribeConfigsResponse{APIVersion: req.Version()}
+	res.Resources = make([]protocol.DescribeConfigsResourceResponse, len(req.Resources))
+	for i, r := range req.Resources {
+		res.Resources[i] = protocol.DescribeConfigsResourceResponse{Type: r.Type, Name: r.Name}
+		err := protocol.ErrNone
+		if r.Type != protocol.TopicResourceType {
+			err = protocol.ErrInvalidRequest.WithErr(fmt.Errorf("unsupported resource type: %d", r.Type))
+		} else {
+			res.Resources[i].ConfigEntries, err = b.describeTopicConfig(r, req.IncludeSynonyms)
+		}
+		res.Resources[i].ErrorCode = err.Code()
+		if err != protocol.ErrNone {
+			msg := err.Error()
+			res.Resources[i].ErrorMessage = &msg
+		}
+	}
+	return res
+}
+
+// describeTopicConfig returns the topic's config entries sorted by name, those named by the
+// resource or all of them if it names none.
+func (b *Broker) describeTopicConfig(r protocol.DescribeConfigsResource, includeSynonyms bool) ([]protocol.DescribeConfigsEntry, protocol.Error) {
+	_, t, err := b.fsm.State().GetTopic(r.Name)
+	if err != nil {
+		return nil, protocol.ErrUnknown.WithErr(err)
+	}
+	if t == nil {
+		return nil, protocol.ErrUnknownTopicOrPartition
+	}
+	// topics registered before an entry was added don't have it, so it's described with its
+	// default.
+	cfg := structs.NewTopicConfig()
+	for name, e := range t.Config {
+		if _, ok := cfg[name]; ok {
+			cfg[name] = e
+		}
+	}
+	names := r.ConfigNames
+	if len(names) == 0 {
+		for name := range cfg {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	entries := make([]protocol.DescribeConfigsEntry, 0, len(names))
+	for _, name := range names {
+		e, ok := cfg[name]
+		if !ok {
+			continue
+		}
+		entry := protocol.DescribeConfigsEntry{
+			Name:      name,
+			Value:     configString(cfg.GetValue(name)),
+			IsDefault: e.Value == nil,
+		}
+		// the broker's config overrides the entry's default.
+		broker := b.brokerConfigValue(name)
+		if e.Value == nil && broker != nil {
+			entry.Value = configString(broker)
+		}
+		if includeSynonyms {
+			if e.Value != nil {
+				entry.Synonyms = append(entry.Synonyms, protocol.DescribeConfigsSynonym{Name: name, Value: configString(e.Value), Source: protocol.TopicConfigSource})
+			}
+			if broker != nil {
+				entry.Synonyms = append(entry.Synonyms, protocol.DescribeConfigsSynonym{Name: e.ServerDefault, Value: configString(broker), Source: protocol.StaticBrokerConfigSource})
+			}
+			if e.Default != nil {
+				entry.Synonyms = append(entry.Synonyms, protocol.DescribeConfigsSynonym{Name: name, Value: configString(e.Default), Source: protocol.DefaultConfigSource})
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, protocol.ErrNone
+}
+
+// brokerConfigValue returns the broker's value of the topic config, nil if the broker doesn't
+// set it.
+func (b *Broker) brokerConfigValue(name string) interface{} {
+	switch name {
+	case minInsyncReplicasConfig:
+		return b.config.MinInsyncReplicas
+	}
+	return nil
+}
+
+// configString returns a config value as sent in responses, nil if it isn't set.
+func configString(v interface{}) *string {
+	var s string
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		s = fmt.Sprint(v)
+	}
+	return &s
+}
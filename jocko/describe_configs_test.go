@@ -0,0 +1,101 @@
+package jocko
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestBroker_ReadOnlyTopic(t *testing.T) {
+	s, dir := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+
+	conn, err := Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	CreateTopic(t, conn, "frozen", 1, 1)
+	WaitForTopicLeader(t, "frozen", 0, s)
+
+	set, err := protocol.Encode(&protocol.MessageSet{Messages: []*protocol.Message{{Value: []byte("v")}}})
+	require.NoError(t, err)
+	produce := func() int16 {
+		res, err := conn.Produce(&protocol.ProduceRequest{
+			APIVersion: 2,
+			Timeout:    time.Second,
+			TopicData:  []*protocol.TopicData{{Topic: "frozen", Data: []*protocol.Data{{Partition: 0, RecordSet: set}}}},
+		})
+		require.NoError(t, err)
+		return res.Responses[0].PartitionResponses[0].ErrorCode
+	}
+	require.Equal(t, protocol.ErrNone.Code(), produce())
+
+	describe := func(names ...string) protocol.DescribeConfigsResourceResponse {
+		res, err := conn.DescribeConfigs(&protocol.DescribeConfigsRequest{
+			APIVersion:      1,
+			Resources:       []protocol.DescribeConfigsResource{{Type: protocol.TopicResourceType, Name: "frozen", ConfigNames: names}},
+			IncludeSynonyms: true,
+		})
+		require.NoError(t, err)
+		require.Len(t, res.Resources, 1)
+		return res.Resources[0]
+	}
+	all := describe()
+	require.Equal(t, protocol.ErrNone.Code(), all.ErrorCode)
+	require.True(t, len(all.ConfigEntries) > 1)
+	readOnly := describe(readOnlyConfig)
+	require.Len(t, readOnly.ConfigEntries, 1)
+	require.Equal(t, "false", *readOnly.ConfigEntries[0].Value)
+	require.True(t, readOnly.ConfigEntries[0].IsDefault)
+
+	value := "true"
+	alter, err := conn.AlterConfigs(&protocol.AlterConfigsRequest{
+		Resources: []protocol.AlterConfigsResource{{
+			Type:    protocol.TopicResourceType,
+			Name:    "frozen",
+			Entries: []protocol.AlterConfigsEntry{{Name: readOnlyConfig, Value: &value}},
+		}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrNone.Code(), alter.Resources[0].ErrorCode)
+
+	readOnly = describe(readOnlyConfig)
+	require.Equal(t, "true", *readOnly.ConfigEntries[0].Value)
+	require.False(t, readOnly.ConfigEntries[0].IsDefault)
+	require.Equal(t, []protocol.DescribeConfigsSynonym{
+		{Name: readOnlyConfig, Value: &value, Source: protocol.TopicConfigSource},
+		{Name: readOnlyConfig, Value: readOnly.ConfigEntries[0].Synonyms[1].Value, Source: protocol.DefaultConfigSource},
+	}, readOnly.ConfigEntries[0].Synonyms)
+
+	// produces are rejected while the records produced before the freeze are still fetched.
+	require.Equal(t, protocol.ErrPolicyViolation.Code(), produce())
+	res, err := conn.Fetch(&protocol.FetchRequest{
+		MaxWaitTime: time.Second,
+		MinBytes:    1,
+		Topics: []*protocol.FetchTopic{{
+			Topic:      "frozen",
+			Partitions: []*protocol.FetchPartition{{Partition: 0, FetchOffset: 0, MaxBytes: 1 << 20}},
+		}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrNone.Code(), res.Responses[0].PartitionResponses[0].ErrorCode)
+	require.NotEmpty(t, res.Responses[0].PartitionResponses[0].RecordSet)
+
+	missing, err := conn.DescribeConfigs(&protocol.DescribeConfigsRequest{
+		Resources: []protocol.DescribeConfigsResource{{Type: protocol.TopicResourceType, Name: "missing"}, {Type: protocol.BrokerResourceType, Name: "1"}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrUnknownTopicOrPartition.Code(), missing.Resources[0].ErrorCode)
+	require.Equal(t, protocol.ErrInvalidRequest.Code(), missing.Resources[1].ErrorCode)
+}
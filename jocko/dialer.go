@@ -40,6 +40,11 @@ type Dialer struct {
 	DualStack bool
 	// SASL enables SASL plain authentication.
 	SASL *SASL
+	// DialFunc, if set, opens the connections in place of a net.Dialer, e.g. to connect brokers
+	// over in-memory pipes in tests.
+	DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+	// tcp, if set, tunes the dialed connections' sockets.
+	tcp *tcpOptions
 }
 
 var (
@@ -104,15 +109,26 @@ func (d *Dialer) dialContext(ctx context.Context, network, address string) (conn
 			address = net.JoinHostPort(address, port)
 		}
 	}
-	conn, err = (&net.Dialer{
-		LocalAddr:     d.LocalAddr,
-		FallbackDelay: d.FallbackDelay,
-		KeepAlive:     d.KeepAlive,
-	}).DialContext(ctx, network, address)
+	if d.DialFunc != nil {
+		conn, err = d.DialFunc(ctx, network, address)
+	} else {
+		conn, err = (&net.Dialer{
+			LocalAddr:     d.LocalAddr,
+			FallbackDelay: d.FallbackDelay,
+			KeepAlive:     d.KeepAlive,
+		}).DialContext(ctx, network, address)
+	}
 	if err != nil {
 		return
 	}
 
+	if d.tcp != nil {
+		if err = d.tcp.apply(conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
 	if d.TLS != nil {
 		conn, err = d.connectTLS(ctx, conn)
 		if err != nil {
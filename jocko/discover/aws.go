@@ -0,0 +1,170 @@
+package discover
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/travisjeffery/jocko/sigv4"
+)
+
+// metadataURL is the EC2 instance metadata service, replaced in tests.
+var metadataURL = "http://169.254.169.254/latest"
+
+var awsClient = &http.Client{Timeout: 10 * time.Second}
+
+// EC2 lists the running instances tagged with the tag_key arg set to the tag_value arg in the
+// region arg, AWS_REGION, or the instance's region. The instances' private IPs with the port arg
+// are the addresses. The credentials are the access_key_id and secret_access_key args, the
+// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY env vars, or the instance's role, which needs to be
+// allowed to ec2:DescribeInstances. The endpoint arg overrides the region's EC2 endpoint.
+func EC2(args map[string]string) ([]string, error) {
+	key, value := args["tag_key"], args["tag_value"]
+	if key == "" || value == "" {
+		return nil, errors.New("tag_key and tag_value are required")
+	}
+	region := args["region"]
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		r, err := instanceMetadata("placement/region")
+		if err != nil {
+			return nil, fmt.Errorf("region isn't set and the instance's is unknown: %v", err)
+		}
+		region = r
+	}
+	creds, err := ec2Credentials(args)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := args["endpoint"]
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://ec2.%s.amazonaws.com", region)
+	}
+
+	var addrs []string
+	var next string
+	for {
+		q := url.Values{
+			"Action":           {"DescribeInstances"},
+			"Version":          {"2016-11-15"},
+			"Filter.1.Name":    {"tag:" + key},
+			"Filter.1.Value.1": {value},
+			"Filter.2.Name":    {"instance-state-name"},
+			"Filter.2.Value.1": {"running"},
+		}
+		if next != "" {
+			q.Set("NextToken", next)
+		}
+		req, err := http.NewRequest("GET", strings.TrimSuffix(endpoint, "/")+"/?"+q.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		sigv4.Sign(req, nil, creds, region, "ec2", time.Now())
+		resp, err := awsClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		var res struct {
+			Reservations []struct {
+				Instances []struct {
+					PrivateIP string `xml:"privateIpAddress"`
+				} `xml:"instancesSet>item"`
+			} `xml:"reservationSet>item"`
+			NextToken string `xml:"nextToken"`
+		}
+		if resp.StatusCode != http.StatusOK {
+			body, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			return nil, fmt.Errorf("describe instances: %s: %s", resp.Status, body)
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&res)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decode instances: %v", err)
+		}
+		for _, r := range res.Reservations {
+			for _, i := range r.Instances {
+				if i.PrivateIP != "" {
+					addrs = append(addrs, net.JoinHostPort(i.PrivateIP, port(args)))
+				}
+			}
+		}
+		if next = res.NextToken; next == "" {
+			return addrs, nil
+		}
+	}
+}
+
+// ec2Credentials returns the credentials from the args, the env, or the instance's role.
+func ec2Credentials(args map[string]string) (sigv4.Credentials, error) {
+	if id := args["access_key_id"]; id != "" {
+		return sigv4.Credentials{AccessKeyID: id, SecretAccessKey: args["secret_access_key"]}, nil
+	}
+	if id := os.Getenv("AWS_ACCESS_KEY_ID"); id != "" {
+		return sigv4.Credentials{
+			AccessKeyID:     id,
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+	role, err := instanceMetadata("meta-data/iam/security-credentials/")
+	if err != nil {
+		return sigv4.Credentials{}, fmt.Errorf("no credentials set and the instance's role is unknown: %v", err)
+	}
+	role = strings.TrimSpace(strings.SplitN(role, "\n", 2)[0])
+	doc, err := instanceMetadata("meta-data/iam/security-credentials/" + role)
+	if err != nil {
+		return sigv4.Credentials{}, fmt.Errorf("role %s credentials: %v", role, err)
+	}
+	var c struct {
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string `json:"SecretAccessKey"`
+		Token           string `json:"Token"`
+	}
+	if err := json.Unmarshal([]byte(doc), &c); err != nil {
+		return sigv4.Credentials{}, fmt.Errorf("role %s credentials: %v", role, err)
+	}
+	return sigv4.Credentials{AccessKeyID: c.AccessKeyID, SecretAccessKey: c.SecretAccessKey, SessionToken: c.Token}, nil
+}
+
+// instanceMetadata gets the path from the instance metadata service, with a session token if the
+// service requires one.
+func instanceMetadata(path string) (string, error) {
+	req, err := http.NewRequest("GET", metadataURL+"/"+path, nil)
+	if err != nil {
+		return "", err
+	}
+	if tokenReq, err := http.NewRequest("PUT", metadataURL+"/api/token", nil); err == nil {
+		tokenReq.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+		if resp, err := awsClient.Do(tokenReq); err == nil {
+			token, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				req.Header.Set("X-aws-ec2-metadata-token", string(token))
+			}
+		}
+	}
+	resp, err := awsClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: %s", path, resp.Status)
+	}
+	return string(body), nil
+}
@@ -0,0 +1,88 @@
+// Package discover finds the serf addresses of the brokers to join with providers that look them
+// up, e.g. in DNS or a cloud's API, so brokers in dynamic environments can form a cluster without
+// being told each other's addresses.
+package discover
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// defaultPort is serf's default port, the port of the addresses providers find without one.
+const defaultPort = "8301"
+
+// Provider looks up addresses with the args of a join config, e.g. the DNS name to look up.
+type Provider interface {
+	Addrs(args map[string]string) ([]string, error)
+}
+
+// ProviderFunc is a function that's a Provider.
+type ProviderFunc func(args map[string]string) ([]string, error)
+
+// Addrs calls f.
+func (f ProviderFunc) Addrs(args map[string]string) ([]string, error) {
+	return f(args)
+}
+
+// Providers returns the built-in providers by name: dns, k8s, and aws.
+func Providers() map[string]Provider {
+	return map[string]Provider{
+		"dns": ProviderFunc(DNS),
+		"k8s": ProviderFunc(Kubernetes),
+		"aws": ProviderFunc(EC2),
+	}
+}
+
+// Addrs returns the addresses of the join config: either an address, or the name of one of the
+// providers and its args as space separated key=value pairs, e.g.
+// "provider=dns name=_serf._tcp.jocko.example.com".
+func Addrs(cfg string, providers map[string]Provider) ([]string, error) {
+	if !strings.Contains(cfg, "provider=") {
+		return []string{cfg}, nil
+	}
+	args, err := parse(cfg)
+	if err != nil {
+		return nil, err
+	}
+	name := args["provider"]
+	p, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown provider %q, known are %s", name, names(providers))
+	}
+	addrs, err := p.Addrs(args)
+	if err != nil {
+		return nil, fmt.Errorf("provider %s: %v", name, err)
+	}
+	return addrs, nil
+}
+
+// parse parses the join config's key=value pairs.
+func parse(cfg string) (map[string]string, error) {
+	args := make(map[string]string)
+	for _, f := range strings.Fields(cfg) {
+		i := strings.Index(f, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("%q isn't a key=value pair", f)
+		}
+		args[f[:i]] = f[i+1:]
+	}
+	return args, nil
+}
+
+func names(providers map[string]Provider) string {
+	s := make([]string, 0, len(providers))
+	for name := range providers {
+		s = append(s, name)
+	}
+	sort.Strings(s)
+	return strings.Join(s, ", ")
+}
+
+// port returns the port arg, serf's default port if it's unset.
+func port(args map[string]string) string {
+	if p := args["port"]; p != "" {
+		return p
+	}
+	return defaultPort
+}
@@ -0,0 +1,124 @@
+package discover
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddrs(t *testing.T) {
+	req := require.New(t)
+	providers := map[string]Provider{
+		"test": ProviderFunc(func(args map[string]string) ([]string, error) {
+			if args["fail"] != "" {
+				return nil, errors.New("failed")
+			}
+			return []string{args["a"], args["b"]}, nil
+		}),
+	}
+
+	addrs, err := Addrs("10.0.0.1:8301", providers)
+	req.NoError(err)
+	req.Equal([]string{"10.0.0.1:8301"}, addrs)
+
+	addrs, err = Addrs("provider=test a=1 b=x=y", providers)
+	req.NoError(err)
+	req.Equal([]string{"1", "x=y"}, addrs)
+
+	_, err = Addrs("provider=test fail=1", providers)
+	req.EqualError(err, "provider test: failed")
+	_, err = Addrs("provider=unknown", providers)
+	req.Error(err)
+	_, err = Addrs("provider=test a", providers)
+	req.Error(err)
+}
+
+func TestDNS(t *testing.T) {
+	defer func(f func(string, string, string) (string, []*net.SRV, error)) { lookupSRV = f }(lookupSRV)
+	lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
+		require.Equal(t, "serf", service)
+		require.Equal(t, "tcp", proto)
+		require.Equal(t, "jocko.example.com", name)
+		return "", []*net.SRV{{Target: "a.jocko.example.com.", Port: 8301}, {Target: "b.jocko.example.com.", Port: 8302}}, nil
+	}
+	addrs, err := DNS(map[string]string{"service": "serf", "proto": "tcp", "name": "jocko.example.com"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a.jocko.example.com:8301", "b.jocko.example.com:8302"}, addrs)
+
+	_, err = DNS(nil)
+	require.Error(t, err)
+}
+
+func TestKubernetes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "discover_test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(d string) { serviceAccountDir = d }(serviceAccountDir)
+	serviceAccountDir = dir
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "token"), []byte("secret\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "namespace"), []byte("kafka"), 0600))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/v1/namespaces/kafka/pods", r.URL.Path)
+		require.Equal(t, "app=jocko", r.URL.Query().Get("labelSelector"))
+		require.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		fmt.Fprint(w, `{"items": [
+			{"status": {"phase": "Running", "podIP": "10.0.0.1"}},
+			{"status": {"phase": "Pending"}},
+			{"status": {"phase": "Running", "podIP": "10.0.0.2"}}
+		]}`)
+	}))
+	defer srv.Close()
+
+	addrs, err := Kubernetes(map[string]string{"label_selector": "app=jocko", "host": srv.URL})
+	require.NoError(t, err)
+	require.Equal(t, []string{"10.0.0.1:8301", "10.0.0.2:8301"}, addrs)
+	addrs, err = Kubernetes(map[string]string{"label_selector": "app=jocko", "host": srv.URL, "port": "9000"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"10.0.0.1:9000", "10.0.0.2:9000"}, addrs)
+}
+
+func TestEC2(t *testing.T) {
+	var pages int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		require.Equal(t, "DescribeInstances", q.Get("Action"))
+		require.Equal(t, "tag:role", q.Get("Filter.1.Name"))
+		require.Equal(t, "jocko", q.Get("Filter.1.Value.1"))
+		require.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"))
+		require.Contains(t, r.Header.Get("Authorization"), "/us-east-1/ec2/aws4_request")
+		pages++
+		if q.Get("NextToken") == "" {
+			fmt.Fprint(w, `<DescribeInstancesResponse><reservationSet><item><instancesSet>
+				<item><privateIpAddress>10.0.0.1</privateIpAddress></item>
+				<item><privateIpAddress>10.0.0.2</privateIpAddress></item>
+			</instancesSet></item></reservationSet><nextToken>next</nextToken></DescribeInstancesResponse>`)
+			return
+		}
+		fmt.Fprint(w, `<DescribeInstancesResponse><reservationSet><item><instancesSet>
+			<item><privateIpAddress>10.0.0.3</privateIpAddress></item>
+		</instancesSet></item></reservationSet></DescribeInstancesResponse>`)
+	}))
+	defer srv.Close()
+
+	addrs, err := EC2(map[string]string{
+		"tag_key":           "role",
+		"tag_value":         "jocko",
+		"region":            "us-east-1",
+		"access_key_id":     "AKID",
+		"secret_access_key": "secret",
+		"endpoint":          srv.URL,
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"10.0.0.1:8301", "10.0.0.2:8301", "10.0.0.3:8301"}, addrs)
+	require.Equal(t, 2, pages)
+}
@@ -0,0 +1,30 @@
+package discover
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// lookupSRV looks up SRV records, replaced in tests.
+var lookupSRV = net.LookupSRV
+
+// DNS looks up the SRV records of the name arg, or of its service and proto args under the name if
+// they're set, e.g. service=serf proto=tcp name=jocko.example.com looks up
+// _serf._tcp.jocko.example.com. The records' targets and ports are the addresses.
+func DNS(args map[string]string) ([]string, error) {
+	name := args["name"]
+	if name == "" {
+		return nil, errors.New("name is required")
+	}
+	_, srvs, err := lookupSRV(args["service"], args["proto"], name)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, 0, len(srvs))
+	for _, srv := range srvs {
+		addrs = append(addrs, net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port))))
+	}
+	return addrs, nil
+}
@@ -0,0 +1,99 @@
+package discover
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// serviceAccountDir is where Kubernetes mounts the pod's service account token, CA, and namespace.
+var serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// Kubernetes lists the running pods matching the label_selector arg, e.g. app=jocko, in the
+// namespace arg, the pod's own if it's unset, from the API server of the cluster the pod's running
+// in, or the host arg. The pods' IPs with the port arg are the addresses. The pod's service
+// account needs to be allowed to list pods.
+func Kubernetes(args map[string]string) ([]string, error) {
+	selector := args["label_selector"]
+	if selector == "" {
+		return nil, errors.New("label_selector is required")
+	}
+	host := args["host"]
+	if host == "" {
+		h, p := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if h == "" || p == "" {
+			return nil, errors.New("not running in kubernetes and host isn't set")
+		}
+		host = "https://" + net.JoinHostPort(h, p)
+	}
+	namespace := args["namespace"]
+	if namespace == "" {
+		ns, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+		if err != nil {
+			return nil, fmt.Errorf("namespace isn't set and the pod's is unknown: %v", err)
+		}
+		namespace = strings.TrimSpace(string(ns))
+	}
+	client, err := kubernetesClient()
+	if err != nil {
+		return nil, err
+	}
+
+	u := fmt.Sprintf("%s/api/v1/namespaces/%s/pods?labelSelector=%s", strings.TrimSuffix(host, "/"), url.PathEscape(namespace), url.QueryEscape(selector))
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "token")); err == nil {
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("list pods: %s", resp.Status)
+	}
+	var pods struct {
+		Items []struct {
+			Status struct {
+				Phase string `json:"phase"`
+				PodIP string `json:"podIP"`
+			} `json:"status"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&pods); err != nil {
+		return nil, fmt.Errorf("decode pods: %v", err)
+	}
+	var addrs []string
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == "Running" && pod.Status.PodIP != "" {
+			addrs = append(addrs, net.JoinHostPort(pod.Status.PodIP, port(args)))
+		}
+	}
+	return addrs, nil
+}
+
+// kubernetesClient returns a client trusting the service account's CA, if the pod has one.
+func kubernetesClient() (*http.Client, error) {
+	transport := &http.Transport{Proxy: http.ProxyFromEnvironment}
+	if ca, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "ca.crt")); err == nil {
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(ca) {
+			return nil, errors.New("no certificates in the service account's ca")
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+	}
+	return &http.Client{Transport: transport, Timeout: 10 * time.Second}, nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package jocko
+
+import "errors"
+
+// diskUsage isn't supported off linux.
+func diskUsage(path string) (total, free int64, err error) {
+	return 0, 0, errors.New("disk usage not supported")
+}
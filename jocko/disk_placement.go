@@ -0,0 +1,112 @@
+package jocko
+
+import (
+	"math/rand"
+	"strconv"
+
+	"github.com/travisjeffery/jocko/jocko/metadata"
+	"github.com/travisjeffery/jocko/log"
+)
+
+// diskPlacementSkew is how much more of its disk the fullest candidate broker must use than the
+// emptiest for new replicas to be placed by disk usage, below it they're spread evenly.
+const diskPlacementSkew = 0.1
+
+// diskUsageLoop reports the broker's disk usage in its serf tags each report interval, for the
+// controller to place new replicas on the emptier brokers' disks.
+func (b *Broker) diskUsageLoop() {
+	ticker := b.clock.NewTicker(b.config.DiskUsageReportInterval)
+	defer ticker.Stop()
+	for {
+		if err := b.reportDiskUsage(); err != nil {
+			log.Debug.Printf("broker/%d: report disk usage error: %s", b.config.ID, err)
+		}
+		select {
+		case <-ticker.C():
+		case <-b.shutdownCh:
+			return
+		}
+	}
+}
+
+// reportDiskUsage sets the broker's disk usage tags to the size of its replicas' logs and the
+// free space on its data dir's disk.
+func (b *Broker) reportDiskUsage() error {
+	_, free, err := diskUsage(b.config.DataDir)
+	if err != nil {
+		return err
+	}
+	var size int64
+	for _, replica := range b.replicaLookup.Replicas() {
+		replica.Lock()
+		l := replica.Log
+		replica.Unlock()
+		if !replica.IsLocal || l == nil {
+			continue
+		}
+		if sizer, ok := l.(interface{ Size() int64 }); ok {
+			size += sizer.Size()
+		}
+	}
+	tags := make(map[string]string)
+	for k, v := range b.serf.LocalMember().Tags {
+		tags[k] = v
+	}
+	tags[metadata.LogBytesTag] = strconv.FormatInt(size, 10)
+	tags[metadata.DiskFreeBytesTag] = strconv.FormatInt(free, 10)
+	return b.serf.SetTags(tags)
+}
+
+// diskWeights returns the brokers' weights for placing replicas on them, the share of their disks
+// left free, or nil if a broker doesn't report its disk usage or the disks are used about evenly.
+func diskWeights(brokers []*metadata.Broker) []float64 {
+	weights := make([]float64, len(brokers))
+	min, max := 1.0, 0.0
+	for i, broker := range brokers {
+		used, ok := broker.DiskUsed()
+		if !ok {
+			return nil
+		}
+		if used < min {
+			min = used
+		}
+		if used > max {
+			max = used
+		}
+		// full disks keep a small weight so a topic can still be placed when every disk's full.
+		weights[i] = 1 - used + 0.01
+	}
+	if max-min < diskPlacementSkew {
+		return nil
+	}
+	return weights
+}
+
+// pickReplicas picks n of the brokers at random, weighted by the weights, the first picked being
+// the leader.
+func pickReplicas(brokers []*metadata.Broker, weights []float64, n int) []int32 {
+	weights = append([]float64(nil), weights...)
+	var total float64
+	for _, w := range weights {
+		total += w
+	}
+	replicas := make([]int32, 0, n)
+	for len(replicas) < n {
+		x := rand.Float64() * total
+		i := 0
+		for ; i < len(weights)-1; i++ {
+			if x < weights[i] {
+				break
+			}
+			x -= weights[i]
+		}
+		// the last broker may be picked already if x was rounded past the others' weights.
+		for weights[i] == 0 {
+			i--
+		}
+		replicas = append(replicas, brokers[i].ID.Int32())
+		total -= weights[i]
+		weights[i] = 0
+	}
+	return replicas
+}
@@ -0,0 +1,191 @@
+package jocko
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/serf/serf"
+	"github.com/travisjeffery/jocko/jocko/metadata"
+	"github.com/travisjeffery/jocko/jocko/structs"
+	"github.com/travisjeffery/jocko/log"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+// Version is the broker's version, set when it's built with
+// -ldflags "-X github.com/travisjeffery/jocko/jocko.Version=<version>".
+var Version = "dev"
+
+// Features that change what brokers write for each other to read, like raft commands and record
+// formats, are gated on every broker in the cluster supporting them. That way a cluster can be
+// upgraded a broker at a time without the brokers yet to be upgraded misreading or ignoring what
+// the upgraded ones write. Brokers advertise the levels of the gated features they support in
+// their serf tags.
+//
+// Features whose use is checked as it happens, like maintenance, only need the brokers in the
+// cluster at the time to support them. Features that leave data behind, like a new record
+// format, are used once an operator finalizes their level with an update features request. A
+// finalized level is stored in the replicated state, so it holds across restarts and brokers
+// rolled back to a version not supporting it can't join the cluster and misread the data.
+const (
+	// FeatureNodeMaintenance is applying the raft command putting brokers in maintenance. Brokers
+	// without it ignore the command and would go on assigning replicas to brokers in maintenance.
+	FeatureNodeMaintenance = "node_maintenance"
+)
+
+// supportedFeatures are the max levels of the gated features this broker supports. It supports
+// each from level 1.
+var supportedFeatures = map[string]int16{
+	FeatureNodeMaintenance: 1,
+}
+
+// unsupportedBrokers returns the IDs of the brokers in the cluster that don't support the feature
+// at the level, sorted. Failed brokers count, since they may be mid upgrade and come back on their
+// old version, only brokers that have left don't.
+func unsupportedBrokers(members []serf.Member, feature string, level int16) []int32 {
+	var ids []int32
+	for _, m := range members {
+		if m.Status == serf.StatusLeft {
+			continue
+		}
+		broker, ok := metadata.IsBroker(m)
+		if !ok || broker.Supports(feature, level) {
+			continue
+		}
+		ids = append(ids, broker.ID.Int32())
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// featureLevel returns the feature's finalized level, 0 if it isn't finalized.
+func (b *Broker) featureLevel(feature string) int16 {
+	_, features, err := b.fsm.State().GetFeatures()
+	if err != nil {
+		log.Error.Printf("broker/%d: get features error: %s", b.config.ID, err)
+		return 0
+	}
+	for _, f := range features {
+		if f.Name == feature {
+			return f.Level
+		}
+	}
+	return 0
+}
+
+// unsupportedFinalizedFeature returns the first finalized feature the broker doesn't support at
+// its finalized level.
+func (b *Broker) unsupportedFinalizedFeature(broker *metadata.Broker) (*structs.Feature, error) {
+	_, features, err := b.fsm.State().GetFeatures()
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range features {
+		if !broker.Supports(f.Name, f.Level) {
+			return f, nil
+		}
+	}
+	return nil, nil
+}
+
+// handleDescribeFeatures returns the feature levels the broker supports and the cluster's
+// finalized levels.
+func (b *Broker) handleDescribeFeatures(ctx *Context, req *protocol.DescribeFeaturesRequest) *protocol.DescribeFeaturesResponse {
+	sp := span(ctx, b.tracer, "describe features")
+	defer sp.Finish()
+	res := &protocol.DescribeFeaturesResponse{}
+	res.APIVersion = req.Version()
+
+	idx, features, err := b.fsm.State().GetFeatures()
+	if err != nil {
+		res.ErrorCode = protocol.ErrUnknown.Code()
+		msg := err.Error()
+		res.ErrorMessage = &msg
+		return res
+	}
+	for name, level := range supportedFeatures {
+		res.SupportedFeatures = append(res.SupportedFeatures, &protocol.SupportedFeature{Name: name, MinLevel: 1, MaxLevel: level})
+	}
+	sort.Slice(res.SupportedFeatures, func(i, j int) bool {
+		return res.SupportedFeatures[i].Name < res.SupportedFeatures[j].Name
+	})
+	res.FinalizedEpoch = -1
+	if idx != 0 {
+		res.FinalizedEpoch = int64(idx)
+	}
+	for _, f := range features {
+		res.FinalizedFeatures = append(res.FinalizedFeatures, &protocol.FinalizedFeature{Name: f.Name, Level: f.Level})
+	}
+	return res
+}
+
+// handleUpdateFeatures finalizes the features' levels. Like topic creation it must be sent to the
+// controller.
+func (b *Broker) handleUpdateFeatures(ctx *Context, req *protocol.UpdateFeaturesRequest) *protocol.UpdateFeaturesResponse {
+	sp := span(ctx, b.tracer, "update features")
+	defer sp.Finish()
+	res := &protocol.UpdateFeaturesResponse{}
+	res.APIVersion = req.Version()
+
+	if !b.isController() {
+		res.ErrorCode = protocol.ErrNotController.Code()
+		return res
+	}
+
+	levels, perr := b.featureUpdateLevels(req.Updates)
+	if perr != protocol.ErrNone {
+		setUpdateFeaturesErr(res, perr)
+		return res
+	}
+	if req.ValidateOnly || len(levels) == 0 {
+		return res
+	}
+	log.Info.Printf("leader/%d: update features: %v", b.config.ID, levels)
+	if _, err := b.raftApply(structs.UpdateFeaturesRequestType, structs.UpdateFeaturesRequest{Levels: levels}); err != nil {
+		setUpdateFeaturesErr(res, protocol.ErrUnknown.WithErr(err))
+	}
+	return res
+}
+
+// featureUpdateLevels validates the updates and returns the levels to finalize. Raising a
+// feature's level needs every broker in the cluster to support it.
+func (b *Broker) featureUpdateLevels(updates []*protocol.FeatureUpdate) (map[string]int16, protocol.Error) {
+	_, features, err := b.fsm.State().GetFeatures()
+	if err != nil {
+		return nil, protocol.ErrUnknown.WithErr(err)
+	}
+	finalized := make(map[string]int16, len(features))
+	for _, f := range features {
+		finalized[f.Name] = f.Level
+	}
+	members := b.LANMembers()
+	levels := make(map[string]int16, len(updates))
+	for _, u := range updates {
+		if _, ok := levels[u.Name]; ok {
+			return nil, protocol.ErrInvalidRequest.WithErr(fmt.Errorf("feature %s is updated more than once", u.Name))
+		}
+		max, ok := supportedFeatures[u.Name]
+		switch {
+		case u.Level < 0:
+			return nil, protocol.ErrInvalidRequest.WithErr(fmt.Errorf("level %d of feature %s is negative", u.Level, u.Name))
+		case !ok && u.Level > 0:
+			return nil, protocol.ErrInvalidRequest.WithErr(fmt.Errorf("unknown feature %s", u.Name))
+		case u.Level > max:
+			return nil, protocol.ErrInvalidRequest.WithErr(fmt.Errorf("the controller supports feature %s up to level %d", u.Name, max))
+		case u.Level < finalized[u.Name] && !u.AllowDowngrade:
+			return nil, protocol.ErrInvalidRequest.WithErr(fmt.Errorf("downgrading feature %s from level %d to %d must be allowed", u.Name, finalized[u.Name], u.Level))
+		}
+		if u.Level > finalized[u.Name] {
+			if ids := unsupportedBrokers(members, u.Name, u.Level); len(ids) != 0 {
+				return nil, protocol.ErrInvalidRequest.WithErr(fmt.Errorf("brokers %v don't support feature %s level %d, upgrade them first", ids, u.Name, u.Level))
+			}
+		}
+		levels[u.Name] = u.Level
+	}
+	return levels, protocol.ErrNone
+}
+
+func setUpdateFeaturesErr(res *protocol.UpdateFeaturesResponse, err protocol.Error) {
+	res.ErrorCode = err.Code()
+	msg := err.Error()
+	res.ErrorMessage = &msg
+}
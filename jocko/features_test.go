@@ -0,0 +1,128 @@
+package jocko
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/hashicorp/consul/testutil/retry"
+	"github.com/hashicorp/serf/serf"
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/jocko/metadata"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestUnsupportedBrokers(t *testing.T) {
+	member := func(id string, status serf.MemberStatus, features string) serf.Member {
+		tags := map[string]string{"id": id, "role": "jocko"}
+		if features != "" {
+			tags[metadata.FeaturesTag] = features
+		}
+		return serf.Member{Name: "broker-" + id, Tags: tags, Status: status}
+	}
+	members := []serf.Member{
+		member("3", serf.StatusAlive, ""),
+		member("1", serf.StatusFailed, "other:1"),
+		member("2", serf.StatusAlive, FeatureNodeMaintenance+":2"),
+		member("5", serf.StatusAlive, FeatureNodeMaintenance+":1"),
+		member("4", serf.StatusLeft, ""),
+		{Name: "client", Tags: map[string]string{"role": "client"}, Status: serf.StatusAlive},
+	}
+	require.Equal(t, []int32{1, 3}, unsupportedBrokers(members, FeatureNodeMaintenance, 1))
+	require.Equal(t, []int32{1, 3, 5}, unsupportedBrokers(members, FeatureNodeMaintenance, 2))
+	require.Empty(t, unsupportedBrokers(members[2:], FeatureNodeMaintenance, 1))
+}
+
+func TestBroker_UpdateFeatures(t *testing.T) {
+	supportedFeatures["test_feature"] = 2
+	defer delete(supportedFeatures, "test_feature")
+
+	s, dir := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+	b := s.broker()
+
+	conn, err := Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	describe, err := conn.DescribeFeatures(&protocol.DescribeFeaturesRequest{})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrNone.Code(), describe.ErrorCode)
+	require.Equal(t, []*protocol.SupportedFeature{
+		{Name: FeatureNodeMaintenance, MinLevel: 1, MaxLevel: 1},
+		{Name: "test_feature", MinLevel: 1, MaxLevel: 2},
+	}, describe.SupportedFeatures)
+	require.Equal(t, int64(-1), describe.FinalizedEpoch)
+	require.Empty(t, describe.FinalizedFeatures)
+
+	update := func(validateOnly bool, updates ...*protocol.FeatureUpdate) *protocol.UpdateFeaturesResponse {
+		var res *protocol.UpdateFeaturesResponse
+		retry.Run(t, func(r *retry.R) {
+			var err error
+			if res, err = conn.UpdateFeatures(&protocol.UpdateFeaturesRequest{Updates: updates, ValidateOnly: validateOnly}); err != nil {
+				r.Fatal(err)
+			}
+			if res.ErrorCode == protocol.ErrNotController.Code() {
+				r.Fatal("not the controller yet")
+			}
+		})
+		return res
+	}
+	requireErr := func(res *protocol.UpdateFeaturesResponse, msg string) {
+		require.Equal(t, protocol.ErrInvalidRequest.Code(), res.ErrorCode)
+		require.NotNil(t, res.ErrorMessage)
+		require.Contains(t, *res.ErrorMessage, msg)
+	}
+
+	requireErr(update(false, &protocol.FeatureUpdate{Name: "test_feature", Level: 3}), "the controller supports feature test_feature up to level 2")
+	requireErr(update(false, &protocol.FeatureUpdate{Name: "unknown", Level: 1}), "unknown feature unknown")
+	requireErr(update(false, &protocol.FeatureUpdate{Name: "test_feature", Level: 1}, &protocol.FeatureUpdate{Name: "test_feature", Level: 2}), "updated more than once")
+
+	require.Equal(t, protocol.ErrNone.Code(), update(true, &protocol.FeatureUpdate{Name: "test_feature", Level: 2}).ErrorCode)
+	require.Equal(t, int16(0), b.featureLevel("test_feature"))
+
+	require.Equal(t, protocol.ErrNone.Code(), update(false, &protocol.FeatureUpdate{Name: "test_feature", Level: 2}, &protocol.FeatureUpdate{Name: "unknown", Level: 0}).ErrorCode)
+	require.Equal(t, int16(2), b.featureLevel("test_feature"))
+	describe, err = conn.DescribeFeatures(&protocol.DescribeFeaturesRequest{})
+	require.NoError(t, err)
+	require.True(t, describe.FinalizedEpoch > 0)
+	require.Equal(t, []*protocol.FinalizedFeature{{Name: "test_feature", Level: 2}}, describe.FinalizedFeatures)
+
+	requireErr(update(false, &protocol.FeatureUpdate{Name: "test_feature", Level: 1}), "downgrading feature test_feature from level 2 to 1 must be allowed")
+	require.Equal(t, protocol.ErrNone.Code(), update(false, &protocol.FeatureUpdate{Name: "test_feature", Level: 1, AllowDowngrade: true}).ErrorCode)
+	require.Equal(t, int16(1), b.featureLevel("test_feature"))
+
+	// a broker only supporting level 1, e.g. one not upgraded yet, blocks finalizing level 2 and
+	// can't join once it's finalized.
+	tags := make(map[string]string)
+	for k, v := range b.serf.LocalMember().Tags {
+		tags[k] = v
+	}
+	tags[metadata.FeaturesTag] = "test_feature:1"
+	require.NoError(t, b.serf.SetTags(tags))
+	retry.Run(t, func(r *retry.R) {
+		if ids := unsupportedBrokers(b.LANMembers(), "test_feature", 2); len(ids) != 1 {
+			r.Fatalf("unsupported brokers are %v, tags not updated", ids)
+		}
+	})
+	requireErr(update(false, &protocol.FeatureUpdate{Name: "test_feature", Level: 2}), "don't support feature test_feature level 2")
+
+	meta, ok := metadata.IsBroker(b.serf.LocalMember())
+	require.True(t, ok)
+	f, err := b.unsupportedFinalizedFeature(meta)
+	require.NoError(t, err)
+	require.Nil(t, f)
+	meta.Features = nil
+	f, err = b.unsupportedFinalizedFeature(meta)
+	require.NoError(t, err)
+	require.NotNil(t, f)
+	require.Equal(t, "test_feature", f.Name)
+}
@@ -0,0 +1,76 @@
+package jocko
+
+import (
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// fetchCache caches the record sets read for fetches so consumers fetching the same hot offset
+// range share one read rather than each going to disk. A nil fetchCache caches nothing.
+type fetchCache struct {
+	cache *lru.Cache
+}
+
+type fetchKey struct {
+	// log is included so a recreated partition doesn't hit its old log's record sets.
+	log       CommitLog
+	topic     string
+	partition int32
+	offset    int64
+	maxBytes  int32
+}
+
+type fetchEntry struct {
+	// newestOffset is the log's newest offset when the record set was read. Once the log has
+	// grown past it the record set is missing records and isn't served.
+	newestOffset int64
+	recordSet    []byte
+}
+
+// newFetchCache returns a fetch cache holding up to size record sets, or nil if size isn't positive.
+func newFetchCache(size int) (*fetchCache, error) {
+	if size <= 0 {
+		return nil, nil
+	}
+	cache, err := lru.New(size)
+	if err != nil {
+		return nil, err
+	}
+	return &fetchCache{cache: cache}, nil
+}
+
+// get returns the cached record set for the fetch if it was read when the log's newest offset
+// was newestOffset.
+func (c *fetchCache) get(key fetchKey, newestOffset int64) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	v, ok := c.cache.Get(key)
+	if !ok {
+		return nil, false
+	}
+	e := v.(fetchEntry)
+	if e.newestOffset != newestOffset {
+		c.cache.Remove(key)
+		return nil, false
+	}
+	return e.recordSet, true
+}
+
+func (c *fetchCache) add(key fetchKey, newestOffset int64, recordSet []byte) {
+	if c == nil {
+		return
+	}
+	c.cache.Add(key, fetchEntry{newestOffset: newestOffset, recordSet: recordSet})
+}
+
+// invalidate removes the partition's record sets, e.g. because its log was truncated.
+func (c *fetchCache) invalidate(topic string, partition int32) {
+	if c == nil {
+		return
+	}
+	for _, k := range c.cache.Keys() {
+		if key := k.(fetchKey); key.topic == topic && key.partition == partition {
+			c.cache.Remove(k)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package jocko
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchCache(t *testing.T) {
+	c, err := newFetchCache(2)
+	require.NoError(t, err)
+
+	key := fetchKey{topic: "test", partition: 0, offset: 1, maxBytes: 100}
+	_, ok := c.get(key, 5)
+	require.False(t, ok)
+
+	c.add(key, 5, []byte("records"))
+	set, ok := c.get(key, 5)
+	require.True(t, ok)
+	require.Equal(t, []byte("records"), set)
+
+	// the log has grown so the cached record set is missing records.
+	_, ok = c.get(key, 6)
+	require.False(t, ok)
+
+	c.add(key, 6, []byte("records"))
+	other := fetchKey{topic: "test", partition: 1, offset: 1, maxBytes: 100}
+	c.add(other, 6, []byte("other"))
+	c.invalidate("test", 0)
+	_, ok = c.get(key, 6)
+	require.False(t, ok)
+	_, ok = c.get(other, 6)
+	require.True(t, ok)
+
+	// a nil cache is disabled.
+	c, err = newFetchCache(0)
+	require.NoError(t, err)
+	c.add(key, 6, []byte("records"))
+	_, ok = c.get(key, 6)
+	require.False(t, ok)
+	c.invalidate("test", 0)
+}
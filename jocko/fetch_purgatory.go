@@ -0,0 +1,184 @@
+package jocko
+
+import (
+	"sync"
+
+	"github.com/travisjeffery/jocko/log"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+// fetchPurgatory holds consumer fetches that found nothing to read at their partitions' log ends,
+// keyed by partition, until an append to one of them or their max wait time. Idle consumers then
+// wait on the broker rather than polling it, each poll rechecking the partitions' state.
+type fetchPurgatory struct {
+	mu      sync.Mutex
+	waiting map[partitionKey]map[*delayedFetch]struct{}
+	// held is the number of fetches held, onChange, if set, is called with it when it changes.
+	held     int
+	onChange func(n int)
+}
+
+type partitionKey struct {
+	topic     string
+	partition int32
+}
+
+// delayedFetch is a fetch watching its partitions for appends.
+type delayedFetch struct {
+	partitions []partitionKey
+	held       bool
+	// woken is closed when one of the partitions is appended to.
+	woken    chan struct{}
+	wakeOnce sync.Once
+	// done answers the fetch, once, closing answered.
+	done     sync.Once
+	complete func()
+	answered chan struct{}
+}
+
+func newFetchPurgatory(onChange func(n int)) *fetchPurgatory {
+	return &fetchPurgatory{
+		waiting:  make(map[partitionKey]map[*delayedFetch]struct{}),
+		onChange: onChange,
+	}
+}
+
+// watch starts watching the fetch's partitions for appends. It's called before the fetch is
+// handled so appends racing the handling aren't missed.
+func (p *fetchPurgatory) watch(r *protocol.FetchRequest) *delayedFetch {
+	d := &delayedFetch{woken: make(chan struct{}), answered: make(chan struct{})}
+	for _, t := range r.Topics {
+		for _, fp := range t.Partitions {
+			d.partitions = append(d.partitions, partitionKey{topic: t.Topic, partition: fp.Partition})
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, k := range d.partitions {
+		if p.waiting[k] == nil {
+			p.waiting[k] = make(map[*delayedFetch]struct{})
+		}
+		p.waiting[k][d] = struct{}{}
+	}
+	return d
+}
+
+// hold holds the watched fetch until it's woken, completing it with complete.
+func (p *fetchPurgatory) hold(d *delayedFetch, complete func()) {
+	d.complete = complete
+	p.mu.Lock()
+	d.held = true
+	p.held++
+	n := p.held
+	p.mu.Unlock()
+	p.changed(n)
+}
+
+// remove stops watching the fetch's partitions.
+func (p *fetchPurgatory) remove(d *delayedFetch) {
+	p.mu.Lock()
+	for _, k := range d.partitions {
+		delete(p.waiting[k], d)
+		if len(p.waiting[k]) == 0 {
+			delete(p.waiting, k)
+		}
+	}
+	held := d.held
+	if held {
+		d.held = false
+		p.held--
+	}
+	n := p.held
+	p.mu.Unlock()
+	if held {
+		p.changed(n)
+	}
+}
+
+// wake wakes the fetches waiting on the partition.
+func (p *fetchPurgatory) wake(topic string, partition int32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for d := range p.waiting[partitionKey{topic: topic, partition: partition}] {
+		d.wakeOnce.Do(func() { close(d.woken) })
+	}
+}
+
+func (p *fetchPurgatory) changed(n int) {
+	if p.onChange != nil {
+		p.onChange(n)
+	}
+}
+
+// finish answers the fetch if it hasn't been, waiting for it if it's being answered.
+func (d *delayedFetch) finish() {
+	d.done.Do(func() {
+		d.complete()
+		close(d.answered)
+	})
+}
+
+// watchFetch watches the partitions of consumer fetches willing to wait for records, nil for
+// those that aren't.
+func (b *Broker) watchFetch(reqCtx *Context) *delayedFetch {
+	r, ok := reqCtx.req.(*protocol.FetchRequest)
+	if !ok || r.ReplicaID >= 0 || r.MaxWaitTime <= 0 || r.MinBytes <= 0 {
+		return nil
+	}
+	return b.purgatory.watch(r)
+}
+
+// holdFetch holds the fetch in purgatory if its response is empty, refetching once it's woken by
+// an append or its max wait time passes. It returns whether it's held.
+func (b *Broker) holdFetch(reqCtx *Context, d *delayedFetch, res protocol.ResponseBody, responses chan<- *Context) bool {
+	fres, ok := res.(*protocol.FetchResponse)
+	if !ok || !emptyFetch(fres) {
+		b.purgatory.remove(d)
+		return false
+	}
+	r := reqCtx.req.(*protocol.FetchRequest)
+	b.purgatory.hold(d, func() {
+		b.purgatory.remove(d)
+		b.held.release(reqCtx.conn, d)
+		b.respond(reqCtx, b.handleFetch(reqCtx, r), responses)
+	})
+	b.held.hold(reqCtx.conn, d)
+	timer := b.clock.NewTimer(r.MaxWaitTime)
+	b.goroutines.goFunc("fetch purgatory", func() {
+		defer timer.Stop()
+		select {
+		case <-d.woken:
+		case <-timer.C():
+		case <-d.answered:
+			return
+		case <-b.shutdownCh:
+			b.purgatory.remove(d)
+			return
+		}
+		log.Debug.Printf("broker/%d: refetching held fetch: %v", b.config.ID, reqCtx)
+		d.finish()
+	})
+	return true
+}
+
+// emptyFetch returns whether the fetch found nothing to read, and nothing else to tell the
+// consumer.
+func emptyFetch(res *protocol.FetchResponse) bool {
+	if res.ErrorCode != protocol.ErrNone.Code() || res.ThrottleTime > 0 {
+		return false
+	}
+	for _, t := range res.Responses {
+		for _, p := range t.PartitionResponses {
+			if p.ErrorCode != protocol.ErrNone.Code() || len(p.RecordSet) > 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (b *Broker) trackHeldFetches(n int) {
+	if m := b.topicMetrics(); m != nil && m.HeldFetches != nil {
+		m.HeldFetches.Set(float64(n))
+	}
+}
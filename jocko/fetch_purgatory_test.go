@@ -0,0 +1,78 @@
+package jocko
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestBroker_FetchPurgatory(t *testing.T) {
+	s, dir := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+
+	consumer, err := Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer consumer.Close()
+	producer, err := Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer producer.Close()
+	CreateTopic(t, producer, "idle", 1, 1)
+	WaitForTopicLeader(t, "idle", 0, s)
+
+	fetch := func(maxWait time.Duration) *protocol.FetchPartitionResponse {
+		res, err := consumer.Fetch(&protocol.FetchRequest{
+			MaxWaitTime: maxWait,
+			MinBytes:    1,
+			Topics: []*protocol.FetchTopic{{
+				Topic:      "idle",
+				Partitions: []*protocol.FetchPartition{{Partition: 0, MaxBytes: 1 << 20}},
+			}},
+		})
+		require.NoError(t, err)
+		p := res.Responses[0].PartitionResponses[0]
+		require.Equal(t, protocol.ErrNone.Code(), p.ErrorCode)
+		return p
+	}
+
+	// fetches at the log end wait out their max wait time.
+	start := time.Now()
+	p := fetch(300 * time.Millisecond)
+	require.Empty(t, p.RecordSet)
+	require.True(t, time.Since(start) >= 300*time.Millisecond, "answered after %s", time.Since(start))
+
+	// and are answered as soon as the partition's appended to.
+	set, err := protocol.Encode(&protocol.MessageSet{Messages: []*protocol.Message{{Value: []byte("v")}}})
+	require.NoError(t, err)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		res, err := producer.Produce(&protocol.ProduceRequest{
+			APIVersion: 2,
+			Timeout:    time.Second,
+			TopicData: []*protocol.TopicData{{
+				Topic: "idle",
+				Data:  []*protocol.Data{{Partition: 0, RecordSet: set}},
+			}},
+		})
+		if err != nil || res.Responses[0].PartitionResponses[0].ErrorCode != protocol.ErrNone.Code() {
+			t.Errorf("produce failed: %v", err)
+		}
+	}()
+	start = time.Now()
+	p = fetch(10 * time.Second)
+	require.True(t, time.Since(start) < 5*time.Second, "answered after %s", time.Since(start))
+	require.Equal(t, set, p.RecordSet)
+	require.Empty(t, s.broker().purgatory.waiting)
+	require.Empty(t, s.broker().held.conns)
+}
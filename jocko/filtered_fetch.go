@@ -0,0 +1,70 @@
+package jocko
+
+import (
+	"bytes"
+
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+// handleFilteredFetch fetches like a regular fetch then drops the message sets that don't match
+// the request's filter, so sparse consumers don't pay to transfer them.
+func (b *Broker) handleFilteredFetch(ctx *Context, r *protocol.FilteredFetchRequest) *protocol.FetchResponse {
+	res := b.handleFetch(ctx, &r.FetchRequest)
+	if len(r.KeyPrefix) == 0 {
+		return res
+	}
+	for _, tres := range res.Responses {
+		for _, pres := range tres.PartitionResponses {
+			if pres.ErrorCode == protocol.ErrNone.Code() {
+				pres.RecordSet = filterRecordSet(pres.RecordSet, r.KeyPrefix)
+			}
+		}
+	}
+	return res
+}
+
+// filterRecordSet returns the message sets in the record set with a message whose key has the
+// prefix. A partial trailing message set is kept so the consumer knows to fetch more. If the last
+// whole message set is dropped it's replaced with an empty one, just its last offset and a zero
+// size, so the consumer can move past the offsets filtered out.
+func filterRecordSet(recordSet, keyPrefix []byte) []byte {
+	const headerLen = 12 // offset and size
+	var filtered, skipped []byte
+	for len(recordSet) > 0 {
+		if len(recordSet) < headerLen {
+			break
+		}
+		n := headerLen + int(protocol.Encoding.Uint32(recordSet[8:headerLen]))
+		if len(recordSet) < n {
+			break
+		}
+		set := recordSet[:n]
+		recordSet = recordSet[n:]
+		if matchesKeyPrefix(set, keyPrefix) {
+			filtered = append(filtered, set...)
+			skipped = nil
+		} else {
+			skipped = set
+		}
+	}
+	if skipped != nil {
+		var header [headerLen]byte
+		protocol.Encoding.PutUint64(header[:8], uint64(protocol.LastOffset(skipped)))
+		filtered = append(filtered, header[:]...)
+	}
+	return append(filtered, recordSet...)
+}
+
+func matchesKeyPrefix(set, keyPrefix []byte) bool {
+	records, err := protocol.DecodeRecords(set)
+	if err != nil {
+		// let the consumer see and handle the corrupt set.
+		return true
+	}
+	for _, r := range records {
+		if bytes.HasPrefix(r.Key, keyPrefix) {
+			return true
+		}
+	}
+	return false
+}
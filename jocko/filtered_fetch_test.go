@@ -0,0 +1,64 @@
+package jocko
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestFilterRecordSet(t *testing.T) {
+	set := func(offset int64, keys ...string) []byte {
+		ms := &protocol.MessageSet{Offset: offset}
+		for _, k := range keys {
+			ms.Messages = append(ms.Messages, &protocol.Message{Key: []byte(k), Value: []byte("v")})
+		}
+		b, err := protocol.Encode(ms)
+		require.NoError(t, err)
+		return b
+	}
+	join := func(sets ...[]byte) (b []byte) {
+		for _, s := range sets {
+			b = append(b, s...)
+		}
+		return b
+	}
+	skipped := func(offset int64) []byte {
+		b := make([]byte, 12)
+		protocol.Encoding.PutUint64(b, uint64(offset))
+		return b
+	}
+	partial := set(4, "a-4")[:15]
+
+	tests := []struct {
+		name string
+		in   []byte
+		out  []byte
+	}{
+		{
+			name: "keeps matching sets",
+			in:   join(set(0, "a-0"), set(1, "b-1"), set(2, "b-2", "a-2"), set(3, "a-3")),
+			out:  join(set(0, "a-0"), set(2, "b-2", "a-2"), set(3, "a-3")),
+		},
+		{
+			name: "marks trailing skipped offset",
+			in:   join(set(0, "a-0"), set(1, "b-1"), set(2, "b-2")),
+			out:  join(set(0, "a-0"), skipped(2)),
+		},
+		{
+			name: "keeps partial trailing set",
+			in:   join(set(0, "b-0"), set(3, "a-3"), partial),
+			out:  join(set(3, "a-3"), partial),
+		},
+		{
+			name: "nothing matches",
+			in:   join(set(0, "b-0"), set(1, "b-1")),
+			out:  skipped(1),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.out, filterRecordSet(test.in, []byte("a-")))
+		})
+	}
+}
@@ -15,6 +15,13 @@ func init() {
 	registerCommand(structs.RegisterPartitionRequestType, (*FSM).applyRegisterPartition)
 	registerCommand(structs.DeregisterPartitionRequestType, (*FSM).applyDeregisterPartition)
 	registerCommand(structs.RegisterGroupRequestType, (*FSM).applyRegisterGroup)
+	registerCommand(structs.BatchNodesRequestType, (*FSM).applyBatchNodes)
+	registerCommand(structs.NodeMaintenanceRequestType, (*FSM).applyNodeMaintenance)
+	registerCommand(structs.UpdateFeaturesRequestType, (*FSM).applyUpdateFeatures)
+	registerCommand(structs.InitProducerIDRequestType, (*FSM).applyInitProducerID)
+	registerCommand(structs.AddTxnPartitionsRequestType, (*FSM).applyAddTxnPartitions)
+	registerCommand(structs.EndTxnRequestType, (*FSM).applyEndTxn)
+	registerCommand(structs.AssignPartitionRequestType, (*FSM).applyAssignPartition)
 }
 
 func (c *FSM) applyRegisterGroup(buf []byte, index uint64) interface{} {
@@ -59,6 +66,96 @@ func (c *FSM) applyDeregisterNode(buf []byte, index uint64) interface{} {
 	return nil
 }
 
+func (c *FSM) applyBatchNodes(buf []byte, index uint64) interface{} {
+	var req structs.BatchNodesRequest
+	if err := structs.Decode(buf, &req); err != nil {
+		panic(fmt.Errorf("failed to decode request: %v", err))
+	}
+
+	if err := c.state.EnsureNodes(index, req.Register, req.Deregister); err != nil {
+		log.Error.Printf("EnsureNodes error: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+func (c *FSM) applyNodeMaintenance(buf []byte, index uint64) interface{} {
+	var req structs.NodeMaintenanceRequest
+	if err := structs.Decode(buf, &req); err != nil {
+		panic(fmt.Errorf("failed to decode request: %v", err))
+	}
+
+	if err := c.state.SetNodeMaintenance(index, req.Node, req.Enabled); err != nil {
+		log.Error.Printf("SetNodeMaintenance error: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+func (c *FSM) applyUpdateFeatures(buf []byte, index uint64) interface{} {
+	var req structs.UpdateFeaturesRequest
+	if err := structs.Decode(buf, &req); err != nil {
+		panic(fmt.Errorf("failed to decode request: %v", err))
+	}
+
+	if err := c.state.SetFeatureLevels(index, req.Levels); err != nil {
+		log.Error.Printf("SetFeatureLevels error: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+// applyInitProducerID returns the initialized producer.
+func (c *FSM) applyInitProducerID(buf []byte, index uint64) interface{} {
+	var req structs.InitProducerIDRequest
+	if err := structs.Decode(buf, &req); err != nil {
+		panic(fmt.Errorf("failed to decode request: %v", err))
+	}
+
+	p, err := c.state.InitProducer(index, req.TransactionalID)
+	if err != nil {
+		log.Error.Printf("InitProducer error: %s", err)
+		return err
+	}
+
+	return p
+}
+
+// applyAddTxnPartitions returns the producer with the partitions and groups in its transaction.
+func (c *FSM) applyAddTxnPartitions(buf []byte, index uint64) interface{} {
+	var req structs.AddTxnPartitionsRequest
+	if err := structs.Decode(buf, &req); err != nil {
+		panic(fmt.Errorf("failed to decode request: %v", err))
+	}
+
+	p, err := c.state.AddTxnPartitions(index, &req)
+	if err != nil {
+		log.Error.Printf("AddTxnPartitions error: %s", err)
+		return err
+	}
+
+	return p
+}
+
+// applyEndTxn returns the producer whose transaction ended.
+func (c *FSM) applyEndTxn(buf []byte, index uint64) interface{} {
+	var req structs.EndTxnRequest
+	if err := structs.Decode(buf, &req); err != nil {
+		panic(fmt.Errorf("failed to decode request: %v", err))
+	}
+
+	p, err := c.state.EndTxn(index, req.TransactionalID, req.ProducerID, req.ProducerEpoch)
+	if err != nil {
+		log.Error.Printf("EndTxn error: %s", err)
+		return err
+	}
+
+	return p
+}
+
 func (c *FSM) applyRegisterTopic(buf []byte, index uint64) interface{} {
 	var req structs.RegisterTopicRequest
 	if err := structs.Decode(buf, &req); err != nil {
@@ -69,6 +166,9 @@ func (c *FSM) applyRegisterTopic(buf []byte, index uint64) interface{} {
 		log.Error.Printf("EnsureTopic error: %s", err)
 		return err
 	}
+	if c.onTopicChange != nil {
+		c.onTopicChange(req.Topic.Topic, false)
+	}
 
 	return nil
 }
@@ -84,6 +184,10 @@ func (c *FSM) applyDeregisterTopic(buf []byte, index uint64) interface{} {
 		return err
 	}
 
+	if c.onTopicChange != nil {
+		c.onTopicChange(req.Topic.Topic, true)
+	}
+
 	return nil
 }
 
@@ -101,6 +205,25 @@ func (c *FSM) applyRegisterPartition(buf []byte, index uint64) interface{} {
 	return nil
 }
 
+// applyAssignPartition returns whether the partition was assigned, false if its topic's deleted.
+func (c *FSM) applyAssignPartition(buf []byte, index uint64) interface{} {
+	var req structs.AssignPartitionRequest
+	if err := structs.Decode(buf, &req); err != nil {
+		panic(fmt.Errorf("failed to decode request: %v", err))
+	}
+
+	assigned, err := c.state.AssignPartition(index, &req.Partition)
+	if err != nil {
+		log.Error.Printf("AssignPartition error: %s", err)
+		return err
+	}
+	if assigned && c.onTopicChange != nil {
+		c.onTopicChange(req.Partition.Topic, false)
+	}
+
+	return assigned
+}
+
 func (c *FSM) applyDeregisterPartition(buf []byte, index uint64) interface{} {
 	var req structs.DeregisterPartitionRequest
 	if err := structs.Decode(buf, &req); err != nil {
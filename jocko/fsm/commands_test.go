@@ -1,6 +1,7 @@
 package fsm
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/hashicorp/raft"
@@ -38,6 +39,187 @@ func TestRegisterNode(t *testing.T) {
 	}
 }
 
+func TestBatchNodes(t *testing.T) {
+	fsm, err := New(stdopentracing.GlobalTracer())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := fsm.state.EnsureNode(1, &structs.Node{Node: 1}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req := structs.BatchNodesRequest{
+		Register:   []structs.Node{{Node: 2}, {Node: 3}},
+		Deregister: []structs.Node{{Node: 1}},
+	}
+	buf, err := structs.Encode(structs.BatchNodesRequestType, req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	resp := fsm.Apply(makeLog(buf))
+	if resp != nil {
+		t.Fatalf("resp: %v", resp)
+	}
+
+	_, nodes, err := fsm.state.GetNodes()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(nodes) != 2 || nodes[0].Node != 2 || nodes[1].Node != 3 {
+		t.Fatalf("bad nodes: %v", nodes)
+	}
+}
+
+func TestNodeMaintenance(t *testing.T) {
+	fsm, err := New(stdopentracing.GlobalTracer())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := fsm.state.EnsureNode(1, &structs.Node{Node: 1, Meta: map[string]string{"name": "broker-1"}}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for _, enabled := range []bool{true, false} {
+		buf, err := structs.Encode(structs.NodeMaintenanceRequestType, structs.NodeMaintenanceRequest{Node: 1, Enabled: enabled})
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if resp := fsm.Apply(makeLog(buf)); resp != nil {
+			t.Fatalf("resp: %v", resp)
+		}
+		_, node, err := fsm.state.GetNode(1)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if node.InMaintenance() != enabled || node.Meta["name"] != "broker-1" {
+			t.Fatalf("bad node: %v", node)
+		}
+	}
+
+	buf, err := structs.Encode(structs.NodeMaintenanceRequestType, structs.NodeMaintenanceRequest{Node: 2, Enabled: true})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp := fsm.Apply(makeLog(buf)); resp == nil {
+		t.Fatalf("expected unknown node error")
+	}
+}
+
+func TestUpdateFeatures(t *testing.T) {
+	fsm, err := New(stdopentracing.GlobalTracer())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for i, levels := range []map[string]int16{{"a": 1, "b": 2}, {"a": 0, "b": 3, "c": 0}} {
+		buf, err := structs.Encode(structs.UpdateFeaturesRequestType, structs.UpdateFeaturesRequest{Levels: levels})
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		l := makeLog(buf)
+		l.Index = uint64(i + 1)
+		if resp := fsm.Apply(l); resp != nil {
+			t.Fatalf("resp: %v", resp)
+		}
+	}
+	idx, features, err := fsm.state.GetFeatures()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if idx != 2 || len(features) != 1 || features[0].Name != "b" || features[0].Level != 3 || features[0].CreateIndex != 1 {
+		t.Fatalf("bad features: %d: %v", idx, features)
+	}
+}
+
+func TestInitProducerID(t *testing.T) {
+	fsm, err := New(stdopentracing.GlobalTracer())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	initProducer := func(index uint64, transactionalID string) *structs.Producer {
+		buf, err := structs.Encode(structs.InitProducerIDRequestType, structs.InitProducerIDRequest{TransactionalID: transactionalID})
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		l := makeLog(buf)
+		l.Index = index
+		p, ok := fsm.Apply(l).(*structs.Producer)
+		if !ok {
+			t.Fatalf("expected producer")
+		}
+		return p
+	}
+	if p := initProducer(1, ""); p.ProducerID != 1 || p.ProducerEpoch != 0 {
+		t.Fatalf("bad producer: %v", p)
+	}
+	if p := initProducer(2, "txn"); p.ProducerID != 2 || p.ProducerEpoch != 0 {
+		t.Fatalf("bad producer: %v", p)
+	}
+	// reinitializing the transactional ID's producer bumps its epoch.
+	if p := initProducer(3, "txn"); p.ProducerID != 2 || p.ProducerEpoch != 1 {
+		t.Fatalf("bad producer: %v", p)
+	}
+	idx, p, err := fsm.state.GetProducer("txn")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if idx != 3 || p.ProducerEpoch != 1 || p.CreateIndex != 2 {
+		t.Fatalf("bad producer: %d: %v", idx, p)
+	}
+}
+
+func TestTxnPartitions(t *testing.T) {
+	fsm, err := New(stdopentracing.GlobalTracer())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	apply := func(index uint64, typ structs.MessageType, req interface{}) interface{} {
+		buf, err := structs.Encode(typ, req)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		l := makeLog(buf)
+		l.Index = index
+		return fsm.Apply(l)
+	}
+	apply(1, structs.InitProducerIDRequestType, structs.InitProducerIDRequest{TransactionalID: "txn"})
+	add := func(index uint64, epoch int16, tp structs.TxnPartition, group string, offset int64) interface{} {
+		return apply(index, structs.AddTxnPartitionsRequestType, structs.AddTxnPartitionsRequest{
+			TransactionalID: "txn",
+			ProducerID:      1,
+			ProducerEpoch:   epoch,
+			Partitions:      []structs.TxnPartition{tp},
+			Groups:          []string{group},
+			Offsets:         []structs.TxnOffset{{Group: group, Topic: "in", Offset: offset}},
+		})
+	}
+	add(2, 0, structs.TxnPartition{Topic: "a", Partition: 0}, "g", 1)
+	add(3, 0, structs.TxnPartition{Topic: "a", Partition: 0}, "h", 1)
+	p, ok := add(4, 0, structs.TxnPartition{Topic: "a", Partition: 0}, "g", 2).(*structs.Producer)
+	if !ok || !p.InTxn() || len(p.Partitions) != 1 || !reflect.DeepEqual(p.Groups, []string{"g", "h"}) {
+		t.Fatalf("bad producer: %v", p)
+	}
+	// a group's later offset replaces its earlier one.
+	if !reflect.DeepEqual(p.Offsets, []structs.TxnOffset{{Group: "g", Topic: "in", Offset: 2}, {Group: "h", Topic: "in", Offset: 1}}) {
+		t.Fatalf("bad offsets: %v", p.Offsets)
+	}
+	// a fenced epoch can't add to the transaction or end it.
+	if _, ok := add(4, 1, structs.TxnPartition{Topic: "b", Partition: 0}, "g", 3).(error); !ok {
+		t.Fatalf("expected error")
+	}
+	if _, ok := apply(5, structs.EndTxnRequestType, structs.EndTxnRequest{TransactionalID: "txn", ProducerID: 1, ProducerEpoch: 1}).(error); !ok {
+		t.Fatalf("expected error")
+	}
+	if p, ok := apply(6, structs.EndTxnRequestType, structs.EndTxnRequest{TransactionalID: "txn", ProducerID: 1}).(*structs.Producer); !ok || p.InTxn() {
+		t.Fatalf("bad producer: %v", p)
+	}
+	_, p, err = fsm.state.GetProducer("txn")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if p.InTxn() || p.ModifyIndex != 6 {
+		t.Fatalf("bad producer: %v", p)
+	}
+}
+
 func TestRegisterTopic(t *testing.T) {
 	fsm, err := New(stdopentracing.GlobalTracer())
 	if err != nil {
@@ -100,6 +282,54 @@ func TestRegisterPartition(t *testing.T) {
 	}
 }
 
+func TestAssignPartition(t *testing.T) {
+	fsm, err := New(stdopentracing.GlobalTracer())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	assign := func(p structs.Partition) interface{} {
+		buf, err := structs.Encode(structs.AssignPartitionRequestType, structs.AssignPartitionRequest{Partition: p})
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		return fsm.Apply(makeLog(buf))
+	}
+
+	// partitions of topics that don't exist aren't registered.
+	if resp := assign(structs.Partition{ID: 1, Partition: 1, Topic: "test-topic", AR: []int32{1, 2}}); resp != false {
+		t.Fatalf("resp: %v", resp)
+	}
+	_, partition, err := fsm.state.GetPartition("test-topic", 1)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if partition != nil {
+		t.Fatalf("partition registered: %v", partition)
+	}
+
+	if err := fsm.state.EnsureTopic(1, &structs.Topic{Topic: "test-topic", Partitions: map[int32][]int32{0: {1}, 1: {1}}}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp := assign(structs.Partition{ID: 1, Partition: 1, Topic: "test-topic", AR: []int32{1, 2}}); resp != true {
+		t.Fatalf("resp: %v", resp)
+	}
+	_, partition, err = fsm.state.GetPartition("test-topic", 1)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if partition == nil || !reflect.DeepEqual(partition.AR, []int32{1, 2}) {
+		t.Fatalf("bad partition: %v", partition)
+	}
+	_, topic, err := fsm.state.GetTopic("test-topic")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if exp := map[int32][]int32{0: {1}, 1: {1, 2}}; !reflect.DeepEqual(topic.Partitions, exp) {
+		t.Fatalf("bad assignment: %v, expected: %v", topic.Partitions, exp)
+	}
+}
+
 func TestRegisterGroup(t *testing.T) {
 	fsm, err := New(stdopentracing.GlobalTracer())
 	if err != nil {
@@ -3,6 +3,7 @@ package fsm
 import (
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"strings"
 	"sync"
@@ -42,6 +43,17 @@ func registerCommand(msg structs.MessageType, fn unboundCommand) {
 type NodeID int32
 type Tracer opentracing.Tracer
 
+// OnTopicChange is called after a topic is registered or deregistered.
+type OnTopicChange func(topic string, deleted bool)
+
+// OnApply is called after each raft log entry is applied with the entry's index, type, and
+// msgpack encoded request.
+type OnApply func(index uint64, msgType structs.MessageType, buf []byte)
+
+// OnSnapshot is called when raft snapshots the state with the index of the last entry applied to
+// it.
+type OnSnapshot func(index uint64)
+
 // FSM implements a finite state machine used with Raft to provide strong consistency.
 type FSM struct {
 	apply     map[structs.MessageType]command
@@ -49,18 +61,33 @@ type FSM struct {
 	state     *Store
 	tracer    opentracing.Tracer
 	nodeID    NodeID
+	// onTopicChange, if set, is called after a topic is registered or deregistered.
+	onTopicChange OnTopicChange
+	// onApply, if set, is called after each log entry is applied.
+	onApply OnApply
+	// onSnapshot, if set, is called when the state's snapshotted.
+	onSnapshot OnSnapshot
 }
 
 // New returns a new FSM instance.
 func New(args ...interface{}) (*FSM, error) {
 	var nodeID NodeID
 	var tracer Tracer
+	var onTopicChange OnTopicChange
+	var onApply OnApply
+	var onSnapshot OnSnapshot
 	for _, arg := range args {
 		switch a := arg.(type) {
 		case NodeID:
 			nodeID = a
 		case Tracer:
 			tracer = a
+		case OnTopicChange:
+			onTopicChange = a
+		case OnApply:
+			onApply = a
+		case OnSnapshot:
+			onSnapshot = a
 		}
 	}
 	store, err := NewStore(tracer, nodeID)
@@ -68,10 +95,13 @@ func New(args ...interface{}) (*FSM, error) {
 		return nil, err
 	}
 	fsm := &FSM{
-		apply:  make(map[structs.MessageType]command),
-		state:  store,
-		tracer: tracer,
-		nodeID: nodeID,
+		apply:         make(map[structs.MessageType]command),
+		state:         store,
+		tracer:        tracer,
+		nodeID:        nodeID,
+		onTopicChange: onTopicChange,
+		onApply:       onApply,
+		onSnapshot:    onSnapshot,
 	}
 	for msg, fn := range commands {
 		thisFn := fn
@@ -92,10 +122,15 @@ func (c *FSM) State() *Store {
 func (c *FSM) Apply(l *raft.Log) interface{} {
 	buf := l.Data
 	msgType := structs.MessageType(buf[0])
-	if fn := c.apply[msgType]; fn != nil {
-		return fn(buf[1:], l.Index)
+	fn := c.apply[msgType]
+	if fn == nil {
+		return nil
 	}
-	return nil
+	res := fn(buf[1:], l.Index)
+	if c.onApply != nil {
+		c.onApply(l.Index, msgType, buf[1:])
+	}
+	return res
 }
 
 func (c *FSM) Restore(old io.ReadCloser) error {
@@ -146,7 +181,11 @@ func (c *FSM) Restore(old io.ReadCloser) error {
 }
 
 func (c *FSM) Snapshot() (raft.FSMSnapshot, error) {
-	return &snapshot{c.state.Snapshot()}, nil
+	snap := &snapshot{c.state.Snapshot()}
+	if c.onSnapshot != nil {
+		c.onSnapshot(snap.state.LastIndex())
+	}
+	return snap, nil
 }
 
 // schemaFn is an interface function used to create and return
@@ -314,6 +353,67 @@ func (s *Store) deleteNodeTxn(tx *memdb.Txn, idx uint64, id int32) error {
 	return nil
 }
 
+// EnsureNodes registers and deregisters the nodes in one transaction.
+func (s *Store) EnsureNodes(idx uint64, register, deregister []structs.Node) error {
+	sp := s.tracer.StartSpan("store: ensure nodes")
+	sp.LogKV("register", len(register), "deregister", len(deregister))
+	sp.SetTag("node id", s.nodeID)
+	defer sp.Finish()
+
+	tx := s.db.Txn(true)
+	defer tx.Abort()
+
+	for i := range register {
+		if err := s.ensureNodeTxn(tx, idx, &register[i]); err != nil {
+			return err
+		}
+	}
+	for _, node := range deregister {
+		if err := s.deleteNodeTxn(tx, idx, node.Node); err != nil {
+			return err
+		}
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// SetNodeMaintenance puts the node into or takes it out of maintenance.
+func (s *Store) SetNodeMaintenance(idx uint64, id int32, enabled bool) error {
+	sp := s.tracer.StartSpan("store: set node maintenance")
+	sp.LogKV("node", id, "enabled", enabled)
+	sp.SetTag("node id", s.nodeID)
+	defer sp.Finish()
+
+	tx := s.db.Txn(true)
+	defer tx.Abort()
+
+	existing, err := tx.First("nodes", "id", id)
+	if err != nil {
+		return fmt.Errorf("node lookup failed: %s", err)
+	}
+	if existing == nil {
+		return fmt.Errorf("unknown node: %d", id)
+	}
+	// copy the node rather than modify the one held by the store.
+	n := *existing.(*structs.Node)
+	n.Meta = make(map[string]string, len(n.Meta)+1)
+	for k, v := range existing.(*structs.Node).Meta {
+		n.Meta[k] = v
+	}
+	if enabled {
+		n.Meta[structs.NodeMaintenanceMeta] = "1"
+	} else {
+		delete(n.Meta, structs.NodeMaintenanceMeta)
+	}
+	if err := s.ensureNodeTxn(tx, idx, &n); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
 func (s *Store) EnsureRegistration(idx uint64, req *structs.RegisterNodeRequest) error {
 	sp := s.tracer.StartSpan("store: ensure registration")
 	s.vlog(sp, "req", req)
@@ -408,6 +508,11 @@ func (s *Store) ensureTopicTxn(tx *memdb.Txn, idx uint64, topic *structs.Topic)
 	}
 
 	if t != nil {
+		if t.ID != "" {
+			// topic ids are immutable.
+			topic.ID = t.ID
+			topic.CreateTimestamp = t.CreateTimestamp
+		}
 		topic.CreateIndex = t.CreateIndex
 		topic.ModifyIndex = idx
 	} else {
@@ -448,6 +553,28 @@ func (s *Store) GetTopic(id string) (uint64, *structs.Topic, error) {
 	return idx, nil, nil
 }
 
+// GetTopicByID is used to get the topic with the given topic ID.
+func (s *Store) GetTopicByID(id string) (uint64, *structs.Topic, error) {
+	sp := s.tracer.StartSpan("store: get topic by id")
+	sp.LogKV("id", id)
+	sp.SetTag("node id", s.nodeID)
+	defer sp.Finish()
+
+	tx := s.db.Txn(false)
+	defer tx.Abort()
+	idx := maxIndexTxn(tx, "topics")
+
+	topic, err := tx.First("topics", "topic_id", id)
+	if err != nil {
+		return 0, nil, fmt.Errorf("topic lookup failed: %s", err)
+	}
+	if topic != nil {
+		return idx, topic.(*structs.Topic), nil
+	}
+
+	return idx, nil, nil
+}
+
 func (s *Store) GetTopics() (uint64, []*structs.Topic, error) {
 	sp := s.tracer.StartSpan("store: get topics")
 	sp.SetTag("node id", s.nodeID)
@@ -693,6 +820,43 @@ func (s *Store) ensurePartitionTxn(tx *memdb.Txn, idx uint64, partition *structs
 	return nil
 }
 
+// AssignPartition registers the partition and sets its replicas in its topic's assignment in one
+// transaction. It returns false, changing nothing, if the topic doesn't exist, e.g. it's since been
+// deleted.
+func (s *Store) AssignPartition(idx uint64, partition *structs.Partition) (bool, error) {
+	sp := s.tracer.StartSpan("store: assign partition")
+	s.vlog(sp, "partition", partition)
+	sp.SetTag("node id", s.nodeID)
+	defer sp.Finish()
+
+	tx := s.db.Txn(true)
+	defer tx.Abort()
+
+	existing, err := tx.First("topics", "id", partition.Topic)
+	if err != nil {
+		return false, fmt.Errorf("topic lookup failed: %s", err)
+	}
+	if existing == nil {
+		return false, nil
+	}
+	// the stored topic's copied, memdb's objects mustn't be modified in place.
+	topic := *existing.(*structs.Topic)
+	topic.Partitions = make(map[int32][]int32, len(topic.Partitions)+1)
+	for id, ar := range existing.(*structs.Topic).Partitions {
+		topic.Partitions[id] = ar
+	}
+	topic.Partitions[partition.ID] = partition.AR
+	if err := s.ensurePartitionTxn(tx, idx, partition); err != nil {
+		return false, err
+	}
+	if err := s.ensureTopicTxn(tx, idx, &topic); err != nil {
+		return false, err
+	}
+
+	tx.Commit()
+	return true, nil
+}
+
 // GetPartition is used to get partitions.
 func (s *Store) GetPartition(topic string, id int32) (uint64, *structs.Partition, error) {
 	sp := s.tracer.StartSpan("store: get partition")
@@ -791,6 +955,245 @@ func (s *Store) deletePartitionTxn(tx *memdb.Txn, idx uint64, topic string, id i
 	return nil
 }
 
+// SetFeatureLevels sets the finalized levels of the features, removing those set to level 0.
+func (s *Store) SetFeatureLevels(idx uint64, levels map[string]int16) error {
+	sp := s.tracer.StartSpan("store: set feature levels")
+	sp.LogKV("levels", levels)
+	sp.SetTag("node id", s.nodeID)
+	defer sp.Finish()
+
+	tx := s.db.Txn(true)
+	defer tx.Abort()
+
+	for name, level := range levels {
+		existing, err := tx.First("features", "id", name)
+		if err != nil {
+			return fmt.Errorf("feature lookup failed: %s", err)
+		}
+		if level <= 0 {
+			if existing == nil {
+				continue
+			}
+			if err := tx.Delete("features", existing); err != nil {
+				return fmt.Errorf("failed deleting feature: %s", err)
+			}
+			continue
+		}
+		f := &structs.Feature{Name: name, Level: level}
+		f.CreateIndex = idx
+		if existing != nil {
+			f.CreateIndex = existing.(*structs.Feature).CreateIndex
+		}
+		f.ModifyIndex = idx
+		if err := tx.Insert("features", f); err != nil {
+			return fmt.Errorf("failed inserting feature: %s", err)
+		}
+	}
+	if err := tx.Insert("index", &IndexEntry{"features", idx}); err != nil {
+		return fmt.Errorf("failed updating index: %s", err)
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// GetFeatures returns the finalized features. The index is the raft index they were last updated
+// at, so it's their epoch.
+func (s *Store) GetFeatures() (uint64, []*structs.Feature, error) {
+	sp := s.tracer.StartSpan("store: get features")
+	sp.SetTag("node id", s.nodeID)
+	defer sp.Finish()
+
+	tx := s.db.Txn(false)
+	defer tx.Abort()
+	idx := maxIndexTxn(tx, "features")
+	it, err := tx.Get("features", "id")
+	if err != nil {
+		return 0, nil, err
+	}
+	var features []*structs.Feature
+	for next := it.Next(); next != nil; next = it.Next() {
+		features = append(features, next.(*structs.Feature))
+	}
+	return idx, features, nil
+}
+
+// InitProducer allocates a producer ID, or bumps the epoch of the transactional ID's producer.
+// Each allocation's a raft command of its own, so its index is a producer ID unique to the
+// cluster. A producer whose epoch would overflow gets a new ID.
+func (s *Store) InitProducer(idx uint64, transactionalID string) (*structs.Producer, error) {
+	sp := s.tracer.StartSpan("store: init producer")
+	sp.SetTag("transactional id", transactionalID)
+	sp.SetTag("node id", s.nodeID)
+	defer sp.Finish()
+
+	p := &structs.Producer{TransactionalID: transactionalID, ProducerID: int64(idx)}
+	p.CreateIndex = idx
+	p.ModifyIndex = idx
+	if transactionalID == "" {
+		return p, nil
+	}
+
+	tx := s.db.Txn(true)
+	defer tx.Abort()
+
+	existing, err := tx.First("producers", "id", transactionalID)
+	if err != nil {
+		return nil, fmt.Errorf("producer lookup failed: %s", err)
+	}
+	if existing != nil {
+		if e := existing.(*structs.Producer); e.ProducerEpoch < math.MaxInt16 {
+			p.ProducerID = e.ProducerID
+			p.ProducerEpoch = e.ProducerEpoch + 1
+			p.CreateIndex = e.CreateIndex
+		}
+	}
+	if err := tx.Insert("producers", p); err != nil {
+		return nil, fmt.Errorf("failed inserting producer: %s", err)
+	}
+	if err := tx.Insert("index", &IndexEntry{"producers", idx}); err != nil {
+		return nil, fmt.Errorf("failed updating index: %s", err)
+	}
+
+	tx.Commit()
+	return p, nil
+}
+
+// AddTxnPartitions adds the partitions, groups, and offsets to the producer's ongoing transaction,
+// starting one if it's not in one. A group's offset of a partition replaces the one committed
+// earlier in the transaction. It fails if the producer's ID or epoch isn't the transactional ID's
+// current one.
+func (s *Store) AddTxnPartitions(idx uint64, req *structs.AddTxnPartitionsRequest) (*structs.Producer, error) {
+	sp := s.tracer.StartSpan("store: add txn partitions")
+	sp.SetTag("transactional id", req.TransactionalID)
+	sp.SetTag("node id", s.nodeID)
+	defer sp.Finish()
+
+	tx := s.db.Txn(true)
+	defer tx.Abort()
+
+	p, err := currentProducerTxn(tx, req.TransactionalID, req.ProducerID, req.ProducerEpoch)
+	if err != nil {
+		return nil, err
+	}
+	for _, tp := range req.Partitions {
+		if !containsTxnPartition(p.Partitions, tp) {
+			p.Partitions = append(p.Partitions, tp)
+		}
+	}
+	for _, group := range req.Groups {
+		if !containsString(p.Groups, group) {
+			p.Groups = append(p.Groups, group)
+		}
+	}
+offsets:
+	for _, o := range req.Offsets {
+		for i, cur := range p.Offsets {
+			if cur.Group == o.Group && cur.Topic == o.Topic && cur.Partition == o.Partition {
+				p.Offsets[i] = o
+				continue offsets
+			}
+		}
+		p.Offsets = append(p.Offsets, o)
+	}
+	p.ModifyIndex = idx
+	if err := tx.Insert("producers", p); err != nil {
+		return nil, fmt.Errorf("failed inserting producer: %s", err)
+	}
+	if err := tx.Insert("index", &IndexEntry{"producers", idx}); err != nil {
+		return nil, fmt.Errorf("failed updating index: %s", err)
+	}
+
+	tx.Commit()
+	return p, nil
+}
+
+// EndTxn ends the producer's ongoing transaction, clearing its partitions, groups, and offsets. It
+// fails if the producer's ID or epoch isn't the transactional ID's current one.
+func (s *Store) EndTxn(idx uint64, transactionalID string, producerID int64, producerEpoch int16) (*structs.Producer, error) {
+	sp := s.tracer.StartSpan("store: end txn")
+	sp.SetTag("transactional id", transactionalID)
+	sp.SetTag("node id", s.nodeID)
+	defer sp.Finish()
+
+	tx := s.db.Txn(true)
+	defer tx.Abort()
+
+	p, err := currentProducerTxn(tx, transactionalID, producerID, producerEpoch)
+	if err != nil {
+		return nil, err
+	}
+	p.Partitions = nil
+	p.Groups = nil
+	p.Offsets = nil
+	p.ModifyIndex = idx
+	if err := tx.Insert("producers", p); err != nil {
+		return nil, fmt.Errorf("failed inserting producer: %s", err)
+	}
+	if err := tx.Insert("index", &IndexEntry{"producers", idx}); err != nil {
+		return nil, fmt.Errorf("failed updating index: %s", err)
+	}
+
+	tx.Commit()
+	return p, nil
+}
+
+// currentProducerTxn returns a copy of the transactional ID's producer to update, if the producer
+// ID and epoch are its current ones.
+func currentProducerTxn(tx *memdb.Txn, transactionalID string, producerID int64, producerEpoch int16) (*structs.Producer, error) {
+	existing, err := tx.First("producers", "id", transactionalID)
+	if err != nil {
+		return nil, fmt.Errorf("producer lookup failed: %s", err)
+	}
+	if existing == nil {
+		return nil, fmt.Errorf("producer of transactional id %q not found", transactionalID)
+	}
+	e := existing.(*structs.Producer)
+	if e.ProducerID != producerID || e.ProducerEpoch != producerEpoch {
+		return nil, fmt.Errorf("producer %d epoch %d isn't transactional id %q's current producer %d epoch %d", producerID, producerEpoch, transactionalID, e.ProducerID, e.ProducerEpoch)
+	}
+	p := *e
+	p.Partitions = append([]structs.TxnPartition(nil), e.Partitions...)
+	p.Groups = append([]string(nil), e.Groups...)
+	p.Offsets = append([]structs.TxnOffset(nil), e.Offsets...)
+	return &p, nil
+}
+
+func containsTxnPartition(partitions []structs.TxnPartition, tp structs.TxnPartition) bool {
+	for _, p := range partitions {
+		if p == tp {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// GetProducer returns the transactional ID's producer, nil if it hasn't been initialized.
+func (s *Store) GetProducer(transactionalID string) (uint64, *structs.Producer, error) {
+	sp := s.tracer.StartSpan("store: get producer")
+	sp.SetTag("transactional id", transactionalID)
+	sp.SetTag("node id", s.nodeID)
+	defer sp.Finish()
+
+	tx := s.db.Txn(false)
+	defer tx.Abort()
+	idx := maxIndexTxn(tx, "producers")
+	p, err := tx.First("producers", "id", transactionalID)
+	if err != nil || p == nil {
+		return idx, nil, err
+	}
+	return idx, p.(*structs.Producer), nil
+}
+
 // maxIndex is a helper used to retrieve the highest known index amongst a set of tables in the db.
 func (s *Store) maxIndex(tables ...string) uint64 {
 	tx := s.db.Txn(false)
@@ -937,6 +1340,14 @@ func topicsTableSchema() *memdb.TableSchema {
 					Lowercase: true,
 				},
 			},
+			"topic_id": &memdb.IndexSchema{
+				Name:         "topic_id",
+				AllowMissing: true,
+				Unique:       true,
+				Indexer: &memdb.StringFieldIndex{
+					Field: "ID",
+				},
+			},
 		},
 	}
 }
@@ -1009,12 +1420,49 @@ func groupTableSchema() *memdb.TableSchema {
 	}
 }
 
+// featuresTableSchema returns a new table schema used for storing the finalized feature levels.
+func featuresTableSchema() *memdb.TableSchema {
+	return &memdb.TableSchema{
+		Name: "features",
+		Indexes: map[string]*memdb.IndexSchema{
+			"id": &memdb.IndexSchema{
+				Name:         "id",
+				AllowMissing: false,
+				Unique:       true,
+				Indexer: &memdb.StringFieldIndex{
+					Field: "Name",
+				},
+			},
+		},
+	}
+}
+
+// producersTableSchema returns a new table schema used for storing the transactional IDs'
+// producers.
+func producersTableSchema() *memdb.TableSchema {
+	return &memdb.TableSchema{
+		Name: "producers",
+		Indexes: map[string]*memdb.IndexSchema{
+			"id": &memdb.IndexSchema{
+				Name:         "id",
+				AllowMissing: false,
+				Unique:       true,
+				Indexer: &memdb.StringFieldIndex{
+					Field: "TransactionalID",
+				},
+			},
+		},
+	}
+}
+
 func init() {
 	registerSchema(indexTableSchema)
 	registerSchema(nodesTableSchema)
 	registerSchema(topicsTableSchema)
 	registerSchema(partitionsTableSchema)
 	registerSchema(groupTableSchema)
+	registerSchema(featuresTableSchema)
+	registerSchema(producersTableSchema)
 
 	e := os.Getenv("JOCKODEBUG")
 	if strings.Contains(e, "fsm=1") {
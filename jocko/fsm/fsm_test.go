@@ -135,6 +135,42 @@ func TestStore_RegisterTopic(t *testing.T) {
 	}
 }
 
+func TestStore_TopicID(t *testing.T) {
+	s := testStore(t)
+
+	if err := s.EnsureTopic(0, &structs.Topic{ID: "id1", Topic: "topic1"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, top, err := s.GetTopicByID("id1"); err != nil || top == nil || top.Topic != "topic1" {
+		t.Fatalf("bad: %#v (err: %s)", top, err)
+	}
+
+	// the id can't be changed by updating the topic
+	if err := s.EnsureTopic(1, &structs.Topic{ID: "id2", Topic: "topic1"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, top, err := s.GetTopic("topic1"); err != nil || top == nil || top.ID != "id1" {
+		t.Fatalf("bad: %#v (err: %s)", top, err)
+	}
+	if _, top, err := s.GetTopicByID("id2"); err != nil || top != nil {
+		t.Fatalf("bad: %#v (err: %s)", top, err)
+	}
+
+	// a recreated topic gets a new id
+	if err := s.DeleteTopic(2, "topic1"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := s.EnsureTopic(3, &structs.Topic{ID: "id3", Topic: "topic1"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, top, err := s.GetTopicByID("id1"); err != nil || top != nil {
+		t.Fatalf("bad: %#v (err: %s)", top, err)
+	}
+	if _, top, err := s.GetTopicByID("id3"); err != nil || top == nil {
+		t.Fatalf("bad: %#v (err: %s)", top, err)
+	}
+}
+
 func testRegisterTopic(t *testing.T, s *Store, idx uint64, id string) {
 	if err := s.EnsureTopic(idx, &structs.Topic{Topic: id}); err != nil {
 		t.Fatalf("err: %s", err)
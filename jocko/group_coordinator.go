@@ -0,0 +1,547 @@
+package jocko
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/travisjeffery/jocko/jocko/structs"
+	"github.com/travisjeffery/jocko/log"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+// groupCheckInterval is how often the coordinator checks for members whose sessions have
+// expired and rebalances whose timeouts have passed.
+const groupCheckInterval = 250 * time.Millisecond
+
+// The broker coordinates the groups whose offsets topic partitions it leads. Like Kafka, a
+// group's members join it, the coordinator waits for every member to join, or the rebalance
+// timeout, then picks a protocol the members all support and a leader that's sent the members'
+// metadata. The leader assigns the members their partitions and sends the assignment in its sync
+// group request, the other members' sync group requests wait for it. Members heartbeat to keep
+// their sessions alive and learn of rebalances.
+//
+// Group membership is held in memory, it's lost when the coordinator moves and the members
+// rejoin the group on the new coordinator, keeping their committed offsets.
+
+// groupCoordinator holds the membership of the groups the broker coordinates.
+type groupCoordinator struct {
+	mu     sync.Mutex
+	groups map[string]*group
+}
+
+type group struct {
+	id           string
+	state        structs.GroupState
+	generation   int32
+	protocolType string
+	protocol     string
+	leader       string
+	members      map[string]*groupMember
+	// join is the rebalance members are joining, sync the current generation's assignment members
+	// are waiting for.
+	join *joinRound
+	sync *syncRound
+	// rebalanceDeadline is when the members that haven't rejoined are removed from the group to
+	// complete the rebalance.
+	rebalanceDeadline time.Time
+}
+
+type groupMember struct {
+	id               string
+	clientID         string
+	clientHost       string
+	protocols        []*protocol.GroupProtocol
+	sessionTimeout   time.Duration
+	rebalanceTimeout time.Duration
+	assignment       []byte
+	// joined is whether the member has joined the rebalance in progress.
+	joined bool
+	// lastSeen is when the member last heartbeat, joined, synced or committed offsets.
+	lastSeen time.Time
+}
+
+// joinRound is a rebalance's joins, done when every member's joined or the rebalance timeout's
+// passed with the result the joined members are answered with.
+type joinRound struct {
+	done       chan struct{}
+	generation int32
+	protocol   string
+	leader     string
+	members    []protocol.Member
+}
+
+// syncRound is a generation's sync, done when the leader's sent the assignment or a rebalance
+// starts.
+type syncRound struct {
+	done chan struct{}
+}
+
+func newGroupCoordinator() *groupCoordinator {
+	return &groupCoordinator{groups: make(map[string]*group)}
+}
+
+// join adds the member to the group, or updates it, and starts a rebalance if one isn't in
+// progress. It returns the member's ID and the rebalance to wait for.
+func (c *groupCoordinator) join(r *protocol.JoinGroupRequest, clientID, clientHost string, now time.Time) (string, *joinRound, protocol.Error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	g, ok := c.groups[r.GroupID]
+	if !ok {
+		if r.MemberID != "" {
+			return "", nil, protocol.ErrUnknownMemberId
+		}
+		g = &group{id: r.GroupID, state: structs.GroupStateEmpty, members: make(map[string]*groupMember)}
+	}
+	m, ok := g.members[r.MemberID]
+	if r.MemberID != "" && !ok {
+		return "", nil, protocol.ErrUnknownMemberId
+	}
+	if !g.supports(r.MemberID, r.ProtocolType, r.GroupProtocols) {
+		return "", nil, protocol.ErrInconsistentGroupProtocol
+	}
+	if !ok {
+		m = &groupMember{id: clientID + "-" + uuid.NewV1().String(), clientID: clientID, clientHost: clientHost}
+		g.members[m.id] = m
+	}
+	c.groups[g.id] = g
+	g.protocolType = r.ProtocolType
+	m.protocols = r.GroupProtocols
+	m.sessionTimeout = time.Duration(r.SessionTimeout) * time.Millisecond
+	m.rebalanceTimeout = time.Duration(r.RebalanceTimeout) * time.Millisecond
+	if r.Version() == 0 {
+		// version 0 has no rebalance timeout, the session timeout's used for both.
+		m.rebalanceTimeout = m.sessionTimeout
+	}
+	m.lastSeen = now
+	if g.state != structs.GroupStatePreparingRebalance {
+		g.prepareRebalance(now)
+	}
+	m.joined = true
+	join := g.join
+	c.completeJoin(g, now)
+	return m.id, join, protocol.ErrNone
+}
+
+// supports returns whether the protocol type and protocols are compatible with the group's other
+// members: they're the same type and support one protocol in common.
+func (g *group) supports(memberID, protocolType string, protocols []*protocol.GroupProtocol) bool {
+	if protocolType == "" || len(protocols) == 0 {
+		return false
+	}
+	others := 0
+	for id := range g.members {
+		if id != memberID {
+			others++
+		}
+	}
+	if others == 0 {
+		return true
+	}
+	if protocolType != g.protocolType {
+		return false
+	}
+	for _, p := range protocols {
+		supported := true
+		for id, m := range g.members {
+			if id != memberID && !m.supports(p.ProtocolName) {
+				supported = false
+				break
+			}
+		}
+		if supported {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *groupMember) supports(name string) bool {
+	for _, p := range m.protocols {
+		if p.ProtocolName == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *groupMember) metadata(name string) []byte {
+	for _, p := range m.protocols {
+		if p.ProtocolName == name {
+			return p.ProtocolMetadata
+		}
+	}
+	return nil
+}
+
+// prepareRebalance starts a rebalance, the members must rejoin before the longest of their
+// rebalance timeouts passes.
+func (g *group) prepareRebalance(now time.Time) {
+	g.endSync()
+	g.state = structs.GroupStatePreparingRebalance
+	g.join = &joinRound{done: make(chan struct{})}
+	var timeout time.Duration
+	for _, m := range g.members {
+		m.joined = false
+		if m.rebalanceTimeout > timeout {
+			timeout = m.rebalanceTimeout
+		}
+	}
+	g.rebalanceDeadline = now.Add(timeout)
+}
+
+// endSync answers the members waiting for the generation's assignment.
+func (g *group) endSync() {
+	if g.sync != nil {
+		close(g.sync.done)
+		g.sync = nil
+	}
+}
+
+// completeJoin completes the group's rebalance if every member has joined or its timeout's
+// passed, removing the members that haven't joined.
+func (c *groupCoordinator) completeJoin(g *group, now time.Time) {
+	if g.state != structs.GroupStatePreparingRebalance {
+		return
+	}
+	expired := !now.Before(g.rebalanceDeadline)
+	for _, m := range g.members {
+		if !m.joined && !expired {
+			return
+		}
+	}
+	for id, m := range g.members {
+		if !m.joined {
+			log.Info.Printf("group coordinator: group: %s: removing member that didn't rejoin: %s", g.id, id)
+			delete(g.members, id)
+		}
+	}
+	join := g.join
+	g.join = nil
+	g.generation++
+	if len(g.members) == 0 {
+		// groups are forgotten once their members are gone, their offsets are kept.
+		g.state = structs.GroupStateEmpty
+		delete(c.groups, g.id)
+		close(join.done)
+		return
+	}
+	g.protocol = g.selectProtocol()
+	if _, ok := g.members[g.leader]; !ok {
+		g.leader = ""
+	}
+	ids := make([]string, 0, len(g.members))
+	for id, m := range g.members {
+		ids = append(ids, id)
+		m.joined = false
+		m.lastSeen = now
+		m.assignment = nil
+	}
+	sort.Strings(ids)
+	if g.leader == "" {
+		g.leader = ids[0]
+	}
+	join.generation, join.protocol, join.leader = g.generation, g.protocol, g.leader
+	for _, id := range ids {
+		join.members = append(join.members, protocol.Member{MemberID: id, MemberMetadata: g.members[id].metadata(g.protocol)})
+	}
+	g.state = structs.GroupStateCompletingRebalance
+	g.sync = &syncRound{done: make(chan struct{})}
+	log.Info.Printf("group coordinator: group: %s: generation %d: protocol: %s, leader: %s, members: %d", g.id, g.generation, g.protocol, g.leader, len(ids))
+	close(join.done)
+}
+
+// selectProtocol returns the protocol the members support that's the most preferred by them,
+// each member voting for the first of its protocols they all support.
+func (g *group) selectProtocol() string {
+	votes := make(map[string]int)
+	for _, m := range g.members {
+		for _, p := range m.protocols {
+			supported := true
+			for _, other := range g.members {
+				if !other.supports(p.ProtocolName) {
+					supported = false
+					break
+				}
+			}
+			if supported {
+				votes[p.ProtocolName]++
+				break
+			}
+		}
+	}
+	var selected string
+	for name, n := range votes {
+		if n > votes[selected] || (n == votes[selected] && name < selected) {
+			selected = name
+		}
+	}
+	return selected
+}
+
+// joined returns the join group response for the member once its rebalance is done.
+func (c *groupCoordinator) joined(memberID string, join *joinRound) *protocol.JoinGroupResponse {
+	res := &protocol.JoinGroupResponse{MemberID: memberID}
+	var member bool
+	for _, m := range join.members {
+		if m.MemberID == memberID {
+			member = true
+			break
+		}
+	}
+	if !member {
+		res.ErrorCode = protocol.ErrUnknownMemberId.Code()
+		return res
+	}
+	res.GenerationID = join.generation
+	res.GroupProtocol = join.protocol
+	res.LeaderID = join.leader
+	if memberID == join.leader {
+		// only the leader assigns the partitions so only it needs the members' metadata.
+		res.Members = join.members
+	}
+	return res
+}
+
+// member returns the group and member, checking the member's in the group's generation.
+func (c *groupCoordinator) member(groupID, memberID string, generation int32) (*group, *groupMember, protocol.Error) {
+	g, ok := c.groups[groupID]
+	if !ok {
+		return nil, nil, protocol.ErrUnknownMemberId
+	}
+	m, ok := g.members[memberID]
+	if !ok {
+		return nil, nil, protocol.ErrUnknownMemberId
+	}
+	if generation != g.generation {
+		return nil, nil, protocol.ErrIllegalGeneration
+	}
+	return g, m, protocol.ErrNone
+}
+
+// sync stores the assignment if the member's the group's leader. It returns the generation's
+// sync to wait for the leader's assignment, nil if it's been received.
+func (c *groupCoordinator) sync(r *protocol.SyncGroupRequest, now time.Time) (*syncRound, protocol.Error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	g, m, err := c.member(r.GroupID, r.MemberID, r.GenerationID)
+	if err != protocol.ErrNone {
+		return nil, err
+	}
+	m.lastSeen = now
+	switch g.state {
+	case structs.GroupStatePreparingRebalance:
+		return nil, protocol.ErrRebalanceInProgress
+	case structs.GroupStateStable:
+		return nil, protocol.ErrNone
+	}
+	sync := g.sync
+	if r.MemberID == g.leader {
+		for _, a := range r.GroupAssignments {
+			// the leader may have assigned members that have since left.
+			if member, ok := g.members[a.MemberID]; ok {
+				member.assignment = a.MemberAssignment
+			}
+		}
+		g.state = structs.GroupStateStable
+		g.endSync()
+	}
+	return sync, protocol.ErrNone
+}
+
+// synced returns the sync group response for the member once the leader's assignment's received.
+func (c *groupCoordinator) synced(r *protocol.SyncGroupRequest) *protocol.SyncGroupResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	res := &protocol.SyncGroupResponse{}
+	g, m, err := c.member(r.GroupID, r.MemberID, r.GenerationID)
+	if err == protocol.ErrNone && g.state != structs.GroupStateStable {
+		// a rebalance started before the leader's assignment was received.
+		err = protocol.ErrRebalanceInProgress
+	}
+	if err != protocol.ErrNone {
+		res.ErrorCode = err.Code()
+		return res
+	}
+	res.MemberAssignment = m.assignment
+	return res
+}
+
+// heartbeat keeps the member's session alive, returning whether the group's rebalancing.
+func (c *groupCoordinator) heartbeat(r *protocol.HeartbeatRequest, now time.Time) protocol.Error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	g, m, err := c.member(r.GroupID, r.MemberID, r.GroupGenerationID)
+	if err != protocol.ErrNone {
+		return err
+	}
+	m.lastSeen = now
+	if g.state == structs.GroupStatePreparingRebalance {
+		return protocol.ErrRebalanceInProgress
+	}
+	return protocol.ErrNone
+}
+
+// commit checks the member can commit the group's offsets, keeping its session alive. Commits in
+// a generation must be from a member of the group's current generation, so a member that missed a
+// rebalance can't overwrite the offsets of the partitions reassigned since. Commits outside of a
+// generation, from consumers assigning their partitions themselves or resetting the group's
+// offsets, are only taken while the group's empty, like Kafka, since its members' commits would
+// overwrite them.
+func (c *groupCoordinator) commit(groupID, memberID string, generation int32, now time.Time) protocol.Error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation < 0 {
+		g, ok := c.groups[groupID]
+		if !ok || len(g.members) == 0 {
+			return protocol.ErrNone
+		}
+		if _, ok := g.members[memberID]; !ok {
+			return protocol.ErrUnknownMemberId
+		}
+		return protocol.ErrIllegalGeneration
+	}
+	if _, ok := c.groups[groupID]; !ok {
+		// like Kafka, there's no generation to commit in.
+		return protocol.ErrIllegalGeneration
+	}
+	g, m, err := c.member(groupID, memberID, generation)
+	if err != protocol.ErrNone {
+		return err
+	}
+	if g.state == structs.GroupStateCompletingRebalance {
+		// the generation's assignment isn't known yet.
+		return protocol.ErrRebalanceInProgress
+	}
+	m.lastSeen = now
+	return protocol.ErrNone
+}
+
+// leave removes the member from the group, rebalancing the rest.
+func (c *groupCoordinator) leave(groupID, memberID string, now time.Time) protocol.Error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	g, ok := c.groups[groupID]
+	if !ok {
+		return protocol.ErrUnknownMemberId
+	}
+	if _, ok := g.members[memberID]; !ok {
+		return protocol.ErrUnknownMemberId
+	}
+	log.Info.Printf("group coordinator: group: %s: member left: %s", groupID, memberID)
+	c.remove(g, memberID, now)
+	return protocol.ErrNone
+}
+
+// remove removes the member from the group, rebalancing the rest.
+func (c *groupCoordinator) remove(g *group, memberID string, now time.Time) {
+	delete(g.members, memberID)
+	if g.state != structs.GroupStatePreparingRebalance {
+		g.prepareRebalance(now)
+	}
+	c.completeJoin(g, now)
+}
+
+// check removes the members whose sessions have expired and completes the rebalances whose
+// timeouts have passed.
+func (c *groupCoordinator) check(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, g := range c.groups {
+		for id, m := range g.members {
+			// members that have joined are waiting on the others rather than heartbeating.
+			if m.joined || now.Sub(m.lastSeen) < m.sessionTimeout {
+				continue
+			}
+			log.Info.Printf("group coordinator: group: %s: member's session expired: %s", g.id, id)
+			c.remove(g, id, now)
+		}
+		c.completeJoin(g, now)
+	}
+}
+
+// describe returns the group's description, the Dead state if it has no members.
+func (c *groupCoordinator) describe(groupID string) protocol.Group {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	res := protocol.Group{GroupID: groupID, State: groupStateNames[structs.GroupStateDead], GroupMembers: make(map[string]*protocol.GroupMember)}
+	g, ok := c.groups[groupID]
+	if !ok {
+		return res
+	}
+	res.State = groupStateNames[g.state]
+	res.ProtocolType = g.protocolType
+	if g.state == structs.GroupStatePreparingRebalance {
+		// the protocol's selected when the rebalance completes.
+		return res
+	}
+	res.Protocol = g.protocol
+	for id, m := range g.members {
+		res.GroupMembers[id] = &protocol.GroupMember{
+			ClientID:              m.clientID,
+			ClientHost:            m.clientHost,
+			GroupMemberMetadata:   m.metadata(g.protocol),
+			GroupMemberAssignment: m.assignment,
+		}
+	}
+	return res
+}
+
+// list returns the groups the broker coordinates, sorted by ID.
+func (c *groupCoordinator) list() []protocol.ListGroup {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	groups := make([]protocol.ListGroup, 0, len(c.groups))
+	for id, g := range c.groups {
+		groups = append(groups, protocol.ListGroup{GroupID: id, ProtocolType: g.protocolType})
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].GroupID < groups[j].GroupID })
+	return groups
+}
+
+// groupStateNames are the group states as Kafka names them in describe groups responses.
+var groupStateNames = map[structs.GroupState]string{
+	structs.GroupStatePreparingRebalance:  "PreparingRebalance",
+	structs.GroupStateCompletingRebalance: "CompletingRebalance",
+	structs.GroupStateStable:              "Stable",
+	structs.GroupStateDead:                "Dead",
+	structs.GroupStateEmpty:               "Empty",
+}
+
+func (b *Broker) groupsLoop() {
+	ticker := b.clock.NewTicker(groupCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C():
+			b.groups.check(now)
+		case <-b.shutdownCh:
+			return
+		}
+	}
+}
+
+// checkSessionTimeout returns an error if the session timeout is outside the broker's bounds.
+func (b *Broker) checkSessionTimeout(ms int32) protocol.Error {
+	timeout := time.Duration(ms) * time.Millisecond
+	if timeout < b.config.GroupMinSessionTimeout || timeout > b.config.GroupMaxSessionTimeout {
+		return protocol.ErrInvalidSessionTimeout
+	}
+	return protocol.ErrNone
+}
+
+// clientHost returns the host of the request's client, empty if it's unknown.
+func clientHost(ctx *Context) string {
+	conn, ok := ctx.conn.(net.Conn)
+	if !ok {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return ""
+	}
+	return host
+}
@@ -0,0 +1,259 @@
+package jocko
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/testutil/retry"
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/jocko/structs"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestGroupCoordinator(t *testing.T) {
+	c := newGroupCoordinator()
+	now := time.Now()
+	joinReq := func(memberID string, protocols ...string) *protocol.JoinGroupRequest {
+		r := &protocol.JoinGroupRequest{APIVersion: 1, GroupID: "g", MemberID: memberID, ProtocolType: "consumer", SessionTimeout: 10000, RebalanceTimeout: 30000}
+		for _, p := range protocols {
+			r.GroupProtocols = append(r.GroupProtocols, &protocol.GroupProtocol{ProtocolName: p, ProtocolMetadata: []byte(memberID + p)})
+		}
+		return r
+	}
+	requireDone := func(join *joinRound, done bool) {
+		select {
+		case <-join.done:
+			require.True(t, done, "join done")
+		default:
+			require.False(t, done, "join not done")
+		}
+	}
+
+	// a lone member's join completes right away and it leads the group.
+	m1, join, err := c.join(joinReq("", "range", "roundrobin"), "client", "host", now)
+	require.Equal(t, protocol.ErrNone, err)
+	requireDone(join, true)
+	res := c.joined(m1, join)
+	require.Equal(t, int32(1), res.GenerationID)
+	require.Equal(t, "range", res.GroupProtocol)
+	require.Equal(t, m1, res.LeaderID)
+	require.Len(t, res.Members, 1)
+
+	sync, err := c.sync(&protocol.SyncGroupRequest{GroupID: "g", GenerationID: 1, MemberID: m1, GroupAssignments: []protocol.GroupAssignment{{MemberID: m1, MemberAssignment: []byte("all")}}}, now)
+	require.Equal(t, protocol.ErrNone, err)
+	require.NotNil(t, sync)
+	require.Equal(t, []byte("all"), c.synced(&protocol.SyncGroupRequest{GroupID: "g", GenerationID: 1, MemberID: m1}).MemberAssignment)
+	require.Equal(t, protocol.ErrNone, c.heartbeat(&protocol.HeartbeatRequest{GroupID: "g", GroupGenerationID: 1, MemberID: m1}, now))
+
+	// a member supporting none of the group's protocols can't join.
+	_, _, err = c.join(joinReq("", "sticky"), "client", "host", now)
+	require.Equal(t, protocol.ErrInconsistentGroupProtocol, err)
+	_, _, err = c.join(joinReq("unknown", "range"), "client", "host", now)
+	require.Equal(t, protocol.ErrUnknownMemberId, err)
+
+	// a second member's join starts a rebalance that waits for the first to rejoin.
+	m2, join, err := c.join(joinReq("", "roundrobin"), "client", "host", now)
+	require.Equal(t, protocol.ErrNone, err)
+	requireDone(join, false)
+	require.Equal(t, protocol.ErrRebalanceInProgress, c.heartbeat(&protocol.HeartbeatRequest{GroupID: "g", GroupGenerationID: 1, MemberID: m1}, now))
+	_, rejoin, err := c.join(joinReq(m1, "range", "roundrobin"), "client", "host", now)
+	require.Equal(t, protocol.ErrNone, err)
+	require.Equal(t, join, rejoin)
+	requireDone(join, true)
+	res = c.joined(m1, join)
+	require.Equal(t, int32(2), res.GenerationID)
+	require.Equal(t, "roundrobin", res.GroupProtocol)
+	require.Equal(t, m1, res.LeaderID)
+	require.ElementsMatch(t, []protocol.Member{
+		{MemberID: m1, MemberMetadata: []byte(m1 + "roundrobin")},
+		{MemberID: m2, MemberMetadata: []byte("roundrobin")},
+	}, res.Members)
+	require.Empty(t, c.joined(m2, join).Members)
+
+	// the follower's sync waits for the leader's assignment.
+	followerSync := &protocol.SyncGroupRequest{GroupID: "g", GenerationID: 2, MemberID: m2}
+	sync, err = c.sync(followerSync, now)
+	require.Equal(t, protocol.ErrNone, err)
+	_, err = c.sync(&protocol.SyncGroupRequest{GroupID: "g", GenerationID: 1, MemberID: m2}, now)
+	require.Equal(t, protocol.ErrIllegalGeneration, err)
+	_, err = c.sync(&protocol.SyncGroupRequest{GroupID: "g", GenerationID: 2, MemberID: m1, GroupAssignments: []protocol.GroupAssignment{
+		{MemberID: m1, MemberAssignment: []byte("a")},
+		{MemberID: m2, MemberAssignment: []byte("b")},
+	}}, now)
+	require.Equal(t, protocol.ErrNone, err)
+	<-sync.done
+	require.Equal(t, []byte("b"), c.synced(followerSync).MemberAssignment)
+
+	// only the current generation's members commit in it, so a member that missed a rebalance
+	// can't overwrite the offsets of the partitions reassigned since.
+	require.Equal(t, protocol.ErrNone, c.commit("g", m2, 2, now))
+	require.Equal(t, protocol.ErrIllegalGeneration, c.commit("g", m2, 1, now))
+	require.Equal(t, protocol.ErrUnknownMemberId, c.commit("g", "unknown", 2, now))
+	require.Equal(t, protocol.ErrIllegalGeneration, c.commit("unknown", m2, 2, now))
+	require.Equal(t, protocol.ErrNone, c.commit("unknown", "", -1, now))
+	// commits outside of a generation, e.g. resetting the offsets, wait for the group to empty.
+	require.Equal(t, protocol.ErrUnknownMemberId, c.commit("g", "", -1, now))
+	require.Equal(t, protocol.ErrIllegalGeneration, c.commit("g", m2, -1, now))
+
+	described := c.describe("g")
+	require.Equal(t, "Stable", described.State)
+	require.Equal(t, "roundrobin", described.Protocol)
+	require.Len(t, described.GroupMembers, 2)
+	require.Equal(t, []protocol.ListGroup{{GroupID: "g", ProtocolType: "consumer"}}, c.list())
+
+	// the member that stops heartbeating is removed once its session expires, the other must
+	// rejoin.
+	later := now.Add(8 * time.Second)
+	require.Equal(t, protocol.ErrNone, c.heartbeat(&protocol.HeartbeatRequest{GroupID: "g", GroupGenerationID: 2, MemberID: m2}, later))
+	c.check(now.Add(11 * time.Second))
+	require.Equal(t, structs.GroupStatePreparingRebalance, c.groups["g"].state)
+	_, ok := c.groups["g"].members[m1]
+	require.False(t, ok)
+
+	// members that don't rejoin in the rebalance timeout are removed, and the group once it's
+	// empty.
+	c.check(now.Add(11*time.Second + 30*time.Second))
+	require.Empty(t, c.groups)
+	require.Equal(t, "Dead", c.describe("g").State)
+	require.Equal(t, protocol.ErrUnknownMemberId, c.leave("g", m2, now))
+}
+
+func TestBroker_GroupMembership(t *testing.T) {
+	s, dir := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+
+	// the members aren't brokers, whose offset commits aren't checked against the groups.
+	dialer := NewDialer("consumer")
+	dial := func() *Conn {
+		conn, err := dialer.Dial("tcp", s.Addr().String())
+		require.NoError(t, err)
+		return conn
+	}
+	conn1, conn2 := dial(), dial()
+	defer conn1.Close()
+	defer conn2.Close()
+
+	// the offsets topic is created by the first find coordinator request.
+	retry.Run(t, func(r *retry.R) {
+		res, err := conn1.FindCoordinator(&protocol.FindCoordinatorRequest{CoordinatorKey: "group"})
+		if err != nil {
+			r.Fatal(err)
+		}
+		if res.ErrorCode != protocol.ErrNone.Code() {
+			r.Fatalf("find coordinator error: %s", protocol.Errs[res.ErrorCode])
+		}
+	})
+
+	// the controller's the transaction coordinator.
+	txn, err := conn1.FindCoordinator(&protocol.FindCoordinatorRequest{APIVersion: 1, CoordinatorKey: "txn", CoordinatorType: protocol.CoordinatorTransaction})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrNone.Code(), txn.ErrorCode)
+	require.Equal(t, s.config.ID, txn.Coordinator.NodeID)
+
+	join := func(conn *Conn, memberID string) *protocol.JoinGroupResponse {
+		var res *protocol.JoinGroupResponse
+		retry.Run(t, func(r *retry.R) {
+			var err error
+			res, err = conn.JoinGroup(&protocol.JoinGroupRequest{
+				APIVersion:       1,
+				GroupID:          "group",
+				SessionTimeout:   10000,
+				RebalanceTimeout: 10000,
+				MemberID:         memberID,
+				ProtocolType:     "consumer",
+				GroupProtocols:   []*protocol.GroupProtocol{{ProtocolName: "range", ProtocolMetadata: []byte("metadata")}},
+			})
+			if err != nil {
+				r.Fatal(err)
+			}
+			if res.ErrorCode == protocol.ErrNotCoordinator.Code() || res.ErrorCode == protocol.ErrCoordinatorNotAvailable.Code() {
+				r.Fatalf("join group error: %s", protocol.Errs[res.ErrorCode])
+			}
+		})
+		return res
+	}
+
+	res1 := join(conn1, "")
+	require.Equal(t, protocol.ErrNone.Code(), res1.ErrorCode)
+	require.Equal(t, int32(1), res1.GenerationID)
+	require.Equal(t, res1.MemberID, res1.LeaderID)
+	sync1, err := conn1.SyncGroup(&protocol.SyncGroupRequest{GroupID: "group", GenerationID: 1, MemberID: res1.MemberID,
+		GroupAssignments: []protocol.GroupAssignment{{MemberID: res1.MemberID, MemberAssignment: []byte("all")}}})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrNone.Code(), sync1.ErrorCode)
+	require.Equal(t, []byte("all"), sync1.MemberAssignment)
+
+	// the second member's join waits for the first to rejoin, which it learns of heartbeating.
+	res2Ch := make(chan *protocol.JoinGroupResponse, 1)
+	go func() { res2Ch <- join(conn2, "") }()
+	retry.Run(t, func(r *retry.R) {
+		hb, err := conn1.Heartbeat(&protocol.HeartbeatRequest{GroupID: "group", GroupGenerationID: 1, MemberID: res1.MemberID})
+		if err != nil {
+			r.Fatal(err)
+		}
+		if hb.ErrorCode != protocol.ErrRebalanceInProgress.Code() {
+			r.Fatalf("heartbeat error code: %d", hb.ErrorCode)
+		}
+	})
+	res1 = join(conn1, res1.MemberID)
+	res2 := <-res2Ch
+	require.Equal(t, protocol.ErrNone.Code(), res2.ErrorCode)
+	require.Equal(t, int32(2), res1.GenerationID)
+	require.Equal(t, int32(2), res2.GenerationID)
+	require.Equal(t, res1.MemberID, res2.LeaderID)
+	require.Len(t, res1.Members, 2)
+
+	// the follower's sync waits for the leader's.
+	sync2Ch := make(chan *protocol.SyncGroupResponse, 1)
+	go func() {
+		res, err := conn2.SyncGroup(&protocol.SyncGroupRequest{GroupID: "group", GenerationID: 2, MemberID: res2.MemberID})
+		require.NoError(t, err)
+		sync2Ch <- res
+	}()
+	sync1, err = conn1.SyncGroup(&protocol.SyncGroupRequest{GroupID: "group", GenerationID: 2, MemberID: res1.MemberID, GroupAssignments: []protocol.GroupAssignment{
+		{MemberID: res1.MemberID, MemberAssignment: []byte("a")},
+		{MemberID: res2.MemberID, MemberAssignment: []byte("b")},
+	}})
+	require.NoError(t, err)
+	require.Equal(t, []byte("a"), sync1.MemberAssignment)
+	sync2 := <-sync2Ch
+	require.Equal(t, protocol.ErrNone.Code(), sync2.ErrorCode)
+	require.Equal(t, []byte("b"), sync2.MemberAssignment)
+
+	describe, err := conn1.DescribeGroups(&protocol.DescribeGroupsRequest{GroupIDs: []string{"group"}})
+	require.NoError(t, err)
+	require.Len(t, describe.Groups, 1)
+	require.Equal(t, "Stable", describe.Groups[0].State)
+	require.Len(t, describe.Groups[0].GroupMembers, 2)
+
+	leave, err := conn2.LeaveGroup(&protocol.LeaveGroupRequest{GroupID: "group", MemberID: res2.MemberID})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrNone.Code(), leave.ErrorCode)
+	hb, err := conn1.Heartbeat(&protocol.HeartbeatRequest{GroupID: "group", GroupGenerationID: 2, MemberID: res1.MemberID})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrRebalanceInProgress.Code(), hb.ErrorCode)
+
+	// the member that left can't commit offsets in its old generation.
+	commit, err := conn2.OffsetCommit(&protocol.OffsetCommitRequest{
+		APIVersion:   2,
+		GroupID:      "group",
+		GenerationID: 2,
+		MemberID:     res2.MemberID,
+		Topics: []*protocol.OffsetCommitRequestTopic{{
+			Name:       "topic",
+			Partitions: []*protocol.OffsetCommitRequestPartition{{PartitionIndex: 0, CommittedOffset: 1}},
+		}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrUnknownMemberId.Code(), commit.Topics[0].Partitions[0].ErrorCode)
+}
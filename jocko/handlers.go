@@ -0,0 +1,194 @@
+package jocko
+
+import (
+	"sort"
+
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+// handler decodes and handles an API's requests. It's the one place the versions the broker
+// serves are set: the server only decodes requests of these versions and the broker advertises
+// them in its API versions responses.
+type handler struct {
+	// minVersion and maxVersion are the versions whose requests and responses the protocol types
+	// encode and decode, and the broker handles.
+	minVersion, maxVersion int16
+	newRequest             func() protocol.VersionedDecoder
+	handle                 func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody
+}
+
+func (h handler) supports(version int16) bool {
+	return version >= h.minVersion && version <= h.maxVersion
+}
+
+// handlers are the broker's handlers by API key. APIs without one, like those whose handlers
+// aren't implemented, aren't advertised and their requests close the connection.
+var handlers map[int16]handler
+
+// apiVersions is the broker's API versions response, derived from its handlers.
+var apiVersions *protocol.APIVersionsResponse
+
+func init() {
+	// set in init since handleAPIVersions refers to the handlers.
+	handlers = map[int16]handler{
+		protocol.ProduceKey: {0, 7, func() protocol.VersionedDecoder { return &protocol.ProduceRequest{} },
+			func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody {
+				return b.handleProduce(ctx, req.(*protocol.ProduceRequest))
+			}},
+		protocol.FetchKey: {0, 13, func() protocol.VersionedDecoder { return &protocol.FetchRequest{} },
+			func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody {
+				return b.handleFetch(ctx, req.(*protocol.FetchRequest))
+			}},
+		protocol.FilteredFetchKey: {0, 0, func() protocol.VersionedDecoder { return &protocol.FilteredFetchRequest{} },
+			func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody {
+				return b.handleFilteredFetch(ctx, req.(*protocol.FilteredFetchRequest))
+			}},
+		protocol.OffsetsKey: {0, 4, func() protocol.VersionedDecoder { return &protocol.OffsetsRequest{} },
+			func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody {
+				return b.handleOffsets(ctx, req.(*protocol.OffsetsRequest))
+			}},
+		protocol.MetadataKey: {0, 10, func() protocol.VersionedDecoder { return &protocol.MetadataRequest{} },
+			func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody {
+				return b.handleMetadata(ctx, req.(*protocol.MetadataRequest))
+			}},
+		protocol.LeaderAndISRKey: {0, 1, func() protocol.VersionedDecoder { return &protocol.LeaderAndISRRequest{} },
+			func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody {
+				return b.handleLeaderAndISR(ctx, req.(*protocol.LeaderAndISRRequest))
+			}},
+		protocol.StopReplicaKey: {0, 0, func() protocol.VersionedDecoder { return &protocol.StopReplicaRequest{} },
+			func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody {
+				return b.handleStopReplica(ctx, req.(*protocol.StopReplicaRequest))
+			}},
+		protocol.BrokerMaintenanceKey: {0, 0, func() protocol.VersionedDecoder { return &protocol.BrokerMaintenanceRequest{} },
+			func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody {
+				return b.handleBrokerMaintenance(ctx, req.(*protocol.BrokerMaintenanceRequest))
+			}},
+		protocol.BrokerHealthKey: {0, 1, func() protocol.VersionedDecoder { return &protocol.BrokerHealthRequest{} },
+			func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody {
+				return b.handleBrokerHealth(ctx, req.(*protocol.BrokerHealthRequest))
+			}},
+		protocol.DescribeQuorumKey: {0, 0, func() protocol.VersionedDecoder { return &protocol.DescribeQuorumRequest{} },
+			func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody {
+				return b.handleDescribeQuorum(ctx, req.(*protocol.DescribeQuorumRequest))
+			}},
+		protocol.PartitionStatsKey: {0, 0, func() protocol.VersionedDecoder { return &protocol.PartitionStatsRequest{} },
+			func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody {
+				return b.handlePartitionStats(ctx, req.(*protocol.PartitionStatsRequest))
+			}},
+		protocol.DescribeFeaturesKey: {0, 0, func() protocol.VersionedDecoder { return &protocol.DescribeFeaturesRequest{} },
+			func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody {
+				return b.handleDescribeFeatures(ctx, req.(*protocol.DescribeFeaturesRequest))
+			}},
+		protocol.UpdateFeaturesKey: {0, 0, func() protocol.VersionedDecoder { return &protocol.UpdateFeaturesRequest{} },
+			func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody {
+				return b.handleUpdateFeatures(ctx, req.(*protocol.UpdateFeaturesRequest))
+			}},
+		protocol.ReassignLostBrokerKey: {0, 0, func() protocol.VersionedDecoder { return &protocol.ReassignLostBrokerRequest{} },
+			func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody {
+				return b.handleReassignLostBroker(ctx, req.(*protocol.ReassignLostBrokerRequest))
+			}},
+		protocol.InitProducerIDKey: {0, 1, func() protocol.VersionedDecoder { return &protocol.InitProducerIDRequest{} },
+			func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody {
+				return b.handleInitProducerID(ctx, req.(*protocol.InitProducerIDRequest))
+			}},
+		protocol.AddPartitionsToTxnKey: {0, 3, func() protocol.VersionedDecoder { return &protocol.AddPartitionsToTxnRequest{} },
+			func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody {
+				return b.handleAddPartitionsToTxn(ctx, req.(*protocol.AddPartitionsToTxnRequest))
+			}},
+		protocol.AddOffsetsToTxnKey: {0, 3, func() protocol.VersionedDecoder { return &protocol.AddOffsetsToTxnRequest{} },
+			func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody {
+				return b.handleAddOffsetsToTxn(ctx, req.(*protocol.AddOffsetsToTxnRequest))
+			}},
+		protocol.EndTxnKey: {0, 3, func() protocol.VersionedDecoder { return &protocol.EndTxnRequest{} },
+			func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody {
+				return b.handleEndTxn(ctx, req.(*protocol.EndTxnRequest))
+			}},
+		protocol.WriteTxnMarkersKey: {0, 1, func() protocol.VersionedDecoder { return &protocol.WriteTxnMarkersRequest{} },
+			func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody {
+				return b.handleWriteTxnMarkers(ctx, req.(*protocol.WriteTxnMarkersRequest))
+			}},
+		protocol.TxnOffsetCommitKey: {0, 3, func() protocol.VersionedDecoder { return &protocol.TxnOffsetCommitRequest{} },
+			func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody {
+				return b.handleTxnOffsetCommit(ctx, req.(*protocol.TxnOffsetCommitRequest))
+			}},
+		protocol.CompactPartitionKey: {0, 0, func() protocol.VersionedDecoder { return &protocol.CompactPartitionRequest{} },
+			func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody {
+				return b.handleCompactPartition(ctx, req.(*protocol.CompactPartitionRequest))
+			}},
+		protocol.DescribeClientQuotasKey: {0, 0, func() protocol.VersionedDecoder { return &protocol.DescribeClientQuotasRequest{} },
+			func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody {
+				return b.handleDescribeClientQuotas(ctx, req.(*protocol.DescribeClientQuotasRequest))
+			}},
+		// version 7 adds static membership, which isn't handled.
+		protocol.OffsetCommitKey: {0, 6, func() protocol.VersionedDecoder { return &protocol.OffsetCommitRequest{} },
+			func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody {
+				return b.handleOffsetCommit(ctx, req.(*protocol.OffsetCommitRequest))
+			}},
+		protocol.OffsetFetchKey: {0, 1, func() protocol.VersionedDecoder { return &protocol.OffsetFetchRequest{} },
+			func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody {
+				return b.handleOffsetFetch(ctx, req.(*protocol.OffsetFetchRequest))
+			}},
+		protocol.FindCoordinatorKey: {0, 1, func() protocol.VersionedDecoder { return &protocol.FindCoordinatorRequest{} },
+			func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody {
+				return b.handleFindCoordinator(ctx, req.(*protocol.FindCoordinatorRequest))
+			}},
+		protocol.JoinGroupKey: {0, 2, func() protocol.VersionedDecoder { return &protocol.JoinGroupRequest{} },
+			func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody {
+				return b.handleJoinGroup(ctx, req.(*protocol.JoinGroupRequest))
+			}},
+		// version 3 adds static membership, which isn't handled.
+		protocol.HeartbeatKey: {0, 2, func() protocol.VersionedDecoder { return &protocol.HeartbeatRequest{} },
+			func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody {
+				return b.handleHeartbeat(ctx, req.(*protocol.HeartbeatRequest))
+			}},
+		// version 3 batches members, which isn't handled.
+		protocol.LeaveGroupKey: {0, 2, func() protocol.VersionedDecoder { return &protocol.LeaveGroupRequest{} },
+			func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody {
+				return b.handleLeaveGroup(ctx, req.(*protocol.LeaveGroupRequest))
+			}},
+		protocol.SyncGroupKey: {0, 1, func() protocol.VersionedDecoder { return &protocol.SyncGroupRequest{} },
+			func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody {
+				return b.handleSyncGroup(ctx, req.(*protocol.SyncGroupRequest))
+			}},
+		protocol.DescribeGroupsKey: {0, 1, func() protocol.VersionedDecoder { return &protocol.DescribeGroupsRequest{} },
+			func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody {
+				return b.handleDescribeGroups(ctx, req.(*protocol.DescribeGroupsRequest))
+			}},
+		protocol.ListGroupsKey: {0, 1, func() protocol.VersionedDecoder { return &protocol.ListGroupsRequest{} },
+			func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody {
+				return b.handleListGroups(ctx, req.(*protocol.ListGroupsRequest))
+			}},
+		protocol.APIVersionsKey: {0, 1, func() protocol.VersionedDecoder { return &protocol.APIVersionsRequest{} },
+			func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody {
+				return b.handleAPIVersions(ctx, req.(*protocol.APIVersionsRequest))
+			}},
+		protocol.CreateTopicsKey: {0, 2, func() protocol.VersionedDecoder { return &protocol.CreateTopicRequests{} },
+			func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody {
+				return b.handleCreateTopic(ctx, req.(*protocol.CreateTopicRequests))
+			}},
+		protocol.DeleteTopicsKey: {0, 1, func() protocol.VersionedDecoder { return &protocol.DeleteTopicsRequest{} },
+			func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody {
+				return b.handleDeleteTopics(ctx, req.(*protocol.DeleteTopicsRequest))
+			}},
+		protocol.DescribeConfigsKey: {0, 1, func() protocol.VersionedDecoder { return &protocol.DescribeConfigsRequest{} },
+			func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody {
+				return b.handleDescribeConfigs(ctx, req.(*protocol.DescribeConfigsRequest))
+			}},
+		protocol.AlterConfigsKey: {0, 1, func() protocol.VersionedDecoder { return &protocol.AlterConfigsRequest{} },
+			func(b *Broker, ctx *Context, req interface{}) protocol.ResponseBody {
+				return b.handleAlterConfigs(ctx, req.(*protocol.AlterConfigsRequest))
+			}},
+	}
+
+	apiVersions = &protocol.APIVersionsResponse{}
+	for key, h := range handlers {
+		apiVersions.APIVersions = append(apiVersions.APIVersions, protocol.APIVersion{
+			APIKey:     key,
+			MinVersion: h.minVersion,
+			MaxVersion: h.maxVersion,
+		})
+	}
+	sort.Slice(apiVersions.APIVersions, func(i, j int) bool {
+		return apiVersions.APIVersions[i].APIKey < apiVersions.APIVersions[j].APIKey
+	})
+}
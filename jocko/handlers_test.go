@@ -0,0 +1,42 @@
+package jocko
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestHandlers_APIVersions(t *testing.T) {
+	req := require.New(t)
+	versions := apiVersions.APIVersions
+	req.Equal(len(handlers), len(versions))
+	req.True(sort.SliceIsSorted(versions, func(i, j int) bool {
+		return versions[i].APIKey < versions[j].APIKey
+	}))
+	for _, v := range versions {
+		h, ok := handlers[v.APIKey]
+		req.True(ok)
+		req.Equal(h.minVersion, v.MinVersion)
+		req.Equal(h.maxVersion, v.MaxVersion)
+		// the versions advertised are the versions the requests decode as.
+		r := h.newRequest()
+		req.Equal(v.APIKey, r.(protocol.Body).Key())
+	}
+
+	b := &Broker{tracer: opentracing.NoopTracer{}}
+	ctx := &Context{parent: context.Background()}
+	res := b.handleAPIVersions(ctx, &protocol.APIVersionsRequest{APIVersion: 1})
+	req.Equal(int16(1), res.APIVersion)
+	req.Equal(protocol.ErrNone.Code(), res.ErrorCode)
+	req.Equal(versions, res.APIVersions)
+
+	// unsupported versions get a version 0 response with the supported versions.
+	res = b.handleAPIVersions(ctx, &protocol.APIVersionsRequest{APIVersion: 3})
+	req.Equal(int16(0), res.APIVersion)
+	req.Equal(protocol.ErrUnsupportedVersion.Code(), res.ErrorCode)
+	req.Equal(versions, res.APIVersions)
+}
@@ -0,0 +1,25 @@
+package jocko
+
+import "github.com/travisjeffery/jocko/protocol"
+
+// handleBrokerHealth returns the broker's clock, raft progress, disk usage, and version for cluster
+// health checks like jocko doctor to compare across the brokers.
+func (b *Broker) handleBrokerHealth(ctx *Context, req *protocol.BrokerHealthRequest) *protocol.BrokerHealthResponse {
+	sp := span(ctx, b.tracer, "broker health")
+	defer sp.Finish()
+	res := &protocol.BrokerHealthResponse{
+		BrokerID:         b.config.ID,
+		Time:             b.clock.Now(),
+		RaftState:        b.raft.State().String(),
+		RaftLastIndex:    int64(b.raft.LastIndex()),
+		RaftAppliedIndex: int64(b.raft.AppliedIndex()),
+		DiskTotalBytes:   -1,
+		DiskFreeBytes:    -1,
+		BrokerVersion:    Version,
+	}
+	res.APIVersion = req.Version()
+	if total, free, err := diskUsage(b.config.DataDir); err == nil {
+		res.DiskTotalBytes, res.DiskFreeBytes = total, free
+	}
+	return res
+}
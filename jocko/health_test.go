@@ -0,0 +1,84 @@
+package jocko
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/clock"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/mock"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestBroker_Health(t *testing.T) {
+	dir, err := ioutil.TempDir("", "health_test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	now := time.Unix(1600000000, 0)
+	b := &Broker{
+		config: &config.Config{ID: 2, DataDir: dir},
+		tracer: opentracing.NoopTracer{},
+		clock:  clock.NewSim(now),
+		raft: &mock.Raft{
+			StateFunc:        func() raft.RaftState { return raft.Follower },
+			LastIndexFunc:    func() uint64 { return 12 },
+			AppliedIndexFunc: func() uint64 { return 10 },
+		},
+	}
+
+	res := b.handleBrokerHealth(&Context{parent: context.Background()}, &protocol.BrokerHealthRequest{})
+	require.Equal(t, protocol.ErrNone.Code(), res.ErrorCode)
+	require.Equal(t, int32(2), res.BrokerID)
+	require.Equal(t, now, res.Time)
+	require.Equal(t, "Follower", res.RaftState)
+	require.Equal(t, int64(12), res.RaftLastIndex)
+	require.Equal(t, int64(10), res.RaftAppliedIndex)
+	require.True(t, res.DiskFreeBytes <= res.DiskTotalBytes)
+	require.Equal(t, Version, res.BrokerVersion)
+}
+
+func TestBroker_DescribeQuorum(t *testing.T) {
+	c := NewTestCluster(t, TestClusterOptions{})
+	defer c.Shutdown()
+	leader := c.Leader(t)
+
+	for _, s := range c.Servers {
+		if s == leader {
+			continue
+		}
+		conn, err := Dial("tcp", s.Addr().String())
+		require.NoError(t, err)
+		res, err := conn.DescribeQuorum(&protocol.DescribeQuorumRequest{})
+		conn.Close()
+		require.NoError(t, err)
+		require.Equal(t, protocol.ErrNotController.Code(), res.ErrorCode)
+	}
+
+	conn, err := Dial("tcp", leader.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	res, err := conn.DescribeQuorum(&protocol.DescribeQuorumRequest{})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrNone.Code(), res.ErrorCode)
+	require.Equal(t, leader.ID(), res.LeaderID)
+	require.True(t, res.Term > 0)
+	require.True(t, res.CommitIndex > 0)
+	require.Equal(t, 3, len(res.Voters))
+	require.Equal(t, 0, len(res.Observers))
+	ids := make(map[int32]bool)
+	for _, v := range res.Voters {
+		require.Equal(t, protocol.ErrNone.Code(), v.ErrorCode)
+		require.True(t, v.LastIndex > 0)
+		require.True(t, v.Lag >= 0)
+		ids[v.ReplicaID] = true
+	}
+	for _, s := range c.Servers {
+		require.True(t, ids[s.ID()])
+	}
+}
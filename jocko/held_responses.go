@@ -0,0 +1,106 @@
+package jocko
+
+import (
+	"io"
+	"sync"
+
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+// heldResponse is a request answered after its handler returns, like a fetch waiting for records
+// or an offset commit waiting for its batch to be appended.
+type heldResponse interface {
+	// finish answers the request if it hasn't been, returning once it's answered.
+	finish()
+}
+
+// heldResponses are the requests being answered asynchronously by conn. A conn's held request is
+// finished before its next request's handled so the conn's responses stay in order.
+type heldResponses struct {
+	mu    sync.Mutex
+	conns map[io.ReadWriter]heldResponse
+}
+
+func newHeldResponses() *heldResponses {
+	return &heldResponses{conns: make(map[io.ReadWriter]heldResponse)}
+}
+
+// hold holds the conn's request until it's released.
+func (h *heldResponses) hold(conn io.ReadWriter, r heldResponse) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.conns[conn] = r
+}
+
+// release releases the conn's request once it's answered, unless the conn's holding another.
+func (h *heldResponses) release(conn io.ReadWriter, r heldResponse) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.conns[conn] == r {
+		delete(h.conns, conn)
+	}
+}
+
+// get returns the conn's held request, nil if it has none.
+func (h *heldResponses) get(conn io.ReadWriter) heldResponse {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.conns[conn]
+}
+
+// finish finishes the conn's held request, if any.
+func (h *heldResponses) finish(conn io.ReadWriter) {
+	h.mu.Lock()
+	r := h.conns[conn]
+	h.mu.Unlock()
+	if r != nil {
+		r.finish()
+	}
+}
+
+// asyncAPIs are the APIs whose handlers block, e.g. waiting to batch their writes, so they're
+// run in their own goroutines rather than holding up the other conns' requests.
+var asyncAPIs = map[int16]bool{
+	protocol.OffsetCommitKey: true,
+	// join and sync group wait for the group's other members.
+	protocol.JoinGroupKey: true,
+	protocol.SyncGroupKey: true,
+	// the transaction coordinator's requests write markers, possibly through this broker itself.
+	protocol.InitProducerIDKey:     true,
+	protocol.AddPartitionsToTxnKey: true,
+	protocol.AddOffsetsToTxnKey:    true,
+	protocol.EndTxnKey:             true,
+	protocol.TxnOffsetCommitKey:    true,
+}
+
+// asyncRequest is a request being handled in its own goroutine.
+type asyncRequest struct {
+	done chan struct{}
+}
+
+func (r *asyncRequest) finish() {
+	<-r.done
+}
+
+// handleAsync handles the request in its own goroutine, holding the conn's next request until
+// it's answered. It's handled once the conn's held request, if any, is answered.
+func (b *Broker) handleAsync(reqCtx *Context, h handler, responses chan<- *Context) {
+	prev := b.held.get(reqCtx.conn)
+	r := &asyncRequest{done: make(chan struct{})}
+	b.held.hold(reqCtx.conn, r)
+	b.goroutines.goFunc("async request", func() {
+		defer close(r.done)
+		defer b.held.release(reqCtx.conn, r)
+		if prev != nil {
+			prev.finish()
+		}
+		b.respond(reqCtx, h.handle(b, reqCtx, reqCtx.req), responses)
+	})
+}
+
+// waitsOnAsync returns whether the conn's held request is an async one, which may block for a
+// while, e.g. a join group waiting for the group's other members.
+func (b *Broker) waitsOnAsync(conn io.ReadWriter) bool {
+	_, ok := b.held.get(conn).(*asyncRequest)
+	return ok
+}
@@ -0,0 +1,166 @@
+package jocko
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/travisjeffery/jocko/log"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+// touch records that the replica was produced to or fetched from so it isn't hibernated.
+func (r *Replica) touch(now time.Time) {
+	atomic.StoreInt64(&r.lastUsed, now.UnixNano())
+}
+
+// idleSince returns when the replica was last used.
+func (r *Replica) idleSince() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&r.lastUsed))
+}
+
+// isHibernated returns whether the replica's log is closed because it was idle.
+func (r *Replica) isHibernated() bool {
+	r.Lock()
+	defer r.Unlock()
+	return r.hibernated
+}
+
+// hibernateLoop periodically hibernates the local replicas idle for longer than HibernateAfter,
+// closing their logs and stopping their replicators so dormant partitions don't hold file handles,
+// mapped indexes, and goroutines.
+func (b *Broker) hibernateLoop() {
+	ticker := b.clock.NewTicker(b.config.HibernateAfter / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C():
+			b.hibernateIdleReplicas(now)
+		case <-b.shutdownCh:
+			return
+		}
+	}
+}
+
+func (b *Broker) hibernateIdleReplicas(now time.Time) {
+	for _, replica := range b.replicaLookup.Replicas() {
+		if !replica.IsLocal || now.Sub(replica.idleSince()) < b.config.HibernateAfter {
+			continue
+		}
+		if err := b.hibernateReplica(replica, now); err != nil {
+			log.Error.Printf("broker/%d: hibernate replica error: topic: %s, partition: %d: %s", b.config.ID, replica.Partition.Topic, replica.Partition.ID, err)
+		}
+	}
+}
+
+func (b *Broker) hibernateReplica(replica *Replica, now time.Time) error {
+	replica.Lock()
+	defer replica.Unlock()
+	if replica.hibernated || replica.Log == nil {
+		return nil
+	}
+	// the replica may have been woken since it was found idle, and isn't hibernated while a
+	// handler's using its log.
+	if now.Sub(replica.idleSince()) < b.config.HibernateAfter || atomic.LoadInt32(&replica.pins) > 0 {
+		return nil
+	}
+	if replica.Replicator != nil {
+		if err := replica.Replicator.Close(); err != nil {
+			return err
+		}
+		replica.Replicator = nil
+	}
+	if c, ok := replica.Log.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			return err
+		}
+	}
+	replica.Log = nil
+	replica.hibernated = true
+	log.Info.Printf("broker/%d: hibernated idle replica: topic: %s, partition: %d", b.config.ID, replica.Partition.Topic, replica.Partition.ID)
+	return nil
+}
+
+// unpin releases the replica pinned by wakeReplica, letting it be hibernated again.
+func (r *Replica) unpin() {
+	atomic.AddInt32(&r.pins, -1)
+}
+
+// pinAwake pins the replica, without marking it used, unless it's hibernated. It returns whether
+// the replica was pinned.
+func (r *Replica) pinAwake() bool {
+	r.Lock()
+	defer r.Unlock()
+	if r.hibernated {
+		return false
+	}
+	atomic.AddInt32(&r.pins, 1)
+	return true
+}
+
+// fetchedBy records that the follower fetched from the replica.
+func (r *Replica) fetchedBy(id int32, now time.Time) {
+	r.Lock()
+	defer r.Unlock()
+	if r.followerFetched == nil {
+		r.followerFetched = make(map[int32]time.Time)
+	}
+	r.followerFetched[id] = now
+}
+
+// wakeReplica marks the replica as used and reopens its log if it was hibernated. If this broker
+// leads the replica's partition its hibernated followers are told to resume replicating. The
+// replica's pinned so it isn't hibernated while the caller uses its log, callers unpin it once
+// they're done.
+func (b *Broker) wakeReplica(replica *Replica) protocol.Error {
+	now := b.clock.Now()
+	replica.touch(now)
+	replica.Lock()
+	if !replica.hibernated {
+		atomic.AddInt32(&replica.pins, 1)
+		replica.Unlock()
+		return protocol.ErrNone
+	}
+	if err := b.startReplica(replica); err != protocol.ErrNone {
+		replica.Unlock()
+		return err
+	}
+	replica.hibernated = false
+	atomic.AddInt32(&replica.pins, 1)
+	state := &protocol.PartitionState{
+		Topic:       replica.Partition.Topic,
+		Partition:   replica.Partition.ID,
+		Leader:      replica.Partition.Leader,
+		LeaderEpoch: replica.Partition.LeaderEpoch,
+		ISR:         replica.Partition.ISR,
+		Replicas:    replica.Partition.AR,
+	}
+	var followers []int32
+	for _, id := range replica.Partition.AR {
+		if id == b.config.ID {
+			continue
+		}
+		// followers keep fetching from a hibernated leader until they hibernate themselves, those
+		// that fetched recently are still replicating.
+		if fetched, ok := replica.followerFetched[id]; ok && now.Sub(fetched) < b.config.HibernateAfter/2 {
+			continue
+		}
+		followers = append(followers, id)
+	}
+	replica.Unlock()
+	log.Info.Printf("broker/%d: woke hibernated replica: topic: %s, partition: %d", b.config.ID, replica.Partition.Topic, replica.Partition.ID)
+
+	if state.Leader != b.config.ID {
+		return protocol.ErrNone
+	}
+	req := &protocol.LeaderAndISRRequest{
+		ControllerID:    b.config.ID,
+		PartitionStates: []*protocol.PartitionState{state},
+	}
+	for _, id := range followers {
+		if err := b.sendLeaderAndISR(id, req); err != nil {
+			log.Error.Printf("broker/%d: wake follower %d error: %s", b.config.ID, id, err)
+		}
+	}
+	return protocol.ErrNone
+}
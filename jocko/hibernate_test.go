@@ -0,0 +1,76 @@
+package jocko
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/testutil/retry"
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestBroker_HibernateReplica(t *testing.T) {
+	s, dir := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+		cfg.HibernateAfter = time.Hour
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+	b := s.handler.(*Broker)
+
+	conn, err := Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	CreateTopic(t, conn, "hibernate-topic", 1, 1)
+	var replica *Replica
+	retry.Run(t, func(r *retry.R) {
+		if replica, err = b.replicaLookup.Replica("hibernate-topic", 0); err != nil {
+			r.Fatal(err)
+		}
+	})
+
+	// recently used replicas aren't hibernated.
+	b.hibernateIdleReplicas(time.Now())
+	require.False(t, replica.isHibernated())
+	require.NotNil(t, replica.Log)
+
+	b.hibernateIdleReplicas(time.Now().Add(2 * time.Hour))
+	require.True(t, replica.isHibernated())
+	require.Nil(t, replica.Log)
+
+	set, err := protocol.Encode(&protocol.MessageSet{Offset: 0, Messages: []*protocol.Message{{Value: []byte("The message.")}}})
+	require.NoError(t, err)
+	res, err := conn.Produce(&protocol.ProduceRequest{
+		APIVersion: 2,
+		Timeout:    time.Second,
+		TopicData: []*protocol.TopicData{{
+			Topic: "hibernate-topic",
+			Data:  []*protocol.Data{{Partition: 0, RecordSet: set}},
+		}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrNone.Code(), res.Responses[0].PartitionResponses[0].ErrorCode)
+	require.False(t, replica.isHibernated())
+	require.NotNil(t, replica.Log)
+	require.Equal(t, int64(1), replica.Log.NewestOffset())
+
+	// replicas used since they were found idle aren't hibernated.
+	require.NoError(t, b.hibernateReplica(replica, time.Now()))
+	require.False(t, replica.isHibernated())
+
+	// nor are replicas pinned by a handler using their log.
+	require.Equal(t, protocol.ErrNone, b.wakeReplica(replica))
+	b.hibernateIdleReplicas(time.Now().Add(2 * time.Hour))
+	require.False(t, replica.isHibernated())
+	replica.unpin()
+	b.hibernateIdleReplicas(time.Now().Add(2 * time.Hour))
+	require.True(t, replica.isHibernated())
+}
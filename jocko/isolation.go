@@ -0,0 +1,34 @@
+package jocko
+
+import (
+	"github.com/travisjeffery/jocko/commitlog"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+// transactionLog is implemented by commit logs that track the transactions appended to them.
+type transactionLog interface {
+	LastStableOffset() int64
+	AbortedTransactions(from, to int64) []commitlog.AbortedTxn
+}
+
+// lastStableOffset returns the offset read committed consumers are served the log's records up
+// to, the first offset of its transactions that aren't committed or aborted yet.
+func lastStableOffset(l CommitLog) int64 {
+	if tl, ok := l.(transactionLog); ok {
+		return tl.LastStableOffset()
+	}
+	return l.NewestOffset()
+}
+
+// abortedTransactions returns the log's aborted transactions with records from the from offset up
+// to the to offset, which read committed consumers skip. It's never nil so the fetch response
+// tells them there aren't any.
+func abortedTransactions(l CommitLog, from, to int64) []*protocol.AbortedTransaction {
+	aborted := []*protocol.AbortedTransaction{}
+	if tl, ok := l.(transactionLog); ok {
+		for _, t := range tl.AbortedTransactions(from, to) {
+			aborted = append(aborted, &protocol.AbortedTransaction{ProducerID: t.ProducerID, FirstOffset: t.FirstOffset})
+		}
+	}
+	return aborted
+}
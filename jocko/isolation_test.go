@@ -0,0 +1,96 @@
+package jocko
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestBroker_ReadCommitted(t *testing.T) {
+	s, dir := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+
+	conn, err := Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	CreateTopic(t, conn, "transactions", 1, 1)
+	WaitForTopicLeader(t, "transactions", 0, s)
+	replica, err := s.broker().replicaLookup.Replica("transactions", 0)
+	require.NoError(t, err)
+
+	// the batches are appended to the log directly, as the transaction coordinator's markers are.
+	const transactional, control = 0x10, 0x20
+	appendBatch := func(attributes int16, producerID int64, records ...*protocol.Record) {
+		b, err := protocol.Encode(&protocol.RecordBatch{
+			Attributes:      attributes,
+			LastOffsetDelta: int32(len(records) - 1),
+			ProducerID:      producerID,
+			Records:         records,
+		})
+		require.NoError(t, err)
+		_, err = replica.Log.Append(b)
+		require.NoError(t, err)
+	}
+	fetch := func(isolation protocol.IsolationLevel) *protocol.FetchPartitionResponse {
+		res, err := conn.Fetch(&protocol.FetchRequest{
+			APIVersion:     9,
+			MaxWaitTime:    time.Second,
+			MinBytes:       1,
+			IsolationLevel: isolation,
+			Topics: []*protocol.FetchTopic{{
+				Topic:      "transactions",
+				Partitions: []*protocol.FetchPartition{{Partition: 0, CurrentLeaderEpoch: -1, MaxBytes: 1 << 20}},
+			}},
+		})
+		require.NoError(t, err)
+		p := res.Responses[0].PartitionResponses[0]
+		require.Equal(t, protocol.ErrNone.Code(), p.ErrorCode)
+		return p
+	}
+	latest := func(isolation protocol.IsolationLevel) int64 {
+		res, err := conn.Offsets(&protocol.OffsetsRequest{
+			APIVersion:     2,
+			ReplicaID:      -1,
+			IsolationLevel: int8(isolation),
+			Topics:         []*protocol.OffsetsTopic{{Topic: "transactions", Partitions: []*protocol.OffsetsPartition{{Partition: 0, Timestamp: -1}}}},
+		})
+		require.NoError(t, err)
+		return res.Responses[0].PartitionResponses[0].Offset
+	}
+
+	appendBatch(transactional, 1, &protocol.Record{Value: []byte("a")}, &protocol.Record{OffsetDelta: 1, Value: []byte("b")})
+	appendBatch(0, -1, &protocol.Record{Value: []byte("c")})
+
+	// the open transaction holds back read committed consumers.
+	p := fetch(protocol.ReadCommitted)
+	require.Empty(t, p.RecordSet)
+	require.Equal(t, int64(-1), p.LastStableOffset)
+	require.Equal(t, int64(2), p.HighWatermark)
+	require.Equal(t, []*protocol.AbortedTransaction{}, p.AbortedTransactions)
+	require.Equal(t, int64(0), latest(protocol.ReadCommitted))
+	p = fetch(protocol.ReadUncommitted)
+	require.NotEmpty(t, p.RecordSet)
+	require.Nil(t, p.AbortedTransactions)
+	require.Equal(t, int64(3), latest(protocol.ReadUncommitted))
+
+	// once it's aborted they're served its records and told to skip them.
+	appendBatch(transactional|control, 1, &protocol.Record{Key: []byte{0, 0, 0, 0}, Value: []byte{0, 0, 0, 0, 0, 0}})
+	p = fetch(protocol.ReadCommitted)
+	require.Equal(t, int64(3), p.LastStableOffset)
+	require.Equal(t, []*protocol.AbortedTransaction{{ProducerID: 1, FirstOffset: 0}}, p.AbortedTransactions)
+	uncommitted := fetch(protocol.ReadUncommitted)
+	require.Equal(t, uncommitted.RecordSet, p.RecordSet)
+	require.Equal(t, int64(4), latest(protocol.ReadCommitted))
+}
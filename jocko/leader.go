@@ -19,6 +19,9 @@ import (
 
 const (
 	barrierWriteTimeout = 2 * time.Minute
+	// maxReconcileBatch caps the members reconciled together, so a restarting cluster's node
+	// registrations are split over a few raft entries rather than thousands.
+	maxReconcileBatch = 256
 )
 
 // setupRaft is used to setup and initialize Raft.
@@ -32,17 +35,22 @@ func (b *Broker) setupRaft() (err error) {
 		}
 	}()
 
-	b.fsm, err = fsm.New(b.tracer, fsm.NodeID(b.config.ID))
+	b.fsm, err = fsm.New(b.tracer, fsm.NodeID(b.config.ID), fsm.OnTopicChange(b.onTopicChange), fsm.OnApply(b.appendClusterMetadata), fsm.OnSnapshot(b.trimClusterMetadata))
 	if err != nil {
 		return err
 	}
 
-	trans, err := raft.NewTCPTransport(b.config.RaftAddr,
-		nil,
-		3,
-		10*time.Second,
-		nil,
-	)
+	var trans *raft.NetworkTransport
+	if b.peerTLS != nil {
+		trans, err = newTLSTransport(b.config.RaftAddr, b.peerTLS, 3, 10*time.Second)
+	} else {
+		trans, err = raft.NewTCPTransport(b.config.RaftAddr,
+			nil,
+			3,
+			10*time.Second,
+			nil,
+		)
+	}
 	if err != nil {
 		return err
 	}
@@ -50,6 +58,9 @@ func (b *Broker) setupRaft() (err error) {
 
 	b.config.RaftConfig.LocalID = raft.ServerID(fmt.Sprintf("%d", b.config.ID))
 	b.config.RaftConfig.StartAsLeader = b.config.StartAsLeader
+	if b.config.LogOutput != nil {
+		b.config.RaftConfig.LogOutput = b.config.LogOutput
+	}
 
 	// build an in-memory setup for dev mode, disk-based otherwise.
 	var logStore raft.LogStore
@@ -114,8 +125,12 @@ func (b *Broker) setupRaft() (err error) {
 	b.raftNotifyCh = raftNotifyCh
 
 	// setup raft store
-	b.raft, err = raft.NewRaft(b.config.RaftConfig, b.fsm, logStore, stable, snap, trans)
-	return err
+	r, err := raft.NewRaft(b.config.RaftConfig, b.fsm, logStore, stable, snap, trans)
+	if err != nil {
+		return err
+	}
+	b.raft = r
+	return nil
 }
 
 func (b *Broker) monitorLeadership() {
@@ -133,11 +148,15 @@ func (b *Broker) monitorLeadership() {
 				}
 				weAreLeaderCh = make(chan struct{})
 				leaderLoop.Add(1)
-				go func(ch chan struct{}) {
+				ch := weAreLeaderCh
+				b.goroutines.goFunc("leader", func() {
 					defer leaderLoop.Done()
 					b.leaderLoop(ch)
-				}(weAreLeaderCh)
+				})
 				log.Info.Printf("leader/%d: cluster leadership acquired", b.config.ID)
+				if b.config.OnLeaderChange != nil {
+					b.config.OnLeaderChange(true)
+				}
 
 			default:
 				if weAreLeaderCh == nil {
@@ -149,6 +168,9 @@ func (b *Broker) monitorLeadership() {
 				leaderLoop.Wait()
 				weAreLeaderCh = nil
 				log.Info.Printf("leader/%d: cluster leadership lost", b.config.ID)
+				if b.config.OnLeaderChange != nil {
+					b.config.OnLeaderChange(false)
+				}
 			}
 		case <-b.shutdownCh:
 			return
@@ -173,7 +195,7 @@ func (b *Broker) leaderLoop(stopCh chan struct{}) {
 
 RECONCILE:
 	reconcileCh = nil
-	interval := time.After(b.config.ReconcileInterval)
+	interval := b.clock.After(b.config.ReconcileInterval)
 	barrier := b.raft.Barrier(barrierWriteTimeout)
 	if err := barrier.Error(); err != nil {
 		log.Error.Printf("leader/%d: wait for barrier error: %s", b.config.ID, err)
@@ -198,6 +220,14 @@ RECONCILE:
 		goto WAIT
 	}
 
+	if err := b.populateBrokers(); err != nil {
+		log.Error.Printf("leader/%d: populate brokers error: %s", b.config.ID, err)
+	}
+
+	if err := b.shedMaintenanceLeaderships(); err != nil {
+		log.Error.Printf("leader/%d: shed maintenance leaderships error: %s", b.config.ID, err)
+	}
+
 	reconcileCh = b.reconcileCh
 
 WAIT:
@@ -210,7 +240,7 @@ WAIT:
 		case <-interval:
 			goto RECONCILE
 		case member := <-reconcileCh:
-			b.reconcileMember(member)
+			b.reconcileMembers(b.coalesceMembers(member, reconcileCh, stopCh))
 		}
 	}
 }
@@ -219,10 +249,8 @@ WAIT:
 func (b *Broker) reconcile() error {
 	members := b.LANMembers()
 	knownMembers := make(map[int32]struct{})
+	b.reconcileBatches(members)
 	for _, member := range members {
-		if err := b.reconcileMember(member); err != nil {
-			return err
-		}
 		meta, ok := metadata.IsBroker(member)
 		if !ok {
 			continue
@@ -238,132 +266,222 @@ func (b *Broker) reconcileReaped(known map[int32]struct{}) error {
 	if err != nil {
 		return err
 	}
+	var reaped []serf.Member
 	for _, node := range nodes {
 		if _, ok := known[node.Node]; ok {
 			continue
 		}
-		member := serf.Member{
+		reaped = append(reaped, serf.Member{
 			Tags: map[string]string{
 				"id":   fmt.Sprintf("%d", node.Node),
 				"role": "jocko",
 			},
+			Status: StatusReap,
+		})
+	}
+	b.reconcileBatches(reaped)
+	return nil
+}
+
+// reconcileBatches reconciles the members maxReconcileBatch at a time.
+func (b *Broker) reconcileBatches(members []serf.Member) {
+	for i := 0; i < len(members); i += maxReconcileBatch {
+		end := i + maxReconcileBatch
+		if end > len(members) {
+			end = len(members)
 		}
-		if err := b.handleReapMember(member); err != nil {
-			return err
+		b.reconcileMembers(members[i:end])
+	}
+}
+
+// coalesceMembers returns the member with those queued after it within the reconcile coalesce
+// period, keeping each member's latest event, so bursts of member events are reconciled together.
+func (b *Broker) coalesceMembers(first serf.Member, ch chan serf.Member, stopCh chan struct{}) []serf.Member {
+	members := []serf.Member{first}
+	index := map[string]int{first.Name: 0}
+	timer := b.clock.NewTimer(b.config.ReconcileCoalescePeriod)
+	defer timer.Stop()
+	for len(members) < maxReconcileBatch {
+		select {
+		case m := <-ch:
+			if i, ok := index[m.Name]; ok {
+				members[i] = m
+				continue
+			}
+			index[m.Name] = len(members)
+			members = append(members, m)
+		case <-timer.C():
+			return members
+		case <-stopCh:
+			return members
+		case <-b.shutdownCh:
+			return members
 		}
 	}
-	return nil
+	return members
 }
 
-func (b *Broker) reconcileMember(m serf.Member) error {
-	var err error
-	switch m.Status {
-	case serf.StatusAlive:
-		err = b.handleAliveMember(m)
-	case serf.StatusFailed:
-		err = b.handleFailedMember(m)
-	case StatusReap:
-		err = b.handleReapMember(m)
-	case serf.StatusLeft:
-		err = b.handleLeftMember(m)
+// reconcileMembers updates the members' nodes in the replicated state, batching their
+// registrations and deregistrations into one raft entry.
+func (b *Broker) reconcileMembers(members []serf.Member) {
+	var req structs.BatchNodesRequest
+	var failed []serf.Member
+	for _, m := range members {
+		var node *structs.Node
+		var err error
+		switch m.Status {
+		case serf.StatusAlive:
+			node, err = b.aliveMemberNode(m)
+		case serf.StatusFailed:
+			if node, err = b.failedMemberNode(m); err == nil {
+				failed = append(failed, m)
+			}
+		case StatusReap:
+			if node, err = b.deregisterMemberNode("reaped", m); node != nil {
+				req.Deregister = append(req.Deregister, *node)
+				node = nil
+			}
+		case serf.StatusLeft:
+			if node, err = b.deregisterMemberNode("left", m); node != nil {
+				req.Deregister = append(req.Deregister, *node)
+				node = nil
+			}
+		}
+		if err != nil {
+			log.Error.Printf("leader/%d: reconcile member: %s: error: %s", b.config.ID, m.Name, err)
+			continue
+		}
+		if node != nil {
+			req.Register = append(req.Register, *node)
+		}
 	}
-	if err != nil {
-		log.Error.Printf("leader/%d: reconcile member: %s: error: %s", m.Name, b.config.ID, err)
+	if err := b.applyNodes(req); err != nil {
+		log.Error.Printf("leader/%d: reconcile members: apply nodes error: %s", b.config.ID, err)
+		return
 	}
-	return nil
+	for _, m := range failed {
+		if err := b.reassignFailedMember(m); err != nil {
+			log.Error.Printf("leader/%d: reconcile member: %s: error: %s", b.config.ID, m.Name, err)
+		}
+	}
+}
+
+// applyNodes applies the node changes. A single change is applied as a plain register or
+// deregister node request.
+func (b *Broker) applyNodes(req structs.BatchNodesRequest) error {
+	var err error
+	switch {
+	case len(req.Register)+len(req.Deregister) == 0:
+	case len(req.Register) == 1 && len(req.Deregister) == 0:
+		_, err = b.raftApply(structs.RegisterNodeRequestType, &structs.RegisterNodeRequest{Node: req.Register[0]})
+	case len(req.Register) == 0 && len(req.Deregister) == 1:
+		_, err = b.raftApply(structs.DeregisterNodeRequestType, &structs.DeregisterNodeRequest{Node: req.Deregister[0]})
+	default:
+		log.Info.Printf("leader/%d: reconcile members: registering %d nodes, deregistering %d nodes", b.config.ID, len(req.Register), len(req.Deregister))
+		_, err = b.raftApply(structs.BatchNodesRequestType, &req)
+	}
+	return err
 }
 
-func (b *Broker) handleAliveMember(m serf.Member) error {
+// aliveMemberNode adds the member to the raft cluster and returns its node to register, or nil
+// if it's registered.
+func (b *Broker) aliveMemberNode(m serf.Member) (*structs.Node, error) {
 	meta, ok := metadata.IsBroker(m)
-	if ok {
-		if err := b.joinCluster(m, meta); err != nil {
-			return err
+	if !ok {
+		return nil, nil
+	}
+	// a broker not supporting a finalized feature, e.g. one rolled back to an old version, could
+	// misread the data written using it.
+	if f, err := b.unsupportedFinalizedFeature(meta); err != nil || f != nil {
+		if f != nil {
+			log.Error.Printf("leader/%d: not adding %s: it doesn't support feature %s at finalized level %d, upgrade it", b.config.ID, m.Name, f.Name, f.Level)
 		}
+		return nil, err
+	}
+	if err := b.joinCluster(m, meta); err != nil {
+		return nil, err
 	}
 	state := b.fsm.State()
 	_, node, err := state.GetNode(meta.ID.Int32())
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if node != nil {
 		// TODO: should still register?
-		return nil
+		return nil, nil
 	}
 
 	log.Info.Printf("leader/%d: member joined, marking health alive: %s", b.config.ID, m.Name)
-	req := structs.RegisterNodeRequest{
-		Node: structs.Node{
-			Node:    meta.ID.Int32(),
-			Address: meta.BrokerAddr,
-			Meta: map[string]string{
-				"raft_addr":     meta.RaftAddr,
-				"serf_lan_addr": meta.SerfLANAddr,
-				"name":          meta.Name,
-			},
-			Check: &structs.HealthCheck{
-				Node:    meta.ID.String(),
-				CheckID: structs.SerfCheckID,
-				Name:    structs.SerfCheckName,
-				Status:  structs.HealthPassing,
-				Output:  structs.SerfCheckAliveOutput,
-			},
+	node = &structs.Node{
+		Node:    meta.ID.Int32(),
+		Address: meta.BrokerAddr,
+		Meta: map[string]string{
+			"raft_addr":     meta.RaftAddr,
+			"serf_lan_addr": meta.SerfLANAddr,
+			"name":          meta.Name,
+		},
+		Check: &structs.HealthCheck{
+			Node:    meta.ID.String(),
+			CheckID: structs.SerfCheckID,
+			Name:    structs.SerfCheckName,
+			Status:  structs.HealthPassing,
+			Output:  structs.SerfCheckAliveOutput,
 		},
 	}
-	_, err = b.raftApply(structs.RegisterNodeRequestType, &req)
-	return err
+	if meta.Observer {
+		node.Meta[observerNodeMeta] = "1"
+	}
+	return node, nil
 }
 
+// raftApplyTimeout is how long raftApply waits for the entry to be enqueued.
+const raftApplyTimeout = 30 * time.Second
+
 func (b *Broker) raftApply(t structs.MessageType, msg interface{}) (interface{}, error) {
+	return b.raftApplyWithin(t, msg, raftApplyTimeout)
+}
+
+// raftApplyWithin is raftApply waiting up to the timeout for the entry to be enqueued.
+func (b *Broker) raftApplyWithin(t structs.MessageType, msg interface{}, timeout time.Duration) (interface{}, error) {
 	buf, err := structs.Encode(t, msg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to encode request: %v", err)
 	}
-	future := b.raft.Apply(buf, 30*time.Second)
+	future := b.raft.Apply(buf, timeout)
 	if err := future.Error(); err != nil {
 		return nil, err
 	}
 	return future.Response(), nil
 }
 
-func (b *Broker) handleLeftMember(m serf.Member) error {
-	return b.handleDeregisterMember("left", m)
-}
-
-func (b *Broker) handleReapMember(member serf.Member) error {
-	return b.handleDeregisterMember("reaped", member)
-}
-
-// handleDeregisterMember is used to deregister a mmeber for a given reason.
-func (b *Broker) handleDeregisterMember(reason string, member serf.Member) error {
+// deregisterMemberNode removes the member from the raft cluster and returns its node to
+// deregister, or nil if it isn't registered.
+func (b *Broker) deregisterMemberNode(reason string, member serf.Member) (*structs.Node, error) {
 	meta, ok := metadata.IsBroker(member)
 	if !ok {
-		return nil
+		return nil, nil
 	}
 
 	if meta.ID.Int32() == b.config.ID {
 		log.Debug.Printf("leader/%d: deregistering self should be done by follower", b.config.ID)
-		return nil
+		return nil, nil
 	}
 
 	if err := b.removeServer(member, meta); err != nil {
-		return err
+		return nil, err
 	}
 
 	state := b.fsm.State()
 	_, node, err := state.GetNode(meta.ID.Int32())
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if node == nil {
-		return nil
+		return nil, nil
 	}
 
 	log.Info.Printf("leader/%d: member is deregistering: reason: %s; node: %s", b.config.ID, reason, meta.ID)
-	req := structs.DeregisterNodeRequest{
-		Node: structs.Node{Node: meta.ID.Int32()},
-	}
-	_, err = b.raftApply(structs.DeregisterNodeRequestType, &req)
-	return err
+	return &structs.Node{Node: meta.ID.Int32()}, nil
 }
 
 func (b *Broker) joinCluster(m serf.Member, parts *metadata.Broker) error {
@@ -378,6 +496,13 @@ func (b *Broker) joinCluster(m serf.Member, parts *metadata.Broker) error {
 		}
 	}
 
+	// a broker with a duplicated address refuses to start but may be seen before it leaves, it
+	// mustn't replace the raft server it duplicates.
+	if dup, addr, ok := findDuplicateAddr(b.LANMembers(), m.Name, parts.ID.Int32(), parts.BrokerAddr, parts.RaftAddr); ok {
+		log.Error.Printf("leader/%d: not adding %s to raft: %s is already advertised by %s", b.config.ID, m.Name, addr, dup.Name)
+		return nil
+	}
+
 	configFuture := b.raft.GetConfiguration()
 	if err := configFuture.Error(); err != nil {
 		log.Error.Printf("leader/%d: get raft configuration error: %s", b.config.ID, err)
@@ -433,26 +558,36 @@ func (b *Broker) joinCluster(m serf.Member, parts *metadata.Broker) error {
 	return nil
 }
 
-func (b *Broker) handleFailedMember(m serf.Member) error {
+// failedMemberNode returns the member's node to register as failing. The node keeps its
+// registered meta, e.g. so a broker restarted during maintenance stays in it.
+func (b *Broker) failedMemberNode(m serf.Member) (*structs.Node, error) {
 	meta, ok := metadata.IsBroker(m)
 	if !ok {
-		return nil
+		return nil, nil
 	}
-
-	req := structs.RegisterNodeRequest{
-		Node: structs.Node{
-			Node: meta.ID.Int32(),
-			Check: &structs.HealthCheck{
-				Node:    m.Tags["raft_addr"],
-				CheckID: structs.SerfCheckID,
-				Name:    structs.SerfCheckName,
-				Status:  structs.HealthCritical,
-				Output:  structs.SerfCheckFailedOutput,
-			},
-		},
+	_, existing, err := b.fsm.State().GetNode(meta.ID.Int32())
+	if err != nil {
+		return nil, err
 	}
-	if _, err := b.raftApply(structs.RegisterNodeRequestType, &req); err != nil {
-		return err
+	node := &structs.Node{Node: meta.ID.Int32()}
+	if existing != nil {
+		node.Address, node.Meta = existing.Address, existing.Meta
+	}
+	node.Check = &structs.HealthCheck{
+		Node:    m.Tags["raft_addr"],
+		CheckID: structs.SerfCheckID,
+		Name:    structs.SerfCheckName,
+		Status:  structs.HealthCritical,
+		Output:  structs.SerfCheckFailedOutput,
+	}
+	return node, nil
+}
+
+// reassignFailedMember moves the leaderships of the failed member's partitions to passing brokers.
+func (b *Broker) reassignFailedMember(m serf.Member) error {
+	meta, ok := metadata.IsBroker(m)
+	if !ok {
+		return nil
 	}
 
 	// TODO should put all the following some where else. maybe onBrokerChange or handleBrokerChange
@@ -477,10 +612,13 @@ func (b *Broker) handleFailedMember(m serf.Member) error {
 	// TODO: add an index for this. have same code in broker.go:handleMetadata(...)
 	var passing []*structs.Node
 	for _, n := range nodes {
-		if n.Check.Status == structs.HealthPassing && n.ID != meta.ID.Int32() {
+		if n.Node != meta.ID.Int32() && canLead(n) {
 			passing = append(passing, n)
 		}
 	}
+	if len(passing) == 0 && len(partitions) > 0 {
+		return fmt.Errorf("no passing brokers to move %d partitions led by %s to", len(partitions), m.Name)
+	}
 
 	// reassign consumer group coordinators
 	_, groups, err := state.GetGroupsByCoordinator(meta.ID.Int32())
@@ -524,29 +662,28 @@ func (b *Broker) handleFailedMember(m serf.Member) error {
 			}
 		}
 
-		// TODO: need to update epochs
-
 		req := structs.RegisterPartitionRequest{
 			Partition: structs.Partition{
-				Topic:     p.Topic,
-				ID:        p.Partition,
-				Partition: p.Partition,
-				Leader:    node.Node,
-				AR:        ar,
-				ISR:       isr,
+				Topic:       p.Topic,
+				ID:          p.Partition,
+				Partition:   p.Partition,
+				Leader:      node.Node,
+				AR:          ar,
+				ISR:         isr,
+				LeaderEpoch: p.LeaderEpoch + 1,
 			},
 		}
 		if _, err = b.raftApply(structs.RegisterPartitionRequestType, req); err != nil {
 			return err
 		}
-		// TODO: need to send on leader and isr changes now i think
 		leaderAndISRReq.PartitionStates = append(leaderAndISRReq.PartitionStates, &protocol.PartitionState{
 			Topic:     p.Topic,
 			Partition: p.Partition,
-			// TODO: ControllerEpoch, LeaderEpoch, ZKVersion - lol
-			Leader:   p.Leader,
-			ISR:      p.ISR,
-			Replicas: p.AR,
+			// TODO: ControllerEpoch, ZKVersion
+			LeaderEpoch: req.Partition.LeaderEpoch,
+			Leader:      req.Partition.Leader,
+			ISR:         req.Partition.ISR,
+			Replicas:    req.Partition.AR,
 		})
 	}
 
@@ -558,11 +695,7 @@ func (b *Broker) handleFailedMember(m serf.Member) error {
 			log.Error.Printf("trying to assign partitions to unknown broker: %s", n)
 			continue
 		}
-		conn, err := defaultDialer.Dial("tcp", broker.BrokerAddr)
-		if err != nil {
-			return err
-		}
-		_, err = conn.LeaderAndISR(leaderAndISRReq)
+		_, err = b.brokerClient(n.Node).LeaderAndISR(leaderAndISRReq)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,51 @@
+package jocko
+
+import (
+	"fmt"
+
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+// checkLeader returns ErrNotLeaderForPartition if the broker isn't the replica's leader. The
+// replicated partition state is checked too since the controller updates it before this broker
+// hears of the new leader, so produces and fetches sent to an old leader fail straight away rather
+// than after the leader and ISR request arrives. The error has the current leader and its epoch
+// as a hint.
+func (b *Broker) checkLeader(replica *Replica) protocol.Error {
+	leader, epoch := b.currentLeader(replica)
+	if leader != b.config.ID {
+		return protocol.ErrNotLeaderForPartition.WithErr(fmt.Errorf("leader is broker %d at epoch %d", leader, epoch))
+	}
+	return protocol.ErrNone
+}
+
+// checkLeaderEpoch checks the leader epoch of a client's metadata against the partition's,
+// returning ErrFencedLeaderEpoch if the client's is older and ErrUnknownLeaderEpoch if it's newer
+// than this broker's heard of, so clients with stale metadata refresh it rather than read from or
+// list offsets of a deposed leader. A negative epoch isn't checked.
+func (b *Broker) checkLeaderEpoch(replica *Replica, clientEpoch int32) protocol.Error {
+	if clientEpoch < 0 {
+		return protocol.ErrNone
+	}
+	_, epoch := b.currentLeader(replica)
+	if clientEpoch < epoch {
+		return protocol.ErrFencedLeaderEpoch.WithErr(fmt.Errorf("epoch %d is older than the current epoch %d", clientEpoch, epoch))
+	}
+	if clientEpoch > epoch {
+		return protocol.ErrUnknownLeaderEpoch.WithErr(fmt.Errorf("epoch %d is newer than the current epoch %d", clientEpoch, epoch))
+	}
+	return protocol.ErrNone
+}
+
+// currentLeader returns the replica's leader and its epoch, from the replicated partition state
+// if it's newer than the replica's.
+func (b *Broker) currentLeader(replica *Replica) (int32, int32) {
+	replica.Lock()
+	leader, epoch := replica.Partition.Leader, replica.Partition.LeaderEpoch
+	replica.Unlock()
+	_, p, err := b.fsm.State().GetPartition(replica.Partition.Topic, replica.Partition.ID)
+	if err == nil && p != nil && p.LeaderEpoch >= epoch {
+		leader, epoch = p.Leader, p.LeaderEpoch
+	}
+	return leader, epoch
+}
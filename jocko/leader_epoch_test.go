@@ -0,0 +1,162 @@
+package jocko
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/testutil/retry"
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/jocko/structs"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestBroker_NotLeaderAfterLeaderChange(t *testing.T) {
+	s, dir := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+	b := s.handler.(*Broker)
+
+	conn, err := Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	CreateTopic(t, conn, "epoch-topic", 1, 1)
+	var replica *Replica
+	retry.Run(t, func(r *retry.R) {
+		if replica, err = b.replicaLookup.Replica("epoch-topic", 0); err != nil {
+			r.Fatal(err)
+		}
+	})
+	require.Equal(t, protocol.ErrNone, b.checkLeader(replica))
+
+	// the controller moves the leader but this broker hasn't been sent the leader and isr request.
+	_, err = b.raftApply(structs.RegisterPartitionRequestType, structs.RegisterPartitionRequest{
+		Partition: structs.Partition{
+			Topic:       "epoch-topic",
+			ID:          0,
+			Partition:   0,
+			Leader:      b.config.ID + 1,
+			AR:          []int32{b.config.ID + 1},
+			ISR:         []int32{b.config.ID + 1},
+			LeaderEpoch: 1,
+		},
+	})
+	require.NoError(t, err)
+
+	err = b.checkLeader(replica)
+	require.Equal(t, protocol.ErrNotLeaderForPartition.Code(), err.(protocol.Error).Code())
+	require.Contains(t, err.Error(), "at epoch 1")
+
+	set, err := protocol.Encode(&protocol.MessageSet{Messages: []*protocol.Message{{Value: []byte("The message.")}}})
+	require.NoError(t, err)
+	pres, err := conn.Produce(&protocol.ProduceRequest{
+		APIVersion: 2,
+		Timeout:    time.Second,
+		TopicData: []*protocol.TopicData{{
+			Topic: "epoch-topic",
+			Data:  []*protocol.Data{{Partition: 0, RecordSet: set}},
+		}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrNotLeaderForPartition.Code(), pres.Responses[0].PartitionResponses[0].ErrorCode)
+
+	fres, err := conn.Fetch(&protocol.FetchRequest{
+		MaxWaitTime: time.Second,
+		MinBytes:    1,
+		Topics: []*protocol.FetchTopic{{
+			Topic:      "epoch-topic",
+			Partitions: []*protocol.FetchPartition{{Partition: 0, MaxBytes: 1 << 10}},
+		}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrNotLeaderForPartition.Code(), fres.Responses[0].PartitionResponses[0].ErrorCode)
+}
+
+func TestBroker_CheckLeaderEpoch(t *testing.T) {
+	s, dir := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+	b := s.handler.(*Broker)
+
+	conn, err := Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	CreateTopic(t, conn, "epoch-topic", 1, 1)
+	WaitForTopicLeader(t, "epoch-topic", 0, s)
+	replica, err := b.replicaLookup.Replica("epoch-topic", 0)
+	require.NoError(t, err)
+	_, epoch := b.currentLeader(replica)
+
+	fetch := func(clientEpoch int32) int16 {
+		res, err := conn.Fetch(&protocol.FetchRequest{
+			APIVersion:  9,
+			MaxWaitTime: time.Second,
+			Topics: []*protocol.FetchTopic{{
+				Topic:      "epoch-topic",
+				Partitions: []*protocol.FetchPartition{{Partition: 0, CurrentLeaderEpoch: clientEpoch, MaxBytes: 1 << 10}},
+			}},
+		})
+		require.NoError(t, err)
+		return res.Responses[0].PartitionResponses[0].ErrorCode
+	}
+	listOffsets := func(clientEpoch int32) *protocol.PartitionResponse {
+		res, err := conn.Offsets(&protocol.OffsetsRequest{
+			APIVersion: 4,
+			Topics: []*protocol.OffsetsTopic{{
+				Topic:      "epoch-topic",
+				Partitions: []*protocol.OffsetsPartition{{Partition: 0, CurrentLeaderEpoch: clientEpoch, Timestamp: -1}},
+			}},
+		})
+		require.NoError(t, err)
+		return res.Responses[0].PartitionResponses[0]
+	}
+
+	require.Equal(t, protocol.ErrNone.Code(), fetch(epoch))
+	require.Equal(t, protocol.ErrNone.Code(), fetch(-1))
+	require.Equal(t, protocol.ErrUnknownLeaderEpoch.Code(), fetch(epoch+1))
+	p := listOffsets(epoch)
+	require.Equal(t, protocol.ErrNone.Code(), p.ErrorCode)
+	require.Equal(t, epoch, p.LeaderEpoch)
+	require.Equal(t, protocol.ErrUnknownLeaderEpoch.Code(), listOffsets(epoch+1).ErrorCode)
+
+	// the controller moves the leader away and back, so clients at the old epoch are fenced.
+	for _, leader := range []int32{b.config.ID + 1, b.config.ID} {
+		epoch++
+		_, err = b.raftApply(structs.RegisterPartitionRequestType, structs.RegisterPartitionRequest{
+			Partition: structs.Partition{
+				Topic:       "epoch-topic",
+				ID:          0,
+				Partition:   0,
+				Leader:      leader,
+				AR:          []int32{b.config.ID},
+				ISR:         []int32{b.config.ID},
+				LeaderEpoch: epoch,
+			},
+		})
+		require.NoError(t, err)
+	}
+	require.Equal(t, protocol.ErrFencedLeaderEpoch.Code(), fetch(epoch-2))
+	require.Equal(t, protocol.ErrFencedLeaderEpoch.Code(), listOffsets(epoch-2).ErrorCode)
+	require.Equal(t, protocol.ErrNone.Code(), fetch(epoch))
+
+	// fetch sessions aren't created so others are unknown.
+	res, err := conn.Fetch(&protocol.FetchRequest{APIVersion: 7, SessionID: 1, SessionEpoch: 1})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrFetchSessionIDNotFound.Code(), res.ErrorCode)
+	require.Equal(t, int32(0), res.SessionID)
+}
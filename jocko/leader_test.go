@@ -0,0 +1,44 @@
+package jocko
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/serf/serf"
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/clock"
+	"github.com/travisjeffery/jocko/jocko/config"
+)
+
+func TestCoalesceMembers(t *testing.T) {
+	sim := clock.NewSim(time.Now())
+	b := &Broker{
+		config:     &config.Config{ReconcileCoalescePeriod: 50 * time.Millisecond},
+		shutdownCh: make(chan struct{}),
+		clock:      sim,
+	}
+	ch := make(chan serf.Member, 8)
+	ch <- serf.Member{Name: "b", Status: serf.StatusAlive}
+	ch <- serf.Member{Name: "a", Status: serf.StatusFailed}
+	ch <- serf.Member{Name: "c", Status: serf.StatusAlive}
+	go func() {
+		// events within the coalesce period are batched too.
+		sim.BlockUntil(1)
+		sim.Advance(49 * time.Millisecond)
+		ch <- serf.Member{Name: "b", Status: serf.StatusLeft}
+		for len(ch) != 0 {
+			runtime.Gosched()
+		}
+		sim.Advance(time.Millisecond)
+	}()
+
+	members := b.coalesceMembers(serf.Member{Name: "a", Status: serf.StatusAlive}, ch, make(chan struct{}))
+	require.Equal(t, []serf.Member{
+		{Name: "a", Status: serf.StatusFailed},
+		{Name: "b", Status: serf.StatusLeft},
+		{Name: "c", Status: serf.StatusAlive},
+	}, members)
+	require.Equal(t, 0, len(ch))
+	require.Equal(t, 0, sim.Waiters())
+}
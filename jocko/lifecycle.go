@@ -0,0 +1,117 @@
+package jocko
+
+import (
+	"bytes"
+	"fmt"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/travisjeffery/jocko/log"
+)
+
+// shutdownLeakTimeout is how long Shutdown waits for the broker's goroutines to exit before
+// reporting them as leaked.
+const shutdownLeakTimeout = 5 * time.Second
+
+// lifecycle tracks the broker's long-running goroutines by subsystem so Shutdown can check they've
+// all exited. Ones that haven't leak, accumulating in processes that restart brokers, like tests
+// and apps embedding them. A nil lifecycle runs its goroutines untracked.
+type lifecycle struct {
+	mu     sync.Mutex
+	counts map[string]int
+	// exited is closed and replaced when a goroutine exits, waking the waiters.
+	exited chan struct{}
+}
+
+func newLifecycle() *lifecycle {
+	return &lifecycle{counts: make(map[string]int), exited: make(chan struct{})}
+}
+
+// goFunc runs fn in a goroutine tracked under the subsystem.
+func (l *lifecycle) goFunc(subsystem string, fn func()) {
+	if l == nil {
+		go fn()
+		return
+	}
+	l.mu.Lock()
+	l.counts[subsystem]++
+	l.mu.Unlock()
+	go func() {
+		defer l.done(subsystem)
+		fn()
+	}()
+}
+
+func (l *lifecycle) done(subsystem string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.counts[subsystem]--; l.counts[subsystem] == 0 {
+		delete(l.counts, subsystem)
+	}
+	close(l.exited)
+	l.exited = make(chan struct{})
+}
+
+// running returns the number of goroutines running by subsystem.
+func (l *lifecycle) running() map[string]int {
+	running := make(map[string]int)
+	if l == nil {
+		return running
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for s, n := range l.counts {
+		running[s] = n
+	}
+	return running
+}
+
+// wait waits up to the timeout for the goroutines to exit, returning the ones still running by
+// subsystem.
+func (l *lifecycle) wait(timeout time.Duration) map[string]int {
+	if l == nil {
+		return nil
+	}
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		l.mu.Lock()
+		n, exited := len(l.counts), l.exited
+		l.mu.Unlock()
+		if n == 0 {
+			return nil
+		}
+		select {
+		case <-exited:
+		case <-deadline.C:
+			return l.running()
+		}
+	}
+}
+
+// waitGoroutines waits for the broker's goroutines to exit after it's shut down, reporting the
+// ones that don't with the stacks of the process's goroutines to debug them by.
+func (b *Broker) waitGoroutines() {
+	running := b.goroutines.wait(shutdownLeakTimeout)
+	if len(running) == 0 {
+		return
+	}
+	log.Error.Printf("broker/%d: goroutines still running %s after shutdown: %s", b.config.ID, shutdownLeakTimeout, formatRunning(running))
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err == nil {
+		log.Debug.Printf("broker/%d: goroutines:\n%s", b.config.ID, buf.String())
+	}
+}
+
+// formatRunning formats the goroutines running by subsystem, e.g. "leader: 1, replicator: 4".
+func formatRunning(running map[string]int) string {
+	s := make([]string, 0, len(running))
+	for subsystem, n := range running {
+		s = append(s, fmt.Sprintf("%s: %d", subsystem, n))
+	}
+	sort.Strings(s)
+	return strings.Join(s, ", ")
+}
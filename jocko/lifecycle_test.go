@@ -0,0 +1,33 @@
+package jocko
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLifecycle(t *testing.T) {
+	req := require.New(t)
+	l := newLifecycle()
+	stop := make(chan struct{})
+	block := func() { <-stop }
+	l.goFunc("a", block)
+	l.goFunc("a", block)
+	l.goFunc("b", func() {})
+
+	// the goroutines still running are reported by subsystem.
+	req.Equal(map[string]int{"a": 2}, l.wait(50*time.Millisecond))
+	req.Equal("a: 2", formatRunning(l.running()))
+
+	close(stop)
+	req.Empty(l.wait(time.Second))
+	req.Empty(l.running())
+
+	// a nil lifecycle runs its goroutines untracked.
+	var untracked *lifecycle
+	done := make(chan struct{})
+	untracked.goFunc("a", func() { close(done) })
+	<-done
+	req.Empty(untracked.wait(time.Second))
+}
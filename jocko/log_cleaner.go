@@ -0,0 +1,73 @@
+package jocko
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/travisjeffery/jocko/commitlog"
+	"github.com/travisjeffery/jocko/log"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+// compactionLog is implemented by commit logs that can be compacted on demand.
+type compactionLog interface {
+	Compact() (int64, error)
+	CleanerStats() (commitlog.CleanerStats, bool)
+}
+
+// handleCompactPartition compacts the partition's local replica's log now rather than when its
+// active segment next splits, so an operator can recover disk space in an emergency.
+func (b *Broker) handleCompactPartition(ctx *Context, req *protocol.CompactPartitionRequest) *protocol.CompactPartitionResponse {
+	sp := span(ctx, b.tracer, "compact partition")
+	defer sp.Finish()
+	res := &protocol.CompactPartitionResponse{APIVersion: req.Version()}
+	reclaimed, err := b.compactPartition(req.Topic, req.Partition)
+	if err != protocol.ErrNone {
+		res.ErrorCode = err.Code()
+		msg := err.Error()
+		res.ErrorMessage = &msg
+		return res
+	}
+	res.ReclaimedBytes = reclaimed
+	return res
+}
+
+func (b *Broker) compactPartition(topic string, partition int32) (int64, protocol.Error) {
+	_, t, err := b.fsm.State().GetTopic(topic)
+	if err != nil || t == nil {
+		return 0, protocol.ErrUnknownTopicOrPartition
+	}
+	if policy := t.Config.GetString("cleanup.policy"); !strings.Contains(policy, commitlog.CompactCleanupPolicy) {
+		return 0, protocol.ErrInvalidRequest.WithErr(fmt.Errorf("topic %s isn't compacted, its cleanup policy is %s", topic, policy))
+	}
+	replica, err := b.replicaLookup.Replica(topic, partition)
+	if err != nil || replica == nil || !replica.IsLocal {
+		return 0, protocol.ErrReplicaNotAvailable
+	}
+	if err := b.wakeReplica(replica); err != protocol.ErrNone {
+		return 0, err
+	}
+	defer replica.unpin()
+	replica.Lock()
+	l, ok := replica.Log.(compactionLog)
+	replica.Unlock()
+	if !ok {
+		return 0, protocol.ErrReplicaNotAvailable
+	}
+	reclaimed, err := l.Compact()
+	if err != nil {
+		log.Error.Printf("broker/%d: compact partition error: topic: %s, partition: %d: %s", b.config.ID, topic, partition, err)
+		return 0, protocol.ErrUnknown.WithErr(err)
+	}
+	log.Info.Printf("broker/%d: compacted partition: topic: %s, partition: %d, reclaimed bytes: %d", b.config.ID, topic, partition, reclaimed)
+	return reclaimed, protocol.ErrNone
+}
+
+// cleanRate returns the bytes per second the compaction cleaned.
+func cleanRate(s commitlog.CleanerStats) float64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+	return float64(s.CleanedBytes) / (float64(s.Duration) / float64(time.Second))
+}
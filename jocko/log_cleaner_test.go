@@ -0,0 +1,91 @@
+package jocko
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestBroker_CompactPartition(t *testing.T) {
+	s, dir := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+
+	conn, err := Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	compact := "compact"
+	for _, topic := range []string{"compacted", "deleted"} {
+		var configs map[string]*string
+		if topic == "compacted" {
+			configs = map[string]*string{"cleanup.policy": &compact}
+		}
+		CreateTopicWithConfigs(t, conn, topic, 1, 1, configs)
+		WaitForTopicLeader(t, topic, 0, s)
+	}
+
+	// the first two sets fill the first segment and are superseded by the last two, which the
+	// split into the active segment doesn't see.
+	for _, key := range []string{"a", "b", "a", "b"} {
+		set, err := protocol.Encode(&protocol.MessageSet{Messages: []*protocol.Message{{Key: []byte(key), Value: bytes.Repeat([]byte("v"), 600)}}})
+		require.NoError(t, err)
+		res, err := conn.Produce(&protocol.ProduceRequest{
+			APIVersion: 2,
+			Timeout:    time.Second,
+			TopicData:  []*protocol.TopicData{{Topic: "compacted", Data: []*protocol.Data{{Partition: 0, RecordSet: set}}}},
+		})
+		require.NoError(t, err)
+		require.Equal(t, protocol.ErrNone.Code(), res.Responses[0].PartitionResponses[0].ErrorCode)
+	}
+
+	res, err := conn.CompactPartition(&protocol.CompactPartitionRequest{Topic: "compacted", Partition: 0})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrNone.Code(), res.ErrorCode)
+	require.True(t, res.ReclaimedBytes > 1200)
+
+	res, err = conn.CompactPartition(&protocol.CompactPartitionRequest{Topic: "deleted", Partition: 0})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrInvalidRequest.Code(), res.ErrorCode)
+	require.Contains(t, *res.ErrorMessage, "isn't compacted")
+	res, err = conn.CompactPartition(&protocol.CompactPartitionRequest{Topic: "compacted", Partition: 1})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrReplicaNotAvailable.Code(), res.ErrorCode)
+
+	labels := []string{"topic", "partition"}
+	lastClean := stdprometheus.NewGaugeVec(stdprometheus.GaugeOpts{Name: "log_cleaner_last_clean_timestamp_seconds"}, labels)
+	dirty := stdprometheus.NewGaugeVec(stdprometheus.GaugeOpts{Name: "log_cleaner_max_dirty_ratio"}, nil)
+	m := &Metrics{
+		LogSize:                  prometheus.NewGauge(stdprometheus.NewGaugeVec(stdprometheus.GaugeOpts{Name: "log_size"}, labels)),
+		LogStartOffset:           prometheus.NewGauge(stdprometheus.NewGaugeVec(stdprometheus.GaugeOpts{Name: "log_start_offset"}, labels)),
+		LogEndOffset:             prometheus.NewGauge(stdprometheus.NewGaugeVec(stdprometheus.GaugeOpts{Name: "log_end_offset"}, labels)),
+		StuckReplicas:            prometheus.NewGauge(stdprometheus.NewGaugeVec(stdprometheus.GaugeOpts{Name: "stuck_replicas"}, labels)),
+		CleanerBufferUtilization: prometheus.NewGauge(stdprometheus.NewGaugeVec(stdprometheus.GaugeOpts{Name: "log_cleaner_buffer_utilization"}, nil)),
+		CleanerMaxDirtyRatio:     prometheus.NewGauge(dirty),
+		CleanerBytesRate:         prometheus.NewGauge(stdprometheus.NewGaugeVec(stdprometheus.GaugeOpts{Name: "log_cleaner_cleaned_bytes_per_second"}, labels)),
+		CleanerLastClean:         prometheus.NewGauge(lastClean),
+	}
+	s.broker().updateLogMetrics(m)
+	value := func(g stdprometheus.Gauge) float64 {
+		var out dto.Metric
+		require.NoError(t, g.Write(&out))
+		return out.Gauge.GetValue()
+	}
+	require.Equal(t, float64(1), value(dirty.WithLabelValues()))
+	require.True(t, value(lastClean.WithLabelValues("compacted", "")) > 0)
+	require.Equal(t, float64(0), value(lastClean.WithLabelValues("deleted", "")))
+}
@@ -0,0 +1,259 @@
+package jocko
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/raft"
+	"github.com/hashicorp/serf/serf"
+	"github.com/travisjeffery/jocko/jocko/metadata"
+	"github.com/travisjeffery/jocko/jocko/structs"
+	"github.com/travisjeffery/jocko/log"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+// lostReplicaMove is a partition's reassignment off a lost broker.
+type lostReplicaMove struct {
+	Partition structs.Partition
+	// To is the broker assigned the lost replica, -1 if no broker could take it and the
+	// partition's left with fewer replicas.
+	To int32
+	// Unclean is whether the partition's new leader wasn't in sync.
+	Unclean bool
+}
+
+// handleReassignLostBroker reassigns the replicas of a broker that will never return to the other
+// brokers. Like topic creation it must be sent to the controller.
+func (b *Broker) handleReassignLostBroker(ctx *Context, req *protocol.ReassignLostBrokerRequest) *protocol.ReassignLostBrokerResponse {
+	sp := span(ctx, b.tracer, "reassign lost broker")
+	defer sp.Finish()
+	res := &protocol.ReassignLostBrokerResponse{}
+	res.APIVersion = req.Version()
+
+	if !b.isController() {
+		res.ErrorCode = protocol.ErrNotController.Code()
+		return res
+	}
+	if !req.AcceptDataLoss && !req.ValidateOnly {
+		setReassignLostBrokerErr(res, protocol.ErrInvalidRequest.WithErr(fmt.Errorf("reassigning broker %d's replicas loses the records only it had, data loss must be accepted", req.BrokerID)))
+		return res
+	}
+	moves, err := b.planLostBroker(req.BrokerID)
+	if err != protocol.ErrNone {
+		setReassignLostBrokerErr(res, err)
+		return res
+	}
+	for _, m := range moves {
+		res.Partitions = append(res.Partitions, &protocol.LostBrokerPartition{
+			Topic:     m.Partition.Topic,
+			Partition: m.Partition.ID,
+			Leader:    m.Partition.Leader,
+			Replicas:  m.Partition.AR,
+			Unclean:   m.Unclean,
+		})
+	}
+	if req.ValidateOnly {
+		return res
+	}
+	if err := b.reassignLostBroker(req.BrokerID, moves); err != nil {
+		setReassignLostBrokerErr(res, protocol.ErrUnknown.WithErr(err))
+	}
+	return res
+}
+
+func setReassignLostBrokerErr(res *protocol.ReassignLostBrokerResponse, err protocol.Error) {
+	res.ErrorCode = err.Code()
+	msg := err.Error()
+	res.ErrorMessage = &msg
+}
+
+// planLostBroker returns the reassignment of the lost broker's replicas. It refuses to plan one
+// for a broker that's alive.
+func (b *Broker) planLostBroker(lost int32) ([]lostReplicaMove, protocol.Error) {
+	for _, m := range b.LANMembers() {
+		if meta, ok := metadata.IsBroker(m); ok && meta.ID.Int32() == lost && m.Status == serf.StatusAlive {
+			return nil, protocol.ErrInvalidRequest.WithErr(fmt.Errorf("broker %d is alive, only lost brokers' replicas can be reassigned", lost))
+		}
+	}
+	state := b.fsm.State()
+	_, node, err := state.GetNode(lost)
+	if err != nil {
+		return nil, protocol.ErrUnknown.WithErr(err)
+	}
+	if node != nil && node.Check != nil && node.Check.Status == structs.HealthPassing {
+		return nil, protocol.ErrInvalidRequest.WithErr(fmt.Errorf("broker %d is passing, only lost brokers' replicas can be reassigned", lost))
+	}
+	_, nodes, err := state.GetNodes()
+	if err != nil {
+		return nil, protocol.ErrUnknown.WithErr(err)
+	}
+	var brokers []int32
+	for _, n := range nodes {
+		if n.Node != lost && canLead(n) {
+			brokers = append(brokers, n.Node)
+		}
+	}
+	_, partitions, err := state.GetPartitions()
+	if err != nil {
+		return nil, protocol.ErrUnknown.WithErr(err)
+	}
+	// brokers not matching a topic's placement constraints aren't assigned its replicas.
+	constraints := make(map[string]map[string]string)
+	for _, p := range partitions {
+		if _, ok := constraints[p.Topic]; ok || !contains(p.AR, lost) {
+			continue
+		}
+		_, topic, err := state.GetTopic(p.Topic)
+		if err != nil {
+			return nil, protocol.ErrUnknown.WithErr(err)
+		}
+		var c map[string]string
+		if topic != nil {
+			c, _ = parsePlacementConstraints(topic.Config.GetString(placementConstraintsConfig))
+		}
+		constraints[p.Topic] = c
+	}
+	allowed := func(topic string, id int32) bool {
+		c := constraints[topic]
+		if len(c) == 0 {
+			return true
+		}
+		broker := b.brokerLookup.BrokerByID(raft.ServerID(fmt.Sprintf("%d", id)))
+		return broker != nil && matchesConstraints(broker, c)
+	}
+	return planLostBroker(partitions, lost, brokers, allowed), protocol.ErrNone
+}
+
+// planLostBroker returns the moves reassigning the lost broker's replicas to the brokers, each to
+// the broker with the fewest replicas allowed to take it. The lost replicas are dropped from the
+// partitions' ISRs, and partitions the lost broker led are led by their first other in-sync
+// replica that's one of the brokers or, failing that, uncleanly by another of their replicas.
+func planLostBroker(partitions []*structs.Partition, lost int32, brokers []int32, allowed func(topic string, id int32) bool) []lostReplicaMove {
+	live := make(map[int32]bool, len(brokers))
+	load := make(map[int32]int, len(brokers))
+	for _, id := range brokers {
+		live[id] = true
+		load[id] = 0
+	}
+	var affected []structs.Partition
+	for _, p := range partitions {
+		for _, r := range p.AR {
+			if _, ok := load[r]; ok {
+				load[r]++
+			}
+		}
+		if contains(p.AR, lost) {
+			affected = append(affected, *p)
+		}
+	}
+	sort.Slice(affected, func(i, j int) bool {
+		if affected[i].Topic != affected[j].Topic {
+			return affected[i].Topic < affected[j].Topic
+		}
+		return affected[i].ID < affected[j].ID
+	})
+
+	ids := append([]int32(nil), brokers...)
+	moves := make([]lostReplicaMove, 0, len(affected))
+	for _, p := range affected {
+		sort.Slice(ids, func(i, j int) bool {
+			if load[ids[i]] != load[ids[j]] {
+				return load[ids[i]] < load[ids[j]]
+			}
+			return ids[i] < ids[j]
+		})
+		m := lostReplicaMove{To: -1}
+		for _, id := range ids {
+			if !contains(p.AR, id) && allowed(p.Topic, id) {
+				m.To = id
+				load[id]++
+				break
+			}
+		}
+		if m.To != -1 {
+			p.AR = replaceReplica(p.AR, lost, m.To)
+		} else {
+			p.AR = removeReplica(p.AR, lost)
+		}
+		p.ISR = removeReplica(p.ISR, lost)
+		if p.Leader == lost {
+			p.Leader = -1
+			for _, r := range p.ISR {
+				if live[r] {
+					p.Leader = r
+					break
+				}
+			}
+			if p.Leader == -1 {
+				// no in-sync replica's left, the records only the lost broker had are gone.
+				m.Unclean = true
+				for _, r := range p.AR {
+					if live[r] && r != m.To {
+						p.Leader = r
+						break
+					}
+				}
+				if p.Leader == -1 && m.To != -1 {
+					p.Leader = m.To
+				}
+			}
+			p.LeaderEpoch++
+			if m.Unclean && p.Leader != -1 {
+				p.ISR = []int32{p.Leader}
+			}
+		}
+		m.Partition = p
+		moves = append(moves, m)
+	}
+	return moves
+}
+
+// reassignLostBroker makes the moves, telling the partitions' replicas of their new assignment.
+func (b *Broker) reassignLostBroker(lost int32, moves []lostReplicaMove) error {
+	state := b.fsm.State()
+	req := &protocol.LeaderAndISRRequest{
+		ControllerID:    b.config.ID,
+		PartitionStates: make([]*protocol.PartitionState, 0, len(moves)),
+	}
+	targets := make(map[int32]struct{})
+	for _, m := range moves {
+		p := m.Partition
+		log.Info.Printf("leader/%d: reassign lost broker: topic: %s, partition: %d, from: %d, to: %d, leader: %d, unclean: %t", b.config.ID, p.Topic, p.ID, lost, m.To, p.Leader, m.Unclean)
+		_, topic, err := state.GetTopic(p.Topic)
+		if err != nil {
+			return err
+		}
+		if topic == nil {
+			continue
+		}
+		if _, err = b.raftApply(structs.RegisterPartitionRequestType, structs.RegisterPartitionRequest{Partition: p}); err != nil {
+			return err
+		}
+		t := *topic
+		t.Partitions = make(map[int32][]int32, len(topic.Partitions))
+		for id, ar := range topic.Partitions {
+			t.Partitions[id] = ar
+		}
+		t.Partitions[p.ID] = p.AR
+		if _, err = b.raftApply(structs.RegisterTopicRequestType, structs.RegisterTopicRequest{Topic: t}); err != nil {
+			return err
+		}
+		req.PartitionStates = append(req.PartitionStates, &protocol.PartitionState{
+			Topic:       p.Topic,
+			Partition:   p.ID,
+			LeaderEpoch: p.LeaderEpoch,
+			Leader:      p.Leader,
+			ISR:         p.ISR,
+			Replicas:    p.AR,
+		})
+		for _, r := range p.AR {
+			targets[r] = struct{}{}
+		}
+	}
+	for id := range targets {
+		if err := b.sendLeaderAndISR(id, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
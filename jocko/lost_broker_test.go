@@ -0,0 +1,86 @@
+package jocko
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/jocko/structs"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestPlanLostBroker(t *testing.T) {
+	partitions := []*structs.Partition{
+		// the lost broker follows, its replica moves to the least loaded broker.
+		{Topic: "a", ID: 0, Leader: 1, AR: []int32{1, 3}, ISR: []int32{1, 3}},
+		// the lost broker leads, an in-sync replica takes over.
+		{Topic: "a", ID: 1, Leader: 3, AR: []int32{3, 1}, ISR: []int32{3, 1}, LeaderEpoch: 2},
+		// the lost broker leads and is the only in-sync replica, the leader's unclean.
+		{Topic: "b", ID: 0, Leader: 3, AR: []int32{3, 2}, ISR: []int32{3}},
+		// the lost broker isn't a replica.
+		{Topic: "b", ID: 1, Leader: 1, AR: []int32{1, 2}, ISR: []int32{1, 2}},
+		// no broker's allowed the replica, the partition's left with fewer.
+		{Topic: "c", ID: 0, Leader: 1, AR: []int32{1, 3}, ISR: []int32{1, 3}},
+	}
+	allowed := func(topic string, id int32) bool { return topic != "c" }
+	moves := planLostBroker(partitions, 3, []int32{1, 2}, allowed)
+	require.Len(t, moves, 4)
+
+	require.Equal(t, int32(2), moves[0].To)
+	require.Equal(t, []int32{1, 2}, moves[0].Partition.AR)
+	require.Equal(t, []int32{1}, moves[0].Partition.ISR)
+	require.Equal(t, int32(1), moves[0].Partition.Leader)
+	require.False(t, moves[0].Unclean)
+
+	require.Equal(t, int32(2), moves[1].To)
+	require.Equal(t, []int32{2, 1}, moves[1].Partition.AR)
+	require.Equal(t, int32(1), moves[1].Partition.Leader)
+	require.Equal(t, int32(3), moves[1].Partition.LeaderEpoch)
+	require.False(t, moves[1].Unclean)
+
+	require.Equal(t, int32(1), moves[2].To)
+	require.Equal(t, []int32{1, 2}, moves[2].Partition.AR)
+	require.Equal(t, int32(2), moves[2].Partition.Leader)
+	require.Equal(t, []int32{2}, moves[2].Partition.ISR)
+	require.True(t, moves[2].Unclean)
+
+	require.Equal(t, int32(-1), moves[3].To)
+	require.Equal(t, []int32{1}, moves[3].Partition.AR)
+	require.Equal(t, []int32{1}, moves[3].Partition.ISR)
+
+	// the state's partitions aren't modified.
+	require.Equal(t, []int32{1, 3}, partitions[0].AR)
+}
+
+func TestBroker_ReassignLostBroker(t *testing.T) {
+	s, dir := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+
+	conn, err := Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	res, err := conn.ReassignLostBroker(&protocol.ReassignLostBrokerRequest{BrokerID: s.config.ID, ValidateOnly: true})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrInvalidRequest.Code(), res.ErrorCode)
+	require.Contains(t, *res.ErrorMessage, "is alive")
+
+	res, err = conn.ReassignLostBroker(&protocol.ReassignLostBrokerRequest{BrokerID: 100})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrInvalidRequest.Code(), res.ErrorCode)
+	require.Contains(t, *res.ErrorMessage, "data loss must be accepted")
+
+	res, err = conn.ReassignLostBroker(&protocol.ReassignLostBrokerRequest{BrokerID: 100, AcceptDataLoss: true})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrNone.Code(), res.ErrorCode)
+	require.Empty(t, res.Partitions)
+}
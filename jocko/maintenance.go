@@ -0,0 +1,179 @@
+package jocko
+
+import (
+	"fmt"
+
+	"github.com/travisjeffery/jocko/jocko/structs"
+	"github.com/travisjeffery/jocko/log"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+// handleBrokerMaintenance puts the broker into or takes it out of maintenance. Like topic
+// creation it must be sent to the controller, which clients find with a metadata request.
+func (b *Broker) handleBrokerMaintenance(ctx *Context, req *protocol.BrokerMaintenanceRequest) *protocol.BrokerMaintenanceResponse {
+	sp := span(ctx, b.tracer, "broker maintenance")
+	defer sp.Finish()
+	res := &protocol.BrokerMaintenanceResponse{}
+	res.APIVersion = req.Version()
+
+	if !b.isController() {
+		res.ErrorCode = protocol.ErrNotController.Code()
+		return res
+	}
+	if ids := unsupportedBrokers(b.LANMembers(), FeatureNodeMaintenance, 1); len(ids) != 0 {
+		setMaintenanceErr(res, protocol.ErrUnsupportedVersion.WithErr(fmt.Errorf("brokers %v don't support maintenance yet, upgrade them first", ids)))
+		return res
+	}
+
+	leaders, err := b.setBrokerMaintenance(req.BrokerID, req.Enabled)
+	if err != protocol.ErrNone {
+		setMaintenanceErr(res, err)
+		return res
+	}
+	res.Leaders = int32(leaders)
+	return res
+}
+
+func setMaintenanceErr(res *protocol.BrokerMaintenanceResponse, err protocol.Error) {
+	res.ErrorCode = err.Code()
+	msg := err.Error()
+	res.ErrorMessage = &msg
+}
+
+// setBrokerMaintenance marks the broker's node in or out of maintenance and, going into it, hands
+// its leaderships off. It returns the number of partitions the broker still leads.
+func (b *Broker) setBrokerMaintenance(id int32, enabled bool) (int, protocol.Error) {
+	state := b.fsm.State()
+	_, node, err := state.GetNode(id)
+	if err != nil {
+		return 0, protocol.ErrUnknown.WithErr(err)
+	}
+	if node == nil {
+		return 0, protocol.ErrBrokerNotAvailable.WithErr(fmt.Errorf("unknown broker %d", id))
+	}
+	if node.InMaintenance() != enabled {
+		log.Info.Printf("leader/%d: broker maintenance: broker: %d, enabled: %t", b.config.ID, id, enabled)
+		if _, err := b.raftApply(structs.NodeMaintenanceRequestType, structs.NodeMaintenanceRequest{Node: id, Enabled: enabled}); err != nil {
+			return 0, protocol.ErrUnknown.WithErr(err)
+		}
+	}
+	if !enabled {
+		return 0, protocol.ErrNone
+	}
+	leaders, err := b.shedLeaderships(id)
+	if err != nil {
+		return leaders, protocol.ErrUnknown.WithErr(err)
+	}
+	return leaders, protocol.ErrNone
+}
+
+// shedMaintenanceLeaderships is run by the controller each reconcile interval to hand off the
+// leaderships brokers in maintenance couldn't shed earlier, e.g. for lack of an in-sync replica.
+func (b *Broker) shedMaintenanceLeaderships() error {
+	_, nodes, err := b.fsm.State().GetNodes()
+	if err != nil {
+		return err
+	}
+	for _, n := range nodes {
+		if !n.InMaintenance() {
+			continue
+		}
+		if _, err := b.shedLeaderships(n.Node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shedLeaderships moves the leaderships of the broker's partitions to the first of their other
+// in-sync replicas able to lead. It returns the number of partitions left without one, which the
+// broker keeps leading.
+func (b *Broker) shedLeaderships(id int32) (int, error) {
+	state := b.fsm.State()
+	_, partitions, err := state.PartitionsByLeader(id)
+	if err != nil {
+		return 0, err
+	}
+	if len(partitions) == 0 {
+		return 0, nil
+	}
+	_, nodes, err := state.GetNodes()
+	if err != nil {
+		return 0, err
+	}
+	leaders := make(map[int32]bool)
+	for _, n := range nodes {
+		if n.Node != id && canLead(n) {
+			leaders[n.Node] = true
+		}
+	}
+
+	req := &protocol.LeaderAndISRRequest{
+		ControllerID:    b.config.ID,
+		PartitionStates: make([]*protocol.PartitionState, 0, len(partitions)),
+	}
+	targets := make(map[int32]struct{})
+	var stuck int
+	for _, p := range partitions {
+		leader := int32(-1)
+		for _, r := range p.ISR {
+			if leaders[r] {
+				leader = r
+				break
+			}
+		}
+		if leader == -1 {
+			stuck++
+			continue
+		}
+		log.Info.Printf("leader/%d: shedding leadership: topic: %s, partition: %d, from: %d, to: %d", b.config.ID, p.Topic, p.Partition, id, leader)
+		np := *p
+		np.Leader = leader
+		np.LeaderEpoch = p.LeaderEpoch + 1
+		if _, err = b.raftApply(structs.RegisterPartitionRequestType, structs.RegisterPartitionRequest{Partition: np}); err != nil {
+			return stuck, err
+		}
+		req.PartitionStates = append(req.PartitionStates, &protocol.PartitionState{
+			Topic:       np.Topic,
+			Partition:   np.Partition,
+			LeaderEpoch: np.LeaderEpoch,
+			Leader:      np.Leader,
+			ISR:         np.ISR,
+			Replicas:    np.AR,
+		})
+		for _, r := range np.AR {
+			targets[r] = struct{}{}
+		}
+	}
+	if stuck > 0 {
+		log.Error.Printf("leader/%d: broker %d in maintenance still leads %d partitions without another in-sync replica to lead them", b.config.ID, id, stuck)
+	}
+
+	for r := range targets {
+		if err := b.sendLeaderAndISR(r, req); err != nil {
+			return stuck, err
+		}
+	}
+	return stuck, nil
+}
+
+// canLead returns whether the node can be made a partition's leader.
+func canLead(n *structs.Node) bool {
+	return n.Check != nil && n.Check.Status == structs.HealthPassing && !isObserver(n) && !n.InMaintenance()
+}
+
+// maintenanceBrokers returns the IDs of the brokers in maintenance.
+func (b *Broker) maintenanceBrokers() map[int32]bool {
+	_, nodes, err := b.fsm.State().GetNodes()
+	if err != nil {
+		log.Error.Printf("broker/%d: get nodes error: %s", b.config.ID, err)
+		return nil
+	}
+	ids := make(map[int32]bool)
+	for _, n := range nodes {
+		if n.InMaintenance() {
+			ids[n.Node] = true
+		}
+	}
+	return ids
+}
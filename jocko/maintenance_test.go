@@ -0,0 +1,140 @@
+package jocko
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/testutil/retry"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/jocko/fsm"
+	"github.com/travisjeffery/jocko/jocko/metadata"
+	"github.com/travisjeffery/jocko/jocko/structs"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func newTestFSM(t *testing.T) *fsm.FSM {
+	f, err := fsm.New(opentracing.GlobalTracer())
+	require.NoError(t, err)
+	return f
+}
+
+func TestBuildPartitionsSkipsMaintenance(t *testing.T) {
+	b := &Broker{brokerLookup: NewBrokerLookup(), fsm: newTestFSM(t)}
+	for _, id := range []int32{1, 2, 3} {
+		b.brokerLookup.AddBroker(&metadata.Broker{ID: metadata.NodeID(id), RaftAddr: fmt.Sprintf("127.0.0.1:%d", 9093+100*id)})
+		require.NoError(t, b.fsm.State().EnsureNode(uint64(id), &structs.Node{Node: id}))
+	}
+	require.NoError(t, b.fsm.State().SetNodeMaintenance(4, 3, true))
+
+	ps, err := b.buildPartitions("test-topic", 10, 2, nil)
+	require.Equal(t, protocol.ErrNone, err)
+	for _, p := range ps {
+		require.NotContains(t, p.AR, int32(3))
+	}
+
+	_, err = b.buildPartitions("test-topic", 1, 3, nil)
+	require.Equal(t, protocol.ErrInvalidReplicationFactor, err)
+}
+
+func TestBroker_Maintenance(t *testing.T) {
+	s1, dir1 := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+	}, nil)
+	defer os.RemoveAll(dir1)
+	require.NoError(t, s1.Start(context.Background()))
+	defer s1.Shutdown()
+
+	s2, dir2 := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = false
+		cfg.NonVoter = true
+	}, nil)
+	defer os.RemoveAll(dir2)
+	require.NoError(t, s2.Start(context.Background()))
+	defer s2.Shutdown()
+
+	TestJoin(t, s2, s1)
+	b1, b2 := s1.broker(), s2.broker()
+	state := b1.fsm.State()
+	retry.Run(t, func(r *retry.R) {
+		_, node, err := state.GetNode(b2.config.ID)
+		if err != nil {
+			r.Fatal(err)
+		}
+		if node == nil {
+			r.Fatal("node not registered")
+		}
+	})
+
+	conn, err := Dial("tcp", s1.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	CreateTopic(t, conn, "maintenance-topic", 8, 2)
+
+	// only the controller handles maintenance requests, found from any broker's metadata.
+	conn2, err := Dial("tcp", s2.Addr().String())
+	require.NoError(t, err)
+	defer conn2.Close()
+	retry.Run(t, func(r *retry.R) {
+		meta, err := conn2.Metadata(&protocol.MetadataRequest{APIVersion: 1})
+		if err != nil {
+			r.Fatal(err)
+		}
+		if meta.ControllerID != b1.config.ID {
+			r.Fatalf("controller id: %d", meta.ControllerID)
+		}
+	})
+	mres, err := conn2.BrokerMaintenance(&protocol.BrokerMaintenanceRequest{BrokerID: b2.config.ID, Enabled: true})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrNotController.Code(), mres.ErrorCode)
+
+	mres, err = conn.BrokerMaintenance(&protocol.BrokerMaintenanceRequest{BrokerID: b2.config.ID, Enabled: true})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrNone.Code(), mres.ErrorCode)
+	require.Equal(t, int32(0), mres.Leaders)
+
+	_, node, err := state.GetNode(b2.config.ID)
+	require.NoError(t, err)
+	require.True(t, node.InMaintenance())
+	_, partitions, err := state.GetPartitions()
+	require.NoError(t, err)
+	for _, p := range partitions {
+		if p.Topic != "maintenance-topic" {
+			continue
+		}
+		// the broker in maintenance keeps its replicas.
+		require.Equal(t, b1.config.ID, p.Leader)
+		require.Len(t, p.AR, 2)
+	}
+
+	// new topics aren't assigned to the broker in maintenance.
+	res, err := conn.CreateTopics(&protocol.CreateTopicRequests{
+		Timeout: time.Second,
+		Requests: []*protocol.CreateTopicRequest{{
+			Topic:             "new-topic",
+			NumPartitions:     1,
+			ReplicationFactor: 2,
+		}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrInvalidReplicationFactor.Code(), res.TopicErrorCodes[0].ErrorCode)
+
+	mres, err = conn.BrokerMaintenance(&protocol.BrokerMaintenanceRequest{BrokerID: b2.config.ID, Enabled: false})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrNone.Code(), mres.ErrorCode)
+	_, node, err = state.GetNode(b2.config.ID)
+	require.NoError(t, err)
+	require.False(t, node.InMaintenance())
+
+	mres, err = conn.BrokerMaintenance(&protocol.BrokerMaintenanceRequest{BrokerID: 1 << 20, Enabled: true})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrBrokerNotAvailable.Code(), mres.ErrorCode)
+}
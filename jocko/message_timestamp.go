@@ -0,0 +1,45 @@
+package jocko
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/travisjeffery/jocko/jocko/structs"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+const (
+	timestampTypeConfig          = "message.timestamp.type"
+	timestampDifferenceMaxConfig = "message.timestamp.difference.max.ms"
+	logAppendTimestampType       = "LogAppendTime"
+)
+
+// logAppendTime returns whether the topic's records are timestamped by the broker when they're
+// appended rather than by their producers.
+func logAppendTime(t *structs.Topic) bool {
+	return t.Config.GetString(timestampTypeConfig) == logAppendTimestampType
+}
+
+// checkTimestamps checks the produced records' create times are within the topic's max timestamp
+// difference of now. The broker overwrites a log append time topic's timestamps so they aren't
+// checked.
+func checkTimestamps(t *structs.Topic, recordSet []byte, now time.Time) protocol.Error {
+	if logAppendTime(t) {
+		return protocol.ErrNone
+	}
+	max, ok := t.Config.GetInt(timestampDifferenceMaxConfig)
+	if !ok || max < 0 || max >= int64(time.Duration(1<<63-1)/time.Millisecond) {
+		return protocol.ErrNone
+	}
+	timestamps, err := protocol.Timestamps(recordSet)
+	if err != nil {
+		return protocol.ErrCorruptMessage.WithErr(err)
+	}
+	diff := time.Duration(max) * time.Millisecond
+	for _, ts := range timestamps {
+		if d := now.Sub(ts); d > diff || d < -diff {
+			return protocol.ErrInvalidTimestamp.WithErr(fmt.Errorf("timestamp %d of topic %s is out of range, its max difference from the broker's time is %dms", ts.UnixNano()/int64(time.Millisecond), t.Topic, max))
+		}
+	}
+	return protocol.ErrNone
+}
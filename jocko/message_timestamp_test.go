@@ -0,0 +1,75 @@
+package jocko
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestBroker_MessageTimestamps(t *testing.T) {
+	s, dir := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+
+	conn, err := Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	hour, appendTime := "3600000", logAppendTimestampType
+	configs := map[string]map[string]*string{
+		"created":  {timestampDifferenceMaxConfig: &hour},
+		"appended": {timestampTypeConfig: &appendTime},
+	}
+	for topic, cfg := range configs {
+		CreateTopicWithConfigs(t, conn, topic, 1, 1, cfg)
+		WaitForTopicLeader(t, topic, 0, s)
+	}
+
+	produce := func(topic string, ts time.Time) *protocol.ProducePartitionResponse {
+		set, err := protocol.Encode(&protocol.MessageSet{Messages: []*protocol.Message{{MagicByte: 1, Timestamp: ts, Value: []byte("v")}}})
+		require.NoError(t, err)
+		res, err := conn.Produce(&protocol.ProduceRequest{
+			APIVersion: 2,
+			Timeout:    time.Second,
+			TopicData:  []*protocol.TopicData{{Topic: topic, Data: []*protocol.Data{{Partition: 0, RecordSet: set}}}},
+		})
+		require.NoError(t, err)
+		return res.Responses[0].PartitionResponses[0]
+	}
+	stale := time.Now().Add(-2 * time.Hour)
+
+	pres := produce("created", stale)
+	require.Equal(t, protocol.ErrInvalidTimestamp.Code(), pres.ErrorCode)
+	pres = produce("created", time.Now())
+	require.Equal(t, protocol.ErrNone.Code(), pres.ErrorCode)
+	require.True(t, pres.LogAppendTime.IsZero())
+
+	pres = produce("appended", stale)
+	require.Equal(t, protocol.ErrNone.Code(), pres.ErrorCode)
+	require.False(t, pres.LogAppendTime.IsZero())
+
+	res, err := conn.Fetch(&protocol.FetchRequest{
+		APIVersion:  5,
+		MaxWaitTime: time.Second,
+		MinBytes:    1,
+		Topics: []*protocol.FetchTopic{{
+			Topic:      "appended",
+			Partitions: []*protocol.FetchPartition{{Partition: 0, FetchOffset: 0, MaxBytes: 1 << 20}},
+		}},
+	})
+	require.NoError(t, err)
+	ms := new(protocol.MessageSet)
+	require.NoError(t, ms.Decode(protocol.NewDecoder(res.Responses[0].PartitionResponses[0].RecordSet)))
+	require.True(t, ms.Messages[0].LogAppendTime())
+	require.True(t, pres.LogAppendTime.Equal(ms.Messages[0].Timestamp))
+}
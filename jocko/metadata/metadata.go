@@ -3,7 +3,9 @@ package metadata
 import (
 	"fmt"
 	"net"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/hashicorp/serf/serf"
 )
@@ -24,12 +26,41 @@ type Broker struct {
 	Bootstrap   bool
 	Expect      int
 	NonVoter    bool
+	Observer    bool
 	Status      serf.MemberStatus
 	RaftAddr    string
 	SerfLANAddr string
 	BrokerAddr  string
+	// InterBrokerAddr, if set, is the listener the other brokers send their requests to.
+	InterBrokerAddr string
+	// Tags are the broker's labels, e.g. disk=ssd, that topics' placement constraints match.
+	Tags map[string]string
+	// LogBytes is the size of the broker's replicas' logs and DiskFreeBytes the free space on its
+	// data dir's disk, both -1 if the broker doesn't report its disk usage.
+	LogBytes      int64
+	DiskFreeBytes int64
+	// Version is the broker's jocko version, empty if it predates reporting it, and Features the
+	// max levels of the features gated on every broker supporting them that it supports.
+	Version  string
+	Features map[string]int16
 }
 
+// TagPrefix prefixes the serf tags holding the broker's labels.
+const TagPrefix = "tag."
+
+// VersionTag and FeaturesTag are the serf tags holding the broker's version and the gated features
+// it supports, comma separated as <feature>:<max level>. A feature without a level is level 1.
+const (
+	VersionTag  = "version"
+	FeaturesTag = "features"
+)
+
+// LogBytesTag and DiskFreeBytesTag are the serf tags the broker reports its disk usage in.
+const (
+	LogBytesTag      = "log_bytes"
+	DiskFreeBytesTag = "disk_free_bytes"
+)
+
 func (b Broker) Host() string {
 	host, _, err := net.SplitHostPort(b.BrokerAddr)
 	if err != nil {
@@ -50,6 +81,29 @@ func (b Broker) Port() int32 {
 	return int32(port)
 }
 
+// PeerAddr returns the address the other brokers send their requests to, its inter-broker
+// listener if it has one.
+func (b Broker) PeerAddr() string {
+	if b.InterBrokerAddr != "" {
+		return b.InterBrokerAddr
+	}
+	return b.BrokerAddr
+}
+
+// DiskUsed returns the share of the space available to the broker's logs that they use, false if
+// the broker doesn't report its disk usage.
+func (b Broker) DiskUsed() (float64, bool) {
+	if b.LogBytes < 0 || b.DiskFreeBytes < 0 || b.LogBytes+b.DiskFreeBytes == 0 {
+		return 0, false
+	}
+	return float64(b.LogBytes) / float64(b.LogBytes+b.DiskFreeBytes), true
+}
+
+// Supports returns whether the broker supports the gated feature at the level.
+func (b Broker) Supports(feature string, level int16) bool {
+	return b.Features[feature] >= level
+}
+
 func (b Broker) String() string {
 	return fmt.Sprintf("broker: %d", b.ID)
 }
@@ -72,6 +126,19 @@ func IsBroker(m serf.Member) (*Broker, bool) {
 
 	_, bootstrap := m.Tags["bootstrap"]
 	_, nonVoter := m.Tags["non_voter"]
+	_, observer := m.Tags["observer"]
+
+	var tags map[string]string
+	for k, v := range m.Tags {
+		if strings.HasPrefix(k, TagPrefix) {
+			if tags == nil {
+				tags = make(map[string]string)
+			}
+			tags[strings.TrimPrefix(k, TagPrefix)] = v
+		}
+	}
+
+	features := FeatureLevels(m.Tags[FeaturesTag])
 
 	idStr := m.Tags["id"]
 	id, err := strconv.Atoi(idStr)
@@ -80,14 +147,63 @@ func IsBroker(m serf.Member) (*Broker, bool) {
 	}
 
 	return &Broker{
-		ID:          NodeID(id),
-		Name:        m.Tags["name"],
-		Bootstrap:   bootstrap,
-		Expect:      expect,
-		NonVoter:    nonVoter,
-		Status:      m.Status,
-		RaftAddr:    m.Tags["raft_addr"],
-		SerfLANAddr: m.Tags["serf_lan_addr"],
-		BrokerAddr:  m.Tags["broker_addr"],
+		ID:              NodeID(id),
+		Name:            m.Tags["name"],
+		Bootstrap:       bootstrap,
+		Expect:          expect,
+		NonVoter:        nonVoter,
+		Observer:        observer,
+		Status:          m.Status,
+		RaftAddr:        m.Tags["raft_addr"],
+		SerfLANAddr:     m.Tags["serf_lan_addr"],
+		BrokerAddr:      m.Tags["broker_addr"],
+		InterBrokerAddr: m.Tags["inter_broker_addr"],
+		Tags:            tags,
+		LogBytes:        byteTag(m.Tags[LogBytesTag]),
+		DiskFreeBytes:   byteTag(m.Tags[DiskFreeBytesTag]),
+		Version:         m.Tags[VersionTag],
+		Features:        features,
 	}, true
 }
+
+// FeatureLevels parses a features tag into the max levels of the features, skipping invalid
+// ones.
+func FeatureLevels(s string) map[string]int16 {
+	if s == "" {
+		return nil
+	}
+	levels := make(map[string]int16)
+	for _, f := range strings.Split(s, ",") {
+		name, level := f, int64(1)
+		if i := strings.LastIndex(f, ":"); i >= 0 {
+			var err error
+			if level, err = strconv.ParseInt(f[i+1:], 10, 16); err != nil || level < 1 {
+				continue
+			}
+			name = f[:i]
+		}
+		if name != "" {
+			levels[name] = int16(level)
+		}
+	}
+	return levels
+}
+
+// FeaturesTagValue formats the max levels of the features as a features tag.
+func FeaturesTagValue(levels map[string]int16) string {
+	features := make([]string, 0, len(levels))
+	for name, level := range levels {
+		features = append(features, name+":"+strconv.Itoa(int(level)))
+	}
+	sort.Strings(features)
+	return strings.Join(features, ",")
+}
+
+// byteTag parses a byte count tag, -1 if it's missing or invalid.
+func byteTag(s string) int64 {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return -1
+	}
+	return n
+}
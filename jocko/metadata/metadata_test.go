@@ -15,6 +15,18 @@ func TestIsBroker(t *testing.T) {
 			name:     "minumum config",
 			function: testMinimum,
 		},
+		{
+			name:     "tags",
+			function: testTags,
+		},
+		{
+			name:     "disk usage",
+			function: testDiskUsage,
+		},
+		{
+			name:     "features",
+			function: testFeatures,
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, test.function)
@@ -30,3 +42,56 @@ func testMinimum(t *testing.T) {
 		t.Fatal("broker id is not 1")
 	}
 }
+
+func testTags(t *testing.T) {
+	b, ok := IsBroker(serf.Member{Tags: map[string]string{"id": "1", "role": "jocko", TagPrefix + "disk": "ssd", "dc": "us-east"}})
+	if !ok {
+		t.Fatal("is broker not ok")
+	}
+	if len(b.Tags) != 1 || b.Tags["disk"] != "ssd" {
+		t.Fatalf("broker tags are %v, not disk=ssd", b.Tags)
+	}
+}
+
+func testDiskUsage(t *testing.T) {
+	b, ok := IsBroker(serf.Member{Tags: map[string]string{"id": "1", "role": "jocko"}})
+	if !ok {
+		t.Fatal("is broker not ok")
+	}
+	if _, ok := b.DiskUsed(); ok {
+		t.Fatal("disk usage of broker not reporting it is ok")
+	}
+	b, ok = IsBroker(serf.Member{Tags: map[string]string{"id": "1", "role": "jocko", LogBytesTag: "30", DiskFreeBytesTag: "90"}})
+	if !ok {
+		t.Fatal("is broker not ok")
+	}
+	if used, ok := b.DiskUsed(); !ok || used != 0.25 {
+		t.Fatalf("disk used is %v, not 0.25", used)
+	}
+}
+
+func testFeatures(t *testing.T) {
+	b, ok := IsBroker(serf.Member{Tags: map[string]string{"id": "1", "role": "jocko"}})
+	if !ok {
+		t.Fatal("is broker not ok")
+	}
+	if b.Supports("node_maintenance", 1) {
+		t.Fatal("broker not reporting features supports node_maintenance")
+	}
+	b, ok = IsBroker(serf.Member{Tags: map[string]string{"id": "1", "role": "jocko", VersionTag: "1.2.0", FeaturesTag: "a,node_maintenance:3,bad:x,neg:-1"}})
+	if !ok {
+		t.Fatal("is broker not ok")
+	}
+	if b.Version != "1.2.0" {
+		t.Fatalf("broker version is %q, not 1.2.0", b.Version)
+	}
+	if !b.Supports("a", 1) || b.Supports("a", 2) || !b.Supports("node_maintenance", 3) || b.Supports("node_maintenance", 4) || b.Supports("b", 1) {
+		t.Fatalf("broker features are %v, not a:1,node_maintenance:3", b.Features)
+	}
+	if len(b.Features) != 2 {
+		t.Fatalf("broker features are %v, invalid ones not skipped", b.Features)
+	}
+	if s := FeaturesTagValue(b.Features); s != "a:1,node_maintenance:3" {
+		t.Fatalf("features tag is %s, not a:1,node_maintenance:3", s)
+	}
+}
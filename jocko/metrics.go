@@ -1,11 +1,172 @@
 package jocko
 
-import "github.com/go-kit/kit/metrics/prometheus"
+import (
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+)
 
 // Alias prometheus' counter, probably only need to use Inc() though.
 type Counter = prometheus.Counter
 
+// MetricsSink creates the broker's metrics in a metrics system, e.g. Prometheus or statsd. The
+// names are snake case without a namespace, and the labels are the label names the metrics are
+// labeled with, the metrics taking alternating label names and values.
+type MetricsSink interface {
+	NewCounter(name, help string, labels []string) metrics.Counter
+	NewGauge(name, help string, labels []string) metrics.Gauge
+	NewHistogram(name, help string, labels []string) metrics.Histogram
+}
+
 // Metrics is used for tracking metrics.
 type Metrics struct {
+	// RequestsHandled counts the requests handled. It's a Prometheus counter so it's only set by
+	// the Prometheus sink, the other sinks count requests handled in requests.
 	RequestsHandled Counter
+	requests        metrics.Counter
+
+	// The topic metrics are labeled with topic and partition. The partition label is empty
+	// unless the broker's config enables per partition metrics, and topics missing from its
+	// metrics topics allowlist are aggregated under the otherTopicsLabel topic.
+
+	// MessagesIn counts the messages appended to the broker's partitions.
+	MessagesIn metrics.Counter
+	// BytesIn counts the bytes produced to the broker's partitions.
+	BytesIn metrics.Counter
+	// BytesOut counts the bytes fetched from the broker's partitions.
+	BytesOut metrics.Counter
+	// LogSize is the bytes stored in the broker's replicas' logs.
+	LogSize metrics.Gauge
+	// LogStartOffset and LogEndOffset are the oldest and next offsets of the broker's replicas'
+	// logs, summed when partitions are aggregated.
+	LogStartOffset metrics.Gauge
+	LogEndOffset   metrics.Gauge
+	// StuckReplicas is the number of the broker's follower replicas that aren't catching up with
+	// their leaders, either backing off repeated fetch failures or stopped on a fatal error.
+	StuckReplicas metrics.Gauge
+	// ReplicaLag is the number of messages the broker's follower replicas are behind their
+	// leaders' high watermarks, summed when partitions are aggregated, and ReplicaLagTime the
+	// seconds since the most lagging of them last caught up.
+	ReplicaLag     metrics.Gauge
+	ReplicaLagTime metrics.Gauge
+	// MaxLag is the most messages any of the broker's follower replicas is behind its leader.
+	MaxLag metrics.Gauge
+	// CleanerBufferUtilization is the largest fraction of the log cleaner's key buffer the broker's
+	// replicas' last compactions filled, and CleanerMaxDirtyRatio the largest fraction of their
+	// compacted bytes that were superseded records.
+	CleanerBufferUtilization metrics.Gauge
+	CleanerMaxDirtyRatio     metrics.Gauge
+	// CleanerBytesRate is the bytes per second the replicas' last compactions cleaned, and
+	// CleanerLastClean the unix time they finished.
+	CleanerBytesRate metrics.Gauge
+	CleanerLastClean metrics.Gauge
+	// RetentionReclaimedBytes counts the bytes deleted from the broker's replicas' logs when
+	// their topics' retention is lowered.
+	RetentionReclaimedBytes metrics.Counter
+	// BufferedBytes is the bytes of unanswered requests and unappended replicated records held
+	// against the broker's queued max request bytes.
+	BufferedBytes metrics.Gauge
+	// HeldFetches is the number of consumer fetches held waiting for records to be appended.
+	HeldFetches metrics.Gauge
+	// ProduceSequenceErrors counts the batches idempotent producers sent out of sequence, labeled
+	// with the type: duplicate, gap, or fenced for a stale producer epoch.
+	ProduceSequenceErrors metrics.Counter
+	// ProduceTimestampSkew is the seconds the produced record sets' create times furthest from
+	// the broker's clock were from it, and ClockSkewedProduces counts the record sets skewed past
+	// the broker's clock skew threshold, labeled with the direction: past or future.
+	ProduceTimestampSkew metrics.Histogram
+	ClockSkewedProduces  metrics.Counter
+	// InjectedTimestamps counts the record sets produced to log append time topics the broker
+	// stamped with their append time.
+	InjectedTimestamps metrics.Counter
+	// OrphanedPartitions is the number of partition dirs in the broker's data dir found orphaned
+	// on its last scan and waiting to be confirmed on the next.
+	OrphanedPartitions metrics.Gauge
+	// OrphanedPartitionsRemoved counts the orphaned partition dirs removed from the broker's data
+	// dir, labeled with the action, quarantine or delete.
+	OrphanedPartitionsRemoved metrics.Counter
+
+	// The client metrics are labeled with client_id and type, produce or fetch. Clients missing
+	// from the broker's metrics client IDs allowlist are aggregated under the otherClientsLabel
+	// client ID.
+
+	// ClientBytes counts the bytes clients produced to and consumed from the broker.
+	ClientBytes metrics.Counter
+	// ClientThrottleTime counts the seconds of throttle time the broker issued clients over
+	// their topics' quotas.
+	ClientThrottleTime metrics.Counter
+	// ClientQuotaViolations counts the responses the broker throttled clients in.
+	ClientQuotaViolations metrics.Counter
+	// DeniedClientRequests counts the requests refused for their client IDs, labeled with
+	// client_id only.
+	DeniedClientRequests metrics.Counter
+
+	// InterBrokerRequestLatency is the seconds requests to other brokers take, labeled with the
+	// broker and api.
+	InterBrokerRequestLatency metrics.Histogram
+}
+
+// NewMetrics creates the metrics in the sink.
+func NewMetrics(sink MetricsSink) *Metrics {
+	labels := []string{"topic", "partition"}
+	clientLabels := []string{"client_id", "type"}
+	requests := sink.NewCounter("requests_handled_total", "Number of requests handled.", nil)
+	m := &Metrics{
+		requests:                  requests,
+		MessagesIn:                sink.NewCounter("messages_in_total", "Number of messages produced.", labels),
+		BytesIn:                   sink.NewCounter("bytes_in_total", "Number of bytes produced.", labels),
+		BytesOut:                  sink.NewCounter("bytes_out_total", "Number of bytes fetched.", labels),
+		LogSize:                   sink.NewGauge("log_size_bytes", "Size of the replicas' logs.", labels),
+		LogStartOffset:            sink.NewGauge("log_start_offset", "Oldest offset in the replicas' logs.", labels),
+		LogEndOffset:              sink.NewGauge("log_end_offset", "Next offset in the replicas' logs.", labels),
+		StuckReplicas:             sink.NewGauge("stuck_replicas", "Number of follower replicas failing to fetch from their leaders.", labels),
+		ReplicaLag:                sink.NewGauge("replica_lag_messages", "Number of messages the follower replicas are behind their leaders.", labels),
+		ReplicaLagTime:            sink.NewGauge("replica_lag_seconds", "Time since the follower replicas last caught up with their leaders.", labels),
+		MaxLag:                    sink.NewGauge("replica_max_lag_messages", "Most messages any follower replica is behind its leader.", nil),
+		CleanerBufferUtilization:  sink.NewGauge("log_cleaner_buffer_utilization", "Largest fraction of the log cleaner's key buffer a compaction filled.", nil),
+		CleanerMaxDirtyRatio:      sink.NewGauge("log_cleaner_max_dirty_ratio", "Largest fraction of a compacted log's bytes its last compaction found superseded.", nil),
+		CleanerBytesRate:          sink.NewGauge("log_cleaner_cleaned_bytes_per_second", "Bytes per second the logs' last compactions cleaned.", labels),
+		CleanerLastClean:          sink.NewGauge("log_cleaner_last_clean_timestamp_seconds", "Unix time the logs were last compacted.", labels),
+		RetentionReclaimedBytes:   sink.NewCounter("retention_reclaimed_bytes_total", "Number of bytes deleted enforcing lowered retention.", labels),
+		BufferedBytes:             sink.NewGauge("buffered_request_bytes", "Number of bytes of unanswered requests and unappended replicated records.", nil),
+		HeldFetches:               sink.NewGauge("held_fetches", "Number of consumer fetches waiting for records.", nil),
+		ProduceSequenceErrors:     sink.NewCounter("produce_sequence_errors_total", "Number of batches idempotent producers sent out of sequence.", append(labels, "type")),
+		ProduceTimestampSkew:      sink.NewHistogram("produce_timestamp_skew_seconds", "Distance of produced records' create times from the broker's clock.", labels),
+		ClockSkewedProduces:       sink.NewCounter("produce_clock_skewed_total", "Number of record sets produced with create times skewed past the clock skew threshold.", append(labels, "direction")),
+		InjectedTimestamps:        sink.NewCounter("produce_injected_timestamps_total", "Number of record sets stamped with their log append time.", labels),
+		OrphanedPartitions:        sink.NewGauge("orphaned_partitions", "Number of orphaned partition dirs waiting to be confirmed.", nil),
+		OrphanedPartitionsRemoved: sink.NewCounter("orphaned_partitions_removed_total", "Number of orphaned partition dirs quarantined or deleted.", []string{"action"}),
+		ClientBytes:               sink.NewCounter("client_bytes_total", "Number of bytes clients produced and fetched.", clientLabels),
+		ClientThrottleTime:        sink.NewCounter("client_throttle_seconds_total", "Throttle time issued to clients over their quotas.", clientLabels),
+		ClientQuotaViolations:     sink.NewCounter("client_quota_violations_total", "Number of responses clients were throttled in.", clientLabels),
+		DeniedClientRequests:      sink.NewCounter("client_requests_denied_total", "Number of requests refused for their client IDs.", []string{"client_id"}),
+		InterBrokerRequestLatency: sink.NewHistogram("inter_broker_request_duration_seconds", "Latency of requests sent to other brokers.", []string{"broker", "api"}),
+	}
+	if c, ok := requests.(*Counter); ok {
+		m.RequestsHandled = *c
+	}
+	return m
+}
+
+// requestHandled counts a handled request.
+func (m *Metrics) requestHandled() {
+	if m.requests != nil {
+		m.requests.Add(1)
+	}
+}
+
+// PrometheusSink creates metrics in the jocko namespace registered with Prometheus' default
+// registry, so metrics should only be created with it once.
+type PrometheusSink struct{}
+
+func (PrometheusSink) NewCounter(name, help string, labels []string) metrics.Counter {
+	return prometheus.NewCounterFrom(stdprometheus.CounterOpts{Namespace: "jocko", Name: name, Help: help}, labels)
+}
+
+func (PrometheusSink) NewGauge(name, help string, labels []string) metrics.Gauge {
+	return prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{Namespace: "jocko", Name: name, Help: help}, labels)
+}
+
+func (PrometheusSink) NewHistogram(name, help string, labels []string) metrics.Histogram {
+	return prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{Namespace: "jocko", Name: name, Help: help}, labels)
 }
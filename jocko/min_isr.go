@@ -0,0 +1,37 @@
+package jocko
+
+import (
+	"fmt"
+
+	"github.com/travisjeffery/jocko/jocko/structs"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+const minInsyncReplicasConfig = "min.insync.replicas"
+
+// minInsyncReplicas returns the fewest in-sync replicas the topic's partitions need to take
+// acks=all produces, the topic's min.insync.replicas if it's set or else the broker's.
+func (b *Broker) minInsyncReplicas(t *structs.Topic) int {
+	if t.Config.Get(minInsyncReplicasConfig).Value != nil {
+		if n, ok := t.Config.GetInt(minInsyncReplicasConfig); ok {
+			return int(n)
+		}
+	}
+	return b.config.MinInsyncReplicas
+}
+
+// checkInsyncReplicas returns the error if the partition has fewer in-sync replicas than the
+// topic's minimum, rather than acknowledging acks=all produces too few replicas hold.
+func (b *Broker) checkInsyncReplicas(t *structs.Topic, partition int32, err protocol.Error) protocol.Error {
+	_, p, perr := b.fsm.State().GetPartition(t.Topic, partition)
+	if perr != nil {
+		return protocol.ErrUnknown.WithErr(perr)
+	}
+	if p == nil {
+		return protocol.ErrUnknownTopicOrPartition
+	}
+	if min := b.minInsyncReplicas(t); len(p.ISR) < min {
+		return err.WithErr(fmt.Errorf("%s/%d has %d in-sync replicas, fewer than its min of %d", t.Topic, partition, len(p.ISR), min))
+	}
+	return protocol.ErrNone
+}
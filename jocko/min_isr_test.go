@@ -0,0 +1,80 @@
+package jocko
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestBroker_MinInsyncReplicas(t *testing.T) {
+	s, dir := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+		cfg.MinInsyncReplicas = 2
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+
+	conn, err := Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	CreateTopic(t, conn, "durable", 1, 1)
+	WaitForTopicLeader(t, "durable", 0, s)
+
+	set, err := protocol.Encode(&protocol.MessageSet{Messages: []*protocol.Message{{Value: []byte("v")}}})
+	require.NoError(t, err)
+	produce := func(acks int16) int16 {
+		res, err := conn.Produce(&protocol.ProduceRequest{
+			APIVersion: 2,
+			Acks:       acks,
+			Timeout:    time.Second,
+			TopicData:  []*protocol.TopicData{{Topic: "durable", Data: []*protocol.Data{{Partition: 0, RecordSet: set}}}},
+		})
+		require.NoError(t, err)
+		return res.Responses[0].PartitionResponses[0].ErrorCode
+	}
+	alter := func(value string) {
+		res, err := conn.AlterConfigs(&protocol.AlterConfigsRequest{
+			Resources: []protocol.AlterConfigsResource{{
+				Type:    protocol.TopicResourceType,
+				Name:    "durable",
+				Entries: []protocol.AlterConfigsEntry{{Name: minInsyncReplicasConfig, Value: &value}},
+			}},
+		})
+		require.NoError(t, err)
+		require.Equal(t, protocol.ErrNone.Code(), res.Resources[0].ErrorCode)
+	}
+
+	// the topic's one replica is fewer than the broker's min.
+	require.Equal(t, protocol.ErrNotEnoughReplicas.Code(), produce(-1))
+	require.Equal(t, protocol.ErrNone.Code(), produce(1))
+	require.Equal(t, protocol.ErrNone.Code(), produce(0))
+
+	res, err := conn.DescribeConfigs(&protocol.DescribeConfigsRequest{
+		APIVersion:      1,
+		Resources:       []protocol.DescribeConfigsResource{{Type: protocol.TopicResourceType, Name: "durable", ConfigNames: []string{minInsyncReplicasConfig}}},
+		IncludeSynonyms: true,
+	})
+	require.NoError(t, err)
+	entry := res.Resources[0].ConfigEntries[0]
+	require.Equal(t, "2", *entry.Value)
+	require.True(t, entry.IsDefault)
+	require.Len(t, entry.Synonyms, 2)
+	require.Equal(t, protocol.StaticBrokerConfigSource, entry.Synonyms[0].Source)
+	require.Equal(t, "2", *entry.Synonyms[0].Value)
+	require.Equal(t, protocol.DefaultConfigSource, entry.Synonyms[1].Source)
+
+	// the topic's min overrides the broker's.
+	alter("1")
+	require.Equal(t, protocol.ErrNone.Code(), produce(-1))
+	alter("3")
+	require.Equal(t, protocol.ErrNotEnoughReplicas.Code(), produce(-1))
+}
@@ -0,0 +1,98 @@
+package jocko
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/log"
+)
+
+// Node runs a broker and the server handling its Kafka protocol connections in-process, so other
+// Go programs can embed jocko. Set the hooks and log output on the node's config.
+type Node struct {
+	// Tracer traces requests. Defaults to a no-op tracer.
+	Tracer opentracing.Tracer
+	// Metrics, if set, tracks the server's and broker's metrics.
+	Metrics *Metrics
+
+	config *config.Config
+	broker *Broker
+	server *Server
+	mu     sync.Mutex
+}
+
+// NewNode returns a node that runs a broker with the given config once started.
+func NewNode(config *config.Config) *Node {
+	return &Node{config: config}
+}
+
+// Start starts the broker, joining its raft and serf clusters, and the server listening for
+// Kafka protocol connections.
+func (n *Node) Start(ctx context.Context) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.broker != nil {
+		return errors.New("node already started")
+	}
+	if n.config.LogOutput != nil {
+		log.SetOutput(n.config.LogOutput)
+	}
+	tracer := n.Tracer
+	if tracer == nil {
+		tracer = opentracing.NoopTracer{}
+	}
+	broker, err := NewBroker(n.config, tracer)
+	if err != nil {
+		return err
+	}
+	if n.Metrics != nil {
+		broker.SetMetrics(n.Metrics)
+	}
+	server := NewServer(n.config, broker, n.Metrics, tracer, func() error { return nil })
+	if err := server.Start(ctx); err != nil {
+		broker.Shutdown()
+		return err
+	}
+	n.broker = broker
+	n.server = server
+	return nil
+}
+
+// Stop gracefully leaves the cluster and shuts down the server and broker. A stopped node can be
+// started again.
+func (n *Node) Stop() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.server == nil {
+		return nil
+	}
+	if err := n.server.Leave(); err != nil {
+		log.Error.Printf("node/%d: leave error: %s", n.config.ID, err)
+	}
+	// stopping again is a no-op, leaving a shut down raft blocks.
+	server := n.server
+	n.server = nil
+	n.broker = nil
+	return server.Shutdown()
+}
+
+// Addr returns the address the node's serving Kafka protocol connections on, or "" if it hasn't
+// been started or has been stopped.
+func (n *Node) Addr() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.server == nil {
+		return ""
+	}
+	return n.server.Addr().String()
+}
+
+// Broker returns the node's broker, or nil if it hasn't been started or has been stopped.
+func (n *Node) Broker() *Broker {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.broker
+}
@@ -0,0 +1,86 @@
+package jocko
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/testutil"
+)
+
+func TestNode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jocko-node")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ports := testutil.Ports(3)
+	cfg := config.DefaultConfig()
+	cfg.ID = 1
+	cfg.DataDir = dir
+	cfg.Bootstrap = true
+	cfg.BootstrapExpect = 1
+	cfg.StartAsLeader = true
+	cfg.OffsetsTopicReplicationFactor = 1
+	cfg.Addr = fmt.Sprintf("127.0.0.1:%d", ports[0])
+	cfg.RaftAddr = fmt.Sprintf("127.0.0.1:%d", ports[1])
+	cfg.SerfLANConfig.MemberlistConfig.BindAddr = "127.0.0.1"
+	cfg.SerfLANConfig.MemberlistConfig.BindPort = ports[2]
+	cfg.LeaveDrainTime = time.Millisecond
+	cfg.RaftConfig.LeaderLeaseTimeout = 100 * time.Millisecond
+	cfg.RaftConfig.HeartbeatTimeout = 200 * time.Millisecond
+	cfg.RaftConfig.ElectionTimeout = 200 * time.Millisecond
+
+	leaderCh := make(chan bool, 1)
+	topicCh := make(chan string, 1)
+	// the hooks mustn't block.
+	cfg.OnLeaderChange = func(isLeader bool) {
+		select {
+		case leaderCh <- isLeader:
+		default:
+		}
+	}
+	cfg.OnTopicChange = func(topic string, deleted bool) {
+		select {
+		case topicCh <- topic:
+		default:
+		}
+	}
+
+	n := NewNode(cfg)
+	require.Equal(t, "", n.Addr())
+	require.NoError(t, n.Start(context.Background()))
+	defer n.Stop()
+	require.Error(t, n.Start(context.Background()))
+
+	select {
+	case isLeader := <-leaderCh:
+		require.True(t, isLeader)
+	case <-time.After(5 * time.Second):
+		t.Fatal("leader change hook not called")
+	}
+
+	conn, err := Dial("tcp", n.Addr())
+	require.NoError(t, err)
+	defer conn.Close()
+	CreateTopic(t, conn, "node-topic", 1, 1)
+
+	select {
+	case topic := <-topicCh:
+		require.Equal(t, "node-topic", topic)
+	case <-time.After(5 * time.Second):
+		t.Fatal("topic change hook not called")
+	}
+	require.NoError(t, n.Stop())
+	require.Nil(t, n.Broker())
+
+	// stopped nodes can be started again.
+	require.NoError(t, n.Start(context.Background()))
+	require.NotNil(t, n.Broker())
+	require.NotEqual(t, "", n.Addr())
+	require.NoError(t, n.Stop())
+}
@@ -0,0 +1,27 @@
+package jocko
+
+import (
+	"github.com/travisjeffery/jocko/jocko/metadata"
+	"github.com/travisjeffery/jocko/jocko/structs"
+)
+
+// observerNodeMeta is the node meta key set on observers, which host no partitions.
+const observerNodeMeta = "observer"
+
+// isObserver returns whether the registered node is an observer.
+func isObserver(n *structs.Node) bool {
+	return n.Meta[observerNodeMeta] != ""
+}
+
+// partitionBrokers returns the brokers partitions can be assigned to that match the placement
+// constraints. Brokers in maintenance aren't assigned partitions.
+func (b *Broker) partitionBrokers(constraints map[string]string) []*metadata.Broker {
+	var brokers []*metadata.Broker
+	maintenance := b.maintenanceBrokers()
+	for _, broker := range b.brokerLookup.Brokers() {
+		if !broker.Observer && !maintenance[broker.ID.Int32()] && matchesConstraints(broker, constraints) {
+			brokers = append(brokers, broker)
+		}
+	}
+	return brokers
+}
@@ -0,0 +1,25 @@
+package jocko
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/jocko/metadata"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestBuildPartitionsSkipsObservers(t *testing.T) {
+	b := &Broker{brokerLookup: NewBrokerLookup(), fsm: newTestFSM(t)}
+	b.brokerLookup.AddBroker(&metadata.Broker{ID: 1, RaftAddr: "127.0.0.1:9093"})
+	b.brokerLookup.AddBroker(&metadata.Broker{ID: 2, RaftAddr: "127.0.0.1:9193"})
+	b.brokerLookup.AddBroker(&metadata.Broker{ID: 3, RaftAddr: "127.0.0.1:9293", Observer: true})
+
+	ps, err := b.buildPartitions("test-topic", 10, 2, nil)
+	require.Equal(t, protocol.ErrNone, err)
+	for _, p := range ps {
+		require.NotContains(t, p.AR, int32(3))
+	}
+
+	_, err = b.buildPartitions("test-topic", 1, 3, nil)
+	require.Equal(t, protocol.ErrInvalidReplicationFactor, err)
+}
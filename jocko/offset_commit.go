@@ -0,0 +1,386 @@
+package jocko
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/travisjeffery/jocko/jocko/util"
+	"github.com/travisjeffery/jocko/log"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+// offsetCommitVersion is the version of Kafka's offset commit key and value formats the broker
+// writes to the offsets topic.
+const offsetCommitVersion = 1
+
+// offsetCommitKey is the key of a message in the offsets topic committing a group's offset.
+type offsetCommitKey struct {
+	Group     string
+	Topic     string
+	Partition int32
+}
+
+func (k *offsetCommitKey) Encode(e protocol.PacketEncoder) error {
+	e.PutInt16(offsetCommitVersion)
+	if err := e.PutString(k.Group); err != nil {
+		return err
+	}
+	if err := e.PutString(k.Topic); err != nil {
+		return err
+	}
+	e.PutInt32(k.Partition)
+	return nil
+}
+
+func (k *offsetCommitKey) Decode(d protocol.PacketDecoder) (err error) {
+	version, err := d.Int16()
+	if err != nil {
+		return err
+	}
+	// versions 0 and 1 are the same, 2 keys group metadata.
+	if version > offsetCommitVersion {
+		return fmt.Errorf("unsupported offset commit key version %d", version)
+	}
+	if k.Group, err = d.String(); err != nil {
+		return err
+	}
+	if k.Topic, err = d.String(); err != nil {
+		return err
+	}
+	k.Partition, err = d.Int32()
+	return err
+}
+
+// offsetCommitValue is the value of a message in the offsets topic committing a group's offset.
+type offsetCommitValue struct {
+	Offset          int64
+	Metadata        string
+	CommitTimestamp int64
+	ExpireTimestamp int64
+}
+
+func (v *offsetCommitValue) Encode(e protocol.PacketEncoder) error {
+	e.PutInt16(offsetCommitVersion)
+	e.PutInt64(v.Offset)
+	if err := e.PutString(v.Metadata); err != nil {
+		return err
+	}
+	e.PutInt64(v.CommitTimestamp)
+	e.PutInt64(v.ExpireTimestamp)
+	return nil
+}
+
+func (v *offsetCommitValue) Decode(d protocol.PacketDecoder) (err error) {
+	version, err := d.Int16()
+	if err != nil {
+		return err
+	}
+	if version != offsetCommitVersion {
+		return fmt.Errorf("unsupported offset commit value version %d", version)
+	}
+	if v.Offset, err = d.Int64(); err != nil {
+		return err
+	}
+	if v.Metadata, err = d.String(); err != nil {
+		return err
+	}
+	if v.CommitTimestamp, err = d.Int64(); err != nil {
+		return err
+	}
+	v.ExpireTimestamp, err = d.Int64()
+	return err
+}
+
+// offsetCommits batches the offset commits to each of the offsets topic's partitions, appending
+// the commits that arrive within the linger together rather than each on its own, since with
+// many consumers auto-committing the appends would otherwise dominate the disk's IOPS. It also
+// serves the committed offsets, read back from the partitions' logs.
+type offsetCommits struct {
+	mu      sync.Mutex
+	batches map[int32]*commitBatch
+	offsets map[int32]*committedOffsets
+	// appendMu serializes the batches' appends.
+	appendMu sync.Mutex
+}
+
+// commitBatch is the commits waiting to be appended to an offsets topic partition.
+type commitBatch struct {
+	replica  *Replica
+	messages []*protocol.Message
+	// done is closed once the batch is appended, with err the append's error.
+	done chan struct{}
+	err  protocol.Error
+	once sync.Once
+}
+
+// committedOffsets are the offsets committed to an offsets topic partition's log.
+type committedOffsets struct {
+	log CommitLog
+	// next is the offset of the next message set to read from the log.
+	next    int64
+	offsets map[offsetCommitKey]offsetCommitValue
+}
+
+func newOffsetCommits() *offsetCommits {
+	return &offsetCommits{
+		batches: make(map[int32]*commitBatch),
+		offsets: make(map[int32]*committedOffsets),
+	}
+}
+
+// coordinatorPartition returns the offsets topic partition storing the group's offsets.
+func coordinatorPartition(group string, partitions int) int32 {
+	return int32(util.Hash(group) % uint64(partitions))
+}
+
+// coordinatorReplica returns the replica of the offsets topic partition storing the group's
+// offsets, if this broker leads it. The replica's pinned, callers unpin it once they're done with
+// its log.
+func (b *Broker) coordinatorReplica(group string) (*Replica, protocol.Error) {
+	_, topic, err := b.fsm.State().GetTopic(OffsetsTopicName)
+	if err != nil {
+		return nil, protocol.ErrUnknown.WithErr(err)
+	}
+	if topic == nil || len(topic.Partitions) == 0 {
+		return nil, protocol.ErrCoordinatorNotAvailable
+	}
+	replica, err := b.replicaLookup.Replica(OffsetsTopicName, coordinatorPartition(group, len(topic.Partitions)))
+	if err != nil {
+		return nil, protocol.ErrNotCoordinator
+	}
+	if err := b.checkLeader(replica); err != protocol.ErrNone {
+		return nil, protocol.ErrNotCoordinator
+	}
+	if err := b.wakeReplica(replica); err != protocol.ErrNone {
+		return nil, err
+	}
+	if replica.Log == nil {
+		replica.unpin()
+		return nil, protocol.ErrCoordinatorNotAvailable
+	}
+	return replica, protocol.ErrNone
+}
+
+// checkCoordinator returns an error unless this broker is the group's coordinator.
+func (b *Broker) checkCoordinator(group string) protocol.Error {
+	replica, err := b.coordinatorReplica(group)
+	if err != protocol.ErrNone {
+		return err
+	}
+	replica.unpin()
+	return protocol.ErrNone
+}
+
+func (b *Broker) handleOffsetCommit(ctx *Context, r *protocol.OffsetCommitRequest) *protocol.OffsetCommitResponse {
+	sp := span(ctx, b.tracer, "offset commit")
+	defer sp.Finish()
+	res := &protocol.OffsetCommitResponse{
+		APIVersion: r.Version(),
+		Topics:     make([]*protocol.OffsetCommitResponseTopic, len(r.Topics)),
+	}
+	for i, t := range r.Topics {
+		res.Topics[i] = &protocol.OffsetCommitResponseTopic{
+			Name:       t.Name,
+			Partitions: make([]*protocol.OffsetCommitResponsePartition, len(t.Partitions)),
+		}
+		for j, p := range t.Partitions {
+			res.Topics[i].Partitions[j] = &protocol.OffsetCommitResponsePartition{PartitionIndex: p.PartitionIndex}
+		}
+	}
+
+	replica, err := b.coordinatorReplica(r.GroupID)
+	if err == protocol.ErrNone {
+		// members of earlier generations can't overwrite the offsets of partitions reassigned since,
+		// nor can commits outside of a generation while the group has members. Brokers commit the
+		// offsets of transactions as they end, those are the group's consumers' offsets.
+		if !brokerClientID.MatchString(ctx.Header().ClientID) {
+			err = b.groups.commit(r.GroupID, r.MemberID, r.GenerationID, b.clock.Now())
+		}
+		var messages []*protocol.Message
+		if err == protocol.ErrNone {
+			if messages, err = offsetCommitMessages(r, b.clock.Now()); err == protocol.ErrNone && len(messages) > 0 {
+				err = b.commitOffsets(replica, messages)
+			}
+		}
+		replica.unpin()
+	}
+	if err != protocol.ErrNone {
+		log.Error.Printf("broker/%d: offset commit: group: %s: %s", b.config.ID, r.GroupID, err)
+	}
+	for _, t := range res.Topics {
+		for _, p := range t.Partitions {
+			p.ErrorCode = err.Code()
+		}
+	}
+	return res
+}
+
+// offsetCommitMessages returns the messages committing the request's offsets.
+func offsetCommitMessages(r *protocol.OffsetCommitRequest, now time.Time) ([]*protocol.Message, protocol.Error) {
+	var messages []*protocol.Message
+	for _, t := range r.Topics {
+		for _, p := range t.Partitions {
+			value := &offsetCommitValue{Offset: p.CommittedOffset, CommitTimestamp: now.UnixNano() / int64(time.Millisecond), ExpireTimestamp: -1}
+			if p.CommittedMetadata != nil {
+				value.Metadata = *p.CommittedMetadata
+			}
+			if r.RetentionTime > 0 {
+				value.ExpireTimestamp = value.CommitTimestamp + int64(r.RetentionTime/time.Millisecond)
+			}
+			k, err := protocol.Encode(&offsetCommitKey{Group: r.GroupID, Topic: t.Name, Partition: p.PartitionIndex})
+			if err != nil {
+				return nil, protocol.ErrUnknown.WithErr(err)
+			}
+			v, err := protocol.Encode(value)
+			if err != nil {
+				return nil, protocol.ErrUnknown.WithErr(err)
+			}
+			messages = append(messages, &protocol.Message{Key: k, Value: v})
+		}
+	}
+	return messages, protocol.ErrNone
+}
+
+// commitOffsets adds the messages to the partition's batch, waiting for it to be appended.
+func (b *Broker) commitOffsets(replica *Replica, messages []*protocol.Message) protocol.Error {
+	c := b.offsetCommits
+	c.mu.Lock()
+	batch, ok := c.batches[replica.Partition.ID]
+	if !ok {
+		batch = &commitBatch{replica: replica, done: make(chan struct{})}
+		c.batches[replica.Partition.ID] = batch
+		if linger := b.config.OffsetCommitLinger; linger > 0 {
+			timer := b.clock.NewTimer(linger)
+			b.goroutines.goFunc("offset commits", func() {
+				defer timer.Stop()
+				select {
+				case <-timer.C():
+					b.appendOffsetCommits(batch)
+				case <-b.shutdownCh:
+					b.finishOffsetCommits(batch, protocol.ErrCoordinatorNotAvailable)
+				}
+			})
+		}
+	}
+	batch.messages = append(batch.messages, messages...)
+	c.mu.Unlock()
+	if b.config.OffsetCommitLinger <= 0 {
+		b.appendOffsetCommits(batch)
+	}
+	<-batch.done
+	return batch.err
+}
+
+// appendOffsetCommits appends the batch's commits to its partition's log in one message set.
+func (b *Broker) appendOffsetCommits(batch *commitBatch) {
+	c := b.offsetCommits
+	c.mu.Lock()
+	if c.batches[batch.replica.Partition.ID] == batch {
+		delete(c.batches, batch.replica.Partition.ID)
+	}
+	messages := batch.messages
+	batch.messages = nil
+	c.mu.Unlock()
+	if len(messages) == 0 {
+		// being appended by another commit that didn't linger.
+		return
+	}
+
+	c.appendMu.Lock()
+	defer c.appendMu.Unlock()
+	set, err := protocol.Encode(&protocol.MessageSet{Messages: messages})
+	if err != nil {
+		b.finishOffsetCommits(batch, protocol.ErrUnknown.WithErr(err))
+		return
+	}
+	if _, err := batch.replica.Log.Append(set); err != nil {
+		log.Error.Printf("broker/%d: offset commits append error: %s", b.config.ID, err)
+		b.finishOffsetCommits(batch, protocol.ErrUnknown.WithErr(err))
+		return
+	}
+	b.trackProduce(OffsetsTopicName, batch.replica.Partition.ID, set)
+	b.purgatory.wake(OffsetsTopicName, batch.replica.Partition.ID)
+	b.finishOffsetCommits(batch, protocol.ErrNone)
+}
+
+// finishOffsetCommits answers the batch's commits with the error.
+func (b *Broker) finishOffsetCommits(batch *commitBatch, err protocol.Error) {
+	batch.once.Do(func() {
+		c := b.offsetCommits
+		c.mu.Lock()
+		if c.batches[batch.replica.Partition.ID] == batch {
+			delete(c.batches, batch.replica.Partition.ID)
+		}
+		c.mu.Unlock()
+		batch.err = err
+		close(batch.done)
+	})
+}
+
+// committedOffset returns the offset the group committed for the partition, read from the
+// replica's log.
+func (b *Broker) committedOffset(replica *Replica, key offsetCommitKey) (offsetCommitValue, bool, error) {
+	c := b.offsetCommits
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	o := c.offsets[replica.Partition.ID]
+	if o == nil || o.log != replica.Log {
+		// the replica's log was recreated, e.g. reassigned away and back, so it's reread.
+		o = &committedOffsets{log: replica.Log, offsets: make(map[offsetCommitKey]offsetCommitValue)}
+		c.offsets[replica.Partition.ID] = o
+	}
+	if err := o.read(); err != nil {
+		return offsetCommitValue{}, false, err
+	}
+	v, ok := o.offsets[key]
+	return v, ok, nil
+}
+
+// read reads the commits appended to the log since it was last read.
+func (o *committedOffsets) read() error {
+	if o.next >= o.log.NewestOffset() {
+		return nil
+	}
+	if oldest := o.log.OldestOffset(); o.next < oldest {
+		o.next = oldest
+	}
+	rdr, err := o.log.NewReader(o.next, 0)
+	if err != nil {
+		return err
+	}
+	p, err := ioutil.ReadAll(rdr)
+	if err != nil {
+		return err
+	}
+	// the reader reads to the log's end, the last message set may be partially appended.
+	for len(p) >= 12 {
+		n := 12 + int(protocol.Encoding.Uint32(p[8:12]))
+		if len(p) < n {
+			break
+		}
+		ms := new(protocol.MessageSet)
+		if err := ms.Decode(protocol.NewDecoder(p[:n])); err != nil {
+			return err
+		}
+		for _, m := range ms.Messages {
+			var k offsetCommitKey
+			if err := k.Decode(protocol.NewDecoder(m.Key)); err != nil {
+				return err
+			}
+			if m.Value == nil {
+				delete(o.offsets, k)
+				continue
+			}
+			var v offsetCommitValue
+			if err := v.Decode(protocol.NewDecoder(m.Value)); err != nil {
+				return err
+			}
+			o.offsets[k] = v
+		}
+		o.next = ms.Offset + 1
+		p = p[n:]
+	}
+	return nil
+}
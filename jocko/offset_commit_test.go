@@ -0,0 +1,102 @@
+package jocko
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/testutil/retry"
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestBroker_OffsetCommit(t *testing.T) {
+	s, dir := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+		cfg.OffsetCommitLinger = 200 * time.Millisecond
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+
+	conn, err := Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	retry.Run(t, func(r *retry.R) {
+		res, err := conn.FindCoordinator(&protocol.FindCoordinatorRequest{CoordinatorKey: "group"})
+		if err != nil {
+			r.Fatal(err)
+		}
+		if res.ErrorCode != protocol.ErrNone.Code() {
+			r.Fatalf("find coordinator error: %d", res.ErrorCode)
+		}
+	})
+	partition := coordinatorPartition("group", OffsetsTopicNumPartitions)
+	WaitForTopicLeader(t, OffsetsTopicName, partition, s)
+	replica, err := s.broker().replicaLookup.Replica(OffsetsTopicName, partition)
+	require.NoError(t, err)
+	newest := replica.Log.NewestOffset()
+
+	// concurrent commits within the linger are appended together.
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c, err := Dial("tcp", s.Addr().String())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer c.Close()
+			metadata := "m"
+			res, err := c.OffsetCommit(&protocol.OffsetCommitRequest{
+				APIVersion:   2,
+				GroupID:      "group",
+				GenerationID: -1,
+				Topics: []*protocol.OffsetCommitRequestTopic{{
+					Name:       "topic",
+					Partitions: []*protocol.OffsetCommitRequestPartition{{PartitionIndex: int32(i), CommittedOffset: int64(10 * i), CommittedMetadata: &metadata}},
+				}},
+			})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if code := res.Topics[0].Partitions[0].ErrorCode; code != protocol.ErrNone.Code() {
+				t.Errorf("offset commit error: %d", code)
+			}
+		}(i)
+	}
+	wg.Wait()
+	require.Equal(t, newest+1, replica.Log.NewestOffset())
+
+	res, err := conn.OffsetFetch(&protocol.OffsetFetchRequest{
+		APIVersion: 1,
+		GroupID:    "group",
+		Topics:     []protocol.OffsetFetchTopicRequest{{Topic: "topic", Partitions: []int32{0, 3, 5}}},
+	})
+	require.NoError(t, err)
+	metadata := "m"
+	require.Equal(t, []protocol.OffsetFetchPartition{
+		{Partition: 0, Offset: 0, Metadata: &metadata},
+		{Partition: 3, Offset: 30, Metadata: &metadata},
+		{Partition: 5, Offset: -1},
+	}, res.Responses[0].Partitions)
+
+	// the offsets are read back from the log after the broker's forgotten them.
+	s.broker().offsetCommits = newOffsetCommits()
+	res, err = conn.OffsetFetch(&protocol.OffsetFetchRequest{
+		APIVersion: 1,
+		GroupID:    "group",
+		Topics:     []protocol.OffsetFetchTopicRequest{{Topic: "topic", Partitions: []int32{4}}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(40), res.Responses[0].Partitions[0].Offset)
+}
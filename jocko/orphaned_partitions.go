@@ -0,0 +1,163 @@
+package jocko
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/travisjeffery/jocko/commitlog"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/log"
+)
+
+// quarantineDir is the dir in the data dir orphaned partition dirs are moved into.
+const quarantineDir = "quarantine"
+
+// orphanedPartitionsLoop scans the data dir for orphaned partition dirs once the broker's caught
+// up with the raft state on startup, and then every scan interval. A dir's only quarantined or
+// deleted if it's still orphaned on the scan after the one that found it, so a partition whose
+// assignment reached this broker before its raft state did isn't mistaken for an orphan.
+func (b *Broker) orphanedPartitionsLoop() {
+	var suspects map[string]bool
+	// the first scan's retried each second until the broker's caught up.
+	wait := time.Second
+	for {
+		select {
+		case <-b.shutdownCh:
+			return
+		case <-b.clock.After(wait):
+		}
+		if !b.raftCaughtUp() {
+			continue
+		}
+		orphans, err := b.orphanedPartitionDirs()
+		if err != nil {
+			log.Error.Printf("broker/%d: scan for orphaned partitions error: %s", b.config.ID, err)
+			continue
+		}
+		suspects = b.handleOrphanedPartitions(orphans, suspects)
+		wait = b.config.OrphanedPartitionScanInterval
+	}
+}
+
+// raftCaughtUp returns whether the broker knows the raft leader and has applied the raft log it's
+// received.
+func (b *Broker) raftCaughtUp() bool {
+	return b.raft.Leader() != "" && b.raft.AppliedIndex() >= b.raft.LastIndex()
+}
+
+// handleOrphanedPartitions quarantines or deletes the orphaned dirs that were suspects on the
+// previous scan, returning the others as this scan's suspects.
+func (b *Broker) handleOrphanedPartitions(orphans []string, suspects map[string]bool) map[string]bool {
+	action := b.config.OrphanedPartitionAction
+	if action == "" {
+		action = config.OrphanedPartitionsQuarantine
+	}
+	next := make(map[string]bool)
+	for _, name := range orphans {
+		if !suspects[name] {
+			log.Info.Printf("broker/%d: found orphaned partition dir %s: it's %sd if it's still orphaned on the next scan", b.config.ID, name, action)
+			next[name] = true
+			continue
+		}
+		path := filepath.Join(b.config.DataDir, "data", name)
+		var err error
+		if action == config.OrphanedPartitionsDelete {
+			err = os.RemoveAll(path)
+		} else {
+			err = b.quarantinePartitionDir(path)
+		}
+		if err != nil {
+			log.Error.Printf("broker/%d: %s orphaned partition dir %s error: %s", b.config.ID, action, name, err)
+			next[name] = true
+			continue
+		}
+		log.Info.Printf("broker/%d: %sd orphaned partition dir %s", b.config.ID, action, name)
+		if m := b.topicMetrics(); m != nil && m.OrphanedPartitionsRemoved != nil {
+			m.OrphanedPartitionsRemoved.With("action", action).Add(1)
+		}
+	}
+	if m := b.topicMetrics(); m != nil && m.OrphanedPartitions != nil {
+		m.OrphanedPartitions.Set(float64(len(next)))
+	}
+	return next
+}
+
+// quarantinePartitionDir moves the partition dir into the data dir's quarantine dir, suffixed
+// with the time if a dir with its name was quarantined before.
+func (b *Broker) quarantinePartitionDir(path string) error {
+	dir := filepath.Join(b.config.DataDir, quarantineDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	dst := filepath.Join(dir, filepath.Base(path))
+	if fileExists(dst) {
+		dst = fmt.Sprintf("%s.%d", dst, b.clock.Now().UnixNano())
+	}
+	return os.Rename(path, dst)
+}
+
+// orphanedPartitionDirs returns the names of the partition dirs in the data dir that don't belong
+// to one of the broker's replicas: their topic or partition no longer exists, the partition's
+// been reassigned off the broker, the dir belongs to a deleted topic with the same name, or the
+// dir was left by an interrupted deletion. Version 0 partition logs waiting to be adopted aren't
+// orphans.
+func (b *Broker) orphanedPartitionDirs() ([]string, error) {
+	infos, err := ioutil.ReadDir(filepath.Join(b.config.DataDir, "data"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	state := b.fsm.State()
+	var orphans []string
+	for _, fi := range infos {
+		if !fi.IsDir() {
+			continue
+		}
+		if _, ok := legacyPartitionID(fi); ok {
+			continue
+		}
+		name := fi.Name()
+		if strings.HasSuffix(name, commitlog.DeletedDirSuffix) {
+			orphans = append(orphans, name)
+			continue
+		}
+		i := strings.LastIndex(name, "-")
+		if i <= 0 {
+			continue
+		}
+		topic := name[:i]
+		id, err := strconv.ParseInt(name[i+1:], 10, 32)
+		if err != nil || id < 0 {
+			continue
+		}
+		if _, err := b.replicaLookup.Replica(topic, int32(id)); err == nil {
+			continue
+		}
+		_, t, err := state.GetTopic(topic)
+		if err != nil {
+			return nil, err
+		}
+		_, p, err := state.GetPartition(topic, int32(id))
+		if err != nil {
+			return nil, err
+		}
+		if t != nil && p != nil && contains(p.AR, b.config.ID) && b.partitionDirTopicID(name) == t.ID {
+			continue
+		}
+		orphans = append(orphans, name)
+	}
+	return orphans, nil
+}
+
+// partitionDirTopicID returns the ID of the topic the partition dir belongs to, empty if it
+// predates topic IDs.
+func (b *Broker) partitionDirTopicID(name string) string {
+	id, _ := readPartitionTopicID(filepath.Join(b.config.DataDir, "data", name, partitionMetadataFile))
+	return id
+}
@@ -0,0 +1,57 @@
+package jocko
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/commitlog"
+	"github.com/travisjeffery/jocko/jocko/config"
+)
+
+func TestBroker_OrphanedPartitions(t *testing.T) {
+	s, dir := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+		// the test scans itself.
+		cfg.OrphanedPartitionScanInterval = 0
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+
+	conn, err := Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	CreateTopic(t, conn, "kept", 1, 1)
+	WaitForTopicLeader(t, "kept", 0, s)
+
+	b := s.broker()
+	data := filepath.Join(b.config.DataDir, "data")
+	for _, name := range []string{"gone-0", "kept-1", "old-0" + commitlog.DeletedDirSuffix, "3"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(data, name), 0755))
+	}
+	orphans, err := b.orphanedPartitionDirs()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"gone-0", "kept-1", "old-0" + commitlog.DeletedDirSuffix}, orphans)
+
+	// orphans are only suspects on the scan that finds them.
+	suspects := b.handleOrphanedPartitions(orphans, nil)
+	require.Len(t, suspects, 3)
+	require.True(t, fileExists(filepath.Join(data, "gone-0")))
+
+	// and are quarantined if they're still orphaned on the next.
+	require.NoError(t, os.RemoveAll(filepath.Join(data, "kept-1")))
+	orphans, err = b.orphanedPartitionDirs()
+	require.NoError(t, err)
+	require.Empty(t, b.handleOrphanedPartitions(orphans, suspects))
+	require.False(t, fileExists(filepath.Join(data, "gone-0")))
+	require.True(t, fileExists(filepath.Join(b.config.DataDir, quarantineDir, "gone-0")))
+	require.True(t, fileExists(filepath.Join(b.config.DataDir, quarantineDir, "old-0"+commitlog.DeletedDirSuffix)))
+	require.True(t, fileExists(filepath.Join(data, "kept-0")))
+	require.True(t, fileExists(filepath.Join(data, "3")))
+}
@@ -0,0 +1,97 @@
+package jocko
+
+import (
+	"sort"
+
+	"github.com/travisjeffery/jocko/commitlog"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+// segmentLister is implemented by commit logs that can list their segments.
+type segmentLister interface {
+	Segments() []*commitlog.Segment
+}
+
+// handlePartitionStats returns the offsets and segment counts of the requested partitions, of all
+// those this broker leads if none are requested, so lag tools can get a broker's partitions in
+// one request rather than a list offsets request each.
+func (b *Broker) handlePartitionStats(ctx *Context, req *protocol.PartitionStatsRequest) *protocol.PartitionStatsResponse {
+	sp := span(ctx, b.tracer, "partition stats")
+	defer sp.Finish()
+	res := &protocol.PartitionStatsResponse{APIVersion: req.Version()}
+
+	led := b.ledPartitions()
+	topics := req.Topics
+	if len(topics) == 0 {
+		for topic := range led {
+			topics = append(topics, &protocol.PartitionStatsTopic{Topic: topic})
+		}
+		sort.Slice(topics, func(i, j int) bool { return topics[i].Topic < topics[j].Topic })
+	}
+	for _, t := range topics {
+		partitions := t.Partitions
+		if len(partitions) == 0 {
+			partitions = led[t.Topic]
+		}
+		tres := &protocol.PartitionStatsTopicResponse{Topic: t.Topic}
+		for _, id := range partitions {
+			tres.Partitions = append(tres.Partitions, b.partitionStats(t.Topic, id))
+		}
+		res.Topics = append(res.Topics, tres)
+	}
+	return res
+}
+
+// ledPartitions returns the IDs of the partitions this broker leads by topic, sorted.
+func (b *Broker) ledPartitions() map[string][]int32 {
+	led := make(map[string][]int32)
+	for _, replica := range b.replicaLookup.Replicas() {
+		if b.checkLeader(replica) == protocol.ErrNone {
+			led[replica.Partition.Topic] = append(led[replica.Partition.Topic], replica.Partition.ID)
+		}
+	}
+	for _, ids := range led {
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	}
+	return led
+}
+
+func (b *Broker) partitionStats(topic string, id int32) *protocol.PartitionStats {
+	stats := &protocol.PartitionStats{Partition: id}
+	replica, err := b.replicaLookup.Replica(topic, id)
+	if err != nil {
+		stats.ErrorCode = protocol.ErrUnknownTopicOrPartition.Code()
+		return stats
+	}
+	// only the leader's log end offset is the partition's.
+	if err := b.checkLeader(replica); err != protocol.ErrNone {
+		stats.ErrorCode = err.Code()
+		return stats
+	}
+	if err := b.wakeReplica(replica); err != protocol.ErrNone {
+		stats.ErrorCode = err.Code()
+		return stats
+	}
+	defer replica.unpin()
+	if replica.Log == nil {
+		stats.ErrorCode = protocol.ErrReplicaNotAvailable.Code()
+		return stats
+	}
+	newest := replica.Log.NewestOffset()
+	stats.LogStartOffset = replica.Log.OldestOffset()
+	stats.LogEndOffset = newest
+	// records on delayed delivery topics aren't fetchable until they're visible.
+	visible := replica.visibleOffset(newest, b.clock.Now())
+	stats.HighWatermark = visible - 1
+	// the last stable offset is what read committed consumers are served up to, before the
+	// records of transactions that aren't committed or aborted yet.
+	stable := visible
+	if lso := lastStableOffset(replica.Log); lso < stable {
+		stable = lso
+	}
+	stats.LastStableOffset = stable - 1
+	if l, ok := replica.Log.(segmentLister); ok {
+		stats.Segments = int32(len(l.Segments()))
+	}
+	return stats
+}
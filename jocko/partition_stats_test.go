@@ -0,0 +1,72 @@
+package jocko
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestBroker_PartitionStats(t *testing.T) {
+	s, dir := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+
+	conn, err := Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	CreateTopic(t, conn, "stats", 2, 1)
+	WaitForTopicLeader(t, "stats", 0, s)
+	WaitForTopicLeader(t, "stats", 1, s)
+
+	set, err := protocol.Encode(&protocol.MessageSet{Messages: []*protocol.Message{{Value: []byte("v")}}})
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		res, err := conn.Produce(&protocol.ProduceRequest{
+			APIVersion: 2,
+			Timeout:    time.Second,
+			TopicData: []*protocol.TopicData{{
+				Topic: "stats",
+				Data:  []*protocol.Data{{Partition: 0, RecordSet: set}},
+			}},
+		})
+		require.NoError(t, err)
+		require.Equal(t, protocol.ErrNone.Code(), res.Responses[0].PartitionResponses[0].ErrorCode)
+	}
+
+	res, err := conn.PartitionStats(&protocol.PartitionStatsRequest{Topics: []*protocol.PartitionStatsTopic{
+		{Topic: "stats", Partitions: []int32{0, 1, 2}},
+	}})
+	require.NoError(t, err)
+	require.Equal(t, []*protocol.PartitionStatsTopicResponse{{
+		Topic: "stats",
+		Partitions: []*protocol.PartitionStats{
+			{Partition: 0, LogEndOffset: 3, HighWatermark: 2, LastStableOffset: 2, Segments: 1},
+			{Partition: 1, HighWatermark: -1, LastStableOffset: -1, Segments: 1},
+			{Partition: 2, ErrorCode: protocol.ErrUnknownTopicOrPartition.Code()},
+		},
+	}}, res.Topics)
+
+	// with no topics it's every partition the broker leads.
+	res, err = conn.PartitionStats(&protocol.PartitionStatsRequest{})
+	require.NoError(t, err)
+	var found bool
+	for _, tres := range res.Topics {
+		if tres.Topic == "stats" {
+			found = true
+			require.Equal(t, 2, len(tres.Partitions))
+			require.Equal(t, int64(3), tres.Partitions[0].LogEndOffset)
+		}
+	}
+	require.True(t, found)
+}
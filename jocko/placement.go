@@ -0,0 +1,39 @@
+package jocko
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/travisjeffery/jocko/jocko/metadata"
+)
+
+// placementConstraintsConfig is the topic config constraining the brokers the topic's replicas are
+// assigned to, as comma separated tag=value pairs the brokers' tags must all match, e.g.
+// "disk=ssd,dc=us-east".
+const placementConstraintsConfig = "placement.constraints"
+
+// parsePlacementConstraints parses the placement constraints config value.
+func parsePlacementConstraints(s string) (map[string]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	constraints := make(map[string]string)
+	for _, c := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(c), "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid placement constraint %q: must be tag=value", c)
+		}
+		constraints[kv[0]] = kv[1]
+	}
+	return constraints, nil
+}
+
+// matchesConstraints returns whether the broker's tags match every constraint.
+func matchesConstraints(broker *metadata.Broker, constraints map[string]string) bool {
+	for k, v := range constraints {
+		if tag, ok := broker.Tags[k]; !ok || tag != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,108 @@
+package jocko
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/testutil/retry"
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/jocko/metadata"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestParsePlacementConstraints(t *testing.T) {
+	c, err := parsePlacementConstraints("")
+	require.NoError(t, err)
+	require.Nil(t, c)
+
+	c, err = parsePlacementConstraints("disk=ssd, dc=us-east")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"disk": "ssd", "dc": "us-east"}, c)
+
+	_, err = parsePlacementConstraints("disk")
+	require.Error(t, err)
+	_, err = parsePlacementConstraints("=ssd")
+	require.Error(t, err)
+}
+
+func TestBuildPartitionsPlacementConstraints(t *testing.T) {
+	b := &Broker{brokerLookup: NewBrokerLookup(), fsm: newTestFSM(t)}
+	b.brokerLookup.AddBroker(&metadata.Broker{ID: 1, RaftAddr: "127.0.0.1:9093", Tags: map[string]string{"disk": "ssd", "dc": "us-east"}})
+	b.brokerLookup.AddBroker(&metadata.Broker{ID: 2, RaftAddr: "127.0.0.1:9193", Tags: map[string]string{"disk": "ssd", "dc": "us-west"}})
+	b.brokerLookup.AddBroker(&metadata.Broker{ID: 3, RaftAddr: "127.0.0.1:9293", Tags: map[string]string{"disk": "hdd", "dc": "us-east"}})
+	b.brokerLookup.AddBroker(&metadata.Broker{ID: 4, RaftAddr: "127.0.0.1:9393"})
+
+	ps, err := b.buildPartitions("test-topic", 10, 2, map[string]string{"disk": "ssd"})
+	require.Equal(t, protocol.ErrNone, err)
+	for _, p := range ps {
+		require.ElementsMatch(t, []int32{1, 2}, p.AR)
+	}
+
+	ps, err = b.buildPartitions("test-topic", 10, 1, map[string]string{"disk": "ssd", "dc": "us-east"})
+	require.Equal(t, protocol.ErrNone, err)
+	for _, p := range ps {
+		require.Equal(t, []int32{1}, p.AR)
+	}
+
+	_, err = b.buildPartitions("test-topic", 1, 2, map[string]string{"dc": "us-east", "disk": "hdd"})
+	require.Equal(t, protocol.ErrInvalidReplicationFactor.Code(), err.Code())
+
+	_, err = b.buildPartitions("test-topic", 1, 1, map[string]string{"dc": "eu-west"})
+	require.Equal(t, protocol.ErrInvalidReplicationFactor.Code(), err.Code())
+}
+
+func TestBuildPartitionsDiskUsage(t *testing.T) {
+	b := &Broker{brokerLookup: NewBrokerLookup(), fsm: newTestFSM(t)}
+	b.brokerLookup.AddBroker(&metadata.Broker{ID: 1, RaftAddr: "127.0.0.1:9093", LogBytes: 90, DiskFreeBytes: 10})
+	b.brokerLookup.AddBroker(&metadata.Broker{ID: 2, RaftAddr: "127.0.0.1:9193", LogBytes: 10, DiskFreeBytes: 90})
+	b.brokerLookup.AddBroker(&metadata.Broker{ID: 3, RaftAddr: "127.0.0.1:9293", LogBytes: 10, DiskFreeBytes: 90})
+
+	ps, err := b.buildPartitions("test-topic", 300, 2, nil)
+	require.Equal(t, protocol.ErrNone, err)
+	replicas := make(map[int32]int)
+	for _, p := range ps {
+		require.Len(t, p.AR, 2)
+		require.NotEqual(t, p.AR[0], p.AR[1])
+		require.Equal(t, p.AR[0], p.Leader)
+		for _, id := range p.AR {
+			replicas[id]++
+		}
+	}
+	// the full disk gets far fewer of the replicas than its even share of 200.
+	require.True(t, replicas[1] < 100, "full disk got %d replicas", replicas[1])
+	require.Equal(t, 600, replicas[1]+replicas[2]+replicas[3])
+
+	// disks used about evenly get the replicas spread evenly.
+	require.Nil(t, diskWeights([]*metadata.Broker{{LogBytes: 50, DiskFreeBytes: 50}, {LogBytes: 55, DiskFreeBytes: 45}}))
+}
+
+func TestBroker_ReportDiskUsage(t *testing.T) {
+	if _, _, err := diskUsage(os.TempDir()); err != nil {
+		t.Skip(err)
+	}
+	s, dir := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+		cfg.DiskUsageReportInterval = 100 * time.Millisecond
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+
+	retry.Run(t, func(r *retry.R) {
+		broker := s.broker().brokerLookup.BrokerByID(raft.ServerID(fmt.Sprintf("%d", s.broker().config.ID)))
+		if broker == nil {
+			r.Fatal("broker not found")
+		}
+		if _, ok := broker.DiskUsed(); !ok {
+			r.Fatal("disk usage not reported")
+		}
+	})
+}
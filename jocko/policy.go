@@ -0,0 +1,128 @@
+package jocko
+
+import (
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+// CreateTopicPolicyRequest is a topic to be created, after the broker's defaults are applied.
+type CreateTopicPolicyRequest struct {
+	Topic             string
+	NumPartitions     int32
+	ReplicationFactor int16
+	// ReplicaAssignment is the replicas requested for each partition, if the client assigned
+	// them.
+	ReplicaAssignment map[int32][]int32
+	// Configs are the topic configs set in the request, others have their defaults.
+	Configs map[string]string
+}
+
+// CreateTopicPolicy validates topics before they're created, like Kafka's
+// create.topic.policy.class.name, e.g. to enforce naming conventions, partition limits, and
+// replication minimums across the cluster.
+type CreateTopicPolicy interface {
+	// ValidateCreateTopic returns an error if the topic mustn't be created, which is sent to the
+	// client with a policy violation. It's called by the controller while handling the request
+	// and may be called concurrently.
+	ValidateCreateTopic(req CreateTopicPolicyRequest) error
+}
+
+// CreateTopicPolicyFunc is an adapter to use an ordinary function as a CreateTopicPolicy.
+type CreateTopicPolicyFunc func(req CreateTopicPolicyRequest) error
+
+// ValidateCreateTopic calls f(req).
+func (f CreateTopicPolicyFunc) ValidateCreateTopic(req CreateTopicPolicyRequest) error {
+	return f(req)
+}
+
+// AlterConfigPolicyRequest is a topic's config to be altered to.
+type AlterConfigPolicyRequest struct {
+	Topic string
+	// Configs are the topic configs set in the request, others are reset to their defaults.
+	Configs map[string]string
+}
+
+// AlterConfigPolicy validates topic configs before they're altered, like Kafka's
+// alter.config.policy.class.name.
+type AlterConfigPolicy interface {
+	// ValidateAlterConfig returns an error if the config mustn't be altered, which is sent to the
+	// client with a policy violation. It's called by the controller while handling the request,
+	// validate only ones too, and may be called concurrently.
+	ValidateAlterConfig(req AlterConfigPolicyRequest) error
+}
+
+// AlterConfigPolicyFunc is an adapter to use an ordinary function as an AlterConfigPolicy.
+type AlterConfigPolicyFunc func(req AlterConfigPolicyRequest) error
+
+// ValidateAlterConfig calls f(req).
+func (f AlterConfigPolicyFunc) ValidateAlterConfig(req AlterConfigPolicyRequest) error {
+	return f(req)
+}
+
+// SetCreateTopicPolicy sets the policy validating the topics clients create, including those
+// auto-created. Only the controller creates topics, so it's set on every broker that may become
+// it. Internal topics aren't validated. A nil policy removes it.
+func (b *Broker) SetCreateTopicPolicy(p CreateTopicPolicy) {
+	b.Lock()
+	defer b.Unlock()
+	b.createTopicPolicy = p
+}
+
+// SetAlterConfigPolicy sets the policy validating the topic configs clients alter. Like
+// SetCreateTopicPolicy it's set on every broker that may become the controller. A nil policy
+// removes it.
+func (b *Broker) SetAlterConfigPolicy(p AlterConfigPolicy) {
+	b.Lock()
+	defer b.Unlock()
+	b.alterConfigPolicy = p
+}
+
+// checkCreateTopicPolicy returns a policy violation if the create topic policy rejects the topic.
+func (b *Broker) checkCreateTopicPolicy(req *protocol.CreateTopicRequest) protocol.Error {
+	b.RLock()
+	p := b.createTopicPolicy
+	b.RUnlock()
+	if p == nil {
+		return protocol.ErrNone
+	}
+	err := p.ValidateCreateTopic(CreateTopicPolicyRequest{
+		Topic:             req.Topic,
+		NumPartitions:     req.NumPartitions,
+		ReplicationFactor: req.ReplicationFactor,
+		ReplicaAssignment: req.ReplicaAssignment,
+		Configs:           policyConfigs(req.Configs),
+	})
+	if err != nil {
+		return protocol.ErrPolicyViolation.WithErr(err)
+	}
+	return protocol.ErrNone
+}
+
+// checkAlterConfigPolicy returns a policy violation if the alter config policy rejects the
+// resource's config.
+func (b *Broker) checkAlterConfigPolicy(r protocol.AlterConfigsResource) protocol.Error {
+	b.RLock()
+	p := b.alterConfigPolicy
+	b.RUnlock()
+	if p == nil {
+		return protocol.ErrNone
+	}
+	configs := make(map[string]*string, len(r.Entries))
+	for _, e := range r.Entries {
+		configs[e.Name] = e.Value
+	}
+	if err := p.ValidateAlterConfig(AlterConfigPolicyRequest{Topic: r.Name, Configs: policyConfigs(configs)}); err != nil {
+		return protocol.ErrPolicyViolation.WithErr(err)
+	}
+	return protocol.ErrNone
+}
+
+// policyConfigs returns the configs set in a request, without those reset to their defaults.
+func policyConfigs(configs map[string]*string) map[string]string {
+	out := make(map[string]string, len(configs))
+	for name, v := range configs {
+		if v != nil {
+			out[name] = *v
+		}
+	}
+	return out
+}
@@ -0,0 +1,92 @@
+package jocko
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/testutil/retry"
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestBroker_Policies(t *testing.T) {
+	s, dir := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+
+	var created CreateTopicPolicyRequest
+	s.broker().SetCreateTopicPolicy(CreateTopicPolicyFunc(func(req CreateTopicPolicyRequest) error {
+		created = req
+		if !strings.HasPrefix(req.Topic, "team.") {
+			return fmt.Errorf("topic %s must start with team.", req.Topic)
+		}
+		return nil
+	}))
+	s.broker().SetAlterConfigPolicy(AlterConfigPolicyFunc(func(req AlterConfigPolicyRequest) error {
+		if _, ok := req.Configs["retention.ms"]; ok {
+			return fmt.Errorf("retention.ms can't be set")
+		}
+		return nil
+	}))
+
+	conn, err := Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	create := func(topic string) *protocol.TopicErrorCode {
+		var code *protocol.TopicErrorCode
+		retry.Run(t, func(r *retry.R) {
+			res, err := conn.CreateTopics(&protocol.CreateTopicRequests{
+				APIVersion: 1,
+				Timeout:    time.Second,
+				Requests:   []*protocol.CreateTopicRequest{{Topic: topic, NumPartitions: 1, ReplicationFactor: 1, Configs: map[string]*string{"read.only": nil}}},
+			})
+			if err != nil {
+				r.Fatal(err)
+			}
+			code = res.TopicErrorCodes[0]
+			if code.ErrorCode == protocol.ErrNotController.Code() {
+				r.Fatalf("create topic error: %d", code.ErrorCode)
+			}
+		})
+		return code
+	}
+
+	code := create("unowned")
+	require.Equal(t, protocol.ErrPolicyViolation.Code(), code.ErrorCode)
+	require.Contains(t, *code.ErrorMessage, "must start with team.")
+	require.Equal(t, int32(1), created.NumPartitions)
+	require.Equal(t, map[string]string{}, created.Configs)
+	_, topic, err := s.broker().fsm.State().GetTopic("unowned")
+	require.NoError(t, err)
+	require.Nil(t, topic)
+
+	require.Equal(t, protocol.ErrNone.Code(), create("team.orders").ErrorCode)
+
+	value := "1000"
+	alter := func(name string) protocol.AlterConfigResourceResponse {
+		res, err := conn.AlterConfigs(&protocol.AlterConfigsRequest{
+			Resources: []protocol.AlterConfigsResource{{
+				Type:    protocol.TopicResourceType,
+				Name:    "team.orders",
+				Entries: []protocol.AlterConfigsEntry{{Name: name, Value: &value}},
+			}},
+		})
+		require.NoError(t, err)
+		return res.Resources[0]
+	}
+	altered := alter("retention.ms")
+	require.Equal(t, protocol.ErrPolicyViolation.Code(), altered.ErrorCode)
+	require.Contains(t, *altered.ErrorMessage, "retention.ms can't be set")
+	require.Equal(t, protocol.ErrNone.Code(), alter("segment.ms").ErrorCode)
+}
@@ -0,0 +1,360 @@
+package jocko
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/travisjeffery/jocko/jocko/structs"
+	"github.com/travisjeffery/jocko/log"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+// replicaMove describes moving a partition's replica from one broker to another.
+type replicaMove struct {
+	Partition structs.Partition
+	From      int32
+	To        int32
+}
+
+// populateBrokers is run by the controller each reconcile interval. It moves
+// replicas off the most loaded brokers and onto the least loaded ones so that
+// brokers added to the cluster take on load from existing topics rather than
+// only new ones. Moves are capped by AutoPopulateMaxMoves so reassignment is
+// rate limited by the reconcile interval.
+//
+// A move adds the new replica to the partition first and only drops the old
+// one on a later pass, once the new one has caught up with the leader, so the
+// partition never has fewer in sync replicas than it started with.
+func (b *Broker) populateBrokers() error {
+	b.RLock()
+	enabled, maxMoves := b.config.AutoPopulateNewBrokers, b.config.AutoPopulateMaxMoves
+	b.RUnlock()
+	if !enabled {
+		return nil
+	}
+
+	state := b.fsm.State()
+	_, nodes, err := state.GetNodes()
+	if err != nil {
+		return err
+	}
+	var passing []int32
+	for _, n := range nodes {
+		if canLead(n) {
+			passing = append(passing, n.Node)
+		}
+	}
+	_, all, err := state.GetPartitions()
+	if err != nil {
+		return err
+	}
+	if err := b.completePopulation(all); err != nil {
+		return err
+	}
+	// replicas of topics with placement constraints stay on the brokers they were placed on.
+	constrained := make(map[string]bool)
+	var partitions []*structs.Partition
+	for _, p := range all {
+		c, ok := constrained[p.Topic]
+		if !ok {
+			_, topic, err := state.GetTopic(p.Topic)
+			if err != nil {
+				return err
+			}
+			c = topic != nil && topic.Config.GetString(placementConstraintsConfig) != ""
+			constrained[p.Topic] = c
+		}
+		if !c {
+			partitions = append(partitions, p)
+		}
+	}
+
+	moves := planPopulation(partitions, passing, maxMoves)
+	if len(moves) == 0 {
+		return nil
+	}
+
+	var assigned []structs.Partition
+	for _, m := range moves {
+		log.Info.Printf("leader/%d: populate: moving replica: topic: %s, partition: %d, from: %d, to: %d", b.config.ID, m.Partition.Topic, m.Partition.ID, m.From, m.To)
+
+		ok, err := b.registerAssignment(m.Partition)
+		if err != nil {
+			return err
+		}
+		if ok {
+			assigned = append(assigned, m.Partition)
+		}
+	}
+
+	return b.sendPartitionStates(assigned)
+}
+
+// completePopulation finishes the moves started on earlier passes whose new replicas have caught
+// up with their leaders. The new replicas join the ISR, and the replicas they replace are dropped
+// from the partition and told to stop and delete their logs.
+func (b *Broker) completePopulation(partitions []*structs.Partition) error {
+	var done []structs.Partition
+	stop := make(map[int32][]*protocol.StopReplicaPartition)
+	for _, p := range partitions {
+		if len(p.Removing) == 0 {
+			continue
+		}
+		caughtUp, err := b.populationCaughtUp(p)
+		if err != nil {
+			log.Error.Printf("leader/%d: populate: check caught up error: topic: %s, partition: %d: %s", b.config.ID, p.Topic, p.ID, err)
+			continue
+		}
+		if !caughtUp {
+			continue
+		}
+		np := completeMove(*p)
+		ok, err := b.registerAssignment(np)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		log.Info.Printf("leader/%d: populate: moved replica: topic: %s, partition: %d, from: %v", b.config.ID, p.Topic, p.ID, p.Removing)
+		done = append(done, np)
+		for _, id := range p.Removing {
+			stop[id] = append(stop[id], &protocol.StopReplicaPartition{Topic: p.Topic, Partition: p.ID})
+		}
+	}
+
+	if err := b.sendPartitionStates(done); err != nil {
+		return err
+	}
+	for id, ps := range stop {
+		req := &protocol.StopReplicaRequest{
+			ControllerID:     b.config.ID,
+			DeletePartitions: true,
+			Partitions:       ps,
+		}
+		if err := b.sendStopReplica(id, req); err != nil {
+			log.Error.Printf("leader/%d: populate: stop replica on broker %d error: %s", b.config.ID, id, err)
+		}
+	}
+	return nil
+}
+
+// populationCaughtUp returns whether the replicas being added to the partition have caught up
+// with the log end offset its leader had when checked.
+func (b *Broker) populationCaughtUp(p *structs.Partition) (bool, error) {
+	leo, err := b.logEndOffset(p.Leader, p.Topic, p.ID)
+	if err != nil {
+		return false, err
+	}
+	for _, id := range p.AR {
+		if contains(p.ISR, id) || contains(p.Removing, id) {
+			continue
+		}
+		offset, err := b.logEndOffset(id, p.Topic, p.ID)
+		if err != nil {
+			return false, err
+		}
+		if offset < leo {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// logEndOffset returns the log end offset of the given broker's replica of the partition.
+func (b *Broker) logEndOffset(id int32, topic string, partition int32) (int64, error) {
+	req := &protocol.OffsetsRequest{
+		APIVersion: 1,
+		ReplicaID:  b.config.ID,
+		Topics: []*protocol.OffsetsTopic{{
+			Topic:      topic,
+			Partitions: []*protocol.OffsetsPartition{{Partition: partition, Timestamp: -1}},
+		}},
+	}
+	var res *protocol.OffsetsResponse
+	if id == b.config.ID {
+		res = b.handleOffsets(&Context{parent: context.Background(), header: &protocol.RequestHeader{}}, req)
+	} else {
+		var err error
+		if res, err = b.brokerClient(id).Offsets(req); err != nil {
+			return 0, err
+		}
+	}
+	if len(res.Responses) != 1 || len(res.Responses[0].PartitionResponses) != 1 {
+		return 0, fmt.Errorf("broker %d's offsets response has no partition", id)
+	}
+	pres := res.Responses[0].PartitionResponses[0]
+	if pres.ErrorCode != protocol.ErrNone.Code() {
+		return 0, protocol.Errs[pres.ErrorCode]
+	}
+	return pres.Offset, nil
+}
+
+// registerAssignment registers the partition's replicas with the cluster, returning false if
+// its topic's since been deleted. The partition and its topic's assignment are updated by one
+// command, applied on the topic as it is then, so they can't disagree and topic updates applied in
+// the meantime aren't overwritten.
+func (b *Broker) registerAssignment(p structs.Partition) (bool, error) {
+	out, err := b.raftApply(structs.AssignPartitionRequestType, structs.AssignPartitionRequest{Partition: p})
+	if err != nil {
+		return false, err
+	}
+	if applyErr, ok := out.(error); ok {
+		return false, applyErr
+	}
+	assigned, _ := out.(bool)
+	return assigned, nil
+}
+
+// sendPartitionStates sends the partitions' states to their replicas, each broker only told of
+// the partitions it's assigned.
+func (b *Broker) sendPartitionStates(partitions []structs.Partition) error {
+	reqs := make(map[int32]*protocol.LeaderAndISRRequest)
+	for _, p := range partitions {
+		for _, id := range p.AR {
+			req, ok := reqs[id]
+			if !ok {
+				req = &protocol.LeaderAndISRRequest{ControllerID: b.config.ID}
+				reqs[id] = req
+			}
+			req.PartitionStates = append(req.PartitionStates, &protocol.PartitionState{
+				Topic:       p.Topic,
+				Partition:   p.ID,
+				Leader:      p.Leader,
+				LeaderEpoch: p.LeaderEpoch,
+				ISR:         p.ISR,
+				Replicas:    p.AR,
+			})
+		}
+	}
+	for id, req := range reqs {
+		if err := b.sendLeaderAndISR(id, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendStopReplica sends the stop replica request to the given broker, handling it directly if
+// it's this broker.
+func (b *Broker) sendStopReplica(id int32, req *protocol.StopReplicaRequest) error {
+	if id == b.config.ID {
+		b.handleStopReplica(&Context{parent: context.Background(), header: &protocol.RequestHeader{}}, req)
+		return nil
+	}
+	_, err := b.brokerClient(id).StopReplica(req)
+	return err
+}
+
+// planPopulation returns up to max replica moves that even out the number of
+// replicas assigned to each of the given brokers. Only follower replicas are
+// moved so leaders keep serving while the new replica catches up. A move's
+// partition has the new replica added and the old one marked as removing;
+// partitions with moves in progress aren't moved again.
+func planPopulation(partitions []*structs.Partition, brokers []int32, max int) []replicaMove {
+	if len(brokers) < 2 || max <= 0 {
+		return nil
+	}
+
+	load := make(map[int32]int, len(brokers))
+	for _, id := range brokers {
+		load[id] = 0
+	}
+
+	// copy the partitions since the ones given may be owned by the state store.
+	ps := make([]structs.Partition, 0, len(partitions))
+	for _, p := range partitions {
+		cp := *p.Clone()
+		ps = append(ps, cp)
+		for _, r := range cp.AR {
+			if _, ok := load[r]; ok && !contains(cp.Removing, r) {
+				load[r]++
+			}
+		}
+	}
+	sort.Slice(ps, func(i, j int) bool {
+		if ps[i].Topic != ps[j].Topic {
+			return ps[i].Topic < ps[j].Topic
+		}
+		return ps[i].ID < ps[j].ID
+	})
+
+	ids := append([]int32(nil), brokers...)
+	moved := make(map[int]bool)
+	var moves []replicaMove
+
+	for len(moves) < max {
+		sort.Slice(ids, func(i, j int) bool {
+			if load[ids[i]] != load[ids[j]] {
+				return load[ids[i]] < load[ids[j]]
+			}
+			return ids[i] < ids[j]
+		})
+		to := ids[0]
+		found := false
+		for k := len(ids) - 1; k > 0 && !found; k-- {
+			from := ids[k]
+			if load[from]-load[to] <= 1 {
+				break
+			}
+			for i := range ps {
+				p := &ps[i]
+				if moved[i] || len(p.Removing) > 0 || p.Leader == from || !contains(p.AR, from) || contains(p.AR, to) {
+					continue
+				}
+				p.AR = append(p.AR, to)
+				p.Removing = []int32{from}
+				moved[i] = true
+				load[from]--
+				load[to]++
+				moves = append(moves, replicaMove{Partition: *p, From: from, To: to})
+				found = true
+				break
+			}
+		}
+		if !found {
+			break
+		}
+	}
+
+	return moves
+}
+
+// completeMove returns the partition with the replicas being added joined to the ISR and the
+// replicas they replace removed.
+func completeMove(p structs.Partition) structs.Partition {
+	np := *p.Clone()
+	for _, id := range p.AR {
+		if !contains(p.Removing, id) && !contains(np.ISR, id) {
+			np.ISR = append(np.ISR, id)
+		}
+	}
+	for _, id := range p.Removing {
+		np.AR = removeReplica(np.AR, id)
+		np.ISR = removeReplica(np.ISR, id)
+	}
+	np.Removing = nil
+	return np
+}
+
+func replaceReplica(rs []int32, old, new int32) []int32 {
+	out := make([]int32, len(rs))
+	for i, r := range rs {
+		if r == old {
+			r = new
+		}
+		out[i] = r
+	}
+	return out
+}
+
+func removeReplica(rs []int32, r int32) []int32 {
+	var out []int32
+	for _, ri := range rs {
+		if ri != r {
+			out = append(out, ri)
+		}
+	}
+	return out
+}
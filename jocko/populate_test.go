@@ -0,0 +1,164 @@
+package jocko
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/consul/testutil/retry"
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/jocko/structs"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestPlanPopulation(t *testing.T) {
+	var partitions []*structs.Partition
+	for i := int32(0); i < 6; i++ {
+		partitions = append(partitions, &structs.Partition{
+			Topic:  "test-topic",
+			ID:     i,
+			Leader: 1 + i%2,
+			AR:     []int32{1 + i%2, 2 - i%2},
+			ISR:    []int32{1 + i%2, 2 - i%2},
+		})
+	}
+
+	// broker 3 just joined and has no replicas.
+	moves := planPopulation(partitions, []int32{1, 2, 3}, 10)
+	require.Equal(t, 4, len(moves))
+
+	load := map[int32]int{}
+	for _, p := range partitions {
+		for _, r := range p.AR {
+			load[r]++
+		}
+	}
+	for _, m := range moves {
+		require.Equal(t, int32(3), m.To)
+		require.NotEqual(t, m.Partition.Leader, m.From)
+		// the new replica's added and the old one's kept in sync until it's caught up.
+		require.Contains(t, m.Partition.AR, int32(3))
+		require.NotContains(t, m.Partition.ISR, int32(3))
+		require.Contains(t, m.Partition.AR, m.From)
+		require.Contains(t, m.Partition.ISR, m.From)
+		require.Equal(t, []int32{m.From}, m.Partition.Removing)
+		load[m.From]--
+		load[m.To]++
+	}
+	require.Equal(t, map[int32]int{1: 4, 2: 4, 3: 4}, load)
+
+	// the state store's partitions aren't modified.
+	for _, p := range partitions {
+		require.NotContains(t, p.AR, int32(3))
+	}
+
+	// moves are capped.
+	require.Equal(t, 1, len(planPopulation(partitions, []int32{1, 2, 3}, 1)))
+
+	// balanced clusters are left alone.
+	require.Equal(t, 0, len(planPopulation(partitions, []int32{1, 2}, 10)))
+
+	// partitions with moves in progress aren't moved again and count as moved.
+	moving := append([]*structs.Partition(nil), partitions...)
+	for _, m := range moves {
+		p := m.Partition
+		moving[p.ID] = &p
+	}
+	require.Equal(t, 0, len(planPopulation(moving, []int32{1, 2, 3}, 10)))
+}
+
+func TestCompleteMove(t *testing.T) {
+	p := structs.Partition{
+		Topic:    "test-topic",
+		Leader:   1,
+		AR:       []int32{1, 2, 3},
+		ISR:      []int32{1, 2},
+		Removing: []int32{2},
+	}
+	np := completeMove(p)
+	require.Equal(t, []int32{1, 3}, np.AR)
+	require.Equal(t, []int32{1, 3}, np.ISR)
+	require.Nil(t, np.Removing)
+
+	// the given partition isn't modified.
+	require.Equal(t, []int32{1, 2, 3}, p.AR)
+	require.Equal(t, []int32{1, 2}, p.ISR)
+}
+
+func TestBroker_StopReplica(t *testing.T) {
+	s, dir := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+	b := s.handler.(*Broker)
+
+	conn, err := Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	CreateTopic(t, conn, "stop-topic", 1, 1)
+	var replica *Replica
+	retry.Run(t, func(r *retry.R) {
+		if replica, err = b.replicaLookup.Replica("stop-topic", 0); err != nil {
+			r.Fatal(err)
+		}
+	})
+	l := replica.Log
+	require.NotNil(t, l)
+
+	// the existing replica's updated rather than replaced.
+	res, err := conn.LeaderAndISR(&protocol.LeaderAndISRRequest{
+		ControllerID: b.config.ID,
+		PartitionStates: []*protocol.PartitionState{{
+			Topic:       "stop-topic",
+			Partition:   0,
+			Leader:      b.config.ID,
+			LeaderEpoch: replica.Partition.LeaderEpoch,
+			ISR:         []int32{b.config.ID},
+			Replicas:    []int32{b.config.ID, 100},
+		}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrNone.Code(), res.Partitions[0].ErrorCode)
+	r, err := b.replicaLookup.Replica("stop-topic", 0)
+	require.NoError(t, err)
+	require.True(t, r == replica)
+	require.True(t, replica.Log == l)
+	require.Equal(t, []int32{b.config.ID, 100}, replica.Partition.AR)
+
+	// brokers aren't given replicas of partitions they aren't assigned.
+	res, err = conn.LeaderAndISR(&protocol.LeaderAndISRRequest{
+		ControllerID: b.config.ID,
+		PartitionStates: []*protocol.PartitionState{{
+			Topic:     "other-topic",
+			Partition: 0,
+			Leader:    100,
+			ISR:       []int32{100},
+			Replicas:  []int32{100},
+		}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrReplicaNotAvailable.Code(), res.Partitions[0].ErrorCode)
+	_, err = b.replicaLookup.Replica("other-topic", 0)
+	require.Error(t, err)
+
+	stop, err := conn.StopReplica(&protocol.StopReplicaRequest{
+		ControllerID:     b.config.ID,
+		DeletePartitions: true,
+		Partitions:       []*protocol.StopReplicaPartition{{Topic: "stop-topic", Partition: 0}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrNone.Code(), stop.Partitions[0].ErrorCode)
+	_, err = b.replicaLookup.Replica("stop-topic", 0)
+	require.Error(t, err)
+	require.Nil(t, replica.Log)
+	_, err = os.Stat(filepath.Join(b.config.DataDir, "data", "stop-topic-0"))
+	require.True(t, os.IsNotExist(err))
+}
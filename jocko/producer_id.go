@@ -0,0 +1,56 @@
+package jocko
+
+import (
+	"github.com/travisjeffery/jocko/jocko/structs"
+	"github.com/travisjeffery/jocko/log"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+// handleInitProducerID allocates an idempotent producer its ID and epoch. They're allocated by
+// the controller through raft so they're unique across the cluster and survive its failover.
+// Brokers that aren't the controller forward the request to it. A transactional producer's
+// ongoing transaction is aborted before its epoch's bumped.
+func (b *Broker) handleInitProducerID(ctx *Context, req *protocol.InitProducerIDRequest) *protocol.InitProducerIDResponse {
+	sp := span(ctx, b.tracer, "init producer id")
+	defer sp.Finish()
+	res := &protocol.InitProducerIDResponse{APIVersion: req.Version(), ProducerID: -1, ProducerEpoch: -1}
+
+	if !b.isController() {
+		controller := b.brokerLookup.BrokerByAddr(b.raft.Leader())
+		if controller == nil {
+			res.ErrorCode = protocol.ErrCoordinatorNotAvailable.Code()
+			return res
+		}
+		fres, err := b.brokerClient(controller.ID.Int32()).InitProducerID(req)
+		if err != nil {
+			log.Error.Printf("broker/%d: init producer id error: forward to controller: %s", b.config.ID, err)
+			res.ErrorCode = protocol.ErrCoordinatorNotAvailable.Code()
+			return res
+		}
+		fres.APIVersion = req.Version()
+		return fres
+	}
+
+	var transactionalID string
+	if req.TransactionalID != nil {
+		transactionalID = *req.TransactionalID
+		if err := b.abortTxn(ctx, transactionalID); err != protocol.ErrNone {
+			res.ErrorCode = err.Code()
+			return res
+		}
+	}
+	out, err := b.raftApply(structs.InitProducerIDRequestType, structs.InitProducerIDRequest{TransactionalID: transactionalID})
+	if applyErr, ok := out.(error); ok {
+		err = applyErr
+	}
+	if err != nil {
+		log.Error.Printf("leader/%d: init producer id error: %s", b.config.ID, err)
+		res.ErrorCode = protocol.ErrUnknown.Code()
+		return res
+	}
+	p := out.(*structs.Producer)
+	log.Debug.Printf("leader/%d: init producer id: transactional id: %q, producer id: %d, producer epoch: %d", b.config.ID, transactionalID, p.ProducerID, p.ProducerEpoch)
+	res.ProducerID = p.ProducerID
+	res.ProducerEpoch = p.ProducerEpoch
+	return res
+}
@@ -0,0 +1,83 @@
+package jocko
+
+import (
+	"context"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestBroker_IdempotentProduce(t *testing.T) {
+	s, dir := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+
+	conn, err := Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	CreateTopic(t, conn, "idempotent", 1, 1)
+	WaitForTopicLeader(t, "idempotent", 0, s)
+
+	initProducer := func(transactionalID *string) *protocol.InitProducerIDResponse {
+		res, err := conn.InitProducerID(&protocol.InitProducerIDRequest{APIVersion: 1, TransactionalID: transactionalID, TransactionTimeout: time.Minute})
+		require.NoError(t, err)
+		require.Equal(t, protocol.ErrNone.Code(), res.ErrorCode)
+		return res
+	}
+	txnID := "txn"
+	txn := initProducer(&txnID)
+	bumped := initProducer(&txnID)
+	require.Equal(t, txn.ProducerID, bumped.ProducerID)
+	require.Equal(t, txn.ProducerEpoch+1, bumped.ProducerEpoch)
+	producer := initProducer(nil)
+	require.NotEqual(t, txn.ProducerID, producer.ProducerID)
+	require.True(t, producer.ProducerID > 0)
+
+	produce := func(firstSeq int32) *protocol.ProducePartitionResponse {
+		batch, err := protocol.Encode(&protocol.RecordBatch{
+			LastOffsetDelta: 1,
+			ProducerID:      producer.ProducerID,
+			ProducerEpoch:   producer.ProducerEpoch,
+			FirstSequence:   firstSeq,
+			Records:         []*protocol.Record{{Value: []byte("a")}, {OffsetDelta: 1, Value: []byte("b")}},
+		})
+		require.NoError(t, err)
+		res, err := conn.Produce(&protocol.ProduceRequest{
+			APIVersion: 3,
+			Timeout:    time.Second,
+			TopicData:  []*protocol.TopicData{{Topic: "idempotent", Data: []*protocol.Data{{Partition: 0, RecordSet: batch}}}},
+		})
+		require.NoError(t, err)
+		return res.Responses[0].PartitionResponses[0]
+	}
+	require.Equal(t, protocol.ErrNone.Code(), produce(0).ErrorCode)
+	// the retried batch isn't appended again.
+	require.Equal(t, protocol.ErrDuplicateSequenceNumber.Code(), produce(0).ErrorCode)
+	require.Equal(t, protocol.ErrOutOfOrderSequenceNumber.Code(), produce(4).ErrorCode)
+	pres := produce(2)
+	require.Equal(t, protocol.ErrNone.Code(), pres.ErrorCode)
+	require.Equal(t, int64(2), pres.BaseOffset)
+
+	// a reopened replica loads the sequences from its log.
+	replica, err := s.broker().replicaLookup.Replica("idempotent", 0)
+	require.NoError(t, err)
+	require.NoError(t, replica.Log.(io.Closer).Close())
+	replica.Log = nil
+	replica.sequences = nil
+	require.Equal(t, protocol.ErrNone, s.broker().startReplica(replica))
+	require.Equal(t, protocol.ErrDuplicateSequenceNumber.Code(), produce(2).ErrorCode)
+	pres = produce(4)
+	require.Equal(t, protocol.ErrNone.Code(), pres.ErrorCode)
+	require.Equal(t, int64(4), pres.BaseOffset)
+}
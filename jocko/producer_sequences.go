@@ -0,0 +1,216 @@
+package jocko
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sync"
+
+	"github.com/travisjeffery/jocko/log"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+// producerSequence is the last batch of an idempotent producer appended to a partition.
+type producerSequence struct {
+	epoch   int16
+	lastSeq int32
+}
+
+// producerSequences tracks the sequences idempotent producers have appended to a partition, to
+// detect the batches they retry that were already appended and the batches they skip.
+type producerSequences struct {
+	mu        sync.Mutex
+	producers map[int64]producerSequence
+}
+
+// sequenceError is a batch whose sequence doesn't follow its producer's last.
+type sequenceError struct {
+	ProducerID    int64
+	ProducerEpoch int16
+	// Expected is the sequence the producer's next batch should start at, -1 if the producer's
+	// epoch is stale.
+	Expected int32
+	FirstSeq int32
+	LastSeq  int32
+	Err      protocol.Error
+}
+
+// check returns an error if the batch's sequences don't follow its producer's last batch: a
+// duplicate sequence number if they were appended already, an out of order one if sequences were
+// skipped, or an invalid producer epoch if the producer's been fenced by a newer epoch. Producers
+// the partition hasn't seen, and those bumping their epoch, are accepted starting from any
+// sequence, since their state may have been lost with the broker's. The caller holds s.mu.
+func (s *producerSequences) check(producerID int64, epoch int16, firstSeq, lastSeq int32) *sequenceError {
+	last, ok := s.producers[producerID]
+	if !ok || epoch > last.epoch {
+		return nil
+	}
+	e := &sequenceError{ProducerID: producerID, ProducerEpoch: epoch, Expected: nextSequence(last.lastSeq), FirstSeq: firstSeq, LastSeq: lastSeq}
+	switch {
+	case epoch < last.epoch:
+		e.Expected = -1
+		e.Err = protocol.ErrInvalidProducerEpoch
+	case firstSeq == e.Expected:
+		return nil
+	case firstSeq <= last.lastSeq && lastSeq <= last.lastSeq:
+		e.Err = protocol.ErrDuplicateSequenceNumber
+	default:
+		e.Err = protocol.ErrOutOfOrderSequenceNumber
+	}
+	return e
+}
+
+// appended records the producer's batch was appended. The caller holds s.mu.
+func (s *producerSequences) appended(producerID int64, epoch int16, lastSeq int32) {
+	if s.producers == nil {
+		s.producers = make(map[int64]producerSequence)
+	}
+	s.producers[producerID] = producerSequence{epoch: epoch, lastSeq: lastSeq}
+}
+
+// appendBatch appends the producer's batch with fn if its sequences follow the producer's last
+// batch, and records it once it's appended. The sequences stay locked from the check until the
+// batch is recorded, so of the producer's batches produced concurrently, e.g. a retry racing the
+// timed out produce it's retrying, only one's appended.
+func (s *producerSequences) appendBatch(p protocol.BatchProducer, fn func() error) (*sequenceError, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e := s.check(p.ID, p.Epoch, p.FirstSequence, p.LastSequence); e != nil {
+		return e, nil
+	}
+	if err := fn(); err != nil {
+		return nil, err
+	}
+	s.appended(p.ID, p.Epoch, p.LastSequence)
+	return nil, nil
+}
+
+// record records the batch of the set appended to the partition if its producer's idempotent, as
+// followers append the sets they replicate so they have the sequences if they become leader.
+func (s *producerSequences) record(set []byte) {
+	p, ok := protocol.ProducerOf(set)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.appended(p.ID, p.Epoch, p.LastSequence)
+}
+
+// nextSequence returns the sequence after seq, which wraps around like Kafka's.
+func nextSequence(seq int32) int32 {
+	if seq == math.MaxInt32 {
+		return 0
+	}
+	return seq + 1
+}
+
+// load records the batches of the idempotent producers in the log, so the sequences survive
+// restarts.
+func (s *producerSequences) load(l CommitLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l.NewestOffset() == l.OldestOffset() {
+		return nil
+	}
+	r, err := l.NewReader(l.OldestOffset(), 0)
+	if err != nil {
+		return err
+	}
+	header := make([]byte, 12)
+	for {
+		// a set being appended while the log's read is cut off.
+		if _, err := io.ReadFull(r, header); err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		set := make([]byte, 12+int(protocol.Encoding.Uint32(header[8:])))
+		copy(set, header)
+		if _, err := io.ReadFull(r, set[12:]); err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if p, ok := protocol.ProducerOf(set); ok {
+			s.appended(p.ID, p.Epoch, p.LastSequence)
+		}
+	}
+}
+
+// loadProducerSequences loads the replica's idempotent producers' sequences from its log, unless
+// they were loaded already. It's called by startReplica as it opens the log, so produce requests
+// don't scan it. The sequences are kept up to date as batches are appended after that, whether the
+// replica leads or follows, and are kept while the replica's hibernated.
+func (r *Replica) loadProducerSequences() {
+	if r.sequences != nil || r.Log == nil {
+		return
+	}
+	s := new(producerSequences)
+	if err := s.load(r.Log); err != nil {
+		log.Error.Printf("replica: load producer sequences error: topic: %s, partition: %d: %s", r.Partition.Topic, r.Partition.ID, err)
+	}
+	r.sequences = s
+}
+
+// producerSequences returns the replica's idempotent producers' sequences.
+func (r *Replica) producerSequences() *producerSequences {
+	r.Lock()
+	defer r.Unlock()
+	if r.sequences == nil {
+		r.sequences = new(producerSequences)
+	}
+	return r.sequences
+}
+
+// appendRecords appends the produced record set to the replica's log and returns the offset it
+// was appended at. An idempotent producer's set must be a single batch whose sequences follow the
+// producer's last batch appended to the replica.
+func (b *Broker) appendRecords(topic string, partition int32, replica *Replica, recordSet []byte) (int64, protocol.Error) {
+	var offset int64
+	appendSet := func() (err error) {
+		offset, err = replica.Log.Append(recordSet)
+		return err
+	}
+	p, ok := protocol.ProducerOf(recordSet)
+	if !ok {
+		if err := appendSet(); err != nil {
+			log.Error.Printf("broker/%d: log append error: %s", b.config.ID, err)
+			return 0, protocol.ErrUnknown
+		}
+		return offset, protocol.ErrNone
+	}
+	if n := protocol.RecordBatchLen(recordSet); n != len(recordSet) {
+		return 0, protocol.ErrInvalidRecord.WithErr(fmt.Errorf("idempotent producer %d's record set isn't a single record batch", p.ID))
+	}
+	e, err := replica.producerSequences().appendBatch(p, appendSet)
+	if err != nil {
+		log.Error.Printf("broker/%d: log append error: %s", b.config.ID, err)
+		return 0, protocol.ErrUnknown
+	}
+	if e != nil {
+		b.trackSequenceError(topic, partition, e)
+		return 0, e.Err
+	}
+	return offset, protocol.ErrNone
+}
+
+// trackSequenceError logs the batch the partition rejected with the producer's ID, epoch, and
+// sequences, and counts it, so client retry bugs can be diagnosed from the broker.
+func (b *Broker) trackSequenceError(topic string, partition int32, e *sequenceError) {
+	log.Info.Printf("broker/%d: produce sequence error: topic: %s, partition: %d, producer id: %d, producer epoch: %d, expected sequence: %d, first sequence: %d, last sequence: %d: %s",
+		b.config.ID, topic, partition, e.ProducerID, e.ProducerEpoch, e.Expected, e.FirstSeq, e.LastSeq, e.Err)
+	if m := b.topicMetrics(); m != nil && m.ProduceSequenceErrors != nil {
+		m.ProduceSequenceErrors.With(append(b.metricLabels(topic, partition), "type", sequenceErrorType(e.Err))...).Add(1)
+	}
+}
+
+func sequenceErrorType(err protocol.Error) string {
+	switch err {
+	case protocol.ErrDuplicateSequenceNumber:
+		return "duplicate"
+	case protocol.ErrOutOfOrderSequenceNumber:
+		return "gap"
+	}
+	return "fenced"
+}
@@ -0,0 +1,83 @@
+package jocko
+
+import (
+	"io"
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestProducerSequences(t *testing.T) {
+	var s producerSequences
+	requireErr := func(e *sequenceError, err protocol.Error, expected int32) {
+		require.NotNil(t, e)
+		require.Equal(t, err, e.Err)
+		require.Equal(t, expected, e.Expected)
+	}
+
+	// an unknown producer starts from any sequence.
+	require.Nil(t, s.check(1, 0, 5, 9))
+	s.appended(1, 0, 9)
+	require.Nil(t, s.check(1, 0, 10, 14))
+
+	// a retry of a batch that was appended is a duplicate, one skipping sequences a gap.
+	requireErr(s.check(1, 0, 5, 9), protocol.ErrDuplicateSequenceNumber, 10)
+	requireErr(s.check(1, 0, 8, 9), protocol.ErrDuplicateSequenceNumber, 10)
+	requireErr(s.check(1, 0, 12, 14), protocol.ErrOutOfOrderSequenceNumber, 10)
+	requireErr(s.check(1, 0, 5, 14), protocol.ErrOutOfOrderSequenceNumber, 10)
+
+	// a newer epoch restarts the producer's sequences and fences older ones.
+	require.Nil(t, s.check(1, 1, 0, 3))
+	s.appended(1, 1, 3)
+	requireErr(s.check(1, 0, 10, 14), protocol.ErrInvalidProducerEpoch, -1)
+
+	// sequences wrap around.
+	s.appended(2, 0, math.MaxInt32)
+	require.Nil(t, s.check(2, 0, 0, 4))
+	require.Nil(t, s.check(3, 0, 0, 4))
+}
+
+func TestProducerSequences_AppendBatch(t *testing.T) {
+	var s producerSequences
+	p := protocol.BatchProducer{ID: 1, FirstSequence: 0, LastSequence: 4}
+
+	// of the producer's batches produced concurrently only one's appended, the others are
+	// duplicates.
+	var appended int32
+	var wg sync.WaitGroup
+	errs := make(chan *sequenceError, 10)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e, err := s.appendBatch(p, func() error {
+				atomic.AddInt32(&appended, 1)
+				return nil
+			})
+			require.NoError(t, err)
+			errs <- e
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	require.Equal(t, int32(1), appended)
+	var duplicates int
+	for e := range errs {
+		if e != nil {
+			require.Equal(t, protocol.ErrDuplicateSequenceNumber, e.Err)
+			duplicates++
+		}
+	}
+	require.Equal(t, cap(errs)-1, duplicates)
+
+	// a batch that fails to append isn't recorded.
+	p = protocol.BatchProducer{ID: 1, FirstSequence: 5, LastSequence: 9}
+	e, err := s.appendBatch(p, func() error { return io.ErrShortWrite })
+	require.Equal(t, io.ErrShortWrite, err)
+	require.Nil(t, e)
+	require.Nil(t, s.check(1, 0, 5, 9))
+}
@@ -0,0 +1,122 @@
+package jocko
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+// describeQuorumTimeout bounds how long the controller waits for the other servers' raft progress,
+// since it handles requests one at a time.
+const describeQuorumTimeout = 2 * time.Second
+
+// handleDescribeQuorum returns the status of the raft quorum: its leader, and how far each voter
+// and observer is behind the leader's log. Like topic creation it must be sent to the controller.
+func (b *Broker) handleDescribeQuorum(ctx *Context, req *protocol.DescribeQuorumRequest) *protocol.DescribeQuorumResponse {
+	sp := span(ctx, b.tracer, "describe quorum")
+	defer sp.Finish()
+	res := &protocol.DescribeQuorumResponse{}
+	res.APIVersion = req.Version()
+
+	if !b.isController() {
+		res.ErrorCode = protocol.ErrNotController.Code()
+		return res
+	}
+
+	future := b.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		res.ErrorCode = protocol.ErrUnknown.Code()
+		msg := err.Error()
+		res.ErrorMessage = &msg
+		return res
+	}
+	stats := b.raft.Stats()
+	res.LeaderID = b.config.ID
+	res.Term, _ = strconv.ParseInt(stats["term"], 10, 64)
+	res.CommitIndex, _ = strconv.ParseInt(stats["commit_index"], 10, 64)
+	lastIndex := int64(b.raft.LastIndex())
+
+	type progress struct {
+		i     int
+		index int64
+		err   error
+	}
+	servers := future.Configuration().Servers
+	replicas := make([]*protocol.QuorumReplica, len(servers))
+	progressCh := make(chan progress, len(servers))
+	var pending int
+	for i, s := range servers {
+		q := &protocol.QuorumReplica{LastIndex: -1, Lag: -1}
+		replicas[i] = q
+		id, err := strconv.ParseInt(string(s.ID), 10, 32)
+		if err != nil {
+			q.ReplicaID = -1
+			q.ErrorCode = protocol.ErrUnknown.Code()
+			continue
+		}
+		q.ReplicaID = int32(id)
+		if q.ReplicaID == b.config.ID {
+			q.LastIndex, q.Lag = lastIndex, 0
+			continue
+		}
+		pending++
+		go func(i int, id int32) {
+			index, err := b.raftLastIndex(id)
+			progressCh <- progress{i: i, index: index, err: err}
+		}(i, q.ReplicaID)
+	}
+
+	timer := b.clock.NewTimer(describeQuorumTimeout)
+	defer timer.Stop()
+	for pending > 0 {
+		select {
+		case p := <-progressCh:
+			pending--
+			q := replicas[p.i]
+			if p.err != nil {
+				q.ErrorCode = protocol.ErrBrokerNotAvailable.Code()
+				continue
+			}
+			q.LastIndex = p.index
+			if q.Lag = lastIndex - p.index; q.Lag < 0 {
+				q.Lag = 0
+			}
+		case <-timer.C():
+			for _, q := range replicas {
+				if q.LastIndex == -1 && q.ErrorCode == protocol.ErrNone.Code() {
+					q.ErrorCode = protocol.ErrRequestTimedOut.Code()
+				}
+			}
+			pending = 0
+		}
+	}
+
+	for i, s := range servers {
+		if s.Suffrage == raft.Voter {
+			res.Voters = append(res.Voters, replicas[i])
+		} else {
+			res.Observers = append(res.Observers, replicas[i])
+		}
+	}
+	return res
+}
+
+// raftLastIndex returns the index of the last entry in the broker's raft log.
+func (b *Broker) raftLastIndex(id int32) (int64, error) {
+	var index int64
+	err := b.brokerConns.do(id, "broker_health", func(conn *Conn) error {
+		res, err := conn.BrokerHealth(&protocol.BrokerHealthRequest{})
+		if err != nil {
+			return err
+		}
+		if res.ErrorCode != protocol.ErrNone.Code() {
+			return fmt.Errorf("broker %d: %s", id, protocol.Errs[res.ErrorCode])
+		}
+		index = res.RaftLastIndex
+		return nil
+	})
+	return index, err
+}
@@ -0,0 +1,148 @@
+package jocko
+
+import (
+	"sync"
+	"time"
+
+	"github.com/travisjeffery/jocko/jocko/structs"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+const (
+	consumerByteRateConfig   = "consumer.byte.rate"
+	producerByteRateConfig   = "producer.byte.rate"
+	producerRecordRateConfig = "producer.record.rate"
+	// quotaWindow is how long the amounts fetched or produced are sampled over before the window's
+	// reset.
+	quotaWindow = time.Second
+)
+
+// consumerByteRate returns the bytes per second each consumer, by client ID, may fetch from the
+// topic from a broker, or zero if the topic's unlimited.
+func consumerByteRate(t *structs.Topic) int64 {
+	return topicRate(t, consumerByteRateConfig)
+}
+
+// producerByteRate returns the bytes per second producers may append to the topic on a broker, or
+// zero if the topic's unlimited.
+func producerByteRate(t *structs.Topic) int64 {
+	return topicRate(t, producerByteRateConfig)
+}
+
+// producerRecordRate returns the records per second producers may append to the topic on a
+// broker, or zero if the topic's unlimited.
+func producerRecordRate(t *structs.Topic) int64 {
+	return topicRate(t, producerRecordRateConfig)
+}
+
+func topicRate(t *structs.Topic, name string) int64 {
+	if t == nil {
+		return 0
+	}
+	rate, ok := t.Config.GetInt(name)
+	if !ok || rate <= 0 {
+		return 0
+	}
+	return rate
+}
+
+// topicQuotas tracks an amount, e.g. the bytes a consumer fetches from a topic or the records
+// producers append to it, per key so a backfilling consumer or runaway producer can be throttled
+// before it starves the others sharing the broker. Fetch quotas are keyed by fetchQuotaKey so one
+// consumer's fetches don't throttle the others.
+type topicQuotas struct {
+	mu     sync.Mutex
+	topics map[string]*quotaSample
+}
+
+// fetchQuotaKey returns the key the consumer's fetches from the topic are tracked under.
+func fetchQuotaKey(clientID, topic string) string {
+	return clientID + "\x00" + topic
+}
+
+type quotaSample struct {
+	start  time.Time
+	amount int64
+}
+
+func newTopicQuotas() *topicQuotas {
+	return &topicQuotas{topics: make(map[string]*quotaSample)}
+}
+
+// throttle returns how long clients must wait before using the key's topic again to keep under
+// the rate, or zero if they're under it.
+func (q *topicQuotas) throttle(key string, rate int64, now time.Time) time.Duration {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s, ok := q.topics[key]
+	if !ok {
+		return 0
+	}
+	elapsed := now.Sub(s.start)
+	allowed := time.Duration(float64(s.amount) / float64(rate) * float64(time.Second))
+	if allowed > elapsed {
+		return allowed - elapsed
+	}
+	if elapsed >= quotaWindow {
+		delete(q.topics, key)
+	}
+	return 0
+}
+
+// record adds the amount clients used of the key's topic.
+func (q *topicQuotas) record(key string, amount int, now time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s, ok := q.topics[key]
+	if !ok {
+		s = &quotaSample{start: now}
+		q.topics[key] = s
+	}
+	s.amount += int64(amount)
+}
+
+// produceThrottle returns how long producers must wait before appending to the topic again to keep
+// under its byte and record rates, or zero if they're under them.
+func (b *Broker) produceThrottle(t *structs.Topic, now time.Time) time.Duration {
+	var throttle time.Duration
+	if rate := producerByteRate(t); rate > 0 {
+		throttle = b.produceByteQuotas.throttle(t.Topic, rate, now)
+	}
+	if rate := producerRecordRate(t); rate > 0 {
+		if d := b.produceRecordQuotas.throttle(t.Topic, rate, now); d > throttle {
+			throttle = d
+		}
+	}
+	return throttle
+}
+
+// recordProduce adds the record set appended to the topic to its produce quotas.
+func (b *Broker) recordProduce(t *structs.Topic, recordSet []byte, now time.Time) {
+	if producerByteRate(t) > 0 {
+		b.produceByteQuotas.record(t.Topic, len(recordSet), now)
+	}
+	if producerRecordRate(t) > 0 {
+		b.produceRecordQuotas.record(t.Topic, countRecords(recordSet), now)
+	}
+}
+
+// countRecords returns the number of records in the record set, counting what it can of a
+// corrupt one.
+func countRecords(recordSet []byte) int {
+	var n int
+	for len(recordSet) >= 12 {
+		size := 12 + int(protocol.Encoding.Uint32(recordSet[8:12]))
+		if size > len(recordSet) {
+			size = len(recordSet)
+		}
+		if count := protocol.RecordCount(recordSet[:size]); count >= 0 {
+			n += count
+		} else {
+			ms := new(protocol.MessageSet)
+			ms.Decode(protocol.NewDecoder(recordSet[:size]))
+			n += len(ms.Messages)
+		}
+		recordSet = recordSet[size:]
+	}
+	return n
+}
@@ -0,0 +1,64 @@
+package jocko
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/jocko/structs"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestFetchQuotas(t *testing.T) {
+	q := newTopicQuotas()
+	now := time.Now()
+	require.Equal(t, time.Duration(0), q.throttle("t", 100, now))
+
+	q.record("t", 50, now)
+	require.Equal(t, time.Duration(0), q.throttle("t", 100, now.Add(500*time.Millisecond)))
+
+	// 250 bytes at 100 bytes a second takes 2.5s, so 2s after the sample started there's 500ms left.
+	q.record("t", 200, now.Add(500*time.Millisecond))
+	require.Equal(t, 500*time.Millisecond, q.throttle("t", 100, now.Add(2*time.Second)))
+	require.Equal(t, time.Duration(0), q.throttle("other", 100, now.Add(2*time.Second)))
+
+	// the sample resets once the topic's back under its rate.
+	require.Equal(t, time.Duration(0), q.throttle("t", 100, now.Add(3*time.Second)))
+	q.record("t", 100, now.Add(3*time.Second))
+	require.Equal(t, time.Second, q.throttle("t", 100, now.Add(3*time.Second)))
+
+	// consumers' fetches from the topic are tracked separately.
+	q.record(fetchQuotaKey("a", "t"), 200, now)
+	require.Equal(t, time.Second, q.throttle(fetchQuotaKey("a", "t"), 100, now.Add(time.Second)))
+	require.Equal(t, time.Duration(0), q.throttle(fetchQuotaKey("b", "t"), 100, now.Add(time.Second)))
+}
+
+func TestProduceThrottle(t *testing.T) {
+	req := require.New(t)
+	b := &Broker{produceByteQuotas: newTopicQuotas(), produceRecordQuotas: newTopicQuotas()}
+	topic := &structs.Topic{Topic: "t", Config: structs.NewTopicConfig()}
+	set, err := protocol.Encode(&protocol.MessageSet{Messages: []*protocol.Message{
+		{Value: []byte("a")}, {Value: []byte("b")}, {Value: []byte("c")},
+	}})
+	req.NoError(err)
+	req.Equal(3, countRecords(set))
+	req.Equal(6, countRecords(append(set, set...)))
+
+	// unlimited topics aren't tracked.
+	now := time.Now()
+	b.recordProduce(topic, set, now)
+	req.Equal(time.Duration(0), b.produceThrottle(topic, now))
+
+	rate := "2"
+	req.NoError(topic.Config.SetValueFromString("producer.record.rate", &rate))
+	b.recordProduce(topic, set, now)
+	req.Equal(1500*time.Millisecond, b.produceThrottle(topic, now))
+
+	// the longer of the byte and record throttles applies.
+	bytes := strconv.Itoa(len(set))
+	req.NoError(topic.Config.SetValueFromString("producer.byte.rate", &bytes))
+	b.recordProduce(topic, set, now)
+	req.Equal(3*time.Second, b.produceThrottle(topic, now))
+	req.Equal(time.Duration(0), b.produceThrottle(topic, now.Add(3*time.Second)))
+}
@@ -0,0 +1,51 @@
+package jocko
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// Raft is the consensus the broker replicates the cluster's state with, satisfied by *raft.Raft.
+type Raft interface {
+	Apply(cmd []byte, timeout time.Duration) raft.ApplyFuture
+	Barrier(timeout time.Duration) raft.Future
+	AddVoter(id raft.ServerID, address raft.ServerAddress, prevIndex uint64, timeout time.Duration) raft.IndexFuture
+	AddNonvoter(id raft.ServerID, address raft.ServerAddress, prevIndex uint64, timeout time.Duration) raft.IndexFuture
+	RemoveServer(id raft.ServerID, prevIndex uint64, timeout time.Duration) raft.IndexFuture
+	BootstrapCluster(configuration raft.Configuration) raft.Future
+	GetConfiguration() raft.ConfigurationFuture
+	Leader() raft.ServerAddress
+	State() raft.RaftState
+	LastIndex() uint64
+	AppliedIndex() uint64
+	Stats() map[string]string
+	Shutdown() raft.Future
+}
+
+// tlsStreamLayer is the raft transport's stream layer secured with TLS, its connections accepted
+// on the TLS listener and dialed with the same config.
+type tlsStreamLayer struct {
+	net.Listener
+	config *tls.Config
+}
+
+// newTLSTransport returns a raft transport listening on the address, secured with the TLS config.
+func newTLSTransport(addr string, config *tls.Config, maxPool int, timeout time.Duration) (*raft.NetworkTransport, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if tcpAddr, ok := ln.Addr().(*net.TCPAddr); !ok || tcpAddr.IP.IsUnspecified() {
+		ln.Close()
+		return nil, fmt.Errorf("raft addr %s isn't advertisable", addr)
+	}
+	return raft.NewNetworkTransport(&tlsStreamLayer{Listener: tls.NewListener(ln, config), config: config}, maxPool, timeout, nil), nil
+}
+
+func (l *tlsStreamLayer) Dial(address raft.ServerAddress, timeout time.Duration) (net.Conn, error) {
+	return tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", string(address), l.config)
+}
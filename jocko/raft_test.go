@@ -0,0 +1,48 @@
+package jocko
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/jocko/structs"
+	"github.com/travisjeffery/jocko/mock"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestBroker_CreatePartition(t *testing.T) {
+	r := &mock.Raft{}
+	b := &Broker{config: &config.Config{ID: 1}, raft: r}
+	partition := structs.Partition{Topic: "test-topic", ID: 1, Partition: 1, Leader: 1, AR: []int32{1}, ISR: []int32{1}}
+
+	require.NoError(t, b.createPartition(partition))
+	applied := r.Applied()
+	require.Equal(t, 1, len(applied))
+	require.Equal(t, uint8(structs.RegisterPartitionRequestType), applied[0][0])
+	var req structs.RegisterPartitionRequest
+	require.NoError(t, structs.Decode(applied[0][1:], &req))
+	require.Equal(t, partition, req.Partition)
+
+	// losing leadership while the apply's in flight fails the create.
+	r.ApplyFunc = func(cmd []byte, timeout time.Duration) raft.ApplyFuture {
+		return &mock.Future{Err: raft.ErrNotLeader, Delay: 10 * time.Millisecond}
+	}
+	require.Equal(t, raft.ErrNotLeader, b.createPartition(partition))
+	require.Equal(t, 2, len(r.Applied()))
+}
+
+func TestBroker_JoinLANError(t *testing.T) {
+	s := &mock.Serf{}
+	b := &Broker{config: &config.Config{ID: 1}, serf: s}
+	require.Equal(t, protocol.ErrNone, b.JoinLAN("127.0.0.1:9093"))
+
+	s.JoinFunc = func(existing []string, ignoreOld bool) (int, error) {
+		return 0, errors.New("no route to host")
+	}
+	err := b.JoinLAN("127.0.0.1:9094", "127.0.0.1:9095")
+	require.Equal(t, protocol.ErrUnknown.Code(), err.Code())
+	require.Equal(t, [][]string{{"127.0.0.1:9093"}, {"127.0.0.1:9094", "127.0.0.1:9095"}}, s.Joined())
+}
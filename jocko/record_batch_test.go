@@ -0,0 +1,164 @@
+package jocko
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestBroker_RecordBatch(t *testing.T) {
+	s, dir := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+
+	conn, err := Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	CreateTopic(t, conn, "batches", 1, 1)
+	WaitForTopicLeader(t, "batches", 0, s)
+
+	produceWith := func(version int16, set []byte) *protocol.ProducePartitionResponse {
+		res, err := conn.Produce(&protocol.ProduceRequest{
+			APIVersion: version,
+			Timeout:    time.Second,
+			TopicData:  []*protocol.TopicData{{Topic: "batches", Data: []*protocol.Data{{Partition: 0, RecordSet: set}}}},
+		})
+		require.NoError(t, err)
+		return res.Responses[0].PartitionResponses[0]
+	}
+	produce := func(set []byte) *protocol.ProducePartitionResponse { return produceWith(2, set) }
+	batch, err := protocol.Encode(&protocol.RecordBatch{
+		Attributes:      int16(protocol.CompressionGZIP),
+		LastOffsetDelta: 2,
+		Records: []*protocol.Record{
+			{Key: []byte("a"), Value: []byte("1"), Headers: []*protocol.RecordHeader{{Key: []byte("h"), Value: []byte("v")}}},
+			{OffsetDelta: 1, Key: []byte("b"), Value: []byte("2")},
+			{OffsetDelta: 2, Key: []byte("c"), Value: []byte("3")},
+		},
+	})
+	require.NoError(t, err)
+	pres := produce(batch)
+	require.Equal(t, protocol.ErrNone.Code(), pres.ErrorCode)
+	require.Equal(t, int64(0), pres.BaseOffset)
+
+	// the batch took an offset per record.
+	legacy, err := protocol.Encode(&protocol.MessageSet{Messages: []*protocol.Message{{Value: []byte("4")}}})
+	require.NoError(t, err)
+	pres = produce(legacy)
+	require.Equal(t, protocol.ErrNone.Code(), pres.ErrorCode)
+	require.Equal(t, int64(3), pres.BaseOffset)
+
+	fetchWith := func(version int16, offset int64) *protocol.FetchPartitionResponse {
+		res, err := conn.Fetch(&protocol.FetchRequest{
+			APIVersion:  version,
+			MaxWaitTime: time.Second,
+			MinBytes:    1,
+			Topics: []*protocol.FetchTopic{{
+				Topic:      "batches",
+				Partitions: []*protocol.FetchPartition{{Partition: 0, FetchOffset: offset, CurrentLeaderEpoch: -1, MaxBytes: 1 << 20}},
+			}},
+		})
+		require.NoError(t, err)
+		return res.Responses[0].PartitionResponses[0]
+	}
+	fetch := func(offset int64) *protocol.FetchPartitionResponse { return fetchWith(5, offset) }
+	// fetching from the middle of the batch returns the whole batch.
+	fpres := fetch(1)
+	require.Equal(t, protocol.ErrNone.Code(), fpres.ErrorCode)
+	require.Equal(t, int64(3), fpres.HighWatermark)
+	require.True(t, protocol.IsRecordBatch(fpres.RecordSet))
+	fetched := new(protocol.RecordBatch)
+	require.NoError(t, fetched.Decode(protocol.NewDecoder(fpres.RecordSet)))
+	require.Equal(t, int64(0), fetched.FirstOffset)
+	require.Len(t, fetched.Records, 3)
+	require.Equal(t, []byte("v"), fetched.Records[0].Headers[0].Value)
+
+	records, err := protocol.DecodeRecords(fetch(3).RecordSet)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, []byte("4"), records[0].Value)
+
+	// a gzip wrapper's messages, given their own offsets by kafka's clients, share its offset.
+	var inner []byte
+	for i, v := range []string{"5", "6"} {
+		b, err := protocol.Encode(&protocol.MessageSet{Offset: int64(i), Messages: []*protocol.Message{{MagicByte: 1, Value: []byte(v)}}})
+		require.NoError(t, err)
+		inner = append(inner, b...)
+	}
+	compressed, err := protocol.Compress(protocol.CompressionGZIP, inner)
+	require.NoError(t, err)
+	wrapper, err := protocol.Encode(&protocol.MessageSet{Messages: []*protocol.Message{{MagicByte: 1, Attributes: int8(protocol.CompressionGZIP), Value: compressed}}})
+	require.NoError(t, err)
+	pres = produce(wrapper)
+	require.Equal(t, protocol.ErrNone.Code(), pres.ErrorCode)
+	require.Equal(t, int64(4), pres.BaseOffset)
+	fpres = fetch(4)
+	require.Equal(t, int64(4), fpres.HighWatermark)
+	ms := new(protocol.MessageSet)
+	require.NoError(t, ms.Decode(protocol.NewDecoder(fpres.RecordSet)))
+	require.Equal(t, int64(4), ms.Offset)
+	require.Equal(t, protocol.CompressionGZIP, ms.Messages[0].Codec())
+	b, err := protocol.Decompress(protocol.CompressionGZIP, ms.Messages[0].Value)
+	require.NoError(t, err)
+	for len(b) > 0 {
+		require.Equal(t, int64(0), int64(protocol.Encoding.Uint64(b)))
+		b = b[12+protocol.Encoding.Uint32(b[8:]):]
+	}
+	records, err = protocol.DecodeRecords(fpres.RecordSet)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.Equal(t, []byte("6"), records[1].Value)
+
+	for i, codec := range []protocol.CompressionCodec{protocol.CompressionSnappy, protocol.CompressionLZ4} {
+		batch, err := protocol.Encode(&protocol.RecordBatch{
+			Attributes: int16(codec),
+			Records:    []*protocol.Record{{Value: []byte(codec.String())}},
+		})
+		require.NoError(t, err)
+		pres = produce(batch)
+		require.Equal(t, protocol.ErrNone.Code(), pres.ErrorCode)
+		require.Equal(t, int64(5+i), pres.BaseOffset)
+		records, err = protocol.DecodeRecords(fetch(pres.BaseOffset).RecordSet)
+		require.NoError(t, err)
+		require.Equal(t, []byte(codec.String()), records[0].Value)
+	}
+
+	// zstd batches are produced from v7 and fetched from v10.
+	zstd, err := protocol.Encode(&protocol.RecordBatch{
+		Attributes: int16(protocol.CompressionZSTD),
+		Records:    []*protocol.Record{{Value: []byte("zstd")}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrUnsupportedCompressionType.Code(), produceWith(5, zstd).ErrorCode)
+	pres = produceWith(7, zstd)
+	require.Equal(t, protocol.ErrNone.Code(), pres.ErrorCode)
+	require.Equal(t, int64(7), pres.BaseOffset)
+	fpres = fetchWith(9, 7)
+	require.Equal(t, protocol.ErrUnsupportedCompressionType.Code(), fpres.ErrorCode)
+	require.Empty(t, fpres.RecordSet)
+	records, err = protocol.DecodeRecords(fetchWith(10, 7).RecordSet)
+	require.NoError(t, err)
+	require.Equal(t, []byte("zstd"), records[0].Value)
+	// the batches before it are still fetched with v9.
+	fpres = fetchWith(9, 6)
+	require.Equal(t, protocol.ErrNone.Code(), fpres.ErrorCode)
+	require.Equal(t, int64(6), protocol.LastOffset(fpres.RecordSet))
+
+	// zstd isn't for legacy message sets.
+	compressed, err = protocol.Compress(protocol.CompressionZSTD, inner)
+	require.NoError(t, err)
+	wrapper, err = protocol.Encode(&protocol.MessageSet{Messages: []*protocol.Message{{MagicByte: 1, Attributes: int8(protocol.CompressionZSTD), Value: compressed}}})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrUnsupportedCompressionType.Code(), produceWith(7, wrapper).ErrorCode)
+}
@@ -39,8 +39,25 @@ func (rl *replicaLookup) Replica(topic string, partition int32) (*Replica, error
 	return r, nil
 }
 
+// RemoveReplica removes the replica, unless it's since been replaced by another replica of its
+// partition.
 func (rl *replicaLookup) RemoveReplica(replica *Replica) {
 	rl.lock.Lock()
 	defer rl.lock.Unlock()
-	delete(rl.replica[replica.Partition.Topic], replica.Partition.ID)
+	if rl.replica[replica.Partition.Topic][replica.Partition.ID] == replica {
+		delete(rl.replica[replica.Partition.Topic], replica.Partition.ID)
+	}
+}
+
+// Replicas returns all of the replicas.
+func (rl *replicaLookup) Replicas() []*Replica {
+	rl.lock.RLock()
+	defer rl.lock.RUnlock()
+	var replicas []*Replica
+	for _, partitions := range rl.replica {
+		for _, r := range partitions {
+			replicas = append(replicas, r)
+		}
+	}
+	return replicas
 }
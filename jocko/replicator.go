@@ -1,9 +1,12 @@
 package jocko
 
 import (
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cenkalti/backoff"
+	"github.com/travisjeffery/jocko/clock"
 	"github.com/travisjeffery/jocko/log"
 	"github.com/travisjeffery/jocko/protocol"
 )
@@ -18,43 +21,144 @@ type client interface {
 
 // Replicator fetches from the partition's leader producing to itself the follower, thereby replicating the partition.
 type Replicator struct {
+	// offset is the next offset to fetch, the follower's log end offset once the fetched message
+	// sets are appended. It's accessed atomically, so is first to be 64-bit aligned.
+	offset int64
+	// buffered is the bytes of the fetched record sets held against the buffer budget until
+	// they're appended, accessed atomically.
+	buffered            int64
 	config              ReplicatorConfig
 	replica             *Replica
 	highwaterMarkOffset int64
-	offset              int64
 	msgs                chan []byte
 	done                chan struct{}
-	leader              client
-	backoff             *backoff.ExponentialBackOff
+	// stopped is closed when the replicator stops on a fatal error.
+	stopped  chan struct{}
+	stopOnce sync.Once
+	leader   client
+	backoff  *backoff.ExponentialBackOff
+
+	mu     sync.Mutex
+	status ReplicatorStatus
+	// lagging is set while the replica's lagged more than the config's LagWarnThreshold, so it's
+	// warned of once.
+	lagging bool
 }
 
 type ReplicatorConfig struct {
 	MinBytes int32
 	// todo: make this a time.Duration
 	MaxWaitTime time.Duration
+	// MinBackoff and MaxBackoff bound how long the replicator waits before retrying a failed
+	// fetch, doubling with each consecutive failure with jitter so followers of a failed leader
+	// don't retry in step.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Clock is what the replicator waits out its backoffs with and marks the replica used by.
+	Clock clock.Clock
+	// buffers is the broker's budget the fetched record sets are held against until they're
+	// appended, so a follower catching up can't run the broker out of memory.
+	buffers *bufferPool
+	// goroutines tracks the replicator's goroutines with the broker's.
+	goroutines *lifecycle
+	// LagWarnThreshold is how long the replica can go without catching up with its leader before
+	// a warning's logged. Zero disables the warnings.
+	LagWarnThreshold time.Duration
+}
+
+// ReplicatorStatus is the replicator's progress fetching from the leader.
+type ReplicatorStatus struct {
+	// Failures is the number of consecutive failed fetches.
+	Failures int
+	// Err is the error the last fetch failed with.
+	Err error
+	// Stopped is set when the replicator hit an error retrying won't fix, e.g. the follower's log
+	// diverged from the leader's, and stopped replicating.
+	Stopped bool
+	// Lag is the number of messages up to its leader's high watermark the replica hadn't fetched
+	// as of the last fetch.
+	Lag int64
+	// CaughtUp is when the replica last fetched up to its leader's high watermark.
+	CaughtUp time.Time
+}
+
+// LagTime returns how long the replica's gone without catching up with its leader, zero if it's
+// caught up.
+func (s ReplicatorStatus) LagTime(now time.Time) time.Duration {
+	if s.Lag == 0 && !s.Stuck() {
+		return 0
+	}
+	return now.Sub(s.CaughtUp)
+}
+
+// Stuck returns whether the replica isn't catching up with its leader: its replicator stopped or
+// has failed stuckReplicaFailures fetches in a row.
+func (s ReplicatorStatus) Stuck() bool {
+	return s.Stopped || s.Failures >= stuckReplicaFailures
 }
 
+const (
+	stuckReplicaFailures = 5
+	defaultMinBackoff    = 100 * time.Millisecond
+	defaultMaxBackoff    = 10 * time.Second
+)
+
 // NewReplicator returns a new replicator instance.
 func NewReplicator(config ReplicatorConfig, replica *Replica, leader client) *Replicator {
 	if config.MinBytes == 0 {
 		config.MinBytes = 1
 	}
+	if config.MinBackoff == 0 {
+		config.MinBackoff = defaultMinBackoff
+	}
+	if config.MaxBackoff == 0 {
+		config.MaxBackoff = defaultMaxBackoff
+	}
+	if config.Clock == nil {
+		config.Clock = clock.New()
+	}
 	bo := backoff.NewExponentialBackOff()
+	bo.InitialInterval = config.MinBackoff
+	bo.MaxInterval = config.MaxBackoff
+	// keep retrying, the default gives up after 15 minutes and returns backoff.Stop, which would
+	// have the replicator hot loop.
+	bo.MaxElapsedTime = 0
+	bo.Clock = config.Clock
+	bo.Reset()
 	r := &Replicator{
 		config:  config,
 		replica: replica,
 		leader:  leader,
 		done:    make(chan struct{}, 2),
+		stopped: make(chan struct{}),
 		msgs:    make(chan []byte, 2),
 		backoff: bo,
+		// the replica's assumed caught up until its first fetch says otherwise.
+		status: ReplicatorStatus{CaughtUp: config.Clock.Now()},
+	}
+	if replica.Log != nil {
+		r.offset = replica.Log.NewestOffset()
 	}
 	return r
 }
 
 // Replicate start fetching messages from the leader and appending them to the local commit log.
 func (r *Replicator) Replicate() {
-	go r.fetchMessages()
-	go r.appendMessages()
+	var wg sync.WaitGroup
+	wg.Add(2)
+	r.config.goroutines.goFunc("replicator", func() {
+		defer wg.Done()
+		r.fetchMessages()
+	})
+	r.config.goroutines.goFunc("replicator", func() {
+		defer wg.Done()
+		r.appendMessages()
+	})
+	go func() {
+		// release the record sets left unappended when the replicator closed or stopped.
+		wg.Wait()
+		r.config.buffers.release(atomic.SwapInt64(&r.buffered, 0))
+	}()
 }
 
 func (r *Replicator) fetchMessages() {
@@ -65,6 +169,8 @@ func (r *Replicator) fetchMessages() {
 		select {
 		case <-r.done:
 			return
+		case <-r.stopped:
+			return
 		default:
 			fetchRequest = &protocol.FetchRequest{
 				ReplicaID:   r.replica.BrokerID,
@@ -74,55 +180,232 @@ func (r *Replicator) fetchMessages() {
 					Topic: r.replica.Partition.Topic,
 					Partitions: []*protocol.FetchPartition{{
 						Partition:   r.replica.Partition.ID,
-						FetchOffset: r.offset,
+						FetchOffset: atomic.LoadInt64(&r.offset),
 					}},
 				}},
 			}
 			fetchResponse, err = r.leader.Fetch(fetchRequest)
-			// TODO: probably shouldn't panic. just let this replica fall out of ISR.
 			if err != nil {
-				log.Error.Printf("replicator: fetch messages error: %s", err)
-				goto BACKOFF
+				goto FAILED
 			}
 			for _, resp := range fetchResponse.Responses {
 				for _, p := range resp.PartitionResponses {
 					if p.ErrorCode != protocol.ErrNone.Code() {
-						log.Error.Printf("replicator: partition response error: %d", p.ErrorCode)
-						goto BACKOFF
+						err = protocol.Errs[p.ErrorCode]
+						goto FAILED
 					}
 					if p.RecordSet == nil {
-						goto BACKOFF
+						// caught up, the leader's waited MaxWaitTime for new messages.
+						r.fetched(p.HighWatermark, atomic.LoadInt64(&r.offset))
+						r.succeeded()
+						goto IDLE
 					}
-					offset := int64(protocol.Encoding.Uint64(p.RecordSet[:8]))
-					if offset > r.offset {
-						r.msgs <- p.RecordSet
-						r.highwaterMarkOffset = p.HighWatermark
-						r.offset = offset
+					next, ok := nextOffset(p.RecordSet)
+					if !ok {
+						// the response holds only part of a message set.
+						r.fetched(p.HighWatermark, atomic.LoadInt64(&r.offset))
+						goto IDLE
 					}
+					// the offset's reset if the appender hit a gap while this fetch was in flight,
+					// in which case the response is dropped.
+					if !atomic.CompareAndSwapInt64(&r.offset, fetchRequest.Topics[0].Partitions[0].FetchOffset, next) {
+						continue
+					}
+					// wait for the buffer budget, pushing back on the leader.
+					n := int64(len(p.RecordSet))
+					if !r.config.buffers.acquire(n, r.done) {
+						return
+					}
+					atomic.AddInt64(&r.buffered, n)
+					select {
+					case r.msgs <- p.RecordSet:
+					case <-r.done:
+						return
+					case <-r.stopped:
+						return
+					}
+					r.highwaterMarkOffset = p.HighWatermark
+					r.fetched(p.HighWatermark, next)
 				}
 			}
 
-			r.backoff.Reset()
+			r.succeeded()
 			continue
 
-		BACKOFF:
-			time.Sleep(r.backoff.NextBackOff())
+		FAILED:
+			if !retriable(err) {
+				r.stop(err)
+				return
+			}
+			r.failed(err)
+			r.config.Clock.Sleep(r.backoff.NextBackOff())
+			continue
+
+		IDLE:
+			if r.config.MaxWaitTime < r.config.MinBackoff {
+				r.config.Clock.Sleep(r.config.MinBackoff)
+			}
 		}
 	}
 }
 
+// retriable returns whether the fetch error is transient, e.g. the leader moved or the request
+// timed out. Connection errors are retriable too since the pool redials the leader.
+func retriable(err error) bool {
+	perr, ok := err.(protocol.Error)
+	if !ok {
+		return true
+	}
+	switch perr.Code() {
+	case protocol.ErrOffsetOutOfRange.Code(), protocol.ErrCorruptMessage.Code():
+		// the follower's log diverged from the leader's.
+		return false
+	}
+	return true
+}
+
+func (r *Replicator) succeeded() {
+	r.backoff.Reset()
+	r.mu.Lock()
+	r.status.Failures, r.status.Err = 0, nil
+	r.mu.Unlock()
+}
+
+func (r *Replicator) failed(err error) {
+	r.mu.Lock()
+	r.status.Failures++
+	r.status.Err = err
+	failures := r.status.Failures
+	r.mu.Unlock()
+	// log the first failure and then only when the replica becomes stuck to not flood the log
+	// while the leader's down.
+	if failures == 1 || failures == stuckReplicaFailures {
+		log.Error.Printf("replicator: %s/%d: fetch error: failures: %d: %s", r.replica.Partition.Topic, r.replica.Partition.ID, failures, err)
+	}
+	r.checkLag()
+}
+
+// fetched records the replica's lag behind the leader's high watermark once it's fetched up to
+// the offset. The leader's high watermark is the offset of its last message, so it's caught up
+// when the offset's past it.
+func (r *Replicator) fetched(highWatermark, offset int64) {
+	lag := highWatermark + 1 - offset
+	if lag < 0 {
+		lag = 0
+	}
+	r.mu.Lock()
+	r.status.Lag = lag
+	if lag == 0 {
+		r.status.CaughtUp = r.config.Clock.Now()
+	}
+	r.mu.Unlock()
+	r.checkLag()
+}
+
+// checkLag logs a warning when the replica's gone longer than the lag warn threshold without
+// catching up with its leader, and once it's caught up again.
+func (r *Replicator) checkLag() {
+	if r.config.LagWarnThreshold <= 0 {
+		return
+	}
+	r.mu.Lock()
+	status, lagTime := r.status, r.status.LagTime(r.config.Clock.Now())
+	warn := !r.lagging && lagTime > r.config.LagWarnThreshold
+	recovered := r.lagging && lagTime == 0
+	if warn || recovered {
+		r.lagging = warn
+	}
+	r.mu.Unlock()
+	if warn {
+		log.Error.Printf("replicator: %s/%d: lagging leader: messages: %d, time: %s, failures: %d", r.replica.Partition.Topic, r.replica.Partition.ID, status.Lag, lagTime, status.Failures)
+	} else if recovered {
+		log.Info.Printf("replicator: %s/%d: caught up with leader", r.replica.Partition.Topic, r.replica.Partition.ID)
+	}
+}
+
+// stop marks the replicator stopped on the fatal error.
+func (r *Replicator) stop(err error) {
+	r.mu.Lock()
+	r.status.Err = err
+	r.status.Stopped = true
+	r.mu.Unlock()
+	r.stopOnce.Do(func() { close(r.stopped) })
+	log.Error.Printf("replicator: %s/%d: stopped replicating: %s", r.replica.Partition.Topic, r.replica.Partition.ID, err)
+}
+
+// Status returns the replicator's progress.
+func (r *Replicator) Status() ReplicatorStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
 func (r *Replicator) appendMessages() {
 	for {
 		select {
 		case <-r.done:
 			return
 		case msg := <-r.msgs:
-			_, err := r.replica.Log.Append(msg)
+			err := r.appendRecordSet(msg)
+			n := int64(len(msg))
+			atomic.AddInt64(&r.buffered, -n)
+			r.config.buffers.release(n)
 			if err != nil {
-				panic(err)
+				r.stop(err)
+				return
 			}
+			r.replica.touch(r.config.Clock.Now())
+		}
+	}
+}
+
+// appendRecordSet appends the fetched message sets that continue the follower's log. Sets before
+// the log end offset were already appended by an earlier, duplicated fetch and are skipped. A set
+// past it means an earlier fetch was lost or reordered so the rest are dropped and the fetcher's
+// reset to re-fetch from the log end offset. Either way the follower's log stays a copy of the
+// leader's.
+func (r *Replicator) appendRecordSet(recordSet []byte) error {
+	const headerLen = 12 // offset and size
+	for len(recordSet) >= headerLen {
+		n := headerLen + int(protocol.Encoding.Uint32(recordSet[8:headerLen]))
+		if len(recordSet) < n {
+			// partial trailing message set, fetched again from the log end offset.
+			return nil
+		}
+		set := recordSet[:n]
+		recordSet = recordSet[n:]
+		offset, leo := int64(protocol.Encoding.Uint64(set[:8])), r.replica.Log.NewestOffset()
+		if offset < leo {
+			continue
+		}
+		if offset > leo {
+			log.Info.Printf("replicator: %s/%d: fetched offset %d past log end offset %d: re-fetching", r.replica.Partition.Topic, r.replica.Partition.ID, offset, leo)
+			atomic.StoreInt64(&r.offset, leo)
+			return nil
+		}
+		if _, err := r.replica.Log.Append(set); err != nil {
+			return err
+		}
+		r.replica.producerSequences().record(set)
+	}
+	return nil
+}
+
+// nextOffset returns the offset after the last record of the last whole message set or record
+// batch in the record set.
+func nextOffset(recordSet []byte) (int64, bool) {
+	const headerLen = 12 // offset and size
+	var next int64
+	var ok bool
+	for len(recordSet) >= headerLen {
+		n := headerLen + int(protocol.Encoding.Uint32(recordSet[8:headerLen]))
+		if len(recordSet) < n {
+			break
 		}
+		next, ok = protocol.LastOffset(recordSet[:n])+1, true
+		recordSet = recordSet[n:]
 	}
+	return next, ok
 }
 
 // Close the replicator object when we are no longer following
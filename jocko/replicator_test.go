@@ -2,8 +2,11 @@ package jocko_test
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -12,6 +15,7 @@ import (
 	"github.com/travisjeffery/jocko/jocko"
 	"github.com/travisjeffery/jocko/jocko/structs"
 	"github.com/travisjeffery/jocko/mock"
+	"github.com/travisjeffery/jocko/protocol"
 	"github.com/travisjeffery/jocko/testutil"
 )
 
@@ -52,6 +56,170 @@ func TestBroker_Replicate(t *testing.T) {
 	require.NoError(t, replicator.Close())
 }
 
+func TestReplicator_FetchErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		code    int16
+		stopped bool
+	}{
+		{name: "connection error", err: errors.New("connection refused")},
+		{name: "not leader", code: protocol.ErrNotLeaderForPartition.Code()},
+		{name: "log diverged", code: protocol.ErrOffsetOutOfRange.Code(), stopped: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var fetches int
+			leader := fetchFunc(func(req *protocol.FetchRequest) (*protocol.FetchResponse, error) {
+				mu.Lock()
+				fetches++
+				mu.Unlock()
+				if test.err != nil {
+					return nil, test.err
+				}
+				return &protocol.FetchResponse{
+					Responses: protocol.FetchTopicResponses{{
+						Topic:              req.Topics[0].Topic,
+						PartitionResponses: []*protocol.FetchPartitionResponse{{ErrorCode: test.code}},
+					}},
+				}, nil
+			})
+			replicator := jocko.NewReplicator(jocko.ReplicatorConfig{
+				MinBackoff: time.Millisecond,
+				MaxBackoff: 5 * time.Millisecond,
+			}, &jocko.Replica{Partition: structs.Partition{Topic: "test"}, Log: newCommitLog()}, leader)
+			replicator.Replicate()
+			defer replicator.Close()
+
+			testutil.WaitForResult(func() (bool, error) {
+				status := replicator.Status()
+				return status.Stuck(), fmt.Errorf("replicator not stuck: %+v", status)
+			}, func(err error) {
+				t.Fatalf("err: %v", err)
+			})
+			status := replicator.Status()
+			require.Equal(t, test.stopped, status.Stopped)
+			require.Error(t, status.Err)
+			if test.stopped {
+				// the replicator doesn't retry fatal errors.
+				time.Sleep(20 * time.Millisecond)
+				mu.Lock()
+				require.Equal(t, 1, fetches)
+				mu.Unlock()
+			}
+		})
+	}
+}
+
+func TestReplicator_IdempotentAppends(t *testing.T) {
+	const count = 6
+	var sets [][]byte
+	for i := 0; i < count; i++ {
+		set, err := protocol.Encode(&protocol.MessageSet{
+			Offset:   int64(i),
+			Messages: []*protocol.Message{{Value: []byte(fmt.Sprintf("msg %d", i))}},
+		})
+		require.NoError(t, err)
+		sets = append(sets, set)
+	}
+	var mu sync.Mutex
+	var fetches int
+	// the leader's responses are duplicated and reordered: the first skips ahead of the fetch
+	// offset and the rest repeat the set before it.
+	leader := fetchFunc(func(req *protocol.FetchRequest) (*protocol.FetchResponse, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		fetches++
+		offset := req.Topics[0].Partitions[0].FetchOffset
+		from, to := offset-1, offset+2
+		if fetches == 1 {
+			from, to = offset+1, offset+3
+		}
+		if from < 0 {
+			from = 0
+		}
+		if to > count {
+			to = count
+		}
+		var recordSet []byte
+		for _, set := range sets[from:to] {
+			recordSet = append(recordSet, set...)
+		}
+		return &protocol.FetchResponse{
+			Responses: protocol.FetchTopicResponses{{
+				Topic:              req.Topics[0].Topic,
+				PartitionResponses: []*protocol.FetchPartitionResponse{{RecordSet: recordSet}},
+			}},
+		}, nil
+	})
+	c := newCommitLog()
+	replicator := jocko.NewReplicator(jocko.ReplicatorConfig{
+		MinBackoff: time.Millisecond,
+	}, &jocko.Replica{Partition: structs.Partition{Topic: "test"}, Log: c}, leader)
+	replicator.Replicate()
+	defer replicator.Close()
+
+	testutil.WaitForResult(func() (bool, error) {
+		return len(c.Log()) >= count, fmt.Errorf("appended %d message sets", len(c.Log()))
+	}, func(err error) {
+		t.Fatalf("err: %v", err)
+	})
+	time.Sleep(20 * time.Millisecond)
+	require.Equal(t, sets, c.Log())
+}
+
+func TestReplicator_Lag(t *testing.T) {
+	var hw int64 = 9
+	leader := fetchFunc(func(req *protocol.FetchRequest) (*protocol.FetchResponse, error) {
+		return &protocol.FetchResponse{
+			Responses: protocol.FetchTopicResponses{{
+				Topic:              req.Topics[0].Topic,
+				PartitionResponses: []*protocol.FetchPartitionResponse{{HighWatermark: atomic.LoadInt64(&hw)}},
+			}},
+		}, nil
+	})
+	replicator := jocko.NewReplicator(jocko.ReplicatorConfig{
+		MinBackoff:       time.Millisecond,
+		LagWarnThreshold: 5 * time.Millisecond,
+	}, &jocko.Replica{Partition: structs.Partition{Topic: "test"}, Log: newCommitLog()}, leader)
+	replicator.Replicate()
+	defer replicator.Close()
+
+	// the leader's high watermark's ahead of the follower, which isn't fetching the records.
+	testutil.WaitForResult(func() (bool, error) {
+		status := replicator.Status()
+		return status.Lag == 10, fmt.Errorf("replicator lag: %d", status.Lag)
+	}, func(err error) {
+		t.Fatalf("err: %v", err)
+	})
+	time.Sleep(10 * time.Millisecond)
+	require.True(t, replicator.Status().LagTime(time.Now()) >= 10*time.Millisecond)
+
+	atomic.StoreInt64(&hw, -1)
+	testutil.WaitForResult(func() (bool, error) {
+		status := replicator.Status()
+		return status.Lag == 0, fmt.Errorf("replicator lag: %d", status.Lag)
+	}, func(err error) {
+		t.Fatalf("err: %v", err)
+	})
+	require.Equal(t, time.Duration(0), replicator.Status().LagTime(time.Now()))
+}
+
+type fetchFunc func(*protocol.FetchRequest) (*protocol.FetchResponse, error)
+
+func (f fetchFunc) Fetch(req *protocol.FetchRequest) (*protocol.FetchResponse, error) {
+	return f(req)
+}
+
+func (f fetchFunc) CreateTopics(*protocol.CreateTopicRequests) (*protocol.CreateTopicsResponse, error) {
+	return nil, nil
+}
+
+func (f fetchFunc) LeaderAndISR(*protocol.LeaderAndISRRequest) (*protocol.LeaderAndISRResponse, error) {
+	return nil, nil
+}
+
 type commitLog struct {
 	*mock.CommitLog
 	sync.RWMutex
@@ -86,7 +254,9 @@ func newCommitLog() *commitLog {
 		},
 
 		NewestOffsetFunc: func() int64 {
-			return 0
+			c.RLock()
+			defer c.RUnlock()
+			return int64(len(c.b))
 		},
 
 		OldestOffsetFunc: func() int64 {
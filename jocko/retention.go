@@ -0,0 +1,84 @@
+package jocko
+
+import (
+	"time"
+
+	"github.com/travisjeffery/jocko/jocko/structs"
+	"github.com/travisjeffery/jocko/log"
+)
+
+// retentionLog is implemented by commit logs whose retention can be changed while they're open.
+type retentionLog interface {
+	Retention() (bytes int64, age time.Duration)
+	SetRetention(bytes int64, age time.Duration)
+	EnforceRetention() (int64, error)
+}
+
+// topicRetention returns the bytes and age the topic's partitions' logs are retained by.
+func topicRetention(t *structs.Topic) (int64, time.Duration) {
+	bytes, ok := t.Config.GetInt("retention.bytes")
+	if !ok {
+		bytes = -1
+	}
+	ms, _ := t.Config.GetInt("retention.ms")
+	return bytes, time.Duration(ms) * time.Millisecond
+}
+
+// onTopicChange is the FSM's hook called after a topic's registered or deregistered.
+func (b *Broker) onTopicChange(topic string, deleted bool) {
+	// it's called while applying raft log entries so the segments are deleted, and the deleted
+	// topic's replicas removed, in the background.
+	if !deleted {
+		b.goroutines.goFunc("retention", func() { b.enforceRetention(topic) })
+	} else {
+		b.goroutines.goFunc("remove deleted replicas", func() { b.removeDeletedReplicas(topic) })
+	}
+	if b.config.OnTopicChange != nil {
+		b.config.OnTopicChange(topic, deleted)
+	}
+}
+
+// enforceRetention applies the topic's retention to the broker's replicas of it when it's changed,
+// deleting the segments past it now rather than when the logs next split so lowering a topic's
+// retention frees up a full disk right away. It returns the bytes reclaimed.
+func (b *Broker) enforceRetention(topic string) int64 {
+	_, t, err := b.fsm.State().GetTopic(topic)
+	if err != nil || t == nil {
+		return 0
+	}
+	bytes, age := topicRetention(t)
+	var total int64
+	for _, replica := range b.replicaLookup.Replicas() {
+		if replica.Partition.Topic != topic {
+			continue
+		}
+		reclaimed, err := b.enforceReplicaRetention(replica, bytes, age)
+		if err != nil {
+			log.Error.Printf("broker/%d: enforce retention error: topic: %s, partition: %d: %s", b.config.ID, topic, replica.Partition.ID, err)
+			continue
+		}
+		total += reclaimed
+		if m := b.topicMetrics(); m != nil && reclaimed > 0 {
+			m.RetentionReclaimedBytes.With(b.metricLabels(topic, replica.Partition.ID)...).Add(float64(reclaimed))
+		}
+	}
+	if total > 0 {
+		log.Info.Printf("broker/%d: enforced retention: topic: %s, retention bytes: %d, retention age: %s, reclaimed bytes: %d", b.config.ID, topic, bytes, age, total)
+	}
+	return total
+}
+
+func (b *Broker) enforceReplicaRetention(replica *Replica, bytes int64, age time.Duration) (int64, error) {
+	replica.Lock()
+	defer replica.Unlock()
+	// hibernated replicas pick up the retention when their logs are reopened.
+	l, ok := replica.Log.(retentionLog)
+	if !ok {
+		return 0, nil
+	}
+	if oldBytes, oldAge := l.Retention(); oldBytes == bytes && oldAge == age {
+		return 0, nil
+	}
+	l.SetRetention(bytes, age)
+	return l.EnforceRetention()
+}
@@ -0,0 +1,86 @@
+package jocko
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/testutil/retry"
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/commitlog"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestBroker_AlterConfigsRetention(t *testing.T) {
+	s, dir := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+
+	conn, err := Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	CreateTopic(t, conn, "retained", 1, 1)
+	WaitForTopicLeader(t, "retained", 0, s)
+
+	set, err := protocol.Encode(&protocol.MessageSet{Messages: []*protocol.Message{{Value: bytes.Repeat([]byte("v"), 400)}}})
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		res, err := conn.Produce(&protocol.ProduceRequest{
+			APIVersion: 2,
+			Timeout:    time.Second,
+			TopicData: []*protocol.TopicData{{
+				Topic: "retained",
+				Data:  []*protocol.Data{{Partition: 0, RecordSet: set}},
+			}},
+		})
+		require.NoError(t, err)
+		require.Equal(t, protocol.ErrNone.Code(), res.Responses[0].PartitionResponses[0].ErrorCode)
+	}
+	replica, err := s.broker().replicaLookup.Replica("retained", 0)
+	require.NoError(t, err)
+	l := replica.Log.(*commitlog.CommitLog)
+	before := l.Size()
+
+	retention := "1024"
+	res, err := conn.AlterConfigs(&protocol.AlterConfigsRequest{
+		Resources: []protocol.AlterConfigsResource{{
+			Type:    protocol.TopicResourceType,
+			Name:    "retained",
+			Entries: []protocol.AlterConfigsEntry{{Name: "retention.bytes", Value: &retention}},
+		}, {
+			Type:    protocol.TopicResourceType,
+			Name:    "missing",
+			Entries: []protocol.AlterConfigsEntry{{Name: "retention.bytes", Value: &retention}},
+		}, {
+			Type:    protocol.TopicResourceType,
+			Name:    "retained",
+			Entries: []protocol.AlterConfigsEntry{{Name: "unknown", Value: &retention}},
+		}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrNone.Code(), res.Resources[0].ErrorCode)
+	require.Equal(t, protocol.ErrUnknownTopicOrPartition.Code(), res.Resources[1].ErrorCode)
+	require.Equal(t, protocol.ErrInvalidConfig.Code(), res.Resources[2].ErrorCode)
+	require.NotNil(t, res.Resources[2].ErrorMessage)
+
+	// the segments past the lowered retention are deleted without waiting for another produce.
+	retry.Run(t, func(r *retry.R) {
+		if size := l.Size(); size > 1024+int64(len(set)) {
+			r.Fatalf("log size %d of %d bytes produced not reduced", size, before)
+		}
+	})
+	require.True(t, l.OldestOffset() > 0)
+	_, topic, err := s.broker().fsm.State().GetTopic("retained")
+	require.NoError(t, err)
+	got, _ := topic.Config.GetInt("retention.bytes")
+	require.Equal(t, int64(1024), got)
+}
@@ -0,0 +1,69 @@
+package jocko
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/serf/serf"
+	"github.com/travisjeffery/jocko/jocko/discover"
+	"github.com/travisjeffery/jocko/log"
+)
+
+// retryJoinLAN tries to join the retry join addresses, rediscovering them each attempt, with
+// exponential backoff until it joins one, another broker joins this one, the attempts run out, or
+// the broker shuts down.
+func (b *Broker) retryJoinLAN() {
+	providers := discover.Providers()
+	for name, p := range b.config.JoinProviders {
+		providers[name] = p
+	}
+	self := fmt.Sprintf("%s:%d", b.config.SerfLANConfig.MemberlistConfig.BindAddr, b.config.SerfLANConfig.MemberlistConfig.BindPort)
+	interval := b.config.RetryJoinInterval
+	for attempt := 1; ; attempt++ {
+		if b.joinedLAN() {
+			return
+		}
+		var addrs []string
+		for _, cfg := range b.config.RetryJoinLAN {
+			found, err := discover.Addrs(cfg, providers)
+			if err != nil {
+				log.Error.Printf("broker/%d: retry join: discover %q error: %s", b.config.ID, cfg, err)
+				continue
+			}
+			for _, addr := range found {
+				if addr != self {
+					addrs = append(addrs, addr)
+				}
+			}
+		}
+		if len(addrs) > 0 {
+			n, err := b.serf.Join(addrs, true)
+			if err == nil {
+				log.Info.Printf("broker/%d: retry join: joined %d of %v", b.config.ID, n, addrs)
+				return
+			}
+			log.Error.Printf("broker/%d: retry join: join %v error: %s", b.config.ID, addrs, err)
+		}
+		if max := b.config.RetryJoinMaxAttempts; max > 0 && attempt >= max {
+			log.Error.Printf("broker/%d: retry join: giving up after %d attempts", b.config.ID, attempt)
+			return
+		}
+		select {
+		case <-b.clock.After(interval):
+		case <-b.shutdownCh:
+			return
+		}
+		if interval *= 2; interval > b.config.RetryJoinMaxInterval {
+			interval = b.config.RetryJoinMaxInterval
+		}
+	}
+}
+
+// joinedLAN returns whether the broker's joined the LAN, seeing another live member.
+func (b *Broker) joinedLAN() bool {
+	for _, m := range b.serf.Members() {
+		if m.Name != b.config.NodeName && m.Status == serf.StatusAlive {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package jocko
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/testutil/retry"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/jocko/discover"
+	"github.com/travisjeffery/jocko/testutil"
+)
+
+func TestBroker_RetryJoin(t *testing.T) {
+	port := testutil.Ports(1)[0]
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	var discovered int32
+	s2, dir2 := NewTestServer(t, func(cfg *config.Config) {
+		cfg.BootstrapExpect = 2
+		cfg.OffsetsTopicReplicationFactor = 2
+		cfg.RetryJoinLAN = []string{"provider=test"}
+		cfg.RetryJoinInterval = 10 * time.Millisecond
+		cfg.RetryJoinMaxInterval = 50 * time.Millisecond
+		cfg.JoinProviders = map[string]discover.Provider{
+			"test": discover.ProviderFunc(func(map[string]string) ([]string, error) {
+				atomic.AddInt32(&discovered, 1)
+				return []string{addr}, nil
+			}),
+		}
+	}, nil)
+	defer os.RemoveAll(dir2)
+
+	// the broker keeps retrying until the one it discovers is up.
+	retry.Run(t, func(r *retry.R) {
+		if atomic.LoadInt32(&discovered) < 3 {
+			r.Fatal("join not retried")
+		}
+	})
+	s1, dir1 := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.OffsetsTopicReplicationFactor = 2
+		cfg.SerfLANConfig.MemberlistConfig.BindPort = port
+	}, nil)
+	defer os.RemoveAll(dir1)
+	defer s1.Shutdown()
+	retry.Run(t, func(r *retry.R) {
+		if n := len(s1.broker().LANMembers()); n != 2 {
+			r.Fatalf("got %d members, want 2", n)
+		}
+	})
+
+	n := atomic.LoadInt32(&discovered)
+	time.Sleep(100 * time.Millisecond)
+	if got := atomic.LoadInt32(&discovered); got != n {
+		t.Fatalf("discovered %d times after joining", got-n)
+	}
+	s2.Shutdown()
+	VerifyNoLeaks(t, s2)
+}
@@ -0,0 +1,66 @@
+package jocko
+
+import (
+	"github.com/travisjeffery/jocko/log"
+)
+
+const segmentCompressionConfig = "segment.compression"
+
+// segmentCompressor is implemented by commit logs that can recompress their sealed segments.
+type segmentCompressor interface {
+	CompressSegments() (int64, error)
+}
+
+// segmentCompressionLoop periodically recompresses the sealed segments of the local replicas of
+// topics with segment.compression set, trading CPU for disk on long retention topics. Fetches
+// decompress the segments they read.
+func (b *Broker) segmentCompressionLoop() {
+	ticker := b.clock.NewTicker(b.config.SegmentCompressionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+			b.compressSegments()
+		case <-b.shutdownCh:
+			return
+		}
+	}
+}
+
+// compressSegments recompresses the sealed segments of the local replicas whose topics are
+// compressed at rest and returns the bytes saved.
+func (b *Broker) compressSegments() int64 {
+	state := b.fsm.State()
+	var total int64
+	for _, replica := range b.replicaLookup.Replicas() {
+		if !replica.IsLocal {
+			continue
+		}
+		_, t, err := state.GetTopic(replica.Partition.Topic)
+		if err != nil || t == nil || t.Config.GetString(segmentCompressionConfig) != "gzip" {
+			continue
+		}
+		saved, err := b.compressReplicaSegments(replica)
+		if err != nil {
+			log.Error.Printf("broker/%d: compress segments error: topic: %s, partition: %d: %s", b.config.ID, replica.Partition.Topic, replica.Partition.ID, err)
+		}
+		if saved > 0 {
+			log.Info.Printf("broker/%d: compressed segments: topic: %s, partition: %d, saved bytes: %d", b.config.ID, replica.Partition.Topic, replica.Partition.ID, saved)
+		}
+		total += saved
+	}
+	return total
+}
+
+func (b *Broker) compressReplicaSegments(replica *Replica) (int64, error) {
+	replica.Lock()
+	// hibernated replicas are compressed once they're woken.
+	l, ok := replica.Log.(segmentCompressor)
+	replica.Unlock()
+	if !ok {
+		return 0, nil
+	}
+	// the replica's not locked while its segments are compressed so produces and fetches aren't
+	// held up, segments closed by its log being hibernated meanwhile are skipped.
+	return l.CompressSegments()
+}
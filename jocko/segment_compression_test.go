@@ -0,0 +1,78 @@
+package jocko
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestBroker_CompressSegments(t *testing.T) {
+	s, dir := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+		// the test compresses the segments itself.
+		cfg.SegmentCompressionInterval = 0
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+
+	conn, err := Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	gzip := "gzip"
+	CreateTopicWithConfigs(t, conn, "compressed", 1, 1, map[string]*string{"segment.compression": &gzip})
+	WaitForTopicLeader(t, "compressed", 0, s)
+
+	var values [][]byte
+	for i := 0; i < 10; i++ {
+		value := bytes.Repeat([]byte{'a' + byte(i)}, 400)
+		values = append(values, value)
+		set, err := protocol.Encode(&protocol.MessageSet{Messages: []*protocol.Message{{Value: value}}})
+		require.NoError(t, err)
+		res, err := conn.Produce(&protocol.ProduceRequest{
+			APIVersion: 2,
+			Timeout:    time.Second,
+			TopicData: []*protocol.TopicData{{
+				Topic: "compressed",
+				Data:  []*protocol.Data{{Partition: 0, RecordSet: set}},
+			}},
+		})
+		require.NoError(t, err)
+		require.Equal(t, protocol.ErrNone.Code(), res.Responses[0].PartitionResponses[0].ErrorCode)
+	}
+	require.True(t, s.broker().compressSegments() > 0)
+	require.Equal(t, int64(0), s.broker().compressSegments())
+
+	// fetches decompress the segments they read.
+	res, err := conn.Fetch(&protocol.FetchRequest{
+		MaxWaitTime: time.Second,
+		MinBytes:    1,
+		Topics: []*protocol.FetchTopic{{
+			Topic:      "compressed",
+			Partitions: []*protocol.FetchPartition{{Partition: 0, MaxBytes: 1 << 20}},
+		}},
+	})
+	require.NoError(t, err)
+	p := res.Responses[0].PartitionResponses[0]
+	require.Equal(t, protocol.ErrNone.Code(), p.ErrorCode)
+	var got [][]byte
+	for set := p.RecordSet; len(set) >= 12; {
+		n := 12 + int(protocol.Encoding.Uint32(set[8:12]))
+		ms := new(protocol.MessageSet)
+		require.NoError(t, ms.Decode(protocol.NewDecoder(set[:n])))
+		for _, m := range ms.Messages {
+			got = append(got, m.Value)
+		}
+		set = set[n:]
+	}
+	require.Equal(t, values, got)
+}
@@ -3,6 +3,7 @@ package jocko
 import (
 	"fmt"
 	"path/filepath"
+	"time"
 
 	"github.com/hashicorp/raft"
 	"github.com/hashicorp/serf/serf"
@@ -14,8 +15,20 @@ const (
 	// StatusReap is used to update the status of a node if we
 	// are handling a EventMemberReap
 	StatusReap = serf.MemberStatus(-1)
+	// reconcileEnqueueTimeout is how long a member event waits for room in the reconcile queue.
+	reconcileEnqueueTimeout = 5 * time.Second
 )
 
+// Serf is the gossip the broker discovers the cluster's members with, satisfied by *serf.Serf.
+type Serf interface {
+	Join(existing []string, ignoreOld bool) (int, error)
+	Leave() error
+	Members() []serf.Member
+	LocalMember() serf.Member
+	SetTags(tags map[string]string) error
+	Shutdown() error
+}
+
 func (b *Broker) setupSerf(config *serf.Config, ch chan serf.Event, path string) (*serf.Serf, error) {
 	config.Init()
 	config.NodeName = b.config.NodeName
@@ -29,12 +42,30 @@ func (b *Broker) setupSerf(config *serf.Config, ch chan serf.Event, path string)
 	if b.config.BootstrapExpect != 0 {
 		config.Tags["expect"] = fmt.Sprintf("%d", b.config.BootstrapExpect)
 	}
-	if b.config.NonVoter {
+	if b.config.IsNonVoter() {
 		config.Tags["non_voter"] = "1"
 	}
+	if b.config.IsObserver() {
+		config.Tags["observer"] = "1"
+	}
+	for k, v := range b.config.Tags {
+		config.Tags[metadata.TagPrefix+k] = v
+	}
+	config.Tags[metadata.VersionTag] = Version
+	config.Tags[metadata.FeaturesTag] = metadata.FeaturesTagValue(supportedFeatures)
 	config.Tags["raft_addr"] = b.config.RaftAddr
 	config.Tags["serf_lan_addr"] = fmt.Sprintf("%s:%d", b.config.SerfLANConfig.MemberlistConfig.BindAddr, b.config.SerfLANConfig.MemberlistConfig.BindPort)
-	config.Tags["broker_addr"] = b.config.Addr
+	config.Tags["broker_addr"] = b.config.AdvertisedAddr()
+	if b.config.InterBrokerAddr != "" {
+		config.Tags["inter_broker_addr"] = b.config.InterBrokerAddr
+	}
+	if b.config.SerfEncryptKey != "" {
+		key, err := b.config.SerfEncryptKeyBytes()
+		if err != nil {
+			return nil, err
+		}
+		config.MemberlistConfig.SecretKey = key
+	}
 	config.EventCh = ch
 	config.EnableNameConflictResolution = false
 	if !b.config.DevMode {
@@ -46,6 +77,39 @@ func (b *Broker) setupSerf(config *serf.Config, ch chan serf.Event, path string)
 	return serf.Create(config)
 }
 
+// checkDuplicateAddrs returns an error if another live broker advertises this broker's Kafka or
+// raft address, e.g. because its config was copied from this one's, so it refuses to start rather
+// than have clients and the raft leader mistake one broker for the other.
+func (b *Broker) checkDuplicateAddrs() error {
+	m, addr, ok := findDuplicateAddr(b.serf.Members(), b.config.NodeName, b.config.ID, b.config.AdvertisedAddr(), b.config.RaftAddr)
+	if !ok {
+		return nil
+	}
+	return fmt.Errorf("%s is already advertised by live member %s: each broker needs its own addresses", addr, m.Name)
+}
+
+// findDuplicateAddr returns the live broker other than the named one with the given ID advertising
+// the broker or raft address, and the duplicated address. Members with the same ID are the same
+// broker restarted under another name so aren't duplicates.
+func findDuplicateAddr(members []serf.Member, name string, id int32, brokerAddr, raftAddr string) (serf.Member, string, bool) {
+	for _, m := range members {
+		if m.Name == name || m.Status != serf.StatusAlive {
+			continue
+		}
+		meta, ok := metadata.IsBroker(m)
+		if !ok || meta.ID.Int32() == id {
+			continue
+		}
+		if meta.BrokerAddr == brokerAddr {
+			return m, fmt.Sprintf("broker address %s", brokerAddr), true
+		}
+		if meta.RaftAddr == raftAddr {
+			return m, fmt.Sprintf("raft address %s", raftAddr), true
+		}
+	}
+	return serf.Member{}, "", false
+}
+
 func (b *Broker) lanEventHandler() {
 	for {
 		select {
@@ -54,6 +118,8 @@ func (b *Broker) lanEventHandler() {
 			case serf.EventMemberJoin:
 				b.lanNodeJoin(e.(serf.MemberEvent))
 				b.localMemberEvent(e.(serf.MemberEvent))
+			case serf.EventMemberUpdate:
+				b.lanNodeUpdate(e.(serf.MemberEvent))
 			case serf.EventMemberReap:
 				b.localMemberEvent(e.(serf.MemberEvent))
 			case serf.EventMemberLeave, serf.EventMemberFailed:
@@ -82,6 +148,18 @@ func (b *Broker) lanNodeJoin(me serf.MemberEvent) {
 	}
 }
 
+// lanNodeUpdate is used to handle update events on the LAN pool, e.g. a broker reporting its disk
+// usage.
+func (b *Broker) lanNodeUpdate(me serf.MemberEvent) {
+	for _, m := range me.Members {
+		meta, ok := metadata.IsBroker(m)
+		if !ok {
+			continue
+		}
+		b.brokerLookup.AddBroker(meta)
+	}
+}
+
 func (b *Broker) lanNodeFailed(me serf.MemberEvent) {
 	for _, m := range me.Members {
 		meta, ok := metadata.IsBroker(m)
@@ -104,9 +182,14 @@ func (b *Broker) localMemberEvent(me serf.MemberEvent) {
 		if isReap {
 			m.Status = StatusReap
 		}
+		// block rather than drop the event while the controller catches up, which holds serf's
+		// events back in turn. The periodic reconcile picks up the member if it doesn't.
 		select {
 		case b.reconcileCh <- m:
-		default:
+		case <-b.clock.After(reconcileEnqueueTimeout):
+			log.Error.Printf("broker/%d: reconcile queue full, dropped member event: %s", b.config.ID, m.Name)
+		case <-b.shutdownCh:
+			return
 		}
 	}
 }
@@ -0,0 +1,93 @@
+package jocko
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/hashicorp/consul/testutil/retry"
+	"github.com/hashicorp/serf/serf"
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/mock"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestBroker_CheckDuplicateAddrs(t *testing.T) {
+	member := func(name, id, brokerAddr, raftAddr string, status serf.MemberStatus) serf.Member {
+		return serf.Member{Name: name, Status: status, Tags: map[string]string{
+			"role":        "jocko",
+			"id":          id,
+			"broker_addr": brokerAddr,
+			"raft_addr":   raftAddr,
+		}}
+	}
+	self := member("b1", "1", "10.0.0.1:9092", "10.0.0.1:9093", serf.StatusAlive)
+	tests := []struct {
+		name   string
+		member serf.Member
+		err    string
+	}{
+		{name: "distinct", member: member("b2", "2", "10.0.0.2:9092", "10.0.0.2:9093", serf.StatusAlive)},
+		{name: "broker addr", member: member("b2", "2", "10.0.0.1:9092", "10.0.0.2:9093", serf.StatusAlive), err: "broker address 10.0.0.1:9092 is already advertised by live member b2"},
+		{name: "raft addr", member: member("b2", "2", "10.0.0.2:9092", "10.0.0.1:9093", serf.StatusAlive), err: "raft address 10.0.0.1:9093 is already advertised by live member b2"},
+		// a broker that's been replaced at its address.
+		{name: "failed", member: member("b2", "2", "10.0.0.1:9092", "10.0.0.1:9093", serf.StatusFailed)},
+		// the same broker restarted under another node name.
+		{name: "same id", member: member("old-b1", "1", "10.0.0.1:9092", "10.0.0.1:9093", serf.StatusAlive)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &Broker{
+				config: &config.Config{ID: 1, NodeName: "b1", Addr: "10.0.0.1:9092", RaftAddr: "10.0.0.1:9093"},
+				serf: &mock.Serf{MembersFunc: func() []serf.Member {
+					return []serf.Member{self, tt.member}
+				}},
+			}
+			err := b.checkDuplicateAddrs()
+			if tt.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func TestBroker_AdvertiseAddr(t *testing.T) {
+	os.Setenv("JOCKO_TEST_HOST", "localhost")
+	defer os.Unsetenv("JOCKO_TEST_HOST")
+	var port string
+	s, dir := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+		_, port, _ = net.SplitHostPort(cfg.Addr)
+		cfg.AdvertiseAddr = "${JOCKO_TEST_HOST}:" + port
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+	WaitForLeader(t, s)
+
+	conn, err := Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	// clients are told the advertised address, not the one the broker binds.
+	retry.Run(t, func(r *retry.R) {
+		md, err := conn.Metadata(&protocol.MetadataRequest{})
+		if err != nil {
+			r.Fatal(err)
+		}
+		if len(md.Brokers) != 1 {
+			r.Fatalf("got %d brokers, want 1", len(md.Brokers))
+		}
+		if got, want := net.JoinHostPort(md.Brokers[0].Host, fmt.Sprint(md.Brokers[0].Port)), "localhost:"+port; got != want {
+			r.Fatalf("got broker addr %s, want %s", got, want)
+		}
+	})
+}
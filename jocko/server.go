@@ -2,11 +2,13 @@ package jocko
 
 import (
 	"context"
+	"crypto/tls"
 	"io"
 	"net"
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/davecgh/go-spew/spew"
 	opentracing "github.com/opentracing/opentracing-go"
@@ -21,6 +23,8 @@ var (
 	serverVerboseLogs    bool
 	requestQueueSpanKey  = contextKey("request queue span key")
 	responseQueueSpanKey = contextKey("response queue span key")
+	wireConnKey          = contextKey("wire conn key")
+	requestBytesKey      = contextKey("request bytes key")
 )
 
 func init() {
@@ -42,9 +46,17 @@ type Handler interface {
 // Server is used to handle the TCP connections, decode requests,
 // defer to the broker, and encode the responses.
 type Server struct {
-	config       *config.Config
-	protocolLn   *net.TCPListener
+	config     *config.Config
+	protocolLn net.Listener
+	certs      *certReloader
+	// peerLn is the inter-broker listener, secured with peerTLS if it's set.
+	peerLn       net.Listener
+	peerTLS      *tls.Config
+	peerCerts    *certReloader
+	wireFilter   *wireFilter
+	clientIDs    *clientIDFilter
 	handler      Handler
+	buffers      *bufferPool
 	shutdown     bool
 	shutdownCh   chan struct{}
 	shutdownLock sync.Mutex
@@ -65,6 +77,16 @@ func NewServer(config *config.Config, handler Handler, metrics *Metrics, tracer
 		responseCh: make(chan *Context, 1024),
 		tracer:     tracer,
 		close:      close,
+		wireFilter: newWireFilter(config),
+		clientIDs:  newClientIDFilter(config),
+	}
+	if h, ok := handler.(interface{ requestBuffers() *bufferPool }); ok {
+		s.buffers = h.requestBuffers()
+	}
+	if h, ok := handler.(interface {
+		peerTLSConfig() (*tls.Config, *certReloader)
+	}); ok {
+		s.peerTLS, s.peerCerts = h.peerTLSConfig()
 	}
 	return s
 }
@@ -75,42 +97,57 @@ func (s *Server) Start(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	if s.protocolLn, err = net.ListenTCP("tcp", protocolAddr); err != nil {
+	ln, err := net.ListenTCP("tcp", protocolAddr)
+	if err != nil {
 		return err
 	}
-
-	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				break
-			case <-s.shutdownCh:
-				break
-			default:
-				conn, err := s.protocolLn.Accept()
-				if err != nil {
-					log.Error.Printf("server/%d: listener accept error: %s", s.config.ID, err)
-					continue
-				}
-
-				go s.handleRequest(conn)
-			}
+	s.protocolLn = tcpListener{TCPListener: ln, opts: newTCPOptions(s.config)}
+	if s.config.WireCaptureDir != "" {
+		if err := os.MkdirAll(s.config.WireCaptureDir, 0755); err != nil {
+			s.protocolLn.Close()
+			return err
 		}
-	}()
+	}
+	if s.config.TLSCertFile != "" {
+		if s.certs, err = newCertReloader(s.config.TLSCertFile, s.config.TLSKeyFile); err != nil {
+			s.protocolLn.Close()
+			return err
+		}
+		tlsConfig, err := newClientTLSConfig(s.certs, s.config.TLSCAFile, s.config.TLSClientAuth)
+		if err != nil {
+			s.protocolLn.Close()
+			return err
+		}
+		s.protocolLn = tls.NewListener(s.protocolLn, tlsConfig)
+	}
+	if s.config.InterBrokerAddr != "" {
+		if s.peerLn, err = s.listenPeers(); err != nil {
+			s.protocolLn.Close()
+			return err
+		}
+		go s.serve(ctx, s.peerLn)
+	}
+
+	go s.serve(ctx, s.protocolLn)
 
 	go func() {
 		for {
 			select {
 			case <-ctx.Done():
-				break
+				return
 			case <-s.shutdownCh:
-				break
+				return
 			case respCtx := <-s.responseCh:
 				if queueSpan, ok := respCtx.Value(responseQueueSpanKey).(opentracing.Span); ok {
 					queueSpan.Finish()
 				}
 				if err := s.handleResponse(respCtx); err != nil {
 					log.Error.Printf("server/%d: handle response error: %s", s.config.ID, err)
+				} else if s.metrics != nil {
+					s.metrics.requestHandled()
+				}
+				if n, ok := respCtx.Value(requestBytesKey).(int64); ok {
+					s.buffers.release(n)
 				}
 			}
 		}
@@ -122,6 +159,58 @@ func (s *Server) Start(ctx context.Context) error {
 	return nil
 }
 
+// listenPeers listens on the inter-broker address, with the inter-broker TLS if it's configured.
+func (s *Server) listenPeers() (net.Listener, error) {
+	addr, err := net.ResolveTCPAddr("tcp", s.config.InterBrokerAddr)
+	if err != nil {
+		return nil, err
+	}
+	ln, err := net.ListenTCP("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	var peerLn net.Listener = tcpListener{TCPListener: ln, opts: newTCPOptions(s.config)}
+	if s.peerTLS != nil {
+		peerLn = tls.NewListener(peerLn, s.peerTLS)
+	}
+	return peerLn, nil
+}
+
+// serve accepts the listener's connections until the server's shut down.
+func (s *Server) serve(ctx context.Context, ln net.Listener) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.shutdownCh:
+			return
+		default:
+			conn, err := ln.Accept()
+			if err != nil {
+				log.Error.Printf("server/%d: listener accept error: %s", s.config.ID, err)
+				continue
+			}
+
+			go s.handleRequest(conn)
+		}
+	}
+}
+
+// ReloadTLS rereads the TLS certificate and key files, the client-facing and inter-broker ones.
+// Existing connections keep the certificate they were established with, new connections use the
+// reloaded one.
+func (s *Server) ReloadTLS() error {
+	if s.certs != nil {
+		if err := s.certs.Reload(); err != nil {
+			return err
+		}
+	}
+	if s.peerCerts != nil {
+		return s.peerCerts.Reload()
+	}
+	return nil
+}
+
 func (s *Server) Leave() error {
 	return s.handler.Leave()
 }
@@ -141,8 +230,15 @@ func (s *Server) Shutdown() error {
 	if err := s.handler.Shutdown(); err != nil {
 		return err
 	}
-	if err := s.protocolLn.Close(); err != nil {
-		return err
+	if s.protocolLn != nil {
+		if err := s.protocolLn.Close(); err != nil {
+			return err
+		}
+	}
+	if s.peerLn != nil {
+		if err := s.peerLn.Close(); err != nil {
+			return err
+		}
 	}
 
 	s.close()
@@ -152,13 +248,32 @@ func (s *Server) Shutdown() error {
 
 func (s *Server) handleRequest(conn net.Conn) {
 	defer conn.Close()
+	wire := s.newWireConn(conn)
+	if wire != nil {
+		defer wire.close()
+	}
+	// held is the bytes of the request being read, released if it's not handed to the handler.
+	var held int64
+	defer func() { s.buffers.release(held) }()
+
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if err := s.handshake(tlsConn); err != nil {
+			log.Error.Printf("server/%d: %s: tls handshake failed, closing conn: %s", s.config.ID, conn.RemoteAddr(), err)
+			return
+		}
+	}
 
 	for {
 		p := make([]byte, 4)
-		_, err := io.ReadFull(conn, p[:])
+		// the conn may idle until the request's first byte, the rest's read within the timeout.
+		_, err := io.ReadFull(conn, p[:1])
 		if err == io.EOF {
 			break
 		}
+		if err == nil {
+			s.setRequestReadDeadline(conn)
+			_, err = io.ReadFull(conn, p[1:])
+		}
 		if err != nil {
 			log.Error.Printf("conn read error: %s", err)
 			break
@@ -171,24 +286,47 @@ func (s *Server) handleRequest(conn net.Conn) {
 		if size == 0 {
 			break // TODO: should this even happen?
 		}
+		if size > uint32(s.config.SocketRequestMaxBytes) {
+			log.Error.Printf("server/%d: %s: request size %d larger than the max %d, closing conn", s.config.ID, conn.RemoteAddr(), size, s.config.SocketRequestMaxBytes)
+			span.LogKV("msg", "request too large", "size", size)
+			decodeSpan.Finish()
+			span.Finish()
+			break
+		}
+
+		// wait for the buffer budget before reading the request, pushing back on the client.
+		if !s.buffers.acquire(int64(size)+4, s.shutdownCh) {
+			decodeSpan.Finish()
+			span.Finish()
+			break
+		}
+		held = int64(size) + 4
 
 		b := make([]byte, size+4) //+4 since we're going to copy the size into b
 		copy(b, p)
 
-		if _, err = io.ReadFull(conn, b[4:]); err != nil {
-			// TODO: handle request
+		// the time waiting for the buffer budget isn't the client's.
+		s.setRequestReadDeadline(conn)
+		_, err = io.ReadFull(conn, b[4:])
+		conn.SetReadDeadline(time.Time{})
+		if err != nil {
+			// the client closed the conn mid request, e.g. a broker shutting down its pooled conns.
+			log.Error.Printf("conn read error: %s", err)
 			span.LogKV("msg", "failed to read from connection", "err", err)
+			decodeSpan.Finish()
 			span.Finish()
-			panic(err)
+			break
 		}
 
 		d := protocol.NewDecoder(b)
 		header := new(protocol.RequestHeader)
 		if err := header.Decode(d); err != nil {
-			// TODO: handle err
+			// the request can't be answered without its correlation id so close the conn like Kafka.
+			log.Error.Printf("server/%d: %s: decode header failed, closing conn: %s", s.config.ID, conn.RemoteAddr(), err)
 			span.LogKV("msg", "failed to decode header", "err", err)
+			decodeSpan.Finish()
 			span.Finish()
-			panic(err)
+			break
 		}
 
 		span.SetTag("api_key", header.APIKey)
@@ -198,65 +336,50 @@ func (s *Server) handleRequest(conn net.Conn) {
 		span.SetTag("node_id", s.config.ID) // can I set this globally for the tracer?
 		span.SetTag("addr", s.config.Addr)
 
-		var req protocol.VersionedDecoder
-
-		switch header.APIKey {
-		case protocol.ProduceKey:
-			req = &protocol.ProduceRequest{}
-		case protocol.FetchKey:
-			req = &protocol.FetchRequest{}
-		case protocol.OffsetsKey:
-			req = &protocol.OffsetsRequest{}
-		case protocol.MetadataKey:
-			req = &protocol.MetadataRequest{}
-		case protocol.LeaderAndISRKey:
-			req = &protocol.LeaderAndISRRequest{}
-		case protocol.StopReplicaKey:
-			req = &protocol.StopReplicaRequest{}
-		case protocol.UpdateMetadataKey:
-			req = &protocol.UpdateMetadataRequest{}
-		case protocol.ControlledShutdownKey:
-			req = &protocol.ControlledShutdownRequest{}
-		case protocol.OffsetCommitKey:
-			req = &protocol.OffsetCommitRequest{}
-		case protocol.OffsetFetchKey:
-			req = &protocol.OffsetFetchRequest{}
-		case protocol.FindCoordinatorKey:
-			req = &protocol.FindCoordinatorRequest{}
-		case protocol.JoinGroupKey:
-			req = &protocol.JoinGroupRequest{}
-		case protocol.HeartbeatKey:
-			req = &protocol.HeartbeatRequest{}
-		case protocol.LeaveGroupKey:
-			req = &protocol.LeaveGroupRequest{}
-		case protocol.SyncGroupKey:
-			req = &protocol.SyncGroupRequest{}
-		case protocol.DescribeGroupsKey:
-			req = &protocol.DescribeGroupsRequest{}
-		case protocol.ListGroupsKey:
-			req = &protocol.ListGroupsRequest{}
-		case protocol.SaslHandshakeKey:
-			req = &protocol.SaslHandshakeRequest{}
-		case protocol.APIVersionsKey:
-			req = &protocol.APIVersionsRequest{}
-		case protocol.CreateTopicsKey:
-			req = &protocol.CreateTopicRequests{}
-		case protocol.DeleteTopicsKey:
-			req = &protocol.DeleteTopicsRequest{}
+		h, ok := handlers[header.APIKey]
+		if !ok {
+			log.Error.Printf("server/%d: %s: unsupported api key, closing conn", s.config.ID, header)
+			span.LogKV("msg", "unsupported api key")
+			decodeSpan.Finish()
+			span.Finish()
+			break
 		}
 
-		if err := req.Decode(d, header.APIVersion); err != nil {
-			log.Error.Printf("server/%d: %s: decode request failed: %s", s.config.ID, header, err)
+		req := h.newRequest()
+		if !h.supports(header.APIVersion) {
+			if header.APIKey != protocol.APIVersionsKey {
+				log.Error.Printf("server/%d: %s: unsupported api version, closing conn", s.config.ID, header)
+				span.LogKV("msg", "unsupported api version")
+				decodeSpan.Finish()
+				span.Finish()
+				break
+			}
+			// answered with the supported versions, the body isn't decoded since its format's unknown.
+			req = &protocol.APIVersionsRequest{APIVersion: header.APIVersion}
+		} else if err := req.Decode(d, header.APIVersion); err != nil {
+			log.Error.Printf("server/%d: %s: decode request failed, closing conn: %s", s.config.ID, header, err)
 			span.LogKV("msg", "failed to decode request", "err", err)
+			decodeSpan.Finish()
 			span.Finish()
-			panic(err)
+			break
 		}
 
 		decodeSpan.Finish()
 
+		if s.clientIDs.denies(header.ClientID) {
+			s.refuse(conn, header, span)
+			break
+		}
+
 		ctx := opentracing.ContextWithSpan(context.Background(), span)
 		queueSpan := s.tracer.StartSpan("server: queue request", opentracing.ChildOf(span.Context()))
 		ctx = context.WithValue(ctx, requestQueueSpanKey, queueSpan)
+		if wire != nil && wire.request(header.ClientID, header.APIKey, header.APIVersion, header.CorrelationID, req, b) {
+			ctx = context.WithValue(ctx, wireConnKey, wire)
+		}
+		// the bytes are released once the request's answered.
+		ctx = context.WithValue(ctx, requestBytesKey, held)
+		held = 0
 
 		reqCtx := &Context{
 			parent: ctx,
@@ -271,6 +394,58 @@ func (s *Server) handleRequest(conn net.Conn) {
 	}
 }
 
+// refuse refuses the request of a denied client ID, its conn's closed after. API versions
+// requests, which clients usually send first, are answered with a cluster authorization error so
+// the client reports why.
+func (s *Server) refuse(conn net.Conn, header *protocol.RequestHeader, span opentracing.Span) {
+	log.Error.Printf("server/%d: %s: client id %q is denied, closing conn", s.config.ID, conn.RemoteAddr(), header.ClientID)
+	span.LogKV("msg", "client id denied")
+	if s.metrics != nil && s.metrics.DeniedClientRequests != nil {
+		clientID := header.ClientID
+		if len(s.config.MetricsClientIDs) != 0 && !containsString(s.config.MetricsClientIDs, clientID) {
+			clientID = otherClientsLabel
+		}
+		s.metrics.DeniedClientRequests.With("client_id", clientID).Add(1)
+	}
+	if header.APIKey != protocol.APIVersionsKey {
+		span.Finish()
+		return
+	}
+	version := header.APIVersion
+	if !handlers[protocol.APIVersionsKey].supports(version) {
+		version = 0
+	}
+	respCtx := &Context{
+		parent: opentracing.ContextWithSpan(context.Background(), span),
+		conn:   conn,
+		header: header,
+		res: &protocol.Response{
+			CorrelationID: header.CorrelationID,
+			Body:          &protocol.APIVersionsResponse{APIVersion: version, ErrorCode: protocol.ErrClusterAuthorizationFailed.Code()},
+		},
+	}
+	if err := s.handleResponse(respCtx); err != nil {
+		log.Error.Printf("server/%d: handle response error: %s", s.config.ID, err)
+	}
+}
+
+// handshake completes the conn's TLS handshake within the handshake timeout, rather than on its
+// first read which would wait on a half-open conn forever.
+func (s *Server) handshake(conn *tls.Conn) error {
+	if s.config.HandshakeTimeout > 0 {
+		conn.SetDeadline(time.Now().Add(s.config.HandshakeTimeout))
+		defer conn.SetDeadline(time.Time{})
+	}
+	return conn.Handshake()
+}
+
+// setRequestReadDeadline sets the deadline the conn must send the rest of its request by.
+func (s *Server) setRequestReadDeadline(conn net.Conn) {
+	if s.config.RequestReadTimeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(s.config.RequestReadTimeout))
+	}
+}
+
 func (s *Server) handleResponse(respCtx *Context) error {
 	psp := opentracing.SpanFromContext(respCtx)
 	sp := s.tracer.StartSpan("server: handle response", opentracing.ChildOf(psp.Context()))
@@ -280,11 +455,38 @@ func (s *Server) handleResponse(respCtx *Context) error {
 	defer psp.Finish()
 	defer sp.Finish()
 
-	b, err := protocol.Encode(respCtx.res.(protocol.Encoder))
+	wire, _ := respCtx.Value(wireConnKey).(*wireConn)
+
+	res, ok := respCtx.res.(*protocol.Response)
+	if !ok {
+		b, err := protocol.Encode(respCtx.res.(protocol.Encoder))
+		if err != nil {
+			return err
+		}
+		if wire != nil {
+			wire.response(respCtx.header.CorrelationID, respCtx.res, b)
+		}
+		_, err = respCtx.conn.Write(b)
+		return err
+	}
+
+	body, err := protocol.Encode(res.Body)
 	if err != nil {
 		return err
 	}
-	_, err = respCtx.conn.Write(b)
+	// write the size, correlation id, and body with one writev rather than copying them into one buffer.
+	header := make([]byte, 8, 9)
+	if protocol.IsFlexibleResponseHeader(respCtx.header.APIKey, respCtx.header.APIVersion) {
+		// flexible versions' headers end with their tagged fields, of which there are none.
+		header = append(header, 0)
+	}
+	protocol.Encoding.PutUint32(header, uint32(len(body)+len(header)-4))
+	protocol.Encoding.PutUint32(header[4:], uint32(res.CorrelationID))
+	if wire != nil {
+		wire.response(res.CorrelationID, res.Body, header, body)
+	}
+	bufs := net.Buffers{header, body}
+	_, err = bufs.WriteTo(respCtx.conn)
 	return err
 }
 
@@ -293,6 +495,14 @@ func (s *Server) Addr() net.Addr {
 	return s.protocolLn.Addr()
 }
 
+// InterBrokerAddr returns the address of the Server's inter-broker listener, nil if it has none.
+func (s *Server) InterBrokerAddr() net.Addr {
+	if s.peerLn == nil {
+		return nil
+	}
+	return s.peerLn.Addr()
+}
+
 func (s *Server) ID() int32 {
 	return s.config.ID
 }
@@ -3,6 +3,8 @@ package jocko_test
 import (
 	"bytes"
 	"context"
+	"io"
+	"net"
 	"os"
 	"testing"
 	"time"
@@ -326,6 +328,7 @@ func BenchmarkServer(b *testing.B) {
 		cfg.Bootstrap = true
 		cfg.BootstrapExpect = 1
 		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
 	}, nil)
 	defer os.RemoveAll(dir)
 	err := srv.Start(ctx)
@@ -415,3 +418,144 @@ func createTopic(t ti.T, s1 *jocko.Server, other ...*jocko.Server) error {
 func strPointer(v string) *string {
 	return &v
 }
+
+func TestServer_ClosesInvalidRequests(t *testing.T) {
+	s, dir := jocko.NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+		cfg.SocketRequestMaxBytes = 1024
+		// any request's bytes the server fails to release block the ones after it.
+		cfg.QueuedMaxRequestBytes = 1
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+
+	frame := func(apiKey int16, body ...byte) []byte {
+		b := make([]byte, 14, 14+len(body))
+		protocol.Encoding.PutUint32(b, uint32(10+len(body)))
+		protocol.Encoding.PutUint16(b[4:], uint16(apiKey))
+		protocol.Encoding.PutUint32(b[8:], 1)
+		return append(b, body...)
+	}
+	tests := map[string][]byte{
+		"unknown api key": frame(9999),
+		"unsupported api version": func() []byte {
+			b := frame(protocol.ProduceKey)
+			protocol.Encoding.PutUint16(b[6:], 99)
+			return b
+		}(),
+		"too large": {0, 0, 8, 0},
+		// a metadata request for 2^31-1 topics.
+		"invalid array length": frame(protocol.MetadataKey, 0x7f, 0xff, 0xff, 0xff),
+		"truncated header":     {0, 0, 0, 3, 0, 3, 0},
+	}
+	for name, b := range tests {
+		t.Run(name, func(t *testing.T) {
+			conn, err := net.Dial("tcp", s.Addr().String())
+			require.NoError(t, err)
+			defer conn.Close()
+			_, err = conn.Write(b)
+			require.NoError(t, err)
+			require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+			_, err = conn.Read(make([]byte, 1))
+			require.Equal(t, io.EOF, err)
+		})
+	}
+
+	// the server's still serving.
+	conn, err := jocko.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	for i := 0; i < 2; i++ {
+		_, err = conn.APIVersions(&protocol.APIVersionsRequest{})
+		require.NoError(t, err)
+	}
+}
+
+func TestServer_ClosesSlowConns(t *testing.T) {
+	s, dir := jocko.NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+		cfg.RequestReadTimeout = 100 * time.Millisecond
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+
+	tests := map[string][]byte{
+		"partial size": {0, 0},
+		"partial body": {0, 0, 0, 20, 0, 18, 0, 0},
+	}
+	for name, b := range tests {
+		t.Run(name, func(t *testing.T) {
+			conn, err := net.Dial("tcp", s.Addr().String())
+			require.NoError(t, err)
+			defer conn.Close()
+			_, err = conn.Write(b)
+			require.NoError(t, err)
+			require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+			_, err = conn.Read(make([]byte, 1))
+			require.Equal(t, io.EOF, err)
+		})
+	}
+
+	// conns idling between requests are kept.
+	conn, err := jocko.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	for i := 0; i < 2; i++ {
+		time.Sleep(300 * time.Millisecond)
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		_, err = conn.APIVersions(&protocol.APIVersionsRequest{})
+		require.NoError(t, err)
+	}
+}
+
+func TestServer_DeniedClientIDs(t *testing.T) {
+	s, dir := jocko.NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+		cfg.DeniedClientIDs = []string{"^$", "legacy-.*"}
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+
+	dial := func(clientID string) *jocko.Conn {
+		conn, err := jocko.NewDialer(clientID).Dial("tcp", s.Addr().String())
+		require.NoError(t, err)
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		return conn
+	}
+	for _, clientID := range []string{"", "legacy-app"} {
+		// api versions requests are answered with why, then the conn's closed.
+		conn := dial(clientID)
+		res, err := conn.APIVersions(&protocol.APIVersionsRequest{})
+		require.NoError(t, err)
+		require.Equal(t, protocol.ErrClusterAuthorizationFailed.Code(), res.ErrorCode)
+		_, err = conn.APIVersions(&protocol.APIVersionsRequest{})
+		require.Error(t, err)
+		conn.Close()
+
+		conn = dial(clientID)
+		_, err = conn.Metadata(&protocol.MetadataRequest{})
+		require.Error(t, err)
+		conn.Close()
+	}
+
+	conn := dial("app")
+	defer conn.Close()
+	res, err := conn.APIVersions(&protocol.APIVersionsRequest{})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrNone.Code(), res.ErrorCode)
+	_, err = conn.Metadata(&protocol.MetadataRequest{})
+	require.NoError(t, err)
+}
@@ -0,0 +1,119 @@
+package jocko
+
+import (
+	"sort"
+
+	"github.com/travisjeffery/jocko/jocko/structs"
+)
+
+// ClusterState is a snapshot of the cluster's state as seen by a broker. It's a copy, so it's safe
+// to read and change while the broker runs.
+type ClusterState struct {
+	// Controller is whether the broker is the cluster's controller.
+	Controller bool
+	Nodes      []*structs.Node
+	Topics     []*structs.Topic
+	Partitions []*structs.Partition
+	// Replicas are the broker's replicas.
+	Replicas []ReplicaState
+}
+
+// ReplicaState is a snapshot of one of a broker's replicas.
+type ReplicaState struct {
+	Partition structs.Partition
+	IsLocal   bool
+	// Open is whether the replica's log is open, it isn't before the replica's started or while
+	// it's hibernated.
+	Open bool
+	// Following is whether the replica is replicating from the partition's leader.
+	Following bool
+	// OldestOffset and NewestOffset are the offsets of the replica's log when it's open.
+	OldestOffset int64
+	NewestOffset int64
+}
+
+// Topics returns copies of the cluster's topics, sorted by name.
+func (b *Broker) Topics() ([]*structs.Topic, error) {
+	_, topics, err := b.fsm.State().GetTopics()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*structs.Topic, 0, len(topics))
+	for _, t := range topics {
+		res = append(res, t.Clone())
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Topic < res[j].Topic })
+	return res, nil
+}
+
+// Partition returns a copy of the topic's partition, or nil if it doesn't exist.
+func (b *Broker) Partition(topic string, id int32) (*structs.Partition, error) {
+	_, p, err := b.fsm.State().GetPartition(topic, id)
+	if err != nil || p == nil {
+		return nil, err
+	}
+	return p.Clone(), nil
+}
+
+// ClusterState returns a snapshot of the cluster's state and the broker's replicas.
+func (b *Broker) ClusterState() (*ClusterState, error) {
+	state := b.fsm.State()
+	_, nodes, err := state.GetNodes()
+	if err != nil {
+		return nil, err
+	}
+	topics, err := b.Topics()
+	if err != nil {
+		return nil, err
+	}
+	_, partitions, err := state.GetPartitions()
+	if err != nil {
+		return nil, err
+	}
+	cs := &ClusterState{
+		Controller: b.isController(),
+		Topics:     topics,
+		Replicas:   b.replicaStates(),
+	}
+	for _, n := range nodes {
+		cs.Nodes = append(cs.Nodes, n.Clone())
+	}
+	sort.Slice(cs.Nodes, func(i, j int) bool { return cs.Nodes[i].Node < cs.Nodes[j].Node })
+	for _, p := range partitions {
+		cs.Partitions = append(cs.Partitions, p.Clone())
+	}
+	sort.Slice(cs.Partitions, func(i, j int) bool { return partitionLess(cs.Partitions[i], cs.Partitions[j]) })
+	return cs, nil
+}
+
+// replicaStates returns snapshots of the broker's replicas, sorted by topic and partition.
+func (b *Broker) replicaStates() []ReplicaState {
+	// the broker's lock's held while the replicas' partitions change on leader and isr requests.
+	b.RLock()
+	defer b.RUnlock()
+	var states []ReplicaState
+	for _, replica := range b.replicaLookup.Replicas() {
+		replica.Lock()
+		l := replica.Log
+		rs := ReplicaState{
+			Partition: *replica.Partition.Clone(),
+			IsLocal:   replica.IsLocal,
+			Open:      l != nil,
+			Following: replica.Replicator != nil,
+		}
+		replica.Unlock()
+		if l != nil {
+			rs.OldestOffset, rs.NewestOffset = l.OldestOffset(), l.NewestOffset()
+		}
+		states = append(states, rs)
+	}
+	sort.Slice(states, func(i, j int) bool { return partitionLess(&states[i].Partition, &states[j].Partition) })
+	return states
+}
+
+func partitionLess(a, b *structs.Partition) bool {
+	if a.Topic != b.Topic {
+		return a.Topic < b.Topic
+	}
+	return a.ID < b.ID
+}
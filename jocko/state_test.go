@@ -0,0 +1,73 @@
+package jocko
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestBroker_ClusterState(t *testing.T) {
+	c := NewTestCluster(t, TestClusterOptions{Brokers: 1})
+	defer c.Shutdown()
+	s := c.Servers[0]
+	b := s.broker()
+
+	conn, err := Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	res, err := conn.CreateTopics(&protocol.CreateTopicRequests{
+		Timeout: 5 * time.Second,
+		Requests: []*protocol.CreateTopicRequest{
+			{Topic: "b", NumPartitions: 2, ReplicationFactor: 1},
+			{Topic: "a", NumPartitions: 1, ReplicationFactor: 1},
+		},
+	})
+	require.NoError(t, err)
+	for _, e := range res.TopicErrorCodes {
+		require.Equal(t, protocol.ErrNone.Code(), e.ErrorCode)
+	}
+	c.WaitForTopicLeader(t, "b", 1)
+
+	topics, err := b.Topics()
+	require.NoError(t, err)
+	var names []string
+	for _, topic := range topics {
+		names = append(names, topic.Topic)
+	}
+	require.Equal(t, []string{"a", "b"}, names)
+
+	p, err := b.Partition("b", 1)
+	require.NoError(t, err)
+	require.Equal(t, s.ID(), p.Leader)
+	require.Equal(t, []int32{s.ID()}, p.ISR)
+	p, err = b.Partition("b", 2)
+	require.NoError(t, err)
+	require.Nil(t, p)
+
+	// what's returned are copies, changing them doesn't change the broker's state.
+	topics[1].Partitions[0] = nil
+	p, _ = b.Partition("b", 1)
+	p.ISR[0] = -1
+	topics, err = b.Topics()
+	require.NoError(t, err)
+	require.Equal(t, []int32{s.ID()}, topics[1].Partitions[0])
+	p, _ = b.Partition("b", 1)
+	require.Equal(t, []int32{s.ID()}, p.ISR)
+
+	cs, err := b.ClusterState()
+	require.NoError(t, err)
+	require.True(t, cs.Controller)
+	require.Equal(t, 1, len(cs.Nodes))
+	require.Equal(t, s.ID(), cs.Nodes[0].Node)
+	require.Equal(t, topics, cs.Topics)
+	var replicas []string
+	for _, rs := range cs.Replicas {
+		replicas = append(replicas, rs.Partition.Topic)
+		require.True(t, rs.IsLocal)
+		require.False(t, rs.Following)
+	}
+	require.Equal(t, []string{"a", "b", "b"}, replicas)
+	require.Equal(t, len(cs.Partitions), len(cs.Replicas))
+}
@@ -0,0 +1,198 @@
+package jocko
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/travisjeffery/jocko/log"
+)
+
+const (
+	// StatsdFlushInterval is how often the statsd sink sends the metrics by default.
+	StatsdFlushInterval = 10 * time.Second
+	// statsdPacketBytes is the most bytes of metrics sent per UDP packet, so they aren't
+	// fragmented over the internet's common MTU.
+	statsdPacketBytes = 1432
+)
+
+// statsdReplacer replaces the characters statsd's line format reserves in label values.
+var statsdReplacer = strings.NewReplacer(".", "_", ":", "_", "|", "_", "@", "_", "\n", "_")
+
+// StatsdSink creates metrics sent to a statsd server over UDP, named in the jocko namespace.
+// Statsd metrics aren't labeled so the non-empty label values are appended to their names, e.g.
+// jocko.bytes_in_total.topic, and histograms, which observe seconds, are sent as timings in
+// milliseconds. Counters and timings are sent once per flush, gauges every flush once set.
+type StatsdSink struct {
+	conn net.Conn
+
+	mu       sync.Mutex
+	counters map[string]float64
+	gauges   map[string]float64
+	timings  map[string][]float64
+
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+// NewStatsdSink returns a sink sending the metrics to the statsd server at the address every
+// flush interval until it's closed.
+func NewStatsdSink(addr string, flushInterval time.Duration) (*StatsdSink, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &StatsdSink{
+		conn:     conn,
+		counters: make(map[string]float64),
+		gauges:   make(map[string]float64),
+		timings:  make(map[string][]float64),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go s.flushLoop(flushInterval)
+	return s, nil
+}
+
+func (s *StatsdSink) flushLoop(interval time.Duration) {
+	defer close(s.stopped)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.flush()
+		case <-s.done:
+			s.flush()
+			return
+		}
+	}
+}
+
+// flush sends the metrics observed since the last flush, and the gauges.
+func (s *StatsdSink) flush() {
+	var lines []string
+	s.mu.Lock()
+	for name, v := range s.counters {
+		lines = append(lines, fmt.Sprintf("%s:%g|c", name, v))
+	}
+	for name, v := range s.gauges {
+		lines = append(lines, fmt.Sprintf("%s:%g|g", name, v))
+	}
+	for name, vs := range s.timings {
+		for _, v := range vs {
+			lines = append(lines, fmt.Sprintf("%s:%g|ms", name, v))
+		}
+	}
+	s.counters = make(map[string]float64)
+	s.timings = make(map[string][]float64)
+	s.mu.Unlock()
+	sort.Strings(lines)
+
+	var packet bytes.Buffer
+	send := func() {
+		if packet.Len() == 0 {
+			return
+		}
+		if _, err := s.conn.Write(packet.Bytes()); err != nil {
+			log.Error.Printf("statsd: send metrics error: %s", err)
+		}
+		packet.Reset()
+	}
+	for _, l := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(l) > statsdPacketBytes {
+			send()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(l)
+	}
+	send()
+}
+
+// Close sends the metrics observed since the last flush and stops sending them.
+func (s *StatsdSink) Close() error {
+	s.closeOnce.Do(func() { close(s.done) })
+	<-s.stopped
+	return s.conn.Close()
+}
+
+func (s *StatsdSink) NewCounter(name, help string, labels []string) metrics.Counter {
+	return statsdCounter{sink: s, name: "jocko." + name}
+}
+
+func (s *StatsdSink) NewGauge(name, help string, labels []string) metrics.Gauge {
+	return statsdGauge{sink: s, name: "jocko." + name}
+}
+
+func (s *StatsdSink) NewHistogram(name, help string, labels []string) metrics.Histogram {
+	return statsdHistogram{sink: s, name: "jocko." + name}
+}
+
+// statsdName appends the non-empty values of the alternating label names and values to the name.
+func statsdName(name string, labelValues []string) string {
+	for i := 1; i < len(labelValues); i += 2 {
+		if v := labelValues[i]; v != "" {
+			name += "." + statsdReplacer.Replace(v)
+		}
+	}
+	return name
+}
+
+type statsdCounter struct {
+	sink *StatsdSink
+	name string
+}
+
+func (c statsdCounter) With(labelValues ...string) metrics.Counter {
+	return statsdCounter{sink: c.sink, name: statsdName(c.name, labelValues)}
+}
+
+func (c statsdCounter) Add(delta float64) {
+	c.sink.mu.Lock()
+	c.sink.counters[c.name] += delta
+	c.sink.mu.Unlock()
+}
+
+type statsdGauge struct {
+	sink *StatsdSink
+	name string
+}
+
+func (g statsdGauge) With(labelValues ...string) metrics.Gauge {
+	return statsdGauge{sink: g.sink, name: statsdName(g.name, labelValues)}
+}
+
+func (g statsdGauge) Set(value float64) {
+	g.sink.mu.Lock()
+	g.sink.gauges[g.name] = value
+	g.sink.mu.Unlock()
+}
+
+func (g statsdGauge) Add(delta float64) {
+	g.sink.mu.Lock()
+	g.sink.gauges[g.name] += delta
+	g.sink.mu.Unlock()
+}
+
+type statsdHistogram struct {
+	sink *StatsdSink
+	name string
+}
+
+func (h statsdHistogram) With(labelValues ...string) metrics.Histogram {
+	return statsdHistogram{sink: h.sink, name: statsdName(h.name, labelValues)}
+}
+
+func (h statsdHistogram) Observe(value float64) {
+	h.sink.mu.Lock()
+	h.sink.timings[h.name] = append(h.sink.timings[h.name], value*1000)
+	h.sink.mu.Unlock()
+}
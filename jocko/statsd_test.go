@@ -0,0 +1,43 @@
+package jocko
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsdSink(t *testing.T) {
+	req := require.New(t)
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	req.NoError(err)
+	defer pc.Close()
+
+	sink, err := NewStatsdSink(pc.LocalAddr().String(), time.Hour)
+	req.NoError(err)
+	m := NewMetrics(sink)
+	m.BytesIn.With("topic", "a.b", "partition", "").Add(3)
+	m.BytesIn.With("topic", "a.b", "partition", "").Add(4)
+	m.LogEndOffset.With("topic", "c", "partition", "1").Set(10)
+	m.InterBrokerRequestLatency.With("broker", "2", "api", "fetch").Observe(0.5)
+	// closing the sink sends the metrics observed since the last flush.
+	req.NoError(sink.Close())
+
+	var lines []string
+	buf := make([]byte, 1024)
+	req.NoError(pc.SetReadDeadline(time.Now().Add(5 * time.Second)))
+	for len(lines) < 3 {
+		n, _, err := pc.ReadFrom(buf)
+		req.NoError(err)
+		lines = append(lines, strings.Split(strings.TrimSpace(string(buf[:n])), "\n")...)
+	}
+	sort.Strings(lines)
+	req.Equal([]string{
+		"jocko.bytes_in_total.a_b:7|c",
+		"jocko.inter_broker_request_duration_seconds.2.fetch:500|ms",
+		"jocko.log_end_offset.c.1:10|g",
+	}, lines)
+}
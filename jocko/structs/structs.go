@@ -2,6 +2,7 @@ package structs
 
 import (
 	"bytes"
+	"fmt"
 
 	"github.com/ugorji/go/codec"
 )
@@ -16,8 +17,39 @@ const (
 	RegisterPartitionRequestType               = 4
 	DeregisterPartitionRequestType             = 5
 	RegisterGroupRequestType                   = 6
+	BatchNodesRequestType                      = 7
+	NodeMaintenanceRequestType                 = 8
+	UpdateFeaturesRequestType                  = 9
+	InitProducerIDRequestType                  = 10
+	AddTxnPartitionsRequestType                = 11
+	EndTxnRequestType                          = 12
+	AssignPartitionRequestType                 = 13
 )
 
+var messageTypeNames = map[MessageType]string{
+	RegisterNodeRequestType:        "register_node",
+	DeregisterNodeRequestType:      "deregister_node",
+	RegisterTopicRequestType:       "register_topic",
+	DeregisterTopicRequestType:     "deregister_topic",
+	RegisterPartitionRequestType:   "register_partition",
+	DeregisterPartitionRequestType: "deregister_partition",
+	RegisterGroupRequestType:       "register_group",
+	BatchNodesRequestType:          "batch_nodes",
+	NodeMaintenanceRequestType:     "node_maintenance",
+	UpdateFeaturesRequestType:      "update_features",
+	InitProducerIDRequestType:      "init_producer_id",
+	AddTxnPartitionsRequestType:    "add_txn_partitions",
+	EndTxnRequestType:              "end_txn",
+	AssignPartitionRequestType:     "assign_partition",
+}
+
+func (t MessageType) String() string {
+	if name, ok := messageTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", t)
+}
+
 type CheckID string
 
 const (
@@ -49,6 +81,49 @@ type DeregisterNodeRequest struct {
 	Node Node
 }
 
+// BatchNodesRequest registers and deregisters nodes together, e.g. the members that joined and
+// left in a burst of membership changes.
+type BatchNodesRequest struct {
+	Register   []Node
+	Deregister []Node
+}
+
+// NodeMaintenanceRequest puts the node into or takes it out of maintenance.
+type NodeMaintenanceRequest struct {
+	Node    int32
+	Enabled bool
+}
+
+// UpdateFeaturesRequest sets the finalized levels of the features, by name. Level 0 unfinalizes
+// the feature.
+type UpdateFeaturesRequest struct {
+	Levels map[string]int16
+}
+
+// InitProducerIDRequest allocates a producer ID, or bumps the epoch of the transactional ID's
+// producer. An empty transactional ID always gets a new producer ID.
+type InitProducerIDRequest struct {
+	TransactionalID string
+}
+
+// AddTxnPartitionsRequest adds the partitions the producer writes to, the groups whose offsets it
+// commits, and the offsets, to its ongoing transaction.
+type AddTxnPartitionsRequest struct {
+	TransactionalID string
+	ProducerID      int64
+	ProducerEpoch   int16
+	Partitions      []TxnPartition
+	Groups          []string
+	Offsets         []TxnOffset
+}
+
+// EndTxnRequest ends the producer's ongoing transaction once its markers are written.
+type EndTxnRequest struct {
+	TransactionalID string
+	ProducerID      int64
+	ProducerEpoch   int16
+}
+
 type RegisterTopicRequest struct {
 	Topic Topic
 }
@@ -65,6 +140,12 @@ type DeregisterPartitionRequest struct {
 	Partition Partition
 }
 
+// AssignPartitionRequest registers the partition and sets its replicas in its topic's assignment
+// together, so the topic's other updates aren't overwritten. It's ignored if the topic's deleted.
+type AssignPartitionRequest struct {
+	Partition Partition
+}
+
 // msgpackHandle is a shared handle for encoding/decoding of structs
 var msgpackHandle = &codec.MsgpackHandle{}
 
@@ -96,6 +177,75 @@ type Node struct {
 	RaftIndex
 }
 
+// NodeMaintenanceMeta is the node meta key set on nodes in maintenance, which lead no partitions
+// and aren't assigned new replicas.
+const NodeMaintenanceMeta = "maintenance"
+
+// InMaintenance returns whether the node is in maintenance.
+func (n *Node) InMaintenance() bool {
+	return n.Meta[NodeMaintenanceMeta] != ""
+}
+
+// Clone returns a deep copy of the node.
+func (n *Node) Clone() *Node {
+	c := *n
+	if n.Check != nil {
+		check := *n.Check
+		c.Check = &check
+	}
+	if n.Meta != nil {
+		c.Meta = make(map[string]string, len(n.Meta))
+		for k, v := range n.Meta {
+			c.Meta[k] = v
+		}
+	}
+	return &c
+}
+
+// Feature is a gated feature's finalized level: brokers use the feature at up to the level, and
+// brokers not supporting it can't join the cluster.
+type Feature struct {
+	Name  string
+	Level int16
+	RaftIndex
+}
+
+// Producer is the idempotent producer of a transactional ID. Each time it's initialized its epoch
+// is bumped, fencing off the batches of the producer's previous instances.
+type Producer struct {
+	TransactionalID string
+	ProducerID      int64
+	ProducerEpoch   int16
+	// Partitions and Groups are the partitions written to, and the groups whose offsets are
+	// committed, in the producer's ongoing transaction. They're empty if it's not in one.
+	Partitions []TxnPartition
+	Groups     []string
+	// Offsets are the groups' offsets committed in the transaction, committed to the groups'
+	// coordinators once it's committed.
+	Offsets []TxnOffset
+	RaftIndex
+}
+
+// InTxn returns whether the producer's in a transaction.
+func (p *Producer) InTxn() bool {
+	return len(p.Partitions) != 0 || len(p.Groups) != 0 || len(p.Offsets) != 0
+}
+
+// TxnPartition is a partition written to in a transaction.
+type TxnPartition struct {
+	Topic     string
+	Partition int32
+}
+
+// TxnOffset is a group's offset of a partition committed in a transaction.
+type TxnOffset struct {
+	Group     string
+	Topic     string
+	Partition int32
+	Offset    int64
+	Metadata  string
+}
+
 // NodeService is a service provided by a node
 type NodeService struct {
 	ID      string
@@ -118,8 +268,12 @@ type HealthCheck struct {
 
 // Topic
 type Topic struct {
-	// ID is ID or name of the topic
+	// ID is the topic's UUID. It's assigned when the topic's created and never changes, so a
+	// topic deleted and recreated with the same name has a different ID.
 	ID string
+	// CreateTimestamp is the unix time in milliseconds the topic was created. It's zero for
+	// topics created before it was recorded.
+	CreateTimestamp int64
 	// Topic is the name of the topic
 	Topic string
 	// Partitions is a map of partition IDs to slice of replicas IDs.
@@ -132,6 +286,19 @@ type Topic struct {
 	RaftIndex
 }
 
+// Clone returns a deep copy of the topic.
+func (t *Topic) Clone() *Topic {
+	c := *t
+	if t.Partitions != nil {
+		c.Partitions = make(map[int32][]int32, len(t.Partitions))
+		for id, replicas := range t.Partitions {
+			c.Partitions[id] = cloneIDs(replicas)
+		}
+	}
+	c.Config = t.Config.Clone()
+	return &c
+}
+
 // Partition
 type Partition struct {
 	// ID identifies the partition. Is here cause memdb wants the indexed field separate.
@@ -143,16 +310,37 @@ type Partition struct {
 	ISR []int32
 	// All assigned replicas
 	AR []int32
+	// Removing are the assigned replicas being moved off the partition. They're dropped from AR
+	// once the replicas added in their place have caught up and joined the ISR.
+	Removing []int32
 	// Leader is the ID of the leader replica
 	Leader int32
 	// ControllerEpoch is the epoch of the controller that last updated
 	// the leader and ISR info. TODO: this will probably have to change to fit better.
 	ControllerEpoch int32
-	LeaderEpoch     int32
+	// LeaderEpoch is incremented each time the partition's leader changes, so brokers and clients
+	// can tell their view of the partition is stale.
+	LeaderEpoch int32
 
 	RaftIndex
 }
 
+// Clone returns a deep copy of the partition.
+func (p *Partition) Clone() *Partition {
+	c := *p
+	c.ISR = cloneIDs(p.ISR)
+	c.AR = cloneIDs(p.AR)
+	c.Removing = cloneIDs(p.Removing)
+	return &c
+}
+
+func cloneIDs(ids []int32) []int32 {
+	if ids == nil {
+		return nil
+	}
+	return append(make([]int32, 0, len(ids)), ids...)
+}
+
 // Member
 type Member struct {
 	ID         string
@@ -19,6 +19,10 @@ func TestEncodeDecode(t *testing.T) {
 			function: testGroup,
 			name:     "group",
 		},
+		{
+			function: testTopicConfig,
+			name:     "topic config",
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, test.function)
@@ -71,3 +75,44 @@ func testGroup(t *testing.T) {
 		t.Fatal("in != out")
 	}
 }
+
+func testTopicConfig(t *testing.T) {
+	in := RegisterTopicRequest{
+		Topic: Topic{
+			Topic:  "test-topic",
+			Config: NewTopicConfig(),
+		},
+	}
+	enable, bytes := "true", "100"
+	if err := in.Topic.Config.SetValueFromString("dead.letter.queue.enable", &enable); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := in.Topic.Config.SetValueFromString("max.message.bytes", &bytes); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	invalid := "yes"
+	if err := in.Topic.Config.SetValueFromString("dead.letter.queue.enable", &invalid); err == nil {
+		t.Fatal("expected invalid value err")
+	}
+	if err := in.Topic.Config.SetValueFromString("unknown", &invalid); err == nil {
+		t.Fatal("expected unknown config err")
+	}
+	b, err := Encode(RegisterTopicRequestType, &in)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var out RegisterTopicRequest
+	err = Decode(b[1:], &out)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if v := out.Topic.Config.GetString("dead.letter.queue.enable"); v != "true" {
+		t.Fatalf("dead.letter.queue.enable = %q", v)
+	}
+	if v, ok := out.Topic.Config.GetInt("max.message.bytes"); !ok || v != 100 {
+		t.Fatalf("max.message.bytes = %d", v)
+	}
+	if v, ok := out.Topic.Config.GetInt("retention.ms"); !ok || v != 604800000 {
+		t.Fatalf("retention.ms = %d", v)
+	}
+}
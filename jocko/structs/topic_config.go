@@ -1,5 +1,10 @@
 package structs
 
+import (
+	"fmt"
+	"strconv"
+)
+
 type TopicConfig map[string]TopicConfigEntry
 
 func NewTopicConfig() TopicConfig {
@@ -7,20 +12,44 @@ func NewTopicConfig() TopicConfig {
 
 	cfg.Set(TopicConfigEntry{
 		ConfigEntry: ConfigEntry{
-			Name:    "cleanup.policy",
-			Default: "delete",
+			Name:        "cleanup.policy",
+			Default:     "delete",
+			ValidValues: []interface{}{"delete", "compact", "compact,delete", "delete,compact"},
 		},
 		ServerDefault: "log.cleanup.policy",
 	})
 
 	cfg.Set(TopicConfigEntry{
 		ConfigEntry: ConfigEntry{
-			Name:    "compression.type",
-			Default: "producer",
+			Name:        "compression.type",
+			Default:     "producer",
+			ValidValues: []interface{}{"producer", "uncompressed", "gzip", "snappy", "lz4", "zstd"},
 		},
 		ServerDefault: "compression.type",
 	})
 
+	cfg.Set(TopicConfigEntry{
+		ConfigEntry: ConfigEntry{
+			Name:    "consumer.byte.rate",
+			Default: 0,
+		},
+	})
+
+	cfg.Set(TopicConfigEntry{
+		ConfigEntry: ConfigEntry{
+			Name:        "dead.letter.queue.enable",
+			Default:     "false",
+			ValidValues: []interface{}{"true", "false"},
+		},
+	})
+
+	cfg.Set(TopicConfigEntry{
+		ConfigEntry: ConfigEntry{
+			Name:    "delivery.delay.ms",
+			Default: 0,
+		},
+	})
+
 	cfg.Set(TopicConfigEntry{
 		ConfigEntry: ConfigEntry{
 			Name:    "delete.retention.ms",
@@ -101,8 +130,9 @@ func NewTopicConfig() TopicConfig {
 
 	cfg.Set(TopicConfigEntry{
 		ConfigEntry: ConfigEntry{
-			Name:    "message.timestamp.type",
-			Default: "CreateTime",
+			Name:        "message.timestamp.type",
+			Default:     "CreateTime",
+			ValidValues: []interface{}{"CreateTime", "LogAppendTime"},
 		},
 	})
 
@@ -130,6 +160,13 @@ func NewTopicConfig() TopicConfig {
 		ServerDefault: "min.insync.replicas",
 	})
 
+	cfg.Set(TopicConfigEntry{
+		ConfigEntry: ConfigEntry{
+			Name:    "placement.constraints",
+			Default: "",
+		},
+	})
+
 	cfg.Set(TopicConfigEntry{
 		ConfigEntry: ConfigEntry{
 			Name:    "preallocate",
@@ -138,6 +175,28 @@ func NewTopicConfig() TopicConfig {
 		ServerDefault: "log.preallocate",
 	})
 
+	cfg.Set(TopicConfigEntry{
+		ConfigEntry: ConfigEntry{
+			Name:    "producer.byte.rate",
+			Default: 0,
+		},
+	})
+
+	cfg.Set(TopicConfigEntry{
+		ConfigEntry: ConfigEntry{
+			Name:    "producer.record.rate",
+			Default: 0,
+		},
+	})
+
+	cfg.Set(TopicConfigEntry{
+		ConfigEntry: ConfigEntry{
+			Name:        "read.only",
+			Default:     "false",
+			ValidValues: []interface{}{"true", "false"},
+		},
+	})
+
 	cfg.Set(TopicConfigEntry{
 		ConfigEntry: ConfigEntry{
 			Name:    "retention.bytes",
@@ -162,6 +221,14 @@ func NewTopicConfig() TopicConfig {
 		ServerDefault: "log.segment.bytes",
 	})
 
+	cfg.Set(TopicConfigEntry{
+		ConfigEntry: ConfigEntry{
+			Name:        "segment.compression",
+			Default:     "none",
+			ValidValues: []interface{}{"none", "gzip"},
+		},
+	})
+
 	cfg.Set(TopicConfigEntry{
 		ConfigEntry: ConfigEntry{
 			Name:    "segment.index.bytes",
@@ -197,6 +264,18 @@ func NewTopicConfig() TopicConfig {
 	return cfg
 }
 
+// Clone returns a copy of the config.
+func (c TopicConfig) Clone() TopicConfig {
+	if c == nil {
+		return nil
+	}
+	clone := make(TopicConfig, len(c))
+	for name, e := range c {
+		clone[name] = e
+	}
+	return clone
+}
+
 func (c TopicConfig) Set(e TopicConfigEntry) {
 	c[e.Name] = e
 }
@@ -226,6 +305,71 @@ func (c TopicConfig) SetValue(name string, value interface{}) TopicConfig {
 	return c
 }
 
+// GetString returns the named entry's value as a string. Strings come back from the raft log as
+// bytes so both are handled.
+func (c TopicConfig) GetString(name string) string {
+	switch v := c.GetValue(name).(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	return ""
+}
+
+// GetInt returns the named entry's value as an int, parsing it if it was set from a request. It
+// returns false if the entry doesn't exist or its value isn't an int.
+func (c TopicConfig) GetInt(name string) (int64, bool) {
+	switch v := c.GetValue(name).(type) {
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint64:
+		return int64(v), true
+	case float64:
+		return int64(v), true
+	case string, []byte:
+		i, err := strconv.ParseInt(c.GetString(name), 10, 64)
+		return i, err == nil
+	}
+	return 0, false
+}
+
+// SetValueFromString sets the named entry to the value as sent in a request, checking the entry
+// exists and the value is one of its valid values. A nil value resets the entry to its default.
+func (c TopicConfig) SetValueFromString(name string, value *string) error {
+	e, ok := c[name]
+	if !ok {
+		return fmt.Errorf("unknown topic config: %s", name)
+	}
+	if value == nil {
+		e.Value = nil
+		c[name] = e
+		return nil
+	}
+	if len(e.ValidValues) != 0 {
+		valid := false
+		for _, v := range e.ValidValues {
+			if v == *value {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Errorf("invalid value for topic config %s: %s", name, *value)
+		}
+	}
+	if _, ok := e.Default.(int); ok {
+		if _, err := strconv.ParseInt(*value, 10, 64); err != nil {
+			return fmt.Errorf("invalid value for topic config %s: %s: must be an integer", name, *value)
+		}
+	}
+	e.Value = *value
+	c[name] = e
+	return nil
+}
+
 type ConfigEntry struct {
 	Default     interface{}
 	Name        string
@@ -0,0 +1,75 @@
+package jocko
+
+import (
+	"net"
+	"time"
+
+	"github.com/travisjeffery/jocko/jocko/config"
+)
+
+// tcpOptions tune the sockets of the broker's TCP connections.
+type tcpOptions struct {
+	keepAlive     time.Duration
+	sendBuffer    int
+	receiveBuffer int
+	noDelay       bool
+}
+
+func newTCPOptions(c *config.Config) *tcpOptions {
+	return &tcpOptions{
+		keepAlive:     c.TCPKeepAlive,
+		sendBuffer:    c.TCPSendBufferBytes,
+		receiveBuffer: c.TCPReceiveBufferBytes,
+		noDelay:       c.TCPNoDelay,
+	}
+}
+
+// apply sets the options on the connection if it's a TCP connection.
+func (o *tcpOptions) apply(conn net.Conn) error {
+	tc, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+	switch {
+	case o.keepAlive > 0:
+		if err := tc.SetKeepAlive(true); err != nil {
+			return err
+		}
+		if err := tc.SetKeepAlivePeriod(o.keepAlive); err != nil {
+			return err
+		}
+	case o.keepAlive < 0:
+		if err := tc.SetKeepAlive(false); err != nil {
+			return err
+		}
+	}
+	if o.sendBuffer > 0 {
+		if err := tc.SetWriteBuffer(o.sendBuffer); err != nil {
+			return err
+		}
+	}
+	if o.receiveBuffer > 0 {
+		if err := tc.SetReadBuffer(o.receiveBuffer); err != nil {
+			return err
+		}
+	}
+	return tc.SetNoDelay(o.noDelay)
+}
+
+// tcpListener applies the options to the connections it accepts.
+type tcpListener struct {
+	*net.TCPListener
+	opts *tcpOptions
+}
+
+func (l tcpListener) Accept() (net.Conn, error) {
+	conn, err := l.AcceptTCP()
+	if err != nil {
+		return nil, err
+	}
+	if err := l.opts.apply(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
@@ -0,0 +1,46 @@
+//go:build !windows
+// +build !windows
+
+package jocko
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTCPListener(t *testing.T) {
+	ln, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	l := tcpListener{TCPListener: ln, opts: &tcpOptions{
+		keepAlive:     time.Minute,
+		receiveBuffer: 16 << 10,
+		noDelay:       false,
+	}}
+	defer l.Close()
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	conn, err := l.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	sockopt := func(level, opt int) (v int) {
+		raw, err := conn.(*net.TCPConn).SyscallConn()
+		require.NoError(t, err)
+		require.NoError(t, raw.Control(func(fd uintptr) {
+			v, err = syscall.GetsockoptInt(int(fd), level, opt)
+		}))
+		require.NoError(t, err)
+		return v
+	}
+	require.Equal(t, 1, sockopt(syscall.SOL_SOCKET, syscall.SO_KEEPALIVE))
+	require.Equal(t, 0, sockopt(syscall.IPPROTO_TCP, syscall.TCP_NODELAY))
+	// linux doubles the requested size to leave room for bookkeeping.
+	rcvbuf := sockopt(syscall.SOL_SOCKET, syscall.SO_RCVBUF)
+	require.True(t, rcvbuf >= 16<<10 && rcvbuf <= 32<<10, "receive buffer: %d", rcvbuf)
+}
@@ -1,16 +1,21 @@
 package jocko
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
+	"net"
+	"os"
 	"sync/atomic"
 	"time"
 
 	"github.com/hashicorp/consul/testutil/retry"
 	"github.com/hashicorp/raft"
+	"github.com/hashicorp/serf/serf"
 	"github.com/mitchellh/go-testing-interface"
-	dynaport "github.com/travisjeffery/go-dynaport"
 	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/protocol"
+	"github.com/travisjeffery/jocko/testutil"
 
 	"github.com/uber/jaeger-lib/metrics"
 
@@ -23,7 +28,7 @@ var (
 )
 
 func NewTestServer(t testing.T, cbBroker func(cfg *config.Config), cbServer func(cfg *config.Config)) (*Server, string) {
-	ports := dynaport.Get(4)
+	ports := testutil.Ports(4)
 	nodeID := atomic.AddInt32(&nodeNumber, 1)
 
 	cfg := jaegercfg.Configuration{
@@ -93,6 +98,7 @@ func NewTestServer(t testing.T, cbBroker func(cfg *config.Config), cbServer func
 	return NewServer(config, b, nil, tracer, closer.Close), tmpDir
 }
 
+// TestJoin joins the other servers to s1's LAN and waits for them to see each other.
 func TestJoin(t testing.T, s1 *Server, other ...*Server) {
 	addr := fmt.Sprintf("127.0.0.1:%d",
 		s1.config.SerfLANConfig.MemberlistConfig.BindPort)
@@ -102,6 +108,12 @@ func TestJoin(t testing.T, s1 *Server, other ...*Server) {
 		} else if num != 1 {
 			t.Fatalf("bad: %d", num)
 		}
+		addr2 := fmt.Sprintf("127.0.0.1:%d", s2.config.SerfLANConfig.MemberlistConfig.BindPort)
+		retry.Run(t, func(r *retry.R) {
+			if !seeEachOther(s1.handler.(*Broker).LANMembers(), s2.handler.(*Broker).LANMembers(), addr, addr2) {
+				r.Fatalf("%s and %s cannot see each other", s1.config.NodeName, s2.config.NodeName)
+			}
+		})
 	}
 }
 
@@ -129,3 +141,166 @@ func WaitForLeader(t testing.T, servers ...*Server) (*Server, []*Server) {
 	}
 	return tmp.leader, followers
 }
+
+// WaitForTopicLeader waits for one of the servers to lead the partition, with its replica ready to
+// take produce and fetch requests, failing the test if none does. Returns the leader.
+func WaitForTopicLeader(t testing.T, topic string, partition int32, servers ...*Server) *Server {
+	var leader *Server
+	retry.Run(t, func(r *retry.R) {
+		for _, s := range servers {
+			b := s.handler.(*Broker)
+			replica, err := b.fetchReplica(topic, partition)
+			if err != nil {
+				continue
+			}
+			replica.Lock()
+			open := replica.Log != nil
+			replica.Unlock()
+			if !open {
+				continue
+			}
+			if b.checkLeader(replica) == protocol.ErrNone {
+				leader = s
+				return
+			}
+		}
+		r.Fatalf("no leader for %s/%d", topic, partition)
+	})
+	return leader
+}
+
+// CreateTopic creates the topic with the partitions and replication factor, retrying until the
+// controller's ready, failing the test if it can't be created.
+func CreateTopic(t testing.T, conn *Conn, topic string, partitions int32, replicationFactor int16) {
+	CreateTopicWithConfigs(t, conn, topic, partitions, replicationFactor, nil)
+}
+
+// CreateTopicWithConfigs is CreateTopic setting the topic's configs.
+func CreateTopicWithConfigs(t testing.T, conn *Conn, topic string, partitions int32, replicationFactor int16, configs map[string]*string) {
+	retry.Run(t, func(r *retry.R) {
+		res, err := conn.CreateTopics(&protocol.CreateTopicRequests{
+			Timeout: time.Second,
+			Requests: []*protocol.CreateTopicRequest{{
+				Topic:             topic,
+				NumPartitions:     partitions,
+				ReplicationFactor: replicationFactor,
+				Configs:           configs,
+			}},
+		})
+		if err != nil {
+			r.Fatal(err)
+		}
+		if code := res.TopicErrorCodes[0].ErrorCode; code != protocol.ErrNone.Code() && code != protocol.ErrTopicAlreadyExists.Code() {
+			r.Fatalf("create topic error: %d", code)
+		}
+	})
+}
+
+// TestClusterOptions configures a test cluster's brokers.
+type TestClusterOptions struct {
+	// Brokers is the number of brokers. Defaults to 3.
+	Brokers int
+	// BootstrapExpect is the number of brokers the others expect, which the first's bootstrap
+	// takes precedence over. Defaults to Brokers.
+	BootstrapExpect int
+	// Racks label the brokers round robin with their "rack" tag.
+	Racks []string
+	// Config, if set, is called with each broker's index and config before it's created.
+	Config func(i int, cfg *config.Config)
+}
+
+// TestCluster is a cluster of test servers, started, joined to the first's LAN, and with a leader.
+type TestCluster struct {
+	Servers []*Server
+	dirs    []string
+	cancel  context.CancelFunc
+}
+
+// NewTestCluster starts a cluster of test servers. Each gets its own ports, so clusters in tests
+// running in parallel don't conflict. Shut it down with Shutdown.
+func NewTestCluster(t testing.T, opts TestClusterOptions) *TestCluster {
+	if opts.Brokers == 0 {
+		opts.Brokers = 3
+	}
+	if opts.BootstrapExpect == 0 {
+		opts.BootstrapExpect = opts.Brokers
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &TestCluster{cancel: cancel}
+	for i := 0; i < opts.Brokers; i++ {
+		i := i
+		s, dir := NewTestServer(t, func(cfg *config.Config) {
+			// the first bootstraps raft, which the others' bootstrap expect defers to.
+			cfg.Bootstrap = i == 0
+			if i > 0 || opts.BootstrapExpect == 1 {
+				cfg.BootstrapExpect = opts.BootstrapExpect
+			}
+			if len(opts.Racks) > 0 {
+				if cfg.Tags == nil {
+					cfg.Tags = make(map[string]string)
+				}
+				cfg.Tags["rack"] = opts.Racks[i%len(opts.Racks)]
+			}
+			if opts.Config != nil {
+				opts.Config(i, cfg)
+			}
+		}, nil)
+		c.Servers = append(c.Servers, s)
+		c.dirs = append(c.dirs, dir)
+		if err := s.Start(ctx); err != nil {
+			c.Shutdown()
+			t.Fatalf("err: %v", err)
+		}
+	}
+	TestJoin(t, c.Servers[0], c.Servers[1:]...)
+	WaitForLeader(t, c.Servers...)
+	return c
+}
+
+// Leader returns the cluster's raft leader, waiting for there to be one.
+func (c *TestCluster) Leader(t testing.T) *Server {
+	leader, _ := WaitForLeader(t, c.Servers...)
+	return leader
+}
+
+// WaitForTopicLeader waits for one of the cluster's servers to lead the partition and returns it.
+func (c *TestCluster) WaitForTopicLeader(t testing.T, topic string, partition int32) *Server {
+	return WaitForTopicLeader(t, topic, partition, c.Servers...)
+}
+
+// Shutdown shuts down the cluster's servers and removes their data dirs.
+func (c *TestCluster) Shutdown() {
+	c.cancel()
+	for i, s := range c.Servers {
+		s.Shutdown()
+		os.RemoveAll(c.dirs[i])
+	}
+}
+
+// VerifyNoLeaks fails the test if any of the servers' brokers have goroutines still running. Call
+// it after shutting them down.
+func VerifyNoLeaks(t testing.T, servers ...*Server) {
+	for _, s := range servers {
+		b := s.handler.(*Broker)
+		if running := b.goroutines.running(); len(running) != 0 {
+			t.Fatalf("broker %d leaked goroutines: %s", b.config.ID, formatRunning(running))
+		}
+	}
+}
+
+func seeEachOther(a, b []serf.Member, addra, addrb string) bool {
+	return serfMembersContains(a, addrb) && serfMembersContains(b, addra)
+}
+
+func serfMembersContains(members []serf.Member, addr string) bool {
+	_, want, err := net.SplitHostPort(addr)
+	if err != nil {
+		panic(err)
+	}
+	for _, m := range members {
+		if got := fmt.Sprintf("%d", m.Port); got == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package jocko
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestNewTestCluster(t *testing.T) {
+	c := NewTestCluster(t, TestClusterOptions{Racks: []string{"a", "b"}})
+	defer c.Shutdown()
+	require.Equal(t, 3, len(c.Servers))
+
+	conn, err := Dial("tcp", c.Leader(t).Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	res, err := conn.CreateTopics(&protocol.CreateTopicRequests{
+		Timeout: 5 * time.Second,
+		Requests: []*protocol.CreateTopicRequest{{
+			Topic:             "test",
+			NumPartitions:     1,
+			ReplicationFactor: 3,
+		}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrNone.Code(), res.TopicErrorCodes[0].ErrorCode)
+	leader := c.WaitForTopicLeader(t, "test", 0)
+
+	// the brokers' racks are in the metadata.
+	md, err := conn.Metadata(&protocol.MetadataRequest{APIVersion: 1, Topics: []string{"test"}})
+	require.NoError(t, err)
+	require.Equal(t, 3, len(md.Brokers))
+	racks := make(map[int32]string)
+	for _, b := range md.Brokers {
+		require.NotNil(t, b.Rack)
+		racks[b.NodeID] = *b.Rack
+	}
+	for i, s := range c.Servers {
+		require.Equal(t, []string{"a", "b"}[i%2], racks[s.ID()])
+	}
+	require.Equal(t, leader.ID(), md.TopicMetadata[0].PartitionMetadata[0].Leader)
+
+	// the brokers' goroutines, including the followers' replicators, exit on shutdown.
+	c.Shutdown()
+	VerifyNoLeaks(t, c.Servers...)
+}
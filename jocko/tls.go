@@ -0,0 +1,134 @@
+package jocko
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync/atomic"
+
+	"github.com/travisjeffery/jocko/jocko/config"
+)
+
+// certReloader holds the server's TLS certificate so it can be swapped, e.g. when a short-lived
+// certificate is renewed, without restarting the listener or dropping connections.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	cert     atomic.Value
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the certificate and key files. The current certificate is kept if they're invalid.
+func (r *certReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.cert.Store(&cert)
+	return nil
+}
+
+// GetCertificate returns the current certificate for new TLS connections.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load().(*tls.Certificate), nil
+}
+
+// GetClientCertificate returns the current certificate for new TLS connections this end dials.
+func (r *certReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.cert.Load().(*tls.Certificate), nil
+}
+
+// newPeerTLSConfig returns the mutual TLS config brokers secure their traffic to each other with,
+// both the connections they accept and those they dial: each end presents the reloader's
+// certificate and only trusts the other's if it's signed by the CA. Peers are verified by the CA
+// alone, not their host names, since brokers dial each other by the addresses they advertise.
+func newPeerTLSConfig(certs *certReloader, caFile string) (*tls.Config, error) {
+	roots, err := loadCA(caFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		GetCertificate:       certs.GetCertificate,
+		GetClientCertificate: certs.GetClientCertificate,
+		ClientAuth:           tls.RequireAndVerifyClientCert,
+		ClientCAs:            roots,
+		// the server's certificate is checked against the CA by VerifyPeerCertificate instead.
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(raw [][]byte, _ [][]*x509.Certificate) error {
+			return verifyPeerCertificate(raw, roots)
+		},
+	}, nil
+}
+
+// newClientTLSConfig returns the TLS config the Kafka protocol listener serves clients with,
+// authenticating their certificates against the CA as the client auth mode says.
+func newClientTLSConfig(certs *certReloader, caFile, clientAuth string) (*tls.Config, error) {
+	c := &tls.Config{GetCertificate: certs.GetCertificate}
+	switch clientAuth {
+	case config.TLSClientAuthRequested:
+		c.ClientAuth = tls.VerifyClientCertIfGiven
+	case config.TLSClientAuthRequired:
+		c.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return c, nil
+	}
+	roots, err := loadCA(caFile)
+	if err != nil {
+		return nil, err
+	}
+	c.ClientCAs = roots
+	return c, nil
+}
+
+// loadCA reads the CA file's certificates.
+func loadCA(caFile string) (*x509.CertPool, error) {
+	ca, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates in %s", caFile)
+	}
+	return roots, nil
+}
+
+// verifyPeerCertificate verifies the peer's certificate chain is signed by one of the roots.
+func verifyPeerCertificate(raw [][]byte, roots *x509.CertPool) error {
+	if len(raw) == 0 {
+		return errors.New("peer sent no certificate")
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	certs := make([]*x509.Certificate, len(raw))
+	for i, r := range raw {
+		cert, err := x509.ParseCertificate(r)
+		if err != nil {
+			return err
+		}
+		certs[i] = cert
+		if i > 0 {
+			opts.Intermediates.AddCert(cert)
+		}
+	}
+	_, err := certs[0].Verify(opts)
+	return err
+}
+
+// peerTLSConfig returns the TLS config and certificate the broker secures its traffic to the
+// other brokers with, nil if it doesn't.
+func (b *Broker) peerTLSConfig() (*tls.Config, *certReloader) {
+	return b.peerTLS, b.peerCerts
+}
@@ -0,0 +1,271 @@
+package jocko
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/testutil/retry"
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/protocol"
+	"github.com/travisjeffery/jocko/testutil"
+)
+
+func TestServer_ReloadTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jocko-tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeTestCert(t, certFile, keyFile, 1)
+
+	s, dataDir := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+		cfg.TLSCertFile = certFile
+		cfg.TLSKeyFile = keyFile
+	}, nil)
+	defer os.RemoveAll(dataDir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+
+	serial := func() int64 {
+		conn, err := tls.Dial("tcp", s.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		require.NoError(t, err)
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+	}
+	require.Equal(t, int64(1), serial())
+
+	writeTestCert(t, certFile, keyFile, 2)
+	require.Equal(t, int64(1), serial())
+	require.NoError(t, s.ReloadTLS())
+	require.Equal(t, int64(2), serial())
+
+	// a bad certificate doesn't replace the current one.
+	require.NoError(t, ioutil.WriteFile(certFile, []byte("bad"), 0600))
+	require.Error(t, s.ReloadTLS())
+	require.Equal(t, int64(2), serial())
+}
+
+func TestServer_TLSHandshakeTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jocko-tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeTestCert(t, certFile, keyFile, 1)
+
+	s, dataDir := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+		cfg.TLSCertFile = certFile
+		cfg.TLSKeyFile = keyFile
+		cfg.HandshakeTimeout = 100 * time.Millisecond
+	}, nil)
+	defer os.RemoveAll(dataDir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+
+	// a conn that never starts its handshake is closed.
+	conn, err := net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err = conn.Read(make([]byte, 1))
+	require.Equal(t, io.EOF, err)
+
+	// a conn that completes it isn't, however long it then idles.
+	tlsConn, err := tls.Dial("tcp", s.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	require.NoError(t, err)
+	defer tlsConn.Close()
+	time.Sleep(300 * time.Millisecond)
+	c, err := NewConn(tlsConn, "")
+	require.NoError(t, err)
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = c.APIVersions(&protocol.APIVersionsRequest{})
+	require.NoError(t, err)
+}
+
+func TestServer_TLSClientAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jocko-tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	// the CA's certificate is both the server's and the authenticated client's.
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeTestCA(t, certFile, keyFile)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	require.NoError(t, err)
+	otherCertFile, otherKeyFile := filepath.Join(dir, "other-cert.pem"), filepath.Join(dir, "other-key.pem")
+	writeTestCert(t, otherCertFile, otherKeyFile, 2)
+	other, err := tls.LoadX509KeyPair(otherCertFile, otherKeyFile)
+	require.NoError(t, err)
+
+	for _, clientAuth := range []string{config.TLSClientAuthNone, config.TLSClientAuthRequested, config.TLSClientAuthRequired} {
+		t.Run(clientAuth, func(t *testing.T) {
+			s, dataDir := NewTestServer(t, func(cfg *config.Config) {
+				cfg.Bootstrap = true
+				cfg.BootstrapExpect = 1
+				cfg.StartAsLeader = true
+				cfg.OffsetsTopicReplicationFactor = 1
+				cfg.TLSCertFile = certFile
+				cfg.TLSKeyFile = keyFile
+				cfg.TLSCAFile = certFile
+				cfg.TLSClientAuth = clientAuth
+			}, nil)
+			defer os.RemoveAll(dataDir)
+			require.NoError(t, s.Start(context.Background()))
+			defer s.Shutdown()
+
+			// connects returns whether a client presenting the certificate, if any, can send a
+			// request. The certificate's sent even if it's not signed by a CA the server accepts.
+			connects := func(certs ...tls.Certificate) bool {
+				conn, err := tls.Dial("tcp", s.Addr().String(), &tls.Config{
+					InsecureSkipVerify: true,
+					GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+						if len(certs) == 0 {
+							return &tls.Certificate{}, nil
+						}
+						return &certs[0], nil
+					},
+				})
+				if err != nil {
+					return false
+				}
+				defer conn.Close()
+				c, err := NewConn(conn, "")
+				require.NoError(t, err)
+				c.SetDeadline(time.Now().Add(5 * time.Second))
+				_, err = c.APIVersions(&protocol.APIVersionsRequest{})
+				return err == nil
+			}
+			require.True(t, connects(cert))
+			require.Equal(t, clientAuth != config.TLSClientAuthRequired, connects())
+			require.Equal(t, clientAuth == config.TLSClientAuthNone, connects(other))
+		})
+	}
+}
+
+func TestBroker_InterBrokerTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jocko-tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	// the brokers share a self-signed certificate that's also their CA.
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeTestCA(t, certFile, keyFile)
+
+	c := NewTestCluster(t, TestClusterOptions{Brokers: 2, Config: func(i int, cfg *config.Config) {
+		cfg.InterBrokerAddr = fmt.Sprintf("127.0.0.1:%d", testutil.Ports(1)[0])
+		cfg.InterBrokerTLSCertFile = certFile
+		cfg.InterBrokerTLSKeyFile = keyFile
+		cfg.InterBrokerTLSCAFile = certFile
+		cfg.SerfEncryptKey = "AAECAwQFBgcICQoLDA0ODw=="
+	}})
+	defer c.Shutdown()
+
+	conn, err := Dial("tcp", c.Leader(t).Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	CreateTopic(t, conn, "secured", 1, 2)
+	leader := c.WaitForTopicLeader(t, "secured", 0)
+	follower := c.Servers[0]
+	if follower == leader {
+		follower = c.Servers[1]
+	}
+
+	pconn, err := Dial("tcp", leader.Addr().String())
+	require.NoError(t, err)
+	defer pconn.Close()
+	set, err := protocol.Encode(&protocol.MessageSet{Messages: []*protocol.Message{{Value: []byte("v")}}})
+	require.NoError(t, err)
+	res, err := pconn.Produce(&protocol.ProduceRequest{
+		APIVersion: 2,
+		Timeout:    time.Second,
+		TopicData: []*protocol.TopicData{{
+			Topic: "secured",
+			Data:  []*protocol.Data{{Partition: 0, RecordSet: set}},
+		}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrNone.Code(), res.Responses[0].PartitionResponses[0].ErrorCode)
+
+	// the follower replicates over the leader's inter-broker listener.
+	retry.Run(t, func(r *retry.R) {
+		replica, err := follower.broker().fetchReplica("secured", 0)
+		if err != nil {
+			r.Fatal(err)
+		}
+		replica.Lock()
+		defer replica.Unlock()
+		if replica.Log == nil || replica.Log.NewestOffset() != 1 {
+			r.Fatal("follower hasn't replicated the record")
+		}
+	})
+
+	// clients without a certificate signed by the CA can't connect to it.
+	tconn, err := tls.Dial("tcp", leader.InterBrokerAddr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err == nil {
+		defer tconn.Close()
+		_, err = tconn.Read(make([]byte, 1))
+	}
+	require.Error(t, err)
+}
+
+// writeTestCA writes a self-signed certificate that can sign itself, to use as both a CA and a
+// peer's certificate.
+func writeTestCA(t *testing.T, certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "jocko-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+}
+
+func writeTestCert(t *testing.T, certFile, keyFile string, serial int64) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "jocko"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+}
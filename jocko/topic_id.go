@@ -0,0 +1,129 @@
+package jocko
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/travisjeffery/jocko/jocko/fsm"
+	"github.com/travisjeffery/jocko/jocko/structs"
+	"github.com/travisjeffery/jocko/log"
+)
+
+// partitionMetadataFile is the file in each partition's log directory recording the ID of the
+// topic the log belongs to.
+const partitionMetadataFile = "partition.metadata"
+
+// newTopicID returns a new, random topic ID.
+func newTopicID() string {
+	return uuid.NewV4().String()
+}
+
+// ensurePartitionTopicID checks the partition log directory belongs to the topic with the given
+// ID. A directory left behind by a deleted topic with the same name is quarantined so the
+// recreated topic doesn't pick up its records, while they're kept in case the mismatch is a
+// mistake. Topics created before topic IDs have an empty ID and aren't checked.
+func (b *Broker) ensurePartitionTopicID(dir, topicID string) error {
+	if topicID == "" {
+		return nil
+	}
+	path := filepath.Join(dir, partitionMetadataFile)
+	existing, err := readPartitionTopicID(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if existing == topicID {
+		return nil
+	}
+	if existing != "" {
+		log.Info.Printf("broker/%d: partition dir %s belongs to topic id %s, not %s: quarantining stale dir", b.config.ID, dir, existing, topicID)
+		if err := b.quarantinePartitionDir(dir); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(fmt.Sprintf("version: 0\ntopic_id: %s\n", topicID)), 0644)
+}
+
+// readPartitionTopicID returns the topic ID recorded in the partition metadata file.
+func readPartitionTopicID(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if id := strings.TrimPrefix(s.Text(), "topic_id:"); id != s.Text() {
+			return strings.TrimSpace(id), nil
+		}
+	}
+	if err := s.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no topic id in %s", path)
+}
+
+// fenceDeletedPartitions starts the new partitions' leader epochs past those of the partitions of
+// a deleted topic with the same name, which are left in the fsm when it's deleted. Consumers
+// with the deleted topic's metadata are then fenced when they fetch with its leader epochs,
+// rather than reading the new topic's records as if they followed the old ones.
+func fenceDeletedPartitions(state *fsm.Store, ps []structs.Partition) {
+	for i := range ps {
+		_, old, err := state.GetPartition(ps[i].Topic, ps[i].ID)
+		if err == nil && old != nil && old.LeaderEpoch >= ps[i].LeaderEpoch {
+			ps[i].LeaderEpoch = old.LeaderEpoch + 1
+		}
+	}
+}
+
+// removeDeletedReplicas closes and removes the broker's replicas of the deleted topic, so its
+// clients get unknown topic or partition errors instead of its records. Replicas of a topic
+// recreated with the same name since are kept.
+func (b *Broker) removeDeletedReplicas(topic string) {
+	_, t, err := b.fsm.State().GetTopic(topic)
+	if err != nil {
+		log.Error.Printf("broker/%d: remove deleted replicas error: topic: %s: %s", b.config.ID, topic, err)
+		return
+	}
+	for _, replica := range b.replicaLookup.Replicas() {
+		if replica.Partition.Topic != topic {
+			continue
+		}
+		replica.Lock()
+		if t != nil && (replica.topicID == "" || replica.topicID == t.ID) {
+			replica.Unlock()
+			continue
+		}
+		if replica.Replicator != nil {
+			if err := replica.Replicator.Close(); err != nil {
+				log.Error.Printf("broker/%d: remove deleted replica error: topic: %s, partition: %d: %s", b.config.ID, topic, replica.Partition.ID, err)
+			}
+			replica.Replicator = nil
+		}
+		if c, ok := replica.Log.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				log.Error.Printf("broker/%d: remove deleted replica error: topic: %s, partition: %d: %s", b.config.ID, topic, replica.Partition.ID, err)
+			}
+		}
+		replica.Log = nil
+		replica.Unlock()
+		b.replicaLookup.RemoveReplica(replica)
+		log.Info.Printf("broker/%d: removed deleted replica: topic: %s, partition: %d", b.config.ID, topic, replica.Partition.ID)
+	}
+}
+
+// committedBeforeCreated returns whether the offset was committed before the topic was created,
+// i.e. it was committed to a deleted topic with the same name. Its offsets don't follow on from
+// the new topic's so the group has to reset them.
+func (b *Broker) committedBeforeCreated(topic string, v offsetCommitValue) bool {
+	_, t, err := b.fsm.State().GetTopic(topic)
+	return err == nil && t != nil && v.CommitTimestamp <= t.CreateTimestamp
+}
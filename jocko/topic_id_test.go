@@ -0,0 +1,185 @@
+package jocko
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/testutil/retry"
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/clock"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestEnsurePartitionTopicID(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "topic_id_test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	b := &Broker{config: &config.Config{DataDir: tmp}, clock: clock.New()}
+	dir := filepath.Join(tmp, "data", "test-topic-0")
+
+	require.NoError(t, b.ensurePartitionTopicID(dir, "id1"))
+	id, err := readPartitionTopicID(filepath.Join(dir, partitionMetadataFile))
+	require.NoError(t, err)
+	require.Equal(t, "id1", id)
+
+	segment := filepath.Join(dir, "00000000000000000000.log")
+	require.NoError(t, ioutil.WriteFile(segment, []byte("records"), 0644))
+	require.NoError(t, b.ensurePartitionTopicID(dir, "id1"))
+	_, err = os.Stat(segment)
+	require.NoError(t, err)
+
+	// the topic was deleted and recreated so the old topic's records are quarantined.
+	require.NoError(t, b.ensurePartitionTopicID(dir, "id2"))
+	_, err = os.Stat(segment)
+	require.True(t, os.IsNotExist(err))
+	require.True(t, fileExists(filepath.Join(tmp, quarantineDir, "test-topic-0", "00000000000000000000.log")))
+	id, err = readPartitionTopicID(filepath.Join(dir, partitionMetadataFile))
+	require.NoError(t, err)
+	require.Equal(t, "id2", id)
+}
+
+func TestBroker_RecreateTopic(t *testing.T) {
+	s, dir := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+	b := s.broker()
+
+	conn, err := Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	createTopic := func() int32 {
+		CreateTopic(t, conn, "recreated", 1, 1)
+		WaitForTopicLeader(t, "recreated", 0, s)
+		replica, err := b.replicaLookup.Replica("recreated", 0)
+		require.NoError(t, err)
+		_, epoch := b.currentLeader(replica)
+		return epoch
+	}
+	fetch := func(clientEpoch int32) int16 {
+		res, err := conn.Fetch(&protocol.FetchRequest{
+			APIVersion:  9,
+			MaxWaitTime: time.Second,
+			Topics: []*protocol.FetchTopic{{
+				Topic:      "recreated",
+				Partitions: []*protocol.FetchPartition{{Partition: 0, CurrentLeaderEpoch: clientEpoch, MaxBytes: 1 << 10}},
+			}},
+		})
+		require.NoError(t, err)
+		return res.Responses[0].PartitionResponses[0].ErrorCode
+	}
+	committed := func() int64 {
+		res, err := conn.OffsetFetch(&protocol.OffsetFetchRequest{
+			APIVersion: 1,
+			GroupID:    "group",
+			Topics:     []protocol.OffsetFetchTopicRequest{{Topic: "recreated", Partitions: []int32{0}}},
+		})
+		require.NoError(t, err)
+		return res.Responses[0].Partitions[0].Offset
+	}
+
+	oldEpoch := createTopic()
+	retry.Run(t, func(r *retry.R) {
+		res, err := conn.FindCoordinator(&protocol.FindCoordinatorRequest{CoordinatorKey: "group"})
+		if err != nil {
+			r.Fatal(err)
+		}
+		if res.ErrorCode != protocol.ErrNone.Code() {
+			r.Fatalf("find coordinator error: %d", res.ErrorCode)
+		}
+	})
+	WaitForTopicLeader(t, OffsetsTopicName, coordinatorPartition("group", OffsetsTopicNumPartitions), s)
+	retry.Run(t, func(r *retry.R) {
+		res, err := conn.OffsetCommit(&protocol.OffsetCommitRequest{
+			APIVersion:   2,
+			GroupID:      "group",
+			GenerationID: -1,
+			Topics: []*protocol.OffsetCommitRequestTopic{{
+				Name:       "recreated",
+				Partitions: []*protocol.OffsetCommitRequestPartition{{PartitionIndex: 0, CommittedOffset: 5}},
+			}},
+		})
+		if err != nil {
+			r.Fatal(err)
+		}
+		if code := res.Topics[0].Partitions[0].ErrorCode; code != protocol.ErrNone.Code() {
+			r.Fatalf("offset commit error: %d", code)
+		}
+	})
+	require.Equal(t, int64(5), committed())
+
+	res, err := conn.DeleteTopics(&protocol.DeleteTopicsRequest{Topics: []string{"recreated"}, Timeout: time.Second})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrNone.Code(), res.TopicErrorCodes[0].ErrorCode)
+	// clients of the deleted topic aren't served its records.
+	retry.Run(t, func(r *retry.R) {
+		if code := fetch(oldEpoch); code != protocol.ErrUnknownTopicOrPartition.Code() {
+			r.Fatalf("fetch error: %d", code)
+		}
+	})
+
+	// the recreated topic's epochs fence clients with the deleted topic's metadata, and the
+	// group's offsets committed to the deleted topic are reset.
+	newEpoch := createTopic()
+	require.True(t, newEpoch > oldEpoch)
+	require.Equal(t, protocol.ErrFencedLeaderEpoch.Code(), fetch(oldEpoch))
+	require.Equal(t, protocol.ErrNone.Code(), fetch(newEpoch))
+	require.Equal(t, int64(-1), committed())
+}
+
+func TestBroker_TopicIDRequests(t *testing.T) {
+	s, dir := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+
+	conn, err := Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	CreateTopic(t, conn, "by-id", 1, 1)
+	WaitForTopicLeader(t, "by-id", 0, s)
+	unknownID := newTopicID()
+
+	meta, err := conn.Metadata(&protocol.MetadataRequest{APIVersion: 10, Topics: []string{"by-id"}})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrNone.Code(), meta.TopicMetadata[0].TopicErrorCode)
+	id := meta.TopicMetadata[0].TopicID
+	require.NotEmpty(t, id)
+
+	meta, err = conn.Metadata(&protocol.MetadataRequest{APIVersion: 10, Topics: []string{}, TopicIDs: []string{id, unknownID}})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(meta.TopicMetadata))
+	require.Equal(t, "by-id", meta.TopicMetadata[0].Topic)
+	require.Equal(t, protocol.ErrUnknownTopicID.Code(), meta.TopicMetadata[1].TopicErrorCode)
+	require.Equal(t, unknownID, meta.TopicMetadata[1].TopicID)
+
+	fetch, err := conn.Fetch(&protocol.FetchRequest{
+		APIVersion:  13,
+		MaxWaitTime: time.Second,
+		Topics: []*protocol.FetchTopic{{
+			TopicID:    id,
+			Partitions: []*protocol.FetchPartition{{Partition: 0, CurrentLeaderEpoch: -1, MaxBytes: 1 << 10}},
+		}, {
+			TopicID:    unknownID,
+			Partitions: []*protocol.FetchPartition{{Partition: 0, CurrentLeaderEpoch: -1, MaxBytes: 1 << 10}},
+		}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, id, fetch.Responses[0].TopicID)
+	require.Equal(t, protocol.ErrNone.Code(), fetch.Responses[0].PartitionResponses[0].ErrorCode)
+	require.Equal(t, protocol.ErrUnknownTopicID.Code(), fetch.Responses[1].PartitionResponses[0].ErrorCode)
+}
@@ -0,0 +1,173 @@
+package jocko
+
+import (
+	"strconv"
+	"time"
+)
+
+const (
+	// otherTopicsLabel is the topic label the metrics of topics missing from the metrics topics
+	// allowlist are aggregated under.
+	otherTopicsLabel = "__other"
+	// logMetricsInterval is how often the log size and offset gauges are updated.
+	logMetricsInterval = 10 * time.Second
+)
+
+// SetMetrics sets the metrics the broker tracks its topics and partitions with and starts
+// updating their log gauges.
+func (b *Broker) SetMetrics(m *Metrics) {
+	b.Lock()
+	b.metrics = m
+	b.Unlock()
+	b.goroutines.goFunc("metrics", func() { b.logMetricsLoop(m) })
+}
+
+func (b *Broker) topicMetrics() *Metrics {
+	b.RLock()
+	defer b.RUnlock()
+	return b.metrics
+}
+
+// metricLabels returns the label values the topic and partition's metrics are tracked under,
+// keeping the number of series down per the broker's config.
+func (b *Broker) metricLabels(topic string, partition int32) []string {
+	if len(b.config.MetricsTopics) != 0 && !containsString(b.config.MetricsTopics, topic) {
+		topic = otherTopicsLabel
+	}
+	var p string
+	if b.config.MetricsPerPartition {
+		p = strconv.Itoa(int(partition))
+	}
+	return []string{"topic", topic, "partition", p}
+}
+
+func (b *Broker) trackProduce(topic string, partition int32, recordSet []byte) {
+	m := b.topicMetrics()
+	if m == nil {
+		return
+	}
+	labels := b.metricLabels(topic, partition)
+	m.MessagesIn.With(labels...).Add(float64(countRecords(recordSet)))
+	m.BytesIn.With(labels...).Add(float64(len(recordSet)))
+}
+
+func (b *Broker) trackFetch(topic string, partition int32, bytes int) {
+	m := b.topicMetrics()
+	if m == nil {
+		return
+	}
+	m.BytesOut.With(b.metricLabels(topic, partition)...).Add(float64(bytes))
+}
+
+func (b *Broker) logMetricsLoop(m *Metrics) {
+	ticker := time.NewTicker(logMetricsInterval)
+	defer ticker.Stop()
+	for {
+		b.updateLogMetrics(m)
+		select {
+		case <-ticker.C:
+		case <-b.shutdownCh:
+			return
+		}
+	}
+}
+
+type logStats struct {
+	size, start, end, stuck, lag int64
+	lagTime                      time.Duration
+	// cleaned is whether the logs have been compacted, cleanRate and lastClean are their fastest
+	// and latest compactions'.
+	cleaned   bool
+	cleanRate float64
+	lastClean time.Time
+}
+
+// updateLogMetrics sets the log gauges from the local replicas, summing the replicas that share
+// labels.
+func (b *Broker) updateLogMetrics(m *Metrics) {
+	type key struct{ topic, partition string }
+	stats := make(map[key]*logStats)
+	var maxLag int64
+	var maxBufferUtilization, maxDirtyRatio float64
+	for _, replica := range b.replicaLookup.Replicas() {
+		replica.Lock()
+		l, replicator := replica.Log, replica.Replicator
+		replica.Unlock()
+		if !replica.IsLocal || l == nil {
+			continue
+		}
+		labels := b.metricLabels(replica.Partition.Topic, replica.Partition.ID)
+		k := key{labels[1], labels[3]}
+		s, ok := stats[k]
+		if !ok {
+			s = &logStats{}
+			stats[k] = s
+		}
+		if sizer, ok := l.(interface{ Size() int64 }); ok {
+			s.size += sizer.Size()
+		}
+		s.start += l.OldestOffset()
+		s.end += l.NewestOffset()
+		if replicator != nil {
+			status := replicator.Status()
+			if status.Stuck() {
+				s.stuck++
+			}
+			s.lag += status.Lag
+			if lagTime := status.LagTime(b.clock.Now()); lagTime > s.lagTime {
+				s.lagTime = lagTime
+			}
+			if status.Lag > maxLag {
+				maxLag = status.Lag
+			}
+		}
+		if c, ok := l.(compactionLog); ok {
+			if cs, ok := c.CleanerStats(); ok && !cs.LastClean.IsZero() {
+				s.cleaned = true
+				if rate := cleanRate(cs); rate > s.cleanRate {
+					s.cleanRate = rate
+				}
+				if cs.LastClean.After(s.lastClean) {
+					s.lastClean = cs.LastClean
+				}
+				if cs.BufferUtilization > maxBufferUtilization {
+					maxBufferUtilization = cs.BufferUtilization
+				}
+				if cs.DirtyRatio > maxDirtyRatio {
+					maxDirtyRatio = cs.DirtyRatio
+				}
+			}
+		}
+	}
+	for k, s := range stats {
+		labels := []string{"topic", k.topic, "partition", k.partition}
+		m.LogSize.With(labels...).Set(float64(s.size))
+		m.LogStartOffset.With(labels...).Set(float64(s.start))
+		m.LogEndOffset.With(labels...).Set(float64(s.end))
+		m.StuckReplicas.With(labels...).Set(float64(s.stuck))
+		if m.ReplicaLag != nil && m.ReplicaLagTime != nil {
+			m.ReplicaLag.With(labels...).Set(float64(s.lag))
+			m.ReplicaLagTime.With(labels...).Set(s.lagTime.Seconds())
+		}
+		if s.cleaned && m.CleanerBytesRate != nil && m.CleanerLastClean != nil {
+			m.CleanerBytesRate.With(labels...).Set(s.cleanRate)
+			m.CleanerLastClean.With(labels...).Set(float64(s.lastClean.UnixNano()) / float64(time.Second))
+		}
+	}
+	if m.MaxLag != nil {
+		m.MaxLag.Set(float64(maxLag))
+	}
+	if m.CleanerBufferUtilization != nil && m.CleanerMaxDirtyRatio != nil {
+		m.CleanerBufferUtilization.Set(maxBufferUtilization)
+		m.CleanerMaxDirtyRatio.Set(maxDirtyRatio)
+	}
+}
+
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
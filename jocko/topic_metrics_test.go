@@ -0,0 +1,96 @@
+package jocko
+
+import (
+	"testing"
+
+	"github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/jocko/structs"
+	"github.com/travisjeffery/jocko/mock"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestBroker_TopicMetrics(t *testing.T) {
+	labels := []string{"topic", "partition"}
+	messagesIn := stdprometheus.NewCounterVec(stdprometheus.CounterOpts{Name: "messages_in"}, labels)
+	bytesIn := stdprometheus.NewCounterVec(stdprometheus.CounterOpts{Name: "bytes_in"}, labels)
+	logEnd := stdprometheus.NewGaugeVec(stdprometheus.GaugeOpts{Name: "log_end_offset"}, labels)
+	m := &Metrics{
+		MessagesIn:     prometheus.NewCounter(messagesIn),
+		BytesIn:        prometheus.NewCounter(bytesIn),
+		BytesOut:       prometheus.NewCounter(stdprometheus.NewCounterVec(stdprometheus.CounterOpts{Name: "bytes_out"}, labels)),
+		LogSize:        prometheus.NewGauge(stdprometheus.NewGaugeVec(stdprometheus.GaugeOpts{Name: "log_size"}, labels)),
+		LogStartOffset: prometheus.NewGauge(stdprometheus.NewGaugeVec(stdprometheus.GaugeOpts{Name: "log_start_offset"}, labels)),
+		LogEndOffset:   prometheus.NewGauge(logEnd),
+		StuckReplicas:  prometheus.NewGauge(stdprometheus.NewGaugeVec(stdprometheus.GaugeOpts{Name: "stuck_replicas"}, labels)),
+	}
+	one, err := protocol.Encode(&protocol.MessageSet{Messages: []*protocol.Message{{Value: []byte("a")}}})
+	require.NoError(t, err)
+	two, err := protocol.Encode(&protocol.MessageSet{Offset: 1, Messages: []*protocol.Message{{Value: []byte("b")}, {Value: []byte("c")}}})
+	require.NoError(t, err)
+	value := func(c stdprometheus.Metric) float64 {
+		var out dto.Metric
+		require.NoError(t, c.Write(&out))
+		if out.Counter != nil {
+			return out.Counter.GetValue()
+		}
+		return out.Gauge.GetValue()
+	}
+
+	tests := []struct {
+		name      string
+		config    *config.Config
+		topic     string
+		partition string
+	}{
+		{
+			name:   "aggregated partitions",
+			config: &config.Config{},
+			topic:  "a",
+		},
+		{
+			name:      "per partition",
+			config:    &config.Config{MetricsPerPartition: true},
+			topic:     "a",
+			partition: "1",
+		},
+		{
+			name:   "topic not allowed",
+			config: &config.Config{MetricsTopics: []string{"b"}},
+			topic:  otherTopicsLabel,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			messagesIn.Reset()
+			bytesIn.Reset()
+			logEnd.Reset()
+			b := &Broker{config: test.config, replicaLookup: NewReplicaLookup(), metrics: m}
+			for _, id := range []int32{0, 1} {
+				b.replicaLookup.AddReplica(&Replica{
+					IsLocal:   true,
+					Partition: structs.Partition{Topic: "a", ID: id},
+					Log: &mock.CommitLog{
+						OldestOffsetFunc: func() int64 { return 0 },
+						NewestOffsetFunc: func() int64 { return 5 },
+					},
+				})
+			}
+			b.trackProduce("a", 1, one)
+			b.trackProduce("a", 1, two)
+			b.updateLogMetrics(m)
+
+			// messages are counted rather than the record sets they're in.
+			require.Equal(t, float64(3), value(messagesIn.WithLabelValues(test.topic, test.partition)))
+			require.Equal(t, float64(len(one)+len(two)), value(bytesIn.WithLabelValues(test.topic, test.partition)))
+			end := float64(10)
+			if test.partition != "" {
+				end = 5
+			}
+			require.Equal(t, end, value(logEnd.WithLabelValues(test.topic, test.partition)))
+		})
+	}
+}
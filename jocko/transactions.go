@@ -0,0 +1,458 @@
+package jocko
+
+import (
+	"fmt"
+
+	"github.com/travisjeffery/jocko/jocko/structs"
+	"github.com/travisjeffery/jocko/log"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+// The controller coordinates transactions, storing their partitions, groups, and offsets on their
+// producers through raft like the producers' IDs, so they survive its failover. Brokers that
+// aren't the controller forward the transaction requests to it, TxnOffsetCommit included, since
+// the offsets committed in a transaction are held by it until the transaction commits. Ending a
+// transaction writes its markers to the partitions it wrote to and commits its offsets to their
+// groups' coordinators, so the offsets topic is never written transactionally.
+
+// handleAddPartitionsToTxn adds the partitions the producer's about to write to to its
+// transaction, so they're marked when it ends.
+func (b *Broker) handleAddPartitionsToTxn(ctx *Context, req *protocol.AddPartitionsToTxnRequest) *protocol.AddPartitionsToTxnResponse {
+	sp := span(ctx, b.tracer, "add partitions to txn")
+	defer sp.Finish()
+
+	if !b.isController() {
+		controller, err := b.controllerClient()
+		if err == protocol.ErrNone {
+			fres, ferr := controller.AddPartitionsToTxn(req)
+			if ferr == nil {
+				fres.APIVersion = req.Version()
+				return fres
+			}
+			log.Error.Printf("broker/%d: add partitions to txn error: forward to controller: %s", b.config.ID, ferr)
+			err = protocol.ErrCoordinatorNotAvailable
+		}
+		return addPartitionsToTxnResponse(req, nil, err)
+	}
+
+	_, err := b.txnProducer(req.TransactionalID, req.ProducerID, req.ProducerEpoch)
+	unknown := make(map[structs.TxnPartition]bool)
+	var partitions []structs.TxnPartition
+	if err == protocol.ErrNone {
+		state := b.fsm.State()
+		for _, t := range req.Topics {
+			for _, id := range t.Partitions {
+				tp := structs.TxnPartition{Topic: t.Name, Partition: id}
+				if _, p, perr := state.GetPartition(t.Name, id); perr != nil || p == nil {
+					unknown[tp] = true
+					continue
+				}
+				partitions = append(partitions, tp)
+			}
+		}
+		if len(unknown) > 0 {
+			// the transaction's left as it was so the producer can retry the request whole.
+			err = protocol.ErrOperationNotAttempted
+		} else {
+			err = b.addToTxn(structs.AddTxnPartitionsRequest{
+				TransactionalID: req.TransactionalID,
+				ProducerID:      req.ProducerID,
+				ProducerEpoch:   req.ProducerEpoch,
+				Partitions:      partitions,
+			})
+		}
+	}
+	if err != protocol.ErrNone {
+		log.Error.Printf("leader/%d: add partitions to txn error: transactional id: %q: %s", b.config.ID, req.TransactionalID, err)
+	}
+	return addPartitionsToTxnResponse(req, unknown, err)
+}
+
+// addPartitionsToTxnResponse answers the request's partitions with the error, unknown partitions
+// with an unknown topic or partition error.
+func addPartitionsToTxnResponse(req *protocol.AddPartitionsToTxnRequest, unknown map[structs.TxnPartition]bool, err protocol.Error) *protocol.AddPartitionsToTxnResponse {
+	res := &protocol.AddPartitionsToTxnResponse{APIVersion: req.Version()}
+	for _, t := range req.Topics {
+		tres := &protocol.AddPartitionsToTxnResponseAddPartitionsToTxnTopicResult{Name: t.Name}
+		for _, id := range t.Partitions {
+			code := err.Code()
+			if unknown[structs.TxnPartition{Topic: t.Name, Partition: id}] {
+				code = protocol.ErrUnknownTopicOrPartition.Code()
+			}
+			tres.Results = append(tres.Results, &protocol.AddPartitionsToTxnResponseAddPartitionsToTxnPartitionResult{PartitionIndex: id, ErrorCode: code})
+		}
+		res.Results = append(res.Results, tres)
+	}
+	return res
+}
+
+// handleAddOffsetsToTxn adds the group to the producer's transaction, so the producer can commit
+// the group's offsets in it.
+func (b *Broker) handleAddOffsetsToTxn(ctx *Context, req *protocol.AddOffsetsToTxnRequest) *protocol.AddOffsetsToTxnResponse {
+	sp := span(ctx, b.tracer, "add offsets to txn")
+	defer sp.Finish()
+	res := &protocol.AddOffsetsToTxnResponse{APIVersion: req.Version()}
+
+	if !b.isController() {
+		controller, err := b.controllerClient()
+		if err == protocol.ErrNone {
+			fres, ferr := controller.AddOffsetsToTxn(req)
+			if ferr == nil {
+				fres.APIVersion = req.Version()
+				return fres
+			}
+			log.Error.Printf("broker/%d: add offsets to txn error: forward to controller: %s", b.config.ID, ferr)
+			err = protocol.ErrCoordinatorNotAvailable
+		}
+		res.ErrorCode = err.Code()
+		return res
+	}
+
+	_, err := b.txnProducer(req.TransactionalID, req.ProducerID, req.ProducerEpoch)
+	if err == protocol.ErrNone {
+		err = b.addToTxn(structs.AddTxnPartitionsRequest{
+			TransactionalID: req.TransactionalID,
+			ProducerID:      req.ProducerID,
+			ProducerEpoch:   req.ProducerEpoch,
+			Groups:          []string{req.GroupID},
+		})
+	}
+	if err != protocol.ErrNone {
+		log.Error.Printf("leader/%d: add offsets to txn error: transactional id: %q, group: %s: %s", b.config.ID, req.TransactionalID, req.GroupID, err)
+	}
+	res.ErrorCode = err.Code()
+	return res
+}
+
+// handleTxnOffsetCommit adds the group's offsets to the producer's transaction, to be committed
+// with it. The group must have been added to the transaction.
+func (b *Broker) handleTxnOffsetCommit(ctx *Context, req *protocol.TxnOffsetCommitRequest) *protocol.TxnOffsetCommitResponse {
+	sp := span(ctx, b.tracer, "txn offset commit")
+	defer sp.Finish()
+
+	if !b.isController() {
+		controller, err := b.controllerClient()
+		if err == protocol.ErrNone {
+			fres, ferr := controller.TxnOffsetCommit(req)
+			if ferr == nil {
+				fres.APIVersion = req.Version()
+				return fres
+			}
+			log.Error.Printf("broker/%d: txn offset commit error: forward to controller: %s", b.config.ID, ferr)
+			err = protocol.ErrCoordinatorNotAvailable
+		}
+		return txnOffsetCommitResponse(req, err)
+	}
+
+	p, err := b.txnProducer(req.TransactionalID, req.ProducerID, req.ProducerEpoch)
+	if err == protocol.ErrNone && !containsString(p.Groups, req.GroupID) {
+		err = protocol.ErrInvalidTxnState.WithErr(fmt.Errorf("group %s wasn't added to the transaction", req.GroupID))
+	}
+	if err == protocol.ErrNone {
+		var offsets []structs.TxnOffset
+		for _, t := range req.Topics {
+			for _, p := range t.Partitions {
+				o := structs.TxnOffset{Group: req.GroupID, Topic: t.Name, Partition: p.PartitionIndex, Offset: p.CommittedOffset}
+				if p.CommittedMetadata != nil {
+					o.Metadata = *p.CommittedMetadata
+				}
+				offsets = append(offsets, o)
+			}
+		}
+		err = b.addToTxn(structs.AddTxnPartitionsRequest{
+			TransactionalID: req.TransactionalID,
+			ProducerID:      req.ProducerID,
+			ProducerEpoch:   req.ProducerEpoch,
+			Offsets:         offsets,
+		})
+	}
+	if err != protocol.ErrNone {
+		log.Error.Printf("leader/%d: txn offset commit error: transactional id: %q, group: %s: %s", b.config.ID, req.TransactionalID, req.GroupID, err)
+	}
+	return txnOffsetCommitResponse(req, err)
+}
+
+// txnOffsetCommitResponse answers the request's partitions with the error.
+func txnOffsetCommitResponse(req *protocol.TxnOffsetCommitRequest, err protocol.Error) *protocol.TxnOffsetCommitResponse {
+	res := &protocol.TxnOffsetCommitResponse{APIVersion: req.Version()}
+	for _, t := range req.Topics {
+		tres := &protocol.TxnOffsetCommitResponseTopic{Name: t.Name}
+		for _, p := range t.Partitions {
+			tres.Partitions = append(tres.Partitions, &protocol.TxnOffsetCommitResponsePartition{PartitionIndex: p.PartitionIndex, ErrorCode: err.Code()})
+		}
+		res.Topics = append(res.Topics, tres)
+	}
+	return res
+}
+
+// handleEndTxn commits or aborts the producer's transaction. Ending a producer that isn't in a
+// transaction succeeds, so a producer retrying the request after a lost response isn't failed.
+func (b *Broker) handleEndTxn(ctx *Context, req *protocol.EndTxnRequest) *protocol.EndTxnResponse {
+	sp := span(ctx, b.tracer, "end txn")
+	defer sp.Finish()
+	res := &protocol.EndTxnResponse{APIVersion: req.Version()}
+
+	if !b.isController() {
+		controller, err := b.controllerClient()
+		if err == protocol.ErrNone {
+			fres, ferr := controller.EndTxn(req)
+			if ferr == nil {
+				fres.APIVersion = req.Version()
+				return fres
+			}
+			log.Error.Printf("broker/%d: end txn error: forward to controller: %s", b.config.ID, ferr)
+			err = protocol.ErrCoordinatorNotAvailable
+		}
+		res.ErrorCode = err.Code()
+		return res
+	}
+
+	p, err := b.txnProducer(req.TransactionalID, req.ProducerID, req.ProducerEpoch)
+	if err == protocol.ErrNone && p.InTxn() {
+		err = b.endTxn(ctx, p, req.Committed)
+	}
+	if err != protocol.ErrNone {
+		log.Error.Printf("leader/%d: end txn error: transactional id: %q, committed: %t: %s", b.config.ID, req.TransactionalID, req.Committed, err)
+	}
+	res.ErrorCode = err.Code()
+	return res
+}
+
+// endTxn writes the transaction's markers to the partitions it wrote to, commits its offsets if
+// it's committed, and then ends it. If the markers or offsets fail the transaction's left
+// ongoing, and ending it again rewrites them, which is harmless since a partition's markers after
+// the first find no transaction to end.
+func (b *Broker) endTxn(ctx *Context, p *structs.Producer, commit bool) protocol.Error {
+	if err := b.writeTxnMarkers(p, commit); err != protocol.ErrNone {
+		return err
+	}
+	if commit {
+		if err := b.commitTxnOffsets(ctx, p); err != protocol.ErrNone {
+			return err
+		}
+	}
+	out, err := b.raftApply(structs.EndTxnRequestType, structs.EndTxnRequest{
+		TransactionalID: p.TransactionalID,
+		ProducerID:      p.ProducerID,
+		ProducerEpoch:   p.ProducerEpoch,
+	})
+	if applyErr, ok := out.(error); ok {
+		err = applyErr
+	}
+	if err != nil {
+		return protocol.ErrUnknown.WithErr(err)
+	}
+	log.Debug.Printf("leader/%d: end txn: transactional id: %q, producer id: %d, producer epoch: %d, committed: %t", b.config.ID, p.TransactionalID, p.ProducerID, p.ProducerEpoch, commit)
+	return protocol.ErrNone
+}
+
+// abortTxn aborts the transactional ID's producer's ongoing transaction, if it's in one, before
+// it's fenced by a new epoch.
+func (b *Broker) abortTxn(ctx *Context, transactionalID string) protocol.Error {
+	_, p, err := b.fsm.State().GetProducer(transactionalID)
+	if err != nil {
+		return protocol.ErrUnknown.WithErr(err)
+	}
+	if p == nil || !p.InTxn() {
+		return protocol.ErrNone
+	}
+	if err := b.endTxn(ctx, p, false); err != protocol.ErrNone {
+		log.Error.Printf("leader/%d: abort txn error: transactional id: %q: %s", b.config.ID, transactionalID, err)
+		return protocol.ErrConcurrentTransactions
+	}
+	return protocol.ErrNone
+}
+
+// writeTxnMarkers writes the transaction's commit or abort markers to the partitions it wrote to,
+// sending each leader its partitions' markers. Partitions deleted since are skipped.
+func (b *Broker) writeTxnMarkers(p *structs.Producer, commit bool) protocol.Error {
+	state := b.fsm.State()
+	leaders := make(map[int32]*protocol.WriteTxnMarkersRequestWritableTxnMarker)
+	for _, tp := range p.Partitions {
+		_, partition, err := state.GetPartition(tp.Topic, tp.Partition)
+		if err != nil {
+			return protocol.ErrUnknown.WithErr(err)
+		}
+		if partition == nil {
+			continue
+		}
+		marker, ok := leaders[partition.Leader]
+		if !ok {
+			marker = &protocol.WriteTxnMarkersRequestWritableTxnMarker{
+				ProducerID:        p.ProducerID,
+				ProducerEpoch:     p.ProducerEpoch,
+				TransactionResult: commit,
+			}
+			leaders[partition.Leader] = marker
+		}
+		var topic *protocol.WriteTxnMarkersRequestWritableTxnMarkerTopic
+		for _, t := range marker.Topics {
+			if t.Name == tp.Topic {
+				topic = t
+			}
+		}
+		if topic == nil {
+			topic = &protocol.WriteTxnMarkersRequestWritableTxnMarkerTopic{Name: tp.Topic}
+			marker.Topics = append(marker.Topics, topic)
+		}
+		topic.PartitionIndexes = append(topic.PartitionIndexes, tp.Partition)
+	}
+	for leader, marker := range leaders {
+		res, err := b.brokerClient(leader).WriteTxnMarkers(&protocol.WriteTxnMarkersRequest{
+			Markers: []*protocol.WriteTxnMarkersRequestWritableTxnMarker{marker},
+		})
+		if err != nil {
+			log.Error.Printf("leader/%d: write txn markers error: broker: %d: %s", b.config.ID, leader, err)
+			return protocol.ErrCoordinatorNotAvailable
+		}
+		for _, m := range res.Markers {
+			for _, t := range m.Topics {
+				for _, pres := range t.Partitions {
+					if pres.ErrorCode != protocol.ErrNone.Code() {
+						log.Error.Printf("leader/%d: write txn markers error: broker: %d, topic: %s, partition: %d: %d", b.config.ID, leader, t.Name, pres.PartitionIndex, pres.ErrorCode)
+						return protocol.ErrCoordinatorNotAvailable
+					}
+				}
+			}
+		}
+	}
+	return protocol.ErrNone
+}
+
+// commitTxnOffsets commits the offsets committed in the transaction to their groups' coordinators.
+func (b *Broker) commitTxnOffsets(ctx *Context, p *structs.Producer) protocol.Error {
+	groups := make(map[string]*protocol.OffsetCommitRequest)
+	for _, o := range p.Offsets {
+		req, ok := groups[o.Group]
+		if !ok {
+			req = &protocol.OffsetCommitRequest{APIVersion: 2, GroupID: o.Group, GenerationID: -1, RetentionTime: -1}
+			groups[o.Group] = req
+		}
+		var topic *protocol.OffsetCommitRequestTopic
+		for _, t := range req.Topics {
+			if t.Name == o.Topic {
+				topic = t
+			}
+		}
+		if topic == nil {
+			topic = &protocol.OffsetCommitRequestTopic{Name: o.Topic}
+			req.Topics = append(req.Topics, topic)
+		}
+		metadata := o.Metadata
+		topic.Partitions = append(topic.Partitions, &protocol.OffsetCommitRequestPartition{
+			PartitionIndex:    o.Partition,
+			CommittedOffset:   o.Offset,
+			CommittedMetadata: &metadata,
+		})
+	}
+	for group, req := range groups {
+		coordinator, err := b.findCoordinator(ctx, &protocol.FindCoordinatorRequest{CoordinatorKey: group, CoordinatorType: protocol.CoordinatorGroup})
+		if err != protocol.ErrNone {
+			return err
+		}
+		res, cerr := b.brokerClient(coordinator.ID.Int32()).OffsetCommit(req)
+		if cerr != nil {
+			log.Error.Printf("leader/%d: commit txn offsets error: group: %s: %s", b.config.ID, group, cerr)
+			return protocol.ErrCoordinatorNotAvailable
+		}
+		for _, t := range res.Topics {
+			for _, pres := range t.Partitions {
+				if pres.ErrorCode != protocol.ErrNone.Code() {
+					log.Error.Printf("leader/%d: commit txn offsets error: group: %s, topic: %s, partition: %d: %d", b.config.ID, group, t.Name, pres.PartitionIndex, pres.ErrorCode)
+					return protocol.ErrCoordinatorNotAvailable
+				}
+			}
+		}
+	}
+	return protocol.ErrNone
+}
+
+// handleWriteTxnMarkers appends the transactions' markers to the partitions this broker leads,
+// ending the transactions there.
+func (b *Broker) handleWriteTxnMarkers(ctx *Context, req *protocol.WriteTxnMarkersRequest) *protocol.WriteTxnMarkersResponse {
+	sp := span(ctx, b.tracer, "write txn markers")
+	defer sp.Finish()
+	res := &protocol.WriteTxnMarkersResponse{APIVersion: req.Version()}
+	for _, m := range req.Markers {
+		mres := &protocol.WriteTxnMarkersResponseWritableTxnMarkerResult{ProducerID: m.ProducerID}
+		for _, t := range m.Topics {
+			tres := &protocol.WriteTxnMarkersResponseWritableTxnMarkerTopicResult{Name: t.Name}
+			for _, id := range t.PartitionIndexes {
+				err := b.writeTxnMarker(t.Name, id, m)
+				if err != protocol.ErrNone {
+					log.Error.Printf("broker/%d: write txn marker error: topic: %s, partition: %d, producer id: %d: %s", b.config.ID, t.Name, id, m.ProducerID, err)
+				}
+				tres.Partitions = append(tres.Partitions, &protocol.WriteTxnMarkersResponseWritableTxnMarkerPartitionResult{PartitionIndex: id, ErrorCode: err.Code()})
+			}
+			mres.Topics = append(mres.Topics, tres)
+		}
+		res.Markers = append(res.Markers, mres)
+	}
+	return res
+}
+
+// writeTxnMarker appends the marker to the partition's log.
+func (b *Broker) writeTxnMarker(topic string, partition int32, m *protocol.WriteTxnMarkersRequestWritableTxnMarker) protocol.Error {
+	replica, err := b.replicaLookup.Replica(topic, partition)
+	if err != nil {
+		return protocol.ErrUnknownTopicOrPartition
+	}
+	if err := b.checkLeader(replica); err != protocol.ErrNone {
+		return err
+	}
+	if err := b.wakeReplica(replica); err != protocol.ErrNone {
+		return err
+	}
+	defer replica.unpin()
+	if replica.Log == nil {
+		return protocol.ErrReplicaNotAvailable
+	}
+	set, err := protocol.Encode(protocol.NewTxnMarker(m.ProducerID, m.ProducerEpoch, m.TransactionResult, m.CoordinatorEpoch, b.clock.Now()))
+	if err != nil {
+		return protocol.ErrUnknown.WithErr(err)
+	}
+	offset, err := replica.Log.Append(set)
+	if err != nil {
+		return protocol.ErrUnknown.WithErr(err)
+	}
+	b.appended(topic, partition, offset, set)
+	b.purgatory.wake(topic, partition)
+	return protocol.ErrNone
+}
+
+// txnProducer returns the transactional ID's producer if the producer ID and epoch are its
+// current ones.
+func (b *Broker) txnProducer(transactionalID string, producerID int64, producerEpoch int16) (*structs.Producer, protocol.Error) {
+	_, p, err := b.fsm.State().GetProducer(transactionalID)
+	if err != nil {
+		return nil, protocol.ErrUnknown.WithErr(err)
+	}
+	if p == nil || p.ProducerID != producerID {
+		return nil, protocol.ErrInvalidProducerIdMapping
+	}
+	if p.ProducerEpoch != producerEpoch {
+		return nil, protocol.ErrInvalidProducerEpoch
+	}
+	return p, protocol.ErrNone
+}
+
+// addToTxn adds the partitions, groups, or offsets to the producer's transaction through raft.
+func (b *Broker) addToTxn(req structs.AddTxnPartitionsRequest) protocol.Error {
+	out, err := b.raftApply(structs.AddTxnPartitionsRequestType, req)
+	if applyErr, ok := out.(error); ok {
+		err = applyErr
+	}
+	if err != nil {
+		return protocol.ErrUnknown.WithErr(err)
+	}
+	return protocol.ErrNone
+}
+
+// controllerClient returns the client of the controller, to forward the requests it handles to.
+func (b *Broker) controllerClient() (brokerClient, protocol.Error) {
+	controller := b.brokerLookup.BrokerByAddr(b.raft.Leader())
+	if controller == nil {
+		return brokerClient{}, protocol.ErrCoordinatorNotAvailable
+	}
+	return b.brokerClient(controller.ID.Int32()), protocol.ErrNone
+}
@@ -0,0 +1,160 @@
+package jocko
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestBroker_Transactions(t *testing.T) {
+	s, dir := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+
+	conn, err := Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	CreateTopic(t, conn, "txn", 1, 1)
+	WaitForTopicLeader(t, "txn", 0, s)
+
+	txnID := "connector"
+	initProducer := func() *protocol.InitProducerIDResponse {
+		res, err := conn.InitProducerID(&protocol.InitProducerIDRequest{APIVersion: 1, TransactionalID: &txnID, TransactionTimeout: time.Minute})
+		require.NoError(t, err)
+		require.Equal(t, protocol.ErrNone.Code(), res.ErrorCode)
+		return res
+	}
+	producer := initProducer()
+
+	addPartition := func(p *protocol.InitProducerIDResponse) int16 {
+		res, err := conn.AddPartitionsToTxn(&protocol.AddPartitionsToTxnRequest{
+			TransactionalID: txnID,
+			ProducerID:      p.ProducerID,
+			ProducerEpoch:   p.ProducerEpoch,
+			Topics:          []*protocol.AddPartitionsToTxnRequestAddPartitionsToTxnTopic{{Name: "txn", Partitions: []int32{0}}},
+		})
+		require.NoError(t, err)
+		return res.Results[0].Results[0].ErrorCode
+	}
+	sequence := int32(0)
+	produce := func(value string) {
+		batch, err := protocol.Encode(&protocol.RecordBatch{
+			Attributes:    protocol.TransactionalAttribute,
+			ProducerID:    producer.ProducerID,
+			ProducerEpoch: producer.ProducerEpoch,
+			FirstSequence: sequence,
+			Records:       []*protocol.Record{{Value: []byte(value)}},
+		})
+		require.NoError(t, err)
+		res, err := conn.Produce(&protocol.ProduceRequest{
+			APIVersion:      3,
+			TransactionalID: &txnID,
+			Timeout:         time.Second,
+			TopicData:       []*protocol.TopicData{{Topic: "txn", Data: []*protocol.Data{{Partition: 0, RecordSet: batch}}}},
+		})
+		require.NoError(t, err)
+		require.Equal(t, protocol.ErrNone.Code(), res.Responses[0].PartitionResponses[0].ErrorCode)
+		sequence++
+	}
+	endTxn := func(p *protocol.InitProducerIDResponse, commit bool) int16 {
+		res, err := conn.EndTxn(&protocol.EndTxnRequest{
+			TransactionalID: txnID,
+			ProducerID:      p.ProducerID,
+			ProducerEpoch:   p.ProducerEpoch,
+			Committed:       commit,
+		})
+		require.NoError(t, err)
+		return res.ErrorCode
+	}
+	fetch := func() *protocol.FetchPartitionResponse {
+		res, err := conn.Fetch(&protocol.FetchRequest{
+			APIVersion:     4,
+			MaxWaitTime:    100 * time.Millisecond,
+			MinBytes:       1,
+			IsolationLevel: protocol.ReadCommitted,
+			Topics: []*protocol.FetchTopic{{
+				Topic:      "txn",
+				Partitions: []*protocol.FetchPartition{{Partition: 0, MaxBytes: 1 << 20}},
+			}},
+		})
+		require.NoError(t, err)
+		p := res.Responses[0].PartitionResponses[0]
+		require.Equal(t, protocol.ErrNone.Code(), p.ErrorCode)
+		return p
+	}
+
+	// a transaction's records are served to read committed consumers once it's committed.
+	require.Equal(t, protocol.ErrNone.Code(), addPartition(producer))
+	produce("a")
+	require.Empty(t, fetch().RecordSet)
+	stats, err := conn.PartitionStats(&protocol.PartitionStatsRequest{Topics: []*protocol.PartitionStatsTopic{
+		{Topic: "txn", Partitions: []int32{0}},
+	}})
+	require.NoError(t, err)
+	require.Equal(t, int64(0), stats.Topics[0].Partitions[0].HighWatermark)
+	require.Equal(t, int64(-1), stats.Topics[0].Partitions[0].LastStableOffset)
+	require.Equal(t, protocol.ErrNone.Code(), endTxn(producer, true))
+	p := fetch()
+	require.NotEmpty(t, p.RecordSet)
+	require.Equal(t, int64(1), p.LastStableOffset)
+
+	// its offsets are committed with it.
+	require.Equal(t, protocol.ErrNone.Code(), addPartition(producer))
+	produce("b")
+	offsets, err := conn.AddOffsetsToTxn(&protocol.AddOffsetsToTxnRequest{
+		TransactionalID: txnID,
+		ProducerID:      producer.ProducerID,
+		ProducerEpoch:   producer.ProducerEpoch,
+		GroupID:         "group",
+	})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrNone.Code(), offsets.ErrorCode)
+	commit, err := conn.TxnOffsetCommit(&protocol.TxnOffsetCommitRequest{
+		TransactionalID: txnID,
+		GroupID:         "group",
+		ProducerID:      producer.ProducerID,
+		ProducerEpoch:   producer.ProducerEpoch,
+		Topics: []*protocol.TxnOffsetCommitRequestTopic{{
+			Name:       "txn",
+			Partitions: []*protocol.TxnOffsetCommitRequestPartition{{PartitionIndex: 0, CommittedOffset: 1}},
+		}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ErrNone.Code(), commit.Topics[0].Partitions[0].ErrorCode)
+	committed := func() int64 {
+		res, err := conn.OffsetFetch(&protocol.OffsetFetchRequest{
+			APIVersion: 1,
+			GroupID:    "group",
+			Topics:     []protocol.OffsetFetchTopicRequest{{Topic: "txn", Partitions: []int32{0}}},
+		})
+		require.NoError(t, err)
+		return res.Responses[0].Partitions[0].Offset
+	}
+	require.Equal(t, int64(-1), committed())
+	require.Equal(t, protocol.ErrNone.Code(), endTxn(producer, true))
+	require.Equal(t, int64(1), committed())
+
+	// reinitializing the producer aborts its ongoing transaction and fences off the old epoch.
+	require.Equal(t, protocol.ErrNone.Code(), addPartition(producer))
+	produce("c")
+	bumped := initProducer()
+	require.Equal(t, producer.ProducerEpoch+1, bumped.ProducerEpoch)
+	p = fetch()
+	require.Equal(t, int64(5), p.LastStableOffset)
+	require.Equal(t, []*protocol.AbortedTransaction{{ProducerID: producer.ProducerID, FirstOffset: 4}}, p.AbortedTransactions)
+	require.Equal(t, protocol.ErrInvalidProducerEpoch.Code(), addPartition(producer))
+	require.Equal(t, protocol.ErrInvalidProducerEpoch.Code(), endTxn(producer, true))
+	// ending a transaction that isn't ongoing is a no-op.
+	require.Equal(t, protocol.ErrNone.Code(), endTxn(bumped, false))
+}
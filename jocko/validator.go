@@ -0,0 +1,71 @@
+package jocko
+
+import (
+	"fmt"
+
+	"github.com/travisjeffery/jocko/jocko/structs"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+// RecordValidator checks the records produced to a topic, e.g. that their values match the
+// topic's registered JSON schema or protobuf descriptor.
+type RecordValidator interface {
+	// Validate returns an error if the record doesn't match the topic's format.
+	Validate(topic string, key, value []byte) error
+}
+
+// RecordValidatorFunc is an adapter to use an ordinary function as a RecordValidator.
+type RecordValidatorFunc func(topic string, key, value []byte) error
+
+// Validate calls f(topic, key, value).
+func (f RecordValidatorFunc) Validate(topic string, key, value []byte) error {
+	return f(topic, key, value)
+}
+
+// SetRecordValidator sets the validator records produced to the topic must pass. Message sets
+// with a record failing validation are rejected with an invalid record error. A nil validator
+// removes the topic's validator.
+func (b *Broker) SetRecordValidator(topic string, v RecordValidator) {
+	b.Lock()
+	defer b.Unlock()
+	if v == nil {
+		delete(b.validators, topic)
+		return
+	}
+	if b.validators == nil {
+		b.validators = make(map[string]RecordValidator)
+	}
+	b.validators[topic] = v
+}
+
+// checkRecords checks the produced record set fits within the topic's max message bytes, its
+// timestamps are within the topic's max difference, and it passes its validator.
+func (b *Broker) checkRecords(t *structs.Topic, recordSet []byte) protocol.Error {
+	if max, ok := t.Config.GetInt("max.message.bytes"); ok && int64(len(recordSet)) > max {
+		return protocol.ErrMessageTooLarge.WithErr(fmt.Errorf("record set of %d bytes exceeds the max message bytes: %d", len(recordSet), max))
+	}
+	if err := checkTimestamps(t, recordSet, b.clock.Now()); err != protocol.ErrNone {
+		return err
+	}
+	return b.validateRecords(t.Topic, recordSet)
+}
+
+// validateRecords checks the produced record set against the topic's validator, if it has one.
+func (b *Broker) validateRecords(topic string, recordSet []byte) protocol.Error {
+	b.RLock()
+	v := b.validators[topic]
+	b.RUnlock()
+	if v == nil {
+		return protocol.ErrNone
+	}
+	records, err := protocol.DecodeRecords(recordSet)
+	if err != nil {
+		return protocol.ErrCorruptMessage.WithErr(err)
+	}
+	for _, r := range records {
+		if err := v.Validate(topic, r.Key, r.Value); err != nil {
+			return protocol.ErrInvalidRecord.WithErr(err)
+		}
+	}
+	return protocol.ErrNone
+}
@@ -0,0 +1,36 @@
+package jocko
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestBroker_ValidateRecords(t *testing.T) {
+	b := &Broker{}
+	b.SetRecordValidator("json", RecordValidatorFunc(func(topic string, key, value []byte) error {
+		if !json.Valid(value) {
+			return errors.New("value isn't json")
+		}
+		return nil
+	}))
+	set := func(values ...string) []byte {
+		ms := &protocol.MessageSet{}
+		for _, v := range values {
+			ms.Messages = append(ms.Messages, &protocol.Message{Value: []byte(v)})
+		}
+		b, err := protocol.Encode(ms)
+		require.NoError(t, err)
+		return b
+	}
+
+	require.Equal(t, protocol.ErrNone, b.validateRecords("json", set(`{"a":1}`, `[]`)))
+	require.Equal(t, protocol.ErrInvalidRecord.Code(), b.validateRecords("json", set(`{"a":1}`, `{`)).Code())
+	require.Equal(t, protocol.ErrNone, b.validateRecords("other", set(`{`)))
+
+	b.SetRecordValidator("json", nil)
+	require.Equal(t, protocol.ErrNone, b.validateRecords("json", set(`{`)))
+}
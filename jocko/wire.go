@@ -0,0 +1,209 @@
+package jocko
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/log"
+)
+
+// Wire captures are a sequence of frames, each prefixed by the time it was read or written as
+// unix nanoseconds and whether it's a response, followed by the frame as sent on the wire
+// including its size.
+const wireCaptureHeaderSize = 9
+
+// WireFrame is a request or response frame read from a wire capture.
+type WireFrame struct {
+	Time     time.Time
+	Response bool
+	// Frame is the raw frame, its size followed by the request or response header and body.
+	Frame []byte
+}
+
+// ReadWireCapture reads the frames dumped to a wire capture file.
+func ReadWireCapture(r io.Reader) ([]WireFrame, error) {
+	br := bufio.NewReader(r)
+	var frames []WireFrame
+	for {
+		header := make([]byte, wireCaptureHeaderSize+4)
+		if _, err := io.ReadFull(br, header); err == io.EOF {
+			return frames, nil
+		} else if err != nil {
+			return frames, err
+		}
+		size := binary.BigEndian.Uint32(header[wireCaptureHeaderSize:])
+		frame := make([]byte, 4+size)
+		copy(frame, header[wireCaptureHeaderSize:])
+		if _, err := io.ReadFull(br, frame[4:]); err != nil {
+			return frames, err
+		}
+		frames = append(frames, WireFrame{
+			Time:     time.Unix(0, int64(binary.BigEndian.Uint64(header))),
+			Response: header[8] == 1,
+			Frame:    frame,
+		})
+	}
+}
+
+// wireFilter matches the connections whose requests and responses are logged and captured.
+type wireFilter struct {
+	clientIDs map[string]bool
+	nets      []*net.IPNet
+}
+
+func newWireFilter(c *config.Config) *wireFilter {
+	f := &wireFilter{}
+	if len(c.WireClientIDs) > 0 {
+		f.clientIDs = make(map[string]bool, len(c.WireClientIDs))
+		for _, id := range c.WireClientIDs {
+			f.clientIDs[id] = true
+		}
+	}
+	for _, cidr := range c.WireCIDRs {
+		// the config's validated so the cidrs parse.
+		if _, n, err := net.ParseCIDR(cidr); err == nil {
+			f.nets = append(f.nets, n)
+		}
+	}
+	return f
+}
+
+func (f *wireFilter) matchAddr(addr net.Addr) bool {
+	if len(f.nets) == 0 {
+		return true
+	}
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, n := range f.nets {
+		if n.Contains(tcp.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *wireFilter) matchClientID(id string) bool {
+	return f.clientIDs == nil || f.clientIDs[id]
+}
+
+// wireConn logs and captures the requests and responses of a connection matching the wire
+// filters. Responses are written from the server's response goroutine so it's locked.
+type wireConn struct {
+	brokerID   int32
+	remote     string
+	filter     *wireFilter
+	log        bool
+	maxBytes   int
+	captureDir string
+
+	mu      sync.Mutex
+	capture *bufio.Writer
+	file    *os.File
+	closed  bool
+}
+
+// newWireConn returns the wire debugger for the connection, or nil if its requests aren't logged
+// or captured.
+func (s *Server) newWireConn(conn net.Conn) *wireConn {
+	if !s.config.WireLog && s.config.WireCaptureDir == "" {
+		return nil
+	}
+	if !s.wireFilter.matchAddr(conn.RemoteAddr()) {
+		return nil
+	}
+	return &wireConn{
+		brokerID:   s.config.ID,
+		remote:     conn.RemoteAddr().String(),
+		filter:     s.wireFilter,
+		log:        s.config.WireLog,
+		maxBytes:   s.config.WireLogMaxBytes,
+		captureDir: s.config.WireCaptureDir,
+	}
+}
+
+// request logs and captures the request if its client ID matches the filter, returning whether
+// it did so its response is too.
+func (w *wireConn) request(clientID string, apiKey, apiVersion int16, correlationID int32, req interface{}, frame []byte) bool {
+	if !w.filter.matchClientID(clientID) {
+		return false
+	}
+	if w.log {
+		log.Info.Printf("wire/%d: %s: client %s: request: api key: %d, version: %d, correlation id: %d: %s", w.brokerID, w.remote, clientID, apiKey, apiVersion, correlationID, w.truncate(req))
+	}
+	w.write(false, frame)
+	return true
+}
+
+// response logs and captures the response, its frame given as the buffers written.
+func (w *wireConn) response(correlationID int32, res interface{}, bufs ...[]byte) {
+	if w.log {
+		log.Info.Printf("wire/%d: %s: response: correlation id: %d: %s", w.brokerID, w.remote, correlationID, w.truncate(res))
+	}
+	w.write(true, bufs...)
+}
+
+func (w *wireConn) truncate(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("<%s>", err)
+	}
+	if w.maxBytes > 0 && len(b) > w.maxBytes {
+		return fmt.Sprintf("%s... (%d bytes truncated)", b[:w.maxBytes], len(b)-w.maxBytes)
+	}
+	return string(b)
+}
+
+// write appends the frame to the connection's capture file, created on its first frame.
+func (w *wireConn) write(response bool, bufs ...[]byte) {
+	if w.captureDir == "" {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	if w.capture == nil {
+		name := fmt.Sprintf("%d-%s.capture", time.Now().UnixNano(), strings.NewReplacer(":", "_", "[", "", "]", "").Replace(w.remote))
+		f, err := os.Create(filepath.Join(w.captureDir, name))
+		if err != nil {
+			log.Error.Printf("wire/%d: %s: create capture file error: %s", w.brokerID, w.remote, err)
+			w.closed = true
+			return
+		}
+		w.file, w.capture = f, bufio.NewWriter(f)
+	}
+	header := make([]byte, wireCaptureHeaderSize)
+	binary.BigEndian.PutUint64(header, uint64(time.Now().UnixNano()))
+	if response {
+		header[8] = 1
+	}
+	w.capture.Write(header)
+	for _, b := range bufs {
+		w.capture.Write(b)
+	}
+	if err := w.capture.Flush(); err != nil {
+		log.Error.Printf("wire/%d: %s: write capture file error: %s", w.brokerID, w.remote, err)
+	}
+}
+
+func (w *wireConn) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	if w.file != nil {
+		w.file.Close()
+	}
+}
@@ -0,0 +1,73 @@
+package jocko
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/jocko/jocko/config"
+	"github.com/travisjeffery/jocko/protocol"
+)
+
+func TestServer_WireCapture(t *testing.T) {
+	captureDir, err := ioutil.TempDir("", "jocko-wire")
+	require.NoError(t, err)
+	defer os.RemoveAll(captureDir)
+
+	s, dir := NewTestServer(t, func(cfg *config.Config) {
+		cfg.Bootstrap = true
+		cfg.BootstrapExpect = 1
+		cfg.StartAsLeader = true
+		cfg.OffsetsTopicReplicationFactor = 1
+		cfg.WireLog = true
+		cfg.WireCaptureDir = captureDir
+		cfg.WireClientIDs = []string{"debug-client"}
+		cfg.WireCIDRs = []string{"127.0.0.0/8"}
+	}, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.Start(context.Background()))
+	defer s.Shutdown()
+
+	// connections from other clients aren't captured.
+	other, err := Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer other.Close()
+	_, err = other.APIVersions(&protocol.APIVersionsRequest{})
+	require.NoError(t, err)
+
+	conn, err := NewDialer("debug-client").Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.APIVersions(&protocol.APIVersionsRequest{})
+	require.NoError(t, err)
+
+	files, err := ioutil.ReadDir(captureDir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	f, err := os.Open(filepath.Join(captureDir, files[0].Name()))
+	require.NoError(t, err)
+	defer f.Close()
+	frames, err := ReadWireCapture(f)
+	require.NoError(t, err)
+	require.Len(t, frames, 2)
+
+	require.False(t, frames[0].Response)
+	header := new(protocol.RequestHeader)
+	require.NoError(t, header.Decode(protocol.NewDecoder(frames[0].Frame)))
+	require.Equal(t, int16(protocol.APIVersionsKey), header.APIKey)
+	require.Equal(t, "debug-client", header.ClientID)
+
+	require.True(t, frames[1].Response)
+	require.Equal(t, header.CorrelationID, int32(protocol.Encoding.Uint32(frames[1].Frame[4:])))
+	require.False(t, frames[1].Time.Before(frames[0].Time))
+}
+
+func TestWireConnTruncate(t *testing.T) {
+	w := &wireConn{maxBytes: 8}
+	require.Equal(t, `{"Topic"... (14 bytes truncated)`, w.truncate(struct{ Topic string }{"test-topic"}))
+	w.maxBytes = 0
+	require.Equal(t, `{"Topic":"test-topic"}`, w.truncate(struct{ Topic string }{"test-topic"}))
+}
@@ -1,6 +1,7 @@
 package log
 
 import (
+	"io"
 	stdlog "log"
 
 	"upspin.io/log"
@@ -44,6 +45,11 @@ func SetPrefix(prefix string) {
 	}
 }
 
+// SetOutput sets the writer the loggers write to.
+func SetOutput(w io.Writer) {
+	log.SetOutput(w)
+}
+
 func SetLevel(level string) {
 	log.SetLevel(level)
 }
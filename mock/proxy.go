@@ -19,28 +19,36 @@ func NewClient(msgCount int) *Client {
 	}
 }
 
+// Messages returns the message sets fetched, in offset order.
 func (p *Client) Messages() [][]byte {
 	return p.msgs
 }
 
 func (p *Client) Fetch(fetchRequest *protocol.FetchRequest) (*protocol.FetchResponse, error) {
-	if len(p.msgs) >= p.msgCount {
+	offset := fetchRequest.Topics[0].Partitions[0].FetchOffset
+	if offset >= int64(p.msgCount) {
 		return &protocol.FetchResponse{}, nil
 	}
-	msgs := [][]byte{
-		[]byte("msg " + strconv.Itoa(len(p.msgs))),
+	for int64(len(p.msgs)) <= offset {
+		set, err := protocol.Encode(&protocol.MessageSet{
+			Offset:   int64(len(p.msgs)),
+			Messages: []*protocol.Message{{Value: []byte("msg " + strconv.Itoa(len(p.msgs)))}},
+		})
+		if err != nil {
+			return nil, err
+		}
+		p.msgs = append(p.msgs, set)
 	}
 	response := &protocol.FetchResponse{
 		Responses: protocol.FetchTopicResponses{{
 			Topic: fetchRequest.Topics[0].Topic,
 			PartitionResponses: []*protocol.FetchPartitionResponse{{
-				RecordSet: msgs[0],
+				RecordSet: p.msgs[offset],
 			},
 			},
 		},
 		},
 	}
-	p.msgs = append(p.msgs, msgs...)
 	return response, nil
 }
 
@@ -0,0 +1,198 @@
+package mock
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// Future is a scriptable raft future. Error blocks for the delay, then returns the error.
+type Future struct {
+	Err   error
+	Delay time.Duration
+	// Idx is the index returned by Index.
+	Idx uint64
+	// Resp is the FSM's response returned by Response for applies.
+	Resp interface{}
+	// Config is the configuration returned by Configuration.
+	Config raft.Configuration
+}
+
+func (f *Future) Error() error {
+	time.Sleep(f.Delay)
+	return f.Err
+}
+
+func (f *Future) Index() uint64 {
+	return f.Idx
+}
+
+func (f *Future) Response() interface{} {
+	return f.Resp
+}
+
+func (f *Future) Configuration() raft.Configuration {
+	return f.Config
+}
+
+// Raft is a mock implementation of jocko.Raft. Methods whose funcs are nil return futures that
+// succeed right away, or zero values, so tests only script the calls they care about. The commands
+// applied and the servers added and removed are recorded for assertions.
+//
+//	r := &mock.Raft{
+//	    ApplyFunc: func(cmd []byte, timeout time.Duration) raft.ApplyFuture {
+//	        return &mock.Future{Err: raft.ErrNotLeader, Delay: 10 * time.Millisecond}
+//	    },
+//	}
+type Raft struct {
+	ApplyFunc            func(cmd []byte, timeout time.Duration) raft.ApplyFuture
+	BarrierFunc          func(timeout time.Duration) raft.Future
+	AddVoterFunc         func(id raft.ServerID, address raft.ServerAddress, prevIndex uint64, timeout time.Duration) raft.IndexFuture
+	AddNonvoterFunc      func(id raft.ServerID, address raft.ServerAddress, prevIndex uint64, timeout time.Duration) raft.IndexFuture
+	RemoveServerFunc     func(id raft.ServerID, prevIndex uint64, timeout time.Duration) raft.IndexFuture
+	BootstrapClusterFunc func(configuration raft.Configuration) raft.Future
+	GetConfigurationFunc func() raft.ConfigurationFuture
+	LeaderFunc           func() raft.ServerAddress
+	StateFunc            func() raft.RaftState
+	LastIndexFunc        func() uint64
+	AppliedIndexFunc     func() uint64
+	StatsFunc            func() map[string]string
+	ShutdownFunc         func() raft.Future
+
+	mu      sync.Mutex
+	applied [][]byte
+	added   []raft.Server
+	removed []raft.ServerID
+}
+
+// Applied returns the commands applied, in order.
+func (r *Raft) Applied() [][]byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([][]byte(nil), r.applied...)
+}
+
+// Added returns the servers added as voters or nonvoters, in order.
+func (r *Raft) Added() []raft.Server {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]raft.Server(nil), r.added...)
+}
+
+// Removed returns the IDs of the servers removed, in order.
+func (r *Raft) Removed() []raft.ServerID {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]raft.ServerID(nil), r.removed...)
+}
+
+// Reset resets the calls recorded.
+func (r *Raft) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.applied, r.added, r.removed = nil, nil, nil
+}
+
+func (r *Raft) Apply(cmd []byte, timeout time.Duration) raft.ApplyFuture {
+	r.mu.Lock()
+	r.applied = append(r.applied, cmd)
+	r.mu.Unlock()
+	if r.ApplyFunc == nil {
+		return &Future{}
+	}
+	return r.ApplyFunc(cmd, timeout)
+}
+
+func (r *Raft) Barrier(timeout time.Duration) raft.Future {
+	if r.BarrierFunc == nil {
+		return &Future{}
+	}
+	return r.BarrierFunc(timeout)
+}
+
+func (r *Raft) AddVoter(id raft.ServerID, address raft.ServerAddress, prevIndex uint64, timeout time.Duration) raft.IndexFuture {
+	r.mu.Lock()
+	r.added = append(r.added, raft.Server{Suffrage: raft.Voter, ID: id, Address: address})
+	r.mu.Unlock()
+	if r.AddVoterFunc == nil {
+		return &Future{}
+	}
+	return r.AddVoterFunc(id, address, prevIndex, timeout)
+}
+
+func (r *Raft) AddNonvoter(id raft.ServerID, address raft.ServerAddress, prevIndex uint64, timeout time.Duration) raft.IndexFuture {
+	r.mu.Lock()
+	r.added = append(r.added, raft.Server{Suffrage: raft.Nonvoter, ID: id, Address: address})
+	r.mu.Unlock()
+	if r.AddNonvoterFunc == nil {
+		return &Future{}
+	}
+	return r.AddNonvoterFunc(id, address, prevIndex, timeout)
+}
+
+func (r *Raft) RemoveServer(id raft.ServerID, prevIndex uint64, timeout time.Duration) raft.IndexFuture {
+	r.mu.Lock()
+	r.removed = append(r.removed, id)
+	r.mu.Unlock()
+	if r.RemoveServerFunc == nil {
+		return &Future{}
+	}
+	return r.RemoveServerFunc(id, prevIndex, timeout)
+}
+
+func (r *Raft) BootstrapCluster(configuration raft.Configuration) raft.Future {
+	if r.BootstrapClusterFunc == nil {
+		return &Future{}
+	}
+	return r.BootstrapClusterFunc(configuration)
+}
+
+func (r *Raft) GetConfiguration() raft.ConfigurationFuture {
+	if r.GetConfigurationFunc == nil {
+		return &Future{}
+	}
+	return r.GetConfigurationFunc()
+}
+
+func (r *Raft) Leader() raft.ServerAddress {
+	if r.LeaderFunc == nil {
+		return ""
+	}
+	return r.LeaderFunc()
+}
+
+func (r *Raft) State() raft.RaftState {
+	if r.StateFunc == nil {
+		return raft.Follower
+	}
+	return r.StateFunc()
+}
+
+func (r *Raft) LastIndex() uint64 {
+	if r.LastIndexFunc == nil {
+		return 0
+	}
+	return r.LastIndexFunc()
+}
+
+func (r *Raft) AppliedIndex() uint64 {
+	if r.AppliedIndexFunc == nil {
+		return 0
+	}
+	return r.AppliedIndexFunc()
+}
+
+func (r *Raft) Stats() map[string]string {
+	if r.StatsFunc == nil {
+		return map[string]string{}
+	}
+	return r.StatsFunc()
+}
+
+func (r *Raft) Shutdown() raft.Future {
+	if r.ShutdownFunc == nil {
+		return &Future{}
+	}
+	return r.ShutdownFunc()
+}
@@ -0,0 +1,78 @@
+package mock
+
+import (
+	"sync"
+
+	"github.com/hashicorp/serf/serf"
+)
+
+// Serf is a mock implementation of jocko.Serf. Joins succeed, joining every address, unless
+// JoinFunc's set, and the addresses joined are recorded for assertions. The local member's tags
+// are the last ones set.
+type Serf struct {
+	JoinFunc     func(existing []string, ignoreOld bool) (int, error)
+	LeaveFunc    func() error
+	MembersFunc  func() []serf.Member
+	SetTagsFunc  func(tags map[string]string) error
+	ShutdownFunc func() error
+
+	mu     sync.Mutex
+	joined [][]string
+	tags   map[string]string
+}
+
+// Joined returns the addresses of each join, in order.
+func (s *Serf) Joined() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]string(nil), s.joined...)
+}
+
+func (s *Serf) Join(existing []string, ignoreOld bool) (int, error) {
+	s.mu.Lock()
+	s.joined = append(s.joined, existing)
+	s.mu.Unlock()
+	if s.JoinFunc == nil {
+		return len(existing), nil
+	}
+	return s.JoinFunc(existing, ignoreOld)
+}
+
+func (s *Serf) Leave() error {
+	if s.LeaveFunc == nil {
+		return nil
+	}
+	return s.LeaveFunc()
+}
+
+func (s *Serf) Members() []serf.Member {
+	if s.MembersFunc == nil {
+		return nil
+	}
+	return s.MembersFunc()
+}
+
+func (s *Serf) LocalMember() serf.Member {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return serf.Member{Tags: s.tags, Status: serf.StatusAlive}
+}
+
+func (s *Serf) SetTags(tags map[string]string) error {
+	if s.SetTagsFunc != nil {
+		if err := s.SetTagsFunc(tags); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tags = tags
+	return nil
+}
+
+func (s *Serf) Shutdown() error {
+	if s.ShutdownFunc == nil {
+		return nil
+	}
+	return s.ShutdownFunc()
+}
@@ -0,0 +1,100 @@
+// Code generated by protocol/gen from schemas/AddOffsetsToTxnRequest.json. DO NOT EDIT.
+
+package protocol
+
+func init() {
+	flexibleVersions[AddOffsetsToTxnKey] = 3
+}
+
+// AddOffsetsToTxnRequest is the AddOffsetsToTxn API's request, versions 0-3.
+type AddOffsetsToTxnRequest struct {
+	APIVersion int16
+
+	// The transactional id corresponding to the transaction.
+	TransactionalID string
+	// Current producer id in use by the transactional id.
+	ProducerID int64
+	// Current epoch associated with the producer id.
+	ProducerEpoch int16
+	// The unique group identifier.
+	GroupID string
+	// TaggedFields are the tagged fields of flexible versions unknown to this struct.
+	TaggedFields TaggedFields
+}
+
+func (r *AddOffsetsToTxnRequest) Encode(e PacketEncoder) error {
+	return r.encode(e, r.APIVersion)
+}
+
+func (r *AddOffsetsToTxnRequest) Decode(d PacketDecoder, version int16) error {
+	r.APIVersion = version
+	return r.decode(d, version)
+}
+
+func (r *AddOffsetsToTxnRequest) Key() int16 {
+	return AddOffsetsToTxnKey
+}
+
+func (r *AddOffsetsToTxnRequest) Version() int16 {
+	return r.APIVersion
+}
+
+func (r *AddOffsetsToTxnRequest) encode(e PacketEncoder, version int16) (err error) {
+	flexible := version >= 3
+	if flexible {
+		err = e.PutCompactString(r.TransactionalID)
+	} else {
+		err = e.PutString(r.TransactionalID)
+	}
+	if err != nil {
+		return err
+	}
+	e.PutInt64(r.ProducerID)
+	e.PutInt16(r.ProducerEpoch)
+	if flexible {
+		err = e.PutCompactString(r.GroupID)
+	} else {
+		err = e.PutString(r.GroupID)
+	}
+	if err != nil {
+		return err
+	}
+	if flexible {
+		if err = e.PutTaggedFields(r.TaggedFields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *AddOffsetsToTxnRequest) decode(d PacketDecoder, version int16) (err error) {
+	flexible := version >= 3
+	if flexible {
+		r.TransactionalID, err = d.CompactString()
+	} else {
+		r.TransactionalID, err = d.String()
+	}
+	if err != nil {
+		return err
+	}
+	if r.ProducerID, err = d.Int64(); err != nil {
+		return err
+	}
+	if r.ProducerEpoch, err = d.Int16(); err != nil {
+		return err
+	}
+	if flexible {
+		r.GroupID, err = d.CompactString()
+	} else {
+		r.GroupID, err = d.String()
+	}
+	if err != nil {
+		return err
+	}
+	if flexible {
+		if r.TaggedFields, err = d.TaggedFields(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
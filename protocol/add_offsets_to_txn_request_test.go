@@ -0,0 +1,28 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddOffsetsToTxnRequest(t *testing.T) {
+	req := require.New(t)
+	exp := &AddOffsetsToTxnRequest{APIVersion: 1, TransactionalID: "txn", ProducerID: 7, ProducerEpoch: 1, GroupID: "group"}
+	b, err := Encode(exp)
+	req.NoError(err)
+	var act AddOffsetsToTxnRequest
+	req.NoError(Decode(b, &act, exp.Version()))
+	req.Equal(exp, &act)
+}
+
+func TestAddOffsetsToTxnResponse(t *testing.T) {
+	req := require.New(t)
+	exp := &AddOffsetsToTxnResponse{APIVersion: 1, ThrottleTime: time.Second, ErrorCode: ErrNotCoordinator.Code()}
+	b, err := Encode(exp)
+	req.NoError(err)
+	var act AddOffsetsToTxnResponse
+	req.NoError(Decode(b, &act, exp.Version()))
+	req.Equal(exp, &act)
+}
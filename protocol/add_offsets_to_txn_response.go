@@ -0,0 +1,64 @@
+// Code generated by protocol/gen from schemas/AddOffsetsToTxnResponse.json. DO NOT EDIT.
+
+package protocol
+
+import "time"
+
+// AddOffsetsToTxnResponse is the AddOffsetsToTxn API's response, versions 0-3.
+type AddOffsetsToTxnResponse struct {
+	APIVersion int16
+
+	// Duration in milliseconds for which the request was throttled due to a quota violation, or zero if the request did not violate any quota.
+	ThrottleTime time.Duration
+	// The response error code, or 0 if there was no error.
+	ErrorCode int16
+	// TaggedFields are the tagged fields of flexible versions unknown to this struct.
+	TaggedFields TaggedFields
+}
+
+func (r *AddOffsetsToTxnResponse) Encode(e PacketEncoder) error {
+	return r.encode(e, r.APIVersion)
+}
+
+func (r *AddOffsetsToTxnResponse) Decode(d PacketDecoder, version int16) error {
+	r.APIVersion = version
+	return r.decode(d, version)
+}
+
+func (r *AddOffsetsToTxnResponse) Key() int16 {
+	return AddOffsetsToTxnKey
+}
+
+func (r *AddOffsetsToTxnResponse) Version() int16 {
+	return r.APIVersion
+}
+
+func (r *AddOffsetsToTxnResponse) encode(e PacketEncoder, version int16) (err error) {
+	flexible := version >= 3
+	e.PutInt32(int32(r.ThrottleTime / time.Millisecond))
+	e.PutInt16(r.ErrorCode)
+	if flexible {
+		if err = e.PutTaggedFields(r.TaggedFields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *AddOffsetsToTxnResponse) decode(d PacketDecoder, version int16) (err error) {
+	flexible := version >= 3
+	if ms, err := d.Int32(); err != nil {
+		return err
+	} else {
+		r.ThrottleTime = time.Duration(ms) * time.Millisecond
+	}
+	if r.ErrorCode, err = d.Int16(); err != nil {
+		return err
+	}
+	if flexible {
+		if r.TaggedFields, err = d.TaggedFields(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
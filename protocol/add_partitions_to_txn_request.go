@@ -0,0 +1,189 @@
+// Code generated by protocol/gen from schemas/AddPartitionsToTxnRequest.json. DO NOT EDIT.
+
+package protocol
+
+func init() {
+	flexibleVersions[AddPartitionsToTxnKey] = 3
+}
+
+// AddPartitionsToTxnRequest is the AddPartitionsToTxn API's request, versions 0-3.
+type AddPartitionsToTxnRequest struct {
+	APIVersion int16
+
+	// The transactional id corresponding to the transaction.
+	TransactionalID string
+	// Current producer id in use by the transactional id.
+	ProducerID int64
+	// Current epoch associated with the producer id.
+	ProducerEpoch int16
+	// The partitions to add to the transaction.
+	Topics []*AddPartitionsToTxnRequestAddPartitionsToTxnTopic
+	// TaggedFields are the tagged fields of flexible versions unknown to this struct.
+	TaggedFields TaggedFields
+}
+
+// AddPartitionsToTxnRequestAddPartitionsToTxnTopic is an element of AddPartitionsToTxnRequest's Topics.
+type AddPartitionsToTxnRequestAddPartitionsToTxnTopic struct {
+	// The name of the topic.
+	Name string
+	// The partition indexes to add to the transaction
+	Partitions []int32
+	// TaggedFields are the tagged fields of flexible versions unknown to this struct.
+	TaggedFields TaggedFields
+}
+
+func (r *AddPartitionsToTxnRequest) Encode(e PacketEncoder) error {
+	return r.encode(e, r.APIVersion)
+}
+
+func (r *AddPartitionsToTxnRequest) Decode(d PacketDecoder, version int16) error {
+	r.APIVersion = version
+	return r.decode(d, version)
+}
+
+func (r *AddPartitionsToTxnRequest) Key() int16 {
+	return AddPartitionsToTxnKey
+}
+
+func (r *AddPartitionsToTxnRequest) Version() int16 {
+	return r.APIVersion
+}
+
+func (r *AddPartitionsToTxnRequest) encode(e PacketEncoder, version int16) (err error) {
+	flexible := version >= 3
+	if flexible {
+		err = e.PutCompactString(r.TransactionalID)
+	} else {
+		err = e.PutString(r.TransactionalID)
+	}
+	if err != nil {
+		return err
+	}
+	e.PutInt64(r.ProducerID)
+	e.PutInt16(r.ProducerEpoch)
+	if flexible {
+		err = e.PutCompactArrayLength(len(r.Topics))
+	} else {
+		err = e.PutArrayLength(len(r.Topics))
+	}
+	if err != nil {
+		return err
+	}
+	for _, v := range r.Topics {
+		if err = v.encode(e, version); err != nil {
+			return err
+		}
+	}
+	if flexible {
+		if err = e.PutTaggedFields(r.TaggedFields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *AddPartitionsToTxnRequest) decode(d PacketDecoder, version int16) (err error) {
+	flexible := version >= 3
+	var n int
+	if flexible {
+		r.TransactionalID, err = d.CompactString()
+	} else {
+		r.TransactionalID, err = d.String()
+	}
+	if err != nil {
+		return err
+	}
+	if r.ProducerID, err = d.Int64(); err != nil {
+		return err
+	}
+	if r.ProducerEpoch, err = d.Int16(); err != nil {
+		return err
+	}
+	if flexible {
+		n, err = d.CompactArrayLength()
+	} else {
+		n, err = d.ArrayLength()
+	}
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		r.Topics = make([]*AddPartitionsToTxnRequestAddPartitionsToTxnTopic, n)
+		for i := range r.Topics {
+			r.Topics[i] = new(AddPartitionsToTxnRequestAddPartitionsToTxnTopic)
+			if err = r.Topics[i].decode(d, version); err != nil {
+				return err
+			}
+		}
+	}
+	if flexible {
+		if r.TaggedFields, err = d.TaggedFields(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *AddPartitionsToTxnRequestAddPartitionsToTxnTopic) encode(e PacketEncoder, version int16) (err error) {
+	flexible := version >= 3
+	if flexible {
+		err = e.PutCompactString(r.Name)
+	} else {
+		err = e.PutString(r.Name)
+	}
+	if err != nil {
+		return err
+	}
+	if flexible {
+		err = e.PutCompactArrayLength(len(r.Partitions))
+	} else {
+		err = e.PutArrayLength(len(r.Partitions))
+	}
+	if err != nil {
+		return err
+	}
+	for _, v := range r.Partitions {
+		e.PutInt32(v)
+	}
+	if flexible {
+		if err = e.PutTaggedFields(r.TaggedFields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *AddPartitionsToTxnRequestAddPartitionsToTxnTopic) decode(d PacketDecoder, version int16) (err error) {
+	flexible := version >= 3
+	var n int
+	if flexible {
+		r.Name, err = d.CompactString()
+	} else {
+		r.Name, err = d.String()
+	}
+	if err != nil {
+		return err
+	}
+	if flexible {
+		n, err = d.CompactArrayLength()
+	} else {
+		n, err = d.ArrayLength()
+	}
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		r.Partitions = make([]int32, n)
+		for i := range r.Partitions {
+			if r.Partitions[i], err = d.Int32(); err != nil {
+				return err
+			}
+		}
+	}
+	if flexible {
+		if r.TaggedFields, err = d.TaggedFields(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddPartitionsToTxnRequest(t *testing.T) {
+	req := require.New(t)
+	for _, version := range []int16{0, 3} {
+		exp := &AddPartitionsToTxnRequest{
+			APIVersion:      version,
+			TransactionalID: "txn",
+			ProducerID:      7,
+			ProducerEpoch:   1,
+			Topics:          []*AddPartitionsToTxnRequestAddPartitionsToTxnTopic{{Name: "a", Partitions: []int32{0, 2}}},
+		}
+		b, err := Encode(exp)
+		req.NoError(err)
+		var act AddPartitionsToTxnRequest
+		req.NoError(Decode(b, &act, exp.Version()))
+		req.Equal(exp, &act)
+	}
+}
+
+func TestAddPartitionsToTxnResponse(t *testing.T) {
+	req := require.New(t)
+	exp := &AddPartitionsToTxnResponse{
+		APIVersion:   1,
+		ThrottleTime: time.Second,
+		Results: []*AddPartitionsToTxnResponseAddPartitionsToTxnTopicResult{{
+			Name:    "a",
+			Results: []*AddPartitionsToTxnResponseAddPartitionsToTxnPartitionResult{{PartitionIndex: 2, ErrorCode: ErrInvalidProducerEpoch.Code()}},
+		}},
+	}
+	b, err := Encode(exp)
+	req.NoError(err)
+	var act AddPartitionsToTxnResponse
+	req.NoError(Decode(b, &act, exp.Version()))
+	req.Equal(exp, &act)
+}
@@ -0,0 +1,206 @@
+// Code generated by protocol/gen from schemas/AddPartitionsToTxnResponse.json. DO NOT EDIT.
+
+package protocol
+
+import "time"
+
+// AddPartitionsToTxnResponse is the AddPartitionsToTxn API's response, versions 0-3.
+type AddPartitionsToTxnResponse struct {
+	APIVersion int16
+
+	// Duration in milliseconds for which the request was throttled due to a quota violation, or zero if the request did not violate any quota.
+	ThrottleTime time.Duration
+	// The results for each topic.
+	Results []*AddPartitionsToTxnResponseAddPartitionsToTxnTopicResult
+	// TaggedFields are the tagged fields of flexible versions unknown to this struct.
+	TaggedFields TaggedFields
+}
+
+// AddPartitionsToTxnResponseAddPartitionsToTxnTopicResult is an element of AddPartitionsToTxnResponse's Results.
+type AddPartitionsToTxnResponseAddPartitionsToTxnTopicResult struct {
+	// The topic name.
+	Name string
+	// The results for each partition
+	Results []*AddPartitionsToTxnResponseAddPartitionsToTxnPartitionResult
+	// TaggedFields are the tagged fields of flexible versions unknown to this struct.
+	TaggedFields TaggedFields
+}
+
+// AddPartitionsToTxnResponseAddPartitionsToTxnPartitionResult is an element of AddPartitionsToTxnResponseAddPartitionsToTxnTopicResult's Results.
+type AddPartitionsToTxnResponseAddPartitionsToTxnPartitionResult struct {
+	// The partition indexes.
+	PartitionIndex int32
+	// The response error code.
+	ErrorCode int16
+	// TaggedFields are the tagged fields of flexible versions unknown to this struct.
+	TaggedFields TaggedFields
+}
+
+func (r *AddPartitionsToTxnResponse) Encode(e PacketEncoder) error {
+	return r.encode(e, r.APIVersion)
+}
+
+func (r *AddPartitionsToTxnResponse) Decode(d PacketDecoder, version int16) error {
+	r.APIVersion = version
+	return r.decode(d, version)
+}
+
+func (r *AddPartitionsToTxnResponse) Key() int16 {
+	return AddPartitionsToTxnKey
+}
+
+func (r *AddPartitionsToTxnResponse) Version() int16 {
+	return r.APIVersion
+}
+
+func (r *AddPartitionsToTxnResponse) encode(e PacketEncoder, version int16) (err error) {
+	flexible := version >= 3
+	e.PutInt32(int32(r.ThrottleTime / time.Millisecond))
+	if flexible {
+		err = e.PutCompactArrayLength(len(r.Results))
+	} else {
+		err = e.PutArrayLength(len(r.Results))
+	}
+	if err != nil {
+		return err
+	}
+	for _, v := range r.Results {
+		if err = v.encode(e, version); err != nil {
+			return err
+		}
+	}
+	if flexible {
+		if err = e.PutTaggedFields(r.TaggedFields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *AddPartitionsToTxnResponse) decode(d PacketDecoder, version int16) (err error) {
+	flexible := version >= 3
+	var n int
+	if ms, err := d.Int32(); err != nil {
+		return err
+	} else {
+		r.ThrottleTime = time.Duration(ms) * time.Millisecond
+	}
+	if flexible {
+		n, err = d.CompactArrayLength()
+	} else {
+		n, err = d.ArrayLength()
+	}
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		r.Results = make([]*AddPartitionsToTxnResponseAddPartitionsToTxnTopicResult, n)
+		for i := range r.Results {
+			r.Results[i] = new(AddPartitionsToTxnResponseAddPartitionsToTxnTopicResult)
+			if err = r.Results[i].decode(d, version); err != nil {
+				return err
+			}
+		}
+	}
+	if flexible {
+		if r.TaggedFields, err = d.TaggedFields(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *AddPartitionsToTxnResponseAddPartitionsToTxnTopicResult) encode(e PacketEncoder, version int16) (err error) {
+	flexible := version >= 3
+	if flexible {
+		err = e.PutCompactString(r.Name)
+	} else {
+		err = e.PutString(r.Name)
+	}
+	if err != nil {
+		return err
+	}
+	if flexible {
+		err = e.PutCompactArrayLength(len(r.Results))
+	} else {
+		err = e.PutArrayLength(len(r.Results))
+	}
+	if err != nil {
+		return err
+	}
+	for _, v := range r.Results {
+		if err = v.encode(e, version); err != nil {
+			return err
+		}
+	}
+	if flexible {
+		if err = e.PutTaggedFields(r.TaggedFields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *AddPartitionsToTxnResponseAddPartitionsToTxnTopicResult) decode(d PacketDecoder, version int16) (err error) {
+	flexible := version >= 3
+	var n int
+	if flexible {
+		r.Name, err = d.CompactString()
+	} else {
+		r.Name, err = d.String()
+	}
+	if err != nil {
+		return err
+	}
+	if flexible {
+		n, err = d.CompactArrayLength()
+	} else {
+		n, err = d.ArrayLength()
+	}
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		r.Results = make([]*AddPartitionsToTxnResponseAddPartitionsToTxnPartitionResult, n)
+		for i := range r.Results {
+			r.Results[i] = new(AddPartitionsToTxnResponseAddPartitionsToTxnPartitionResult)
+			if err = r.Results[i].decode(d, version); err != nil {
+				return err
+			}
+		}
+	}
+	if flexible {
+		if r.TaggedFields, err = d.TaggedFields(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *AddPartitionsToTxnResponseAddPartitionsToTxnPartitionResult) encode(e PacketEncoder, version int16) (err error) {
+	flexible := version >= 3
+	e.PutInt32(r.PartitionIndex)
+	e.PutInt16(r.ErrorCode)
+	if flexible {
+		if err = e.PutTaggedFields(r.TaggedFields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *AddPartitionsToTxnResponseAddPartitionsToTxnPartitionResult) decode(d PacketDecoder, version int16) (err error) {
+	flexible := version >= 3
+	if r.PartitionIndex, err = d.Int32(); err != nil {
+		return err
+	}
+	if r.ErrorCode, err = d.Int16(); err != nil {
+		return err
+	}
+	if flexible {
+		if r.TaggedFields, err = d.TaggedFields(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
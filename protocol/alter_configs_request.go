@@ -1,5 +1,11 @@
 package protocol
 
+// Config resource types.
+const (
+	TopicResourceType  int8 = 2
+	BrokerResourceType int8 = 4
+)
+
 type AlterConfigsRequest struct {
 	APIVersion int16
 
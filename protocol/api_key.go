@@ -45,4 +45,19 @@ const (
 	ExpireDelegationTokenKey   = 40
 	DescribeDelegationTokenKey = 41
 	DeleteGroupsKey            = 42
+	DescribeClientQuotasKey    = 48
+)
+
+// Jocko's extension API keys. They're outside of Kafka's range so don't collide with its APIs,
+// and aren't advertised in API versions responses.
+const (
+	FilteredFetchKey      = 10000
+	BrokerMaintenanceKey  = 10001
+	BrokerHealthKey       = 10002
+	DescribeQuorumKey     = 10003
+	PartitionStatsKey     = 10004
+	DescribeFeaturesKey   = 10005
+	UpdateFeaturesKey     = 10006
+	ReassignLostBrokerKey = 10007
+	CompactPartitionKey   = 10008
 )
@@ -35,6 +35,10 @@ func (c *APIVersionsResponse) Encode(e PacketEncoder) error {
 
 func (c *APIVersionsResponse) Decode(d PacketDecoder, version int16) error {
 	c.APIVersion = version
+	var err error
+	if c.ErrorCode, err = d.Int16(); err != nil {
+		return err
+	}
 	l, err := d.ArrayLength()
 	if err != nil {
 		return err
@@ -0,0 +1,32 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIVersionsResponse(t *testing.T) {
+	req := require.New(t)
+	for _, exp := range []*APIVersionsResponse{{
+		APIVersion: 0,
+		ErrorCode:  ErrUnsupportedVersion.Code(),
+		APIVersions: []APIVersion{
+			{APIKey: ProduceKey, MinVersion: 0, MaxVersion: 5},
+		},
+	}, {
+		APIVersion: 1,
+		APIVersions: []APIVersion{
+			{APIKey: ProduceKey, MinVersion: 0, MaxVersion: 5},
+			{APIKey: FetchKey, MinVersion: 0, MaxVersion: 5},
+		},
+		ThrottleTime: time.Second,
+	}} {
+		b, err := Encode(exp)
+		req.NoError(err)
+		var act APIVersionsResponse
+		req.NoError(Decode(b, &act, exp.Version()))
+		req.Equal(exp, &act)
+	}
+}
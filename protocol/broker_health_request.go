@@ -0,0 +1,25 @@
+package protocol
+
+// BrokerHealthRequest is a jocko extension API asking a broker for the state cluster health checks
+// need that isn't in its metadata: its clock, its raft progress, its disk usage, and from version
+// 1 its jocko version.
+type BrokerHealthRequest struct {
+	APIVersion int16
+}
+
+func (r *BrokerHealthRequest) Encode(e PacketEncoder) (err error) {
+	return nil
+}
+
+func (r *BrokerHealthRequest) Decode(d PacketDecoder, version int16) (err error) {
+	r.APIVersion = version
+	return nil
+}
+
+func (r *BrokerHealthRequest) Key() int16 {
+	return BrokerHealthKey
+}
+
+func (r *BrokerHealthRequest) Version() int16 {
+	return r.APIVersion
+}
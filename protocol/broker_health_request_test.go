@@ -0,0 +1,41 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBrokerHealthRequest(t *testing.T) {
+	req := require.New(t)
+	exp := &BrokerHealthRequest{}
+	b, err := Encode(exp)
+	req.NoError(err)
+	var act BrokerHealthRequest
+	err = Decode(b, &act, exp.Version())
+	req.NoError(err)
+	req.Equal(exp, &act)
+}
+
+func TestBrokerHealthResponse(t *testing.T) {
+	req := require.New(t)
+	exp := &BrokerHealthResponse{
+		APIVersion:       1,
+		ErrorCode:        ErrNone.Code(),
+		BrokerID:         2,
+		Time:             time.Unix(1600000000, 123*int64(time.Millisecond)),
+		RaftState:        "Follower",
+		RaftLastIndex:    120,
+		RaftAppliedIndex: 118,
+		DiskTotalBytes:   1 << 40,
+		DiskFreeBytes:    1 << 30,
+		BrokerVersion:    "1.2.0",
+	}
+	b, err := Encode(exp)
+	req.NoError(err)
+	var act BrokerHealthResponse
+	err = Decode(b, &act, exp.Version())
+	req.NoError(err)
+	req.Equal(exp, &act)
+}
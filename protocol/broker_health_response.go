@@ -0,0 +1,85 @@
+package protocol
+
+import "time"
+
+type BrokerHealthResponse struct {
+	APIVersion int16
+
+	ErrorCode int16
+	BrokerID  int32
+	// Time is the broker's clock when it handled the request, to the millisecond.
+	Time time.Time
+	// RaftState is the broker's raft state, e.g. Leader or Follower. RaftLastIndex is the index of
+	// the last entry in its raft log and RaftAppliedIndex the last it's applied to its state.
+	RaftState        string
+	RaftLastIndex    int64
+	RaftAppliedIndex int64
+	// DiskTotalBytes and DiskFreeBytes are the size and free space of the file system holding the
+	// broker's data dir, -1 if the broker can't tell.
+	DiskTotalBytes int64
+	DiskFreeBytes  int64
+	// BrokerVersion is the broker's jocko version, added in version 1.
+	BrokerVersion string
+}
+
+func (r *BrokerHealthResponse) Encode(e PacketEncoder) (err error) {
+	e.PutInt16(r.ErrorCode)
+	e.PutInt32(r.BrokerID)
+	e.PutInt64(r.Time.UnixNano() / int64(time.Millisecond))
+	if err = e.PutString(r.RaftState); err != nil {
+		return err
+	}
+	e.PutInt64(r.RaftLastIndex)
+	e.PutInt64(r.RaftAppliedIndex)
+	e.PutInt64(r.DiskTotalBytes)
+	e.PutInt64(r.DiskFreeBytes)
+	if r.APIVersion >= 1 {
+		if err = e.PutString(r.BrokerVersion); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *BrokerHealthResponse) Decode(d PacketDecoder, version int16) (err error) {
+	r.APIVersion = version
+
+	if r.ErrorCode, err = d.Int16(); err != nil {
+		return err
+	}
+	if r.BrokerID, err = d.Int32(); err != nil {
+		return err
+	}
+	ms, err := d.Int64()
+	if err != nil {
+		return err
+	}
+	r.Time = time.Unix(0, ms*int64(time.Millisecond))
+	if r.RaftState, err = d.String(); err != nil {
+		return err
+	}
+	if r.RaftLastIndex, err = d.Int64(); err != nil {
+		return err
+	}
+	if r.RaftAppliedIndex, err = d.Int64(); err != nil {
+		return err
+	}
+	if r.DiskTotalBytes, err = d.Int64(); err != nil {
+		return err
+	}
+	if r.DiskFreeBytes, err = d.Int64(); err != nil {
+		return err
+	}
+	if version >= 1 {
+		r.BrokerVersion, err = d.String()
+	}
+	return err
+}
+
+func (r *BrokerHealthResponse) Key() int16 {
+	return BrokerHealthKey
+}
+
+func (r *BrokerHealthResponse) Version() int16 {
+	return r.APIVersion
+}
@@ -0,0 +1,35 @@
+package protocol
+
+// BrokerMaintenanceRequest is a jocko extension API putting a broker into or taking it out of
+// maintenance. A broker in maintenance keeps its replicas but hands off its partitions'
+// leaderships and isn't assigned new replicas until its maintenance ends.
+type BrokerMaintenanceRequest struct {
+	APIVersion int16
+
+	BrokerID int32
+	Enabled  bool
+}
+
+func (r *BrokerMaintenanceRequest) Encode(e PacketEncoder) (err error) {
+	e.PutInt32(r.BrokerID)
+	e.PutBool(r.Enabled)
+	return nil
+}
+
+func (r *BrokerMaintenanceRequest) Decode(d PacketDecoder, version int16) (err error) {
+	r.APIVersion = version
+
+	if r.BrokerID, err = d.Int32(); err != nil {
+		return err
+	}
+	r.Enabled, err = d.Bool()
+	return err
+}
+
+func (r *BrokerMaintenanceRequest) Key() int16 {
+	return BrokerMaintenanceKey
+}
+
+func (r *BrokerMaintenanceRequest) Version() int16 {
+	return r.APIVersion
+}
@@ -0,0 +1,37 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBrokerMaintenanceRequest(t *testing.T) {
+	req := require.New(t)
+	exp := &BrokerMaintenanceRequest{
+		BrokerID: 2,
+		Enabled:  true,
+	}
+	b, err := Encode(exp)
+	req.NoError(err)
+	var act BrokerMaintenanceRequest
+	err = Decode(b, &act, exp.Version())
+	req.NoError(err)
+	req.Equal(exp, &act)
+}
+
+func TestBrokerMaintenanceResponse(t *testing.T) {
+	req := require.New(t)
+	msg := "no in-sync replica to take over"
+	exp := &BrokerMaintenanceResponse{
+		ErrorCode:    ErrNone.Code(),
+		ErrorMessage: &msg,
+		Leaders:      3,
+	}
+	b, err := Encode(exp)
+	req.NoError(err)
+	var act BrokerMaintenanceResponse
+	err = Decode(b, &act, exp.Version())
+	req.NoError(err)
+	req.Equal(exp, &act)
+}
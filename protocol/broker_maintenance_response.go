@@ -0,0 +1,41 @@
+package protocol
+
+type BrokerMaintenanceResponse struct {
+	APIVersion int16
+
+	ErrorCode    int16
+	ErrorMessage *string
+	// Leaders is the number of partitions the broker still leads, e.g. because no other in-sync
+	// replica could take over. Maintenance should wait until it's zero.
+	Leaders int32
+}
+
+func (r *BrokerMaintenanceResponse) Encode(e PacketEncoder) (err error) {
+	e.PutInt16(r.ErrorCode)
+	if err = e.PutNullableString(r.ErrorMessage); err != nil {
+		return err
+	}
+	e.PutInt32(r.Leaders)
+	return nil
+}
+
+func (r *BrokerMaintenanceResponse) Decode(d PacketDecoder, version int16) (err error) {
+	r.APIVersion = version
+
+	if r.ErrorCode, err = d.Int16(); err != nil {
+		return err
+	}
+	if r.ErrorMessage, err = d.NullableString(); err != nil {
+		return err
+	}
+	r.Leaders, err = d.Int32()
+	return err
+}
+
+func (r *BrokerMaintenanceResponse) Key() int16 {
+	return BrokerMaintenanceKey
+}
+
+func (r *BrokerMaintenanceResponse) Version() int16 {
+	return r.APIVersion
+}
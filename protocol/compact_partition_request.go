@@ -0,0 +1,37 @@
+package protocol
+
+// CompactPartitionRequest is a jocko extension API compacting a partition's replica on the broker
+// it's sent to now rather than when its active segment next splits, e.g. to recover disk space in
+// an emergency.
+type CompactPartitionRequest struct {
+	APIVersion int16
+
+	Topic     string
+	Partition int32
+}
+
+func (r *CompactPartitionRequest) Encode(e PacketEncoder) (err error) {
+	if err = e.PutString(r.Topic); err != nil {
+		return err
+	}
+	e.PutInt32(r.Partition)
+	return nil
+}
+
+func (r *CompactPartitionRequest) Decode(d PacketDecoder, version int16) (err error) {
+	r.APIVersion = version
+
+	if r.Topic, err = d.String(); err != nil {
+		return err
+	}
+	r.Partition, err = d.Int32()
+	return err
+}
+
+func (r *CompactPartitionRequest) Key() int16 {
+	return CompactPartitionKey
+}
+
+func (r *CompactPartitionRequest) Version() int16 {
+	return r.APIVersion
+}
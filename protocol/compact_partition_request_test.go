@@ -0,0 +1,38 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompactPartitionRequest(t *testing.T) {
+	req := require.New(t)
+	exp := &CompactPartitionRequest{Topic: "t", Partition: 2}
+	b, err := Encode(exp)
+	req.NoError(err)
+	var act CompactPartitionRequest
+	err = Decode(b, &act, exp.Version())
+	req.NoError(err)
+	req.Equal(exp, &act)
+}
+
+func TestCompactPartitionResponse(t *testing.T) {
+	req := require.New(t)
+	exp := &CompactPartitionResponse{ReclaimedBytes: 4096}
+	b, err := Encode(exp)
+	req.NoError(err)
+	var act CompactPartitionResponse
+	err = Decode(b, &act, exp.Version())
+	req.NoError(err)
+	req.Equal(exp, &act)
+
+	msg := "topic t isn't compacted"
+	exp = &CompactPartitionResponse{ErrorCode: ErrInvalidRequest.Code(), ErrorMessage: &msg}
+	b, err = Encode(exp)
+	req.NoError(err)
+	act = CompactPartitionResponse{}
+	err = Decode(b, &act, exp.Version())
+	req.NoError(err)
+	req.Equal(exp, &act)
+}
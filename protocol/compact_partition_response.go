@@ -0,0 +1,40 @@
+package protocol
+
+type CompactPartitionResponse struct {
+	APIVersion int16
+
+	ErrorCode    int16
+	ErrorMessage *string
+	// ReclaimedBytes is the bytes the compaction removed from the replica's log.
+	ReclaimedBytes int64
+}
+
+func (r *CompactPartitionResponse) Encode(e PacketEncoder) (err error) {
+	e.PutInt16(r.ErrorCode)
+	if err = e.PutNullableString(r.ErrorMessage); err != nil {
+		return err
+	}
+	e.PutInt64(r.ReclaimedBytes)
+	return nil
+}
+
+func (r *CompactPartitionResponse) Decode(d PacketDecoder, version int16) (err error) {
+	r.APIVersion = version
+
+	if r.ErrorCode, err = d.Int16(); err != nil {
+		return err
+	}
+	if r.ErrorMessage, err = d.NullableString(); err != nil {
+		return err
+	}
+	r.ReclaimedBytes, err = d.Int64()
+	return err
+}
+
+func (r *CompactPartitionResponse) Key() int16 {
+	return CompactPartitionKey
+}
+
+func (r *CompactPartitionResponse) Version() int16 {
+	return r.APIVersion
+}
@@ -0,0 +1,346 @@
+package protocol
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4"
+)
+
+// CompressionCodec is the codec a message's value is compressed with, set in the lowest bits of
+// its attributes. A compressed message's value is its wrapped message set.
+type CompressionCodec int8
+
+const (
+	CompressionNone   CompressionCodec = 0
+	CompressionGZIP   CompressionCodec = 1
+	CompressionSnappy CompressionCodec = 2
+	CompressionLZ4    CompressionCodec = 3
+	// CompressionZSTD is only for record batches, produced from version 7 and fetched from
+	// version 10.
+	CompressionZSTD CompressionCodec = 4
+
+	compressionCodecMask = 0x07
+)
+
+func (c CompressionCodec) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionGZIP:
+		return "gzip"
+	case CompressionSnappy:
+		return "snappy"
+	case CompressionLZ4:
+		return "lz4"
+	case CompressionZSTD:
+		return "zstd"
+	}
+	return "unknown"
+}
+
+// zstdEncoder and zstdDecoder are shared, they're safe for concurrent use compressing and
+// decompressing whole buffers.
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// Codec returns the codec the message's value is compressed with.
+func (m *Message) Codec() CompressionCodec {
+	return CompressionCodec(m.Attributes & compressionCodecMask)
+}
+
+// Compress compresses b with the codec. Snappy's compressed as a single block without the
+// snappy-java stream framing, which Kafka's clients read either way.
+func Compress(codec CompressionCodec, b []byte) ([]byte, error) {
+	switch codec {
+	case CompressionNone:
+		return b, nil
+	case CompressionGZIP:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(b); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case CompressionSnappy:
+		return snappy.Encode(nil, b), nil
+	case CompressionLZ4:
+		var buf bytes.Buffer
+		w := lz4.NewWriter(&buf)
+		if _, err := w.Write(b); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case CompressionZSTD:
+		return zstdEncoder.EncodeAll(b, nil), nil
+	}
+	return nil, ErrUnsupportedCompressionType
+}
+
+// Decompress decompresses b, compressed with the codec. Snappy's read as a single block or in the
+// snappy-java stream framing Kafka's Java clients write, with its magic header and sized blocks.
+func Decompress(codec CompressionCodec, b []byte) ([]byte, error) {
+	switch codec {
+	case CompressionNone:
+		return b, nil
+	case CompressionGZIP:
+		r, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, ErrCorruptMessage.WithErr(err)
+		}
+		defer r.Close()
+		out, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, ErrCorruptMessage.WithErr(err)
+		}
+		return out, nil
+	case CompressionSnappy:
+		out, err := decodeSnappy(b)
+		if err != nil {
+			return nil, ErrCorruptMessage.WithErr(err)
+		}
+		return out, nil
+	case CompressionLZ4:
+		out, err := ioutil.ReadAll(lz4.NewReader(bytes.NewReader(b)))
+		if err != nil {
+			return nil, ErrCorruptMessage.WithErr(err)
+		}
+		return out, nil
+	case CompressionZSTD:
+		out, err := zstdDecoder.DecodeAll(b, nil)
+		if err != nil {
+			return nil, ErrCorruptMessage.WithErr(err)
+		}
+		return out, nil
+	}
+	return nil, ErrUnsupportedCompressionType
+}
+
+// xerialHeader starts snappy-java's stream framing. It's followed by the framing's version and
+// compatible version, then each block's size and the block.
+var xerialHeader = []byte{0x82, 'S', 'N', 'A', 'P', 'P', 'Y', 0}
+
+const xerialBlocksPos = 16
+
+var errTruncatedSnappy = errors.New("truncated snappy block")
+
+// decodeSnappy decodes a single snappy block or snappy-java's framed blocks, checking the frames'
+// sizes against b rather than trusting the client's.
+func decodeSnappy(b []byte) ([]byte, error) {
+	if !bytes.HasPrefix(b, xerialHeader) {
+		return snappy.Decode(nil, b)
+	}
+	if len(b) < xerialBlocksPos {
+		return nil, errTruncatedSnappy
+	}
+	out := make([]byte, 0, len(b))
+	for b = b[xerialBlocksPos:]; len(b) > 0; {
+		if len(b) < 4 {
+			return nil, errTruncatedSnappy
+		}
+		size := Encoding.Uint32(b)
+		b = b[4:]
+		if uint64(size) > uint64(len(b)) {
+			return nil, errTruncatedSnappy
+		}
+		block, err := snappy.Decode(nil, b[:size])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, block...)
+		b = b[size:]
+	}
+	return out, nil
+}
+
+// IndexCodec returns the index of the record set's first record batch, or message set with
+// messages, compressed with the codec, or -1 if there's none.
+func IndexCodec(set []byte, codec CompressionCodec) int {
+	for i := 0; len(set)-i >= 12; {
+		set := set[i:]
+		n := 12 + int(Encoding.Uint32(set[8:12]))
+		if n > len(set) {
+			n = len(set)
+		}
+		if IsRecordBatch(set[:n]) {
+			if n >= batchAttributesPos+2 && CompressionCodec(Encoding.Uint16(set[batchAttributesPos:])&compressionCodecMask) == codec {
+				return i
+			}
+		} else {
+			ms := new(MessageSet)
+			if err := ms.Decode(NewDecoder(set[:n])); err == nil {
+				for _, m := range ms.Messages {
+					if m.Codec() == codec {
+						return i
+					}
+				}
+			}
+		}
+		i += n
+	}
+	return -1
+}
+
+// DecompressMessages returns the messages with compressed messages replaced by the messages they
+// wrap.
+func DecompressMessages(msgs []*Message) ([]*Message, error) {
+	var out []*Message
+	for _, m := range msgs {
+		if m.Codec() == CompressionNone {
+			out = append(out, m)
+			continue
+		}
+		b, err := Decompress(m.Codec(), m.Value)
+		if err != nil {
+			return nil, err
+		}
+		inner := new(MessageSet)
+		if err := inner.Decode(NewDecoder(b)); err != nil {
+			return nil, ErrCorruptMessage.WithErr(err)
+		}
+		out = append(out, inner.Messages...)
+	}
+	return out, nil
+}
+
+// ShareWrappedOffsets returns the legacy message set with the offsets of the messages wrapped by
+// its compressed magic 1 messages zeroed. Kafka's clients read those offsets relative to the last
+// wrapped message's, at the wrapper's offset, so the wrapped messages share the wrapper's offset
+// like the set's messages share the set's. Magic 0 wrapped offsets are absolute and left as they
+// are. Record batches and sets without compressed messages are returned as they are.
+func ShareWrappedOffsets(set []byte) ([]byte, error) {
+	if len(set) == 0 || IsRecordBatch(set) {
+		return set, nil
+	}
+	ms := new(MessageSet)
+	if err := ms.Decode(NewDecoder(set)); err != nil {
+		return nil, err
+	}
+	wrapped := false
+	for _, m := range ms.Messages {
+		if m.MagicByte == 0 || m.Codec() == CompressionNone {
+			continue
+		}
+		b, err := Decompress(m.Codec(), m.Value)
+		if err != nil {
+			return nil, err
+		}
+		inner := new(MessageSet)
+		if err := inner.Decode(NewDecoder(b)); err != nil {
+			return nil, ErrCorruptMessage.WithErr(err)
+		}
+		// each wrapped message gets its own offset, zero, and size as Kafka's clients expect.
+		var zeroed []byte
+		for _, im := range inner.Messages {
+			b, err := Encode(&MessageSet{Messages: []*Message{im}})
+			if err != nil {
+				return nil, err
+			}
+			zeroed = append(zeroed, b...)
+		}
+		if m.Value, err = Compress(m.Codec(), zeroed); err != nil {
+			return nil, err
+		}
+		wrapped = true
+	}
+	if !wrapped {
+		return set, nil
+	}
+	return Encode(ms)
+}
+
+// Recompress returns the record set with its record batches and legacy message set compressed
+// with the codec. Batches and sets already compressed with it, and control batches, are returned
+// as they are. A legacy set's messages are wrapped by a single message compressed with the codec,
+// or unwrapped if it's none, and zstd's unsupported for them.
+func Recompress(set []byte, codec CompressionCodec) ([]byte, error) {
+	out := make([]byte, 0, len(set))
+	for len(set) > 0 {
+		if !IsRecordBatch(set) {
+			b, err := recompressMessageSet(set, codec)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, b...)
+			break
+		}
+		d := NewDecoder(set)
+		batch := new(RecordBatch)
+		if err := batch.Decode(d); err != nil {
+			return nil, err
+		}
+		if batch.Control() || batch.Codec() == codec {
+			out = append(out, set[:d.Offset()]...)
+		} else {
+			batch.Attributes = batch.Attributes&^compressionCodecMask | int16(codec)
+			b, err := Encode(batch)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, b...)
+		}
+		set = set[d.Offset():]
+	}
+	return out, nil
+}
+
+// recompressMessageSet returns the legacy message set's messages, decompressed, wrapped by a
+// message compressed with the codec.
+func recompressMessageSet(set []byte, codec CompressionCodec) ([]byte, error) {
+	if codec == CompressionZSTD {
+		return nil, ErrUnsupportedCompressionType
+	}
+	ms := new(MessageSet)
+	if err := ms.Decode(NewDecoder(set)); err != nil {
+		return nil, err
+	}
+	unchanged := true
+	for _, m := range ms.Messages {
+		if m.Codec() != codec {
+			unchanged = false
+		}
+	}
+	if len(ms.Messages) == 0 || unchanged && (codec == CompressionNone || len(ms.Messages) == 1) {
+		return set, nil
+	}
+	msgs, err := DecompressMessages(ms.Messages)
+	if err != nil {
+		return nil, err
+	}
+	if codec == CompressionNone {
+		return Encode(&MessageSet{Offset: ms.Offset, Messages: msgs})
+	}
+	// the wrapper's the newest magic and timestamp of its messages, which each get their own
+	// offset, zero, and size as Kafka's clients expect.
+	wrapper := &Message{Attributes: int8(codec)}
+	var wrapped []byte
+	for _, m := range msgs {
+		if m.MagicByte > wrapper.MagicByte {
+			wrapper.MagicByte = m.MagicByte
+		}
+		if m.Timestamp.After(wrapper.Timestamp) {
+			wrapper.Timestamp = m.Timestamp
+		}
+		b, err := Encode(&MessageSet{Messages: []*Message{m}})
+		if err != nil {
+			return nil, err
+		}
+		wrapped = append(wrapped, b...)
+	}
+	if wrapper.Value, err = Compress(codec, wrapped); err != nil {
+		return nil, err
+	}
+	return Encode(&MessageSet{Offset: ms.Offset, Messages: []*Message{wrapper}})
+}
@@ -0,0 +1,138 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompression(t *testing.T) {
+	req := require.New(t)
+	set, err := Encode(&MessageSet{Messages: []*Message{{Value: []byte("hello")}}})
+	req.NoError(err)
+	for _, codec := range []CompressionCodec{CompressionNone, CompressionGZIP, CompressionSnappy, CompressionLZ4, CompressionZSTD} {
+		b, err := Compress(codec, set)
+		req.NoError(err)
+		act, err := Decompress(codec, b)
+		req.NoError(err)
+		req.Equal(set, act)
+	}
+
+	// snappy-java frames its blocks after a magic header and version, each with its size.
+	block, err := Compress(CompressionSnappy, set)
+	req.NoError(err)
+	framed := []byte{0x82, 'S', 'N', 'A', 'P', 'P', 'Y', 0, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 0}
+	Encoding.PutUint32(framed[16:], uint32(len(block)))
+	act, err := Decompress(CompressionSnappy, append(framed, block...))
+	req.NoError(err)
+	req.Equal(set, act)
+	_, err = Decompress(CompressionSnappy, framed)
+	req.Equal(ErrCorruptMessage.Code(), err.(Error).Code())
+	// truncated frames are corrupt rather than read past the set.
+	for _, b := range [][]byte{framed[:10], framed[:18], append(framed, block[:len(block)-1]...)} {
+		_, err = Decompress(CompressionSnappy, b)
+		req.Equal(ErrCorruptMessage.Code(), err.(Error).Code())
+	}
+	_, err = Decompress(CompressionSnappy, []byte{0x82})
+	req.Equal(ErrCorruptMessage.Code(), err.(Error).Code())
+
+	_, err = Compress(CompressionCodec(7), set)
+	req.Equal(ErrUnsupportedCompressionType, err)
+	_, err = Decompress(CompressionGZIP, set)
+	req.Equal(ErrCorruptMessage.Code(), err.(Error).Code())
+}
+
+func TestShareWrappedOffsets(t *testing.T) {
+	req := require.New(t)
+	// kafka's clients give each wrapped message its own offset and size.
+	var inner []byte
+	for i, v := range []string{"a", "b"} {
+		b, err := Encode(&MessageSet{Offset: int64(i), Messages: []*Message{{MagicByte: 1, Value: []byte(v)}}})
+		req.NoError(err)
+		inner = append(inner, b...)
+	}
+	compressed, err := Compress(CompressionGZIP, inner)
+	req.NoError(err)
+	set, err := Encode(&MessageSet{Messages: []*Message{{MagicByte: 1, Attributes: int8(CompressionGZIP), Value: compressed}}})
+	req.NoError(err)
+
+	records, err := DecodeRecords(set)
+	req.NoError(err)
+	req.Len(records, 2)
+	req.Equal([]byte("b"), records[1].Value)
+
+	shared, err := ShareWrappedOffsets(set)
+	req.NoError(err)
+	ms := new(MessageSet)
+	req.NoError(ms.Decode(NewDecoder(shared)))
+	req.Len(ms.Messages, 1)
+	req.Equal(CompressionGZIP, ms.Messages[0].Codec())
+	b, err := Decompress(CompressionGZIP, ms.Messages[0].Value)
+	req.NoError(err)
+	d := NewDecoder(b)
+	for _, v := range []string{"a", "b"} {
+		offset, err := d.Int64()
+		req.NoError(err)
+		req.Equal(int64(0), offset)
+		size, err := d.Int32()
+		req.NoError(err)
+		raw, err := d.RawBytes(int(size))
+		req.NoError(err)
+		m := new(Message)
+		req.NoError(m.Decode(NewDecoder(raw)))
+		req.Equal([]byte(v), m.Value)
+	}
+
+	// sets without compressed messages are left as they are.
+	plain, err := Encode(&MessageSet{Messages: []*Message{{Value: []byte("c")}}})
+	req.NoError(err)
+	shared, err = ShareWrappedOffsets(plain)
+	req.NoError(err)
+	req.Equal(plain, shared)
+}
+
+func TestRecompress(t *testing.T) {
+	batch, err := Encode(&RecordBatch{
+		Attributes:      int16(CompressionGZIP) | transactionalMask,
+		LastOffsetDelta: 1,
+		ProducerID:      7,
+		Records:         []*Record{{Value: []byte("a")}, {OffsetDelta: 1, Value: []byte("b")}},
+	})
+	require.NoError(t, err)
+	control, err := Encode(&RecordBatch{FirstOffset: 2, Attributes: controlMask | transactionalMask, ProducerID: 7, Records: []*Record{{Key: []byte{0, 0, 0, 1}}}})
+	require.NoError(t, err)
+	set := append(batch, control...)
+
+	// already compressed with the codec, the set's as it is.
+	out, err := Recompress(set, CompressionGZIP)
+	require.NoError(t, err)
+	require.Equal(t, set, out)
+
+	out, err = Recompress(set, CompressionLZ4)
+	require.NoError(t, err)
+	d := NewDecoder(out)
+	recompressed := new(RecordBatch)
+	require.NoError(t, recompressed.Decode(d))
+	require.Equal(t, CompressionLZ4, recompressed.Codec())
+	require.True(t, recompressed.Transactional())
+	require.Equal(t, int64(7), recompressed.ProducerID)
+	require.Len(t, recompressed.Records, 2)
+	require.Equal(t, control, out[d.Offset():])
+
+	legacy, err := Encode(&MessageSet{Messages: []*Message{{MagicByte: 1, Value: []byte("c")}, {MagicByte: 1, Value: []byte("d")}}})
+	require.NoError(t, err)
+	wrapped, err := Recompress(legacy, CompressionSnappy)
+	require.NoError(t, err)
+	ms := new(MessageSet)
+	require.NoError(t, ms.Decode(NewDecoder(wrapped)))
+	require.Len(t, ms.Messages, 1)
+	require.Equal(t, CompressionSnappy, ms.Messages[0].Codec())
+	require.Equal(t, int8(1), ms.Messages[0].MagicByte)
+
+	unwrapped, err := Recompress(wrapped, CompressionNone)
+	require.NoError(t, err)
+	require.Equal(t, legacy, unwrapped)
+
+	_, err = Recompress(legacy, CompressionZSTD)
+	require.Equal(t, ErrUnsupportedCompressionType, err)
+}
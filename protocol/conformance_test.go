@@ -0,0 +1,144 @@
+package protocol
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// conformanceBody is a request or response body decoded from the conformance vectors.
+type conformanceBody interface {
+	Encoder
+	VersionedDecoder
+}
+
+// conformanceType is the API and type of a conformance vector's body.
+type conformanceType struct {
+	key int16
+	new func() conformanceBody
+}
+
+// conformanceTypes are the types of the conformance vectors, by the name their files start with.
+var conformanceTypes = map[string]conformanceType{
+	"APIVersionsRequest":      {APIVersionsKey, func() conformanceBody { return &APIVersionsRequest{} }},
+	"APIVersionsResponse":     {APIVersionsKey, func() conformanceBody { return &APIVersionsResponse{} }},
+	"CreateTopicsRequest":     {CreateTopicsKey, func() conformanceBody { return &CreateTopicRequests{} }},
+	"CreateTopicsResponse":    {CreateTopicsKey, func() conformanceBody { return &CreateTopicsResponse{} }},
+	"DeleteTopicsRequest":     {DeleteTopicsKey, func() conformanceBody { return &DeleteTopicsRequest{} }},
+	"DeleteTopicsResponse":    {DeleteTopicsKey, func() conformanceBody { return &DeleteTopicsResponse{} }},
+	"FetchRequest":            {FetchKey, func() conformanceBody { return &FetchRequest{} }},
+	"FetchResponse":           {FetchKey, func() conformanceBody { return &FetchResponse{} }},
+	"FindCoordinatorRequest":  {FindCoordinatorKey, func() conformanceBody { return &FindCoordinatorRequest{} }},
+	"FindCoordinatorResponse": {FindCoordinatorKey, func() conformanceBody { return &FindCoordinatorResponse{} }},
+	"HeartbeatRequest":        {HeartbeatKey, func() conformanceBody { return &HeartbeatRequest{} }},
+	"HeartbeatResponse":       {HeartbeatKey, func() conformanceBody { return &HeartbeatResponse{} }},
+	"LeaveGroupRequest":       {LeaveGroupKey, func() conformanceBody { return &LeaveGroupRequest{} }},
+	"LeaveGroupResponse":      {LeaveGroupKey, func() conformanceBody { return &LeaveGroupResponse{} }},
+	"MetadataRequest":         {MetadataKey, func() conformanceBody { return &MetadataRequest{} }},
+	"MetadataResponse":        {MetadataKey, func() conformanceBody { return &MetadataResponse{} }},
+	"OffsetCommitRequest":     {OffsetCommitKey, func() conformanceBody { return &OffsetCommitRequest{} }},
+	"OffsetCommitResponse":    {OffsetCommitKey, func() conformanceBody { return &OffsetCommitResponse{} }},
+	"OffsetFetchRequest":      {OffsetFetchKey, func() conformanceBody { return &OffsetFetchRequest{} }},
+	"OffsetFetchResponse":     {OffsetFetchKey, func() conformanceBody { return &OffsetFetchResponse{} }},
+	"OffsetsRequest":          {OffsetsKey, func() conformanceBody { return &OffsetsRequest{} }},
+	"OffsetsResponse":         {OffsetsKey, func() conformanceBody { return &OffsetsResponse{} }},
+	"ProduceRequest":          {ProduceKey, func() conformanceBody { return &ProduceRequest{} }},
+	"ProduceResponse":         {ProduceKey, func() conformanceBody { return &ProduceResponse{} }},
+	"SyncGroupRequest":        {SyncGroupKey, func() conformanceBody { return &SyncGroupRequest{} }},
+	"SyncGroupResponse":       {SyncGroupKey, func() conformanceBody { return &SyncGroupResponse{} }},
+}
+
+// conformanceName matches the vectors' file names: the type, version, and an optional
+// description of the case.
+var conformanceName = regexp.MustCompile(`^([A-Za-z]+)_v(\d+)(_\w+)?\.hex$`)
+
+// TestConformance decodes the frames in testdata/conformance, which are in the format Kafka's
+// clients and brokers send, and checks they're encoded back byte for byte.
+func TestConformance(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "conformance", "*.hex"))
+	require.NoError(t, err)
+	require.NotEmpty(t, paths)
+	for _, path := range paths {
+		path := path
+		t.Run(strings.TrimSuffix(filepath.Base(path), ".hex"), func(t *testing.T) {
+			m := conformanceName.FindStringSubmatch(filepath.Base(path))
+			require.NotNil(t, m, "vector file names are <type>_v<version>[_<case>].hex")
+			typ, ok := conformanceTypes[m[1]]
+			require.True(t, ok, "unknown type %s", m[1])
+			version, err := strconv.Atoi(m[2])
+			require.NoError(t, err)
+			frame := readConformanceVector(t, path)
+
+			if strings.HasSuffix(m[1], "Request") {
+				testRequestConformance(t, frame, typ, int16(version))
+			} else {
+				testResponseConformance(t, frame, typ, int16(version))
+			}
+		})
+	}
+}
+
+func testRequestConformance(t *testing.T, frame []byte, typ conformanceType, version int16) {
+	d := NewDecoder(frame)
+	var header RequestHeader
+	require.NoError(t, header.Decode(d))
+	require.Equal(t, int32(len(frame)-4), header.Size)
+	require.Equal(t, typ.key, header.APIKey)
+	require.Equal(t, version, header.APIVersion)
+	body := typ.new()
+	require.NoError(t, body.Decode(d, version))
+	require.Zero(t, d.remaining(), "bytes left after decoding")
+
+	b, err := Encode(&Request{
+		CorrelationID: header.CorrelationID,
+		ClientID:      header.ClientID,
+		TaggedFields:  header.TaggedFields,
+		Body:          body.(Body),
+	})
+	require.NoError(t, err)
+	require.Equal(t, hex.Dump(frame), hex.Dump(b))
+}
+
+func testResponseConformance(t *testing.T, frame []byte, typ conformanceType, version int16) {
+	d := NewDecoder(frame)
+	size, err := d.Int32()
+	require.NoError(t, err)
+	require.Equal(t, int32(len(frame)-4), size)
+	_, err = d.Int32()
+	require.NoError(t, err)
+	if IsFlexibleResponseHeader(typ.key, version) {
+		_, err = d.TaggedFields()
+		require.NoError(t, err)
+	}
+	header := frame[:d.Offset()]
+	body := typ.new()
+	require.NoError(t, body.Decode(d, version))
+	require.Zero(t, d.remaining(), "bytes left after decoding")
+
+	b, err := Encode(body)
+	require.NoError(t, err)
+	require.Equal(t, hex.Dump(frame), hex.Dump(append(append([]byte(nil), header...), b...)))
+}
+
+// readConformanceVector reads the frame in the vector file: hex bytes, with anything after a #
+// on a line a comment.
+func readConformanceVector(t *testing.T, path string) []byte {
+	p, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	var s strings.Builder
+	for _, line := range strings.Split(string(p), "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		s.WriteString(strings.Join(strings.Fields(line), ""))
+	}
+	frame, err := hex.DecodeString(s.String())
+	require.NoError(t, err)
+	return frame
+}
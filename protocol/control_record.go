@@ -0,0 +1,52 @@
+package protocol
+
+import "time"
+
+// TransactionalAttribute is set in the attributes of the record batches producers write in a
+// transaction, and of the control batches marking its end.
+const TransactionalAttribute int16 = transactionalMask
+
+// ControlType is the type of a control batch's marker, which is its control record's key.
+type ControlType int16
+
+const (
+	ControlAbort  ControlType = 0
+	ControlCommit ControlType = 1
+)
+
+// controlRecordVersion is the version of the control record's key and value.
+const controlRecordVersion = 0
+
+// NewTxnMarker returns the control batch marking the producer's transaction committed or aborted
+// in a partition it wrote to. Its record's key is the marker's version and type, and its value
+// the version and the coordinator's epoch.
+func NewTxnMarker(producerID int64, producerEpoch int16, commit bool, coordinatorEpoch int32, now time.Time) *RecordBatch {
+	typ := ControlAbort
+	if commit {
+		typ = ControlCommit
+	}
+	key := make([]byte, 4)
+	Encoding.PutUint16(key, controlRecordVersion)
+	Encoding.PutUint16(key[2:], uint16(typ))
+	value := make([]byte, 6)
+	Encoding.PutUint16(value, controlRecordVersion)
+	Encoding.PutUint32(value[2:], uint32(coordinatorEpoch))
+	return &RecordBatch{
+		Attributes:     transactionalMask | controlMask,
+		FirstTimestamp: now,
+		MaxTimestamp:   now,
+		ProducerID:     producerID,
+		ProducerEpoch:  producerEpoch,
+		FirstSequence:  -1,
+		Records:        []*Record{{Key: key, Value: value}},
+	}
+}
+
+// ControlType returns the type of the control batch's marker, or false if the batch isn't a
+// control batch.
+func (b *RecordBatch) ControlType() (ControlType, bool) {
+	if !b.Control() || len(b.Records) == 0 || len(b.Records[0].Key) < 4 {
+		return 0, false
+	}
+	return ControlType(Encoding.Uint16(b.Records[0].Key[2:])), true
+}
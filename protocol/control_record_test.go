@@ -0,0 +1,32 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTxnMarker(t *testing.T) {
+	req := require.New(t)
+	for _, commit := range []bool{false, true} {
+		b, err := Encode(NewTxnMarker(7, 2, commit, 3, time.Unix(1500000000, 0)))
+		req.NoError(err)
+		// markers have no sequence so they're not checked against the producer's batches.
+		_, ok := ProducerOf(b)
+		req.False(ok)
+
+		act := new(RecordBatch)
+		req.NoError(act.Decode(NewDecoder(b)))
+		req.True(act.Transactional())
+		req.True(act.Control())
+		req.Equal(int64(7), act.ProducerID)
+		req.Equal(int16(2), act.ProducerEpoch)
+		typ, ok := act.ControlType()
+		req.True(ok)
+		req.Equal(commit, typ == ControlCommit)
+		req.Equal([]byte{0, 0, 0, 0, 0, 3}, act.Records[0].Value)
+	}
+	_, ok := (&RecordBatch{Attributes: TransactionalAttribute, Records: []*Record{{Key: []byte{0, 0, 0, 1}}}}).ControlType()
+	req.False(ok)
+}
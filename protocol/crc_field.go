@@ -30,3 +30,32 @@ func (f *CRCField) Check(curOffset int, buf []byte) error {
 	}
 	return nil
 }
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// CRC32CField is a record batch's CRC, the CRC-32C of what follows it through the end of the batch.
+type CRC32CField struct {
+	StartOffset int
+}
+
+func (f *CRC32CField) SaveOffset(in int) {
+	f.StartOffset = in
+}
+
+func (f *CRC32CField) ReserveSize() int {
+	return 4
+}
+
+func (f *CRC32CField) Fill(curOffset int, buf []byte) error {
+	crc := crc32.Checksum(buf[f.StartOffset+4:curOffset], castagnoliTable)
+	Encoding.PutUint32(buf[f.StartOffset:], crc)
+	return nil
+}
+
+func (f *CRC32CField) Check(curOffset int, buf []byte) error {
+	crc := crc32.Checksum(buf[f.StartOffset+4:curOffset], castagnoliTable)
+	if crc != Encoding.Uint32(buf[f.StartOffset:]) {
+		return errors.New("crc didn't match")
+	}
+	return nil
+}
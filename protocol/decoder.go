@@ -1,6 +1,7 @@
 package protocol
 
 import (
+	"encoding/binary"
 	"errors"
 	"math"
 )
@@ -9,6 +10,9 @@ var ErrInsufficientData = errors.New("kafka: insufficient data to decode packet,
 var ErrInvalidStringLength = errors.New("kafka: invalid string length")
 var ErrInvalidArrayLength = errors.New("kafka: invalid array length")
 var ErrInvalidByteSliceLength = errors.New("invalid byteslice length")
+var ErrVarintOverflow = errors.New("kafka: varint overflow")
+var ErrInvalidTaggedFields = errors.New("kafka: invalid tagged fields")
+var ErrInvalidUUID = errors.New("kafka: invalid uuid")
 
 type PacketDecoder interface {
 	Bool() (bool, error)
@@ -16,13 +20,27 @@ type PacketDecoder interface {
 	Int16() (int16, error)
 	Int32() (int32, error)
 	Int64() (int64, error)
+	Float64() (float64, error)
 	ArrayLength() (int, error)
+	NullableArrayLength() (int, error)
 	Bytes() ([]byte, error)
 	String() (string, error)
 	NullableString() (*string, error)
 	Int32Array() ([]int32, error)
 	Int64Array() ([]int64, error)
 	StringArray() ([]string, error)
+	UVarint() (uint64, error)
+	Varint() (int64, error)
+	VarintBytes() ([]byte, error)
+	RawBytes(n int) ([]byte, error)
+	CompactArrayLength() (int, error)
+	CompactBytes() ([]byte, error)
+	CompactString() (string, error)
+	CompactNullableString() (*string, error)
+	CompactStringArray() ([]string, error)
+	CompactInt32Array() ([]int32, error)
+	UUID() (string, error)
+	TaggedFields() (TaggedFields, error)
 	Push(pd PushDecoder) error
 	Pop() error
 	remaining() int
@@ -73,12 +91,20 @@ func (d *ByteDecoder) Bool() (bool, error) {
 }
 
 func (d *ByteDecoder) Int8() (int8, error) {
+	if d.remaining() < 1 {
+		d.off = len(d.b)
+		return -1, ErrInsufficientData
+	}
 	tmp := int8(d.b[d.off])
 	d.off++
 	return tmp, nil
 }
 
 func (d *ByteDecoder) Int16() (int16, error) {
+	if d.remaining() < 2 {
+		d.off = len(d.b)
+		return -1, ErrInsufficientData
+	}
 	tmp := int16(Encoding.Uint16(d.b[d.off:]))
 	d.off += 2
 	return tmp, nil
@@ -104,22 +130,48 @@ func (d *ByteDecoder) Int64() (int64, error) {
 	return tmp, nil
 }
 
+func (d *ByteDecoder) Float64() (float64, error) {
+	if d.remaining() < 8 {
+		d.off = len(d.b)
+		return -1, ErrInsufficientData
+	}
+	tmp := math.Float64frombits(Encoding.Uint64(d.b[d.off:]))
+	d.off += 8
+	return tmp, nil
+}
+
 func (d *ByteDecoder) ArrayLength() (int, error) {
 	if d.remaining() < 4 {
 		d.off = len(d.b)
 		return -1, ErrInsufficientData
 	}
-	tmp := int(Encoding.Uint32(d.b[d.off:]))
+	tmp := int(int32(Encoding.Uint32(d.b[d.off:])))
 	d.off += 4
-	if tmp > d.remaining() {
-		d.off = len(d.b)
-		return -1, ErrInsufficientData
+	// each element is at least a byte.
+	if tmp < 0 || tmp > d.remaining() {
+		return -1, d.invalidLength(ErrInvalidArrayLength)
 	} else if tmp > 2*math.MaxUint16 {
 		return -1, ErrInvalidArrayLength
 	}
 	return tmp, nil
 }
 
+// NullableArrayLength returns the length of a nullable array, -1 if it's null.
+func (d *ByteDecoder) NullableArrayLength() (int, error) {
+	if d.remaining() >= 4 && int32(Encoding.Uint32(d.b[d.off:])) == -1 {
+		d.off += 4
+		return -1, nil
+	}
+	return d.ArrayLength()
+}
+
+// invalidLength returns the error for a length the rest of the frame can't hold, rather than
+// allocating for it, and skips the rest of the frame.
+func (d *ByteDecoder) invalidLength(err error) error {
+	d.off = len(d.b)
+	return ErrInvalidRequest.WithErr(err)
+}
+
 // collections
 
 func (d *ByteDecoder) Bytes() ([]byte, error) {
@@ -165,8 +217,7 @@ func (d *ByteDecoder) String() (string, error) {
 	case n == 0:
 		return "", nil
 	case n > d.remaining():
-		d.off = len(d.b)
-		return "", ErrInsufficientData
+		return "", d.invalidLength(ErrInvalidStringLength)
 	}
 
 	tmpStr := string(d.b[d.off : d.off+n])
@@ -184,8 +235,7 @@ func (d *ByteDecoder) stringLength() (int, error) {
 	case n < -1:
 		return 0, ErrInvalidStringLength
 	case n > d.remaining():
-		d.off = len(d.b)
-		return 0, ErrInsufficientData
+		return 0, d.invalidLength(ErrInvalidStringLength)
 	}
 	return n, nil
 }
@@ -205,22 +255,17 @@ func (d *ByteDecoder) Int32Array() ([]int32, error) {
 		d.off = len(d.b)
 		return nil, ErrInsufficientData
 	}
-	n := int(Encoding.Uint32(d.b[d.off:]))
+	n := int(int32(Encoding.Uint32(d.b[d.off:])))
 	d.off += 4
 
-	if d.remaining() < 4*n {
-		d.off = len(d.b)
-		return nil, ErrInsufficientData
+	if n < 0 || d.remaining() < 4*n {
+		return nil, d.invalidLength(ErrInvalidArrayLength)
 	}
 
 	if n == 0 {
 		return nil, nil
 	}
 
-	if n < 0 {
-		return nil, ErrInvalidArrayLength
-	}
-
 	ret := make([]int32, n)
 	for i := range ret {
 		ret[i] = int32(Encoding.Uint32(d.b[d.off:]))
@@ -234,22 +279,17 @@ func (d *ByteDecoder) Int64Array() ([]int64, error) {
 		d.off = len(d.b)
 		return nil, ErrInsufficientData
 	}
-	n := int(Encoding.Uint32(d.b[d.off:]))
+	n := int(int32(Encoding.Uint32(d.b[d.off:])))
 	d.off += 4
 
-	if d.remaining() < 8*n {
-		d.off = len(d.b)
-		return nil, ErrInsufficientData
+	if n < 0 || d.remaining() < 8*n {
+		return nil, d.invalidLength(ErrInvalidArrayLength)
 	}
 
 	if n == 0 {
 		return nil, nil
 	}
 
-	if n < 0 {
-		return nil, ErrInvalidArrayLength
-	}
-
 	ret := make([]int64, n)
 	for i := range ret {
 		ret[i] = int64(Encoding.Uint64(d.b[d.off:]))
@@ -263,15 +303,16 @@ func (d *ByteDecoder) StringArray() ([]string, error) {
 		d.off = len(d.b)
 		return nil, ErrInsufficientData
 	}
-	n := int(Encoding.Uint32(d.b[d.off:]))
+	n := int(int32(Encoding.Uint32(d.b[d.off:])))
 	d.off += 4
 
-	if n == 0 {
-		return nil, nil
+	// each string is at least its length.
+	if n < 0 || d.remaining() < 2*n {
+		return nil, d.invalidLength(ErrInvalidArrayLength)
 	}
 
-	if n < 0 {
-		return nil, ErrInvalidArrayLength
+	if n == 0 {
+		return nil, nil
 	}
 
 	ret := make([]string, n)
@@ -285,6 +326,205 @@ func (d *ByteDecoder) StringArray() ([]string, error) {
 	return ret, nil
 }
 
+// compact types of flexible versions
+
+func (d *ByteDecoder) UVarint() (uint64, error) {
+	tmp, n := binary.Uvarint(d.b[d.off:])
+	if n == 0 {
+		d.off = len(d.b)
+		return 0, ErrInsufficientData
+	}
+	if n < 0 {
+		return 0, ErrVarintOverflow
+	}
+	d.off += n
+	return tmp, nil
+}
+
+func (d *ByteDecoder) Varint() (int64, error) {
+	tmp, n := binary.Varint(d.b[d.off:])
+	if n == 0 {
+		d.off = len(d.b)
+		return 0, ErrInsufficientData
+	}
+	if n < 0 {
+		return 0, ErrVarintOverflow
+	}
+	d.off += n
+	return tmp, nil
+}
+
+// VarintBytes reads a byte slice of a record batch's record, its length encoded as a varint with
+// -1 for null.
+func (d *ByteDecoder) VarintBytes() ([]byte, error) {
+	tmp, err := d.Varint()
+	switch {
+	case err != nil:
+		return nil, err
+	case tmp < -1 || tmp > math.MaxInt32:
+		return nil, ErrInvalidByteSliceLength
+	case tmp == -1:
+		return nil, nil
+	}
+	return d.RawBytes(int(tmp))
+}
+
+// RawBytes reads the next n bytes.
+func (d *ByteDecoder) RawBytes(n int) ([]byte, error) {
+	if n < 0 {
+		return nil, ErrInvalidByteSliceLength
+	}
+	if n > d.remaining() {
+		d.off = len(d.b)
+		return nil, ErrInsufficientData
+	}
+	tmp := d.b[d.off : d.off+n]
+	d.off += n
+	return tmp, nil
+}
+
+// compactLength reads the length of a compact array, string, or byte slice, encoded as an
+// unsigned varint of the length plus one with zero for null, and returns -1 for null.
+func (d *ByteDecoder) compactLength() (int, error) {
+	tmp, err := d.UVarint()
+	if err != nil {
+		return 0, err
+	}
+	if tmp > math.MaxInt32 {
+		return 0, d.invalidLength(ErrInvalidArrayLength)
+	}
+	return int(tmp) - 1, nil
+}
+
+func (d *ByteDecoder) CompactArrayLength() (int, error) {
+	n, err := d.compactLength()
+	if err != nil {
+		return -1, err
+	}
+	if n > d.remaining() {
+		return -1, d.invalidLength(ErrInvalidArrayLength)
+	}
+	return n, nil
+}
+
+func (d *ByteDecoder) CompactBytes() ([]byte, error) {
+	n, err := d.compactLength()
+	switch {
+	case err != nil:
+		return nil, err
+	case n == -1:
+		return nil, nil
+	case n > d.remaining():
+		d.off = len(d.b)
+		return nil, ErrInsufficientData
+	}
+	tmp := d.b[d.off : d.off+n]
+	d.off += n
+	return tmp, nil
+}
+
+func (d *ByteDecoder) CompactString() (string, error) {
+	s, err := d.CompactNullableString()
+	if err != nil || s == nil {
+		return "", err
+	}
+	return *s, nil
+}
+
+func (d *ByteDecoder) CompactNullableString() (*string, error) {
+	n, err := d.compactLength()
+	switch {
+	case err != nil:
+		return nil, err
+	case n == -1:
+		return nil, nil
+	case n > math.MaxInt16:
+		return nil, ErrInvalidStringLength
+	case n > d.remaining():
+		return nil, d.invalidLength(ErrInvalidStringLength)
+	}
+	tmp := string(d.b[d.off : d.off+n])
+	d.off += n
+	return &tmp, nil
+}
+
+func (d *ByteDecoder) CompactStringArray() ([]string, error) {
+	n, err := d.CompactArrayLength()
+	if err != nil || n <= 0 {
+		return nil, err
+	}
+	ret := make([]string, n)
+	for i := range ret {
+		if ret[i], err = d.CompactString(); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+func (d *ByteDecoder) CompactInt32Array() ([]int32, error) {
+	n, err := d.CompactArrayLength()
+	if err != nil || n <= 0 {
+		return nil, err
+	}
+	if d.remaining() < 4*n {
+		return nil, d.invalidLength(ErrInvalidArrayLength)
+	}
+	ret := make([]int32, n)
+	for i := range ret {
+		ret[i] = int32(Encoding.Uint32(d.b[d.off:]))
+		d.off += 4
+	}
+	return ret, nil
+}
+
+// UUID reads a UUID, e.g. a topic ID, returning an empty string for the zero UUID.
+func (d *ByteDecoder) UUID() (string, error) {
+	b, err := d.RawBytes(uuidSize)
+	if err != nil {
+		return "", err
+	}
+	return uuidString(b), nil
+}
+
+// TaggedFields reads the tagged fields ending a flexible version's struct. Fields are kept raw,
+// whether or not the struct knows their tags, so they can be decoded or passed along as is.
+func (d *ByteDecoder) TaggedFields() (TaggedFields, error) {
+	n, err := d.UVarint()
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	if n > uint64(d.remaining()) {
+		return nil, d.invalidLength(ErrInvalidTaggedFields)
+	}
+	ret := make(TaggedFields, n)
+	prev := int64(-1)
+	for i := uint64(0); i < n; i++ {
+		tag, err := d.UVarint()
+		if err != nil {
+			return nil, err
+		}
+		if int64(tag) <= prev || tag > math.MaxUint32 {
+			return nil, ErrInvalidTaggedFields
+		}
+		prev = int64(tag)
+		size, err := d.UVarint()
+		if err != nil {
+			return nil, err
+		}
+		if size > uint64(d.remaining()) {
+			d.off = len(d.b)
+			return nil, ErrInsufficientData
+		}
+		ret[uint32(tag)] = d.b[d.off : d.off+int(size)]
+		d.off += int(size)
+	}
+	return ret, nil
+}
+
 func (d *ByteDecoder) Push(pd PushDecoder) error {
 	pd.SaveOffset(d.off)
 	reserved := pd.ReserveSize()
@@ -0,0 +1,75 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecoderLengths(t *testing.T) {
+	for name, tc := range map[string]struct {
+		b      []byte
+		decode func(d *ByteDecoder) error
+		err    error
+	}{
+		"array longer than frame": {
+			b:      []byte{0x7f, 0xff, 0xff, 0xff, 0},
+			decode: func(d *ByteDecoder) error { _, err := d.ArrayLength(); return err },
+			err:    ErrInvalidRequest,
+		},
+		"negative array": {
+			b:      []byte{0xff, 0xff, 0xff, 0xfe},
+			decode: func(d *ByteDecoder) error { _, err := d.ArrayLength(); return err },
+			err:    ErrInvalidRequest,
+		},
+		"string array longer than frame": {
+			b:      []byte{0, 0, 0, 3, 0, 0, 0, 0},
+			decode: func(d *ByteDecoder) error { _, err := d.StringArray(); return err },
+			err:    ErrInvalidRequest,
+		},
+		"int32 array longer than frame": {
+			b:      []byte{0, 0, 0, 2, 0, 0, 0, 1},
+			decode: func(d *ByteDecoder) error { _, err := d.Int32Array(); return err },
+			err:    ErrInvalidRequest,
+		},
+		"int64 array negative": {
+			b:      []byte{0x80, 0, 0, 0},
+			decode: func(d *ByteDecoder) error { _, err := d.Int64Array(); return err },
+			err:    ErrInvalidRequest,
+		},
+		"string longer than frame": {
+			b:      []byte{0x7f, 0xff, 'a'},
+			decode: func(d *ByteDecoder) error { _, err := d.String(); return err },
+			err:    ErrInvalidRequest,
+		},
+		"compact array longer than frame": {
+			b:      []byte{0xff, 0xff, 0xff, 0x07},
+			decode: func(d *ByteDecoder) error { _, err := d.CompactArrayLength(); return err },
+			err:    ErrInvalidRequest,
+		},
+		"truncated int16": {
+			b:      []byte{1},
+			decode: func(d *ByteDecoder) error { _, err := d.Int16(); return err },
+			err:    ErrInsufficientData,
+		},
+		"truncated int8": {
+			b:      []byte{},
+			decode: func(d *ByteDecoder) error { _, err := d.Int8(); return err },
+			err:    ErrInsufficientData,
+		},
+	} {
+		d := NewDecoder(tc.b)
+		err := tc.decode(d)
+		if perr, ok := err.(Error); ok {
+			require.Equal(t, tc.err.(Error).Code(), perr.Code(), name)
+		} else {
+			require.Equal(t, tc.err, err, name)
+		}
+		require.Equal(t, 0, d.remaining(), name)
+	}
+
+	// requests whose counts the frame can't hold fail without allocating for them.
+	var req MetadataRequest
+	err := Decode([]byte{0x7f, 0xff, 0xff, 0xff}, &req, 0)
+	require.Equal(t, ErrInvalidRequest.Code(), err.(Error).Code())
+}
@@ -0,0 +1,81 @@
+package protocol
+
+// Client quota entity types and match types.
+const (
+	QuotaEntityUser     = "user"
+	QuotaEntityClientID = "client-id"
+	QuotaEntityIP       = "ip"
+
+	// QuotaMatchExact matches the entity with the component's name, QuotaMatchDefault the
+	// entity's default, and QuotaMatchAny every entity of the component's type.
+	QuotaMatchExact   int8 = 0
+	QuotaMatchDefault int8 = 1
+	QuotaMatchAny     int8 = 2
+)
+
+type DescribeClientQuotasRequest struct {
+	APIVersion int16
+
+	Components []*QuotaFilterComponent
+	// Strict only matches entities with no types other than the components'.
+	Strict bool
+}
+
+// QuotaFilterComponent filters the quota entities on one of their types.
+type QuotaFilterComponent struct {
+	EntityType string
+	MatchType  int8
+	Match      *string
+}
+
+func (r *DescribeClientQuotasRequest) Encode(e PacketEncoder) (err error) {
+	if err = e.PutArrayLength(len(r.Components)); err != nil {
+		return err
+	}
+	for _, c := range r.Components {
+		if err = e.PutString(c.EntityType); err != nil {
+			return err
+		}
+		e.PutInt8(c.MatchType)
+		if err = e.PutNullableString(c.Match); err != nil {
+			return err
+		}
+	}
+	e.PutBool(r.Strict)
+	return nil
+}
+
+func (r *DescribeClientQuotasRequest) Decode(d PacketDecoder, version int16) (err error) {
+	r.APIVersion = version
+
+	n, err := d.ArrayLength()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		r.Components = make([]*QuotaFilterComponent, n)
+		for i := range r.Components {
+			c := new(QuotaFilterComponent)
+			if c.EntityType, err = d.String(); err != nil {
+				return err
+			}
+			if c.MatchType, err = d.Int8(); err != nil {
+				return err
+			}
+			if c.Match, err = d.NullableString(); err != nil {
+				return err
+			}
+			r.Components[i] = c
+		}
+	}
+	r.Strict, err = d.Bool()
+	return err
+}
+
+func (r *DescribeClientQuotasRequest) Key() int16 {
+	return DescribeClientQuotasKey
+}
+
+func (r *DescribeClientQuotasRequest) Version() int16 {
+	return r.APIVersion
+}
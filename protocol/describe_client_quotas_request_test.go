@@ -0,0 +1,53 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDescribeClientQuotasRequest(t *testing.T) {
+	req := require.New(t)
+	client := "client-1"
+	exp := &DescribeClientQuotasRequest{
+		Components: []*QuotaFilterComponent{
+			{EntityType: QuotaEntityClientID, MatchType: QuotaMatchExact, Match: &client},
+			{EntityType: QuotaEntityUser, MatchType: QuotaMatchAny},
+		},
+		Strict: true,
+	}
+	b, err := Encode(exp)
+	req.NoError(err)
+	var act DescribeClientQuotasRequest
+	err = Decode(b, &act, exp.Version())
+	req.NoError(err)
+	req.Equal(exp, &act)
+}
+
+func TestDescribeClientQuotasResponse(t *testing.T) {
+	req := require.New(t)
+	client := "client-1"
+	exp := &DescribeClientQuotasResponse{
+		ThrottleTime: 10 * time.Millisecond,
+		Entries: []*QuotaEntry{{
+			Entity: []*QuotaEntity{{EntityType: QuotaEntityClientID, EntityName: &client}},
+			Values: []*QuotaValue{{Key: "produce_byte_rate", Value: 1024.5}, {Key: "fetch_quota_violations", Value: 3}},
+		}},
+	}
+	b, err := Encode(exp)
+	req.NoError(err)
+	var act DescribeClientQuotasResponse
+	err = Decode(b, &act, exp.Version())
+	req.NoError(err)
+	req.Equal(exp, &act)
+
+	msg := "unknown entity type"
+	exp = &DescribeClientQuotasResponse{ErrorCode: ErrInvalidRequest.Code(), ErrorMessage: &msg}
+	b, err = Encode(exp)
+	req.NoError(err)
+	act = DescribeClientQuotasResponse{}
+	err = Decode(b, &act, exp.Version())
+	req.NoError(err)
+	req.Equal(exp, &act)
+}
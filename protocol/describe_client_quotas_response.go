@@ -0,0 +1,133 @@
+package protocol
+
+import "time"
+
+// QuotaEntity is one of the types and names identifying a client quota entity. A nil name is the
+// type's default entity.
+type QuotaEntity struct {
+	EntityType string
+	EntityName *string
+}
+
+// QuotaValue is one of a quota entity's values.
+type QuotaValue struct {
+	Key   string
+	Value float64
+}
+
+// QuotaEntry is a quota entity's values.
+type QuotaEntry struct {
+	Entity []*QuotaEntity
+	Values []*QuotaValue
+}
+
+type DescribeClientQuotasResponse struct {
+	APIVersion int16
+
+	ThrottleTime time.Duration
+	ErrorCode    int16
+	ErrorMessage *string
+	// Entries is nil if there's an error.
+	Entries []*QuotaEntry
+}
+
+func (r *DescribeClientQuotasResponse) Encode(e PacketEncoder) (err error) {
+	e.PutInt32(int32(r.ThrottleTime / time.Millisecond))
+	e.PutInt16(r.ErrorCode)
+	if err = e.PutNullableString(r.ErrorMessage); err != nil {
+		return err
+	}
+	if r.Entries == nil {
+		e.PutInt32(-1)
+		return nil
+	}
+	if err = e.PutArrayLength(len(r.Entries)); err != nil {
+		return err
+	}
+	for _, entry := range r.Entries {
+		if err = e.PutArrayLength(len(entry.Entity)); err != nil {
+			return err
+		}
+		for _, entity := range entry.Entity {
+			if err = e.PutString(entity.EntityType); err != nil {
+				return err
+			}
+			if err = e.PutNullableString(entity.EntityName); err != nil {
+				return err
+			}
+		}
+		if err = e.PutArrayLength(len(entry.Values)); err != nil {
+			return err
+		}
+		for _, v := range entry.Values {
+			if err = e.PutString(v.Key); err != nil {
+				return err
+			}
+			e.PutFloat64(v.Value)
+		}
+	}
+	return nil
+}
+
+func (r *DescribeClientQuotasResponse) Decode(d PacketDecoder, version int16) (err error) {
+	r.APIVersion = version
+
+	throttle, err := d.Int32()
+	if err != nil {
+		return err
+	}
+	r.ThrottleTime = time.Duration(throttle) * time.Millisecond
+	if r.ErrorCode, err = d.Int16(); err != nil {
+		return err
+	}
+	if r.ErrorMessage, err = d.NullableString(); err != nil {
+		return err
+	}
+	n, err := d.NullableArrayLength()
+	if err != nil || n < 0 {
+		return err
+	}
+	r.Entries = make([]*QuotaEntry, n)
+	for i := range r.Entries {
+		entry := new(QuotaEntry)
+		m, err := d.ArrayLength()
+		if err != nil {
+			return err
+		}
+		entry.Entity = make([]*QuotaEntity, m)
+		for j := range entry.Entity {
+			entity := new(QuotaEntity)
+			if entity.EntityType, err = d.String(); err != nil {
+				return err
+			}
+			if entity.EntityName, err = d.NullableString(); err != nil {
+				return err
+			}
+			entry.Entity[j] = entity
+		}
+		if m, err = d.ArrayLength(); err != nil {
+			return err
+		}
+		entry.Values = make([]*QuotaValue, m)
+		for j := range entry.Values {
+			v := new(QuotaValue)
+			if v.Key, err = d.String(); err != nil {
+				return err
+			}
+			if v.Value, err = d.Float64(); err != nil {
+				return err
+			}
+			entry.Values[j] = v
+		}
+		r.Entries[i] = entry
+	}
+	return nil
+}
+
+func (r *DescribeClientQuotasResponse) Key() int16 {
+	return DescribeClientQuotasKey
+}
+
+func (r *DescribeClientQuotasResponse) Version() int16 {
+	return r.APIVersion
+}
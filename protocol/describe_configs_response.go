@@ -26,6 +26,13 @@ type DescribeConfigsEntry struct {
 	Synonyms    []DescribeConfigsSynonym
 }
 
+// Config synonym sources, where a config's value is set.
+const (
+	TopicConfigSource        int8 = 1
+	StaticBrokerConfigSource int8 = 4
+	DefaultConfigSource      int8 = 5
+)
+
 type DescribeConfigsSynonym struct {
 	Name   string
 	Value  *string
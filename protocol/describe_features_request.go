@@ -0,0 +1,24 @@
+package protocol
+
+// DescribeFeaturesRequest is a jocko extension API asking a broker for the levels of the gated
+// features it supports and the levels the cluster has finalized.
+type DescribeFeaturesRequest struct {
+	APIVersion int16
+}
+
+func (r *DescribeFeaturesRequest) Encode(e PacketEncoder) (err error) {
+	return nil
+}
+
+func (r *DescribeFeaturesRequest) Decode(d PacketDecoder, version int16) (err error) {
+	r.APIVersion = version
+	return nil
+}
+
+func (r *DescribeFeaturesRequest) Key() int16 {
+	return DescribeFeaturesKey
+}
+
+func (r *DescribeFeaturesRequest) Version() int16 {
+	return r.APIVersion
+}
@@ -0,0 +1,37 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDescribeFeaturesRequest(t *testing.T) {
+	req := require.New(t)
+	exp := &DescribeFeaturesRequest{}
+	b, err := Encode(exp)
+	req.NoError(err)
+	var act DescribeFeaturesRequest
+	err = Decode(b, &act, exp.Version())
+	req.NoError(err)
+	req.Equal(exp, &act)
+}
+
+func TestDescribeFeaturesResponse(t *testing.T) {
+	req := require.New(t)
+	exp := &DescribeFeaturesResponse{
+		ErrorCode: ErrNone.Code(),
+		SupportedFeatures: []*SupportedFeature{
+			{Name: "node_maintenance", MinLevel: 1, MaxLevel: 1},
+			{Name: "record_batch", MinLevel: 1, MaxLevel: 2},
+		},
+		FinalizedEpoch:    42,
+		FinalizedFeatures: []*FinalizedFeature{{Name: "record_batch", Level: 2}},
+	}
+	b, err := Encode(exp)
+	req.NoError(err)
+	var act DescribeFeaturesResponse
+	err = Decode(b, &act, exp.Version())
+	req.NoError(err)
+	req.Equal(exp, &act)
+}
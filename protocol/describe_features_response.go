@@ -0,0 +1,112 @@
+package protocol
+
+// SupportedFeature is the range of levels of a gated feature a broker supports.
+type SupportedFeature struct {
+	Name     string
+	MinLevel int16
+	MaxLevel int16
+}
+
+// FinalizedFeature is the level of a gated feature the cluster has finalized, which brokers use
+// the feature at.
+type FinalizedFeature struct {
+	Name  string
+	Level int16
+}
+
+type DescribeFeaturesResponse struct {
+	APIVersion int16
+
+	ErrorCode         int16
+	ErrorMessage      *string
+	SupportedFeatures []*SupportedFeature
+	// FinalizedEpoch is the raft index the finalized features were last updated at, -1 if they
+	// never were.
+	FinalizedEpoch    int64
+	FinalizedFeatures []*FinalizedFeature
+}
+
+func (r *DescribeFeaturesResponse) Encode(e PacketEncoder) (err error) {
+	e.PutInt16(r.ErrorCode)
+	if err = e.PutNullableString(r.ErrorMessage); err != nil {
+		return err
+	}
+	if err = e.PutArrayLength(len(r.SupportedFeatures)); err != nil {
+		return err
+	}
+	for _, f := range r.SupportedFeatures {
+		if err = e.PutString(f.Name); err != nil {
+			return err
+		}
+		e.PutInt16(f.MinLevel)
+		e.PutInt16(f.MaxLevel)
+	}
+	e.PutInt64(r.FinalizedEpoch)
+	if err = e.PutArrayLength(len(r.FinalizedFeatures)); err != nil {
+		return err
+	}
+	for _, f := range r.FinalizedFeatures {
+		if err = e.PutString(f.Name); err != nil {
+			return err
+		}
+		e.PutInt16(f.Level)
+	}
+	return nil
+}
+
+func (r *DescribeFeaturesResponse) Decode(d PacketDecoder, version int16) (err error) {
+	r.APIVersion = version
+
+	if r.ErrorCode, err = d.Int16(); err != nil {
+		return err
+	}
+	if r.ErrorMessage, err = d.NullableString(); err != nil {
+		return err
+	}
+	n, err := d.ArrayLength()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		r.SupportedFeatures = make([]*SupportedFeature, n)
+		for i := range r.SupportedFeatures {
+			f := new(SupportedFeature)
+			if f.Name, err = d.String(); err != nil {
+				return err
+			}
+			if f.MinLevel, err = d.Int16(); err != nil {
+				return err
+			}
+			if f.MaxLevel, err = d.Int16(); err != nil {
+				return err
+			}
+			r.SupportedFeatures[i] = f
+		}
+	}
+	if r.FinalizedEpoch, err = d.Int64(); err != nil {
+		return err
+	}
+	if n, err = d.ArrayLength(); err != nil || n <= 0 {
+		return err
+	}
+	r.FinalizedFeatures = make([]*FinalizedFeature, n)
+	for i := range r.FinalizedFeatures {
+		f := new(FinalizedFeature)
+		if f.Name, err = d.String(); err != nil {
+			return err
+		}
+		if f.Level, err = d.Int16(); err != nil {
+			return err
+		}
+		r.FinalizedFeatures[i] = f
+	}
+	return nil
+}
+
+func (r *DescribeFeaturesResponse) Key() int16 {
+	return DescribeFeaturesKey
+}
+
+func (r *DescribeFeaturesResponse) Version() int16 {
+	return r.APIVersion
+}
@@ -0,0 +1,25 @@
+package protocol
+
+// DescribeQuorumRequest is a jocko extension API asking the controller for the status of the raft
+// quorum replicating the cluster's metadata. Like topic creation it must be sent to the
+// controller.
+type DescribeQuorumRequest struct {
+	APIVersion int16
+}
+
+func (r *DescribeQuorumRequest) Encode(e PacketEncoder) (err error) {
+	return nil
+}
+
+func (r *DescribeQuorumRequest) Decode(d PacketDecoder, version int16) (err error) {
+	r.APIVersion = version
+	return nil
+}
+
+func (r *DescribeQuorumRequest) Key() int16 {
+	return DescribeQuorumKey
+}
+
+func (r *DescribeQuorumRequest) Version() int16 {
+	return r.APIVersion
+}
@@ -0,0 +1,40 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDescribeQuorumRequest(t *testing.T) {
+	req := require.New(t)
+	exp := &DescribeQuorumRequest{}
+	b, err := Encode(exp)
+	req.NoError(err)
+	var act DescribeQuorumRequest
+	err = Decode(b, &act, exp.Version())
+	req.NoError(err)
+	req.Equal(exp, &act)
+}
+
+func TestDescribeQuorumResponse(t *testing.T) {
+	req := require.New(t)
+	exp := &DescribeQuorumResponse{
+		ErrorCode:   ErrNone.Code(),
+		LeaderID:    1,
+		Term:        3,
+		CommitIndex: 120,
+		Voters: []*QuorumReplica{
+			{ReplicaID: 1, LastIndex: 120},
+			{ReplicaID: 2, LastIndex: 118, Lag: 2},
+			{ReplicaID: 3, ErrorCode: ErrBrokerNotAvailable.Code(), LastIndex: -1, Lag: -1},
+		},
+		Observers: []*QuorumReplica{{ReplicaID: 4, LastIndex: 100, Lag: 20}},
+	}
+	b, err := Encode(exp)
+	req.NoError(err)
+	var act DescribeQuorumResponse
+	err = Decode(b, &act, exp.Version())
+	req.NoError(err)
+	req.Equal(exp, &act)
+}
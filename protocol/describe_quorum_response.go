@@ -0,0 +1,109 @@
+package protocol
+
+// QuorumReplica is a raft server's progress replicating the leader's log.
+type QuorumReplica struct {
+	ReplicaID int32
+	// ErrorCode is set if the controller couldn't get the replica's progress, e.g. it's down, in
+	// which case LastIndex and Lag are -1.
+	ErrorCode int16
+	// LastIndex is the index of the last entry in the replica's raft log and Lag how many entries
+	// it's behind the leader's.
+	LastIndex int64
+	Lag       int64
+}
+
+type DescribeQuorumResponse struct {
+	APIVersion int16
+
+	ErrorCode    int16
+	ErrorMessage *string
+	LeaderID     int32
+	// Term is the leader's raft term. CommitIndex is the index of the last entry a quorum of the
+	// voters has.
+	Term        int64
+	CommitIndex int64
+	Voters      []*QuorumReplica
+	// Observers are the non-voting servers, which replicate the log but don't count towards the
+	// quorum.
+	Observers []*QuorumReplica
+}
+
+func (r *DescribeQuorumResponse) Encode(e PacketEncoder) (err error) {
+	e.PutInt16(r.ErrorCode)
+	if err = e.PutNullableString(r.ErrorMessage); err != nil {
+		return err
+	}
+	e.PutInt32(r.LeaderID)
+	e.PutInt64(r.Term)
+	e.PutInt64(r.CommitIndex)
+	for _, replicas := range [][]*QuorumReplica{r.Voters, r.Observers} {
+		if err = e.PutArrayLength(len(replicas)); err != nil {
+			return err
+		}
+		for _, q := range replicas {
+			e.PutInt32(q.ReplicaID)
+			e.PutInt16(q.ErrorCode)
+			e.PutInt64(q.LastIndex)
+			e.PutInt64(q.Lag)
+		}
+	}
+	return nil
+}
+
+func (r *DescribeQuorumResponse) Decode(d PacketDecoder, version int16) (err error) {
+	r.APIVersion = version
+
+	if r.ErrorCode, err = d.Int16(); err != nil {
+		return err
+	}
+	if r.ErrorMessage, err = d.NullableString(); err != nil {
+		return err
+	}
+	if r.LeaderID, err = d.Int32(); err != nil {
+		return err
+	}
+	if r.Term, err = d.Int64(); err != nil {
+		return err
+	}
+	if r.CommitIndex, err = d.Int64(); err != nil {
+		return err
+	}
+	if r.Voters, err = decodeQuorumReplicas(d); err != nil {
+		return err
+	}
+	r.Observers, err = decodeQuorumReplicas(d)
+	return err
+}
+
+func decodeQuorumReplicas(d PacketDecoder) ([]*QuorumReplica, error) {
+	n, err := d.ArrayLength()
+	if err != nil || n <= 0 {
+		return nil, err
+	}
+	replicas := make([]*QuorumReplica, n)
+	for i := range replicas {
+		q := new(QuorumReplica)
+		if q.ReplicaID, err = d.Int32(); err != nil {
+			return nil, err
+		}
+		if q.ErrorCode, err = d.Int16(); err != nil {
+			return nil, err
+		}
+		if q.LastIndex, err = d.Int64(); err != nil {
+			return nil, err
+		}
+		if q.Lag, err = d.Int64(); err != nil {
+			return nil, err
+		}
+		replicas[i] = q
+	}
+	return replicas, nil
+}
+
+func (r *DescribeQuorumResponse) Key() int16 {
+	return DescribeQuorumKey
+}
+
+func (r *DescribeQuorumResponse) Version() int16 {
+	return r.APIVersion
+}
@@ -1,6 +1,7 @@
 package protocol
 
 import (
+	"encoding/binary"
 	"math"
 )
 
@@ -10,6 +11,7 @@ type PacketEncoder interface {
 	PutInt16(in int16)
 	PutInt32(in int32)
 	PutInt64(in int64)
+	PutFloat64(in float64)
 	PutArrayLength(in int) error
 	PutRawBytes(in []byte) error
 	PutBytes(in []byte) error
@@ -18,6 +20,17 @@ type PacketEncoder interface {
 	PutStringArray(in []string) error
 	PutInt32Array(in []int32) error
 	PutInt64Array(in []int64) error
+	PutUVarint(in uint64)
+	PutVarint(in int64)
+	PutVarintBytes(in []byte) error
+	PutCompactArrayLength(in int) error
+	PutCompactBytes(in []byte) error
+	PutCompactString(in string) error
+	PutCompactNullableString(in *string) error
+	PutCompactStringArray(in []string) error
+	PutCompactInt32Array(in []int32) error
+	PutUUID(in string) error
+	PutTaggedFields(in TaggedFields) error
 	Push(pe PushEncoder)
 	Pop()
 }
@@ -74,6 +87,10 @@ func (e *LenEncoder) PutInt64(in int64) {
 	e.Length += 8
 }
 
+func (e *LenEncoder) PutFloat64(in float64) {
+	e.Length += 8
+}
+
 func (e *LenEncoder) PutArrayLength(in int) error {
 	if in > math.MaxInt32 {
 		return ErrInvalidArrayLength
@@ -150,6 +167,108 @@ func (e *LenEncoder) PutInt64Array(in []int64) error {
 	return nil
 }
 
+// compact types of flexible versions
+
+func (e *LenEncoder) PutUVarint(in uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	e.Length += binary.PutUvarint(buf[:], in)
+}
+
+// varint types of record batches
+
+func (e *LenEncoder) PutVarint(in int64) {
+	var buf [binary.MaxVarintLen64]byte
+	e.Length += binary.PutVarint(buf[:], in)
+}
+
+func (e *LenEncoder) PutVarintBytes(in []byte) error {
+	if in == nil {
+		e.PutVarint(-1)
+		return nil
+	}
+	e.PutVarint(int64(len(in)))
+	return e.PutRawBytes(in)
+}
+
+func (e *LenEncoder) PutCompactArrayLength(in int) error {
+	if in > math.MaxInt32 {
+		return ErrInvalidArrayLength
+	}
+	// null arrays are encoded as -1, written as 0.
+	e.PutUVarint(uint64(in + 1))
+	return nil
+}
+
+func (e *LenEncoder) PutCompactBytes(in []byte) error {
+	if in == nil {
+		e.PutUVarint(0)
+		return nil
+	}
+	if len(in) > math.MaxInt32 {
+		return ErrInvalidByteSliceLength
+	}
+	e.PutUVarint(uint64(len(in) + 1))
+	e.Length += len(in)
+	return nil
+}
+
+func (e *LenEncoder) PutCompactString(in string) error {
+	if len(in) > math.MaxInt16 {
+		return ErrInvalidStringLength
+	}
+	e.PutUVarint(uint64(len(in) + 1))
+	e.Length += len(in)
+	return nil
+}
+
+func (e *LenEncoder) PutCompactNullableString(in *string) error {
+	if in == nil {
+		e.PutUVarint(0)
+		return nil
+	}
+	return e.PutCompactString(*in)
+}
+
+func (e *LenEncoder) PutCompactStringArray(in []string) error {
+	if err := e.PutCompactArrayLength(len(in)); err != nil {
+		return err
+	}
+	for _, str := range in {
+		if err := e.PutCompactString(str); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *LenEncoder) PutCompactInt32Array(in []int32) error {
+	if err := e.PutCompactArrayLength(len(in)); err != nil {
+		return err
+	}
+	e.Length += 4 * len(in)
+	return nil
+}
+
+func (e *LenEncoder) PutUUID(in string) error {
+	if _, err := uuidBytes(in); err != nil {
+		return err
+	}
+	e.Length += uuidSize
+	return nil
+}
+
+func (e *LenEncoder) PutTaggedFields(in TaggedFields) error {
+	e.PutUVarint(uint64(len(in)))
+	for _, tag := range in.tags() {
+		e.PutUVarint(uint64(tag))
+		e.PutUVarint(uint64(len(in[tag])))
+		if err := e.PutRawBytes(in[tag]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (e *LenEncoder) Push(pe PushEncoder) {
 	e.Length += pe.ReserveSize()
 }
@@ -197,6 +316,11 @@ func (e *ByteEncoder) PutInt64(in int64) {
 	e.off += 8
 }
 
+func (e *ByteEncoder) PutFloat64(in float64) {
+	Encoding.PutUint64(e.b[e.off:], math.Float64bits(in))
+	e.off += 8
+}
+
 func (e *ByteEncoder) PutArrayLength(in int) error {
 	e.PutInt32(int32(in))
 	return nil
@@ -269,6 +393,94 @@ func (e *ByteEncoder) PutInt64Array(in []int64) error {
 	return nil
 }
 
+func (e *ByteEncoder) PutUVarint(in uint64) {
+	e.off += binary.PutUvarint(e.b[e.off:], in)
+}
+
+func (e *ByteEncoder) PutVarint(in int64) {
+	e.off += binary.PutVarint(e.b[e.off:], in)
+}
+
+func (e *ByteEncoder) PutVarintBytes(in []byte) error {
+	if in == nil {
+		e.PutVarint(-1)
+		return nil
+	}
+	e.PutVarint(int64(len(in)))
+	return e.PutRawBytes(in)
+}
+
+func (e *ByteEncoder) PutCompactArrayLength(in int) error {
+	e.PutUVarint(uint64(in + 1))
+	return nil
+}
+
+func (e *ByteEncoder) PutCompactBytes(in []byte) error {
+	if in == nil {
+		e.PutUVarint(0)
+		return nil
+	}
+	e.PutUVarint(uint64(len(in) + 1))
+	return e.PutRawBytes(in)
+}
+
+func (e *ByteEncoder) PutCompactString(in string) error {
+	e.PutUVarint(uint64(len(in) + 1))
+	copy(e.b[e.off:], in)
+	e.off += len(in)
+	return nil
+}
+
+func (e *ByteEncoder) PutCompactNullableString(in *string) error {
+	if in == nil {
+		e.PutUVarint(0)
+		return nil
+	}
+	return e.PutCompactString(*in)
+}
+
+func (e *ByteEncoder) PutCompactStringArray(in []string) error {
+	if err := e.PutCompactArrayLength(len(in)); err != nil {
+		return err
+	}
+	for _, val := range in {
+		if err := e.PutCompactString(val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *ByteEncoder) PutCompactInt32Array(in []int32) error {
+	if err := e.PutCompactArrayLength(len(in)); err != nil {
+		return err
+	}
+	for _, val := range in {
+		e.PutInt32(val)
+	}
+	return nil
+}
+
+func (e *ByteEncoder) PutUUID(in string) error {
+	b, err := uuidBytes(in)
+	if err != nil {
+		return err
+	}
+	return e.PutRawBytes(b[:])
+}
+
+func (e *ByteEncoder) PutTaggedFields(in TaggedFields) error {
+	e.PutUVarint(uint64(len(in)))
+	for _, tag := range in.tags() {
+		e.PutUVarint(uint64(tag))
+		e.PutUVarint(uint64(len(in[tag])))
+		if err := e.PutRawBytes(in[tag]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (e *ByteEncoder) Push(pe PushEncoder) {
 	pe.SaveOffset(e.off)
 	e.off += pe.ReserveSize()
@@ -0,0 +1,88 @@
+// Code generated by protocol/gen from schemas/EndTxnRequest.json. DO NOT EDIT.
+
+package protocol
+
+func init() {
+	flexibleVersions[EndTxnKey] = 3
+}
+
+// EndTxnRequest is the EndTxn API's request, versions 0-3.
+type EndTxnRequest struct {
+	APIVersion int16
+
+	// The ID of the transaction to end.
+	TransactionalID string
+	// The producer ID.
+	ProducerID int64
+	// The current epoch associated with the producer.
+	ProducerEpoch int16
+	// True if the transaction was committed, false if it was aborted.
+	Committed bool
+	// TaggedFields are the tagged fields of flexible versions unknown to this struct.
+	TaggedFields TaggedFields
+}
+
+func (r *EndTxnRequest) Encode(e PacketEncoder) error {
+	return r.encode(e, r.APIVersion)
+}
+
+func (r *EndTxnRequest) Decode(d PacketDecoder, version int16) error {
+	r.APIVersion = version
+	return r.decode(d, version)
+}
+
+func (r *EndTxnRequest) Key() int16 {
+	return EndTxnKey
+}
+
+func (r *EndTxnRequest) Version() int16 {
+	return r.APIVersion
+}
+
+func (r *EndTxnRequest) encode(e PacketEncoder, version int16) (err error) {
+	flexible := version >= 3
+	if flexible {
+		err = e.PutCompactString(r.TransactionalID)
+	} else {
+		err = e.PutString(r.TransactionalID)
+	}
+	if err != nil {
+		return err
+	}
+	e.PutInt64(r.ProducerID)
+	e.PutInt16(r.ProducerEpoch)
+	e.PutBool(r.Committed)
+	if flexible {
+		if err = e.PutTaggedFields(r.TaggedFields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *EndTxnRequest) decode(d PacketDecoder, version int16) (err error) {
+	flexible := version >= 3
+	if flexible {
+		r.TransactionalID, err = d.CompactString()
+	} else {
+		r.TransactionalID, err = d.String()
+	}
+	if err != nil {
+		return err
+	}
+	if r.ProducerID, err = d.Int64(); err != nil {
+		return err
+	}
+	if r.ProducerEpoch, err = d.Int16(); err != nil {
+		return err
+	}
+	if r.Committed, err = d.Bool(); err != nil {
+		return err
+	}
+	if flexible {
+		if r.TaggedFields, err = d.TaggedFields(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
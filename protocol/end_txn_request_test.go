@@ -0,0 +1,28 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEndTxnRequest(t *testing.T) {
+	req := require.New(t)
+	exp := &EndTxnRequest{APIVersion: 1, TransactionalID: "txn", ProducerID: 7, ProducerEpoch: 1, Committed: true}
+	b, err := Encode(exp)
+	req.NoError(err)
+	var act EndTxnRequest
+	req.NoError(Decode(b, &act, exp.Version()))
+	req.Equal(exp, &act)
+}
+
+func TestEndTxnResponse(t *testing.T) {
+	req := require.New(t)
+	exp := &EndTxnResponse{APIVersion: 1, ThrottleTime: time.Second, ErrorCode: ErrInvalidTxnState.Code()}
+	b, err := Encode(exp)
+	req.NoError(err)
+	var act EndTxnResponse
+	req.NoError(Decode(b, &act, exp.Version()))
+	req.Equal(exp, &act)
+}
@@ -60,66 +60,80 @@ var (
 	ErrTransactionalIdAuthorizationFailed = Error{code: 53, msg: "transactional id authorization failed"}
 	ErrSecurityDisabled                   = Error{code: 54, msg: "security disabled"}
 	ErrOperationNotAttempted              = Error{code: 55, msg: "operation not attempted"}
+	ErrFetchSessionIDNotFound             = Error{code: 70, msg: "fetch session id not found"}
+	ErrFencedLeaderEpoch                  = Error{code: 74, msg: "fenced leader epoch"}
+	ErrUnknownLeaderEpoch                 = Error{code: 75, msg: "unknown leader epoch"}
+	ErrUnsupportedCompressionType         = Error{code: 76, msg: "unsupported compression type"}
+	ErrInvalidRecord                      = Error{code: 87, msg: "invalid record"}
+	ErrThrottlingQuotaExceeded            = Error{code: 89, msg: "throttling quota exceeded"}
+	ErrUnknownTopicID                     = Error{code: 100, msg: "unknown topic id"}
 
 	// Errs maps err codes to their errs.
 	Errs = map[int16]Error{
-		-1: ErrUnknown,
-		0:  ErrNone,
-		1:  ErrOffsetOutOfRange,
-		2:  ErrCorruptMessage,
-		3:  ErrUnknownTopicOrPartition,
-		4:  ErrInvalidFetchSize,
-		5:  ErrLeaderNotAvailable,
-		6:  ErrNotLeaderForPartition,
-		7:  ErrRequestTimedOut,
-		8:  ErrBrokerNotAvailable,
-		9:  ErrReplicaNotAvailable,
-		10: ErrMessageTooLarge,
-		11: ErrStaleControllerEpoch,
-		12: ErrOffsetMetadataTooLarge,
-		13: ErrNetworkException,
-		14: ErrCoordinatorLoadInProgress,
-		15: ErrCoordinatorNotAvailable,
-		16: ErrNotCoordinator,
-		17: ErrInvalidTopicException,
-		18: ErrRecordListTooLarge,
-		19: ErrNotEnoughReplicas,
-		20: ErrNotEnoughReplicasAfterAppend,
-		21: ErrInvalidRequiredAcks,
-		22: ErrIllegalGeneration,
-		23: ErrInconsistentGroupProtocol,
-		24: ErrInvalidGroupId,
-		25: ErrUnknownMemberId,
-		26: ErrInvalidSessionTimeout,
-		27: ErrRebalanceInProgress,
-		28: ErrInvalidCommitOffsetSize,
-		29: ErrTopicAuthorizationFailed,
-		30: ErrGroupAuthorizationFailed,
-		31: ErrClusterAuthorizationFailed,
-		32: ErrInvalidTimestamp,
-		33: ErrUnsupportedSaslMechanism,
-		34: ErrIllegalSaslState,
-		35: ErrUnsupportedVersion,
-		36: ErrTopicAlreadyExists,
-		37: ErrInvalidPartitions,
-		38: ErrInvalidReplicationFactor,
-		39: ErrInvalidReplicaAssignment,
-		40: ErrInvalidConfig,
-		41: ErrNotController,
-		42: ErrInvalidRequest,
-		43: ErrUnsupportedForMessageFormat,
-		44: ErrPolicyViolation,
-		45: ErrOutOfOrderSequenceNumber,
-		46: ErrDuplicateSequenceNumber,
-		47: ErrInvalidProducerEpoch,
-		48: ErrInvalidTxnState,
-		49: ErrInvalidProducerIdMapping,
-		50: ErrInvalidTransactionTimeout,
-		51: ErrConcurrentTransactions,
-		52: ErrTransactionCoordinatorFenced,
-		53: ErrTransactionalIdAuthorizationFailed,
-		54: ErrSecurityDisabled,
-		55: ErrOperationNotAttempted,
+		-1:  ErrUnknown,
+		0:   ErrNone,
+		1:   ErrOffsetOutOfRange,
+		2:   ErrCorruptMessage,
+		3:   ErrUnknownTopicOrPartition,
+		4:   ErrInvalidFetchSize,
+		5:   ErrLeaderNotAvailable,
+		6:   ErrNotLeaderForPartition,
+		7:   ErrRequestTimedOut,
+		8:   ErrBrokerNotAvailable,
+		9:   ErrReplicaNotAvailable,
+		10:  ErrMessageTooLarge,
+		11:  ErrStaleControllerEpoch,
+		12:  ErrOffsetMetadataTooLarge,
+		13:  ErrNetworkException,
+		14:  ErrCoordinatorLoadInProgress,
+		15:  ErrCoordinatorNotAvailable,
+		16:  ErrNotCoordinator,
+		17:  ErrInvalidTopicException,
+		18:  ErrRecordListTooLarge,
+		19:  ErrNotEnoughReplicas,
+		20:  ErrNotEnoughReplicasAfterAppend,
+		21:  ErrInvalidRequiredAcks,
+		22:  ErrIllegalGeneration,
+		23:  ErrInconsistentGroupProtocol,
+		24:  ErrInvalidGroupId,
+		25:  ErrUnknownMemberId,
+		26:  ErrInvalidSessionTimeout,
+		27:  ErrRebalanceInProgress,
+		28:  ErrInvalidCommitOffsetSize,
+		29:  ErrTopicAuthorizationFailed,
+		30:  ErrGroupAuthorizationFailed,
+		31:  ErrClusterAuthorizationFailed,
+		32:  ErrInvalidTimestamp,
+		33:  ErrUnsupportedSaslMechanism,
+		34:  ErrIllegalSaslState,
+		35:  ErrUnsupportedVersion,
+		36:  ErrTopicAlreadyExists,
+		37:  ErrInvalidPartitions,
+		38:  ErrInvalidReplicationFactor,
+		39:  ErrInvalidReplicaAssignment,
+		40:  ErrInvalidConfig,
+		41:  ErrNotController,
+		42:  ErrInvalidRequest,
+		43:  ErrUnsupportedForMessageFormat,
+		44:  ErrPolicyViolation,
+		45:  ErrOutOfOrderSequenceNumber,
+		46:  ErrDuplicateSequenceNumber,
+		47:  ErrInvalidProducerEpoch,
+		48:  ErrInvalidTxnState,
+		49:  ErrInvalidProducerIdMapping,
+		50:  ErrInvalidTransactionTimeout,
+		51:  ErrConcurrentTransactions,
+		52:  ErrTransactionCoordinatorFenced,
+		53:  ErrTransactionalIdAuthorizationFailed,
+		54:  ErrSecurityDisabled,
+		55:  ErrOperationNotAttempted,
+		70:  ErrFetchSessionIDNotFound,
+		74:  ErrFencedLeaderEpoch,
+		75:  ErrUnknownLeaderEpoch,
+		76:  ErrUnsupportedCompressionType,
+		87:  ErrInvalidRecord,
+		89:  ErrThrottlingQuotaExceeded,
+		100: ErrUnknownTopicID,
 	}
 )
 
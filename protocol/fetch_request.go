@@ -9,17 +9,42 @@ const (
 	ReadCommitted   IsolationLevel = 1
 )
 
+// DebuggingReplicaID is the replica ID of fetches reading any replica's log as it is, not just the
+// leader's, e.g. to compare a partition's replicas.
+const DebuggingReplicaID int32 = -2
+
+func init() {
+	flexibleVersions[FetchKey] = 12
+}
+
 type FetchPartition struct {
-	Partition   int32
-	FetchOffset int64
-	MaxBytes    int32
+	Partition int32
+	// CurrentLeaderEpoch is the leader epoch of the fetcher's metadata, sent from v9. -1 skips
+	// checking it.
+	CurrentLeaderEpoch int32
+	FetchOffset        int64
+	// LastFetchedEpoch is the epoch of the fetcher's last fetched record, sent from v12.
+	LastFetchedEpoch int32
+	// LogStartOffset is the follower's log start offset, sent from v5.
+	LogStartOffset int64
+	MaxBytes       int32
 }
 
 type FetchTopic struct {
+	// Topic is sent up to v12, from v13 topics are fetched by TopicID.
 	Topic      string
+	TopicID    string
 	Partitions []*FetchPartition
 }
 
+// ForgottenTopic is a topic's partitions to remove from an incremental fetch session.
+type ForgottenTopic struct {
+	// Topic is sent up to v12, from v13 topics are forgotten by TopicID.
+	Topic      string
+	TopicID    string
+	Partitions []int32
+}
+
 type FetchRequest struct {
 	APIVersion int16
 
@@ -28,10 +53,20 @@ type FetchRequest struct {
 	MinBytes       int32
 	MaxBytes       int32
 	IsolationLevel IsolationLevel
-	Topics         []*FetchTopic
+	// SessionID and SessionEpoch are the fetch session, sent from v7.
+	SessionID    int32
+	SessionEpoch int32
+	Topics       []*FetchTopic
+	// ForgottenTopics is sent from v7.
+	ForgottenTopics []*ForgottenTopic
+	// RackID is the fetcher's rack, sent from v11.
+	RackID string
+	// TaggedFields are the tagged fields of flexible versions, sent from v12.
+	TaggedFields TaggedFields
 }
 
 func (r *FetchRequest) Encode(e PacketEncoder) (err error) {
+	flexible := IsFlexible(FetchKey, r.APIVersion)
 	if r.ReplicaID == 0 {
 		e.PutInt32(-1) // replica ID is -1 for clients
 	} else {
@@ -45,27 +80,78 @@ func (r *FetchRequest) Encode(e PacketEncoder) (err error) {
 	if r.APIVersion >= 4 {
 		e.PutInt8(int8(r.IsolationLevel))
 	}
-	if err = e.PutArrayLength(len(r.Topics)); err != nil {
+	if r.APIVersion >= 7 {
+		e.PutInt32(r.SessionID)
+		e.PutInt32(r.SessionEpoch)
+	}
+	if err = putArrayLength(e, flexible, len(r.Topics)); err != nil {
 		return err
 	}
 	for _, t := range r.Topics {
-		if err = e.PutString(t.Topic); err != nil {
+		if r.APIVersion >= 13 {
+			err = e.PutUUID(t.TopicID)
+		} else {
+			err = putString(e, flexible, t.Topic)
+		}
+		if err != nil {
 			return err
 		}
-		if err = e.PutArrayLength(len(t.Partitions)); err != nil {
+		if err = putArrayLength(e, flexible, len(t.Partitions)); err != nil {
 			return err
 		}
 		for _, p := range t.Partitions {
 			e.PutInt32(p.Partition)
+			if r.APIVersion >= 9 {
+				e.PutInt32(p.CurrentLeaderEpoch)
+			}
 			e.PutInt64(p.FetchOffset)
+			if r.APIVersion >= 12 {
+				e.PutInt32(p.LastFetchedEpoch)
+			}
+			if r.APIVersion >= 5 {
+				e.PutInt64(p.LogStartOffset)
+			}
 			e.PutInt32(p.MaxBytes)
+			if err = putTaggedFields(e, flexible, nil); err != nil {
+				return err
+			}
+		}
+		if err = putTaggedFields(e, flexible, nil); err != nil {
+			return err
 		}
 	}
-	return nil
+	if r.APIVersion >= 7 {
+		if err = putArrayLength(e, flexible, len(r.ForgottenTopics)); err != nil {
+			return err
+		}
+		for _, t := range r.ForgottenTopics {
+			if r.APIVersion >= 13 {
+				err = e.PutUUID(t.TopicID)
+			} else {
+				err = putString(e, flexible, t.Topic)
+			}
+			if err != nil {
+				return err
+			}
+			if err = putInt32Array(e, flexible, t.Partitions); err != nil {
+				return err
+			}
+			if err = putTaggedFields(e, flexible, nil); err != nil {
+				return err
+			}
+		}
+	}
+	if r.APIVersion >= 11 {
+		if err = putString(e, flexible, r.RackID); err != nil {
+			return err
+		}
+	}
+	return putTaggedFields(e, flexible, r.TaggedFields)
 }
 
 func (r *FetchRequest) Decode(d PacketDecoder, version int16) (err error) {
 	r.APIVersion = version
+	flexible := IsFlexible(FetchKey, version)
 	r.ReplicaID, err = d.Int32()
 	if err != nil {
 		return err
@@ -92,18 +178,30 @@ func (r *FetchRequest) Decode(d PacketDecoder, version int16) (err error) {
 		}
 		r.IsolationLevel = IsolationLevel(isolationLevel)
 	}
-	topicCount, err := d.ArrayLength()
+	if r.APIVersion >= 7 {
+		if r.SessionID, err = d.Int32(); err != nil {
+			return err
+		}
+		if r.SessionEpoch, err = d.Int32(); err != nil {
+			return err
+		}
+	}
+	topicCount, err := arrayLength(d, flexible)
 	if err != nil {
 		return err
 	}
 	topics := make([]*FetchTopic, topicCount)
 	for i := range topics {
 		t := &FetchTopic{}
-		t.Topic, err = d.String()
+		if r.APIVersion >= 13 {
+			t.TopicID, err = d.UUID()
+		} else {
+			t.Topic, err = getString(d, flexible)
+		}
 		if err != nil {
 			return err
 		}
-		partitionCount, err := d.ArrayLength()
+		partitionCount, err := arrayLength(d, flexible)
 		if err != nil {
 			return err
 		}
@@ -114,21 +212,75 @@ func (r *FetchRequest) Decode(d PacketDecoder, version int16) (err error) {
 			if err != nil {
 				return err
 			}
+			if r.APIVersion >= 9 {
+				p.CurrentLeaderEpoch, err = d.Int32()
+				if err != nil {
+					return err
+				}
+			}
 			p.FetchOffset, err = d.Int64()
 			if err != nil {
 				return err
 			}
+			if r.APIVersion >= 12 {
+				if p.LastFetchedEpoch, err = d.Int32(); err != nil {
+					return err
+				}
+			}
+			if r.APIVersion >= 5 {
+				p.LogStartOffset, err = d.Int64()
+				if err != nil {
+					return err
+				}
+			}
 			p.MaxBytes, err = d.Int32()
 			if err != nil {
 				return err
 			}
+			if _, err = getTaggedFields(d, flexible); err != nil {
+				return err
+			}
 			ps[j] = p
 		}
 		t.Partitions = ps
+		if _, err = getTaggedFields(d, flexible); err != nil {
+			return err
+		}
 		topics[i] = t
 	}
 	r.Topics = topics
-	return nil
+	if r.APIVersion >= 7 {
+		forgottenCount, err := arrayLength(d, flexible)
+		if err != nil {
+			return err
+		}
+		r.ForgottenTopics = make([]*ForgottenTopic, forgottenCount)
+		for i := range r.ForgottenTopics {
+			t := &ForgottenTopic{}
+			if r.APIVersion >= 13 {
+				t.TopicID, err = d.UUID()
+			} else {
+				t.Topic, err = getString(d, flexible)
+			}
+			if err != nil {
+				return err
+			}
+			if t.Partitions, err = getInt32Array(d, flexible); err != nil {
+				return err
+			}
+			if _, err = getTaggedFields(d, flexible); err != nil {
+				return err
+			}
+			r.ForgottenTopics[i] = t
+		}
+	}
+	if r.APIVersion >= 11 {
+		if r.RackID, err = getString(d, flexible); err != nil {
+			return err
+		}
+	}
+	r.TaggedFields, err = getTaggedFields(d, flexible)
+	return err
 }
 
 func (r *FetchRequest) Key() int16 {
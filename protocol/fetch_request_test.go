@@ -29,3 +29,94 @@ func TestFetchRequest(t *testing.T) {
 	req.NoError(err)
 	req.Equal(exp, &act)
 }
+
+func TestFetchRequestV5(t *testing.T) {
+	req := require.New(t)
+	exp := &FetchRequest{
+		APIVersion:     5,
+		ReplicaID:      1,
+		MaxWaitTime:    time.Millisecond,
+		MinBytes:       3,
+		MaxBytes:       4,
+		IsolationLevel: ReadCommitted,
+		Topics: []*FetchTopic{{
+			Topic: "test_topic",
+			Partitions: []*FetchPartition{{
+				Partition:      1,
+				FetchOffset:    2,
+				LogStartOffset: 1,
+				MaxBytes:       3,
+			}},
+		}},
+	}
+	b, err := Encode(exp)
+	req.NoError(err)
+	var act FetchRequest
+	err = Decode(b, &act, exp.Version())
+	req.NoError(err)
+	req.Equal(exp, &act)
+}
+
+func TestFetchRequestV9(t *testing.T) {
+	req := require.New(t)
+	exp := &FetchRequest{
+		APIVersion:     9,
+		ReplicaID:      1,
+		MaxWaitTime:    time.Millisecond,
+		MinBytes:       3,
+		MaxBytes:       4,
+		IsolationLevel: ReadCommitted,
+		SessionID:      5,
+		SessionEpoch:   6,
+		Topics: []*FetchTopic{{
+			Topic: "test_topic",
+			Partitions: []*FetchPartition{{
+				Partition:          1,
+				CurrentLeaderEpoch: 7,
+				FetchOffset:        2,
+				LogStartOffset:     1,
+				MaxBytes:           3,
+			}},
+		}},
+		ForgottenTopics: []*ForgottenTopic{{Topic: "old_topic", Partitions: []int32{0, 1}}},
+	}
+	b, err := Encode(exp)
+	req.NoError(err)
+	var act FetchRequest
+	err = Decode(b, &act, exp.Version())
+	req.NoError(err)
+	req.Equal(exp, &act)
+}
+
+func TestFetchRequestV13(t *testing.T) {
+	req := require.New(t)
+	exp := &FetchRequest{
+		APIVersion:     13,
+		ReplicaID:      1,
+		MaxWaitTime:    time.Millisecond,
+		MinBytes:       3,
+		MaxBytes:       4,
+		IsolationLevel: ReadCommitted,
+		SessionID:      5,
+		SessionEpoch:   6,
+		Topics: []*FetchTopic{{
+			TopicID: "5f2e3a1b-7c4d-4e8a-9b0c-1d2e3f405162",
+			Partitions: []*FetchPartition{{
+				Partition:          1,
+				CurrentLeaderEpoch: 7,
+				FetchOffset:        2,
+				LastFetchedEpoch:   6,
+				LogStartOffset:     1,
+				MaxBytes:           3,
+			}},
+		}},
+		ForgottenTopics: []*ForgottenTopic{{TopicID: "0b7e4c2a-1f3d-4a5b-8c6d-7e8f90a1b2c3", Partitions: []int32{0, 1}}},
+		RackID:          "rack",
+	}
+	b, err := Encode(exp)
+	req.NoError(err)
+	var act FetchRequest
+	err = Decode(b, &act, exp.Version())
+	req.NoError(err)
+	req.Equal(exp, &act)
+}
@@ -14,13 +14,14 @@ func (t *AbortedTransaction) Decode(d PacketDecoder, version int16) (err error)
 	if t.FirstOffset, err = d.Int64(); err != nil {
 		return err
 	}
-	return nil
+	_, err = getTaggedFields(d, IsFlexible(FetchKey, version))
+	return err
 }
 
-func (t *AbortedTransaction) Encode(e PacketEncoder) (err error) {
+func (t *AbortedTransaction) Encode(e PacketEncoder, version int16) (err error) {
 	e.PutInt64(t.ProducerID)
 	e.PutInt64(t.FirstOffset)
-	return nil
+	return putTaggedFields(e, IsFlexible(FetchKey, version), nil)
 }
 
 type FetchPartitionResponse struct {
@@ -28,11 +29,19 @@ type FetchPartitionResponse struct {
 	ErrorCode           int16
 	HighWatermark       int64
 	LastStableOffset    int64
+	LogStartOffset      int64
 	AbortedTransactions []*AbortedTransaction
-	RecordSet           []byte
+	// PreferredReadReplica is the replica the fetcher should fetch from instead, sent from v11.
+	// -1 means there's none and the fetcher keeps fetching from the leader.
+	PreferredReadReplica int32
+	RecordSet            []byte
+	// TaggedFields are the tagged fields of flexible versions, sent from v12, e.g. the diverging
+	// epoch and current leader.
+	TaggedFields TaggedFields
 }
 
 func (r *FetchPartitionResponse) Decode(d PacketDecoder, version int16) (err error) {
+	flexible := IsFlexible(FetchKey, version)
 	if r.Partition, err = d.Int32(); err != nil {
 		return err
 	}
@@ -47,13 +56,20 @@ func (r *FetchPartitionResponse) Decode(d PacketDecoder, version int16) (err err
 		if r.LastStableOffset, err = d.Int64(); err != nil {
 			return err
 		}
+		if version >= 5 {
+			if r.LogStartOffset, err = d.Int64(); err != nil {
+				return err
+			}
+		}
 
-		transactionCount, err := d.ArrayLength()
+		// the aborted transactions are null unless the fetch is read committed.
+		transactionCount, err := nullableArrayLength(d, flexible)
 		if err != nil {
 			return err
 		}
-
-		r.AbortedTransactions = make([]*AbortedTransaction, transactionCount)
+		if transactionCount >= 0 {
+			r.AbortedTransactions = make([]*AbortedTransaction, transactionCount)
+		}
 		for i := 0; i < transactionCount; i++ {
 			t := &AbortedTransaction{}
 			if err = t.Decode(d, version); err != nil {
@@ -63,38 +79,57 @@ func (r *FetchPartitionResponse) Decode(d PacketDecoder, version int16) (err err
 		}
 	}
 
-	if r.RecordSet, err = d.Bytes(); err != nil {
+	if version >= 11 {
+		if r.PreferredReadReplica, err = d.Int32(); err != nil {
+			return err
+		}
+	}
+
+	if r.RecordSet, err = getBytes(d, flexible); err != nil {
 		return err
 	}
 
-	return nil
+	r.TaggedFields, err = getTaggedFields(d, flexible)
+	return err
 }
 
 func (r *FetchPartitionResponse) Encode(e PacketEncoder, version int16) (err error) {
+	flexible := IsFlexible(FetchKey, version)
 	e.PutInt32(r.Partition)
 	e.PutInt16(r.ErrorCode)
 	e.PutInt64(r.HighWatermark)
 
 	if version >= 4 {
 		e.PutInt64(r.LastStableOffset)
+		if version >= 5 {
+			e.PutInt64(r.LogStartOffset)
+		}
 
-		if err = e.PutArrayLength(len(r.AbortedTransactions)); err != nil {
+		if err = putNullableArrayLength(e, flexible, len(r.AbortedTransactions), r.AbortedTransactions == nil); err != nil {
 			return err
 		}
 		for _, t := range r.AbortedTransactions {
-			t.Encode(e)
+			if err = t.Encode(e, version); err != nil {
+				return err
+			}
 		}
 	}
 
-	if err = e.PutBytes(r.RecordSet); err != nil {
+	if version >= 11 {
+		e.PutInt32(r.PreferredReadReplica)
+	}
+
+	if err = putBytes(e, flexible, r.RecordSet); err != nil {
 		return err
 	}
 
-	return nil
+	return putTaggedFields(e, flexible, r.TaggedFields)
 }
 
 type FetchTopicResponse struct {
+	// Topic is sent up to v12, from v13 topics are responded to by TopicID.
 	Topic              string
+	TopicID            string
 	PartitionResponses FetchPartitionResponses
 }
 
@@ -104,24 +139,40 @@ type FetchResponse struct {
 	APIVersion int16
 
 	ThrottleTime time.Duration
-	Responses    FetchTopicResponses
+	// ErrorCode and SessionID are sent from v7. A session ID of 0 means the broker didn't create
+	// a fetch session so the fetcher sends full fetch requests.
+	ErrorCode int16
+	SessionID int32
+	Responses FetchTopicResponses
+	// TaggedFields are the tagged fields of flexible versions, sent from v12.
+	TaggedFields TaggedFields
 }
 
 type FetchTopicResponses []*FetchTopicResponse
 
 func (r *FetchResponse) Encode(e PacketEncoder) (err error) {
+	flexible := IsFlexible(FetchKey, r.APIVersion)
 	if r.APIVersion >= 1 {
 		e.PutInt32(int32(r.ThrottleTime / time.Millisecond))
 	}
+	if r.APIVersion >= 7 {
+		e.PutInt16(r.ErrorCode)
+		e.PutInt32(r.SessionID)
+	}
 
-	if err = e.PutArrayLength(len(r.Responses)); err != nil {
+	if err = putArrayLength(e, flexible, len(r.Responses)); err != nil {
 		return err
 	}
 	for _, response := range r.Responses {
-		if err = e.PutString(response.Topic); err != nil {
+		if r.APIVersion >= 13 {
+			err = e.PutUUID(response.TopicID)
+		} else {
+			err = putString(e, flexible, response.Topic)
+		}
+		if err != nil {
 			return err
 		}
-		if err = e.PutArrayLength(len(response.PartitionResponses)); err != nil {
+		if err = putArrayLength(e, flexible, len(response.PartitionResponses)); err != nil {
 			return err
 		}
 		for _, p := range response.PartitionResponses {
@@ -129,12 +180,16 @@ func (r *FetchResponse) Encode(e PacketEncoder) (err error) {
 				return err
 			}
 		}
+		if err = putTaggedFields(e, flexible, nil); err != nil {
+			return err
+		}
 	}
-	return nil
+	return putTaggedFields(e, flexible, r.TaggedFields)
 }
 
 func (r *FetchResponse) Decode(d PacketDecoder, version int16) (err error) {
 	r.APIVersion = version
+	flexible := IsFlexible(FetchKey, version)
 
 	if r.APIVersion >= 1 {
 		throttle, err := d.Int32()
@@ -143,8 +198,16 @@ func (r *FetchResponse) Decode(d PacketDecoder, version int16) (err error) {
 		}
 		r.ThrottleTime = time.Duration(throttle) * time.Millisecond
 	}
+	if r.APIVersion >= 7 {
+		if r.ErrorCode, err = d.Int16(); err != nil {
+			return err
+		}
+		if r.SessionID, err = d.Int32(); err != nil {
+			return err
+		}
+	}
 
-	responseCount, err := d.ArrayLength()
+	responseCount, err := arrayLength(d, flexible)
 	if err != nil {
 		return err
 	}
@@ -152,11 +215,15 @@ func (r *FetchResponse) Decode(d PacketDecoder, version int16) (err error) {
 
 	for i := range r.Responses {
 		resp := &FetchTopicResponse{}
-		resp.Topic, err = d.String()
+		if r.APIVersion >= 13 {
+			resp.TopicID, err = d.UUID()
+		} else {
+			resp.Topic, err = getString(d, flexible)
+		}
 		if err != nil {
 			return err
 		}
-		partitionCount, err := d.ArrayLength()
+		partitionCount, err := arrayLength(d, flexible)
 		if err != nil {
 			return err
 		}
@@ -169,9 +236,13 @@ func (r *FetchResponse) Decode(d PacketDecoder, version int16) (err error) {
 			ps[j] = p
 		}
 		resp.PartitionResponses = ps
+		if _, err = getTaggedFields(d, flexible); err != nil {
+			return err
+		}
 		r.Responses[i] = resp
 	}
-	return nil
+	r.TaggedFields, err = getTaggedFields(d, flexible)
+	return err
 }
 
 func (r *FetchResponse) Version() int16 {
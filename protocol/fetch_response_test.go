@@ -29,3 +29,94 @@ func TestFetchResponse(t *testing.T) {
 	req.NoError(err)
 	req.Equal(exp, &act)
 }
+
+func TestFetchResponseV5(t *testing.T) {
+	req := require.New(t)
+	exp := &FetchResponse{
+		APIVersion:   5,
+		ThrottleTime: time.Millisecond,
+		Responses: []*FetchTopicResponse{{
+			Topic: "test_topic",
+			PartitionResponses: []*FetchPartitionResponse{{
+				Partition:           1,
+				ErrorCode:           ErrOffsetOutOfRange.Code(),
+				HighWatermark:       2,
+				LastStableOffset:    3,
+				LogStartOffset:      1,
+				AbortedTransactions: []*AbortedTransaction{},
+				RecordSet:           []byte("sup"),
+			}},
+		}},
+	}
+	b, err := Encode(exp)
+	req.NoError(err)
+	var act FetchResponse
+	err = Decode(b, &act, exp.Version())
+	req.NoError(err)
+	req.Equal(exp, &act)
+}
+
+func TestFetchResponseV7(t *testing.T) {
+	req := require.New(t)
+	exp := &FetchResponse{
+		APIVersion:   7,
+		ThrottleTime: time.Millisecond,
+		ErrorCode:    ErrFetchSessionIDNotFound.Code(),
+		SessionID:    5,
+		Responses: []*FetchTopicResponse{{
+			Topic: "test_topic",
+			PartitionResponses: []*FetchPartitionResponse{{
+				Partition:           1,
+				ErrorCode:           ErrFencedLeaderEpoch.Code(),
+				HighWatermark:       2,
+				LastStableOffset:    3,
+				LogStartOffset:      1,
+				AbortedTransactions: []*AbortedTransaction{},
+				RecordSet:           []byte("sup"),
+			}},
+		}},
+	}
+	b, err := Encode(exp)
+	req.NoError(err)
+	var act FetchResponse
+	err = Decode(b, &act, exp.Version())
+	req.NoError(err)
+	req.Equal(exp, &act)
+}
+
+func TestFetchResponseV13(t *testing.T) {
+	req := require.New(t)
+	exp := &FetchResponse{
+		APIVersion:   13,
+		ThrottleTime: time.Millisecond,
+		SessionID:    5,
+		Responses: []*FetchTopicResponse{{
+			TopicID: "5f2e3a1b-7c4d-4e8a-9b0c-1d2e3f405162",
+			PartitionResponses: []*FetchPartitionResponse{{
+				Partition:            1,
+				HighWatermark:        2,
+				LastStableOffset:     3,
+				LogStartOffset:       1,
+				AbortedTransactions:  []*AbortedTransaction{{ProducerID: 4, FirstOffset: 2}},
+				PreferredReadReplica: -1,
+				RecordSet:            []byte("sup"),
+			}},
+		}, {
+			TopicID: "0b7e4c2a-1f3d-4a5b-8c6d-7e8f90a1b2c3",
+			PartitionResponses: []*FetchPartitionResponse{{
+				Partition:            0,
+				ErrorCode:            ErrUnknownTopicID.Code(),
+				HighWatermark:        -1,
+				LastStableOffset:     -1,
+				LogStartOffset:       -1,
+				PreferredReadReplica: -1,
+			}},
+		}},
+	}
+	b, err := Encode(exp)
+	req.NoError(err)
+	var act FetchResponse
+	err = Decode(b, &act, exp.Version())
+	req.NoError(err)
+	req.Equal(exp, &act)
+}
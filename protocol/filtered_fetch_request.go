@@ -0,0 +1,30 @@
+package protocol
+
+// FilteredFetchRequest is a jocko extension to the fetch API for sparse consumers. The broker
+// drops the message sets without a message matching the filter before responding, so they're
+// never sent. The response is a FetchResponse.
+type FilteredFetchRequest struct {
+	FetchRequest
+	// KeyPrefix filters the fetched message sets to those with a message whose key starts with
+	// it. An empty prefix matches every message.
+	KeyPrefix []byte
+}
+
+func (r *FilteredFetchRequest) Encode(e PacketEncoder) (err error) {
+	if err = r.FetchRequest.Encode(e); err != nil {
+		return err
+	}
+	return e.PutBytes(r.KeyPrefix)
+}
+
+func (r *FilteredFetchRequest) Decode(d PacketDecoder, version int16) (err error) {
+	if err = r.FetchRequest.Decode(d, version); err != nil {
+		return err
+	}
+	r.KeyPrefix, err = d.Bytes()
+	return err
+}
+
+func (r *FilteredFetchRequest) Key() int16 {
+	return FilteredFetchKey
+}
@@ -0,0 +1,34 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilteredFetchRequest(t *testing.T) {
+	req := require.New(t)
+	exp := &FilteredFetchRequest{
+		FetchRequest: FetchRequest{
+			ReplicaID:   1,
+			MaxWaitTime: time.Millisecond,
+			MinBytes:    3,
+			Topics: []*FetchTopic{{
+				Topic: "test_topic",
+				Partitions: []*FetchPartition{{
+					Partition:   1,
+					FetchOffset: 2,
+					MaxBytes:    3,
+				}},
+			}},
+		},
+		KeyPrefix: []byte("user-"),
+	}
+	b, err := Encode(exp)
+	req.NoError(err)
+	var act FilteredFetchRequest
+	err = Decode(b, &act, exp.Version())
+	req.NoError(err)
+	req.Equal(exp, &act)
+}
@@ -6,7 +6,7 @@ type CoordinatorType int8
 
 const (
 	CoordinatorGroup       CoordinatorType = 0
-	CoordinatorTransaction CoordinatorType = 0
+	CoordinatorTransaction CoordinatorType = 1
 )
 
 type FindCoordinatorRequest struct {
@@ -43,7 +43,7 @@ func (r *FindCoordinatorRequest) Decode(d PacketDecoder, version int16) (err err
 }
 
 func (r *FindCoordinatorRequest) Key() int16 {
-	return 10
+	return FindCoordinatorKey
 }
 
 func (r *FindCoordinatorRequest) Version() int16 {
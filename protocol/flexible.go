@@ -0,0 +1,112 @@
+package protocol
+
+// These write and read the fields of hand-written requests and responses whose later versions are
+// flexible, with the compact encoding for flexible versions and the original for the others.
+// Generated requests and responses write their own.
+
+func putArrayLength(e PacketEncoder, flexible bool, n int) error {
+	if flexible {
+		return e.PutCompactArrayLength(n)
+	}
+	return e.PutArrayLength(n)
+}
+
+// putNullableArrayLength writes the length of the array, or null if it's nil.
+func putNullableArrayLength(e PacketEncoder, flexible bool, n int, null bool) error {
+	if null {
+		n = -1
+	}
+	return putArrayLength(e, flexible, n)
+}
+
+func putString(e PacketEncoder, flexible bool, s string) error {
+	if flexible {
+		return e.PutCompactString(s)
+	}
+	return e.PutString(s)
+}
+
+func putNullableString(e PacketEncoder, flexible bool, s *string) error {
+	if flexible {
+		return e.PutCompactNullableString(s)
+	}
+	return e.PutNullableString(s)
+}
+
+func putBytes(e PacketEncoder, flexible bool, b []byte) error {
+	if flexible {
+		return e.PutCompactBytes(b)
+	}
+	return e.PutBytes(b)
+}
+
+func putInt32Array(e PacketEncoder, flexible bool, a []int32) error {
+	if flexible {
+		return e.PutCompactInt32Array(a)
+	}
+	return e.PutInt32Array(a)
+}
+
+// putTaggedFields writes the tagged fields ending the struct, which only flexible versions have.
+func putTaggedFields(e PacketEncoder, flexible bool, t TaggedFields) error {
+	if !flexible {
+		return nil
+	}
+	return e.PutTaggedFields(t)
+}
+
+func arrayLength(d PacketDecoder, flexible bool) (int, error) {
+	if !flexible {
+		return d.ArrayLength()
+	}
+	n, err := d.CompactArrayLength()
+	if err == nil && n < 0 {
+		// only nullable arrays may be null.
+		return -1, ErrInvalidArrayLength
+	}
+	return n, err
+}
+
+// nullableArrayLength reads the length of an array, -1 if it's null.
+func nullableArrayLength(d PacketDecoder, flexible bool) (int, error) {
+	if flexible {
+		return d.CompactArrayLength()
+	}
+	return d.NullableArrayLength()
+}
+
+func getString(d PacketDecoder, flexible bool) (string, error) {
+	if flexible {
+		return d.CompactString()
+	}
+	return d.String()
+}
+
+func getNullableString(d PacketDecoder, flexible bool) (*string, error) {
+	if flexible {
+		return d.CompactNullableString()
+	}
+	return d.NullableString()
+}
+
+func getBytes(d PacketDecoder, flexible bool) ([]byte, error) {
+	if flexible {
+		return d.CompactBytes()
+	}
+	return d.Bytes()
+}
+
+func getInt32Array(d PacketDecoder, flexible bool) ([]int32, error) {
+	if flexible {
+		return d.CompactInt32Array()
+	}
+	return d.Int32Array()
+}
+
+// getTaggedFields reads the tagged fields ending the struct, which only flexible versions have.
+func getTaggedFields(d PacketDecoder, flexible bool) (TaggedFields, error) {
+	if !flexible {
+		return nil, nil
+	}
+	return d.TaggedFields()
+}
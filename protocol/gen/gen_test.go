@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestGeneratedUpToDate checks the protocol package's generated files are those its schemas
+// generate now. Run go generate in protocol if it fails.
+func TestGeneratedUpToDate(t *testing.T) {
+	paths, err := schemaPaths([]string{"../schemas"})
+	require.NoError(t, err)
+	require.NotEmpty(t, paths)
+	for _, path := range paths {
+		name, src, err := generateFile(path)
+		require.NoError(t, err)
+		// the files are generated from within protocol.
+		src = []byte(strings.Replace(string(src), "../schemas/", "schemas/", 1))
+		b, err := ioutil.ReadFile(filepath.Join("..", name))
+		require.NoError(t, err)
+		require.Equal(t, string(b), string(src), name)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	_, src, err := generateFile("testdata/TaggedRequest.json")
+	require.NoError(t, err)
+	for _, s := range []string{
+		"flexibleVersions[TaggedKey] = 2",
+		"Timeout time.Duration",
+		"Topics []*TaggedRequestTopicData",
+		"type TaggedRequestTopicData struct",
+		"Partitions []int32",
+		"r.ReplicaID = -1",
+		"tags = tags.with(0, b)",
+		"if b, ok := r.TaggedFields[0]; ok {",
+	} {
+		require.Contains(t, string(src), s)
+	}
+}
+
+func TestParseSchemaErrors(t *testing.T) {
+	for _, tc := range []struct {
+		schema string
+		err    string
+	}{
+		{`{"apiKey": 1, "type": "request", "name": "FooRequest", "validVersions": "0-x", "fields": []}`, "invalid versions"},
+		{`{"apiKey": 1, "type": "header", "name": "FooHeader", "validVersions": "0", "fields": []}`, "unsupported message type"},
+		{`{"type": "request", "name": "FooRequest", "validVersions": "0", "fields": []}`, "missing name or api key"},
+	} {
+		_, err := parseSchema([]byte(tc.schema))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), tc.err)
+	}
+
+	s, err := parseSchema([]byte(`{"apiKey": 1, "type": "request", "name": "FooRequest", "validVersions": "0", "fields": [
+		{"name": "Id", "type": "uuid", "versions": "0+"}]}`))
+	require.NoError(t, err)
+	_, err = generate(s, "FooRequest.json")
+	require.EqualError(t, err, "FooRequest: field Id: unsupported type uuid")
+}
+
+func TestParseVersions(t *testing.T) {
+	for s, exp := range map[string]versions{
+		"0+":   {Low: 0, High: 1<<15 - 1},
+		"1-3":  {Low: 1, High: 3},
+		"2":    {Low: 2, High: 2},
+		"none": noVersions,
+	} {
+		v, err := parseVersions(s)
+		require.NoError(t, err)
+		require.Equal(t, exp, v)
+		require.Equal(t, s, v.String())
+	}
+	_, err := parseVersions("3-1")
+	require.Error(t, err)
+}
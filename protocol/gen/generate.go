@@ -0,0 +1,662 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// initialisms are the words of Kafka's field names written in capitals in Go's.
+var initialisms = map[string]string{
+	"Api":  "API",
+	"Crc":  "CRC",
+	"Id":   "ID",
+	"Ids":  "IDs",
+	"Ip":   "IP",
+	"Isr":  "ISR",
+	"Json": "JSON",
+	"Url":  "URL",
+}
+
+// fieldNames are the Go names of fields kept from before their messages were generated, keyed by
+// the message's and field's names in Kafka's schemas.
+var fieldNames = map[string]string{
+	"HeartbeatRequest.GenerationId": "GroupGenerationID",
+}
+
+func words(s string) []string {
+	var ws []string
+	start := 0
+	rs := []rune(s)
+	for i := 1; i < len(rs); i++ {
+		if unicode.IsUpper(rs[i]) && !unicode.IsUpper(rs[i-1]) {
+			ws = append(ws, string(rs[start:i]))
+			start = i
+		}
+	}
+	return append(ws, string(rs[start:]))
+}
+
+// goName returns the Go name of Kafka's, e.g. GroupID for GroupId.
+func goName(s string) string {
+	var b strings.Builder
+	for _, w := range words(s) {
+		if i, ok := initialisms[w]; ok {
+			w = i
+		}
+		b.WriteString(w)
+	}
+	return b.String()
+}
+
+// fileName returns the name of the file generated for the message, e.g. heartbeat_request.go.
+func fileName(s *schema) string {
+	ws := words(s.Name)
+	for i, w := range ws {
+		ws[i] = strings.ToLower(w)
+	}
+	return strings.Join(ws, "_") + ".go"
+}
+
+// kind is a field's type.
+type kind int
+
+const (
+	boolKind kind = iota
+	int8Kind
+	int16Kind
+	int32Kind
+	int64Kind
+	stringKind
+	bytesKind
+	structKind
+)
+
+var kinds = map[string]kind{
+	"bool":   boolKind,
+	"int8":   int8Kind,
+	"int16":  int16Kind,
+	"int32":  int32Kind,
+	"int64":  int64Kind,
+	"string": stringKind,
+	"bytes":  bytesKind,
+}
+
+// fieldType is a field's type as it's encoded and declared in Go.
+type fieldType struct {
+	kind  kind
+	array bool
+	// nullable strings are pointers.
+	nullable bool
+	// millisecond fields, named ending in Ms, are durations.
+	duration bool
+	// structName is the Go name of the struct of struct arrays.
+	structName string
+}
+
+func (t fieldType) goType() string {
+	var s string
+	switch {
+	case t.kind == structKind:
+		s = "*" + t.structName
+	case t.duration:
+		s = "time.Duration"
+	case t.kind == stringKind && t.nullable:
+		s = "*string"
+	case t.kind == bytesKind:
+		s = "[]byte"
+	default:
+		s = map[kind]string{boolKind: "bool", int8Kind: "int8", int16Kind: "int16", int32Kind: "int32", int64Kind: "int64", stringKind: "string"}[t.kind]
+	}
+	if t.array {
+		return "[]" + s
+	}
+	return s
+}
+
+// structType is a struct generated for the message or one of its struct arrays.
+type structType struct {
+	name     string
+	about    string
+	fields   []*field
+	versions versions
+	message  bool
+}
+
+type generator struct {
+	schema   *schema
+	source   string
+	name     string
+	structs  []*structType
+	common   map[string]*field
+	types    map[*field]fieldType
+	imports  map[string]bool
+	flexible versions
+	// tagged is set while writing a tagged field's value.
+	tagged bool
+	buf    bytes.Buffer
+}
+
+// generate returns the Go source of the message's types, read from the source file.
+func generate(s *schema, source string) ([]byte, error) {
+	g := &generator{
+		schema:   s,
+		source:   source,
+		name:     goName(s.Name),
+		common:   make(map[string]*field),
+		types:    make(map[*field]fieldType),
+		imports:  make(map[string]bool),
+		flexible: s.FlexibleVersions.intersect(s.ValidVersions),
+	}
+	for _, c := range s.CommonStructs {
+		g.common[c.Name] = c
+	}
+	about := fmt.Sprintf("%s is the %s API's %s, versions %s.", g.name, goName(g.apiName()), s.Type, s.ValidVersions)
+	if err := g.addStruct(g.name, about, s.Fields, s.ValidVersions, true); err != nil {
+		return nil, fmt.Errorf("%s: %s", s.Name, err)
+	}
+	g.generate()
+	b, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return g.buf.Bytes(), fmt.Errorf("%s: format generated source: %s", s.Name, err)
+	}
+	return b, nil
+}
+
+func (g *generator) apiName() string {
+	return strings.TrimSuffix(strings.TrimSuffix(g.schema.Name, "Request"), "Response")
+}
+
+// addStruct adds the struct and those of its struct arrays, checking their fields' types.
+func (g *generator) addStruct(name, about string, fields []*field, vs versions, message bool) error {
+	g.structs = append(g.structs, &structType{name: name, about: about, fields: fields, versions: vs, message: message})
+	for _, f := range fields {
+		fvs := f.Versions.intersect(vs)
+		if f.Versions.none() {
+			return fmt.Errorf("field %s: no versions", f.Name)
+		}
+		t := fieldType{}
+		typ := f.Type
+		if strings.HasPrefix(typ, "[]") {
+			t.array = true
+			typ = strings.TrimPrefix(typ, "[]")
+		}
+		k, ok := kinds[typ]
+		switch {
+		case ok:
+			t.kind = k
+		case t.array && len(typ) > 0 && unicode.IsUpper(rune(typ[0])):
+			t.kind = structKind
+			t.structName = goName(typ)
+			if !strings.HasPrefix(t.structName, g.name) {
+				t.structName = g.name + t.structName
+			}
+			sfs := f.Fields
+			if len(sfs) == 0 {
+				c, ok := g.common[typ]
+				if !ok {
+					return fmt.Errorf("field %s: unknown struct %s", f.Name, typ)
+				}
+				sfs = c.Fields
+			}
+			if !fvs.none() {
+				about := fmt.Sprintf("%s is an element of %s's %s.", t.structName, name, goName(f.Name))
+				if err := g.addStruct(t.structName, about, sfs, fvs, false); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("field %s: unsupported type %s", f.Name, f.Type)
+		}
+		if !f.NullableVersions.none() {
+			if t.kind != stringKind && t.kind != bytesKind || t.array {
+				return fmt.Errorf("field %s: unsupported nullable %s", f.Name, f.Type)
+			}
+			t.nullable = t.kind == stringKind
+		}
+		if (t.kind == int32Kind || t.kind == int64Kind) && !t.array && strings.HasSuffix(f.Name, "Ms") {
+			t.duration = true
+			g.imports["time"] = true
+		}
+		if !f.TaggedVersions.none() {
+			if f.Tag == nil {
+				return fmt.Errorf("field %s: tagged without a tag", f.Name)
+			}
+			if t.array || t.kind == structKind {
+				return fmt.Errorf("field %s: unsupported tagged %s", f.Name, f.Type)
+			}
+		}
+		g.types[f] = t
+	}
+	return nil
+}
+
+func (g *generator) p(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+	g.buf.WriteByte('\n')
+}
+
+func (g *generator) generate() {
+	g.p("// Code generated by protocol/gen from %s. DO NOT EDIT.", g.source)
+	g.p("")
+	g.p("package protocol")
+	g.p("")
+	if len(g.imports) > 0 {
+		var imports []string
+		for i := range g.imports {
+			imports = append(imports, strconv.Quote(i))
+		}
+		sort.Strings(imports)
+		if len(imports) == 1 {
+			g.p("import %s", imports[0])
+		} else {
+			g.p("import (%s)", strings.Join(imports, "\n"))
+		}
+		g.p("")
+	}
+	if g.schema.Type == "request" && !g.flexible.none() {
+		g.p("func init() {")
+		g.p("flexibleVersions[%sKey] = %d", goName(g.apiName()), g.flexible.Low)
+		g.p("}")
+		g.p("")
+	}
+	for _, st := range g.structs {
+		g.declare(st)
+	}
+	for _, st := range g.structs {
+		if st.message {
+			g.messageMethods(st)
+		}
+		g.encode(st)
+		g.decode(st)
+	}
+}
+
+func (g *generator) fieldName(f *field) string {
+	if name, ok := fieldNames[g.schema.Name+"."+f.Name]; ok {
+		return name
+	}
+	if g.types[f].duration {
+		return goName(strings.TrimSuffix(f.Name, "Ms"))
+	}
+	return goName(f.Name)
+}
+
+// flexibleVersions returns the struct's flexible versions.
+func (g *generator) flexibleVersions(st *structType) versions {
+	return g.flexible.intersect(st.versions)
+}
+
+func (g *generator) declare(st *structType) {
+	g.p("// %s", st.about)
+	g.p("type %s struct {", st.name)
+	if st.message {
+		g.p("APIVersion int16")
+		g.p("")
+	}
+	for _, f := range st.fields {
+		if f.Versions.intersect(st.versions).none() {
+			continue
+		}
+		if f.About != "" {
+			g.p("// %s", f.About)
+		}
+		g.p("%s %s", g.fieldName(f), g.types[f].goType())
+	}
+	if !g.flexibleVersions(st).none() {
+		g.p("// TaggedFields are the tagged fields of flexible versions unknown to this struct.")
+		g.p("TaggedFields TaggedFields")
+	}
+	g.p("}")
+	g.p("")
+}
+
+func (g *generator) messageMethods(st *structType) {
+	g.p("func (r *%s) Encode(e PacketEncoder) error {", st.name)
+	g.p("return r.encode(e, r.APIVersion)")
+	g.p("}")
+	g.p("")
+	g.p("func (r *%s) Decode(d PacketDecoder, version int16) error {", st.name)
+	g.p("r.APIVersion = version")
+	g.p("return r.decode(d, version)")
+	g.p("}")
+	g.p("")
+	g.p("func (r *%s) Key() int16 {", st.name)
+	g.p("return %sKey", goName(g.apiName()))
+	g.p("}")
+	g.p("")
+	g.p("func (r *%s) Version() int16 {", st.name)
+	g.p("return r.APIVersion")
+	g.p("}")
+	g.p("")
+}
+
+// condition returns the condition on the version for the versions, within the struct's, or
+// the empty string if it's all of them.
+func condition(vs, within versions) string {
+	var conds []string
+	if vs.Low > within.Low {
+		conds = append(conds, fmt.Sprintf("version >= %d", vs.Low))
+	}
+	if vs.High < within.High {
+		conds = append(conds, fmt.Sprintf("version <= %d", vs.High))
+	}
+	return strings.Join(conds, " && ")
+}
+
+// flex writes the statement setting err, the first for flexible versions and the second for
+// others, and the check of err. Tagged fields are only in flexible versions.
+func (g *generator) flex(st *structType, flexible, other string) {
+	fvs := g.flexibleVersions(st)
+	switch {
+	case fvs.none():
+		g.p("%s", other)
+	case fvs == st.versions || g.tagged:
+		g.p("%s", flexible)
+	default:
+		g.p("if flexible {")
+		g.p("%s", flexible)
+		g.p("} else {")
+		g.p("%s", other)
+		g.p("}")
+	}
+	g.p("if err != nil {")
+	g.p("return err")
+	g.p("}")
+}
+
+func (g *generator) encode(st *structType) {
+	g.p("func (r *%s) encode(e PacketEncoder, version int16) (err error) {", st.name)
+	fvs := g.flexibleVersions(st)
+	if !fvs.none() && fvs != st.versions {
+		g.p("flexible := version >= %d", fvs.Low)
+	}
+	for _, f := range st.fields {
+		vs := f.Versions.intersect(st.versions)
+		if vs.none() {
+			continue
+		}
+		// tagged fields are only written to flexible versions' tagged fields.
+		if !f.TaggedVersions.none() {
+			continue
+		}
+		cond := condition(vs, st.versions)
+		if cond != "" {
+			g.p("if %s {", cond)
+		}
+		g.encodeField(st, f, "r."+g.fieldName(f))
+		if cond != "" {
+			g.p("}")
+		}
+	}
+	if !fvs.none() {
+		if fvs != st.versions {
+			g.p("if flexible {")
+		}
+		tags := "r.TaggedFields"
+		for _, f := range st.fields {
+			tvs := f.TaggedVersions.intersect(f.Versions).intersect(st.versions)
+			if tvs.none() {
+				continue
+			}
+			if tags != "tags" {
+				tags = "tags"
+				g.p("tags := r.TaggedFields")
+			}
+			expr := "r." + g.fieldName(f)
+			cond := joinConditions(condition(tvs, fvs), g.nonDefault(f, expr))
+			g.p("if %s {", cond)
+			g.p("b, err := Encode(encoderFunc(func(e PacketEncoder) (err error) {")
+			g.tagged = true
+			g.encodeValue(st, g.types[f], expr)
+			g.tagged = false
+			g.p("return nil")
+			g.p("}))")
+			g.p("if err != nil {")
+			g.p("return err")
+			g.p("}")
+			g.p("tags = tags.with(%d, b)", *f.Tag)
+			g.p("}")
+		}
+		g.p("if err = e.PutTaggedFields(%s); err != nil {", tags)
+		g.p("return err")
+		g.p("}")
+		if fvs != st.versions {
+			g.p("}")
+		}
+	}
+	g.p("return nil")
+	g.p("}")
+	g.p("")
+}
+
+func joinConditions(a, b string) string {
+	if a == "" {
+		return b
+	}
+	if b == "" {
+		return a
+	}
+	return a + " && " + b
+}
+
+// nonDefault returns the condition the field has other than its default value, written to
+// tagged fields only if so.
+func (g *generator) nonDefault(f *field, expr string) string {
+	t := g.types[f]
+	switch {
+	case t.kind == boolKind:
+		if f.Default != nil && *f.Default == "true" {
+			return "!" + expr
+		}
+		return expr
+	case t.kind == bytesKind:
+		return "len(" + expr + ") != 0"
+	case t.nullable:
+		return expr + " != nil"
+	case t.kind == stringKind:
+		return expr + ` != ""`
+	}
+	return expr + " != " + g.defaultValue(f)
+}
+
+// defaultValue returns the field's default value, for numeric fields.
+func (g *generator) defaultValue(f *field) string {
+	d := "0"
+	if f.Default != nil {
+		if v, err := strconv.ParseInt(*f.Default, 0, 64); err == nil {
+			d = strconv.FormatInt(v, 10)
+		}
+	}
+	if g.types[f].duration && d != "0" {
+		return fmt.Sprintf("%s * time.Millisecond", d)
+	}
+	return d
+}
+
+func (g *generator) encodeField(st *structType, f *field, expr string) {
+	t := g.types[f]
+	if !t.array {
+		g.encodeValue(st, t, expr)
+		return
+	}
+	g.flex(st, fmt.Sprintf("err = e.PutCompactArrayLength(len(%s))", expr), fmt.Sprintf("err = e.PutArrayLength(len(%s))", expr))
+	g.p("for _, v := range %s {", expr)
+	t.array = false
+	if t.kind == structKind {
+		g.p("if err = v.encode(e, version); err != nil {")
+		g.p("return err")
+		g.p("}")
+	} else {
+		g.encodeValue(st, t, "v")
+	}
+	g.p("}")
+}
+
+func (g *generator) encodeValue(st *structType, t fieldType, expr string) {
+	switch t.kind {
+	case boolKind:
+		g.p("e.PutBool(%s)", expr)
+	case int8Kind:
+		g.p("e.PutInt8(%s)", expr)
+	case int16Kind:
+		g.p("e.PutInt16(%s)", expr)
+	case int32Kind:
+		if t.duration {
+			g.p("e.PutInt32(int32(%s / time.Millisecond))", expr)
+		} else {
+			g.p("e.PutInt32(%s)", expr)
+		}
+	case int64Kind:
+		if t.duration {
+			g.p("e.PutInt64(int64(%s / time.Millisecond))", expr)
+		} else {
+			g.p("e.PutInt64(%s)", expr)
+		}
+	case stringKind:
+		if t.nullable {
+			g.flex(st, fmt.Sprintf("err = e.PutCompactNullableString(%s)", expr), fmt.Sprintf("err = e.PutNullableString(%s)", expr))
+		} else {
+			g.flex(st, fmt.Sprintf("err = e.PutCompactString(%s)", expr), fmt.Sprintf("err = e.PutString(%s)", expr))
+		}
+	case bytesKind:
+		g.flex(st, fmt.Sprintf("err = e.PutCompactBytes(%s)", expr), fmt.Sprintf("err = e.PutBytes(%s)", expr))
+	}
+}
+
+func (g *generator) decode(st *structType) {
+	g.p("func (r *%s) decode(d PacketDecoder, version int16) (err error) {", st.name)
+	fvs := g.flexibleVersions(st)
+	if !fvs.none() && fvs != st.versions {
+		g.p("flexible := version >= %d", fvs.Low)
+	}
+	for _, f := range st.fields {
+		if g.types[f].array && !f.Versions.intersect(st.versions).none() {
+			g.p("var n int")
+			break
+		}
+	}
+	for _, f := range st.fields {
+		vs := f.Versions.intersect(st.versions)
+		if vs.none() {
+			continue
+		}
+		if !f.TaggedVersions.none() {
+			continue
+		}
+		expr := "r." + g.fieldName(f)
+		cond := condition(vs, st.versions)
+		if cond != "" {
+			g.p("if %s {", cond)
+		}
+		g.decodeField(st, f, expr)
+		if cond != "" {
+			// versions without the field get its default.
+			if d := g.defaultValue(f); !g.types[f].array && g.types[f].kind != stringKind && g.types[f].kind != bytesKind && g.types[f].kind != boolKind && d != "0" {
+				g.p("} else {")
+				g.p("%s = %s", expr, d)
+			}
+			g.p("}")
+		}
+	}
+	if !fvs.none() {
+		if fvs != st.versions {
+			g.p("if flexible {")
+		}
+		g.p("if r.TaggedFields, err = d.TaggedFields(); err != nil {")
+		g.p("return err")
+		g.p("}")
+		var tagged bool
+		for _, f := range st.fields {
+			tvs := f.TaggedVersions.intersect(f.Versions).intersect(st.versions)
+			if tvs.none() {
+				continue
+			}
+			tagged = true
+			cond := joinConditions(condition(tvs, fvs), "ok")
+			g.p("if b, ok := r.TaggedFields[%d]; %s {", *f.Tag, cond)
+			g.p("d := NewDecoder(b)")
+			g.tagged = true
+			g.decodeValue(st, g.types[f], "r."+g.fieldName(f))
+			g.tagged = false
+			g.p("delete(r.TaggedFields, %d)", *f.Tag)
+			g.p("}")
+		}
+		if tagged {
+			g.p("if len(r.TaggedFields) == 0 {")
+			g.p("r.TaggedFields = nil")
+			g.p("}")
+		}
+		if fvs != st.versions {
+			g.p("}")
+		}
+	}
+	g.p("return nil")
+	g.p("}")
+	g.p("")
+}
+
+func (g *generator) decodeField(st *structType, f *field, expr string) {
+	t := g.types[f]
+	if !t.array {
+		g.decodeValue(st, t, expr)
+		return
+	}
+	g.flex(st, "n, err = d.CompactArrayLength()", "n, err = d.ArrayLength()")
+	g.p("if n > 0 {")
+	t.array = false
+	g.p("%s = make(%s, n)", expr, fieldType{kind: t.kind, array: true, structName: t.structName}.goType())
+	g.p("for i := range %s {", expr)
+	if t.kind == structKind {
+		g.p("%s[i] = new(%s)", expr, t.structName)
+		g.p("if err = %s[i].decode(d, version); err != nil {", expr)
+		g.p("return err")
+		g.p("}")
+	} else {
+		g.decodeValue(st, t, expr+"[i]")
+	}
+	g.p("}")
+	g.p("}")
+}
+
+func (g *generator) decodeValue(st *structType, t fieldType, expr string) {
+	check := func(call string) {
+		g.p("if %s, err = %s; err != nil {", expr, call)
+		g.p("return err")
+		g.p("}")
+	}
+	switch t.kind {
+	case boolKind:
+		check("d.Bool()")
+	case int8Kind:
+		check("d.Int8()")
+	case int16Kind:
+		check("d.Int16()")
+	case int32Kind, int64Kind:
+		call := "d.Int32()"
+		if t.kind == int64Kind {
+			call = "d.Int64()"
+		}
+		if !t.duration {
+			check(call)
+			return
+		}
+		g.p("if ms, err := %s; err != nil {", call)
+		g.p("return err")
+		g.p("} else {")
+		g.p("%s = time.Duration(ms) * time.Millisecond", expr)
+		g.p("}")
+	case stringKind:
+		if t.nullable {
+			g.flex(st, fmt.Sprintf("%s, err = d.CompactNullableString()", expr), fmt.Sprintf("%s, err = d.NullableString()", expr))
+		} else {
+			g.flex(st, fmt.Sprintf("%s, err = d.CompactString()", expr), fmt.Sprintf("%s, err = d.String()", expr))
+		}
+	case bytesKind:
+		g.flex(st, fmt.Sprintf("%s, err = d.CompactBytes()", expr), fmt.Sprintf("%s, err = d.Bytes()", expr))
+	}
+}
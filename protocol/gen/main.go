@@ -0,0 +1,83 @@
+// Command gen generates the protocol package's request and response types from Apache Kafka's
+// JSON message definitions, kept in protocol/schemas. Run it with go generate in protocol.
+//
+// Usage:
+//
+//	go run ./gen [-out dir] schemas...
+//
+// Schemas are files or directories of .json files. Each message is written to the file named
+// after it, e.g. HeartbeatRequest.json to heartbeat_request.go.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+func main() {
+	out := flag.String("out", ".", "directory to write the generated files to")
+	flag.Parse()
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: gen [-out dir] schemas...")
+		os.Exit(2)
+	}
+	paths, err := schemaPaths(flag.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for _, path := range paths {
+		name, src, err := generateFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if err := ioutil.WriteFile(filepath.Join(*out, name), src, 0644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+}
+
+// schemaPaths returns the schema files given, reading the .json files of directories.
+func schemaPaths(args []string) ([]string, error) {
+	var paths []string
+	for _, arg := range args {
+		fi, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			paths = append(paths, arg)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(arg, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, matches...)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// generateFile returns the name and source of the file generated from the schema file.
+func generateFile(path string) (string, []byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+	s, err := parseSchema(b)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %s", path, err)
+	}
+	src, err := generate(s, filepath.ToSlash(path))
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return fileName(s), src, nil
+}
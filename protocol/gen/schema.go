@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// schema is one of Kafka's message definitions, from clients/src/main/resources/common/message.
+type schema struct {
+	APIKey           *int16   `json:"apiKey"`
+	Type             string   `json:"type"`
+	Name             string   `json:"name"`
+	ValidVersions    versions `json:"validVersions"`
+	FlexibleVersions versions `json:"flexibleVersions"`
+	Fields           []*field `json:"fields"`
+	CommonStructs    []*field `json:"commonStructs"`
+}
+
+type field struct {
+	Name             string   `json:"name"`
+	Type             string   `json:"type"`
+	Versions         versions `json:"versions"`
+	NullableVersions versions `json:"nullableVersions"`
+	TaggedVersions   versions `json:"taggedVersions"`
+	Tag              *uint32  `json:"tag"`
+	Default          *string  `json:"default"`
+	About            string   `json:"about"`
+	Fields           []*field `json:"fields"`
+}
+
+// UnmarshalJSON reads defaults given as strings, numbers, or bools.
+func (f *field) UnmarshalJSON(b []byte) error {
+	type plain field
+	var v struct {
+		*plain
+		Default interface{} `json:"default"`
+	}
+	v.plain = (*plain)(f)
+	f.Versions, f.NullableVersions, f.TaggedVersions = noVersions, noVersions, noVersions
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	if v.Default != nil {
+		d := fmt.Sprint(v.Default)
+		f.Default = &d
+	}
+	return nil
+}
+
+// versions is a range of versions like "0+", "1-3", "2", or "none".
+type versions struct {
+	Low, High int16
+}
+
+var noVersions = versions{Low: 1, High: 0}
+
+func (v versions) none() bool {
+	return v.Low > v.High
+}
+
+func (v versions) String() string {
+	switch {
+	case v.none():
+		return "none"
+	case v.High == math.MaxInt16:
+		return fmt.Sprintf("%d+", v.Low)
+	case v.Low == v.High:
+		return strconv.Itoa(int(v.Low))
+	}
+	return fmt.Sprintf("%d-%d", v.Low, v.High)
+}
+
+// intersect returns the versions in both ranges.
+func (v versions) intersect(o versions) versions {
+	if o.Low > v.Low {
+		v.Low = o.Low
+	}
+	if o.High < v.High {
+		v.High = o.High
+	}
+	return v
+}
+
+func (v *versions) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	p, err := parseVersions(s)
+	if err != nil {
+		return err
+	}
+	*v = p
+	return nil
+}
+
+func parseVersions(s string) (versions, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "none" {
+		return noVersions, nil
+	}
+	if strings.HasSuffix(s, "+") {
+		low, err := strconv.ParseInt(strings.TrimSuffix(s, "+"), 10, 16)
+		if err != nil {
+			return noVersions, fmt.Errorf("invalid versions %q", s)
+		}
+		return versions{Low: int16(low), High: math.MaxInt16}, nil
+	}
+	parts := strings.SplitN(s, "-", 2)
+	low, err := strconv.ParseInt(parts[0], 10, 16)
+	if err != nil {
+		return noVersions, fmt.Errorf("invalid versions %q", s)
+	}
+	high := low
+	if len(parts) == 2 {
+		if high, err = strconv.ParseInt(parts[1], 10, 16); err != nil || high < low {
+			return noVersions, fmt.Errorf("invalid versions %q", s)
+		}
+	}
+	return versions{Low: int16(low), High: int16(high)}, nil
+}
+
+// parseSchema parses the message definition. Kafka's definitions are JSON with line comments.
+func parseSchema(b []byte) (*schema, error) {
+	var buf bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(strings.TrimSpace(line), "//") {
+			continue
+		}
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	s := &schema{FlexibleVersions: noVersions}
+	if err := json.Unmarshal(buf.Bytes(), s); err != nil {
+		return nil, err
+	}
+	if s.Name == "" || s.APIKey == nil {
+		return nil, fmt.Errorf("schema missing name or api key")
+	}
+	if s.Type != "request" && s.Type != "response" {
+		return nil, fmt.Errorf("%s: unsupported message type %q", s.Name, s.Type)
+	}
+	if s.ValidVersions.none() {
+		return nil, fmt.Errorf("%s: no valid versions", s.Name)
+	}
+	return s, nil
+}
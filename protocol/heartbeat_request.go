@@ -1,34 +1,34 @@
+// Code generated by protocol/gen from schemas/HeartbeatRequest.json. DO NOT EDIT.
+
 package protocol
 
+func init() {
+	flexibleVersions[HeartbeatKey] = 4
+}
+
+// HeartbeatRequest is the Heartbeat API's request, versions 0-4.
 type HeartbeatRequest struct {
 	APIVersion int16
 
-	GroupID           string
+	// The group id.
+	GroupID string
+	// The generation of the group.
 	GroupGenerationID int32
-	MemberID          string
+	// The member ID.
+	MemberID string
+	// The unique identifier of the consumer instance provided by end user.
+	GroupInstanceID *string
+	// TaggedFields are the tagged fields of flexible versions unknown to this struct.
+	TaggedFields TaggedFields
 }
 
-func (r *HeartbeatRequest) Encode(e PacketEncoder) (err error) {
-	if err = e.PutString(r.GroupID); err != nil {
-		return err
-	}
-	e.PutInt32(r.GroupGenerationID)
-	return e.PutString(r.MemberID)
+func (r *HeartbeatRequest) Encode(e PacketEncoder) error {
+	return r.encode(e, r.APIVersion)
 }
 
-func (r *HeartbeatRequest) Decode(d PacketDecoder, version int16) (err error) {
+func (r *HeartbeatRequest) Decode(d PacketDecoder, version int16) error {
 	r.APIVersion = version
-
-	if r.GroupID, err = d.String(); err != nil {
-		return
-	}
-	if r.GroupGenerationID, err = d.Int32(); err != nil {
-		return
-	}
-	if r.MemberID, err = d.String(); err != nil {
-		return
-	}
-	return nil
+	return r.decode(d, version)
 }
 
 func (r *HeartbeatRequest) Key() int16 {
@@ -38,3 +38,79 @@ func (r *HeartbeatRequest) Key() int16 {
 func (r *HeartbeatRequest) Version() int16 {
 	return r.APIVersion
 }
+
+func (r *HeartbeatRequest) encode(e PacketEncoder, version int16) (err error) {
+	flexible := version >= 4
+	if flexible {
+		err = e.PutCompactString(r.GroupID)
+	} else {
+		err = e.PutString(r.GroupID)
+	}
+	if err != nil {
+		return err
+	}
+	e.PutInt32(r.GroupGenerationID)
+	if flexible {
+		err = e.PutCompactString(r.MemberID)
+	} else {
+		err = e.PutString(r.MemberID)
+	}
+	if err != nil {
+		return err
+	}
+	if version >= 3 {
+		if flexible {
+			err = e.PutCompactNullableString(r.GroupInstanceID)
+		} else {
+			err = e.PutNullableString(r.GroupInstanceID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if flexible {
+		if err = e.PutTaggedFields(r.TaggedFields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *HeartbeatRequest) decode(d PacketDecoder, version int16) (err error) {
+	flexible := version >= 4
+	if flexible {
+		r.GroupID, err = d.CompactString()
+	} else {
+		r.GroupID, err = d.String()
+	}
+	if err != nil {
+		return err
+	}
+	if r.GroupGenerationID, err = d.Int32(); err != nil {
+		return err
+	}
+	if flexible {
+		r.MemberID, err = d.CompactString()
+	} else {
+		r.MemberID, err = d.String()
+	}
+	if err != nil {
+		return err
+	}
+	if version >= 3 {
+		if flexible {
+			r.GroupInstanceID, err = d.CompactNullableString()
+		} else {
+			r.GroupInstanceID, err = d.NullableString()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if flexible {
+		if r.TaggedFields, err = d.TaggedFields(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
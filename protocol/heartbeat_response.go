@@ -1,31 +1,28 @@
+// Code generated by protocol/gen from schemas/HeartbeatResponse.json. DO NOT EDIT.
+
 package protocol
 
 import "time"
 
+// HeartbeatResponse is the Heartbeat API's response, versions 0-4.
 type HeartbeatResponse struct {
 	APIVersion int16
 
+	// The duration in milliseconds for which the request was throttled due to a quota violation, or zero if the request did not violate any quota.
 	ThrottleTime time.Duration
-	ErrorCode    int16
+	// The error code, or 0 if there was no error.
+	ErrorCode int16
+	// TaggedFields are the tagged fields of flexible versions unknown to this struct.
+	TaggedFields TaggedFields
 }
 
 func (r *HeartbeatResponse) Encode(e PacketEncoder) error {
-	e.PutInt16(r.ErrorCode)
-	return nil
+	return r.encode(e, r.APIVersion)
 }
 
-func (r *HeartbeatResponse) Decode(d PacketDecoder, version int16) (err error) {
+func (r *HeartbeatResponse) Decode(d PacketDecoder, version int16) error {
 	r.APIVersion = version
-
-	if version >= 1 {
-		throttle, err := d.Int32()
-		if err != nil {
-			return err
-		}
-		r.ThrottleTime = time.Duration(throttle) / time.Millisecond
-	}
-	r.ErrorCode, err = d.Int16()
-	return err
+	return r.decode(d, version)
 }
 
 func (r *HeartbeatResponse) Key() int16 {
@@ -35,3 +32,37 @@ func (r *HeartbeatResponse) Key() int16 {
 func (r *HeartbeatResponse) Version() int16 {
 	return r.APIVersion
 }
+
+func (r *HeartbeatResponse) encode(e PacketEncoder, version int16) (err error) {
+	flexible := version >= 4
+	if version >= 1 {
+		e.PutInt32(int32(r.ThrottleTime / time.Millisecond))
+	}
+	e.PutInt16(r.ErrorCode)
+	if flexible {
+		if err = e.PutTaggedFields(r.TaggedFields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *HeartbeatResponse) decode(d PacketDecoder, version int16) (err error) {
+	flexible := version >= 4
+	if version >= 1 {
+		if ms, err := d.Int32(); err != nil {
+			return err
+		} else {
+			r.ThrottleTime = time.Duration(ms) * time.Millisecond
+		}
+	}
+	if r.ErrorCode, err = d.Int16(); err != nil {
+		return err
+	}
+	if flexible {
+		if r.TaggedFields, err = d.TaggedFields(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
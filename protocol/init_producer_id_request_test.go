@@ -0,0 +1,41 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInitProducerIDRequest(t *testing.T) {
+	req := require.New(t)
+	txnID := "txn"
+	for _, exp := range []*InitProducerIDRequest{
+		{APIVersion: 1, TransactionalID: &txnID, TransactionTimeout: time.Minute},
+		{TransactionTimeout: -time.Millisecond},
+	} {
+		b, err := Encode(exp)
+		req.NoError(err)
+		var act InitProducerIDRequest
+		err = Decode(b, &act, exp.Version())
+		req.NoError(err)
+		req.Equal(exp, &act)
+	}
+}
+
+func TestInitProducerIDResponse(t *testing.T) {
+	req := require.New(t)
+	exp := &InitProducerIDResponse{
+		APIVersion:    1,
+		ThrottleTime:  time.Second,
+		ErrorCode:     ErrNone.Code(),
+		ProducerID:    42,
+		ProducerEpoch: 3,
+	}
+	b, err := Encode(exp)
+	req.NoError(err)
+	var act InitProducerIDResponse
+	err = Decode(b, &act, exp.Version())
+	req.NoError(err)
+	req.Equal(exp, &act)
+}
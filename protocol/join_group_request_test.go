@@ -0,0 +1,58 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJoinGroupRequest(t *testing.T) {
+	req := require.New(t)
+	for _, exp := range []*JoinGroupRequest{{
+		APIVersion:     0,
+		GroupID:        "group",
+		SessionTimeout: 10000,
+		MemberID:       "",
+		ProtocolType:   "consumer",
+		GroupProtocols: []*GroupProtocol{{ProtocolName: "range", ProtocolMetadata: []byte("metadata")}},
+	}, {
+		APIVersion:       2,
+		GroupID:          "group",
+		SessionTimeout:   10000,
+		RebalanceTimeout: 60000,
+		MemberID:         "member",
+		ProtocolType:     "consumer",
+		GroupProtocols: []*GroupProtocol{
+			{ProtocolName: "range", ProtocolMetadata: []byte("metadata")},
+			{ProtocolName: "roundrobin", ProtocolMetadata: []byte("metadata")},
+		},
+	}} {
+		b, err := Encode(exp)
+		req.NoError(err)
+		var act JoinGroupRequest
+		err = Decode(b, &act, exp.Version())
+		req.NoError(err)
+		req.Equal(exp, &act)
+	}
+}
+
+func TestJoinGroupResponse(t *testing.T) {
+	req := require.New(t)
+	exp := &JoinGroupResponse{
+		APIVersion:    2,
+		GenerationID:  3,
+		GroupProtocol: "range",
+		LeaderID:      "member-1",
+		MemberID:      "member-1",
+		Members: []Member{
+			{MemberID: "member-1", MemberMetadata: []byte("metadata-1")},
+			{MemberID: "member-2", MemberMetadata: []byte("metadata-2")},
+		},
+	}
+	b, err := Encode(exp)
+	req.NoError(err)
+	var act JoinGroupResponse
+	err = Decode(b, &act, exp.Version())
+	req.NoError(err)
+	req.Equal(exp, &act)
+}
@@ -1,26 +1,44 @@
+// Code generated by protocol/gen from schemas/LeaveGroupRequest.json. DO NOT EDIT.
+
 package protocol
 
+func init() {
+	flexibleVersions[LeaveGroupKey] = 4
+}
+
+// LeaveGroupRequest is the LeaveGroup API's request, versions 0-5.
 type LeaveGroupRequest struct {
 	APIVersion int16
 
-	GroupID  string
+	// The ID of the group to leave.
+	GroupID string
+	// The member ID to remove from the group.
+	MemberID string
+	// List of leaving member identities.
+	Members []*LeaveGroupRequestMemberIdentity
+	// TaggedFields are the tagged fields of flexible versions unknown to this struct.
+	TaggedFields TaggedFields
+}
+
+// LeaveGroupRequestMemberIdentity is an element of LeaveGroupRequest's Members.
+type LeaveGroupRequestMemberIdentity struct {
+	// The member ID to remove from the group.
 	MemberID string
+	// The group instance ID to remove from the group.
+	GroupInstanceID *string
+	// The reason why the member left the group.
+	Reason *string
+	// TaggedFields are the tagged fields of flexible versions unknown to this struct.
+	TaggedFields TaggedFields
 }
 
 func (r *LeaveGroupRequest) Encode(e PacketEncoder) error {
-	if err := e.PutString(r.GroupID); err != nil {
-		return err
-	}
-	return e.PutString(r.MemberID)
+	return r.encode(e, r.APIVersion)
 }
 
-func (r *LeaveGroupRequest) Decode(d PacketDecoder, version int16) (err error) {
+func (r *LeaveGroupRequest) Decode(d PacketDecoder, version int16) error {
 	r.APIVersion = version
-	if r.GroupID, err = d.String(); err != nil {
-		return err
-	}
-	r.MemberID, err = d.String()
-	return err
+	return r.decode(d, version)
 }
 
 func (r *LeaveGroupRequest) Key() int16 {
@@ -30,3 +48,166 @@ func (r *LeaveGroupRequest) Key() int16 {
 func (r *LeaveGroupRequest) Version() int16 {
 	return r.APIVersion
 }
+
+func (r *LeaveGroupRequest) encode(e PacketEncoder, version int16) (err error) {
+	flexible := version >= 4
+	if flexible {
+		err = e.PutCompactString(r.GroupID)
+	} else {
+		err = e.PutString(r.GroupID)
+	}
+	if err != nil {
+		return err
+	}
+	if version <= 2 {
+		if flexible {
+			err = e.PutCompactString(r.MemberID)
+		} else {
+			err = e.PutString(r.MemberID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if version >= 3 {
+		if flexible {
+			err = e.PutCompactArrayLength(len(r.Members))
+		} else {
+			err = e.PutArrayLength(len(r.Members))
+		}
+		if err != nil {
+			return err
+		}
+		for _, v := range r.Members {
+			if err = v.encode(e, version); err != nil {
+				return err
+			}
+		}
+	}
+	if flexible {
+		if err = e.PutTaggedFields(r.TaggedFields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *LeaveGroupRequest) decode(d PacketDecoder, version int16) (err error) {
+	flexible := version >= 4
+	var n int
+	if flexible {
+		r.GroupID, err = d.CompactString()
+	} else {
+		r.GroupID, err = d.String()
+	}
+	if err != nil {
+		return err
+	}
+	if version <= 2 {
+		if flexible {
+			r.MemberID, err = d.CompactString()
+		} else {
+			r.MemberID, err = d.String()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if version >= 3 {
+		if flexible {
+			n, err = d.CompactArrayLength()
+		} else {
+			n, err = d.ArrayLength()
+		}
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			r.Members = make([]*LeaveGroupRequestMemberIdentity, n)
+			for i := range r.Members {
+				r.Members[i] = new(LeaveGroupRequestMemberIdentity)
+				if err = r.Members[i].decode(d, version); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if flexible {
+		if r.TaggedFields, err = d.TaggedFields(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *LeaveGroupRequestMemberIdentity) encode(e PacketEncoder, version int16) (err error) {
+	flexible := version >= 4
+	if flexible {
+		err = e.PutCompactString(r.MemberID)
+	} else {
+		err = e.PutString(r.MemberID)
+	}
+	if err != nil {
+		return err
+	}
+	if flexible {
+		err = e.PutCompactNullableString(r.GroupInstanceID)
+	} else {
+		err = e.PutNullableString(r.GroupInstanceID)
+	}
+	if err != nil {
+		return err
+	}
+	if version >= 5 {
+		if flexible {
+			err = e.PutCompactNullableString(r.Reason)
+		} else {
+			err = e.PutNullableString(r.Reason)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if flexible {
+		if err = e.PutTaggedFields(r.TaggedFields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *LeaveGroupRequestMemberIdentity) decode(d PacketDecoder, version int16) (err error) {
+	flexible := version >= 4
+	if flexible {
+		r.MemberID, err = d.CompactString()
+	} else {
+		r.MemberID, err = d.String()
+	}
+	if err != nil {
+		return err
+	}
+	if flexible {
+		r.GroupInstanceID, err = d.CompactNullableString()
+	} else {
+		r.GroupInstanceID, err = d.NullableString()
+	}
+	if err != nil {
+		return err
+	}
+	if version >= 5 {
+		if flexible {
+			r.Reason, err = d.CompactNullableString()
+		} else {
+			r.Reason, err = d.NullableString()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if flexible {
+		if r.TaggedFields, err = d.TaggedFields(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeaveGroupRequest(t *testing.T) {
+	req := require.New(t)
+	instance := "instance"
+	reason := "shutting down"
+	for _, exp := range []*LeaveGroupRequest{{
+		APIVersion: 1,
+		GroupID:    "group",
+		MemberID:   "member",
+	}, {
+		APIVersion: 3,
+		GroupID:    "group",
+		Members: []*LeaveGroupRequestMemberIdentity{
+			{MemberID: "member-1", GroupInstanceID: &instance},
+			{MemberID: "member-2"},
+		},
+	}, {
+		APIVersion: 5,
+		GroupID:    "group",
+		Members: []*LeaveGroupRequestMemberIdentity{
+			{MemberID: "member-1", Reason: &reason, TaggedFields: TaggedFields{7: []byte{1}}},
+		},
+		TaggedFields: TaggedFields{0: []byte("tag")},
+	}} {
+		b, err := Encode(exp)
+		req.NoError(err)
+		var act LeaveGroupRequest
+		err = Decode(b, &act, exp.Version())
+		req.NoError(err)
+		req.Equal(exp, &act)
+	}
+}
+
+func TestLeaveGroupResponse(t *testing.T) {
+	req := require.New(t)
+	for _, exp := range []*LeaveGroupResponse{{
+		APIVersion: 0,
+		ErrorCode:  ErrUnknownMemberId.Code(),
+	}, {
+		APIVersion:   1,
+		ThrottleTime: 100 * time.Millisecond,
+	}, {
+		APIVersion:   4,
+		ThrottleTime: time.Second,
+		Members: []*LeaveGroupResponseMemberResponse{
+			{MemberID: "member", ErrorCode: ErrNone.Code()},
+		},
+	}} {
+		b, err := Encode(exp)
+		req.NoError(err)
+		var act LeaveGroupResponse
+		err = Decode(b, &act, exp.Version())
+		req.NoError(err)
+		req.Equal(exp, &act)
+	}
+}
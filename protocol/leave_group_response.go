@@ -1,39 +1,173 @@
+// Code generated by protocol/gen from schemas/LeaveGroupResponse.json. DO NOT EDIT.
+
 package protocol
 
 import "time"
 
+// LeaveGroupResponse is the LeaveGroup API's response, versions 0-5.
 type LeaveGroupResponse struct {
 	APIVersion int16
 
+	// The duration in milliseconds for which the request was throttled due to a quota violation, or zero if the request did not violate any quota.
 	ThrottleTime time.Duration
-	ErrorCode    int16
+	// The error code, or 0 if there was no error.
+	ErrorCode int16
+	// List of leaving member responses.
+	Members []*LeaveGroupResponseMemberResponse
+	// TaggedFields are the tagged fields of flexible versions unknown to this struct.
+	TaggedFields TaggedFields
+}
+
+// LeaveGroupResponseMemberResponse is an element of LeaveGroupResponse's Members.
+type LeaveGroupResponseMemberResponse struct {
+	// The member ID to remove from the group.
+	MemberID string
+	// The group instance ID to remove from the group.
+	GroupInstanceID *string
+	// The error code, or 0 if there was no error.
+	ErrorCode int16
+	// TaggedFields are the tagged fields of flexible versions unknown to this struct.
+	TaggedFields TaggedFields
 }
 
 func (r *LeaveGroupResponse) Encode(e PacketEncoder) error {
-	if r.APIVersion >= 1 {
+	return r.encode(e, r.APIVersion)
+}
+
+func (r *LeaveGroupResponse) Decode(d PacketDecoder, version int16) error {
+	r.APIVersion = version
+	return r.decode(d, version)
+}
+
+func (r *LeaveGroupResponse) Key() int16 {
+	return LeaveGroupKey
+}
+
+func (r *LeaveGroupResponse) Version() int16 {
+	return r.APIVersion
+}
+
+func (r *LeaveGroupResponse) encode(e PacketEncoder, version int16) (err error) {
+	flexible := version >= 4
+	if version >= 1 {
 		e.PutInt32(int32(r.ThrottleTime / time.Millisecond))
 	}
 	e.PutInt16(r.ErrorCode)
+	if version >= 3 {
+		if flexible {
+			err = e.PutCompactArrayLength(len(r.Members))
+		} else {
+			err = e.PutArrayLength(len(r.Members))
+		}
+		if err != nil {
+			return err
+		}
+		for _, v := range r.Members {
+			if err = v.encode(e, version); err != nil {
+				return err
+			}
+		}
+	}
+	if flexible {
+		if err = e.PutTaggedFields(r.TaggedFields); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (r *LeaveGroupResponse) Decode(d PacketDecoder, version int16) (err error) {
-	r.APIVersion = version
-	if r.APIVersion >= 1 {
-		throttle, err := d.Int32()
+func (r *LeaveGroupResponse) decode(d PacketDecoder, version int16) (err error) {
+	flexible := version >= 4
+	var n int
+	if version >= 1 {
+		if ms, err := d.Int32(); err != nil {
+			return err
+		} else {
+			r.ThrottleTime = time.Duration(ms) * time.Millisecond
+		}
+	}
+	if r.ErrorCode, err = d.Int16(); err != nil {
+		return err
+	}
+	if version >= 3 {
+		if flexible {
+			n, err = d.CompactArrayLength()
+		} else {
+			n, err = d.ArrayLength()
+		}
 		if err != nil {
 			return err
 		}
-		r.ThrottleTime = time.Duration(throttle) * time.Millisecond
+		if n > 0 {
+			r.Members = make([]*LeaveGroupResponseMemberResponse, n)
+			for i := range r.Members {
+				r.Members[i] = new(LeaveGroupResponseMemberResponse)
+				if err = r.Members[i].decode(d, version); err != nil {
+					return err
+				}
+			}
+		}
 	}
-	r.ErrorCode, err = d.Int16()
-	return err
+	if flexible {
+		if r.TaggedFields, err = d.TaggedFields(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (r *LeaveGroupResponse) Key() int16 {
-	return 13
+func (r *LeaveGroupResponseMemberResponse) encode(e PacketEncoder, version int16) (err error) {
+	flexible := version >= 4
+	if flexible {
+		err = e.PutCompactString(r.MemberID)
+	} else {
+		err = e.PutString(r.MemberID)
+	}
+	if err != nil {
+		return err
+	}
+	if flexible {
+		err = e.PutCompactNullableString(r.GroupInstanceID)
+	} else {
+		err = e.PutNullableString(r.GroupInstanceID)
+	}
+	if err != nil {
+		return err
+	}
+	e.PutInt16(r.ErrorCode)
+	if flexible {
+		if err = e.PutTaggedFields(r.TaggedFields); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (r *LeaveGroupResponse) Version() int16 {
-	return r.APIVersion
+func (r *LeaveGroupResponseMemberResponse) decode(d PacketDecoder, version int16) (err error) {
+	flexible := version >= 4
+	if flexible {
+		r.MemberID, err = d.CompactString()
+	} else {
+		r.MemberID, err = d.String()
+	}
+	if err != nil {
+		return err
+	}
+	if flexible {
+		r.GroupInstanceID, err = d.CompactNullableString()
+	} else {
+		r.GroupInstanceID, err = d.NullableString()
+	}
+	if err != nil {
+		return err
+	}
+	if r.ErrorCode, err = d.Int16(); err != nil {
+		return err
+	}
+	if flexible {
+		if r.TaggedFields, err = d.TaggedFields(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -16,7 +16,7 @@ func (m *Message) Encode(e PacketEncoder) error {
 	e.PutInt8(m.MagicByte)
 	e.PutInt8(m.Attributes)
 	if m.MagicByte > 0 {
-		e.PutInt64(m.Timestamp.UnixNano() / int64(time.Millisecond))
+		e.PutInt64(timestampMillis(m.Timestamp))
 	}
 	if err := e.PutBytes(m.Key); err != nil {
 		return err
@@ -44,7 +44,7 @@ func (m *Message) Decode(d PacketDecoder) error {
 		if err != nil {
 			return err
 		}
-		m.Timestamp = time.Unix(t/1000, (t%1000)*int64(time.Millisecond))
+		m.Timestamp = millisTimestamp(t)
 	}
 	if m.Key, err = d.Bytes(); err != nil {
 		return err
@@ -27,7 +27,24 @@ func (ms *MessageSet) Decode(d PacketDecoder) error {
 	if ms.Size, err = d.Int32(); err != nil {
 		return err
 	}
+	// end is what remains once the messages the size covers are read. Kafka's clients give each
+	// message its own offset and size, which are skipped since a set's messages share its offset.
+	end := d.remaining() - int(ms.Size)
 	for d.remaining() > 0 {
+		if d.remaining() <= end {
+			if d.remaining() < 12 {
+				ms.PartialTrailingMessages = true
+				return nil
+			}
+			if _, err = d.Int64(); err != nil {
+				return err
+			}
+			size, err := d.Int32()
+			if err != nil {
+				return err
+			}
+			end = d.remaining() - int(size)
+		}
 		m := new(Message)
 		err = m.Decode(d)
 		switch err {
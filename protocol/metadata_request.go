@@ -1,32 +1,123 @@
 package protocol
 
+func init() {
+	flexibleVersions[MetadataKey] = 9
+}
+
 type MetadataRequest struct {
 	APIVersion int16
 
-	Topics                 []string
+	// Topics are the topics to return, every topic if nil. Version 0 can't request no topics, its
+	// empty topics are every topic, while later versions' topics are nullable.
+	Topics []string
+	// TopicIDs are the IDs of topics to return too, sent from v10.
+	TopicIDs               []string
 	AllowAutoTopicCreation bool
+	// IncludeClusterAuthorizedOperations, sent from v8 to v10, and
+	// IncludeTopicAuthorizedOperations, sent from v8, ask for the operations the client's
+	// authorized to do on the cluster and the topics.
+	IncludeClusterAuthorizedOperations bool
+	IncludeTopicAuthorizedOperations   bool
+	// TaggedFields are the tagged fields of flexible versions, sent from v9.
+	TaggedFields TaggedFields
 }
 
 func (r *MetadataRequest) Encode(e PacketEncoder) (err error) {
-	err = e.PutStringArray(r.Topics)
-	if err != nil {
+	flexible := IsFlexible(MetadataKey, r.APIVersion)
+	// topics are requested by name and from v10 by ID, with a null name.
+	byID := r.APIVersion >= 10
+	n := len(r.Topics)
+	if byID {
+		n += len(r.TopicIDs)
+	}
+	null := r.APIVersion >= 1 && r.Topics == nil && (!byID || r.TopicIDs == nil)
+	if err = putNullableArrayLength(e, flexible, n, null); err != nil {
 		return err
 	}
+	for _, name := range r.Topics {
+		if byID {
+			if err = e.PutUUID(""); err != nil {
+				return err
+			}
+		}
+		if err = putString(e, flexible, name); err != nil {
+			return err
+		}
+		if err = putTaggedFields(e, flexible, nil); err != nil {
+			return err
+		}
+	}
+	if byID {
+		for _, id := range r.TopicIDs {
+			if err = e.PutUUID(id); err != nil {
+				return err
+			}
+			if err = putNullableString(e, flexible, nil); err != nil {
+				return err
+			}
+			if err = putTaggedFields(e, flexible, nil); err != nil {
+				return err
+			}
+		}
+	}
 	if r.APIVersion >= 4 {
 		e.PutBool(r.AllowAutoTopicCreation)
 	}
-	return nil
+	if r.APIVersion >= 8 && r.APIVersion <= 10 {
+		e.PutBool(r.IncludeClusterAuthorizedOperations)
+	}
+	if r.APIVersion >= 8 {
+		e.PutBool(r.IncludeTopicAuthorizedOperations)
+	}
+	return putTaggedFields(e, flexible, r.TaggedFields)
 }
 
 func (r *MetadataRequest) Decode(d PacketDecoder, version int16) (err error) {
 	r.APIVersion = version
-	r.Topics, err = d.StringArray()
+	flexible := IsFlexible(MetadataKey, version)
+	n, err := nullableArrayLength(d, flexible)
 	if err != nil {
 		return err
 	}
+	if n >= 0 && (version >= 1 || n > 0) {
+		r.Topics = make([]string, 0, n)
+	}
+	for i := 0; i < n; i++ {
+		var id string
+		if version >= 10 {
+			if id, err = d.UUID(); err != nil {
+				return err
+			}
+		}
+		name, err := getNullableString(d, flexible)
+		if err != nil {
+			return err
+		}
+		if name != nil {
+			r.Topics = append(r.Topics, *name)
+		} else {
+			r.TopicIDs = append(r.TopicIDs, id)
+		}
+		if _, err = getTaggedFields(d, flexible); err != nil {
+			return err
+		}
+	}
 	if version >= 4 {
-		r.AllowAutoTopicCreation, err = d.Bool()
+		if r.AllowAutoTopicCreation, err = d.Bool(); err != nil {
+			return err
+		}
+	}
+	if version >= 8 && version <= 10 {
+		if r.IncludeClusterAuthorizedOperations, err = d.Bool(); err != nil {
+			return err
+		}
+	}
+	if version >= 8 {
+		if r.IncludeTopicAuthorizedOperations, err = d.Bool(); err != nil {
+			return err
+		}
 	}
+	r.TaggedFields, err = getTaggedFields(d, flexible)
 	return err
 }
 
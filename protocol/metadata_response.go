@@ -1,78 +1,158 @@
 package protocol
 
+import "time"
+
 type Broker struct {
 	NodeID int32
 	Host   string
 	Port   int32
-	// unsupported: Rack *string
+	Rack   *string
 }
 
 type PartitionMetadata struct {
 	PartitionErrorCode int16
 	PartitionID        int32
 	Leader             int32
-	Replicas           []int32
-	ISR                []int32
+	// LeaderEpoch is sent from v7.
+	LeaderEpoch int32
+	Replicas    []int32
+	ISR         []int32
+	// OfflineReplicas is sent from v5.
+	OfflineReplicas []int32
 }
 
+// AuthorizedOperationsOmitted is the authorized operations of metadata responses to requests that
+// didn't ask for them.
+const AuthorizedOperationsOmitted int32 = -2147483648
+
 type TopicMetadata struct {
-	TopicErrorCode    int16
-	Topic             string
+	TopicErrorCode int16
+	Topic          string
+	// TopicID is sent from v10.
+	TopicID           string
+	IsInternal        bool
 	PartitionMetadata []*PartitionMetadata
+	// TopicAuthorizedOperations is sent from v8.
+	TopicAuthorizedOperations int32
 }
 
 type MetadataResponse struct {
 	APIVersion int16
 
+	ThrottleTime  time.Duration
 	Brokers       []*Broker
+	ClusterID     *string
 	ControllerID  int32
 	TopicMetadata []*TopicMetadata
+	// ClusterAuthorizedOperations is sent from v8 to v10.
+	ClusterAuthorizedOperations int32
+	// TaggedFields are the tagged fields of flexible versions, sent from v9.
+	TaggedFields TaggedFields
 }
 
 func (r *MetadataResponse) Encode(e PacketEncoder) (err error) {
-	if err = e.PutArrayLength(len(r.Brokers)); err != nil {
+	flexible := IsFlexible(MetadataKey, r.APIVersion)
+	if r.APIVersion >= 3 {
+		e.PutInt32(int32(r.ThrottleTime / time.Millisecond))
+	}
+	if err = putArrayLength(e, flexible, len(r.Brokers)); err != nil {
 		return err
 	}
 	for _, b := range r.Brokers {
 		e.PutInt32(b.NodeID)
-		if err = e.PutString(b.Host); err != nil {
+		if err = putString(e, flexible, b.Host); err != nil {
 			return err
 		}
 		e.PutInt32(b.Port)
+		if r.APIVersion >= 1 {
+			if err = putNullableString(e, flexible, b.Rack); err != nil {
+				return err
+			}
+		}
+		if err = putTaggedFields(e, flexible, nil); err != nil {
+			return err
+		}
+	}
+	if r.APIVersion >= 2 {
+		if err = putNullableString(e, flexible, r.ClusterID); err != nil {
+			return err
+		}
 	}
 	if r.APIVersion >= 1 {
 		e.PutInt32(r.ControllerID)
 	}
-	if err = e.PutArrayLength(len(r.TopicMetadata)); err != nil {
+	if err = putArrayLength(e, flexible, len(r.TopicMetadata)); err != nil {
 		return err
 	}
 	for _, t := range r.TopicMetadata {
 		e.PutInt16(t.TopicErrorCode)
-		if err = e.PutString(t.Topic); err != nil {
+		if r.APIVersion >= 10 && t.Topic == "" {
+			// the name's null from v10, e.g. the topic requested by ID is unknown.
+			err = putNullableString(e, flexible, nil)
+		} else {
+			err = putString(e, flexible, t.Topic)
+		}
+		if err != nil {
 			return err
 		}
-		if err = e.PutArrayLength(len(t.PartitionMetadata)); err != nil {
+		if r.APIVersion >= 10 {
+			if err = e.PutUUID(t.TopicID); err != nil {
+				return err
+			}
+		}
+		if r.APIVersion >= 1 {
+			e.PutBool(t.IsInternal)
+		}
+		if err = putArrayLength(e, flexible, len(t.PartitionMetadata)); err != nil {
 			return err
 		}
 		for _, p := range t.PartitionMetadata {
 			e.PutInt16(p.PartitionErrorCode)
 			e.PutInt32(p.PartitionID)
 			e.PutInt32(p.Leader)
-			if err = e.PutInt32Array(p.Replicas); err != nil {
+			if r.APIVersion >= 7 {
+				e.PutInt32(p.LeaderEpoch)
+			}
+			if err = putInt32Array(e, flexible, p.Replicas); err != nil {
+				return err
+			}
+			if err = putInt32Array(e, flexible, p.ISR); err != nil {
 				return err
 			}
-			if err = e.PutInt32Array(p.ISR); err != nil {
+			if r.APIVersion >= 5 {
+				if err = putInt32Array(e, flexible, p.OfflineReplicas); err != nil {
+					return err
+				}
+			}
+			if err = putTaggedFields(e, flexible, nil); err != nil {
 				return err
 			}
 		}
+		if r.APIVersion >= 8 {
+			e.PutInt32(t.TopicAuthorizedOperations)
+		}
+		if err = putTaggedFields(e, flexible, nil); err != nil {
+			return err
+		}
 	}
-	return nil
+	if r.APIVersion >= 8 && r.APIVersion <= 10 {
+		e.PutInt32(r.ClusterAuthorizedOperations)
+	}
+	return putTaggedFields(e, flexible, r.TaggedFields)
 }
 
 func (r *MetadataResponse) Decode(d PacketDecoder, version int16) (err error) {
 	r.APIVersion = version
+	flexible := IsFlexible(MetadataKey, version)
 
-	brokerCount, err := d.ArrayLength()
+	if version >= 3 {
+		throttle, err := d.Int32()
+		if err != nil {
+			return err
+		}
+		r.ThrottleTime = time.Duration(throttle) * time.Millisecond
+	}
+	brokerCount, err := arrayLength(d, flexible)
 	if err != nil {
 		return err
 	}
@@ -82,7 +162,7 @@ func (r *MetadataResponse) Decode(d PacketDecoder, version int16) (err error) {
 		if err != nil {
 			return err
 		}
-		host, err := d.String()
+		host, err := getString(d, flexible)
 		if err != nil {
 			return err
 		}
@@ -95,6 +175,19 @@ func (r *MetadataResponse) Decode(d PacketDecoder, version int16) (err error) {
 			Host:   host,
 			Port:   port,
 		}
+		if version >= 1 {
+			if r.Brokers[i].Rack, err = getNullableString(d, flexible); err != nil {
+				return err
+			}
+		}
+		if _, err = getTaggedFields(d, flexible); err != nil {
+			return err
+		}
+	}
+	if version >= 2 {
+		if r.ClusterID, err = getNullableString(d, flexible); err != nil {
+			return err
+		}
 	}
 	if version >= 1 {
 		r.ControllerID, err = d.Int32()
@@ -102,7 +195,7 @@ func (r *MetadataResponse) Decode(d PacketDecoder, version int16) (err error) {
 			return err
 		}
 	}
-	topicCount, err := d.ArrayLength()
+	topicCount, err := arrayLength(d, flexible)
 	if err != nil {
 		return err
 	}
@@ -113,11 +206,28 @@ func (r *MetadataResponse) Decode(d PacketDecoder, version int16) (err error) {
 		if err != nil {
 			return err
 		}
-		m.Topic, err = d.String()
-		if err != nil {
+		if version >= 10 {
+			var name *string
+			if name, err = getNullableString(d, flexible); err != nil {
+				return err
+			}
+			if name != nil {
+				m.Topic = *name
+			}
+		} else if m.Topic, err = getString(d, flexible); err != nil {
 			return err
 		}
-		partitionCount, err := d.ArrayLength()
+		if version >= 10 {
+			if m.TopicID, err = d.UUID(); err != nil {
+				return err
+			}
+		}
+		if version >= 1 {
+			if m.IsInternal, err = d.Bool(); err != nil {
+				return err
+			}
+		}
+		partitionCount, err := arrayLength(d, flexible)
 		if err != nil {
 			return err
 		}
@@ -136,17 +246,47 @@ func (r *MetadataResponse) Decode(d PacketDecoder, version int16) (err error) {
 			if err != nil {
 				return err
 			}
-			p.Replicas, err = d.Int32Array()
+			if version >= 7 {
+				if p.LeaderEpoch, err = d.Int32(); err != nil {
+					return err
+				}
+			}
+			p.Replicas, err = getInt32Array(d, flexible)
+			if err != nil {
+				return err
+			}
+			p.ISR, err = getInt32Array(d, flexible)
 			if err != nil {
 				return err
 			}
-			p.ISR, err = d.Int32Array()
+			if version >= 5 {
+				if p.OfflineReplicas, err = getInt32Array(d, flexible); err != nil {
+					return err
+				}
+			}
+			if _, err = getTaggedFields(d, flexible); err != nil {
+				return err
+			}
 			partitions[i] = p
 		}
 		m.PartitionMetadata = partitions
+		if version >= 8 {
+			if m.TopicAuthorizedOperations, err = d.Int32(); err != nil {
+				return err
+			}
+		}
+		if _, err = getTaggedFields(d, flexible); err != nil {
+			return err
+		}
 		r.TopicMetadata[i] = m
 	}
-	return nil
+	if version >= 8 && version <= 10 {
+		if r.ClusterAuthorizedOperations, err = d.Int32(); err != nil {
+			return err
+		}
+	}
+	r.TaggedFields, err = getTaggedFields(d, flexible)
+	return err
 }
 
 func (r *MetadataResponse) Version() int16 {
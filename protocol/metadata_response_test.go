@@ -0,0 +1,64 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetadataResponse(t *testing.T) {
+	req := require.New(t)
+	rack, clusterID := "rack", "cluster"
+	for version := int16(0); version <= 10; version++ {
+		exp := &MetadataResponse{
+			APIVersion: version,
+			Brokers:    []*Broker{{NodeID: 1, Host: "localhost", Port: 9092}},
+			TopicMetadata: []*TopicMetadata{{
+				Topic: "test",
+				PartitionMetadata: []*PartitionMetadata{{
+					PartitionID: 0,
+					Leader:      1,
+					Replicas:    []int32{1},
+					ISR:         []int32{1},
+				}},
+			}},
+		}
+		if version >= 1 {
+			exp.Brokers[0].Rack = &rack
+			exp.ControllerID = 1
+			exp.TopicMetadata[0].IsInternal = true
+		}
+		if version >= 2 {
+			exp.ClusterID = &clusterID
+		}
+		if version >= 3 {
+			exp.ThrottleTime = time.Second
+		}
+		if version >= 5 {
+			exp.TopicMetadata[0].PartitionMetadata[0].OfflineReplicas = []int32{2}
+		}
+		if version >= 7 {
+			exp.TopicMetadata[0].PartitionMetadata[0].LeaderEpoch = 3
+		}
+		if version >= 8 {
+			exp.TopicMetadata[0].TopicAuthorizedOperations = AuthorizedOperationsOmitted
+			exp.ClusterAuthorizedOperations = AuthorizedOperationsOmitted
+		}
+		if version >= 10 {
+			exp.TopicMetadata[0].TopicID = "5f2e3a1b-7c4d-4e8a-9b0c-1d2e3f405162"
+			// the unknown topic requested by ID has a null name.
+			exp.TopicMetadata = append(exp.TopicMetadata, &TopicMetadata{
+				TopicErrorCode:            ErrUnknownTopicID.Code(),
+				TopicID:                   "0b7e4c2a-1f3d-4a5b-8c6d-7e8f90a1b2c3",
+				PartitionMetadata:         []*PartitionMetadata{},
+				TopicAuthorizedOperations: AuthorizedOperationsOmitted,
+			})
+		}
+		b, err := Encode(exp)
+		req.NoError(err)
+		var act MetadataResponse
+		req.NoError(Decode(b, &act, version))
+		req.Equal(exp, &act)
+	}
+}
@@ -1,104 +1,332 @@
+// Code generated by protocol/gen from schemas/OffsetCommitRequest.json. DO NOT EDIT.
+
 package protocol
 
+import "time"
+
+func init() {
+	flexibleVersions[OffsetCommitKey] = 8
+}
+
+// OffsetCommitRequest is the OffsetCommit API's request, versions 0-8.
 type OffsetCommitRequest struct {
 	APIVersion int16
 
-	GroupID       string
-	GenerationID  int32
-	MemberID      string
-	RetentionTime int64
-	Topics        []OffsetCommitTopicRequest
+	// The unique group identifier.
+	GroupID string
+	// The generation of the group.
+	GenerationID int32
+	// The member ID assigned by the group coordinator.
+	MemberID string
+	// The unique identifier of the consumer instance provided by end user.
+	GroupInstanceID *string
+	// The time period in ms to retain the offset.
+	RetentionTime time.Duration
+	// The topics to commit offsets for.
+	Topics []*OffsetCommitRequestTopic
+	// TaggedFields are the tagged fields of flexible versions unknown to this struct.
+	TaggedFields TaggedFields
+}
+
+// OffsetCommitRequestTopic is an element of OffsetCommitRequest's Topics.
+type OffsetCommitRequestTopic struct {
+	// The topic name.
+	Name string
+	// Each partition to commit offsets for.
+	Partitions []*OffsetCommitRequestPartition
+	// TaggedFields are the tagged fields of flexible versions unknown to this struct.
+	TaggedFields TaggedFields
+}
+
+// OffsetCommitRequestPartition is an element of OffsetCommitRequestTopic's Partitions.
+type OffsetCommitRequestPartition struct {
+	// The partition index.
+	PartitionIndex int32
+	// The message offset to be committed.
+	CommittedOffset int64
+	// The leader epoch of this partition.
+	CommittedLeaderEpoch int32
+	// The timestamp of the commit.
+	CommitTimestamp int64
+	// Any associated metadata the client wants to keep.
+	CommittedMetadata *string
+	// TaggedFields are the tagged fields of flexible versions unknown to this struct.
+	TaggedFields TaggedFields
 }
 
-type OffsetCommitTopicRequest struct {
-	Topic      string
-	Partitions []OffsetCommitPartitionRequest
+func (r *OffsetCommitRequest) Encode(e PacketEncoder) error {
+	return r.encode(e, r.APIVersion)
 }
 
-type OffsetCommitPartitionRequest struct {
-	Partition int32
-	Offset    int64
-	Timestamp int64
-	Metadata  *string
+func (r *OffsetCommitRequest) Decode(d PacketDecoder, version int16) error {
+	r.APIVersion = version
+	return r.decode(d, version)
+}
+
+func (r *OffsetCommitRequest) Key() int16 {
+	return OffsetCommitKey
+}
+
+func (r *OffsetCommitRequest) Version() int16 {
+	return r.APIVersion
 }
 
-func (r *OffsetCommitRequest) Encode(e PacketEncoder) (err error) {
-	if err = e.PutString(r.GroupID); err != nil {
+func (r *OffsetCommitRequest) encode(e PacketEncoder, version int16) (err error) {
+	flexible := version >= 8
+	if flexible {
+		err = e.PutCompactString(r.GroupID)
+	} else {
+		err = e.PutString(r.GroupID)
+	}
+	if err != nil {
 		return err
 	}
-	if err := e.PutArrayLength(len(r.Topics)); err != nil {
+	if version >= 1 {
+		e.PutInt32(r.GenerationID)
+	}
+	if version >= 1 {
+		if flexible {
+			err = e.PutCompactString(r.MemberID)
+		} else {
+			err = e.PutString(r.MemberID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if version >= 7 {
+		if flexible {
+			err = e.PutCompactNullableString(r.GroupInstanceID)
+		} else {
+			err = e.PutNullableString(r.GroupInstanceID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if version >= 2 && version <= 4 {
+		e.PutInt64(int64(r.RetentionTime / time.Millisecond))
+	}
+	if flexible {
+		err = e.PutCompactArrayLength(len(r.Topics))
+	} else {
+		err = e.PutArrayLength(len(r.Topics))
+	}
+	if err != nil {
 		return err
 	}
-	for _, t := range r.Topics {
-		if err := e.PutArrayLength(len(t.Partitions)); err != nil {
+	for _, v := range r.Topics {
+		if err = v.encode(e, version); err != nil {
 			return err
 		}
-		for _, p := range t.Partitions {
-			e.PutInt32(p.Partition)
-			e.PutInt64(p.Offset)
-			if err := e.PutNullableString(p.Metadata); err != nil {
-				return err
-			}
+	}
+	if flexible {
+		if err = e.PutTaggedFields(r.TaggedFields); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
-func (r *OffsetCommitRequest) Decode(d PacketDecoder, version int16) (err error) {
-	r.APIVersion = version
-
-	if r.GroupID, err = d.String(); err != nil {
+func (r *OffsetCommitRequest) decode(d PacketDecoder, version int16) (err error) {
+	flexible := version >= 8
+	var n int
+	if flexible {
+		r.GroupID, err = d.CompactString()
+	} else {
+		r.GroupID, err = d.String()
+	}
+	if err != nil {
 		return err
 	}
 	if version >= 1 {
 		if r.GenerationID, err = d.Int32(); err != nil {
 			return err
 		}
-		if r.MemberID, err = d.String(); err != nil {
+	} else {
+		r.GenerationID = -1
+	}
+	if version >= 1 {
+		if flexible {
+			r.MemberID, err = d.CompactString()
+		} else {
+			r.MemberID, err = d.String()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if version >= 7 {
+		if flexible {
+			r.GroupInstanceID, err = d.CompactNullableString()
+		} else {
+			r.GroupInstanceID, err = d.NullableString()
+		}
+		if err != nil {
 			return err
 		}
 	}
-	if version >= 2 {
-		if r.RetentionTime, err = d.Int64(); err != nil {
+	if version >= 2 && version <= 4 {
+		if ms, err := d.Int64(); err != nil {
 			return err
+		} else {
+			r.RetentionTime = time.Duration(ms) * time.Millisecond
 		}
+	} else {
+		r.RetentionTime = -1 * time.Millisecond
+	}
+	if flexible {
+		n, err = d.CompactArrayLength()
+	} else {
+		n, err = d.ArrayLength()
 	}
-	topicCount, err := d.ArrayLength()
 	if err != nil {
 		return err
 	}
-	r.Topics = make([]OffsetCommitTopicRequest, topicCount)
-	for _, t := range r.Topics {
-		partitionCount, err := d.ArrayLength()
-		if err != nil {
-			return err
-		}
-		t.Partitions = make([]OffsetCommitPartitionRequest, partitionCount)
-		for _, p := range t.Partitions {
-			if p.Partition, err = d.Int32(); err != nil {
+	if n > 0 {
+		r.Topics = make([]*OffsetCommitRequestTopic, n)
+		for i := range r.Topics {
+			r.Topics[i] = new(OffsetCommitRequestTopic)
+			if err = r.Topics[i].decode(d, version); err != nil {
 				return err
 			}
-			if p.Offset, err = d.Int64(); err != nil {
-				return err
-			}
-			if version >= 1 {
-				if p.Timestamp, err = d.Int64(); err != nil {
-					return err
-				}
-			}
-			if p.Metadata, err = d.NullableString(); err != nil {
+		}
+	}
+	if flexible {
+		if r.TaggedFields, err = d.TaggedFields(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *OffsetCommitRequestTopic) encode(e PacketEncoder, version int16) (err error) {
+	flexible := version >= 8
+	if flexible {
+		err = e.PutCompactString(r.Name)
+	} else {
+		err = e.PutString(r.Name)
+	}
+	if err != nil {
+		return err
+	}
+	if flexible {
+		err = e.PutCompactArrayLength(len(r.Partitions))
+	} else {
+		err = e.PutArrayLength(len(r.Partitions))
+	}
+	if err != nil {
+		return err
+	}
+	for _, v := range r.Partitions {
+		if err = v.encode(e, version); err != nil {
+			return err
+		}
+	}
+	if flexible {
+		if err = e.PutTaggedFields(r.TaggedFields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *OffsetCommitRequestTopic) decode(d PacketDecoder, version int16) (err error) {
+	flexible := version >= 8
+	var n int
+	if flexible {
+		r.Name, err = d.CompactString()
+	} else {
+		r.Name, err = d.String()
+	}
+	if err != nil {
+		return err
+	}
+	if flexible {
+		n, err = d.CompactArrayLength()
+	} else {
+		n, err = d.ArrayLength()
+	}
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		r.Partitions = make([]*OffsetCommitRequestPartition, n)
+		for i := range r.Partitions {
+			r.Partitions[i] = new(OffsetCommitRequestPartition)
+			if err = r.Partitions[i].decode(d, version); err != nil {
 				return err
 			}
 		}
 	}
+	if flexible {
+		if r.TaggedFields, err = d.TaggedFields(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (r *OffsetCommitRequest) Version() int16 {
-	return r.APIVersion
+func (r *OffsetCommitRequestPartition) encode(e PacketEncoder, version int16) (err error) {
+	flexible := version >= 8
+	e.PutInt32(r.PartitionIndex)
+	e.PutInt64(r.CommittedOffset)
+	if version >= 6 {
+		e.PutInt32(r.CommittedLeaderEpoch)
+	}
+	if version >= 1 && version <= 1 {
+		e.PutInt64(r.CommitTimestamp)
+	}
+	if flexible {
+		err = e.PutCompactNullableString(r.CommittedMetadata)
+	} else {
+		err = e.PutNullableString(r.CommittedMetadata)
+	}
+	if err != nil {
+		return err
+	}
+	if flexible {
+		if err = e.PutTaggedFields(r.TaggedFields); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (r *OffsetCommitRequest) Key() int16 {
-	return OffsetCommitKey
-
+func (r *OffsetCommitRequestPartition) decode(d PacketDecoder, version int16) (err error) {
+	flexible := version >= 8
+	if r.PartitionIndex, err = d.Int32(); err != nil {
+		return err
+	}
+	if r.CommittedOffset, err = d.Int64(); err != nil {
+		return err
+	}
+	if version >= 6 {
+		if r.CommittedLeaderEpoch, err = d.Int32(); err != nil {
+			return err
+		}
+	} else {
+		r.CommittedLeaderEpoch = -1
+	}
+	if version >= 1 && version <= 1 {
+		if r.CommitTimestamp, err = d.Int64(); err != nil {
+			return err
+		}
+	} else {
+		r.CommitTimestamp = -1
+	}
+	if flexible {
+		r.CommittedMetadata, err = d.CompactNullableString()
+	} else {
+		r.CommittedMetadata, err = d.NullableString()
+	}
+	if err != nil {
+		return err
+	}
+	if flexible {
+		if r.TaggedFields, err = d.TaggedFields(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,64 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOffsetCommitRequest(t *testing.T) {
+	req := require.New(t)
+	metadata := "metadata"
+	// fields missing from a version are decoded with their defaults.
+	for _, exp := range []*OffsetCommitRequest{{
+		APIVersion:    0,
+		GroupID:       "group",
+		GenerationID:  -1,
+		RetentionTime: -time.Millisecond,
+		Topics: []*OffsetCommitRequestTopic{{
+			Name:       "topic",
+			Partitions: []*OffsetCommitRequestPartition{{PartitionIndex: 1, CommittedOffset: 10, CommittedLeaderEpoch: -1, CommitTimestamp: -1, CommittedMetadata: &metadata}},
+		}},
+	}, {
+		APIVersion:    1,
+		GroupID:       "group",
+		GenerationID:  2,
+		MemberID:      "member",
+		RetentionTime: -time.Millisecond,
+		Topics: []*OffsetCommitRequestTopic{{
+			Name:       "topic",
+			Partitions: []*OffsetCommitRequestPartition{{PartitionIndex: 1, CommittedOffset: 10, CommittedLeaderEpoch: -1, CommitTimestamp: 1000}},
+		}},
+	}, {
+		APIVersion:    2,
+		GroupID:       "group",
+		GenerationID:  2,
+		MemberID:      "member",
+		RetentionTime: time.Hour,
+		Topics: []*OffsetCommitRequestTopic{{
+			Name: "topic",
+			Partitions: []*OffsetCommitRequestPartition{
+				{PartitionIndex: 0, CommittedOffset: 5, CommittedLeaderEpoch: -1, CommitTimestamp: -1},
+				{PartitionIndex: 1, CommittedOffset: 10, CommittedLeaderEpoch: -1, CommitTimestamp: -1, CommittedMetadata: &metadata},
+			},
+		}},
+	}, {
+		APIVersion:    6,
+		GroupID:       "group",
+		GenerationID:  2,
+		MemberID:      "member",
+		RetentionTime: -time.Millisecond,
+		Topics: []*OffsetCommitRequestTopic{{
+			Name:       "topic",
+			Partitions: []*OffsetCommitRequestPartition{{PartitionIndex: 1, CommittedOffset: 10, CommittedLeaderEpoch: 3, CommitTimestamp: -1}},
+		}},
+	}} {
+		b, err := Encode(exp)
+		req.NoError(err)
+		var act OffsetCommitRequest
+		err = Decode(b, &act, exp.Version())
+		req.NoError(err)
+		req.Equal(exp, &act)
+	}
+}
@@ -1,82 +1,210 @@
+// Code generated by protocol/gen from schemas/OffsetCommitResponse.json. DO NOT EDIT.
+
 package protocol
 
 import "time"
 
+// OffsetCommitResponse is the OffsetCommit API's response, versions 0-8.
 type OffsetCommitResponse struct {
 	APIVersion int16
 
+	// The duration in milliseconds for which the request was throttled due to a quota violation, or zero if the request did not violate any quota.
 	ThrottleTime time.Duration
-	Responses    []OffsetCommitTopicResponse
+	// The responses for each topic.
+	Topics []*OffsetCommitResponseTopic
+	// TaggedFields are the tagged fields of flexible versions unknown to this struct.
+	TaggedFields TaggedFields
 }
 
-type OffsetCommitTopicResponse struct {
-	Topic              string
-	PartitionResponses []OffsetCommitPartitionResponse
+// OffsetCommitResponseTopic is an element of OffsetCommitResponse's Topics.
+type OffsetCommitResponseTopic struct {
+	// The topic name.
+	Name string
+	// The responses for each partition in the topic.
+	Partitions []*OffsetCommitResponsePartition
+	// TaggedFields are the tagged fields of flexible versions unknown to this struct.
+	TaggedFields TaggedFields
 }
 
-type OffsetCommitPartitionResponse struct {
-	Partition int32
+// OffsetCommitResponsePartition is an element of OffsetCommitResponseTopic's Partitions.
+type OffsetCommitResponsePartition struct {
+	// The partition index.
+	PartitionIndex int32
+	// The error code, or 0 if there was no error.
 	ErrorCode int16
+	// TaggedFields are the tagged fields of flexible versions unknown to this struct.
+	TaggedFields TaggedFields
+}
+
+func (r *OffsetCommitResponse) Encode(e PacketEncoder) error {
+	return r.encode(e, r.APIVersion)
 }
 
-func (r *OffsetCommitResponse) Encode(e PacketEncoder) (err error) {
-	if r.APIVersion >= 3 {
+func (r *OffsetCommitResponse) Decode(d PacketDecoder, version int16) error {
+	r.APIVersion = version
+	return r.decode(d, version)
+}
+
+func (r *OffsetCommitResponse) Key() int16 {
+	return OffsetCommitKey
+}
+
+func (r *OffsetCommitResponse) Version() int16 {
+	return r.APIVersion
+}
+
+func (r *OffsetCommitResponse) encode(e PacketEncoder, version int16) (err error) {
+	flexible := version >= 8
+	if version >= 3 {
 		e.PutInt32(int32(r.ThrottleTime / time.Millisecond))
 	}
-	if err := e.PutArrayLength(len(r.Responses)); err != nil {
+	if flexible {
+		err = e.PutCompactArrayLength(len(r.Topics))
+	} else {
+		err = e.PutArrayLength(len(r.Topics))
+	}
+	if err != nil {
 		return err
 	}
-	for _, t := range r.Responses {
-		if err := e.PutString(t.Topic); err != nil {
+	for _, v := range r.Topics {
+		if err = v.encode(e, version); err != nil {
 			return err
 		}
-		if err := e.PutArrayLength(len(t.PartitionResponses)); err != nil {
+	}
+	if flexible {
+		if err = e.PutTaggedFields(r.TaggedFields); err != nil {
 			return err
 		}
-		for _, p := range t.PartitionResponses {
-			e.PutInt32(p.Partition)
-			e.PutInt16(p.ErrorCode)
-		}
 	}
 	return nil
 }
 
-func (r *OffsetCommitResponse) Decode(d PacketDecoder, version int16) (err error) {
-	r.APIVersion = version
-
+func (r *OffsetCommitResponse) decode(d PacketDecoder, version int16) (err error) {
+	flexible := version >= 8
+	var n int
 	if version >= 3 {
-		throttle, err := d.Int32()
-		if err != nil {
+		if ms, err := d.Int32(); err != nil {
 			return err
+		} else {
+			r.ThrottleTime = time.Duration(ms) * time.Millisecond
 		}
-		r.ThrottleTime = time.Duration(throttle) * time.Millisecond
 	}
+	if flexible {
+		n, err = d.CompactArrayLength()
+	} else {
+		n, err = d.ArrayLength()
+	}
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		r.Topics = make([]*OffsetCommitResponseTopic, n)
+		for i := range r.Topics {
+			r.Topics[i] = new(OffsetCommitResponseTopic)
+			if err = r.Topics[i].decode(d, version); err != nil {
+				return err
+			}
+		}
+	}
+	if flexible {
+		if r.TaggedFields, err = d.TaggedFields(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	topicCount, err := d.ArrayLength()
+func (r *OffsetCommitResponseTopic) encode(e PacketEncoder, version int16) (err error) {
+	flexible := version >= 8
+	if flexible {
+		err = e.PutCompactString(r.Name)
+	} else {
+		err = e.PutString(r.Name)
+	}
+	if err != nil {
+		return err
+	}
+	if flexible {
+		err = e.PutCompactArrayLength(len(r.Partitions))
+	} else {
+		err = e.PutArrayLength(len(r.Partitions))
+	}
 	if err != nil {
 		return err
 	}
-	r.Responses = make([]OffsetCommitTopicResponse, topicCount)
-	for _, t := range r.Responses {
-		if t.Topic, err = d.String(); err != nil {
+	for _, v := range r.Partitions {
+		if err = v.encode(e, version); err != nil {
 			return err
 		}
-		partitionCount, err := d.ArrayLength()
-		if err != nil {
+	}
+	if flexible {
+		if err = e.PutTaggedFields(r.TaggedFields); err != nil {
 			return err
 		}
-		t.PartitionResponses = make([]OffsetCommitPartitionResponse, partitionCount)
-		for _, p := range t.PartitionResponses {
-			p.Partition, err = d.Int32()
-			if err != nil {
-				return err
-			}
-			p.ErrorCode, err = d.Int16()
-			if err != nil {
+	}
+	return nil
+}
+
+func (r *OffsetCommitResponseTopic) decode(d PacketDecoder, version int16) (err error) {
+	flexible := version >= 8
+	var n int
+	if flexible {
+		r.Name, err = d.CompactString()
+	} else {
+		r.Name, err = d.String()
+	}
+	if err != nil {
+		return err
+	}
+	if flexible {
+		n, err = d.CompactArrayLength()
+	} else {
+		n, err = d.ArrayLength()
+	}
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		r.Partitions = make([]*OffsetCommitResponsePartition, n)
+		for i := range r.Partitions {
+			r.Partitions[i] = new(OffsetCommitResponsePartition)
+			if err = r.Partitions[i].decode(d, version); err != nil {
 				return err
 			}
 		}
+	}
+	if flexible {
+		if r.TaggedFields, err = d.TaggedFields(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
+func (r *OffsetCommitResponsePartition) encode(e PacketEncoder, version int16) (err error) {
+	flexible := version >= 8
+	e.PutInt32(r.PartitionIndex)
+	e.PutInt16(r.ErrorCode)
+	if flexible {
+		if err = e.PutTaggedFields(r.TaggedFields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *OffsetCommitResponsePartition) decode(d PacketDecoder, version int16) (err error) {
+	flexible := version >= 8
+	if r.PartitionIndex, err = d.Int32(); err != nil {
+		return err
+	}
+	if r.ErrorCode, err = d.Int16(); err != nil {
+		return err
+	}
+	if flexible {
+		if r.TaggedFields, err = d.TaggedFields(); err != nil {
+			return err
+		}
 	}
 	return nil
 }
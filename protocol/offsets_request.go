@@ -1,9 +1,12 @@
 package protocol
 
 type OffsetsPartition struct {
-	Partition     int32
-	Timestamp     int64 // -1 to receive latest offset, -2 to receive earliest offset
-	MaxNumOffsets int32
+	Partition int32
+	// CurrentLeaderEpoch is the leader epoch of the client's metadata, sent from v4. -1 skips
+	// checking it.
+	CurrentLeaderEpoch int32
+	Timestamp          int64 // -1 to receive latest offset, -2 to receive earliest offset
+	MaxNumOffsets      int32
 }
 
 type OffsetsTopic struct {
@@ -39,6 +42,9 @@ func (r *OffsetsRequest) Encode(e PacketEncoder) (err error) {
 		}
 		for _, p := range t.Partitions {
 			e.PutInt32(p.Partition)
+			if r.APIVersion >= 4 {
+				e.PutInt32(p.CurrentLeaderEpoch)
+			}
 			e.PutInt64(p.Timestamp)
 
 			if r.APIVersion == 0 {
@@ -84,6 +90,12 @@ func (r *OffsetsRequest) Decode(d PacketDecoder, version int16) (err error) {
 			if err != nil {
 				return err
 			}
+			if version >= 4 {
+				p.CurrentLeaderEpoch, err = d.Int32()
+				if err != nil {
+					return err
+				}
+			}
 			p.Timestamp, err = d.Int64()
 			if err != nil {
 				return err
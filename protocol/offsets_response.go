@@ -8,6 +8,8 @@ type PartitionResponse struct {
 	Timestamp time.Time
 	Offsets   []int64
 	Offset    int64
+	// LeaderEpoch is the partition's leader epoch, sent from v4.
+	LeaderEpoch int32
 }
 
 type OffsetResponse struct {
@@ -48,12 +50,16 @@ func (r *OffsetsResponse) Encode(e PacketEncoder) (err error) {
 				e.PutInt64(p.Timestamp.UnixNano() / int64(time.Millisecond))
 				e.PutInt64(p.Offset)
 			}
+			if r.APIVersion >= 4 {
+				e.PutInt32(p.LeaderEpoch)
+			}
 		}
 	}
 	return nil
 }
 
 func (r *OffsetsResponse) Decode(d PacketDecoder, version int16) (err error) {
+	r.APIVersion = version
 	if version >= 2 {
 		throttle, err := d.Int32()
 		if err != nil {
@@ -106,6 +112,12 @@ func (r *OffsetsResponse) Decode(d PacketDecoder, version int16) (err error) {
 					return err
 				}
 			}
+			if version >= 4 {
+				p.LeaderEpoch, err = d.Int32()
+				if err != nil {
+					return err
+				}
+			}
 
 			ps[j] = p
 		}
@@ -0,0 +1,59 @@
+package protocol
+
+// PartitionStatsRequest is a jocko extension API asking a broker for the offsets and segment
+// counts of the partitions it leads in one call, so lag and monitoring tools don't need a list
+// offsets request per partition. With no topics it's every partition the broker leads.
+type PartitionStatsRequest struct {
+	APIVersion int16
+	Topics     []*PartitionStatsTopic
+}
+
+// PartitionStatsTopic is a topic's partitions to get the stats of, all of the ones the broker
+// leads if there are none.
+type PartitionStatsTopic struct {
+	Topic      string
+	Partitions []int32
+}
+
+func (r *PartitionStatsRequest) Encode(e PacketEncoder) (err error) {
+	if err = e.PutArrayLength(len(r.Topics)); err != nil {
+		return err
+	}
+	for _, t := range r.Topics {
+		if err = e.PutString(t.Topic); err != nil {
+			return err
+		}
+		if err = e.PutInt32Array(t.Partitions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *PartitionStatsRequest) Decode(d PacketDecoder, version int16) (err error) {
+	r.APIVersion = version
+	n, err := d.ArrayLength()
+	if err != nil || n <= 0 {
+		return err
+	}
+	r.Topics = make([]*PartitionStatsTopic, n)
+	for i := range r.Topics {
+		t := new(PartitionStatsTopic)
+		if t.Topic, err = d.String(); err != nil {
+			return err
+		}
+		if t.Partitions, err = d.Int32Array(); err != nil {
+			return err
+		}
+		r.Topics[i] = t
+	}
+	return nil
+}
+
+func (r *PartitionStatsRequest) Key() int16 {
+	return PartitionStatsKey
+}
+
+func (r *PartitionStatsRequest) Version() int16 {
+	return r.APIVersion
+}
@@ -0,0 +1,38 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPartitionStatsRequest(t *testing.T) {
+	req := require.New(t)
+	exp := &PartitionStatsRequest{Topics: []*PartitionStatsTopic{
+		{Topic: "a", Partitions: []int32{0, 2}},
+		{Topic: "b"},
+	}}
+	b, err := Encode(exp)
+	req.NoError(err)
+	var act PartitionStatsRequest
+	err = Decode(b, &act, exp.Version())
+	req.NoError(err)
+	req.Equal(exp, &act)
+}
+
+func TestPartitionStatsResponse(t *testing.T) {
+	req := require.New(t)
+	exp := &PartitionStatsResponse{Topics: []*PartitionStatsTopicResponse{{
+		Topic: "a",
+		Partitions: []*PartitionStats{
+			{Partition: 0, LogStartOffset: 10, LogEndOffset: 120, HighWatermark: 119, LastStableOffset: 119, Segments: 3},
+			{Partition: 2, ErrorCode: ErrNotLeaderForPartition.Code()},
+		},
+	}}}
+	b, err := Encode(exp)
+	req.NoError(err)
+	var act PartitionStatsResponse
+	err = Decode(b, &act, exp.Version())
+	req.NoError(err)
+	req.Equal(exp, &act)
+}
@@ -0,0 +1,116 @@
+package protocol
+
+// PartitionStats is a partition's offsets and segments on its leader.
+type PartitionStats struct {
+	Partition int32
+	// ErrorCode is set if the broker doesn't lead the partition or can't read its log, in which
+	// case the rest are zero.
+	ErrorCode int16
+	// LogStartOffset is the first offset in the leader's log and LogEndOffset the offset the next
+	// record's appended at.
+	LogStartOffset int64
+	LogEndOffset   int64
+	// HighWatermark is the last offset consumers can fetch, like fetch responses report it.
+	// LastStableOffset is the same since there are no transactions to wait on.
+	HighWatermark    int64
+	LastStableOffset int64
+	// Segments is the number of segments in the leader's log.
+	Segments int32
+}
+
+type PartitionStatsTopicResponse struct {
+	Topic      string
+	Partitions []*PartitionStats
+}
+
+type PartitionStatsResponse struct {
+	APIVersion int16
+
+	Topics []*PartitionStatsTopicResponse
+}
+
+func (r *PartitionStatsResponse) Encode(e PacketEncoder) (err error) {
+	if err = e.PutArrayLength(len(r.Topics)); err != nil {
+		return err
+	}
+	for _, t := range r.Topics {
+		if err = e.PutString(t.Topic); err != nil {
+			return err
+		}
+		if err = e.PutArrayLength(len(t.Partitions)); err != nil {
+			return err
+		}
+		for _, p := range t.Partitions {
+			e.PutInt32(p.Partition)
+			e.PutInt16(p.ErrorCode)
+			e.PutInt64(p.LogStartOffset)
+			e.PutInt64(p.LogEndOffset)
+			e.PutInt64(p.HighWatermark)
+			e.PutInt64(p.LastStableOffset)
+			e.PutInt32(p.Segments)
+		}
+	}
+	return nil
+}
+
+func (r *PartitionStatsResponse) Decode(d PacketDecoder, version int16) (err error) {
+	r.APIVersion = version
+	n, err := d.ArrayLength()
+	if err != nil || n <= 0 {
+		return err
+	}
+	r.Topics = make([]*PartitionStatsTopicResponse, n)
+	for i := range r.Topics {
+		t := new(PartitionStatsTopicResponse)
+		if t.Topic, err = d.String(); err != nil {
+			return err
+		}
+		if t.Partitions, err = decodePartitionStats(d); err != nil {
+			return err
+		}
+		r.Topics[i] = t
+	}
+	return nil
+}
+
+func decodePartitionStats(d PacketDecoder) ([]*PartitionStats, error) {
+	n, err := d.ArrayLength()
+	if err != nil || n <= 0 {
+		return nil, err
+	}
+	partitions := make([]*PartitionStats, n)
+	for i := range partitions {
+		p := new(PartitionStats)
+		if p.Partition, err = d.Int32(); err != nil {
+			return nil, err
+		}
+		if p.ErrorCode, err = d.Int16(); err != nil {
+			return nil, err
+		}
+		if p.LogStartOffset, err = d.Int64(); err != nil {
+			return nil, err
+		}
+		if p.LogEndOffset, err = d.Int64(); err != nil {
+			return nil, err
+		}
+		if p.HighWatermark, err = d.Int64(); err != nil {
+			return nil, err
+		}
+		if p.LastStableOffset, err = d.Int64(); err != nil {
+			return nil, err
+		}
+		if p.Segments, err = d.Int32(); err != nil {
+			return nil, err
+		}
+		partitions[i] = p
+	}
+	return partitions, nil
+}
+
+func (r *PartitionStatsResponse) Key() int16 {
+	return PartitionStatsKey
+}
+
+func (r *PartitionStatsResponse) Version() int16 {
+	return r.APIVersion
+}
@@ -38,7 +38,7 @@ func (r *ProduceResponse) Encode(e PacketEncoder) (err error) {
 			e.PutInt16(p.ErrorCode)
 			if r.APIVersion >= 2 {
 				e.PutInt64(p.BaseOffset)
-				e.PutInt64(int64(p.LogAppendTime.UnixNano() / int64(time.Millisecond)))
+				e.PutInt64(timestampMillis(p.LogAppendTime))
 			}
 			if r.APIVersion >= 5 {
 				e.PutInt64(p.LogStartOffset)
@@ -95,7 +95,7 @@ func (r *ProduceResponse) Decode(d PacketDecoder, version int16) (err error) {
 				if err != nil {
 					return err
 				}
-				p.LogAppendTime = time.Unix(millis/1000, (millis%1000)*int64(time.Millisecond))
+				p.LogAppendTime = millisTimestamp(millis)
 			}
 			if r.APIVersion >= 5 {
 				p.LogStartOffset, err = d.Int64()
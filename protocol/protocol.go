@@ -1,3 +1,5 @@
+//go:generate go run ./gen -out . schemas
+
 package protocol
 
 import (
@@ -0,0 +1,44 @@
+package protocol
+
+// ReassignLostBrokerRequest is a jocko extension API reassigning the replicas of a broker that's
+// permanently lost, e.g. to hardware failure, to the other brokers. Unlike a usual reassignment
+// the lost replicas are dropped right away rather than once the new ones catch up, and partitions
+// whose only in-sync replica was lost get a leader that may be missing records.
+type ReassignLostBrokerRequest struct {
+	APIVersion int16
+
+	BrokerID int32
+	// AcceptDataLoss must be set to reassign the replicas, acknowledging the records only the
+	// lost broker had are lost.
+	AcceptDataLoss bool
+	// ValidateOnly plans the reassignment without making it.
+	ValidateOnly bool
+}
+
+func (r *ReassignLostBrokerRequest) Encode(e PacketEncoder) (err error) {
+	e.PutInt32(r.BrokerID)
+	e.PutBool(r.AcceptDataLoss)
+	e.PutBool(r.ValidateOnly)
+	return nil
+}
+
+func (r *ReassignLostBrokerRequest) Decode(d PacketDecoder, version int16) (err error) {
+	r.APIVersion = version
+
+	if r.BrokerID, err = d.Int32(); err != nil {
+		return err
+	}
+	if r.AcceptDataLoss, err = d.Bool(); err != nil {
+		return err
+	}
+	r.ValidateOnly, err = d.Bool()
+	return err
+}
+
+func (r *ReassignLostBrokerRequest) Key() int16 {
+	return ReassignLostBrokerKey
+}
+
+func (r *ReassignLostBrokerRequest) Version() int16 {
+	return r.APIVersion
+}
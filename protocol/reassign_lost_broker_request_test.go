@@ -0,0 +1,43 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReassignLostBrokerRequest(t *testing.T) {
+	req := require.New(t)
+	exp := &ReassignLostBrokerRequest{BrokerID: 3, AcceptDataLoss: true, ValidateOnly: true}
+	b, err := Encode(exp)
+	req.NoError(err)
+	var act ReassignLostBrokerRequest
+	err = Decode(b, &act, exp.Version())
+	req.NoError(err)
+	req.Equal(exp, &act)
+}
+
+func TestReassignLostBrokerResponse(t *testing.T) {
+	req := require.New(t)
+	exp := &ReassignLostBrokerResponse{
+		Partitions: []*LostBrokerPartition{
+			{Topic: "t", Partition: 0, Leader: 1, Replicas: []int32{1, 2}},
+			{Topic: "t", Partition: 1, Leader: 2, Replicas: []int32{2, 4}, Unclean: true},
+		},
+	}
+	b, err := Encode(exp)
+	req.NoError(err)
+	var act ReassignLostBrokerResponse
+	err = Decode(b, &act, exp.Version())
+	req.NoError(err)
+	req.Equal(exp, &act)
+
+	msg := "broker 3 is alive"
+	exp = &ReassignLostBrokerResponse{ErrorCode: ErrInvalidRequest.Code(), ErrorMessage: &msg}
+	b, err = Encode(exp)
+	req.NoError(err)
+	act = ReassignLostBrokerResponse{}
+	err = Decode(b, &act, exp.Version())
+	req.NoError(err)
+	req.Equal(exp, &act)
+}
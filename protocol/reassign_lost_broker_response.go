@@ -0,0 +1,88 @@
+package protocol
+
+type ReassignLostBrokerResponse struct {
+	APIVersion int16
+
+	ErrorCode    int16
+	ErrorMessage *string
+	// Partitions are the partitions the lost broker had replicas of, with their reassignment.
+	Partitions []*LostBrokerPartition
+}
+
+// LostBrokerPartition is a partition's reassignment off a lost broker.
+type LostBrokerPartition struct {
+	Topic     string
+	Partition int32
+	Leader    int32
+	Replicas  []int32
+	// Unclean is whether the partition's new leader wasn't in sync, so records may be lost.
+	Unclean bool
+}
+
+func (r *ReassignLostBrokerResponse) Encode(e PacketEncoder) (err error) {
+	e.PutInt16(r.ErrorCode)
+	if err = e.PutNullableString(r.ErrorMessage); err != nil {
+		return err
+	}
+	if err = e.PutArrayLength(len(r.Partitions)); err != nil {
+		return err
+	}
+	for _, p := range r.Partitions {
+		if err = e.PutString(p.Topic); err != nil {
+			return err
+		}
+		e.PutInt32(p.Partition)
+		e.PutInt32(p.Leader)
+		if err = e.PutInt32Array(p.Replicas); err != nil {
+			return err
+		}
+		e.PutBool(p.Unclean)
+	}
+	return nil
+}
+
+func (r *ReassignLostBrokerResponse) Decode(d PacketDecoder, version int16) (err error) {
+	r.APIVersion = version
+
+	if r.ErrorCode, err = d.Int16(); err != nil {
+		return err
+	}
+	if r.ErrorMessage, err = d.NullableString(); err != nil {
+		return err
+	}
+	n, err := d.ArrayLength()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		r.Partitions = make([]*LostBrokerPartition, n)
+	}
+	for i := range r.Partitions {
+		p := new(LostBrokerPartition)
+		if p.Topic, err = d.String(); err != nil {
+			return err
+		}
+		if p.Partition, err = d.Int32(); err != nil {
+			return err
+		}
+		if p.Leader, err = d.Int32(); err != nil {
+			return err
+		}
+		if p.Replicas, err = d.Int32Array(); err != nil {
+			return err
+		}
+		if p.Unclean, err = d.Bool(); err != nil {
+			return err
+		}
+		r.Partitions[i] = p
+	}
+	return nil
+}
+
+func (r *ReassignLostBrokerResponse) Key() int16 {
+	return ReassignLostBrokerKey
+}
+
+func (r *ReassignLostBrokerResponse) Version() int16 {
+	return r.APIVersion
+}
@@ -0,0 +1,420 @@
+package protocol
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// RecordBatchMagic is the magic byte of the v2 record batch format modern clients produce.
+const RecordBatchMagic = 2
+
+const (
+	// a record batch's magic byte is at the same position as a legacy message set's first
+	// message's, which is how the formats are told apart.
+	magicPos             = 16
+	lastOffsetDeltaPos   = 23
+	producerIDPos        = 43
+	producerEpochPos     = 51
+	firstSequencePos     = 53
+	recordsCountPos      = 57
+	recordBatchHeaderLen = 61
+
+	transactionalMask = 0x10
+	controlMask       = 0x20
+)
+
+// minRecordLen is the smallest encoded record: its length, attributes, timestamp and offset
+// deltas, key and value lengths, and headers count, a byte each.
+const minRecordLen = 7
+
+// RecordBatch is a batch of records in the v2, magic 2, format. Its records' offsets and
+// timestamps are deltas from the batch's first offset and timestamp, and its CRC is a CRC-32C of
+// the batch from its attributes on, so the first offset can be assigned without recomputing it.
+type RecordBatch struct {
+	FirstOffset          int64
+	PartitionLeaderEpoch int32
+	Attributes           int16
+	LastOffsetDelta      int32
+	FirstTimestamp       time.Time
+	MaxTimestamp         time.Time
+	ProducerID           int64
+	ProducerEpoch        int16
+	FirstSequence        int32
+	Records              []*Record
+}
+
+// Codec returns the codec the batch's records are compressed with.
+func (b *RecordBatch) Codec() CompressionCodec {
+	return CompressionCodec(b.Attributes & compressionCodecMask)
+}
+
+// Transactional returns whether the batch was produced in a transaction.
+func (b *RecordBatch) Transactional() bool {
+	return b.Attributes&transactionalMask != 0
+}
+
+// Control returns whether the batch holds a transaction's commit or abort marker rather than
+// records.
+func (b *RecordBatch) Control() bool {
+	return b.Attributes&controlMask != 0
+}
+
+func (b *RecordBatch) Encode(e PacketEncoder) error {
+	e.PutInt64(b.FirstOffset)
+	e.Push(&SizeField{})
+	e.PutInt32(b.PartitionLeaderEpoch)
+	e.PutInt8(RecordBatchMagic)
+	e.Push(&CRC32CField{})
+	e.PutInt16(b.Attributes)
+	e.PutInt32(b.LastOffsetDelta)
+	e.PutInt64(timestampMillis(b.FirstTimestamp))
+	e.PutInt64(timestampMillis(b.MaxTimestamp))
+	e.PutInt64(b.ProducerID)
+	e.PutInt16(b.ProducerEpoch)
+	e.PutInt32(b.FirstSequence)
+	e.PutInt32(int32(len(b.Records)))
+	if b.Codec() == CompressionNone {
+		for _, r := range b.Records {
+			if err := r.Encode(e); err != nil {
+				return err
+			}
+		}
+	} else {
+		raw, err := Encode(records(b.Records))
+		if err != nil {
+			return err
+		}
+		compressed, err := Compress(b.Codec(), raw)
+		if err != nil {
+			return err
+		}
+		if err := e.PutRawBytes(compressed); err != nil {
+			return err
+		}
+	}
+	e.Pop()
+	e.Pop()
+	return nil
+}
+
+func (b *RecordBatch) Decode(d PacketDecoder) error {
+	var err error
+	if b.FirstOffset, err = d.Int64(); err != nil {
+		return err
+	}
+	length, err := d.Int32()
+	if err != nil {
+		return err
+	}
+	batch, err := d.RawBytes(int(length))
+	if err != nil {
+		return err
+	}
+	// the batch's all there, so running out of it means it's corrupt rather than truncated.
+	if err = b.decode(NewDecoder(batch)); err == ErrInsufficientData {
+		return ErrCorruptMessage.WithErr(err)
+	}
+	return err
+}
+
+func (b *RecordBatch) decode(d PacketDecoder) error {
+	var err error
+	if b.PartitionLeaderEpoch, err = d.Int32(); err != nil {
+		return err
+	}
+	magic, err := d.Int8()
+	if err != nil {
+		return err
+	}
+	if magic != RecordBatchMagic {
+		return fmt.Errorf("unsupported record batch magic: %d", magic)
+	}
+	if err = d.Push(&CRC32CField{}); err != nil {
+		return err
+	}
+	if b.Attributes, err = d.Int16(); err != nil {
+		return err
+	}
+	if b.LastOffsetDelta, err = d.Int32(); err != nil {
+		return err
+	}
+	first, err := d.Int64()
+	if err != nil {
+		return err
+	}
+	b.FirstTimestamp = millisTimestamp(first)
+	max, err := d.Int64()
+	if err != nil {
+		return err
+	}
+	b.MaxTimestamp = millisTimestamp(max)
+	if b.ProducerID, err = d.Int64(); err != nil {
+		return err
+	}
+	if b.ProducerEpoch, err = d.Int16(); err != nil {
+		return err
+	}
+	if b.FirstSequence, err = d.Int32(); err != nil {
+		return err
+	}
+	n, err := d.Int32()
+	if err != nil {
+		return err
+	}
+	if n < 0 {
+		return ErrInvalidArrayLength
+	}
+	raw, err := d.RawBytes(d.remaining())
+	if err != nil {
+		return err
+	}
+	if err = d.Pop(); err != nil {
+		return err
+	}
+	if raw, err = Decompress(b.Codec(), raw); err != nil {
+		return err
+	}
+	// the count's from the wire, it can't claim more records than their bytes hold.
+	if int(n) > len(raw)/minRecordLen {
+		return ErrInvalidArrayLength
+	}
+	rd := NewDecoder(raw)
+	b.Records = make([]*Record, n)
+	for i := range b.Records {
+		b.Records[i] = new(Record)
+		if err = b.Records[i].Decode(rd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// records encodes records without a length, as they're compressed in a record batch.
+type records []*Record
+
+func (rs records) Encode(e PacketEncoder) error {
+	for _, r := range rs {
+		if err := r.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Record is a record of a record batch, its offset and timestamp relative to the batch's.
+type Record struct {
+	Attributes     int8
+	TimestampDelta time.Duration
+	OffsetDelta    int64
+	Key            []byte
+	Value          []byte
+	Headers        []*RecordHeader
+}
+
+// RecordHeader is a header of a record, metadata set by the producer that's kept apart from the
+// record's value.
+type RecordHeader struct {
+	Key   []byte
+	Value []byte
+}
+
+func (r *Record) Encode(e PacketEncoder) error {
+	// the record's prefixed with its varint length so it's encoded twice, first to size it.
+	l := new(LenEncoder)
+	if err := r.encode(l); err != nil {
+		return err
+	}
+	e.PutVarint(int64(l.Length))
+	return r.encode(e)
+}
+
+func (r *Record) encode(e PacketEncoder) error {
+	e.PutInt8(r.Attributes)
+	e.PutVarint(int64(r.TimestampDelta / time.Millisecond))
+	e.PutVarint(r.OffsetDelta)
+	if err := e.PutVarintBytes(r.Key); err != nil {
+		return err
+	}
+	if err := e.PutVarintBytes(r.Value); err != nil {
+		return err
+	}
+	e.PutVarint(int64(len(r.Headers)))
+	for _, h := range r.Headers {
+		if err := e.PutVarintBytes(h.Key); err != nil {
+			return err
+		}
+		if err := e.PutVarintBytes(h.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Record) Decode(d PacketDecoder) error {
+	length, err := d.Varint()
+	if err != nil {
+		return err
+	}
+	if length < 0 || length > int64(d.remaining()) {
+		return ErrInsufficientData
+	}
+	raw, err := d.RawBytes(int(length))
+	if err != nil {
+		return err
+	}
+	d = NewDecoder(raw)
+	if r.Attributes, err = d.Int8(); err != nil {
+		return err
+	}
+	delta, err := d.Varint()
+	if err != nil {
+		return err
+	}
+	r.TimestampDelta = time.Duration(delta) * time.Millisecond
+	if r.OffsetDelta, err = d.Varint(); err != nil {
+		return err
+	}
+	if r.Key, err = d.VarintBytes(); err != nil {
+		return err
+	}
+	if r.Value, err = d.VarintBytes(); err != nil {
+		return err
+	}
+	n, err := d.Varint()
+	if err != nil {
+		return err
+	}
+	if n < 0 || n > int64(d.remaining()) {
+		return ErrInvalidArrayLength
+	}
+	for i := int64(0); i < n; i++ {
+		h := new(RecordHeader)
+		if h.Key, err = d.VarintBytes(); err != nil {
+			return err
+		}
+		if h.Value, err = d.VarintBytes(); err != nil {
+			return err
+		}
+		r.Headers = append(r.Headers, h)
+	}
+	return nil
+}
+
+// timestampMillis returns the time in milliseconds since the epoch, or -1 for no timestamp.
+func timestampMillis(t time.Time) int64 {
+	if t.IsZero() {
+		return -1
+	}
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func millisTimestamp(ms int64) time.Time {
+	if ms < 0 {
+		return time.Time{}
+	}
+	return time.Unix(ms/1000, (ms%1000)*int64(time.Millisecond))
+}
+
+// IsRecordBatch returns whether the record set starts with a record batch rather than a legacy
+// message set.
+func IsRecordBatch(set []byte) bool {
+	return len(set) > magicPos && set[magicPos] == RecordBatchMagic
+}
+
+// LastOffset returns the offset of the last record of the record set's first message set or
+// record batch. A message set's messages all share its offset.
+func LastOffset(set []byte) int64 {
+	offset := int64(Encoding.Uint64(set))
+	if IsRecordBatch(set) && len(set) >= lastOffsetDeltaPos+4 {
+		offset += int64(int32(Encoding.Uint32(set[lastOffsetDeltaPos:])))
+	}
+	return offset
+}
+
+// RecordCount returns the number of records in the record batch at the start of the record set,
+// read from its header without decoding them, or -1 if it doesn't start with a record batch.
+func RecordCount(set []byte) int {
+	if !IsRecordBatch(set) || len(set) < recordBatchHeaderLen {
+		return -1
+	}
+	return int(int32(Encoding.Uint32(set[recordsCountPos:])))
+}
+
+// BatchProducer is the idempotent producer of a record batch and the sequences of its records.
+type BatchProducer struct {
+	ID            int64
+	Epoch         int16
+	FirstSequence int32
+	LastSequence  int32
+}
+
+// ProducerOf returns the producer of the record batch at the start of the record set, read from
+// its header, or false if it doesn't start with a record batch or its producer isn't idempotent.
+func ProducerOf(set []byte) (BatchProducer, bool) {
+	if !IsRecordBatch(set) || len(set) < recordBatchHeaderLen {
+		return BatchProducer{}, false
+	}
+	p := BatchProducer{
+		ID:            int64(Encoding.Uint64(set[producerIDPos:])),
+		Epoch:         int16(Encoding.Uint16(set[producerEpochPos:])),
+		FirstSequence: int32(Encoding.Uint32(set[firstSequencePos:])),
+	}
+	// brokers allocate producer IDs from 1, so batches encoded without one aren't idempotent.
+	if p.ID <= 0 || p.FirstSequence < 0 {
+		return BatchProducer{}, false
+	}
+	// sequences wrap around after the max int32.
+	delta := int32(Encoding.Uint32(set[lastOffsetDeltaPos:]))
+	if p.FirstSequence > math.MaxInt32-delta {
+		p.LastSequence = delta - (math.MaxInt32 - p.FirstSequence) - 1
+	} else {
+		p.LastSequence = p.FirstSequence + delta
+	}
+	return p, true
+}
+
+// RecordBatchLen returns the length of the record batch at the start of the record set, read from
+// its header, or -1 if it doesn't start with a record batch.
+func RecordBatchLen(set []byte) int {
+	if !IsRecordBatch(set) {
+		return -1
+	}
+	return 12 + int(Encoding.Uint32(set[8:]))
+}
+
+// DecodeRecords decodes the records of a produced or fetched record set, either record batches
+// or a legacy message set whose messages are returned as records without headers. A record batch
+// truncated by a fetch's max bytes is dropped.
+func DecodeRecords(set []byte) ([]*Record, error) {
+	var rs []*Record
+	for len(set) > 0 {
+		if !IsRecordBatch(set) {
+			// a legacy message set's messages run to the end of the record set.
+			ms := new(MessageSet)
+			if err := ms.Decode(NewDecoder(set)); err != nil {
+				return nil, err
+			}
+			msgs, err := DecompressMessages(ms.Messages)
+			if err != nil {
+				return nil, err
+			}
+			for _, m := range msgs {
+				rs = append(rs, &Record{Key: m.Key, Value: m.Value})
+			}
+			break
+		}
+		d := NewDecoder(set)
+		batch := new(RecordBatch)
+		err := batch.Decode(d)
+		if err == ErrInsufficientData {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		rs = append(rs, batch.Records...)
+		set = set[d.Offset():]
+	}
+	return rs, nil
+}
@@ -0,0 +1,101 @@
+package protocol
+
+import (
+	"hash/crc32"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordBatch(t *testing.T) {
+	req := require.New(t)
+	now := time.Unix(1500000000, 123*int64(time.Millisecond))
+	records := []*Record{
+		{Key: []byte("k0"), Value: []byte("v0"), Headers: []*RecordHeader{{Key: []byte("h"), Value: []byte("hv")}, {Key: []byte("null")}}},
+		{TimestampDelta: 5 * time.Millisecond, OffsetDelta: 1, Value: []byte("v1")},
+	}
+	for _, codec := range []CompressionCodec{CompressionNone, CompressionGZIP} {
+		exp := &RecordBatch{
+			FirstOffset:          10,
+			PartitionLeaderEpoch: 3,
+			Attributes:           int16(codec),
+			LastOffsetDelta:      1,
+			FirstTimestamp:       now,
+			MaxTimestamp:         now.Add(5 * time.Millisecond),
+			ProducerID:           7,
+			ProducerEpoch:        1,
+			FirstSequence:        42,
+			Records:              records,
+		}
+		b, err := Encode(exp)
+		req.NoError(err)
+		req.True(IsRecordBatch(b))
+		req.Equal(int64(11), LastOffset(b))
+		req.Equal(2, RecordCount(b))
+		req.Equal(len(b), RecordBatchLen(b))
+		p, ok := ProducerOf(b)
+		req.True(ok)
+		req.Equal(BatchProducer{ID: 7, Epoch: 1, FirstSequence: 42, LastSequence: 43}, p)
+		wrapped := append([]byte{}, b...)
+		Encoding.PutUint32(wrapped[firstSequencePos:], math.MaxInt32)
+		p, _ = ProducerOf(wrapped)
+		req.Equal(int32(0), p.LastSequence)
+
+		act := new(RecordBatch)
+		req.NoError(act.Decode(NewDecoder(b)))
+		req.Equal(codec, act.Codec())
+		req.True(exp.FirstTimestamp.Equal(act.FirstTimestamp))
+		req.True(exp.MaxTimestamp.Equal(act.MaxTimestamp))
+		act.FirstTimestamp, act.MaxTimestamp = exp.FirstTimestamp, exp.MaxTimestamp
+		req.Equal(exp, act)
+
+		// the base offset isn't covered by the crc so it can be assigned on append.
+		Encoding.PutUint64(b, 20)
+		req.NoError(new(RecordBatch).Decode(NewDecoder(b)))
+		b[len(b)-1]++
+		req.Error(new(RecordBatch).Decode(NewDecoder(b)))
+	}
+
+	// a count of more records than the batch holds is refused before they're allocated.
+	b, err := Encode(&RecordBatch{Records: records})
+	req.NoError(err)
+	Encoding.PutUint32(b[recordsCountPos:], math.MaxInt32)
+	Encoding.PutUint32(b[magicPos+1:], crc32.Checksum(b[magicPos+5:], castagnoliTable))
+	req.Equal(ErrInvalidArrayLength, new(RecordBatch).Decode(NewDecoder(b)))
+}
+
+func TestDecodeRecords(t *testing.T) {
+	req := require.New(t)
+	legacy, err := Encode(&MessageSet{Messages: []*Message{{Key: []byte("k"), Value: []byte("v")}}})
+	req.NoError(err)
+	req.False(IsRecordBatch(legacy))
+	req.Equal(int64(0), LastOffset(legacy))
+	req.Equal(-1, RecordCount(legacy))
+	req.Equal(-1, RecordBatchLen(legacy))
+	_, ok := ProducerOf(legacy)
+	req.False(ok)
+	rs, err := DecodeRecords(legacy)
+	req.NoError(err)
+	req.Equal([]*Record{{Key: []byte("k"), Value: []byte("v")}}, rs)
+
+	first, err := Encode(&RecordBatch{Records: []*Record{{Value: []byte("a")}}})
+	req.NoError(err)
+	second, err := Encode(&RecordBatch{FirstOffset: 1, Records: []*Record{{Value: []byte("b")}}})
+	req.NoError(err)
+	set := append(append([]byte{}, first...), second...)
+	rs, err = DecodeRecords(set)
+	req.NoError(err)
+	req.Len(rs, 2)
+	req.Equal([]byte("b"), rs[1].Value)
+
+	// a batch truncated by the fetch's max bytes is dropped.
+	rs, err = DecodeRecords(set[:len(set)-3])
+	req.NoError(err)
+	req.Len(rs, 1)
+
+	first[len(first)-1]++
+	_, err = DecodeRecords(first)
+	req.Error(err)
+}
@@ -9,6 +9,7 @@ type Body interface {
 type Request struct {
 	CorrelationID int32
 	ClientID      string
+	TaggedFields  TaggedFields
 	Body          Body
 }
 
@@ -20,6 +21,11 @@ func (r *Request) Encode(pe PacketEncoder) (err error) {
 	if err = pe.PutString(r.ClientID); err != nil {
 		return err
 	}
+	if IsFlexible(r.Body.Key(), r.Body.Version()) {
+		if err = pe.PutTaggedFields(r.TaggedFields); err != nil {
+			return err
+		}
+	}
 	if err = r.Body.Encode(pe); err != nil {
 		return err
 	}
@@ -13,6 +13,8 @@ type RequestHeader struct {
 	CorrelationID int32
 	// Size of the Client ID
 	ClientID string
+	// Tagged fields of flexible versions' headers
+	TaggedFields TaggedFields
 }
 
 func (r *RequestHeader) Encode(e PacketEncoder) {
@@ -24,6 +26,11 @@ func (r *RequestHeader) Encode(e PacketEncoder) {
 		// TODO: better err handling
 		panic(err)
 	}
+	if IsFlexible(r.APIKey, r.APIVersion) {
+		if err := e.PutTaggedFields(r.TaggedFields); err != nil {
+			panic(err)
+		}
+	}
 }
 
 func (r *RequestHeader) Decode(d PacketDecoder) error {
@@ -45,6 +52,10 @@ func (r *RequestHeader) Decode(d PacketDecoder) error {
 		return err
 	}
 	r.ClientID, err = d.String()
+	if err != nil || !IsFlexible(r.APIKey, r.APIVersion) {
+		return err
+	}
+	r.TaggedFields, err = d.TaggedFields()
 	return err
 }
 
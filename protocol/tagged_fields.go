@@ -0,0 +1,52 @@
+package protocol
+
+import "sort"
+
+// TaggedFields are the optional fields ending each struct of a flexible version (KIP-482), keyed
+// by tag with the field's encoded value. Fields a struct doesn't know are kept so they round-trip.
+type TaggedFields map[uint32][]byte
+
+// tags returns the fields' tags in ascending order, the order they're encoded in.
+func (t TaggedFields) tags() []uint32 {
+	tags := make([]uint32, 0, len(t))
+	for tag := range t {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+	return tags
+}
+
+// flexibleVersions maps API keys to the first version using the flexible encoding: compact
+// strings and arrays, tagged fields, and request and response headers ending in tagged fields.
+// Generated requests add their API's entry.
+var flexibleVersions = map[int16]int16{}
+
+// IsFlexible returns whether the API's version uses the flexible encoding.
+func IsFlexible(apiKey, version int16) bool {
+	v, ok := flexibleVersions[apiKey]
+	return ok && version >= v
+}
+
+// IsFlexibleResponseHeader returns whether the response header of the API's version ends in
+// tagged fields. API versions responses never do so clients can read them before knowing which
+// versions the broker supports.
+func IsFlexibleResponseHeader(apiKey, version int16) bool {
+	return apiKey != APIVersionsKey && IsFlexible(apiKey, version)
+}
+
+// with returns the tagged fields with the field, leaving these as they are.
+func (t TaggedFields) with(tag uint32, b []byte) TaggedFields {
+	ret := make(TaggedFields, len(t)+1)
+	for k, v := range t {
+		ret[k] = v
+	}
+	ret[tag] = b
+	return ret
+}
+
+// encoderFunc encodes tagged fields' values, generated with the struct they're in.
+type encoderFunc func(e PacketEncoder) error
+
+func (f encoderFunc) Encode(e PacketEncoder) error {
+	return f(e)
+}
@@ -0,0 +1,130 @@
+package protocol
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// flexibleStruct is encoded the way flexible versions' structs are.
+type flexibleStruct struct {
+	Name         string
+	Comment      *string
+	Data         []byte
+	Hosts        []string
+	Replicas     []int32
+	TaggedFields TaggedFields
+}
+
+func (s *flexibleStruct) Encode(e PacketEncoder) error {
+	if err := e.PutCompactString(s.Name); err != nil {
+		return err
+	}
+	if err := e.PutCompactNullableString(s.Comment); err != nil {
+		return err
+	}
+	if err := e.PutCompactBytes(s.Data); err != nil {
+		return err
+	}
+	if err := e.PutCompactStringArray(s.Hosts); err != nil {
+		return err
+	}
+	if err := e.PutCompactInt32Array(s.Replicas); err != nil {
+		return err
+	}
+	return e.PutTaggedFields(s.TaggedFields)
+}
+
+func (s *flexibleStruct) Decode(d PacketDecoder, version int16) (err error) {
+	if s.Name, err = d.CompactString(); err != nil {
+		return err
+	}
+	if s.Comment, err = d.CompactNullableString(); err != nil {
+		return err
+	}
+	if s.Data, err = d.CompactBytes(); err != nil {
+		return err
+	}
+	if s.Hosts, err = d.CompactStringArray(); err != nil {
+		return err
+	}
+	if s.Replicas, err = d.CompactInt32Array(); err != nil {
+		return err
+	}
+	s.TaggedFields, err = d.TaggedFields()
+	return err
+}
+
+func TestFlexibleEncoding(t *testing.T) {
+	req := require.New(t)
+	comment := strings.Repeat("c", 200)
+	for _, exp := range []*flexibleStruct{
+		{Name: "test-topic"},
+		{
+			Name:     "test-topic",
+			Comment:  &comment,
+			Data:     []byte{1, 2, 3},
+			Hosts:    []string{"a", "b"},
+			Replicas: []int32{1, 2, 3},
+			TaggedFields: TaggedFields{
+				300: []byte("unknown"),
+				0:   {},
+				1:   []byte{0xff},
+			},
+		},
+	} {
+		b, err := Encode(exp)
+		req.NoError(err)
+		var act flexibleStruct
+		req.NoError(Decode(b, &act, 0))
+		req.Equal(exp, &act)
+	}
+
+	b, err := Encode(&flexibleStruct{})
+	req.NoError(err)
+	// empty name, null comment and data, empty hosts and replicas, and no tagged fields.
+	req.Equal([]byte{1, 0, 0, 1, 1, 0}, b)
+}
+
+func TestTaggedFieldsDecodeErrors(t *testing.T) {
+	req := require.New(t)
+	for name, b := range map[string][]byte{
+		"unordered tags":  {2, 1, 0, 0, 0},
+		"duplicate tags":  {2, 0, 0, 0, 0},
+		"truncated field": {1, 0, 5, 1},
+		"too many fields": {5, 0, 0},
+		"varint overflow": {0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01},
+	} {
+		_, err := NewDecoder(b).TaggedFields()
+		req.Error(err, name)
+	}
+}
+
+func TestFlexibleRequestHeader(t *testing.T) {
+	req := require.New(t)
+
+	for _, version := range []int16{1, 9} {
+		exp := &Request{
+			CorrelationID: 3,
+			ClientID:      "test-client",
+			Body:          &MetadataRequest{APIVersion: version},
+		}
+		if version == 9 {
+			exp.TaggedFields = TaggedFields{0: []byte("tag")}
+		}
+		b, err := Encode(exp)
+		req.NoError(err)
+		var header RequestHeader
+		req.NoError(header.Decode(NewDecoder(b)))
+		req.Equal(int32(len(b)-4), header.Size)
+		req.Equal(version, header.APIVersion)
+		req.Equal(exp.CorrelationID, header.CorrelationID)
+		req.Equal(exp.ClientID, header.ClientID)
+		req.Equal(exp.TaggedFields, header.TaggedFields)
+	}
+
+	req.True(IsFlexibleResponseHeader(MetadataKey, 9))
+	req.False(IsFlexibleResponseHeader(MetadataKey, 8))
+	req.False(IsFlexibleResponseHeader(APIVersionsKey, 3))
+}
@@ -0,0 +1,104 @@
+package protocol
+
+import (
+	"hash/crc32"
+	"time"
+)
+
+const (
+	// TimestampTypeMask is the attribute bit of magic 1 messages and record batches whose
+	// timestamps are the broker's log append time rather than the producer's create time.
+	TimestampTypeMask = 0x08
+
+	batchCRCPos        = 17
+	batchAttributesPos = 21
+	maxTimestampPos    = 35
+)
+
+// LogAppendTime returns whether the message's timestamp was set by the broker on append.
+func (m *Message) LogAppendTime() bool {
+	return m.MagicByte > 0 && m.Attributes&TimestampTypeMask != 0
+}
+
+// LogAppendTime returns whether the batch's max timestamp was set by the broker on append.
+func (b *RecordBatch) LogAppendTime() bool {
+	return b.Attributes&TimestampTypeMask != 0
+}
+
+// Timestamps returns the create times of a produced record set's records. Magic 0 messages don't
+// have timestamps and neither do records whose producer didn't set one, so they're skipped.
+func Timestamps(set []byte) ([]time.Time, error) {
+	var ts []time.Time
+	for len(set) > 0 {
+		if !IsRecordBatch(set) {
+			ms := new(MessageSet)
+			if err := ms.Decode(NewDecoder(set)); err != nil {
+				return nil, err
+			}
+			msgs, err := DecompressMessages(ms.Messages)
+			if err != nil {
+				return nil, err
+			}
+			for _, m := range msgs {
+				if m.MagicByte > 0 && !m.Timestamp.IsZero() {
+					ts = append(ts, m.Timestamp)
+				}
+			}
+			break
+		}
+		d := NewDecoder(set)
+		batch := new(RecordBatch)
+		if err := batch.Decode(d); err != nil {
+			return nil, err
+		}
+		if !batch.FirstTimestamp.IsZero() {
+			for _, r := range batch.Records {
+				ts = append(ts, batch.FirstTimestamp.Add(r.TimestampDelta))
+			}
+		}
+		set = set[d.Offset():]
+	}
+	return ts, nil
+}
+
+// SetLogAppendTime returns a copy of the record set with its timestamps set to the log append
+// time and marked as such. A record batch's records keep their deltas and only its max timestamp
+// changes, so its header's rewritten in place without decompressing it.
+func SetLogAppendTime(set []byte, t time.Time) ([]byte, error) {
+	out := make([]byte, 0, len(set))
+	for len(set) > 0 {
+		if !IsRecordBatch(set) {
+			ms := new(MessageSet)
+			if err := ms.Decode(NewDecoder(set)); err != nil {
+				return nil, err
+			}
+			for _, m := range ms.Messages {
+				if m.MagicByte > 0 {
+					m.Attributes |= TimestampTypeMask
+					m.Timestamp = t
+				}
+			}
+			b, err := Encode(ms)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, b...)
+			break
+		}
+		if len(set) < recordBatchHeaderLen {
+			return nil, ErrInsufficientData
+		}
+		end := 12 + int(Encoding.Uint32(set[8:]))
+		if end > len(set) || end < recordBatchHeaderLen {
+			return nil, ErrInsufficientData
+		}
+		batch := append([]byte{}, set[:end]...)
+		attributes := Encoding.Uint16(batch[batchAttributesPos:])
+		Encoding.PutUint16(batch[batchAttributesPos:], attributes|TimestampTypeMask)
+		Encoding.PutUint64(batch[maxTimestampPos:], uint64(timestampMillis(t)))
+		Encoding.PutUint32(batch[batchCRCPos:], crc32.Checksum(batch[batchAttributesPos:], castagnoliTable))
+		out = append(out, batch...)
+		set = set[end:]
+	}
+	return out, nil
+}
@@ -0,0 +1,53 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetLogAppendTime(t *testing.T) {
+	req := require.New(t)
+	created := time.Unix(1500000000, 0)
+	appended := created.Add(time.Hour)
+
+	legacy, err := Encode(&MessageSet{Messages: []*Message{
+		{MagicByte: 1, Timestamp: created, Value: []byte("a")},
+		{Value: []byte("b")},
+	}})
+	req.NoError(err)
+	batch, err := Encode(&RecordBatch{
+		Attributes:      int16(CompressionGZIP),
+		LastOffsetDelta: 1,
+		FirstTimestamp:  created,
+		MaxTimestamp:    created.Add(time.Second),
+		Records:         []*Record{{Value: []byte("c")}, {OffsetDelta: 1, TimestampDelta: time.Second, Value: []byte("d")}},
+	})
+	req.NoError(err)
+
+	ts, err := Timestamps(append(append([]byte{}, batch...), legacy...))
+	req.NoError(err)
+	req.Equal([]time.Time{created, created.Add(time.Second), created}, ts)
+
+	stamped, err := SetLogAppendTime(legacy, appended)
+	req.NoError(err)
+	ms := new(MessageSet)
+	req.NoError(ms.Decode(NewDecoder(stamped)))
+	req.True(ms.Messages[0].LogAppendTime())
+	req.True(appended.Equal(ms.Messages[0].Timestamp))
+	req.False(ms.Messages[1].LogAppendTime())
+
+	stamped, err = SetLogAppendTime(batch, appended)
+	req.NoError(err)
+	b := new(RecordBatch)
+	req.NoError(b.Decode(NewDecoder(stamped)))
+	req.True(b.LogAppendTime())
+	req.Equal(CompressionGZIP, b.Codec())
+	req.True(appended.Equal(b.MaxTimestamp))
+	req.True(created.Equal(b.FirstTimestamp))
+	req.Len(b.Records, 2)
+	// the original's left as it was.
+	req.NoError(b.Decode(NewDecoder(batch)))
+	req.False(b.LogAppendTime())
+}
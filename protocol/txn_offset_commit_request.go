@@ -0,0 +1,334 @@
+// Code generated by protocol/gen from schemas/TxnOffsetCommitRequest.json. DO NOT EDIT.
+
+package protocol
+
+func init() {
+	flexibleVersions[TxnOffsetCommitKey] = 3
+}
+
+// TxnOffsetCommitRequest is the TxnOffsetCommit API's request, versions 0-3.
+type TxnOffsetCommitRequest struct {
+	APIVersion int16
+
+	// The ID of the transaction.
+	TransactionalID string
+	// The ID of the group.
+	GroupID string
+	// The current producer ID in use by the transactional ID.
+	ProducerID int64
+	// The current epoch associated with the producer ID.
+	ProducerEpoch int16
+	// The generation of the consumer.
+	GenerationID int32
+	// The member ID assigned by the group coordinator.
+	MemberID string
+	// The unique identifier of the consumer instance provided by end user.
+	GroupInstanceID *string
+	// Each topic that we want to commit offsets for.
+	Topics []*TxnOffsetCommitRequestTopic
+	// TaggedFields are the tagged fields of flexible versions unknown to this struct.
+	TaggedFields TaggedFields
+}
+
+// TxnOffsetCommitRequestTopic is an element of TxnOffsetCommitRequest's Topics.
+type TxnOffsetCommitRequestTopic struct {
+	// The topic name.
+	Name string
+	// The partitions inside the topic that we want to committ offsets for.
+	Partitions []*TxnOffsetCommitRequestPartition
+	// TaggedFields are the tagged fields of flexible versions unknown to this struct.
+	TaggedFields TaggedFields
+}
+
+// TxnOffsetCommitRequestPartition is an element of TxnOffsetCommitRequestTopic's Partitions.
+type TxnOffsetCommitRequestPartition struct {
+	// The index of the partition within the topic.
+	PartitionIndex int32
+	// The message offset to be committed.
+	CommittedOffset int64
+	// The leader epoch of the last consumed record.
+	CommittedLeaderEpoch int32
+	// Any associated metadata the client wants to keep.
+	CommittedMetadata *string
+	// TaggedFields are the tagged fields of flexible versions unknown to this struct.
+	TaggedFields TaggedFields
+}
+
+func (r *TxnOffsetCommitRequest) Encode(e PacketEncoder) error {
+	return r.encode(e, r.APIVersion)
+}
+
+func (r *TxnOffsetCommitRequest) Decode(d PacketDecoder, version int16) error {
+	r.APIVersion = version
+	return r.decode(d, version)
+}
+
+func (r *TxnOffsetCommitRequest) Key() int16 {
+	return TxnOffsetCommitKey
+}
+
+func (r *TxnOffsetCommitRequest) Version() int16 {
+	return r.APIVersion
+}
+
+func (r *TxnOffsetCommitRequest) encode(e PacketEncoder, version int16) (err error) {
+	flexible := version >= 3
+	if flexible {
+		err = e.PutCompactString(r.TransactionalID)
+	} else {
+		err = e.PutString(r.TransactionalID)
+	}
+	if err != nil {
+		return err
+	}
+	if flexible {
+		err = e.PutCompactString(r.GroupID)
+	} else {
+		err = e.PutString(r.GroupID)
+	}
+	if err != nil {
+		return err
+	}
+	e.PutInt64(r.ProducerID)
+	e.PutInt16(r.ProducerEpoch)
+	if version >= 3 {
+		e.PutInt32(r.GenerationID)
+	}
+	if version >= 3 {
+		if flexible {
+			err = e.PutCompactString(r.MemberID)
+		} else {
+			err = e.PutString(r.MemberID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if version >= 3 {
+		if flexible {
+			err = e.PutCompactNullableString(r.GroupInstanceID)
+		} else {
+			err = e.PutNullableString(r.GroupInstanceID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if flexible {
+		err = e.PutCompactArrayLength(len(r.Topics))
+	} else {
+		err = e.PutArrayLength(len(r.Topics))
+	}
+	if err != nil {
+		return err
+	}
+	for _, v := range r.Topics {
+		if err = v.encode(e, version); err != nil {
+			return err
+		}
+	}
+	if flexible {
+		if err = e.PutTaggedFields(r.TaggedFields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *TxnOffsetCommitRequest) decode(d PacketDecoder, version int16) (err error) {
+	flexible := version >= 3
+	var n int
+	if flexible {
+		r.TransactionalID, err = d.CompactString()
+	} else {
+		r.TransactionalID, err = d.String()
+	}
+	if err != nil {
+		return err
+	}
+	if flexible {
+		r.GroupID, err = d.CompactString()
+	} else {
+		r.GroupID, err = d.String()
+	}
+	if err != nil {
+		return err
+	}
+	if r.ProducerID, err = d.Int64(); err != nil {
+		return err
+	}
+	if r.ProducerEpoch, err = d.Int16(); err != nil {
+		return err
+	}
+	if version >= 3 {
+		if r.GenerationID, err = d.Int32(); err != nil {
+			return err
+		}
+	} else {
+		r.GenerationID = -1
+	}
+	if version >= 3 {
+		if flexible {
+			r.MemberID, err = d.CompactString()
+		} else {
+			r.MemberID, err = d.String()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if version >= 3 {
+		if flexible {
+			r.GroupInstanceID, err = d.CompactNullableString()
+		} else {
+			r.GroupInstanceID, err = d.NullableString()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if flexible {
+		n, err = d.CompactArrayLength()
+	} else {
+		n, err = d.ArrayLength()
+	}
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		r.Topics = make([]*TxnOffsetCommitRequestTopic, n)
+		for i := range r.Topics {
+			r.Topics[i] = new(TxnOffsetCommitRequestTopic)
+			if err = r.Topics[i].decode(d, version); err != nil {
+				return err
+			}
+		}
+	}
+	if flexible {
+		if r.TaggedFields, err = d.TaggedFields(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *TxnOffsetCommitRequestTopic) encode(e PacketEncoder, version int16) (err error) {
+	flexible := version >= 3
+	if flexible {
+		err = e.PutCompactString(r.Name)
+	} else {
+		err = e.PutString(r.Name)
+	}
+	if err != nil {
+		return err
+	}
+	if flexible {
+		err = e.PutCompactArrayLength(len(r.Partitions))
+	} else {
+		err = e.PutArrayLength(len(r.Partitions))
+	}
+	if err != nil {
+		return err
+	}
+	for _, v := range r.Partitions {
+		if err = v.encode(e, version); err != nil {
+			return err
+		}
+	}
+	if flexible {
+		if err = e.PutTaggedFields(r.TaggedFields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *TxnOffsetCommitRequestTopic) decode(d PacketDecoder, version int16) (err error) {
+	flexible := version >= 3
+	var n int
+	if flexible {
+		r.Name, err = d.CompactString()
+	} else {
+		r.Name, err = d.String()
+	}
+	if err != nil {
+		return err
+	}
+	if flexible {
+		n, err = d.CompactArrayLength()
+	} else {
+		n, err = d.ArrayLength()
+	}
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		r.Partitions = make([]*TxnOffsetCommitRequestPartition, n)
+		for i := range r.Partitions {
+			r.Partitions[i] = new(TxnOffsetCommitRequestPartition)
+			if err = r.Partitions[i].decode(d, version); err != nil {
+				return err
+			}
+		}
+	}
+	if flexible {
+		if r.TaggedFields, err = d.TaggedFields(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *TxnOffsetCommitRequestPartition) encode(e PacketEncoder, version int16) (err error) {
+	flexible := version >= 3
+	e.PutInt32(r.PartitionIndex)
+	e.PutInt64(r.CommittedOffset)
+	if version >= 2 {
+		e.PutInt32(r.CommittedLeaderEpoch)
+	}
+	if flexible {
+		err = e.PutCompactNullableString(r.CommittedMetadata)
+	} else {
+		err = e.PutNullableString(r.CommittedMetadata)
+	}
+	if err != nil {
+		return err
+	}
+	if flexible {
+		if err = e.PutTaggedFields(r.TaggedFields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *TxnOffsetCommitRequestPartition) decode(d PacketDecoder, version int16) (err error) {
+	flexible := version >= 3
+	if r.PartitionIndex, err = d.Int32(); err != nil {
+		return err
+	}
+	if r.CommittedOffset, err = d.Int64(); err != nil {
+		return err
+	}
+	if version >= 2 {
+		if r.CommittedLeaderEpoch, err = d.Int32(); err != nil {
+			return err
+		}
+	} else {
+		r.CommittedLeaderEpoch = -1
+	}
+	if flexible {
+		r.CommittedMetadata, err = d.CompactNullableString()
+	} else {
+		r.CommittedMetadata, err = d.NullableString()
+	}
+	if err != nil {
+		return err
+	}
+	if flexible {
+		if r.TaggedFields, err = d.TaggedFields(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
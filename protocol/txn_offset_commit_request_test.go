@@ -0,0 +1,63 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxnOffsetCommitRequest(t *testing.T) {
+	req := require.New(t)
+	metadata := "metadata"
+	// fields missing from the version are decoded as their defaults.
+	for _, exp := range []*TxnOffsetCommitRequest{
+		{
+			TransactionalID: "txn",
+			GroupID:         "group",
+			ProducerID:      7,
+			ProducerEpoch:   1,
+			GenerationID:    -1,
+			Topics: []*TxnOffsetCommitRequestTopic{{
+				Name:       "a",
+				Partitions: []*TxnOffsetCommitRequestPartition{{PartitionIndex: 1, CommittedOffset: 42, CommittedLeaderEpoch: -1, CommittedMetadata: &metadata}},
+			}},
+		},
+		{
+			APIVersion:      3,
+			TransactionalID: "txn",
+			GroupID:         "group",
+			ProducerID:      7,
+			ProducerEpoch:   1,
+			GenerationID:    2,
+			MemberID:        "member",
+			Topics: []*TxnOffsetCommitRequestTopic{{
+				Name:       "a",
+				Partitions: []*TxnOffsetCommitRequestPartition{{PartitionIndex: 1, CommittedOffset: 42, CommittedLeaderEpoch: 4}},
+			}},
+		},
+	} {
+		b, err := Encode(exp)
+		req.NoError(err)
+		var act TxnOffsetCommitRequest
+		req.NoError(Decode(b, &act, exp.Version()))
+		req.Equal(exp, &act)
+	}
+}
+
+func TestTxnOffsetCommitResponse(t *testing.T) {
+	req := require.New(t)
+	exp := &TxnOffsetCommitResponse{
+		APIVersion:   1,
+		ThrottleTime: time.Second,
+		Topics: []*TxnOffsetCommitResponseTopic{{
+			Name:       "a",
+			Partitions: []*TxnOffsetCommitResponsePartition{{PartitionIndex: 1, ErrorCode: ErrNone.Code()}},
+		}},
+	}
+	b, err := Encode(exp)
+	req.NoError(err)
+	var act TxnOffsetCommitResponse
+	req.NoError(Decode(b, &act, exp.Version()))
+	req.Equal(exp, &act)
+}
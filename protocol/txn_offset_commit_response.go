@@ -0,0 +1,206 @@
+// Code generated by protocol/gen from schemas/TxnOffsetCommitResponse.json. DO NOT EDIT.
+
+package protocol
+
+import "time"
+
+// TxnOffsetCommitResponse is the TxnOffsetCommit API's response, versions 0-3.
+type TxnOffsetCommitResponse struct {
+	APIVersion int16
+
+	// The duration in milliseconds for which the request was throttled due to a quota violation, or zero if the request did not violate any quota.
+	ThrottleTime time.Duration
+	// The responses for each topic.
+	Topics []*TxnOffsetCommitResponseTopic
+	// TaggedFields are the tagged fields of flexible versions unknown to this struct.
+	TaggedFields TaggedFields
+}
+
+// TxnOffsetCommitResponseTopic is an element of TxnOffsetCommitResponse's Topics.
+type TxnOffsetCommitResponseTopic struct {
+	// The topic name.
+	Name string
+	// The responses for each partition in the topic.
+	Partitions []*TxnOffsetCommitResponsePartition
+	// TaggedFields are the tagged fields of flexible versions unknown to this struct.
+	TaggedFields TaggedFields
+}
+
+// TxnOffsetCommitResponsePartition is an element of TxnOffsetCommitResponseTopic's Partitions.
+type TxnOffsetCommitResponsePartition struct {
+	// The partition index.
+	PartitionIndex int32
+	// The error code, or 0 if there was no error.
+	ErrorCode int16
+	// TaggedFields are the tagged fields of flexible versions unknown to this struct.
+	TaggedFields TaggedFields
+}
+
+func (r *TxnOffsetCommitResponse) Encode(e PacketEncoder) error {
+	return r.encode(e, r.APIVersion)
+}
+
+func (r *TxnOffsetCommitResponse) Decode(d PacketDecoder, version int16) error {
+	r.APIVersion = version
+	return r.decode(d, version)
+}
+
+func (r *TxnOffsetCommitResponse) Key() int16 {
+	return TxnOffsetCommitKey
+}
+
+func (r *TxnOffsetCommitResponse) Version() int16 {
+	return r.APIVersion
+}
+
+func (r *TxnOffsetCommitResponse) encode(e PacketEncoder, version int16) (err error) {
+	flexible := version >= 3
+	e.PutInt32(int32(r.ThrottleTime / time.Millisecond))
+	if flexible {
+		err = e.PutCompactArrayLength(len(r.Topics))
+	} else {
+		err = e.PutArrayLength(len(r.Topics))
+	}
+	if err != nil {
+		return err
+	}
+	for _, v := range r.Topics {
+		if err = v.encode(e, version); err != nil {
+			return err
+		}
+	}
+	if flexible {
+		if err = e.PutTaggedFields(r.TaggedFields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *TxnOffsetCommitResponse) decode(d PacketDecoder, version int16) (err error) {
+	flexible := version >= 3
+	var n int
+	if ms, err := d.Int32(); err != nil {
+		return err
+	} else {
+		r.ThrottleTime = time.Duration(ms) * time.Millisecond
+	}
+	if flexible {
+		n, err = d.CompactArrayLength()
+	} else {
+		n, err = d.ArrayLength()
+	}
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		r.Topics = make([]*TxnOffsetCommitResponseTopic, n)
+		for i := range r.Topics {
+			r.Topics[i] = new(TxnOffsetCommitResponseTopic)
+			if err = r.Topics[i].decode(d, version); err != nil {
+				return err
+			}
+		}
+	}
+	if flexible {
+		if r.TaggedFields, err = d.TaggedFields(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *TxnOffsetCommitResponseTopic) encode(e PacketEncoder, version int16) (err error) {
+	flexible := version >= 3
+	if flexible {
+		err = e.PutCompactString(r.Name)
+	} else {
+		err = e.PutString(r.Name)
+	}
+	if err != nil {
+		return err
+	}
+	if flexible {
+		err = e.PutCompactArrayLength(len(r.Partitions))
+	} else {
+		err = e.PutArrayLength(len(r.Partitions))
+	}
+	if err != nil {
+		return err
+	}
+	for _, v := range r.Partitions {
+		if err = v.encode(e, version); err != nil {
+			return err
+		}
+	}
+	if flexible {
+		if err = e.PutTaggedFields(r.TaggedFields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *TxnOffsetCommitResponseTopic) decode(d PacketDecoder, version int16) (err error) {
+	flexible := version >= 3
+	var n int
+	if flexible {
+		r.Name, err = d.CompactString()
+	} else {
+		r.Name, err = d.String()
+	}
+	if err != nil {
+		return err
+	}
+	if flexible {
+		n, err = d.CompactArrayLength()
+	} else {
+		n, err = d.ArrayLength()
+	}
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		r.Partitions = make([]*TxnOffsetCommitResponsePartition, n)
+		for i := range r.Partitions {
+			r.Partitions[i] = new(TxnOffsetCommitResponsePartition)
+			if err = r.Partitions[i].decode(d, version); err != nil {
+				return err
+			}
+		}
+	}
+	if flexible {
+		if r.TaggedFields, err = d.TaggedFields(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *TxnOffsetCommitResponsePartition) encode(e PacketEncoder, version int16) (err error) {
+	flexible := version >= 3
+	e.PutInt32(r.PartitionIndex)
+	e.PutInt16(r.ErrorCode)
+	if flexible {
+		if err = e.PutTaggedFields(r.TaggedFields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *TxnOffsetCommitResponsePartition) decode(d PacketDecoder, version int16) (err error) {
+	flexible := version >= 3
+	if r.PartitionIndex, err = d.Int32(); err != nil {
+		return err
+	}
+	if r.ErrorCode, err = d.Int16(); err != nil {
+		return err
+	}
+	if flexible {
+		if r.TaggedFields, err = d.TaggedFields(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package protocol
+
+// UpdateFeaturesRequest is a jocko extension API finalizing the levels of gated features, so
+// brokers start using them. The controller only finalizes a level every broker supports, after
+// which brokers that don't can't join the cluster. Like topic creation it must be sent to the
+// controller, and the updates are applied all together or not at all.
+type UpdateFeaturesRequest struct {
+	APIVersion int16
+
+	Updates []*FeatureUpdate
+	// ValidateOnly checks the updates without applying them.
+	ValidateOnly bool
+}
+
+// FeatureUpdate sets a feature's finalized level. Lowering it, or unfinalizing the feature with
+// level 0, must be allowed with AllowDowngrade since brokers may have written data only the
+// higher level reads.
+type FeatureUpdate struct {
+	Name           string
+	Level          int16
+	AllowDowngrade bool
+}
+
+func (r *UpdateFeaturesRequest) Encode(e PacketEncoder) (err error) {
+	if err = e.PutArrayLength(len(r.Updates)); err != nil {
+		return err
+	}
+	for _, u := range r.Updates {
+		if err = e.PutString(u.Name); err != nil {
+			return err
+		}
+		e.PutInt16(u.Level)
+		e.PutBool(u.AllowDowngrade)
+	}
+	e.PutBool(r.ValidateOnly)
+	return nil
+}
+
+func (r *UpdateFeaturesRequest) Decode(d PacketDecoder, version int16) (err error) {
+	r.APIVersion = version
+
+	n, err := d.ArrayLength()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		r.Updates = make([]*FeatureUpdate, n)
+		for i := range r.Updates {
+			u := new(FeatureUpdate)
+			if u.Name, err = d.String(); err != nil {
+				return err
+			}
+			if u.Level, err = d.Int16(); err != nil {
+				return err
+			}
+			if u.AllowDowngrade, err = d.Bool(); err != nil {
+				return err
+			}
+			r.Updates[i] = u
+		}
+	}
+	r.ValidateOnly, err = d.Bool()
+	return err
+}
+
+func (r *UpdateFeaturesRequest) Key() int16 {
+	return UpdateFeaturesKey
+}
+
+func (r *UpdateFeaturesRequest) Version() int16 {
+	return r.APIVersion
+}
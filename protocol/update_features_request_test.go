@@ -0,0 +1,39 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateFeaturesRequest(t *testing.T) {
+	req := require.New(t)
+	exp := &UpdateFeaturesRequest{
+		Updates: []*FeatureUpdate{
+			{Name: "record_batch", Level: 2},
+			{Name: "node_maintenance", Level: 0, AllowDowngrade: true},
+		},
+		ValidateOnly: true,
+	}
+	b, err := Encode(exp)
+	req.NoError(err)
+	var act UpdateFeaturesRequest
+	err = Decode(b, &act, exp.Version())
+	req.NoError(err)
+	req.Equal(exp, &act)
+}
+
+func TestUpdateFeaturesResponse(t *testing.T) {
+	req := require.New(t)
+	msg := "brokers [2] don't support record_batch level 2"
+	exp := &UpdateFeaturesResponse{
+		ErrorCode:    ErrInvalidRequest.Code(),
+		ErrorMessage: &msg,
+	}
+	b, err := Encode(exp)
+	req.NoError(err)
+	var act UpdateFeaturesResponse
+	err = Decode(b, &act, exp.Version())
+	req.NoError(err)
+	req.Equal(exp, &act)
+}
@@ -0,0 +1,31 @@
+package protocol
+
+type UpdateFeaturesResponse struct {
+	APIVersion int16
+
+	ErrorCode    int16
+	ErrorMessage *string
+}
+
+func (r *UpdateFeaturesResponse) Encode(e PacketEncoder) (err error) {
+	e.PutInt16(r.ErrorCode)
+	return e.PutNullableString(r.ErrorMessage)
+}
+
+func (r *UpdateFeaturesResponse) Decode(d PacketDecoder, version int16) (err error) {
+	r.APIVersion = version
+
+	if r.ErrorCode, err = d.Int16(); err != nil {
+		return err
+	}
+	r.ErrorMessage, err = d.NullableString()
+	return err
+}
+
+func (r *UpdateFeaturesResponse) Key() int16 {
+	return UpdateFeaturesKey
+}
+
+func (r *UpdateFeaturesResponse) Version() int16 {
+	return r.APIVersion
+}
@@ -0,0 +1,43 @@
+package protocol
+
+import (
+	"encoding/hex"
+	"strings"
+)
+
+// uuidSize is the size of an encoded UUID.
+const uuidSize = 16
+
+// uuidBytes returns the bytes of the UUID in its canonical form, e.g. a topic ID. An empty string
+// is the zero UUID, which Kafka uses for no ID.
+func uuidBytes(s string) ([uuidSize]byte, error) {
+	var b [uuidSize]byte
+	if s == "" {
+		return b, nil
+	}
+	h := strings.Replace(s, "-", "", -1)
+	if len(h) != 2*uuidSize {
+		return b, ErrInvalidUUID
+	}
+	if _, err := hex.Decode(b[:], []byte(h)); err != nil {
+		return b, ErrInvalidUUID
+	}
+	return b, nil
+}
+
+// uuidString returns the canonical form of the encoded UUID, or an empty string for the zero
+// UUID.
+func uuidString(b []byte) string {
+	zero := true
+	for _, c := range b {
+		if c != 0 {
+			zero = false
+			break
+		}
+	}
+	if zero {
+		return ""
+	}
+	h := hex.EncodeToString(b)
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
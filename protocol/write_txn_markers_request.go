@@ -0,0 +1,242 @@
+// Code generated by protocol/gen from schemas/WriteTxnMarkersRequest.json. DO NOT EDIT.
+
+package protocol
+
+func init() {
+	flexibleVersions[WriteTxnMarkersKey] = 1
+}
+
+// WriteTxnMarkersRequest is the WriteTxnMarkers API's request, versions 0-1.
+type WriteTxnMarkersRequest struct {
+	APIVersion int16
+
+	// The transaction markers to be written.
+	Markers []*WriteTxnMarkersRequestWritableTxnMarker
+	// TaggedFields are the tagged fields of flexible versions unknown to this struct.
+	TaggedFields TaggedFields
+}
+
+// WriteTxnMarkersRequestWritableTxnMarker is an element of WriteTxnMarkersRequest's Markers.
+type WriteTxnMarkersRequestWritableTxnMarker struct {
+	// The current producer ID.
+	ProducerID int64
+	// The current epoch associated with the producer ID.
+	ProducerEpoch int16
+	// The result of the transaction to write to the partitions (false = ABORT, true = COMMIT).
+	TransactionResult bool
+	// Each topic that we want to write transaction marker(s) for.
+	Topics []*WriteTxnMarkersRequestWritableTxnMarkerTopic
+	// Epoch associated with the transaction state partition hosted by this transaction coordinator
+	CoordinatorEpoch int32
+	// TaggedFields are the tagged fields of flexible versions unknown to this struct.
+	TaggedFields TaggedFields
+}
+
+// WriteTxnMarkersRequestWritableTxnMarkerTopic is an element of WriteTxnMarkersRequestWritableTxnMarker's Topics.
+type WriteTxnMarkersRequestWritableTxnMarkerTopic struct {
+	// The topic name.
+	Name string
+	// The indexes of the partitions to write transaction markers for.
+	PartitionIndexes []int32
+	// TaggedFields are the tagged fields of flexible versions unknown to this struct.
+	TaggedFields TaggedFields
+}
+
+func (r *WriteTxnMarkersRequest) Encode(e PacketEncoder) error {
+	return r.encode(e, r.APIVersion)
+}
+
+func (r *WriteTxnMarkersRequest) Decode(d PacketDecoder, version int16) error {
+	r.APIVersion = version
+	return r.decode(d, version)
+}
+
+func (r *WriteTxnMarkersRequest) Key() int16 {
+	return WriteTxnMarkersKey
+}
+
+func (r *WriteTxnMarkersRequest) Version() int16 {
+	return r.APIVersion
+}
+
+func (r *WriteTxnMarkersRequest) encode(e PacketEncoder, version int16) (err error) {
+	flexible := version >= 1
+	if flexible {
+		err = e.PutCompactArrayLength(len(r.Markers))
+	} else {
+		err = e.PutArrayLength(len(r.Markers))
+	}
+	if err != nil {
+		return err
+	}
+	for _, v := range r.Markers {
+		if err = v.encode(e, version); err != nil {
+			return err
+		}
+	}
+	if flexible {
+		if err = e.PutTaggedFields(r.TaggedFields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *WriteTxnMarkersRequest) decode(d PacketDecoder, version int16) (err error) {
+	flexible := version >= 1
+	var n int
+	if flexible {
+		n, err = d.CompactArrayLength()
+	} else {
+		n, err = d.ArrayLength()
+	}
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		r.Markers = make([]*WriteTxnMarkersRequestWritableTxnMarker, n)
+		for i := range r.Markers {
+			r.Markers[i] = new(WriteTxnMarkersRequestWritableTxnMarker)
+			if err = r.Markers[i].decode(d, version); err != nil {
+				return err
+			}
+		}
+	}
+	if flexible {
+		if r.TaggedFields, err = d.TaggedFields(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *WriteTxnMarkersRequestWritableTxnMarker) encode(e PacketEncoder, version int16) (err error) {
+	flexible := version >= 1
+	e.PutInt64(r.ProducerID)
+	e.PutInt16(r.ProducerEpoch)
+	e.PutBool(r.TransactionResult)
+	if flexible {
+		err = e.PutCompactArrayLength(len(r.Topics))
+	} else {
+		err = e.PutArrayLength(len(r.Topics))
+	}
+	if err != nil {
+		return err
+	}
+	for _, v := range r.Topics {
+		if err = v.encode(e, version); err != nil {
+			return err
+		}
+	}
+	e.PutInt32(r.CoordinatorEpoch)
+	if flexible {
+		if err = e.PutTaggedFields(r.TaggedFields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *WriteTxnMarkersRequestWritableTxnMarker) decode(d PacketDecoder, version int16) (err error) {
+	flexible := version >= 1
+	var n int
+	if r.ProducerID, err = d.Int64(); err != nil {
+		return err
+	}
+	if r.ProducerEpoch, err = d.Int16(); err != nil {
+		return err
+	}
+	if r.TransactionResult, err = d.Bool(); err != nil {
+		return err
+	}
+	if flexible {
+		n, err = d.CompactArrayLength()
+	} else {
+		n, err = d.ArrayLength()
+	}
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		r.Topics = make([]*WriteTxnMarkersRequestWritableTxnMarkerTopic, n)
+		for i := range r.Topics {
+			r.Topics[i] = new(WriteTxnMarkersRequestWritableTxnMarkerTopic)
+			if err = r.Topics[i].decode(d, version); err != nil {
+				return err
+			}
+		}
+	}
+	if r.CoordinatorEpoch, err = d.Int32(); err != nil {
+		return err
+	}
+	if flexible {
+		if r.TaggedFields, err = d.TaggedFields(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *WriteTxnMarkersRequestWritableTxnMarkerTopic) encode(e PacketEncoder, version int16) (err error) {
+	flexible := version >= 1
+	if flexible {
+		err = e.PutCompactString(r.Name)
+	} else {
+		err = e.PutString(r.Name)
+	}
+	if err != nil {
+		return err
+	}
+	if flexible {
+		err = e.PutCompactArrayLength(len(r.PartitionIndexes))
+	} else {
+		err = e.PutArrayLength(len(r.PartitionIndexes))
+	}
+	if err != nil {
+		return err
+	}
+	for _, v := range r.PartitionIndexes {
+		e.PutInt32(v)
+	}
+	if flexible {
+		if err = e.PutTaggedFields(r.TaggedFields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *WriteTxnMarkersRequestWritableTxnMarkerTopic) decode(d PacketDecoder, version int16) (err error) {
+	flexible := version >= 1
+	var n int
+	if flexible {
+		r.Name, err = d.CompactString()
+	} else {
+		r.Name, err = d.String()
+	}
+	if err != nil {
+		return err
+	}
+	if flexible {
+		n, err = d.CompactArrayLength()
+	} else {
+		n, err = d.ArrayLength()
+	}
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		r.PartitionIndexes = make([]int32, n)
+		for i := range r.PartitionIndexes {
+			if r.PartitionIndexes[i], err = d.Int32(); err != nil {
+				return err
+			}
+		}
+	}
+	if flexible {
+		if r.TaggedFields, err = d.TaggedFields(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
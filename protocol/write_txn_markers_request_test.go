@@ -0,0 +1,43 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteTxnMarkersRequest(t *testing.T) {
+	req := require.New(t)
+	exp := &WriteTxnMarkersRequest{
+		Markers: []*WriteTxnMarkersRequestWritableTxnMarker{{
+			ProducerID:        7,
+			ProducerEpoch:     1,
+			TransactionResult: true,
+			Topics:            []*WriteTxnMarkersRequestWritableTxnMarkerTopic{{Name: "a", PartitionIndexes: []int32{0, 1}}},
+			CoordinatorEpoch:  3,
+		}},
+	}
+	b, err := Encode(exp)
+	req.NoError(err)
+	var act WriteTxnMarkersRequest
+	req.NoError(Decode(b, &act, exp.Version()))
+	req.Equal(exp, &act)
+}
+
+func TestWriteTxnMarkersResponse(t *testing.T) {
+	req := require.New(t)
+	exp := &WriteTxnMarkersResponse{
+		Markers: []*WriteTxnMarkersResponseWritableTxnMarkerResult{{
+			ProducerID: 7,
+			Topics: []*WriteTxnMarkersResponseWritableTxnMarkerTopicResult{{
+				Name:       "a",
+				Partitions: []*WriteTxnMarkersResponseWritableTxnMarkerPartitionResult{{PartitionIndex: 1, ErrorCode: ErrNotLeaderForPartition.Code()}},
+			}},
+		}},
+	}
+	b, err := Encode(exp)
+	req.NoError(err)
+	var act WriteTxnMarkersResponse
+	req.NoError(Decode(b, &act, exp.Version()))
+	req.Equal(exp, &act)
+}
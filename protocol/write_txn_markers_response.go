@@ -0,0 +1,261 @@
+// Code generated by protocol/gen from schemas/WriteTxnMarkersResponse.json. DO NOT EDIT.
+
+package protocol
+
+// WriteTxnMarkersResponse is the WriteTxnMarkers API's response, versions 0-1.
+type WriteTxnMarkersResponse struct {
+	APIVersion int16
+
+	// The results for writing makers.
+	Markers []*WriteTxnMarkersResponseWritableTxnMarkerResult
+	// TaggedFields are the tagged fields of flexible versions unknown to this struct.
+	TaggedFields TaggedFields
+}
+
+// WriteTxnMarkersResponseWritableTxnMarkerResult is an element of WriteTxnMarkersResponse's Markers.
+type WriteTxnMarkersResponseWritableTxnMarkerResult struct {
+	// The current producer ID in use by the transactional ID.
+	ProducerID int64
+	// The results by topic.
+	Topics []*WriteTxnMarkersResponseWritableTxnMarkerTopicResult
+	// TaggedFields are the tagged fields of flexible versions unknown to this struct.
+	TaggedFields TaggedFields
+}
+
+// WriteTxnMarkersResponseWritableTxnMarkerTopicResult is an element of WriteTxnMarkersResponseWritableTxnMarkerResult's Topics.
+type WriteTxnMarkersResponseWritableTxnMarkerTopicResult struct {
+	// The topic name.
+	Name string
+	// The results by partition.
+	Partitions []*WriteTxnMarkersResponseWritableTxnMarkerPartitionResult
+	// TaggedFields are the tagged fields of flexible versions unknown to this struct.
+	TaggedFields TaggedFields
+}
+
+// WriteTxnMarkersResponseWritableTxnMarkerPartitionResult is an element of WriteTxnMarkersResponseWritableTxnMarkerTopicResult's Partitions.
+type WriteTxnMarkersResponseWritableTxnMarkerPartitionResult struct {
+	// The partition index.
+	PartitionIndex int32
+	// The error code, or 0 if there was no error.
+	ErrorCode int16
+	// TaggedFields are the tagged fields of flexible versions unknown to this struct.
+	TaggedFields TaggedFields
+}
+
+func (r *WriteTxnMarkersResponse) Encode(e PacketEncoder) error {
+	return r.encode(e, r.APIVersion)
+}
+
+func (r *WriteTxnMarkersResponse) Decode(d PacketDecoder, version int16) error {
+	r.APIVersion = version
+	return r.decode(d, version)
+}
+
+func (r *WriteTxnMarkersResponse) Key() int16 {
+	return WriteTxnMarkersKey
+}
+
+func (r *WriteTxnMarkersResponse) Version() int16 {
+	return r.APIVersion
+}
+
+func (r *WriteTxnMarkersResponse) encode(e PacketEncoder, version int16) (err error) {
+	flexible := version >= 1
+	if flexible {
+		err = e.PutCompactArrayLength(len(r.Markers))
+	} else {
+		err = e.PutArrayLength(len(r.Markers))
+	}
+	if err != nil {
+		return err
+	}
+	for _, v := range r.Markers {
+		if err = v.encode(e, version); err != nil {
+			return err
+		}
+	}
+	if flexible {
+		if err = e.PutTaggedFields(r.TaggedFields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *WriteTxnMarkersResponse) decode(d PacketDecoder, version int16) (err error) {
+	flexible := version >= 1
+	var n int
+	if flexible {
+		n, err = d.CompactArrayLength()
+	} else {
+		n, err = d.ArrayLength()
+	}
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		r.Markers = make([]*WriteTxnMarkersResponseWritableTxnMarkerResult, n)
+		for i := range r.Markers {
+			r.Markers[i] = new(WriteTxnMarkersResponseWritableTxnMarkerResult)
+			if err = r.Markers[i].decode(d, version); err != nil {
+				return err
+			}
+		}
+	}
+	if flexible {
+		if r.TaggedFields, err = d.TaggedFields(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *WriteTxnMarkersResponseWritableTxnMarkerResult) encode(e PacketEncoder, version int16) (err error) {
+	flexible := version >= 1
+	e.PutInt64(r.ProducerID)
+	if flexible {
+		err = e.PutCompactArrayLength(len(r.Topics))
+	} else {
+		err = e.PutArrayLength(len(r.Topics))
+	}
+	if err != nil {
+		return err
+	}
+	for _, v := range r.Topics {
+		if err = v.encode(e, version); err != nil {
+			return err
+		}
+	}
+	if flexible {
+		if err = e.PutTaggedFields(r.TaggedFields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *WriteTxnMarkersResponseWritableTxnMarkerResult) decode(d PacketDecoder, version int16) (err error) {
+	flexible := version >= 1
+	var n int
+	if r.ProducerID, err = d.Int64(); err != nil {
+		return err
+	}
+	if flexible {
+		n, err = d.CompactArrayLength()
+	} else {
+		n, err = d.ArrayLength()
+	}
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		r.Topics = make([]*WriteTxnMarkersResponseWritableTxnMarkerTopicResult, n)
+		for i := range r.Topics {
+			r.Topics[i] = new(WriteTxnMarkersResponseWritableTxnMarkerTopicResult)
+			if err = r.Topics[i].decode(d, version); err != nil {
+				return err
+			}
+		}
+	}
+	if flexible {
+		if r.TaggedFields, err = d.TaggedFields(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *WriteTxnMarkersResponseWritableTxnMarkerTopicResult) encode(e PacketEncoder, version int16) (err error) {
+	flexible := version >= 1
+	if flexible {
+		err = e.PutCompactString(r.Name)
+	} else {
+		err = e.PutString(r.Name)
+	}
+	if err != nil {
+		return err
+	}
+	if flexible {
+		err = e.PutCompactArrayLength(len(r.Partitions))
+	} else {
+		err = e.PutArrayLength(len(r.Partitions))
+	}
+	if err != nil {
+		return err
+	}
+	for _, v := range r.Partitions {
+		if err = v.encode(e, version); err != nil {
+			return err
+		}
+	}
+	if flexible {
+		if err = e.PutTaggedFields(r.TaggedFields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *WriteTxnMarkersResponseWritableTxnMarkerTopicResult) decode(d PacketDecoder, version int16) (err error) {
+	flexible := version >= 1
+	var n int
+	if flexible {
+		r.Name, err = d.CompactString()
+	} else {
+		r.Name, err = d.String()
+	}
+	if err != nil {
+		return err
+	}
+	if flexible {
+		n, err = d.CompactArrayLength()
+	} else {
+		n, err = d.ArrayLength()
+	}
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		r.Partitions = make([]*WriteTxnMarkersResponseWritableTxnMarkerPartitionResult, n)
+		for i := range r.Partitions {
+			r.Partitions[i] = new(WriteTxnMarkersResponseWritableTxnMarkerPartitionResult)
+			if err = r.Partitions[i].decode(d, version); err != nil {
+				return err
+			}
+		}
+	}
+	if flexible {
+		if r.TaggedFields, err = d.TaggedFields(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *WriteTxnMarkersResponseWritableTxnMarkerPartitionResult) encode(e PacketEncoder, version int16) (err error) {
+	flexible := version >= 1
+	e.PutInt32(r.PartitionIndex)
+	e.PutInt16(r.ErrorCode)
+	if flexible {
+		if err = e.PutTaggedFields(r.TaggedFields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *WriteTxnMarkersResponseWritableTxnMarkerPartitionResult) decode(d PacketDecoder, version int16) (err error) {
+	flexible := version >= 1
+	if r.PartitionIndex, err = d.Int32(); err != nil {
+		return err
+	}
+	if r.ErrorCode, err = d.Int16(); err != nil {
+		return err
+	}
+	if flexible {
+		if r.TaggedFields, err = d.TaggedFields(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
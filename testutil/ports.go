@@ -0,0 +1,12 @@
+package testutil
+
+import (
+	dynaport "github.com/travisjeffery/go-dynaport"
+)
+
+// Ports returns n free ports for a test's listeners. They're handed out in order from a block of
+// ports locked by the test process, so concurrently running test binaries don't conflict and the
+// servers a test creates get consecutive ports, skipping any in use.
+func Ports(n int) []int {
+	return dynaport.Get(n)
+}
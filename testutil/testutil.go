@@ -9,14 +9,13 @@ import (
 	"testing"
 	"time"
 
-	dynaport "github.com/travisjeffery/go-dynaport"
 	"github.com/travisjeffery/jocko/jocko/config"
 )
 
 func TestConfig(t *testing.T) (string, *config.Config) {
 	dir := tempDir(t, "jocko")
 	config := config.DefaultConfig()
-	ports := dynaport.Get(3)
+	ports := Ports(3)
 	config.NodeName = uniqueNodeName(t.Name())
 	config.Bootstrap = true
 	config.DataDir = dir